@@ -2,10 +2,27 @@ package bchutil
 
 import (
 	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcutil"
 )
 
+// The CashAddr and BitPay address types are btcutil addresses, which can be
+// passed to code written against btcutil.Address.  CashAddr addresses are
+// only created for, and IsForNet only matches, the networks of Prefixes.
+var (
+	_ btcutil.Address = (*CashAddressPubKeyHash)(nil)
+	_ btcutil.Address = (*CashAddressScriptHash)(nil)
+	_ btcutil.Address = (*CashAddressScriptHash32)(nil)
+	_ btcutil.Address = (*CashAddressPubKey)(nil)
+	_ btcutil.Address = (*BitpayAddressPubKeyHash)(nil)
+	_ btcutil.Address = (*BitpayAddressScriptHash)(nil)
+)
+
+// PayToAddrScript returns the script paying to addr, a btcutil, CashAddr or
+// BitPay address.
 func PayToAddrScript(addr btcutil.Address) ([]byte, error) {
 	var script []byte
 	var err error
@@ -23,3 +40,47 @@ func PayToAddrScript(addr btcutil.Address) ([]byte, error) {
 	}
 	return script, errors.New("Unrecognized address format")
 }
+
+// ToCashAddress returns the CashAddr address of net paying to the same script
+// as addr, a CashAddr address, a btcutil or BitPay pay-to-pubkey-hash or
+// pay-to-script-hash address, or a btcutil pay-to-pubkey address.  CashAddr
+// addresses of net are returned as is, and those of other networks, such as
+// the ones of eCash, are re-encoded for net.
+func ToCashAddress(addr btcutil.Address, net *chaincfg.Params) (btcutil.Address, error) {
+	switch addr := addr.(type) {
+	case *CashAddressPubKeyHash, *CashAddressScriptHash, *CashAddressScriptHash32, *CashAddressPubKey:
+		if addr.IsForNet(net) {
+			return addr, nil
+		}
+	}
+	switch addr := addr.(type) {
+	case *CashAddressPubKeyHash, *btcutil.AddressPubKeyHash, *BitpayAddressPubKeyHash:
+		return NewCashAddressPubKeyHash(addr.ScriptAddress(), net)
+	case *CashAddressPubKey, *btcutil.AddressPubKey:
+		return NewCashAddressPubKey(addr.ScriptAddress(), net)
+	case *CashAddressScriptHash, *btcutil.AddressScriptHash, *BitpayAddressScriptHash:
+		return NewCashAddressScriptHashFromHash(addr.ScriptAddress(), net)
+	case *CashAddressScriptHash32:
+		return NewCashAddressScriptHash32FromHash(addr.ScriptAddress(), net)
+	}
+	return nil, fmt.Errorf("no CashAddr address for address type %T", addr)
+}
+
+// ToLegacyAddress returns the btcutil address of net paying to the same
+// script as addr, a CashAddr or BitPay pay-to-pubkey-hash or
+// pay-to-script-hash address or a CashAddr pay-to-pubkey address, which
+// txscript.PayToAddrScript accepts.  There
+// are no legacy addresses of pay-to-script-hash outputs with 32 bytes hashes.
+func ToLegacyAddress(addr btcutil.Address, net *chaincfg.Params) (btcutil.Address, error) {
+	switch addr := addr.(type) {
+	case *btcutil.AddressPubKeyHash, *btcutil.AddressScriptHash, *btcutil.AddressPubKey:
+		return addr, nil
+	case *CashAddressPubKey:
+		return btcutil.NewAddressPubKey(addr.ScriptAddress(), net)
+	case *CashAddressPubKeyHash, *BitpayAddressPubKeyHash:
+		return btcutil.NewAddressPubKeyHash(addr.ScriptAddress(), net)
+	case *CashAddressScriptHash, *BitpayAddressScriptHash:
+		return btcutil.NewAddressScriptHashFromHash(addr.ScriptAddress(), net)
+	}
+	return nil, fmt.Errorf("no legacy address for address type %T", addr)
+}
@@ -0,0 +1,128 @@
+package bchutil
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestAddressConversion(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	key := signingTestKeys()[0]
+	pubKey, _ := btcutil.NewAddressPubKey(key.PubKey().SerializeCompressed(), params)
+	hash := btcutil.Hash160(key.PubKey().SerializeCompressed())
+	redeemScript := []byte{txscript.OP_TRUE}
+
+	cashP2PKH, _ := NewCashAddressPubKeyHash(hash, params)
+	cashP2SH, _ := NewCashAddressScriptHash(redeemScript, params)
+	cashP2PK, _ := NewCashAddressPubKey(key.PubKey().SerializeCompressed(), params)
+	bitpayP2PKH, _ := NewBitpayAddressPubKeyHash(hash, params)
+	legacyP2PKH, _ := btcutil.NewAddressPubKeyHash(hash, params)
+	legacyP2SH, _ := btcutil.NewAddressScriptHash(redeemScript, params)
+
+	for _, test := range []struct {
+		addr, cash, legacy btcutil.Address
+	}{
+		{cashP2PKH, cashP2PKH, legacyP2PKH},
+		{cashP2SH, cashP2SH, legacyP2SH},
+		{bitpayP2PKH, cashP2PKH, legacyP2PKH},
+		{legacyP2PKH, cashP2PKH, legacyP2PKH},
+		{legacyP2SH, cashP2SH, legacyP2SH},
+		{pubKey, cashP2PK, pubKey},
+		{cashP2PK, cashP2PK, pubKey},
+	} {
+		cash, err := ToCashAddress(test.addr, params)
+		if err != nil || cash.EncodeAddress() != test.cash.EncodeAddress() {
+			t.Errorf("%v: got CashAddr %v, %v, want %v", test.addr, cash, err, test.cash)
+			continue
+		}
+		if !cash.IsForNet(params) || cash.IsForNet(&chaincfg.TestNet3Params) {
+			t.Errorf("%v: wrong network", cash)
+		}
+		legacy, err := ToLegacyAddress(test.addr, params)
+		if err != nil || legacy.EncodeAddress() != test.legacy.EncodeAddress() {
+			t.Errorf("%v: got legacy address %v, %v, want %v", test.addr, legacy, err, test.legacy)
+			continue
+		}
+
+		// Our addresses pay to the scripts the btcutil ones do, through
+		// txscript once converted.
+		want, _ := txscript.PayToAddrScript(test.legacy)
+		script, err := PayToAddrScript(cash)
+		if err != nil || !bytes.Equal(script, want) {
+			t.Errorf("%v: got script %x, %v, want %x", cash, script, err, want)
+		}
+		script, err = txscript.PayToAddrScript(legacy)
+		if err != nil || !bytes.Equal(script, want) {
+			t.Errorf("%v: got script %x, %v, want %x", legacy, script, err, want)
+		}
+	}
+
+	p2sh32, _ := NewCashAddressScriptHash32(redeemScript, params)
+	if _, err := ToLegacyAddress(p2sh32, params); err == nil {
+		t.Error("converted P2SH32 address to a legacy address")
+	}
+	if decoded, err := DecodeAddress(cashP2PKH.EncodeAddress(), params); err != nil ||
+		!bytes.Equal(decoded.ScriptAddress(), hash) {
+		t.Errorf("got %v, %v", decoded, err)
+	}
+}
+
+func TestCashAddressPubKey(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	key := signingTestKeys()[0]
+	for _, pubKey := range [][]byte{key.PubKey().SerializeCompressed(), key.PubKey().SerializeUncompressed()} {
+		addr, err := NewCashAddressPubKey(pubKey, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p2pkh, _ := NewCashAddressPubKeyHash(btcutil.Hash160(pubKey), params)
+		if addr.EncodeAddress() != p2pkh.EncodeAddress() || addr.AddressPubKeyHash().EncodeAddress() !=
+			p2pkh.EncodeAddress() {
+			t.Errorf("got encoding %v, want %v", addr, p2pkh)
+		}
+		if !bytes.Equal(addr.ScriptAddress(), pubKey) || !addr.PubKey().IsEqual(key.PubKey()) {
+			t.Errorf("got script address %x", addr.ScriptAddress())
+		}
+
+		want, _ := txscript.NewScriptBuilder().AddData(pubKey).AddOp(txscript.OP_CHECKSIG).Script()
+		pkScript, err := PayToAddrScript(addr)
+		if err != nil || !bytes.Equal(pkScript, want) {
+			t.Errorf("got script %x, %v, want %x", pkScript, err, want)
+		}
+		extracted, err := ExtractPkScriptAddrs(pkScript, params)
+		if p2pk, ok := extracted.(*CashAddressPubKey); err != nil || !ok || !bytes.Equal(p2pk.ScriptAddress(),
+			pubKey) {
+			t.Errorf("got address %#v, %v", extracted, err)
+		}
+
+		tx := engineTestTx(nil)
+		kdb := txscript.KeyClosure(func(btcutil.Address) (*btcec.PrivateKey, bool, error) {
+			return key, false, nil
+		})
+		scriptSig, err := SignTxOutput(params, tx, 0, pkScript, txscript.SigHashAll, kdb, nil, nil, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ops, _ := parseScript(scriptSig); len(ops) != 1 {
+			t.Errorf("got scriptSig %x", scriptSig)
+		}
+		tx.TxIn[0].SignatureScript = scriptSig
+		vm, err := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, 1000)
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			t.Errorf("spending pay-to-pubkey: %v", err)
+		}
+	}
+
+	invalid := append([]byte{0x02}, make([]byte, 32)...)
+	if _, err := NewCashAddressPubKey(invalid, params); err == nil {
+		t.Error("created address of a key off the curve")
+	}
+}
@@ -0,0 +1,239 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// cashAddrHashSizes are the hash sizes of CashAddr payloads, by the size bits
+// of their version byte.
+var cashAddrHashSizes = [8]int{20, 24, 28, 32, 40, 48, 56, 64}
+
+// AddressMatch is a network and type an address string decodes to.
+type AddressMatch struct {
+	// NetName is the name of the network, and Params its parameters, nil
+	// for the networks added to Prefixes directly rather than with
+	// RegisterPrefix.
+	NetName string
+	Params  *chaincfg.Params
+
+	// Prefix is the CashAddr prefix of the network.
+	Prefix string
+
+	// Type is the type of the address and Hash its hash, 20 bytes, or 32
+	// for pay-to-script-hash addresses with a 32 bytes hash.
+	Type AddressType
+	Hash []byte
+
+	// TokenAware tells whether the address is a CashAddr address of the
+	// token-aware types, which wallets must only pay tokens to.
+	TokenAware bool
+
+	// Canonical is the lowercase CashAddr encoding of the address, with
+	// its prefix, token-aware if the address is.
+	Canonical string
+}
+
+// AddressInfo is what can be told of an address string without knowing its
+// network.
+type AddressInfo struct {
+	Input  string
+	Format AddressFormat
+
+	// Matches are the networks the address is valid for, ordered by
+	// prefix then network name.  Legacy addresses share the version bytes
+	// of several networks, and CashAddr addresses without prefix have a
+	// valid checksum under every prefix leaving the checksum in the same
+	// state as theirs, so that more than one match is not an error, but
+	// must be resolved by the caller.
+	Matches []AddressMatch
+}
+
+// Ambiguous returns whether the address is valid for more than one network.
+func (info *AddressInfo) Ambiguous() bool {
+	return len(info.Matches) > 1
+}
+
+// IdentifyAddress decodes s, an address of any network of Prefixes in the
+// CashAddr, legacy or BitPay formats, and returns the networks and types it
+// decodes to.  CashAddr addresses without prefix are checked against every
+// prefix, and legacy addresses against the version bytes of every network.
+// Surrounding spaces are ignored.  Strings that are not addresses fail with an
+// error wrapping ErrInvalidAddress or ErrChecksumMismatch, and strings that
+// are both CashAddr and base58 addresses with ErrAddressCollision.
+func IdentifyAddress(s string) (*AddressInfo, error) {
+	info := &AddressInfo{Input: s}
+	s = strings.TrimSpace(s)
+	cash, cashErr := identifyCashAddr(s)
+	format, base, err := AddressFormatUnknown, []AddressMatch(nil), ErrInvalidAddress
+	if strings.IndexByte(s, ':') < 0 {
+		format, base, err = identifyBase58(s)
+	}
+	switch {
+	case cashErr == nil && err == nil:
+		return nil, ErrAddressCollision
+	case cashErr == nil:
+		info.Format, info.Matches = AddressFormatCashAddr, cash
+	case err == nil:
+		info.Format, info.Matches = format, base
+	case format != AddressFormatUnknown:
+		return nil, err
+	case looksLikeCashAddr(s):
+		return nil, cashErr
+	default:
+		return nil, fmt.Errorf("%w: not a CashAddr, legacy or BitPay address", ErrInvalidAddress)
+	}
+	sort.Slice(info.Matches, func(i, j int) bool {
+		a, b := &info.Matches[i], &info.Matches[j]
+		if a.Prefix != b.Prefix {
+			return a.Prefix < b.Prefix
+		}
+		return a.NetName < b.NetName
+	})
+	return info, nil
+}
+
+// identifyCashAddr returns the matches of s, a CashAddr address with or
+// without prefix.
+func identifyCashAddr(s string) ([]AddressMatch, error) {
+	payload, prefix := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		prefix, payload = s[:i], s[i+1:]
+	}
+	if s != strings.ToLower(s) && s != strings.ToUpper(s) {
+		return nil, fmt.Errorf("%w: mixed case", ErrInvalidAddress)
+	}
+	prefix = strings.ToLower(prefix)
+	if len(payload) <= 8 {
+		return nil, fmt.Errorf("%w: payload too short", ErrInvalidAddress)
+	}
+	values := make(data, len(payload))
+	for i := 0; i < len(payload); i++ {
+		c := payload[i]
+		if c > 127 || CHARSET_REV[c] == -1 {
+			return nil, fmt.Errorf("%w: invalid character %q", ErrInvalidAddress, c)
+		}
+		values[i] = byte(CHARSET_REV[c])
+	}
+	hash, typ, tokenAware, err := unpackCashAddrPayload(values[:len(values)-8])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+
+	var matches []AddressMatch
+	known := false
+	for name, p := range Prefixes {
+		if prefix != "" && p != prefix {
+			continue
+		}
+		known = true
+		if polyModUpdate(polyModUpdate(1, ExpandPrefix(p)), values)^1 != 0 {
+			continue
+		}
+		matches = append(matches, AddressMatch{
+			NetName:    name,
+			Params:     prefixNets[name],
+			Prefix:     p,
+			Type:       typ,
+			Hash:       hash,
+			TokenAware: tokenAware,
+			Canonical:  p + ":" + strings.ToLower(payload),
+		})
+	}
+	switch {
+	case !known:
+		return nil, fmt.Errorf("%w: unknown prefix %q", ErrInvalidAddress, prefix)
+	case len(matches) == 0:
+		return nil, ErrChecksumMismatch
+	}
+	return matches, nil
+}
+
+// unpackCashAddrPayload returns the hash and type of the 5 bits values of a
+// CashAddr payload, without checksum, and whether the type is token-aware.
+// Unlike unpackAddressData, all the hash sizes and the token-aware types are
+// decoded.
+func unpackCashAddrPayload(values data) ([]byte, AddressType, bool, error) {
+	b, err := convertBits(values, 5, 8, false)
+	if err != nil {
+		return nil, P2PKH, false, err
+	}
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		return nil, P2PKH, false, errors.New("invalid version byte")
+	}
+	version := b[0]
+	if size := cashAddrHashSizes[version&0x07]; len(b)-1 != size {
+		return nil, P2PKH, false, fmt.Errorf("%d bytes hash, version byte %#x is for %d bytes", len(b)-1,
+			version, size)
+	}
+	switch version >> 3 {
+	case 0:
+		return b[1:], P2PKH, false, nil
+	case 1:
+		return b[1:], P2SH, false, nil
+	case 2:
+		return b[1:], P2PKH, true, nil
+	case 3:
+		return b[1:], P2SH, true, nil
+	}
+	return nil, P2PKH, false, fmt.Errorf("%w: version byte %#x", ErrUnknownAddressType, version)
+}
+
+// identifyBase58 returns the format and matches of s, a legacy or BitPay
+// address.  The format is known when only the checksum is wrong.
+func identifyBase58(s string) (AddressFormat, []AddressMatch, error) {
+	decoded := base58.Decode(s)
+	if len(decoded) != 1+ripemd160.Size+4 {
+		return AddressFormatUnknown, nil, ErrInvalidAddress
+	}
+	version, hash := decoded[0], decoded[1:1+ripemd160.Size]
+	format := AddressFormatLegacy
+	if version == bitpayP2PkH || version == bitpayP2SH {
+		format = AddressFormatBitPay
+	}
+
+	var matches []AddressMatch
+	for name, prefix := range Prefixes {
+		net := prefixNets[name]
+		if net == nil {
+			continue
+		}
+		typ := P2PKH
+		switch {
+		case format == AddressFormatBitPay && name == chaincfg.MainNetParams.Name:
+			if version == bitpayP2SH {
+				typ = P2SH
+			}
+		case format == AddressFormatLegacy && version == net.PubKeyHashAddrID:
+		case format == AddressFormatLegacy && version == net.ScriptHashAddrID:
+			typ = P2SH
+		default:
+			continue
+		}
+		payload, err := packAddressData(typ, hash)
+		if err != nil {
+			return format, nil, err
+		}
+		matches = append(matches, AddressMatch{
+			NetName:   name,
+			Params:    net,
+			Prefix:    prefix,
+			Type:      typ,
+			Hash:      hash,
+			Canonical: prefix + ":" + Encode(prefix, payload),
+		})
+	}
+	if len(matches) == 0 {
+		return AddressFormatUnknown, nil, ErrInvalidAddress
+	}
+	if _, _, err := base58.CheckDecode(s); err != nil {
+		return format, nil, ErrChecksumMismatch
+	}
+	return format, matches, nil
+}
@@ -0,0 +1,126 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestIdentifyAddress(t *testing.T) {
+	hash := btcutil.Hash160(signingTestKeys()[0].PubKey().SerializeCompressed())
+	cash, _ := NewCashAddressPubKeyHash(hash, &chaincfg.MainNetParams)
+	canonical := "bitcoincash:" + cash.EncodeAddress()
+	legacy, _ := btcutil.NewAddressPubKeyHash(hash, &chaincfg.MainNetParams)
+	testnet, _ := btcutil.NewAddressScriptHashFromHash(hash, &chaincfg.TestNet3Params)
+	bitpay, _ := ToBitpayAddress(cash)
+	tokenPayload, _ := convertBits(append([]byte{0x10}, hash...), 8, 5, true)
+	token := "bitcoincash:" + Encode("bitcoincash", tokenPayload)
+
+	tests := []struct {
+		input      string
+		format     AddressFormat
+		prefixes   []string
+		typ        AddressType
+		tokenAware bool
+	}{
+		{canonical, AddressFormatCashAddr, []string{"bitcoincash"}, P2PKH, false},
+		{strings.ToUpper(cash.EncodeAddress()), AddressFormatCashAddr, []string{"bitcoincash"}, P2PKH, false},
+		{token, AddressFormatCashAddr, []string{"bitcoincash"}, P2PKH, true},
+		{legacy.EncodeAddress(), AddressFormatLegacy, []string{"bitcoincash", "ecash"}, P2PKH, false},
+		{testnet.EncodeAddress(), AddressFormatLegacy, []string{"bchreg", "bchtest", "ectest"}, P2SH, false},
+		{bitpay.EncodeAddress(), AddressFormatBitPay, []string{"bitcoincash"}, P2PKH, false},
+	}
+	for _, test := range tests {
+		info, err := IdentifyAddress(test.input)
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		if info.Format != test.format || len(info.Matches) != len(test.prefixes) {
+			t.Errorf("%s: %v with %d matches, want %v with %d", test.input, info.Format, len(info.Matches),
+				test.format, len(test.prefixes))
+			continue
+		}
+		if info.Ambiguous() != (len(test.prefixes) > 1) {
+			t.Errorf("%s: ambiguous %v", test.input, info.Ambiguous())
+		}
+		for i, m := range info.Matches {
+			if m.Prefix != test.prefixes[i] || m.Type != test.typ || m.TokenAware != test.tokenAware ||
+				!bytes.Equal(m.Hash, hash) {
+				t.Errorf("%s: match %d is %+v", test.input, i, m)
+			}
+			if m.Params == nil || Prefixes[m.Params.Name] != m.Prefix {
+				t.Errorf("%s: match %d has parameters %v", test.input, i, m.Params)
+			}
+			check, err := IdentifyAddress(m.Canonical)
+			if err != nil || len(check.Matches) != 1 || check.Matches[0].Canonical != m.Canonical ||
+				check.Matches[0].Type != m.Type || check.Matches[0].TokenAware != m.TokenAware {
+				t.Errorf("%s: canonical %s does not decode to the match: %v", test.input, m.Canonical, err)
+			}
+		}
+	}
+	if got := mustIdentify(t, token).Matches[0].Canonical; got != token {
+		t.Errorf("token-aware address re-encoded to %s", got)
+	}
+
+	badChecksum := canonical[:len(canonical)-1] + "q"
+	if badChecksum == canonical {
+		badChecksum = canonical[:len(canonical)-1] + "p"
+	}
+	for _, test := range []struct {
+		input string
+		err   error
+	}{
+		{badChecksum, ErrChecksumMismatch},
+		{"unknown:" + cash.EncodeAddress(), ErrInvalidAddress},
+		{"not an address", ErrInvalidAddress},
+		{"", ErrInvalidAddress},
+	} {
+		if _, err := IdentifyAddress(test.input); !errors.Is(err, test.err) {
+			t.Errorf("%q: got error %v, want %v", test.input, err, test.err)
+		}
+	}
+}
+
+func TestIdentifyAddressAmbiguous(t *testing.T) {
+	// The checksum of these prefixes is in the same state after the
+	// prefix, so that every payload is valid under both.
+	nets := []chaincfg.Params{chaincfg.MainNetParams, chaincfg.MainNetParams}
+	nets[0].Name, nets[1].Name = "test-ambiguous-1", "test-ambiguous-2"
+	for i, prefix := range []string{"ffokvixabb", "xezsdxljbf"} {
+		if err := RegisterPrefix(&nets[i], prefix); err != nil {
+			t.Fatal(err)
+		}
+		defer delete(prefixNets, nets[i].Name)
+		defer delete(Prefixes, nets[i].Name)
+	}
+
+	hash := btcutil.Hash160([]byte("ambiguous"))
+	payload, _ := packAddressData(P2SH, hash)
+	addr := Encode("ffokvixabb", payload)
+	info := mustIdentify(t, addr)
+	if !info.Ambiguous() || len(info.Matches) != 2 {
+		t.Fatalf("%d matches", len(info.Matches))
+	}
+	for i, want := range []string{"ffokvixabb:" + addr, "xezsdxljbf:" + addr} {
+		if m := info.Matches[i]; m.Canonical != want || m.Params != &nets[i] || m.Type != P2SH {
+			t.Errorf("match %d is %+v, want %s", i, m, want)
+		}
+	}
+	if info := mustIdentify(t, "xezsdxljbf:"+addr); info.Ambiguous() {
+		t.Errorf("prefixed address is ambiguous")
+	}
+}
+
+func mustIdentify(t *testing.T, s string) *AddressInfo {
+	t.Helper()
+	info, err := IdentifyAddress(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
@@ -0,0 +1,287 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// parallelValidationThreshold is the number of addresses from which
+// ValidateAddresses validates them in parallel.
+const parallelValidationThreshold = 4096
+
+var (
+	// ErrInvalidAddress describes an error where a string is not an address
+	// of any supported format.
+	ErrInvalidAddress = errors.New("invalid address")
+
+	// ErrWrongNetwork describes an error where an address is valid, but for
+	// another network than the one expected.
+	ErrWrongNetwork = errors.New("address for another network")
+)
+
+// AddressFormat is the encoding of an address.
+type AddressFormat int
+
+const (
+	// AddressFormatUnknown is the format of strings that are not addresses.
+	AddressFormatUnknown AddressFormat = iota
+
+	// AddressFormatCashAddr is the CashAddr format, with or without prefix.
+	AddressFormatCashAddr
+
+	// AddressFormatLegacy is the base58 format of Bitcoin addresses.
+	AddressFormatLegacy
+
+	// AddressFormatBitPay is the base58 format of BitPay addresses.
+	AddressFormatBitPay
+)
+
+// String returns the name of the format.
+func (f AddressFormat) String() string {
+	switch f {
+	case AddressFormatUnknown:
+		return "unknown"
+	case AddressFormatCashAddr:
+		return "cashaddr"
+	case AddressFormatLegacy:
+		return "legacy"
+	case AddressFormatBitPay:
+		return "bitpay"
+	}
+	return fmt.Sprintf("AddressFormat(%d)", int(f))
+}
+
+// AddressValidation is the result of the validation of an address.
+type AddressValidation struct {
+	Input string
+
+	// Address is the decoded address, nil if the input is not valid, and
+	// Format the format detected, which is also set for invalid inputs
+	// when it can be told.
+	Address btcutil.Address
+	Format  AddressFormat
+
+	// Canonical is the lowercase CashAddr encoding of the address, with
+	// its prefix.
+	Canonical string
+
+	// Err is the reason the input is not valid: an error wrapping
+	// ErrInvalidAddress, ErrChecksumMismatch, ErrWrongNetwork or
+	// ErrAddressCollision.
+	Err error
+}
+
+// addressValidator validates the addresses of a network, computing the state
+// of the checksum of its CashAddr prefix once.
+type addressValidator struct {
+	params      *chaincfg.Params
+	prefix      string
+	prefixState uint64
+}
+
+// newAddressValidator returns the validator of the addresses of params.
+func newAddressValidator(params *chaincfg.Params) (*addressValidator, error) {
+	prefix, ok := Prefixes[params.Name]
+	if !ok {
+		return nil, errors.New("unknown network parameters")
+	}
+	return &addressValidator{params: params, prefix: prefix,
+		prefixState: polyModUpdate(1, ExpandPrefix(prefix))}, nil
+}
+
+// ValidateAddresses validates inputs, addresses of params in the CashAddr,
+// legacy or, on mainnet, BitPay formats, and returns the results in order.
+// Surrounding spaces are ignored, and strings that are addresses of two
+// formats fail with ErrAddressCollision.  Large batches are validated in
+// parallel.
+func ValidateAddresses(inputs []string, params *chaincfg.Params) ([]AddressValidation, error) {
+	v, err := newAddressValidator(params)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]AddressValidation, len(inputs))
+	workers := 1
+	if len(inputs) >= parallelValidationThreshold {
+		workers = runtime.NumCPU()
+	}
+	chunk := (len(inputs) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < len(inputs); start += chunk {
+		end := start + chunk
+		if end > len(inputs) {
+			end = len(inputs)
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				results[i] = v.validate(inputs[i])
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// ValidateAddressStream validates the addresses returned by next, until it
+// returns io.EOF, like ValidateAddresses, and passes the results to fn, so
+// that inputs need not be held in memory.  Errors of next, other than io.EOF,
+// and of fn stop the validation and are returned.
+func ValidateAddressStream(next func() (string, error), params *chaincfg.Params,
+	fn func(AddressValidation) error) error {
+
+	v, err := newAddressValidator(params)
+	if err != nil {
+		return err
+	}
+	for {
+		input, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(v.validate(input)); err != nil {
+			return err
+		}
+	}
+}
+
+// validate validates an address.
+func (v *addressValidator) validate(input string) AddressValidation {
+	r := AddressValidation{Input: input}
+	s := strings.TrimSpace(input)
+	cash, cashErr := v.decodeCashAddr(s)
+	format, addr, err := AddressFormatUnknown, btcutil.Address(nil), ErrInvalidAddress
+	if strings.IndexByte(s, ':') < 0 {
+		format, addr, err = v.decodeBase58(s)
+	}
+	switch {
+	case cashErr == nil && err == nil:
+		r.Err = ErrAddressCollision
+	case cashErr == nil:
+		r.Format, r.Address = AddressFormatCashAddr, cash
+		r.Canonical = v.prefix + ":" + strings.ToLower(s[strings.IndexByte(s, ':')+1:])
+	case err == nil:
+		r.Format, r.Address = format, addr
+		canonical, err := ToCashAddress(addr, v.params)
+		if err != nil {
+			r.Address, r.Err = nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+			return r
+		}
+		r.Canonical = v.prefix + ":" + canonical.EncodeAddress()
+	case format != AddressFormatUnknown:
+		r.Format, r.Err = format, err
+	case looksLikeCashAddr(s):
+		r.Format, r.Err = AddressFormatCashAddr, cashErr
+	default:
+		r.Err = fmt.Errorf("%w: not a CashAddr, legacy or BitPay address", ErrInvalidAddress)
+	}
+	return r
+}
+
+// looksLikeCashAddr returns whether s is made of a prefix and CashAddr
+// characters, and is meant as a CashAddr address.
+func looksLikeCashAddr(s string) bool {
+	if strings.IndexByte(s, ':') >= 0 {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c > 127 || CHARSET_REV[c] == -1 {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// decodeCashAddr decodes the CashAddr encoding of an address of the network,
+// whose prefix is optional.
+func (v *addressValidator) decodeCashAddr(s string) (btcutil.Address, error) {
+	payload := s
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		if !strings.EqualFold(s[:i], v.prefix) {
+			return nil, fmt.Errorf("%w: prefix %q, want %q", ErrWrongNetwork, s[:i], v.prefix)
+		}
+		payload = s[i+1:]
+	}
+	if s != strings.ToLower(s) && s != strings.ToUpper(s) {
+		return nil, fmt.Errorf("%w: mixed case", ErrInvalidAddress)
+	}
+	if len(payload) <= 8 {
+		return nil, fmt.Errorf("%w: payload too short", ErrInvalidAddress)
+	}
+	values := make(data, len(payload))
+	for i := 0; i < len(payload); i++ {
+		c := payload[i]
+		if c > 127 || CHARSET_REV[c] == -1 {
+			return nil, fmt.Errorf("%w: invalid character %q", ErrInvalidAddress, c)
+		}
+		values[i] = byte(CHARSET_REV[c])
+	}
+	if polyModUpdate(v.prefixState, values)^1 != 0 {
+		return nil, ErrChecksumMismatch
+	}
+	hash, typ, err := unpackAddressData(values[:len(values)-8])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	addr, err := cashAddressFromData(hash, typ, v.params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	return addr, nil
+}
+
+// decodeBase58 decodes the legacy or BitPay encoding of an address of the
+// network, and returns its format, which is known when only the checksum or
+// the network of the address is wrong.
+func (v *addressValidator) decodeBase58(s string) (AddressFormat, btcutil.Address, error) {
+	decoded := base58.Decode(s)
+	if len(decoded) != 1+ripemd160.Size+4 {
+		return AddressFormatUnknown, nil, ErrInvalidAddress
+	}
+	version, hash := decoded[0], decoded[1:1+ripemd160.Size]
+	mainnet := v.params.Name == chaincfg.MainNetParams.Name
+	var format AddressFormat
+	switch {
+	case mainnet && (version == bitpayP2PkH || version == bitpayP2SH):
+		format = AddressFormatBitPay
+	case version == v.params.PubKeyHashAddrID || version == v.params.ScriptHashAddrID:
+		format = AddressFormatLegacy
+	case chaincfg.IsPubKeyHashAddrID(version) || chaincfg.IsScriptHashAddrID(version) ||
+		version == bitpayP2PkH || version == bitpayP2SH:
+		return AddressFormatLegacy, nil, fmt.Errorf("%w: version byte %d", ErrWrongNetwork, version)
+	default:
+		return AddressFormatUnknown, nil, ErrInvalidAddress
+	}
+	checksum := chainhash.DoubleHashB(decoded[:1+ripemd160.Size])[:4]
+	if !bytes.Equal(checksum, decoded[1+ripemd160.Size:]) {
+		return format, nil, ErrChecksumMismatch
+	}
+
+	var addr btcutil.Address
+	var err error
+	switch version {
+	case bitpayP2PkH:
+		addr, err = newBitpayAddressPubKeyHash(hash, version)
+	case bitpayP2SH:
+		addr, err = newBitpayAddressScriptHashFromHash(hash, version)
+	case v.params.PubKeyHashAddrID:
+		addr, err = btcutil.NewAddressPubKeyHash(hash, v.params)
+	default:
+		addr, err = btcutil.NewAddressScriptHashFromHash(hash, v.params)
+	}
+	return format, addr, err
+}
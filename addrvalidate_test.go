@@ -0,0 +1,120 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestValidateAddresses(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	hash := btcutil.Hash160(signingTestKeys()[0].PubKey().SerializeCompressed())
+	cash, _ := NewCashAddressPubKeyHash(hash, params)
+	canonical := "bitcoincash:" + cash.EncodeAddress()
+	legacy, _ := btcutil.NewAddressPubKeyHash(hash, params)
+	bitpay, _ := ToBitpayAddress(cash)
+	p2sh32, _ := NewCashAddressScriptHash32([]byte{1}, params)
+	testnet, _ := btcutil.NewAddressPubKeyHash(hash, &chaincfg.TestNet3Params)
+	badChecksum := canonical[:len(canonical)-1] + "q"
+	if badChecksum == canonical {
+		badChecksum = canonical[:len(canonical)-1] + "p"
+	}
+	badLegacy := []byte(legacy.EncodeAddress())
+	if badLegacy[5] = '2'; legacy.EncodeAddress()[5] == '2' {
+		badLegacy[5] = '3'
+	}
+
+	tests := []struct {
+		input     string
+		format    AddressFormat
+		canonical string
+		err       error
+	}{
+		{canonical, AddressFormatCashAddr, canonical, nil},
+		{cash.EncodeAddress(), AddressFormatCashAddr, canonical, nil},
+		{" " + strings.ToUpper(canonical) + "\n", AddressFormatCashAddr, canonical, nil},
+		{legacy.EncodeAddress(), AddressFormatLegacy, canonical, nil},
+		{bitpay.EncodeAddress(), AddressFormatBitPay, canonical, nil},
+		{"bitcoincash:" + p2sh32.EncodeAddress(), AddressFormatCashAddr,
+			"bitcoincash:" + p2sh32.EncodeAddress(), nil},
+		{badChecksum, AddressFormatCashAddr, "", ErrChecksumMismatch},
+		{string(badLegacy), AddressFormatLegacy, "", ErrChecksumMismatch},
+		{"bchtest:" + cash.EncodeAddress(), AddressFormatCashAddr, "", ErrWrongNetwork},
+		{testnet.EncodeAddress(), AddressFormatLegacy, "", ErrWrongNetwork},
+		{"Bitcoincash:" + cash.EncodeAddress(), AddressFormatCashAddr, "", ErrInvalidAddress},
+		{"not an address", AddressFormatUnknown, "", ErrInvalidAddress},
+		{"", AddressFormatUnknown, "", ErrInvalidAddress},
+	}
+	inputs := make([]string, len(tests))
+	for i, test := range tests {
+		inputs[i] = test.input
+	}
+	results, err := ValidateAddresses(inputs, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		r := results[i]
+		if r.Input != test.input || r.Format != test.format || r.Canonical != test.canonical ||
+			!errors.Is(r.Err, test.err) || (r.Address == nil) != (test.err != nil) {
+			t.Errorf("%q: got %+v", test.input, r)
+		}
+		if test.err == nil {
+			if decoded, err := DecodeAddress(r.Canonical, params); err != nil ||
+				decoded.EncodeAddress() != r.Canonical[len("bitcoincash:"):] {
+				t.Errorf("%q: canonical form %q decodes to %v, %v", test.input, r.Canonical, decoded, err)
+			}
+		}
+	}
+
+	// Large batches are validated in parallel, with the same results.
+	batch := make([]string, parallelValidationThreshold+1)
+	for i := range batch {
+		batch[i] = inputs[i%len(inputs)]
+	}
+	results, _ = ValidateAddresses(batch, params)
+	for i, r := range results {
+		if want := tests[i%len(tests)]; r.Canonical != want.canonical || !errors.Is(r.Err, want.err) {
+			t.Fatalf("input %d: got %+v", i, r)
+		}
+	}
+
+	var streamed []AddressValidation
+	next := 0
+	err = ValidateAddressStream(func() (string, error) {
+		if next == len(inputs) {
+			return "", io.EOF
+		}
+		next++
+		return inputs[next-1], nil
+	}, params, func(r AddressValidation) error {
+		streamed = append(streamed, r)
+		return nil
+	})
+	if err != nil || len(streamed) != len(tests) || streamed[3].Canonical != canonical {
+		t.Errorf("got %d results, %v", len(streamed), err)
+	}
+	stop := fmt.Errorf("stop")
+	err = ValidateAddressStream(func() (string, error) { return canonical, nil }, params,
+		func(AddressValidation) error { return stop })
+	if err != stop {
+		t.Errorf("got %v, want the error of the callback", err)
+	}
+}
+
+func BenchmarkValidateAddresses(b *testing.B) {
+	addr, _ := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.MainNetParams)
+	inputs := make([]string, 1000)
+	for i := range inputs {
+		inputs[i] = "bitcoincash:" + addr.EncodeAddress()
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ValidateAddresses(inputs, &chaincfg.MainNetParams)
+	}
+}
@@ -0,0 +1,106 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+var (
+	// ErrInvalidAmount describes an error where an amount is negative or
+	// exceeds MaxSatoshi.
+	ErrInvalidAmount = errors.New("amount out of range")
+
+	// ErrAmountOverflow describes an error where amounts add up to more than
+	// MaxSatoshi.
+	ErrAmountOverflow = errors.New("amount overflow")
+)
+
+// CheckAmount returns an error wrapping ErrInvalidAmount unless a is between
+// zero and MaxSatoshi.
+func CheckAmount(a btcutil.Amount) error {
+	if a < 0 || a > btcutil.MaxSatoshi {
+		return fmt.Errorf("%w: %d satoshis", ErrInvalidAmount, int64(a))
+	}
+	return nil
+}
+
+// AddChecked returns the sum of the amounts a and b, and an error wrapping
+// ErrAmountOverflow if it exceeds MaxSatoshi.  Amounts out of range fail with
+// ErrInvalidAmount, so the sum never overflows.
+func AddChecked(a, b btcutil.Amount) (btcutil.Amount, error) {
+	if err := CheckAmount(a); err != nil {
+		return 0, err
+	}
+	if err := CheckAmount(b); err != nil {
+		return 0, err
+	}
+	if a+b > btcutil.MaxSatoshi {
+		return 0, fmt.Errorf("%w: %v + %v", ErrAmountOverflow, a, b)
+	}
+	return a + b, nil
+}
+
+// SubChecked returns a minus b, which must be amounts with b at most a: other
+// values fail with ErrInvalidAmount.
+func SubChecked(a, b btcutil.Amount) (btcutil.Amount, error) {
+	if err := CheckAmount(a); err != nil {
+		return 0, err
+	}
+	if err := CheckAmount(b); err != nil {
+		return 0, err
+	}
+	if b > a {
+		return 0, fmt.Errorf("%w: %v - %v is negative", ErrInvalidAmount, a, b)
+	}
+	return a - b, nil
+}
+
+// SumAmounts returns the sum of amounts, as AddChecked does.
+func SumAmounts(amounts []btcutil.Amount) (btcutil.Amount, error) {
+	var sum btcutil.Amount
+	for _, a := range amounts {
+		var err error
+		if sum, err = AddChecked(sum, a); err != nil {
+			return 0, err
+		}
+	}
+	return sum, nil
+}
+
+// CheckTransactionValues checks the values of tx, spending the outputs held
+// by prevOuts: the values of its inputs and outputs must be amounts, each
+// adding up to at most MaxSatoshi, and outputs must not spend more than the
+// inputs, which fails with ErrNegativeFee.
+func CheckTransactionValues(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut) error {
+	in, out, err := txValues(tx, prevOuts)
+	if err != nil {
+		return err
+	}
+	if out > in {
+		return fmt.Errorf("%w by %v", ErrNegativeFee, out-in)
+	}
+	return nil
+}
+
+// txValues returns the total value of the outputs spent by tx, held by
+// prevOuts, and of its outputs.
+func txValues(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut) (in, out btcutil.Amount, err error) {
+	for i := range tx.TxIn {
+		prevOut, ok := prevOuts[i]
+		if !ok || prevOut == nil {
+			return 0, 0, fmt.Errorf("no previous output for input %d", i)
+		}
+		if in, err = AddChecked(in, btcutil.Amount(prevOut.Value)); err != nil {
+			return 0, 0, fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	for i, txOut := range tx.TxOut {
+		if out, err = AddChecked(out, btcutil.Amount(txOut.Value)); err != nil {
+			return 0, 0, fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+	return in, out, nil
+}
@@ -0,0 +1,90 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestCheckedAmounts(t *testing.T) {
+	const max = btcutil.MaxSatoshi
+	tests := []struct {
+		a, b     btcutil.Amount
+		sum, sub btcutil.Amount
+		addErr   error
+		subErr   error
+	}{
+		{5, 3, 8, 2, nil, nil},
+		{max, 0, max, max, nil, nil},
+		{max, 1, 0, max - 1, ErrAmountOverflow, nil},
+		{3, 5, 8, 0, nil, ErrInvalidAmount},
+		{-1, 1, 0, 0, ErrInvalidAmount, ErrInvalidAmount},
+		{1 << 62, 1 << 62, 0, 0, ErrInvalidAmount, ErrInvalidAmount},
+	}
+	for _, test := range tests {
+		sum, err := AddChecked(test.a, test.b)
+		if !errors.Is(err, test.addErr) || (err == nil && sum != test.sum) {
+			t.Errorf("%d + %d: got %d, %v", test.a, test.b, sum, err)
+		}
+		sub, err := SubChecked(test.a, test.b)
+		if !errors.Is(err, test.subErr) || (err == nil && sub != test.sub) {
+			t.Errorf("%d - %d: got %d, %v", test.a, test.b, sub, err)
+		}
+	}
+
+	if sum, err := SumAmounts([]btcutil.Amount{1, 2, 3}); err != nil || sum != 6 {
+		t.Errorf("got %d, %v", sum, err)
+	}
+	if _, err := SumAmounts([]btcutil.Amount{max / 2, max / 2, max / 2}); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("got %v, want ErrAmountOverflow", err)
+	}
+}
+
+func TestCheckTransactionValues(t *testing.T) {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	prevOuts := make(map[int]*wire.TxOut)
+	for i := 0; i < 2; i++ {
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(i)}, 0), nil, nil))
+		prevOuts[i] = wire.NewTxOut(1000, nil)
+	}
+	tx.AddTxOut(wire.NewTxOut(1500, nil))
+	if err := CheckTransactionValues(tx, prevOuts); err != nil {
+		t.Fatal(err)
+	}
+
+	tx.TxOut[0].Value = 2500
+	if err := CheckTransactionValues(tx, prevOuts); !errors.Is(err, ErrNegativeFee) {
+		t.Errorf("got %v, want ErrNegativeFee", err)
+	}
+	tx.TxOut[0].Value = -1
+	if err := CheckTransactionValues(tx, prevOuts); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("got %v, want ErrInvalidAmount", err)
+	}
+
+	// Adversarial previous outputs whose sum overflows int64.
+	tx.TxOut[0].Value = 1500
+	prevOuts[0].Value, prevOuts[1].Value = btcutil.MaxSatoshi, btcutil.MaxSatoshi
+	if err := CheckTransactionValues(tx, prevOuts); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("got %v, want ErrAmountOverflow", err)
+	}
+	if _, err := TxFee(tx, prevOuts); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("TxFee: got %v, want ErrAmountOverflow", err)
+	}
+	delete(prevOuts, 1)
+	if err := CheckTransactionValues(tx, prevOuts); err == nil {
+		t.Error("missing previous output")
+	}
+}
+
+func TestLargestFirstOverflow(t *testing.T) {
+	utxos := []UTXO{
+		{OutPoint: wire.OutPoint{Index: 0}, Amount: btcutil.MaxSatoshi},
+		{OutPoint: wire.OutPoint{Index: 1}, Amount: btcutil.MaxSatoshi},
+	}
+	if _, err := (LargestFirst{}).SelectCoins(utxos, btcutil.MaxSatoshi+1); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("got %v, want ErrAmountOverflow", err)
+	}
+}
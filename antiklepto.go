@@ -0,0 +1,158 @@
+package bchutil
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+var (
+	// s2cDataTag and s2cPointTag are the tags of the hashes of the
+	// secp256k1-zkp anti-exfil protocol.  They are used for both ECDSA and
+	// Schnorr signatures.
+	s2cDataTag  = []byte("s2c/ecdsa/data")
+	s2cPointTag = []byte("s2c/ecdsa/point")
+)
+
+var (
+	// ErrNonceCommitment describes an error where the nonce of an
+	// anti-klepto signature is not the one the signer committed to, tweaked
+	// by the host nonce.  The signer must be considered malicious.
+	ErrNonceCommitment = errors.New("signature nonce does not match the signer commitment")
+
+	// ErrInvalidSignature describes an error where a signature does not
+	// verify.
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// taggedHash returns sha256(sha256(tag) || sha256(tag) || data...).
+func taggedHash(tag []byte, data ...[]byte) [32]byte {
+	tagHash := sha256.Sum256(tag)
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	var out [32]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// hostCommitment returns the commitment of the host to its nonce.
+func hostCommitment(hostNonce [32]byte) [32]byte {
+	return taggedHash(s2cDataTag, hostNonce[:])
+}
+
+// nonceTweak returns the scalar added to the committed nonce of the signer:
+// the tagged hash of the commitment and the host nonce.
+func nonceTweak(commitment []byte, hostNonce [32]byte) *big.Int {
+	t := taggedHash(s2cPointTag, commitment, hostNonce[:])
+	tweak := new(big.Int).SetBytes(t[:])
+	return tweak.Mod(tweak, btcec.S256().N)
+}
+
+// GenerateHostNonce returns a random host nonce for one anti-klepto
+// signature.  A nonce must never be reused.
+func GenerateHostNonce() ([32]byte, error) {
+	var nonce [32]byte
+	_, err := rand.Read(nonce[:])
+	return nonce, err
+}
+
+// NonceCommitmentChallenge is sent by the host to the signer in the first
+// round of the anti-klepto protocol.  It commits to the host nonce without
+// revealing it.
+type NonceCommitmentChallenge struct {
+	SigHash        []byte
+	HostCommitment [32]byte
+}
+
+// BuildNonceCommitmentChallenge returns the challenge asking the signer to
+// commit to its nonce for sighash.
+func BuildNonceCommitmentChallenge(hostNonce [32]byte, sighash []byte) (*NonceCommitmentChallenge, error) {
+	if len(sighash) != 32 {
+		return nil, errors.New("sighash must be 32 bytes")
+	}
+	return &NonceCommitmentChallenge{
+		SigHash:        append([]byte(nil), sighash...),
+		HostCommitment: hostCommitment(hostNonce),
+	}, nil
+}
+
+// VerifyAntiKleptoSignature checks that sig is a valid signature of sighash
+// by pubKey whose nonce is the nonce committed to by the signer in
+// deviceCommitment, tweaked by hostNonce.  As in consensus, 64 byte
+// signatures are Schnorr signatures and the others DER encoded ECDSA ones,
+// both without sighash type.
+//
+// This check is what makes the protocol useful: a signer choosing its nonce to
+// leak its key produces signatures that are valid but fail it with
+// ErrNonceCommitment.
+func VerifyAntiKleptoSignature(sig []byte, pubKey *btcec.PublicKey, sighash []byte,
+	hostNonce [32]byte, deviceCommitment []byte) error {
+
+	curve := btcec.S256()
+	r0, err := btcec.ParsePubKey(deviceCommitment, curve)
+	if err != nil {
+		return fmt.Errorf("invalid signer commitment: %v", err)
+	}
+	commitment := r0.SerializeCompressed()
+
+	// R = R0 + t*G.  Schnorr signers negate the nonce when R.y is not a
+	// quadratic residue, and ECDSA only keeps R.x, so only the x coordinate
+	// is compared.
+	tx, ty := curve.ScalarBaseMult(nonceTweak(commitment, hostNonce).Bytes())
+	rx, _ := curve.Add(r0.X, r0.Y, tx, ty)
+
+	var r *big.Int
+	if len(sig) == SchnorrSignatureLen {
+		if !VerifySchnorr(pubKey, sighash, sig) {
+			return ErrInvalidSignature
+		}
+		r = new(big.Int).SetBytes(sig[:32])
+	} else {
+		s, err := btcec.ParseDERSignature(sig, curve)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+		}
+		if !s.Verify(sighash, pubKey) {
+			return ErrInvalidSignature
+		}
+		r = s.R
+		rx.Mod(rx, curve.N)
+	}
+	if r.Cmp(rx) != 0 {
+		return ErrNonceCommitment
+	}
+	return nil
+}
+
+// SignAntiKlepto runs the host side of the anti-klepto protocol with signer
+// and returns the signature of sighash after verifying it.
+func SignAntiKlepto(signer AntiKleptoSigner, sighash []byte, opts *SignerOpts) ([]byte, error) {
+	hostNonce, err := GenerateHostNonce()
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := BuildNonceCommitmentChallenge(hostNonce, sighash)
+	if err != nil {
+		return nil, err
+	}
+	commitment, err := signer.CommitNonce(challenge, opts)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signer.SignWithHostNonce(challenge, hostNonce, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyAntiKleptoSignature(sig, signer.PubKey(), sighash, hostNonce, commitment); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
@@ -0,0 +1,90 @@
+package bchutil
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// leakySigner commits honestly but signs with a nonce of its choice, as a
+// device exfiltrating its key would.
+type leakySigner struct {
+	*PrivKeySigner
+}
+
+func (s *leakySigner) SignWithHostNonce(challenge *NonceCommitmentChallenge, hostNonce [32]byte,
+	opts *SignerOpts) ([]byte, error) {
+
+	k := big.NewInt(42)
+	if opts != nil && opts.Schnorr {
+		return signSchnorrWithNonce(s.Key.D, s.Key.PubKey(), challenge.SigHash, k), nil
+	}
+	return signECDSAWithNonce(s.Key.D, challenge.SigHash, k).Serialize(), nil
+}
+
+func TestAntiKlepto(t *testing.T) {
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte("anti-klepto test key"))
+	signer := NewPrivKeySigner(key)
+	sighash := sha256.Sum256([]byte("sighash"))
+
+	for _, opts := range []*SignerOpts{nil, {Schnorr: true}} {
+		sig, err := SignAntiKlepto(signer, sighash[:], opts)
+		if err != nil {
+			t.Fatalf("opts %+v: %v", opts, err)
+		}
+		if opts != nil && !VerifySchnorr(key.PubKey(), sighash[:], sig) {
+			t.Error("Schnorr signature does not verify")
+		}
+
+		// Two runs use different host nonces, hence different
+		// signatures.
+		again, _ := SignAntiKlepto(signer, sighash[:], opts)
+		if string(again) == string(sig) {
+			t.Error("host nonce did not change the signature")
+		}
+
+		if _, err := SignAntiKlepto(&leakySigner{signer}, sighash[:], opts); err != ErrNonceCommitment {
+			t.Errorf("leaky signer: expected ErrNonceCommitment, got %v", err)
+		}
+	}
+}
+
+func TestVerifyAntiKleptoSignature(t *testing.T) {
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte("anti-klepto test key"))
+	signer := NewPrivKeySigner(key)
+	sighash := sha256.Sum256([]byte("sighash"))
+
+	hostNonce, _ := GenerateHostNonce()
+	challenge, err := BuildNonceCommitmentChallenge(hostNonce, sighash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitment, _ := signer.CommitNonce(challenge, nil)
+	sig, err := signer.SignWithHostNonce(challenge, hostNonce, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAntiKleptoSignature(sig, key.PubKey(), sighash[:], hostNonce, commitment); err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := GenerateHostNonce()
+	if err := VerifyAntiKleptoSignature(sig, key.PubKey(), sighash[:], other, commitment); err != ErrNonceCommitment {
+		t.Errorf("wrong host nonce: expected ErrNonceCommitment, got %v", err)
+	}
+	if err := VerifyAntiKleptoSignature(sig, key.PubKey(), make([]byte, 32), hostNonce, commitment); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong sighash: expected ErrInvalidSignature, got %v", err)
+	}
+	if _, err := signer.SignWithHostNonce(challenge, other, nil); err == nil {
+		t.Error("signer accepted a host nonce not matching the commitment")
+	}
+
+	// A plain signature does not use the committed nonce.
+	plain, _ := signer.SignDigest(sighash[:], nil)
+	if err := VerifyAntiKleptoSignature(plain, key.PubKey(), sighash[:], hostNonce, commitment); err != ErrNonceCommitment {
+		t.Errorf("plain signature: expected ErrNonceCommitment, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package bchutil
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// ErrInvalidASM describes an error where a script in ASM can't be assembled.
+var ErrInvalidASM = errors.New("invalid script ASM")
+
+// bchOpcodeNames are the names of the opcodes Bitcoin Cash re-enabled or added
+// since 2018 in slots btcd names differently: the May 2018 and November 2018
+// opcodes, OP_REVERSEBYTES of May 2020, and the native introspection opcodes
+// of May 2022 and May 2023.
+var bchOpcodeNames = map[byte]string{
+	opSplit:              "OP_SPLIT",
+	opNum2Bin:            "OP_NUM2BIN",
+	opBin2Num:            "OP_BIN2NUM",
+	opCheckDataSig:       "OP_CHECKDATASIG",
+	opCheckDataSigVerify: "OP_CHECKDATASIGVERIFY",
+	opReverseBytes:       "OP_REVERSEBYTES",
+
+	0xc0: "OP_INPUTINDEX",
+	0xc1: "OP_ACTIVEBYTECODE",
+	0xc2: "OP_TXVERSION",
+	0xc3: "OP_TXINPUTCOUNT",
+	0xc4: "OP_TXOUTPUTCOUNT",
+	0xc5: "OP_TXLOCKTIME",
+	0xc6: "OP_UTXOVALUE",
+	0xc7: "OP_UTXOBYTECODE",
+	0xc8: "OP_OUTPOINTTXHASH",
+	0xc9: "OP_OUTPOINTINDEX",
+	0xca: "OP_INPUTBYTECODE",
+	0xcb: "OP_INPUTSEQUENCENUMBER",
+	0xcc: "OP_OUTPUTVALUE",
+	0xcd: "OP_OUTPUTBYTECODE",
+	0xce: "OP_UTXOTOKENCATEGORY",
+	0xcf: "OP_UTXOTOKENCOMMITMENT",
+	0xd0: "OP_UTXOTOKENAMOUNT",
+	0xd1: "OP_OUTPUTTOKENCATEGORY",
+	0xd2: "OP_OUTPUTTOKENCOMMITMENT",
+	0xd3: "OP_OUTPUTTOKENAMOUNT",
+}
+
+// opcodeNames are the names of the opcodes, and opcodeByName maps the names,
+// aliases such as OP_NOP2 included, to their value.
+var opcodeNames, opcodeByName = func() ([256]string, map[string]byte) {
+	var names [256]string
+	byName := make(map[string]byte, len(txscript.OpcodeByName))
+	aliases := map[string]bool{"OP_FALSE": true, "OP_TRUE": true, "OP_NOP2": true, "OP_NOP3": true}
+	for name, op := range txscript.OpcodeByName {
+		if _, ok := bchOpcodeNames[op]; ok {
+			continue
+		}
+		byName[name] = op
+		if !aliases[name] {
+			names[op] = name
+		}
+	}
+	for op, name := range bchOpcodeNames {
+		byName[name] = op
+		names[op] = name
+	}
+	return names, byName
+}()
+
+// ParseASM assembles the space separated tokens of asm, which are:
+//
+//   - opcode names, such as OP_CHECKSIG or OP_CHECKDATASIG
+//   - decimal numbers, pushed minimally: 0 to 16 and -1 with OP_0 to OP_16
+//     and OP_1NEGATE, others as script numbers
+//   - hex data prefixed with 0x, pushed minimally
+//   - data push opcodes followed by hex data, such as OP_PUSHDATA1 0x0102,
+//     pushing it with that opcode
+//
+// Errors wrap ErrInvalidASM and give the position of the token, starting at
+// 0.
+func ParseASM(asm string) ([]byte, error) {
+	tokens := strings.Fields(asm)
+	var script []byte
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%w: token %d %q: %s", ErrInvalidASM, i, token, fmt.Sprintf(format, args...))
+		}
+
+		if strings.HasPrefix(token, "0x") {
+			data, err := hex.DecodeString(token[2:])
+			if err != nil {
+				return nil, fail("invalid hex data")
+			}
+			script = append(script, minimalPush(data)...)
+			continue
+		}
+		if n, err := strconv.ParseInt(token, 10, 64); err == nil {
+			if n == -n && n != 0 {
+				return nil, fail("number out of range")
+			}
+			script = append(script, minimalPush(scriptNum(n).Bytes())...)
+			continue
+		}
+
+		op, ok := opcodeByName[token]
+		if !ok {
+			return nil, fail("unknown opcode")
+		}
+		if op == txscript.OP_0 || op > txscript.OP_PUSHDATA4 {
+			script = append(script, op)
+			continue
+		}
+		if i+1 == len(tokens) || !strings.HasPrefix(tokens[i+1], "0x") {
+			return nil, fail("data push without hex data")
+		}
+		data, err := hex.DecodeString(tokens[i+1][2:])
+		if err != nil {
+			return nil, fail("invalid hex data")
+		}
+		push, err := encodePush(op, data)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		script = append(script, push...)
+		i++
+	}
+	return script, nil
+}
+
+// encodePush returns the push of data with the data push opcode op.
+func encodePush(op byte, data []byte) ([]byte, error) {
+	n := len(data)
+	switch {
+	case op <= txscript.OP_DATA_75:
+		if int(op) != n {
+			return nil, fmt.Errorf("%d bytes of data", n)
+		}
+		return append([]byte{op}, data...), nil
+	case op == txscript.OP_PUSHDATA1 && n <= 0xff:
+		return append([]byte{op, byte(n)}, data...), nil
+	case op == txscript.OP_PUSHDATA2 && n <= 0xffff:
+		return append([]byte{op, byte(n), byte(n >> 8)}, data...), nil
+	case op == txscript.OP_PUSHDATA4:
+		return append([]byte{op, byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)}, data...), nil
+	}
+	return nil, fmt.Errorf("%d bytes of data", n)
+}
+
+// DisasmASM returns the ASM of script, which ParseASM assembles back to
+// script.  Minimal pushes are written as numbers, for OP_0 to OP_16 and
+// OP_1NEGATE, or hex data, and other pushes with their opcode followed by
+// their data.  Truncated scripts fail with an error wrapping
+// ErrMalformedPush.
+func DisasmASM(script []byte) (string, error) {
+	ops, err := parseScript(script)
+	if err != nil {
+		return "", err
+	}
+	tokens := make([]string, len(ops))
+	for i := range ops {
+		tokens[i] = ops[i].asm()
+	}
+	return strings.Join(tokens, " "), nil
+}
+
+// asm returns the ASM of the opcode, as written by DisasmASM.
+func (op *parsedOpcode) asm() string {
+	switch {
+	case op.value == txscript.OP_0:
+		return "0"
+	case op.value == txscript.OP_1NEGATE:
+		return "-1"
+	case op.value >= txscript.OP_1 && op.value <= txscript.OP_16:
+		return strconv.Itoa(int(op.value - txscript.OP_1 + 1))
+	case op.value > txscript.OP_PUSHDATA4:
+		return opcodeNames[op.value]
+	case op.isMinimalPush():
+		return "0x" + hex.EncodeToString(op.data)
+	}
+	return opcodeNames[op.value] + " 0x" + hex.EncodeToString(op.data)
+}
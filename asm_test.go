@@ -0,0 +1,96 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestParseASM(t *testing.T) {
+	hash := strings.Repeat("89", 20)
+	for i, test := range []struct {
+		asm    string
+		script string
+	}{
+		{"OP_DUP OP_HASH160 0x" + hash + " OP_EQUALVERIFY OP_CHECKSIG", "76a914" + hash + "88ac"},
+		{"0 1 16 -1 17 1000 -1000", "0051604f" + "0111" + "02e803" + "02e883"},
+		{"OP_CAT OP_SPLIT OP_NUM2BIN OP_BIN2NUM OP_CHECKDATASIG OP_CHECKDATASIGVERIFY OP_REVERSEBYTES",
+			"7e7f8081babbbc"},
+		{"OP_INPUTINDEX OP_ACTIVEBYTECODE OP_UTXOTOKENCATEGORY OP_OUTPUTTOKENAMOUNT", "c0c1ced3"},
+		{"OP_NOP2 OP_CHECKLOCKTIMEVERIFY OP_CHECKSEQUENCEVERIFY OP_FALSE OP_TRUE", "b1b1b20051"},
+		{"OP_DATA_1 0x05 OP_PUSHDATA1 0x0102 OP_PUSHDATA2 0x OP_PUSHDATA4 0xff", "0105" + "4c020102" +
+			"4d0000" + "4e01000000ff"},
+		{"0x 0x05 0x81", "00554f"},
+		{"  ", ""},
+	} {
+		script, err := ParseASM(test.asm)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if got := hex.EncodeToString(script); got != test.script {
+			t.Errorf("test %d: got %s, want %s", i, got, test.script)
+		}
+	}
+
+	for i, test := range []struct {
+		asm      string
+		position string
+	}{
+		{"OP_DUP OP_FOO", "token 1"},
+		{"OP_1 0xabc", "token 1"},
+		{"OP_1 OP_2 OP_PUSHDATA1", "token 2"},
+		{"OP_DATA_2 0x01", "token 0"},
+		{"OP_PUSHDATA1 OP_1", "token 0"},
+		{"-9223372036854775808", "token 0"},
+		{"OP_SUBSTR", "token 0"},
+	} {
+		_, err := ParseASM(test.asm)
+		if !errors.Is(err, ErrInvalidASM) || !strings.Contains(err.Error(), test.position) {
+			t.Errorf("test %d: got %v, want ErrInvalidASM at %s", i, err, test.position)
+		}
+	}
+}
+
+func TestDisasmASM(t *testing.T) {
+	p2pkh, _ := payToPubKeyHashScript(bytes.Repeat([]byte{0x89}, 20))
+	asm, err := DisasmASM(p2pkh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "OP_DUP OP_HASH160 0x" + strings.Repeat("89", 20) + " OP_EQUALVERIFY OP_CHECKSIG"; asm != want {
+		t.Errorf("got %s, want %s", asm, want)
+	}
+
+	// Every script parses back to the same bytes, whatever its pushes.
+	scripts := [][]byte{
+		{txscript.OP_0, txscript.OP_1NEGATE, txscript.OP_16, txscript.OP_RESERVED, 0xba, 0xc0, 0xd3, 0xff},
+		{txscript.OP_DATA_1, 5, txscript.OP_DATA_1, 0x81, txscript.OP_PUSHDATA1, 0, txscript.OP_PUSHDATA2, 1, 0, 7},
+		append([]byte{txscript.OP_PUSHDATA4, 76, 0, 0, 0}, make([]byte, 76)...),
+		append([]byte{txscript.OP_PUSHDATA1, 76}, make([]byte, 76)...),
+	}
+	for op := 0; op < 256; op++ {
+		if op <= txscript.OP_PUSHDATA4 && op != txscript.OP_0 {
+			continue
+		}
+		scripts = append(scripts, []byte{byte(op)})
+	}
+	for i, script := range scripts {
+		asm, err := DisasmASM(script)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		got, err := ParseASM(asm)
+		if err != nil || !bytes.Equal(got, script) {
+			t.Errorf("test %d: %q assembles to %x, %v, want %x", i, asm, got, err, script)
+		}
+	}
+
+	if _, err := DisasmASM([]byte{txscript.OP_DATA_2, 1}); !errors.Is(err, ErrMalformedPush) {
+		t.Errorf("got %v, want ErrMalformedPush", err)
+	}
+}
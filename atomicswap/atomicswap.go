@@ -0,0 +1,243 @@
+// Package atomicswap builds the hash time-locked contracts of cross-chain
+// atomic swaps.
+//
+// A contract locks funds behind a pay-to-script-hash output that the
+// recipient spends by revealing the secret whose SHA-256 the contract commits
+// to, or that the refund key spends once the contract locktime is reached.
+// Each party of a swap funds a contract on its chain with the same secret
+// hash; the initiator, who knows the secret, redeems the contract of the
+// participant and so reveals the secret, which the participant extracts with
+// ExtractSecret to redeem the contract of the initiator.  The locktime of the
+// initiator contract must be later than the locktime of the participant
+// contract, so that the participant can't refund before the initiator
+// redeemed.
+package atomicswap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// SecretSize is the size of the secrets of contracts, enforced by their
+// script so that the secret is valid on chains with smaller push limits.
+const SecretSize = 32
+
+// maxSigSize is the size of the largest signature pushed by the scriptSigs of
+// the contracts, a DER encoded ECDSA signature with its sighash type.
+const maxSigSize = 73
+
+var (
+	// ErrWrongSecret describes an error where a secret is not the secret
+	// of the hash of a contract.
+	ErrWrongSecret = errors.New("secret does not match the secret hash")
+
+	// ErrWrongKey describes an error where the key signing a spend of a
+	// contract is not the key of the branch spent.
+	ErrWrongKey = errors.New("key does not match the contract")
+
+	// ErrNoSecret describes an error where a transaction does not reveal the
+	// secret of a contract.
+	ErrNoSecret = errors.New("no secret revealed")
+)
+
+// HTLC is a hash time-locked contract.  Its script is
+//
+//	OP_IF
+//		OP_SIZE 32 OP_EQUALVERIFY OP_SHA256 <secret hash> OP_EQUALVERIFY
+//		<recipient pubkey>
+//	OP_ELSE
+//		<locktime> OP_CHECKLOCKTIMEVERIFY OP_DROP <refund pubkey>
+//	OP_ENDIF
+//	OP_CHECKSIG
+//
+// redeemed with the scriptSig <sig> <secret> OP_TRUE <script> and refunded
+// with <sig> OP_FALSE <script>.
+type HTLC struct {
+	recipientPub []byte
+	refundPub    []byte
+	secretHash   [32]byte
+	locktime     uint32
+
+	script   []byte
+	pkScript []byte
+}
+
+// NewHTLC returns the contract paying the recipient, with the serialized public
+// key recipientPub, given the secret of secretHash, or refunding the refund
+// key after locktime, a block height or a time as transaction locktimes.
+func NewHTLC(recipientPub, refundPub []byte, secretHash [32]byte, locktime uint32) (*HTLC, error) {
+	for _, pubKey := range [][]byte{recipientPub, refundPub} {
+		if _, err := btcec.ParsePubKey(pubKey, btcec.S256()); err != nil {
+			return nil, fmt.Errorf("public key %x: %v", pubKey, err)
+		}
+	}
+	if locktime == 0 {
+		return nil, errors.New("contract without locktime")
+	}
+	h := &HTLC{recipientPub: append([]byte(nil), recipientPub...), refundPub: append([]byte(nil), refundPub...),
+		secretHash: secretHash, locktime: locktime}
+	var err error
+	h.script, err = txscript.NewScriptBuilder().
+		AddOp(txscript.OP_IF).
+		AddOp(txscript.OP_SIZE).AddInt64(SecretSize).AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_SHA256).AddData(secretHash[:]).AddOp(txscript.OP_EQUALVERIFY).
+		AddData(h.recipientPub).
+		AddOp(txscript.OP_ELSE).
+		AddInt64(int64(locktime)).AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).AddOp(txscript.OP_DROP).
+		AddData(h.refundPub).
+		AddOp(txscript.OP_ENDIF).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		return nil, err
+	}
+	h.pkScript, err = txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).
+		AddData(btcutil.Hash160(h.script)).AddOp(txscript.OP_EQUAL).Script()
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Script returns the contract script, the redeem script of its outputs.
+func (h *HTLC) Script() []byte {
+	return h.script
+}
+
+// PkScript returns the pay-to-script-hash script of the contract outputs.
+func (h *HTLC) PkScript() []byte {
+	return h.pkScript
+}
+
+// Address returns the pay-to-script-hash address of the contract on the
+// network of params.
+func (h *HTLC) Address(params *chaincfg.Params) (btcutil.Address, error) {
+	return bchutil.NewCashAddressScriptHash(h.script, params)
+}
+
+// SecretHash returns the SHA-256 of the secret redeeming the contract.
+func (h *HTLC) SecretHash() [32]byte {
+	return h.secretHash
+}
+
+// LockTime returns the locktime after which the contract is refunded.
+func (h *HTLC) LockTime() uint32 {
+	return h.locktime
+}
+
+// BuildContractTx returns the unsigned transaction funding the contract with
+// amount from utxos, paying feeRate and sending the change to changeScript.
+// The transaction is signed with UnsignedTx.Sign.
+func (h *HTLC) BuildContractTx(utxos []bchutil.UTXO, amount btcutil.Amount, changeScript []byte,
+	feeRate bchutil.FeeRate) (*bchutil.UnsignedTx, error) {
+
+	b := bchutil.NewTxBuilder(feeRate, changeScript)
+	b.AddUTXOs(utxos...)
+	b.AddOutput(wire.NewTxOut(int64(amount), h.pkScript))
+	return b.Build()
+}
+
+// BuildRedeemTx returns the transaction spending contract, an output of the
+// contract, to payTo with the secret and the recipient key, paying feeRate.
+// The options are those of bchutil.SignInput.
+func (h *HTLC) BuildRedeemTx(contract bchutil.UTXO, secret []byte, key *btcec.PrivateKey, payTo []byte,
+	feeRate bchutil.FeeRate, opts ...bchutil.SignOption) (*wire.MsgTx, error) {
+
+	if sha256.Sum256(secret) != h.secretHash || len(secret) != SecretSize {
+		return nil, ErrWrongSecret
+	}
+	if !isKey(key, h.recipientPub) {
+		return nil, fmt.Errorf("%w: not the recipient key", ErrWrongKey)
+	}
+	// Redeeming is not restricted by the locktime of the contract.
+	tx, err := h.spendTx(contract, payTo, feeRate, 0, wire.MaxTxInSequenceNum, SecretSize+1+1)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := bchutil.SignInput(tx, 0, h.script, bchutil.SigHashAllForkID, key, int64(contract.Amount), opts...)
+	if err != nil {
+		return nil, err
+	}
+	tx.TxIn[0].SignatureScript, err = txscript.NewScriptBuilder().AddData(sig).AddData(secret).
+		AddOp(txscript.OP_TRUE).AddData(h.script).Script()
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// BuildRefundTx returns the transaction spending contract, an output of the
+// contract, to payTo with the refund key, paying feeRate.  Its locktime is
+// the locktime of the contract, so it can't be mined before.  The options are
+// those of bchutil.SignInput.
+func (h *HTLC) BuildRefundTx(contract bchutil.UTXO, key *btcec.PrivateKey, payTo []byte,
+	feeRate bchutil.FeeRate, opts ...bchutil.SignOption) (*wire.MsgTx, error) {
+
+	if !isKey(key, h.refundPub) {
+		return nil, fmt.Errorf("%w: not the refund key", ErrWrongKey)
+	}
+	// OP_CHECKLOCKTIMEVERIFY fails for final inputs.
+	tx, err := h.spendTx(contract, payTo, feeRate, h.locktime, wire.MaxTxInSequenceNum-1, 1)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := bchutil.SignInput(tx, 0, h.script, bchutil.SigHashAllForkID, key, int64(contract.Amount), opts...)
+	if err != nil {
+		return nil, err
+	}
+	tx.TxIn[0].SignatureScript, err = txscript.NewScriptBuilder().AddData(sig).AddOp(txscript.OP_FALSE).
+		AddData(h.script).Script()
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// spendTx returns the unsigned transaction spending contract to payTo with
+// locktime and sequence, whose fee at feeRate covers a scriptSig of a
+// signature, branchSize bytes selecting the branch and the contract script.
+func (h *HTLC) spendTx(contract bchutil.UTXO, payTo []byte, feeRate bchutil.FeeRate, locktime uint32,
+	sequence uint32, branchSize int) (*wire.MsgTx, error) {
+
+	if !bytes.Equal(contract.PkScript, h.pkScript) {
+		return nil, errors.New("output not paying to the contract")
+	}
+	if contract.HasTokens() {
+		return nil, errors.New("contract output carries tokens")
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.LockTime = locktime
+	txIn := wire.NewTxIn(&contract.OutPoint, nil, nil)
+	txIn.Sequence = sequence
+	tx.AddTxIn(txIn)
+	txOut := wire.NewTxOut(0, payTo)
+	tx.AddTxOut(txOut)
+
+	// The script, of less than 256 bytes, is pushed with OP_PUSHDATA1 when
+	// longer than 75 bytes.
+	scriptSigSize := 1 + maxSigSize + branchSize + 1 + len(h.script)
+	if len(h.script) > txscript.OP_DATA_75 {
+		scriptSigSize++
+	}
+	fee := feeRate.Fee(tx.SerializeSize() + bchutil.EstimateInputSize(scriptSigSize) - bchutil.EstimateInputSize(0))
+	txOut.Value = int64(contract.Amount - fee)
+	if bchutil.IsDust(txOut) {
+		return nil, fmt.Errorf("%w: contract of %v, fee of %v", bchutil.ErrInsufficientFunds, contract.Amount, fee)
+	}
+	return tx, nil
+}
+
+// isKey returns whether pubKey is the serialized public key of key.
+func isKey(key *btcec.PrivateKey, pubKey []byte) bool {
+	return bytes.Equal(key.PubKey().SerializeCompressed(), pubKey) ||
+		bytes.Equal(key.PubKey().SerializeUncompressed(), pubKey)
+}
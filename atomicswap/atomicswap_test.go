@@ -0,0 +1,175 @@
+package atomicswap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testContract returns a contract with its recipient and refund keys and
+// secret, and an output paying to it.
+func testContract(t *testing.T) (*HTLC, []*btcec.PrivateKey, []byte, bchutil.UTXO) {
+	t.Helper()
+	recipient, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x01})
+	refund, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x02})
+	secret := bytes.Repeat([]byte{0x5e}, SecretSize)
+	h, err := NewHTLC(recipient.PubKey().SerializeCompressed(), refund.PubKey().SerializeCompressed(),
+		sha256.Sum256(secret), 700000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract := bchutil.UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}, Index: 1}, Amount: 100000,
+		PkScript: h.PkScript()}
+	return h, []*btcec.PrivateKey{recipient, refund}, secret, contract
+}
+
+// execute runs the scripts of the first input of tx spending contract.
+func execute(tx *wire.MsgTx, contract bchutil.UTXO) error {
+	vm, err := bchutil.NewEngine(contract.PkScript, tx, 0, bchutil.StandardScriptFlags, nil,
+		int64(contract.Amount))
+	if err != nil {
+		return err
+	}
+	return vm.Execute()
+}
+
+func TestHTLCScript(t *testing.T) {
+	h, keys, secret, _ := testContract(t)
+	hash := sha256.Sum256(secret)
+	want, _ := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_IF).
+		AddOp(txscript.OP_SIZE).AddData([]byte{32}).AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_SHA256).AddData(hash[:]).AddOp(txscript.OP_EQUALVERIFY).
+		AddData(keys[0].PubKey().SerializeCompressed()).
+		AddOp(txscript.OP_ELSE).
+		AddData([]byte{0x60, 0xae, 0x0a}).AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).AddOp(txscript.OP_DROP).
+		AddData(keys[1].PubKey().SerializeCompressed()).
+		AddOp(txscript.OP_ENDIF).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+	if !bytes.Equal(h.Script(), want) {
+		t.Fatalf("script %x, want %x", h.Script(), want)
+	}
+	addr, err := h.Address(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := bchutil.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkScript, h.PkScript()) {
+		t.Fatalf("address script %x, contract script %x", pkScript, h.PkScript())
+	}
+
+	if _, err := NewHTLC([]byte{1}, keys[1].PubKey().SerializeCompressed(), hash, 1); err == nil {
+		t.Error("invalid public key accepted")
+	}
+	if _, err := NewHTLC(keys[0].PubKey().SerializeCompressed(), keys[1].PubKey().SerializeCompressed(),
+		hash, 0); err == nil {
+		t.Error("zero locktime accepted")
+	}
+}
+
+func TestBuildContractTx(t *testing.T) {
+	h, keys, _, _ := testContract(t)
+	change, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+		AddData(btcutil.Hash160(keys[1].PubKey().SerializeCompressed())).AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_CHECKSIG).Script()
+	utxos := []bchutil.UTXO{{OutPoint: wire.OutPoint{Hash: chainhash.Hash{9}}, Amount: 500000, PkScript: change}}
+	u, err := h.BuildContractTx(utxos, 100000, change, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txOut := u.Tx.TxOut[u.Recipients[0]]; txOut.Value != 100000 || !bytes.Equal(txOut.PkScript, h.PkScript()) {
+		t.Fatalf("contract output %v", txOut)
+	}
+}
+
+func TestBuildRedeemTx(t *testing.T) {
+	h, keys, secret, contract := testContract(t)
+	payTo := []byte{txscript.OP_TRUE}
+	for _, opts := range [][]bchutil.SignOption{nil, {bchutil.WithSchnorr()}} {
+		tx, err := h.BuildRedeemTx(contract, secret, keys[0], payTo, 1000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.LockTime != 0 || tx.TxIn[0].Sequence != wire.MaxTxInSequenceNum {
+			t.Fatalf("locktime %d, sequence %x", tx.LockTime, tx.TxIn[0].Sequence)
+		}
+		if err := execute(tx, contract); err != nil {
+			t.Fatal(err)
+		}
+		fee := contract.Amount - btcutil.Amount(tx.TxOut[0].Value)
+		if size := tx.SerializeSize(); fee < bchutil.FeeRate(1000).Fee(size) {
+			t.Fatalf("fee %v for %d bytes", fee, size)
+		}
+		got, err := ExtractSecret(tx, h.SecretHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Fatalf("extracted %x, want %x", got, secret)
+		}
+	}
+
+	// The stack must hold the secret above the signature: swapping them
+	// fails the script.
+	tx, _ := h.BuildRedeemTx(contract, secret, keys[0], payTo, 1000)
+	pushes, _ := txscript.PushedData(tx.TxIn[0].SignatureScript)
+	tx.TxIn[0].SignatureScript, _ = txscript.NewScriptBuilder().AddData(pushes[1]).AddData(pushes[0]).
+		AddOp(txscript.OP_TRUE).AddData(pushes[2]).Script()
+	if err := execute(tx, contract); err == nil {
+		t.Fatal("swapped secret and signature accepted")
+	}
+
+	if _, err := h.BuildRedeemTx(contract, bytes.Repeat([]byte{1}, SecretSize), keys[0], payTo, 1000); !errors.Is(err,
+		ErrWrongSecret) {
+		t.Errorf("got %v, want ErrWrongSecret", err)
+	}
+	if _, err := h.BuildRedeemTx(contract, secret, keys[1], payTo, 1000); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("got %v, want ErrWrongKey", err)
+	}
+}
+
+func TestBuildRefundTx(t *testing.T) {
+	h, keys, _, contract := testContract(t)
+	tx, err := h.BuildRefundTx(contract, keys[1], []byte{txscript.OP_TRUE}, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.LockTime != h.LockTime() || tx.TxIn[0].Sequence == wire.MaxTxInSequenceNum {
+		t.Fatalf("locktime %d, sequence %x", tx.LockTime, tx.TxIn[0].Sequence)
+	}
+	if err := execute(tx, contract); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExtractSecret(tx, h.SecretHash()); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("got %v, want ErrNoSecret", err)
+	}
+
+	// Before the locktime of the contract.
+	early := tx.Copy()
+	early.LockTime = h.LockTime() - 1
+	if err := execute(early, contract); err == nil {
+		t.Fatal("refund before the locktime accepted")
+	}
+
+	if _, err := h.BuildRefundTx(contract, keys[0], []byte{txscript.OP_TRUE}, 1000); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("got %v, want ErrWrongKey", err)
+	}
+	contract.Amount = 600
+	if _, err := h.BuildRefundTx(contract, keys[1], []byte{txscript.OP_TRUE}, 1000); !errors.Is(err,
+		bchutil.ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+}
@@ -0,0 +1,254 @@
+package atomicswap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// lockTimeThreshold is the locktime below which locktimes are block heights,
+// and above which they are times.
+const lockTimeThreshold = 500000000
+
+var (
+	// ErrInvalidContract describes an error where a script is not a hash
+	// time-locked contract of the template of HTLC.
+	ErrInvalidContract = errors.New("invalid contract script")
+
+	// ErrAuditMismatch describes an error where a contract does not have
+	// the terms expected by its audit.
+	ErrAuditMismatch = errors.New("contract does not match the expected terms")
+)
+
+// AuditParams are the terms a contract is expected to have.  Zero fields are
+// not checked.
+type AuditParams struct {
+	// SecretHash is the hash of the secret of the swap.
+	SecretHash [32]byte
+
+	// RecipientHash160 and RefundHash160 are the hash160 of the recipient
+	// and refund public keys.
+	RecipientHash160 []byte
+	RefundHash160    []byte
+
+	// SecretSize is the size of the secrets the contract must enforce.
+	SecretSize int
+
+	// MinLockTime is the earliest locktime of the contract, which must be
+	// of the same kind, a block height or a time.
+	MinLockTime uint32
+}
+
+// AuditResult describes the terms of a contract.
+type AuditResult struct {
+	// RecipientPubKey and RefundPubKey are the serialized public keys of
+	// the redeem and refund branches, and RecipientHash160 and
+	// RefundHash160 their hash160.
+	RecipientPubKey  []byte
+	RefundPubKey     []byte
+	RecipientHash160 []byte
+	RefundHash160    []byte
+
+	// SecretHash is the SHA-256 of the secret, of SecretSize bytes, which
+	// redeems the contract.
+	SecretHash [32]byte
+	SecretSize int
+
+	// LockTime is the locktime after which the contract is refunded.
+	LockTime uint32
+}
+
+// AuditHTLC parses contractScript, the script of a contract authored by the
+// counterparty of a swap, and checks its terms against expected.  Scripts
+// that are not contracts of the template of HTLC fail with
+// ErrInvalidContract, and contracts whose terms are not the expected ones
+// with ErrAuditMismatch.
+func AuditHTLC(contractScript []byte, expected AuditParams) (*AuditResult, error) {
+	ops, err := parseContract(contractScript)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidContract, err)
+	}
+	template := []byte{
+		txscript.OP_IF,
+		txscript.OP_SIZE, txscript.OP_DATA_1, txscript.OP_EQUALVERIFY,
+		txscript.OP_SHA256, txscript.OP_DATA_32, txscript.OP_EQUALVERIFY,
+		txscript.OP_DATA_1,
+		txscript.OP_ELSE,
+		txscript.OP_DATA_1, txscript.OP_CHECKLOCKTIMEVERIFY, txscript.OP_DROP,
+		txscript.OP_DATA_1,
+		txscript.OP_ENDIF,
+		txscript.OP_CHECKSIG,
+	}
+	if len(ops) != len(template) {
+		return nil, fmt.Errorf("%w: %d opcodes, want %d", ErrInvalidContract, len(ops), len(template))
+	}
+	for i, op := range ops {
+		// OP_DATA_1 stands for any push in the template.
+		if template[i] == txscript.OP_DATA_1 && op.isPush() {
+			continue
+		}
+		if op.opcode != template[i] {
+			return nil, fmt.Errorf("%w: unexpected opcode %02x at %d", ErrInvalidContract, op.opcode, i)
+		}
+	}
+
+	r := &AuditResult{RecipientPubKey: ops[7].data, RefundPubKey: ops[12].data}
+	copy(r.SecretHash[:], ops[5].data)
+	secretSize, err := ops[2].scriptNum(4)
+	if err != nil {
+		return nil, fmt.Errorf("%w: secret size: %v", ErrInvalidContract, err)
+	}
+	if secretSize <= 0 {
+		return nil, fmt.Errorf("%w: secret size %d", ErrInvalidContract, secretSize)
+	}
+	r.SecretSize = int(secretSize)
+	// CHECKLOCKTIMEVERIFY accepts 5 bytes locktimes.
+	lockTime, err := ops[9].scriptNum(5)
+	if err != nil {
+		return nil, fmt.Errorf("%w: locktime: %v", ErrInvalidContract, err)
+	}
+	if lockTime <= 0 || lockTime > 0xffffffff {
+		return nil, fmt.Errorf("%w: locktime %d", ErrInvalidContract, lockTime)
+	}
+	r.LockTime = uint32(lockTime)
+	for _, pubKey := range [][]byte{r.RecipientPubKey, r.RefundPubKey} {
+		if _, err := btcec.ParsePubKey(pubKey, btcec.S256()); err != nil {
+			return nil, fmt.Errorf("%w: public key %x: %v", ErrInvalidContract, pubKey, err)
+		}
+	}
+	r.RecipientHash160 = btcutil.Hash160(r.RecipientPubKey)
+	r.RefundHash160 = btcutil.Hash160(r.RefundPubKey)
+
+	switch {
+	case expected.SecretHash != [32]byte{} && r.SecretHash != expected.SecretHash:
+		return nil, fmt.Errorf("%w: secret hash %x, want %x", ErrAuditMismatch, r.SecretHash, expected.SecretHash)
+	case expected.RecipientHash160 != nil && !bytes.Equal(r.RecipientHash160, expected.RecipientHash160):
+		return nil, fmt.Errorf("%w: recipient %x, want %x", ErrAuditMismatch, r.RecipientHash160,
+			expected.RecipientHash160)
+	case expected.RefundHash160 != nil && !bytes.Equal(r.RefundHash160, expected.RefundHash160):
+		return nil, fmt.Errorf("%w: refund %x, want %x", ErrAuditMismatch, r.RefundHash160, expected.RefundHash160)
+	case expected.SecretSize != 0 && r.SecretSize != expected.SecretSize:
+		return nil, fmt.Errorf("%w: secret size %d, want %d", ErrAuditMismatch, r.SecretSize, expected.SecretSize)
+	case expected.MinLockTime != 0 && (r.LockTime < lockTimeThreshold) != (expected.MinLockTime < lockTimeThreshold):
+		return nil, fmt.Errorf("%w: locktime %d and %d of different kinds", ErrAuditMismatch, r.LockTime,
+			expected.MinLockTime)
+	case r.LockTime < expected.MinLockTime:
+		return nil, fmt.Errorf("%w: locktime %d, want at least %d", ErrAuditMismatch, r.LockTime,
+			expected.MinLockTime)
+	}
+	return r, nil
+}
+
+// ExtractSecret returns the secret revealed by redeemTx, the first data pushed
+// by the scriptSigs of its inputs whose SHA-256 is secretHash, or ErrNoSecret.
+// Inputs with malformed scriptSigs are skipped.
+func ExtractSecret(redeemTx *wire.MsgTx, secretHash [32]byte) ([]byte, error) {
+	for _, txIn := range redeemTx.TxIn {
+		ops, err := parseContract(txIn.SignatureScript)
+		if err != nil {
+			continue
+		}
+		for _, op := range ops {
+			if op.isPush() && sha256.Sum256(op.data) == secretHash {
+				return append([]byte(nil), op.data...), nil
+			}
+		}
+	}
+	return nil, ErrNoSecret
+}
+
+// contractOp is an opcode of a script with the data it pushes.
+type contractOp struct {
+	opcode byte
+	data   []byte
+}
+
+// isPush returns whether the opcode pushes data, small integers included.
+func (op *contractOp) isPush() bool {
+	return op.opcode <= txscript.OP_16 && op.opcode != txscript.OP_RESERVED
+}
+
+// scriptNum returns the minimally encoded script number pushed by the opcode,
+// of at most maxLen bytes.
+func (op *contractOp) scriptNum(maxLen int) (int64, error) {
+	switch {
+	case op.opcode == txscript.OP_0:
+		return 0, nil
+	case op.opcode == txscript.OP_1NEGATE:
+		return -1, nil
+	case op.opcode >= txscript.OP_1 && op.opcode <= txscript.OP_16:
+		return int64(op.opcode - txscript.OP_1 + 1), nil
+	case op.opcode > txscript.OP_PUSHDATA4 || int(op.opcode) != len(op.data):
+		return 0, errors.New("not a minimal number push")
+	}
+	n := len(op.data)
+	if n > maxLen {
+		return 0, fmt.Errorf("number of %d bytes, limit %d", n, maxLen)
+	}
+	// The most significant byte holds the sign bit, of a byte of its own
+	// only if the next byte uses its high bit.
+	if op.data[n-1]&0x7f == 0 && (n == 1 || op.data[n-2]&0x80 == 0) {
+		return 0, errors.New("non-minimally encoded number")
+	}
+	var v int64
+	for i, b := range op.data {
+		v |= int64(b) << (8 * uint(i))
+	}
+	if op.data[n-1]&0x80 != 0 {
+		v &^= int64(0x80) << (8 * uint(n-1))
+		v = -v
+	}
+	return v, nil
+}
+
+// parseContract splits script in its opcodes, failing for truncated pushes.
+func parseContract(script []byte) ([]contractOp, error) {
+	var ops []contractOp
+	for i := 0; i < len(script); {
+		op := contractOp{opcode: script[i]}
+		i++
+		var n int
+		switch {
+		case op.opcode >= txscript.OP_DATA_1 && op.opcode <= txscript.OP_DATA_75:
+			n = int(op.opcode)
+		case op.opcode == txscript.OP_PUSHDATA1:
+			if len(script)-i < 1 {
+				return nil, errors.New("truncated push")
+			}
+			n = int(script[i])
+			i++
+		case op.opcode == txscript.OP_PUSHDATA2:
+			if len(script)-i < 2 {
+				return nil, errors.New("truncated push")
+			}
+			n = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		case op.opcode == txscript.OP_PUSHDATA4:
+			if len(script)-i < 4 {
+				return nil, errors.New("truncated push")
+			}
+			l := binary.LittleEndian.Uint32(script[i:])
+			if l > uint32(len(script)) {
+				return nil, errors.New("truncated push")
+			}
+			n = int(l)
+			i += 4
+		}
+		if len(script)-i < n {
+			return nil, errors.New("truncated push")
+		}
+		if op.opcode <= txscript.OP_PUSHDATA4 {
+			op.data = script[i : i+n]
+		}
+		i += n
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
@@ -0,0 +1,130 @@
+package atomicswap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestAuditHTLC(t *testing.T) {
+	h, keys, _, _ := testContract(t)
+	recipient := btcutil.Hash160(keys[0].PubKey().SerializeCompressed())
+	refund := btcutil.Hash160(keys[1].PubKey().SerializeCompressed())
+	r, err := AuditHTLC(h.Script(), AuditParams{SecretHash: h.SecretHash(), RecipientHash160: recipient,
+		RefundHash160: refund, SecretSize: SecretSize, MinLockTime: 600000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r.RecipientHash160, recipient) || !bytes.Equal(r.RefundHash160, refund) ||
+		!bytes.Equal(r.RecipientPubKey, keys[0].PubKey().SerializeCompressed()) ||
+		r.SecretHash != h.SecretHash() || r.SecretSize != SecretSize || r.LockTime != 700000 {
+		t.Fatalf("audit %+v", r)
+	}
+
+	mismatches := []AuditParams{
+		{SecretHash: [32]byte{1}},
+		{RecipientHash160: refund},
+		{RefundHash160: recipient},
+		{SecretSize: 20},
+		{MinLockTime: 700001},
+		// A time, while the contract locktime is a height.
+		{MinLockTime: 1600000000},
+	}
+	for _, expected := range mismatches {
+		if _, err := AuditHTLC(h.Script(), expected); !errors.Is(err, ErrAuditMismatch) {
+			t.Errorf("%+v: got %v, want ErrAuditMismatch", expected, err)
+		}
+	}
+
+	// Contracts of other participants build the same script.
+	other, err := NewHTLC(r.RecipientPubKey, r.RefundPubKey, r.SecretHash, r.LockTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(other.Script(), h.Script()) {
+		t.Fatal("contract rebuilt from its audit differs")
+	}
+}
+
+func TestAuditHTLCInvalid(t *testing.T) {
+	h, keys, _, _ := testContract(t)
+	pubKey := keys[0].PubKey().SerializeCompressed()
+	hash := h.SecretHash()
+	build := func(secretSize []byte, lockTime []byte, recipient []byte) []byte {
+		script, _ := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_IF).
+			AddOp(txscript.OP_SIZE).AddFullData(secretSize).AddOp(txscript.OP_EQUALVERIFY).
+			AddOp(txscript.OP_SHA256).AddData(hash[:]).AddOp(txscript.OP_EQUALVERIFY).
+			AddData(recipient).
+			AddOp(txscript.OP_ELSE).
+			AddFullData(lockTime).AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).AddOp(txscript.OP_DROP).
+			AddData(pubKey).
+			AddOp(txscript.OP_ENDIF).
+			AddOp(txscript.OP_CHECKSIG).
+			Script()
+		return script
+	}
+	tests := map[string][]byte{
+		"empty":                 nil,
+		"p2pkh":                 append([]byte{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_DATA_20}, make([]byte, 22)...),
+		"trailing opcode":       append(append([]byte(nil), h.Script()...), txscript.OP_NOP),
+		"non-minimal size":      build([]byte{32, 0}, []byte{0x60, 0xae, 0x0a}, pubKey),
+		"negative size":         build([]byte{0xa0}, []byte{0x60, 0xae, 0x0a}, pubKey),
+		"non-minimal locktime":  build([]byte{32}, []byte{0x60, 0xae, 0x0a, 0}, pubKey),
+		"negative locktime":     build([]byte{32}, []byte{0x60, 0xae, 0x8a}, pubKey),
+		"oversized locktime":    build([]byte{32}, []byte{1, 2, 3, 4, 5, 6}, pubKey),
+		"invalid recipient":     build([]byte{32}, []byte{0x60, 0xae, 0x0a}, []byte{2, 1}),
+		"pushdata size":         build(bytes.Repeat([]byte{1}, 80), []byte{0x60, 0xae, 0x0a}, pubKey),
+		"truncated pushdata4":   {txscript.OP_PUSHDATA4, 0xff, 0xff},
+		"oversized pushdata4":   {txscript.OP_PUSHDATA4, 0xff, 0xff, 0xff, 0xff, 1},
+		"pushdata past the end": {txscript.OP_PUSHDATA1, 10, 1},
+	}
+	shortHash := append([]byte(nil), h.Script()...)
+	shortHash[6] = txscript.OP_DATA_31
+	tests["secret hash of 31 bytes"] = shortHash
+	for name, script := range tests {
+		if _, err := AuditHTLC(script, AuditParams{}); !errors.Is(err, ErrInvalidContract) {
+			t.Errorf("%s: got %v, want ErrInvalidContract", name, err)
+		}
+	}
+
+	// Every truncation and byte flip of the script fails or parses without
+	// panicking.
+	script := h.Script()
+	for i := range script {
+		AuditHTLC(script[:i], AuditParams{})
+		for _, b := range []byte{0, txscript.OP_PUSHDATA1, txscript.OP_PUSHDATA2, txscript.OP_PUSHDATA4, 0xff} {
+			flipped := append([]byte(nil), script...)
+			flipped[i] = b
+			AuditHTLC(flipped, AuditParams{})
+		}
+	}
+}
+
+func TestExtractSecret(t *testing.T) {
+	h, keys, secret, contract := testContract(t)
+	redeem, err := h.BuildRedeemTx(contract, secret, keys[0], []byte{txscript.OP_TRUE}, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The redeem may spend other outputs first, some with malformed
+	// scriptSigs.
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, []byte{txscript.OP_PUSHDATA1, 10}, nil))
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, []byte{txscript.OP_DATA_1, 1}, nil))
+	tx.AddTxIn(redeem.TxIn[0])
+	got, err := ExtractSecret(tx, h.SecretHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, secret) {
+		t.Fatalf("extracted %x, want %x", got, secret)
+	}
+	if _, err := ExtractSecret(tx, [32]byte{1}); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("got %v, want ErrNoSecret", err)
+	}
+}
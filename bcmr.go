@@ -0,0 +1,126 @@
+package bchutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// bcmrLokadID is the first push of BCMR outputs.
+const bcmrLokadID = "BCMR"
+
+// ErrNotBCMR describes an error where an output script is not a BCMR
+// announcement.
+var ErrNotBCMR = errors.New("not a BCMR output")
+
+// BCMRAnnouncement is the publication of a Bitcoin Cash Metadata Registry by
+// an OP_RETURN output of an authchain transaction.
+type BCMRAnnouncement struct {
+	// ContentHash is the SHA-256 hash of the registry.
+	ContentHash [32]byte
+
+	// URIs are where the registry is published.  Those without scheme are
+	// HTTPS URLs.
+	URIs []string
+}
+
+// BuildBCMROutput returns the OP_RETURN output announcing the registry hashed
+// to contentHash and published at uris.  The script must not exceed
+// MaxDataCarrierSize.
+func BuildBCMROutput(contentHash [32]byte, uris []string) (*wire.TxOut, error) {
+	if len(uris) == 0 {
+		return nil, errors.New("no BCMR URI")
+	}
+	builder := NewScriptBuilder().AddOp(txscript.OP_RETURN).AddData([]byte(bcmrLokadID)).
+		AddData(contentHash[:])
+	for i, uri := range uris {
+		if uri == "" || !utf8.ValidString(uri) {
+			return nil, fmt.Errorf("invalid BCMR URI %d %q", i, uri)
+		}
+		builder.AddDataPush([]byte(uri))
+	}
+	pkScript, err := builder.Script()
+	if err != nil {
+		return nil, err
+	}
+	if len(pkScript) > MaxDataCarrierSize {
+		return nil, fmt.Errorf("%w: BCMR script of %d bytes", ErrDataCarrierSize, len(pkScript))
+	}
+	return wire.NewTxOut(0, pkScript), nil
+}
+
+// ParseBCMR parses the script of a BCMR output built by BuildBCMROutput.
+// Other scripts fail with an error wrapping ErrNotBCMR.
+func ParseBCMR(pkScript []byte) (*BCMRAnnouncement, error) {
+	if len(pkScript) == 0 || pkScript[0] != txscript.OP_RETURN {
+		return nil, fmt.Errorf("%w: no OP_RETURN", ErrNotBCMR)
+	}
+	ops, err := parseScript(pkScript[1:])
+	if err != nil || !isPushOnly(ops) {
+		return nil, fmt.Errorf("%w: not push only", ErrNotBCMR)
+	}
+	if len(ops) == 0 || string(ops[0].data) != bcmrLokadID {
+		return nil, fmt.Errorf("%w: no %s identifier", ErrNotBCMR, bcmrLokadID)
+	}
+	if len(ops) < 3 {
+		return nil, fmt.Errorf("%w: no content hash or URI", ErrNotBCMR)
+	}
+	if len(ops[1].data) != 32 {
+		return nil, fmt.Errorf("%w: content hash of %d bytes", ErrNotBCMR, len(ops[1].data))
+	}
+	a := &BCMRAnnouncement{}
+	copy(a.ContentHash[:], ops[1].data)
+	for i, op := range ops[2:] {
+		if len(op.data) == 0 || !utf8.Valid(op.data) {
+			return nil, fmt.Errorf("%w: invalid URI %d", ErrNotBCMR, i)
+		}
+		a.URIs = append(a.URIs, string(op.data))
+	}
+	return a, nil
+}
+
+// AuthchainFetcher provides the transactions of authchains.
+type AuthchainFetcher interface {
+	// SpendingTx returns the transaction spending op, or nil if it is
+	// unspent.
+	SpendingTx(ctx context.Context, op wire.OutPoint) (*wire.MsgTx, error)
+}
+
+// LatestBCMR walks the authchain starting with authbase, where every
+// transaction spends the output 0 of the previous one, and returns the
+// announcement of its latest transaction with a BCMR output, or nil if none.
+func LatestBCMR(ctx context.Context, authbase *wire.MsgTx, fetcher AuthchainFetcher) (*BCMRAnnouncement, error) {
+	var latest *BCMRAnnouncement
+	for tx := authbase; tx != nil; {
+		for _, txOut := range tx.TxOut {
+			if a, err := ParseBCMR(txOut.PkScript); err == nil {
+				latest = a
+				break
+			}
+		}
+		op := wire.OutPoint{Hash: tx.TxHash(), Index: 0}
+		next, err := fetcher.SpendingTx(ctx, op)
+		if err != nil {
+			return nil, err
+		}
+		if next != nil && !spendsOutPoint(next, op) {
+			return nil, fmt.Errorf("transaction %v does not spend %v", next.TxHash(), op)
+		}
+		tx = next
+	}
+	return latest, nil
+}
+
+// spendsOutPoint returns whether an input of tx spends op.
+func spendsOutPoint(tx *wire.MsgTx, op wire.OutPoint) bool {
+	for _, txIn := range tx.TxIn {
+		if txIn.PreviousOutPoint == op {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package bchutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testAuthchainFetcher is an AuthchainFetcher of transactions in memory.
+type testAuthchainFetcher []*wire.MsgTx
+
+func (f testAuthchainFetcher) SpendingTx(ctx context.Context, op wire.OutPoint) (*wire.MsgTx, error) {
+	for _, tx := range f {
+		if spendsOutPoint(tx, op) {
+			return tx, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestBCMR(t *testing.T) {
+	hash := sha256.Sum256([]byte(`{"version":{"major":0}}`))
+	uris := []string{"example.com/bcmr.json", "ipfs://bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi", "x"}
+	txOut, err := BuildBCMROutput(hash, uris)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := ParseBCMR(txOut.PkScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ContentHash != hash || !reflect.DeepEqual(a.URIs, uris) {
+		t.Errorf("got %+v", a)
+	}
+
+	if _, err := BuildBCMROutput(hash, nil); err == nil {
+		t.Error("no error without URI")
+	}
+	if _, err := BuildBCMROutput(hash, []string{strings.Repeat("a", 200)}); !errors.Is(err, ErrDataCarrierSize) {
+		t.Errorf("got %v, want ErrDataCarrierSize", err)
+	}
+	for i, pkScript := range [][]byte{
+		nil,
+		{0x6a, 0x04, 'S', 'L', 'P', 0},
+		{0x6a, 0x04, 'B', 'C', 'M', 'R', 0x01, 0x00, 0x01, 'a'},
+		txOut.PkScript[:len(txOut.PkScript)-1],
+	} {
+		if _, err := ParseBCMR(pkScript); !errors.Is(err, ErrNotBCMR) {
+			t.Errorf("test %d: got %v, want ErrNotBCMR", i, err)
+		}
+	}
+}
+
+func TestLatestBCMR(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	authbase := wire.NewMsgTx(wire.TxVersion)
+	authbase.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	authbase.AddTxOut(wire.NewTxOut(1000, pkScript))
+
+	var chain testAuthchainFetcher
+	prev := authbase
+	for i := 0; i < 4; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: prev.TxHash()}, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(1000, pkScript))
+		if i < 3 {
+			bcmr, _ := BuildBCMROutput([32]byte{byte(i)}, []string{"example.com"})
+			tx.AddTxOut(bcmr)
+		}
+		chain = append(chain, tx)
+		prev = tx
+	}
+	// A transaction spending another output is not part of the chain.
+	other := wire.NewMsgTx(wire.TxVersion)
+	other.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chain[2].TxHash(), Index: 1}, nil, nil))
+	bcmr, _ := BuildBCMROutput([32]byte{0xff}, []string{"example.com"})
+	other.AddTxOut(bcmr)
+	chain = append(testAuthchainFetcher{other}, chain...)
+
+	a, err := LatestBCMR(context.Background(), authbase, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == nil || a.ContentHash != [32]byte{2} {
+		t.Errorf("got %+v", a)
+	}
+	if a, err := LatestBCMR(context.Background(), authbase, chain[:1]); a != nil || err != nil {
+		t.Errorf("got %+v, %v", a, err)
+	}
+}
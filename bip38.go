@@ -0,0 +1,201 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+)
+
+// BIP38 flag bits and the scrypt parameters deriving the encryption keys
+// from passphrases.
+const (
+	bip38NoECMultiply = 0xc0
+	bip38Compressed   = 0x20
+	bip38LotSequence  = 0x04
+
+	bip38ScryptN = 16384
+	bip38ScryptR = 8
+	bip38ScryptP = 8
+)
+
+var (
+	// ErrInvalidBIP38Key describes an error where a BIP38 encrypted key is
+	// not the Base58Check encoding of an encrypted key, such as a key
+	// string mistyped or truncated.
+	ErrInvalidBIP38Key = errors.New("invalid BIP38 encrypted key")
+
+	// ErrBIP38Passphrase describes an error where a BIP38 encrypted key
+	// decrypts to a key whose address does not match the checksum of the
+	// encrypted key, because the passphrase is wrong.
+	ErrBIP38Passphrase = errors.New("wrong BIP38 passphrase")
+)
+
+// bip38AddressHash returns the checksum of BIP38 encrypted keys, the first 4
+// bytes of the double SHA-256 of the legacy mainnet pay-to-pubkey-hash address
+// of key, of its compressed public key if compressed is set.
+func bip38AddressHash(key *btcec.PublicKey, compressed bool) []byte {
+	pubKey := key.SerializeUncompressed()
+	if compressed {
+		pubKey = key.SerializeCompressed()
+	}
+	addr, _ := btcutil.NewAddressPubKeyHash(btcutil.Hash160(pubKey), &chaincfg.MainNetParams)
+	return chainhash.DoubleHashB([]byte(addr.EncodeAddress()))[:4]
+}
+
+// xorBytes returns the XOR of a and b, of the same size.
+func xorBytes(a, b []byte) []byte {
+	x := make([]byte, len(a))
+	for i := range a {
+		x[i] = a[i] ^ b[i]
+	}
+	return x
+}
+
+// EncryptBIP38 returns the BIP38 encryption of priv with passphrase, the
+// "6P" string printed on paper wallets, for the address of the compressed
+// public key of priv if compressed is set.  Passphrases are normalized to
+// NFC, as the specification requires.
+func EncryptBIP38(priv *btcec.PrivateKey, passphrase string, compressed bool) (string, error) {
+	flag := byte(bip38NoECMultiply)
+	if compressed {
+		flag |= bip38Compressed
+	}
+	addrHash := bip38AddressHash(priv.PubKey(), compressed)
+	derived, err := scrypt.Key([]byte(norm.NFC.String(passphrase)), addrHash, bip38ScryptN, bip38ScryptR,
+		bip38ScryptP, 64)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(derived[32:])
+	if err != nil {
+		return "", err
+	}
+	encrypted := xorBytes(priv.Serialize(), derived[:32])
+	block.Encrypt(encrypted[:16], encrypted[:16])
+	block.Encrypt(encrypted[16:], encrypted[16:])
+
+	payload := append([]byte{0x42, flag}, addrHash...)
+	return base58.CheckEncode(append(payload, encrypted...), 0x01), nil
+}
+
+// DecryptBIP38 decrypts encKey, a BIP38 encrypted key, with passphrase and
+// returns the private key and whether its address is that of its compressed
+// public key.  Keys encrypted with or without EC multiplication are supported.
+// Strings that are not encrypted keys fail with ErrInvalidBIP38Key, and wrong
+// passphrases with ErrBIP38Passphrase.
+func DecryptBIP38(encKey, passphrase string) (*btcec.PrivateKey, bool, error) {
+	decoded, version, err := base58.CheckDecode(encKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidBIP38Key, err)
+	}
+	if version != 0x01 || len(decoded) != 38 {
+		return nil, false, fmt.Errorf("%w: %d bytes with prefix %#x", ErrInvalidBIP38Key, len(decoded)+1, version)
+	}
+	passphrase = norm.NFC.String(passphrase)
+	flag, addrHash := decoded[1], decoded[2:6]
+	compressed := flag&bip38Compressed != 0
+
+	var priv *btcec.PrivateKey
+	switch {
+	case decoded[0] == 0x42 && flag&^bip38Compressed == bip38NoECMultiply:
+		priv, err = decryptBIP38(decoded[6:], passphrase, addrHash)
+	case decoded[0] == 0x43 && flag&^(bip38Compressed|bip38LotSequence) == 0:
+		priv, err = decryptBIP38ECMultiply(decoded[6:], passphrase, addrHash, flag&bip38LotSequence != 0)
+	default:
+		return nil, false, fmt.Errorf("%w: unknown type %#x with flags %#x", ErrInvalidBIP38Key, decoded[0], flag)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !bytes.Equal(bip38AddressHash(priv.PubKey(), compressed), addrHash) {
+		return nil, false, ErrBIP38Passphrase
+	}
+	return priv, compressed, nil
+}
+
+// decryptBIP38 decrypts the 32 bytes of a key encrypted without EC
+// multiplication.
+func decryptBIP38(encrypted []byte, passphrase string, addrHash []byte) (*btcec.PrivateKey, error) {
+	derived, err := scrypt.Key([]byte(passphrase), addrHash, bip38ScryptN, bip38ScryptR, bip38ScryptP, 64)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derived[32:])
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	block.Decrypt(key[:16], encrypted[:16])
+	block.Decrypt(key[16:], encrypted[16:])
+	return bip38PrivKey(xorBytes(key, derived[:32]))
+}
+
+// decryptBIP38ECMultiply decrypts the owner entropy and encrypted parts of a
+// key encrypted with EC multiplication, whose owner entropy holds a lot and
+// sequence number if lotSequence is set.
+func decryptBIP38ECMultiply(data []byte, passphrase string, addrHash []byte,
+	lotSequence bool) (*btcec.PrivateKey, error) {
+
+	ownerEntropy, encrypted1, encrypted2 := data[:8], data[8:16], data[16:32]
+	ownerSalt := ownerEntropy
+	if lotSequence {
+		ownerSalt = ownerEntropy[:4]
+	}
+	passFactor, err := scrypt.Key([]byte(passphrase), ownerSalt, bip38ScryptN, bip38ScryptR, bip38ScryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	if lotSequence {
+		passFactor = chainhash.DoubleHashB(append(passFactor, ownerEntropy...))
+	}
+	curve := btcec.S256()
+	passFactorInt := new(big.Int).SetBytes(passFactor)
+	if passFactorInt.Sign() == 0 || passFactorInt.Cmp(curve.N) >= 0 {
+		return nil, ErrBIP38Passphrase
+	}
+	_, passPoint := btcec.PrivKeyFromBytes(curve, passFactor)
+
+	salt := append(append([]byte(nil), addrHash...), ownerEntropy...)
+	derived, err := scrypt.Key(passPoint.SerializeCompressed(), salt, 1024, 1, 1, 64)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derived[32:])
+	if err != nil {
+		return nil, err
+	}
+
+	// The second encrypted part holds the end of the first one and the
+	// end of seedb, the first part the start of seedb.
+	part2 := make([]byte, 16)
+	block.Decrypt(part2, encrypted2)
+	part2 = xorBytes(part2, derived[16:32])
+	part1 := append(append([]byte(nil), encrypted1...), part2[:8]...)
+	block.Decrypt(part1, part1)
+	seedB := append(xorBytes(part1, derived[:16]), part2[8:]...)
+
+	factorB := new(big.Int).SetBytes(chainhash.DoubleHashB(seedB))
+	d := factorB.Mul(factorB, passFactorInt)
+	return bip38PrivKey(d.Mod(d, curve.N).FillBytes(make([]byte, 32)))
+}
+
+// bip38PrivKey returns the private key of the 32 bytes key, which must be in
+// the range of private keys.
+func bip38PrivKey(key []byte) (*btcec.PrivateKey, error) {
+	d := new(big.Int).SetBytes(key)
+	if d.Sign() == 0 || d.Cmp(btcec.S256().N) >= 0 {
+		return nil, ErrBIP38Passphrase
+	}
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), key)
+	return priv, nil
+}
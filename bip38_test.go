@@ -0,0 +1,78 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcutil"
+)
+
+// Test vectors of BIP38.
+var bip38Tests = []struct {
+	passphrase string
+	encrypted  string
+	wif        string
+	ecMultiply bool
+}{
+	{"TestingOneTwoThree", "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg",
+		"5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR", false},
+	{"Satoshi", "6PRNFFkZc2NZ6dJqFfhRoFNMR9Lnyj7dYGrzdgXXVMXcxoKTePPX1dWByq",
+		"5HtasZ6ofTHP6HCwTqTkLDuLQisYPah7aUnSKfC7h4hMUVw2gi5", false},
+	// The passphrase is normalized to NFC.
+	{"\u03d2\u0301\u0000\U00010400\U0001F4A9", "6PRW5o9FLp4gJDDVqJQKJFTpMvdsSGJxMYHtHaQBF3ooa8mwD69bapcDQn",
+		"5Jajm8eQ22H3pGWLEVCXyvND8dQZhiQhoLJNKjYXk9roUFTMSZ4", false},
+	{"TestingOneTwoThree", "6PYNKZ1EAgYgmQfmNVamxyXVWHzK5s6DGhwP4J5o44cvXdoY7sRzhtpUeo",
+		"L44B5gGEpqEDRS9vVPz7QT35jcBG2r3CZwSwQ4fCewXAhAhqGVpP", false},
+	{"Satoshi", "6PYLtMnXvfG3oJde97zRyLYFZCYizPU5T3LwgdYJz1fRhh16bU7u6PPmY7",
+		"KwYgW8gcxj1JWJXhPSu4Fqwzfhp5Yfi42mdYmMa4XqK7NJxXUSK7", false},
+	{"TestingOneTwoThree", "6PfQu77ygVyJLZjfvMLyhLMQbYnu5uguoJJ4kMCLqWwPEdfpwANVS76gTX",
+		"5K4caxezwjGCGfnoPTZ8tMcJBLB7Jvyjv4xxeacadhq8nLisLR2", true},
+	{"MOLON LABE", "6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j",
+		"5JLdxTtcTHcfYcmJsNVy1v2PMDx432JPoYcBTVVRHpPaxUrdtf8", true},
+}
+
+func TestBIP38(t *testing.T) {
+	for i, test := range bip38Tests {
+		wif, err := btcutil.DecodeWIF(test.wif)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, compressed, err := DecryptBIP38(test.encrypted, test.passphrase)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if priv.D.Cmp(wif.PrivKey.D) != 0 || compressed != wif.CompressPubKey {
+			t.Errorf("test %d: got key %x, compressed %v", i, priv.Serialize(), compressed)
+		}
+		if test.ecMultiply {
+			continue
+		}
+		encrypted, err := EncryptBIP38(wif.PrivKey, test.passphrase, wif.CompressPubKey)
+		if err != nil || encrypted != test.encrypted {
+			t.Errorf("test %d: got %v, %v, want %v", i, encrypted, err, test.encrypted)
+		}
+	}
+}
+
+func TestDecryptBIP38Errors(t *testing.T) {
+	for _, test := range []struct{ encrypted, passphrase string }{
+		{bip38Tests[0].encrypted, "TestingOneTwoThreE"},
+		{bip38Tests[5].encrypted, "TestingOneTwoThreE"},
+	} {
+		if _, _, err := DecryptBIP38(test.encrypted, test.passphrase); !errors.Is(err, ErrBIP38Passphrase) {
+			t.Errorf("%s: got %v, want ErrBIP38Passphrase", test.encrypted, err)
+		}
+	}
+	encrypted := bip38Tests[0].encrypted
+	for _, s := range []string{
+		encrypted[:len(encrypted)-1] + "h",
+		encrypted[:len(encrypted)-2],
+		bip38Tests[0].wif,
+		"",
+	} {
+		if _, _, err := DecryptBIP38(s, bip38Tests[0].passphrase); !errors.Is(err, ErrInvalidBIP38Key) {
+			t.Errorf("%q: got %v, want ErrInvalidBIP38Key", s, err)
+		}
+	}
+}
@@ -19,6 +19,10 @@ var (
 	bitpayP2SH  = byte(0x28)
 )
 
+// ErrNotBitpayAddress describes an error where a base58 address does not have
+// the version bytes of the BitPay format.
+var ErrNotBitpayAddress = errors.New("not a BitPay address")
+
 // UnsupportedWitnessVerError describes an error where a segwit address being
 // decoded has an unsupported witness version.
 type UnsupportedWitnessVerError byte
@@ -131,6 +135,9 @@ func (a *BitpayAddressPubKeyHash) ScriptAddress() []byte {
 // IsForNet returns whether or not the pay-to-pubkey-hash address is associated
 // with the passed bitcoin network.
 func (a *BitpayAddressPubKeyHash) IsForNet(net *chaincfg.Params) bool {
+	if net.Name == chaincfg.MainNetParams.Name {
+		return a.netID == bitpayP2PkH
+	}
 	return a.netID == net.PubKeyHashAddrID
 }
 
@@ -210,6 +217,9 @@ func (a *BitpayAddressScriptHash) ScriptAddress() []byte {
 // IsForNet returns whether or not the pay-to-script-hash address is associated
 // with the passed bitcoin network.
 func (a *BitpayAddressScriptHash) IsForNet(net *chaincfg.Params) bool {
+	if net.Name == chaincfg.MainNetParams.Name {
+		return a.netID == bitpayP2SH
+	}
 	return a.netID == net.ScriptHashAddrID
 }
 
@@ -248,3 +258,38 @@ func bitpayPayToAddrScript(addr btcutil.Address) ([]byte, error) {
 	return nil, fmt.Errorf("unable to generate payment script for unsupported "+
 		"address type %T", addr)
 }
+
+// ConvertBitpayAddress returns the mainnet CashAddr encoding of addr, a
+// mainnet address of the BitPay format decoded by DecodeBitpay.  Unlike
+// DecodeBitpay, it rejects the version bytes of legacy addresses with
+// ErrNotBitpayAddress, so that a string is never read as both formats.
+func ConvertBitpayAddress(addr string) (string, error) {
+	decoded, err := DecodeBitpay(addr, &chaincfg.MainNetParams)
+	if err != nil {
+		return "", err
+	}
+	// Only the BitPay version bytes are for mainnet.
+	if !decoded.IsForNet(&chaincfg.MainNetParams) {
+		return "", fmt.Errorf("%w: %s has the version byte of a legacy address", ErrNotBitpayAddress, addr)
+	}
+	cash, err := ToCashAddress(decoded, &chaincfg.MainNetParams)
+	if err != nil {
+		return "", err
+	}
+	return cash.EncodeAddress(), nil
+}
+
+// ToBitpayAddress returns the mainnet BitPay address paying to the same
+// script as addr, a CashAddr or btcutil pay-to-pubkey-hash or
+// pay-to-script-hash address.  BitPay addresses are returned as is.
+func ToBitpayAddress(addr btcutil.Address) (btcutil.Address, error) {
+	switch addr := addr.(type) {
+	case *BitpayAddressPubKeyHash, *BitpayAddressScriptHash:
+		return addr, nil
+	case *CashAddressPubKeyHash, *btcutil.AddressPubKeyHash:
+		return newBitpayAddressPubKeyHash(addr.ScriptAddress(), bitpayP2PkH)
+	case *CashAddressScriptHash, *btcutil.AddressScriptHash:
+		return newBitpayAddressScriptHashFromHash(addr.ScriptAddress(), bitpayP2SH)
+	}
+	return nil, fmt.Errorf("no BitPay address for address type %T", addr)
+}
@@ -2,6 +2,7 @@ package bchutil
 
 import (
 	"bytes"
+	"errors"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil"
 	"testing"
@@ -42,3 +43,44 @@ func TestDecodeBitpay(t *testing.T) {
 		t.Error("Script doesn't match original btc address")
 	}
 }
+
+func TestConvertBitpayAddress(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	for _, bitpay := range []string{"CLtewbVQHRvs2J9JzRo58aVCZAVF8VbkXU", "HDLrcK5m6yUx3ogjGyjwnevdbfYg26RVUa"} {
+		addr, err := DecodeBitpay(bitpay, params)
+		if err != nil {
+			t.Fatalf("%s: %v", bitpay, err)
+		}
+		if !addr.IsForNet(params) || addr.IsForNet(&chaincfg.TestNet3Params) {
+			t.Errorf("%s: wrong network", bitpay)
+		}
+		if _, err := DecodeAddress(bitpay, params); err == nil {
+			t.Errorf("%s: decoded as a CashAddr", bitpay)
+		}
+
+		cash, err := ConvertBitpayAddress(bitpay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cashAddr, err := DecodeAddress(cash, params)
+		if err != nil || !bytes.Equal(cashAddr.ScriptAddress(), addr.ScriptAddress()) {
+			t.Errorf("%s: got CashAddr %s, %v", bitpay, cash, err)
+		}
+		converted, err := ToBitpayAddress(cashAddr)
+		if err != nil || converted.EncodeAddress() != bitpay {
+			t.Errorf("%s: got BitPay address %v, %v", cash, converted, err)
+		}
+		want, _ := PayToAddrScript(cashAddr)
+		if script, err := PayToAddrScript(addr); err != nil || !bytes.Equal(script, want) {
+			t.Errorf("%s: got script %x, %v, want %x", bitpay, script, err, want)
+		}
+	}
+
+	// Legacy addresses are not of the BitPay format.
+	if _, err := ConvertBitpayAddress("15RmNZ9LQNxL8AEtJgU9Z4sAw3GqJK99vf"); !errors.Is(err, ErrNotBitpayAddress) {
+		t.Errorf("got %v, want ErrNotBitpayAddress", err)
+	}
+	if _, err := ConvertBitpayAddress("CLtewbVQHRvs2J9JzRo58aVCZAVF8VbkXV"); err != ErrChecksumMismatch {
+		t.Errorf("got %v, want ErrChecksumMismatch", err)
+	}
+}
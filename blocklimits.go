@@ -0,0 +1,134 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// Signature check limits of blocks and their transactions, as of the May 2020
+// upgrade.
+const (
+	// MaxTxSigChecks is the largest number of signature checks of the
+	// inputs of a transaction.
+	MaxTxSigChecks = 3000
+
+	// BlockSizeSigChecksRatio is the ratio of the size limit of blocks to
+	// their signature check limit.
+	BlockSizeSigChecksRatio = 141
+)
+
+var (
+	// ErrBlockTxCount describes an error where a block has more
+	// transactions than transactions of MinTxSize bytes fit in its size
+	// limit.
+	ErrBlockTxCount = errors.New("too many transactions in block")
+
+	// ErrBlockSigChecks describes an error where the inputs of the
+	// transactions of a block exceed the signature check limit of the
+	// block, MaxBlockSigChecks of its size limit.
+	ErrBlockSigChecks = errors.New("too many signature checks in block")
+
+	// ErrTxSigChecks describes an error where the inputs of a transaction
+	// exceed MaxTxSigChecks.
+	ErrTxSigChecks = errors.New("too many signature checks in transaction")
+
+	// ErrInputSigChecks describes an error where an input has more
+	// signature checks than the size of its scriptSig allows: each check
+	// past the first one takes 43 bytes.
+	ErrInputSigChecks = errors.New("too many signature checks for the scriptSig size")
+)
+
+// MaxBlockSigChecks returns the signature check limit of blocks of at most
+// maxBlockSize bytes.
+func MaxBlockSigChecks(maxBlockSize int) int {
+	return maxBlockSize / BlockSizeSigChecksRatio
+}
+
+// maxInputSigChecks returns the largest number of signature checks of an
+// input with a scriptSig of scriptSigSize bytes.
+func maxInputSigChecks(scriptSigSize int) int {
+	return (scriptSigSize + 60) / 43
+}
+
+// ValidateBlockLimits checks that block, of a chain whose blocks are of at
+// most maxBlockSize bytes, MaxBlockSize when not positive, is within the size
+// and signature check limits of consensus: its size, failing with an error
+// wrapping ErrBlockTooLarge, its number of transactions, with ErrBlockTxCount,
+// and the signature checks of its inputs, their sum, each transaction and each
+// input being bounded with ErrBlockSigChecks, ErrTxSigChecks and
+// ErrInputSigChecks.  Signature checks are counted by running the scripts with
+// ConsensusScriptFlags, whose failures are returned.  Blocks whose scripts
+// execute opcodes the engine does not implement fail with an error wrapping
+// ErrUnsupportedOpcode: their limits are unknown, not exceeded.  The outputs
+// spent are
+// those of the block, or fetched with prevOutFetcher.  Errors name the
+// transaction, and input, violating the limit.
+func ValidateBlockLimits(block *btcutil.Block, prevOutFetcher PrevOutputFetcher, maxBlockSize int) error {
+	if maxBlockSize <= 0 {
+		maxBlockSize = MaxBlockSize
+	}
+	if size := block.MsgBlock().SerializeSize(); size > maxBlockSize {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrBlockTooLarge, size, maxBlockSize)
+	}
+	txs := block.Transactions()
+	if maxTxs := maxBlockSize / MinTxSize; len(txs) > maxTxs {
+		return fmt.Errorf("%w: %d transactions, limit %d", ErrBlockTxCount, len(txs), maxTxs)
+	}
+
+	outputs := make(map[wire.OutPoint]*wire.TxOut)
+	for _, tx := range txs {
+		for i, txOut := range tx.MsgTx().TxOut {
+			outputs[wire.OutPoint{Hash: *tx.Hash(), Index: uint32(i)}] = txOut
+		}
+	}
+	blockSigChecks, maxSigChecks := 0, MaxBlockSigChecks(maxBlockSize)
+	for idx, tx := range txs {
+		msgTx := tx.MsgTx()
+		if IsCoinBaseTx(msgTx) {
+			continue
+		}
+		sigHashes := txscript.NewTxSigHashes(msgTx)
+		txSigChecks := 0
+		for i, txIn := range msgTx.TxIn {
+			prevOut := outputs[txIn.PreviousOutPoint]
+			if prevOut == nil && prevOutFetcher != nil {
+				prevOut = prevOutFetcher.FetchPrevOutput(txIn.PreviousOutPoint)
+			}
+			if prevOut == nil {
+				return fmt.Errorf("transaction %d, %v: input %d spends unknown output %v", idx, tx.Hash(), i,
+					txIn.PreviousOutPoint)
+			}
+			vm, err := NewEngine(prevOut.PkScript, msgTx, i, ConsensusScriptFlags, sigHashes, prevOut.Value)
+			if err == nil {
+				err = vm.Execute()
+			}
+			if errors.Is(err, ErrUnsupportedOpcode) {
+				return fmt.Errorf("transaction %d, %v: input %d: can't count signature checks: %w", idx,
+					tx.Hash(), i, err)
+			}
+			if err != nil {
+				return fmt.Errorf("transaction %d, %v: input %d: %w", idx, tx.Hash(), i, err)
+			}
+			sigChecks := vm.SigChecks()
+			if limit := maxInputSigChecks(len(txIn.SignatureScript)); sigChecks > limit {
+				return fmt.Errorf("transaction %d, %v: input %d: %w: %d checks for a %d bytes scriptSig, "+
+					"limit %d", idx, tx.Hash(), i, ErrInputSigChecks, sigChecks, len(txIn.SignatureScript), limit)
+			}
+			txSigChecks += sigChecks
+		}
+		if txSigChecks > MaxTxSigChecks {
+			return fmt.Errorf("transaction %d, %v: %w: %d checks, limit %d", idx, tx.Hash(), ErrTxSigChecks,
+				txSigChecks, MaxTxSigChecks)
+		}
+		blockSigChecks += txSigChecks
+		if blockSigChecks > maxSigChecks {
+			return fmt.Errorf("transaction %d, %v: %w: %d checks up to it, limit %d", idx, tx.Hash(),
+				ErrBlockSigChecks, blockSigChecks, maxSigChecks)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package bchutil
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// blockLimitsTestMultisig returns a 1-of-n multisig script of the first
+// signing test key repeated n times, which counts n signature checks.
+func blockLimitsTestMultisig(n int) []byte {
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_1)
+	for i := 0; i < n; i++ {
+		builder.AddData(signingTestKeys()[0].PubKey().SerializeCompressed())
+	}
+	script, _ := builder.AddInt64(int64(n)).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	return script
+}
+
+// blockLimitsTestBlock returns a block of a coinbase and transactions
+// spending the outputs of prevOuts with each input signed with the first
+// signing test key by signInput, which returns the scriptSig.
+func blockLimitsTestBlock(t *testing.T, inputs []int, prevOuts testPrevOutputFetcher,
+	signInput func(tx *wire.MsgTx, idx int, prevOut *wire.TxOut) []byte) *btcutil.Block {
+
+	coinbase, err := NewCoinbaseTx(CoinbaseSpec{Height: 1000, PkScript: []byte{txscript.OP_TRUE}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := wire.NewMsgBlock(&wire.BlockHeader{})
+	block.AddTransaction(coinbase)
+	ops := make([]wire.OutPoint, 0, len(prevOuts))
+	for op := range prevOuts {
+		ops = append(ops, op)
+	}
+	for n, count := range inputs {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		for _, op := range ops[:count] {
+			tx.AddTxIn(wire.NewTxIn(&op, nil, nil))
+		}
+		ops = ops[count:]
+		tx.AddTxOut(wire.NewTxOut(int64(n), []byte{txscript.OP_TRUE}))
+		for i, txIn := range tx.TxIn {
+			txIn.SignatureScript = signInput(tx, i, prevOuts[txIn.PreviousOutPoint])
+		}
+		block.AddTransaction(tx)
+	}
+	return btcutil.NewBlock(block)
+}
+
+func TestValidateBlockLimits(t *testing.T) {
+	key := signingTestKeys()[0]
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	bare := blockLimitsTestMultisig(4)
+	redeemScript := blockLimitsTestMultisig(15)
+	p2sh, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+	sign := func(tx *wire.MsgTx, idx int, prevOut *wire.TxOut) []byte {
+		switch {
+		case string(prevOut.PkScript) == string(p2pkh):
+			scriptSig, err := SignatureScript(tx, idx, p2pkh, txscript.SigHashAll|SigHashForkID, key, true,
+				prevOut.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return scriptSig
+		case string(prevOut.PkScript) == string(p2sh):
+			sig, _ := RawTxInSignature(tx, idx, redeemScript, txscript.SigHashAll, key, prevOut.Value)
+			scriptSig, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(sig).
+				AddData(redeemScript).Script()
+			return scriptSig
+		}
+		sig, _ := RawTxInSignature(tx, idx, prevOut.PkScript, txscript.SigHashAll, key, prevOut.Value)
+		scriptSig, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(sig).Script()
+		return scriptSig
+	}
+	outputs := func(pkScript []byte, n int) testPrevOutputFetcher {
+		prevOuts := make(testPrevOutputFetcher)
+		for i := 0; i < n; i++ {
+			prevOuts[wire.OutPoint{Hash: chainhash.Hash{byte(i), byte(i >> 8), pkScript[0]}}] =
+				wire.NewTxOut(10000, pkScript)
+		}
+		return prevOuts
+	}
+
+	// A transaction of the block spending the output of another one.
+	block := blockLimitsTestBlock(t, []int{2}, outputs(p2pkh, 2), sign)
+	parent := block.Transactions()[1]
+	child := wire.NewMsgTx(wire.TxVersion)
+	child.AddTxIn(wire.NewTxIn(wire.NewOutPoint(parent.Hash(), 0), nil, nil))
+	child.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	block.MsgBlock().AddTransaction(child)
+	block = btcutil.NewBlock(block.MsgBlock())
+	if err := ValidateBlockLimits(block, outputs(p2pkh, 2), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateBlockLimits(block, nil, 0); err == nil || !strings.Contains(err.Error(), "unknown output") {
+		t.Errorf("got %v, want an unknown output error", err)
+	}
+	size := block.MsgBlock().SerializeSize()
+	if err := ValidateBlockLimits(block, outputs(p2pkh, 2), size-1); !errors.Is(err, ErrBlockTooLarge) {
+		t.Errorf("got %v, want %v", err, ErrBlockTooLarge)
+	}
+
+	// Transactions of 60 bytes, smaller than allowed, fit more of them in
+	// the size limit than allowed.
+	tiny := wire.NewMsgBlock(&wire.BlockHeader{})
+	for i := 0; i < 20; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{byte(i)}}, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(0, nil))
+		tiny.AddTransaction(tx)
+	}
+	if err := ValidateBlockLimits(btcutil.NewBlock(tiny), nil, tiny.SerializeSize()); !errors.Is(err,
+		ErrBlockTxCount) {
+		t.Errorf("got %v, want %v", err, ErrBlockTxCount)
+	}
+
+	tests := []struct {
+		name         string
+		prevOuts     testPrevOutputFetcher
+		inputs       []int
+		maxBlockSize int
+		err          error
+		where        string
+	}{
+		// 15 checks for a scriptSig of about 589 bytes, the most it allows.
+		{"multisig", outputs(p2sh, 3), []int{1, 2}, 0, nil, ""},
+		{"block", outputs(p2sh, 3), []int{1, 2}, 3000, ErrBlockSigChecks, "transaction 2"},
+		{"transaction", outputs(p2sh, 202), []int{1, 201}, 0, ErrTxSigChecks, "transaction 2"},
+		// 4 checks for a scriptSig of about 74 bytes, allowing 3.
+		{"input", outputs(bare, 1), []int{1}, 0, ErrInputSigChecks, "transaction 1"},
+	}
+	for _, test := range tests {
+		block := blockLimitsTestBlock(t, test.inputs, test.prevOuts, sign)
+		err := ValidateBlockLimits(block, test.prevOuts, test.maxBlockSize)
+		if !errors.Is(err, test.err) || (err != nil && test.err == nil) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err != nil && !strings.Contains(err.Error(), test.where) {
+			t.Errorf("%s: error %q does not name %s", test.name, err, test.where)
+		}
+	}
+}
+
+// TestValidateBlockLimitsTokens validates blocks spending token outputs, and
+// outputs of opcodes the engine does not implement.
+func TestValidateBlockLimitsTokens(t *testing.T) {
+	key := signingTestKeys()[0]
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	token := &TokenData{Category: chainhash.Hash{9}, Amount: 1000}
+	prevOuts := testPrevOutputFetcher{
+		wire.OutPoint{Hash: chainhash.Hash{1}}: wire.NewTxOut(10000, append(token.Bytes(), p2pkh...)),
+		wire.OutPoint{Hash: chainhash.Hash{2}}: wire.NewTxOut(10000, append(token.Bytes(), p2pkh...)),
+	}
+	sign := func(tx *wire.MsgTx, idx int, prevOut *wire.TxOut) []byte {
+		scriptSig, err := SignatureScript(tx, idx, p2pkh, SigHashAllForkID, key, true, prevOut.Value,
+			WithTokenPrevout(token))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return scriptSig
+	}
+	if err := ValidateBlockLimits(blockLimitsTestBlock(t, []int{2}, prevOuts, sign), prevOuts, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// OP_INPUTINDEX 0 OP_EQUAL
+	introspection := testPrevOutputFetcher{
+		wire.OutPoint{Hash: chainhash.Hash{3}}: wire.NewTxOut(10000, []byte{opInputIndex, txscript.OP_0,
+			txscript.OP_EQUAL}),
+	}
+	block := blockLimitsTestBlock(t, []int{1}, introspection, func(*wire.MsgTx, int, *wire.TxOut) []byte {
+		return nil
+	})
+	if err := ValidateBlockLimits(block, introspection, 0); !errors.Is(err, ErrUnsupportedOpcode) {
+		t.Errorf("got %v, want %v", err, ErrUnsupportedOpcode)
+	}
+}
@@ -0,0 +1,198 @@
+package bchutil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// MaxBlockSize is the largest block allowed by consensus.
+const MaxBlockSize = 32000000
+
+// ErrBlockTooLarge describes an error where a block read by a BlockReader is
+// larger than its size limit, or claims a length taking it over the limit.
+var ErrBlockTooLarge = errors.New("block too large")
+
+// blockReaderCounter counts the bytes read of a block, failing the reads past
+// its size limit.
+type blockReaderCounter struct {
+	r        *bufio.Reader
+	read     int64
+	maxBytes int64
+}
+
+// Read reads from the block.
+func (c *blockReaderCounter) Read(p []byte) (int, error) {
+	if int64(len(p)) > c.maxBytes-c.read {
+		if c.read >= c.maxBytes {
+			return 0, fmt.Errorf("%w: more than %d bytes", ErrBlockTooLarge, c.maxBytes)
+		}
+		p = p[:c.maxBytes-c.read]
+	}
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	return n, err
+}
+
+// copyN copies the next n bytes of the block to w, n being a length read from
+// the block, checked against the size limit before anything is read.
+func (c *blockReaderCounter) copyN(w io.Writer, n uint64) error {
+	if n > uint64(c.maxBytes-c.read) {
+		return fmt.Errorf("%w: %d bytes length at offset %d, limit %d", ErrBlockTooLarge, n, c.read, c.maxBytes)
+	}
+	_, err := io.CopyN(w, c, int64(n))
+	return err
+}
+
+// BlockReader reads the transactions of a serialized block one at a time, so
+// that a block need not be held in memory to be processed.
+type BlockReader struct {
+	r       blockReaderCounter
+	header  wire.BlockHeader
+	txCount uint64
+	index   uint64
+
+	// txBuf holds the serialization of the transaction being read, reused
+	// from a transaction to the next.
+	txBuf bytes.Buffer
+	err   error
+}
+
+// NewBlockReader reads the header and the number of transactions of the block
+// serialized in r, of at most maxBlockSize bytes, MaxBlockSize when not
+// positive.  Reading a block larger than the limit fails with an error
+// wrapping ErrBlockTooLarge once the limit is reached.  Reads of r are
+// buffered, so that r may be read past the end of the block.
+func NewBlockReader(r io.Reader, maxBlockSize int) (*BlockReader, error) {
+	if maxBlockSize <= 0 {
+		maxBlockSize = MaxBlockSize
+	}
+	br := &BlockReader{r: blockReaderCounter{r: bufio.NewReader(r), maxBytes: int64(maxBlockSize)}}
+	if err := br.header.Deserialize(&br.r); err != nil {
+		return nil, err
+	}
+	var err error
+	if br.txCount, err = wire.ReadVarInt(&br.r, 0); err != nil {
+		return nil, err
+	}
+	return br, nil
+}
+
+// Header returns the header of the block.
+func (br *BlockReader) Header() *wire.BlockHeader {
+	return &br.header
+}
+
+// TxCount returns the number of transactions of the block.
+func (br *BlockReader) TxCount() uint64 {
+	return br.txCount
+}
+
+// Next parses the next transaction of the block and returns it, with its
+// index in the block set, and the offset of its serialization in the block.
+// It returns io.EOF after the last transaction.  Errors are sticky: once a
+// transaction fails to be read, so do the next calls.
+func (br *BlockReader) Next() (*btcutil.Tx, int64, error) {
+	br.txBuf.Reset()
+	offset, _, err := br.scanTx(&br.txBuf)
+	if err != nil {
+		return nil, offset, err
+	}
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(br.txBuf.Bytes())); err != nil {
+		br.err = err
+		return nil, offset, err
+	}
+	tx := btcutil.NewTx(&msgTx)
+	tx.SetIndex(int(br.index - 1))
+	return tx, offset, nil
+}
+
+// Skip skips the next transaction of the block, reading only the lengths in
+// its serialization, and returns its offset and size.  It returns io.EOF
+// after the last transaction, and fails like Next.
+func (br *BlockReader) Skip() (int64, int, error) {
+	return br.scanTx(io.Discard)
+}
+
+// scanTx copies the serialization of the next transaction to w, checking its
+// lengths, and returns its offset and size.
+func (br *BlockReader) scanTx(w io.Writer) (int64, int, error) {
+	offset := br.r.read
+	if br.err != nil {
+		return offset, 0, br.err
+	}
+	if br.index == br.txCount {
+		return offset, 0, io.EOF
+	}
+	if err := br.scanTxFields(w); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		br.err = fmt.Errorf("transaction %d at offset %d: %w", br.index, offset, err)
+		return offset, 0, br.err
+	}
+	br.index++
+	return offset, int(br.r.read - offset), nil
+}
+
+// scanTxFields copies the fields of a transaction to w: the version, the
+// outpoint, scriptSig and sequence of each input, the value and script of each
+// output, and the lock time.
+func (br *BlockReader) scanTxFields(w io.Writer) error {
+	if err := br.r.copyN(w, 4); err != nil {
+		return err
+	}
+	inputs, err := br.copyVarInt(w)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < inputs; i++ {
+		if err := br.r.copyN(w, 36); err != nil {
+			return err
+		}
+		if err := br.copyScript(w); err != nil {
+			return err
+		}
+		if err := br.r.copyN(w, 4); err != nil {
+			return err
+		}
+	}
+	outputs, err := br.copyVarInt(w)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < outputs; i++ {
+		if err := br.r.copyN(w, 8); err != nil {
+			return err
+		}
+		if err := br.copyScript(w); err != nil {
+			return err
+		}
+	}
+	return br.r.copyN(w, 4)
+}
+
+// copyScript copies a script of the block, prefixed with its length, to w.
+func (br *BlockReader) copyScript(w io.Writer) error {
+	n, err := br.copyVarInt(w)
+	if err != nil {
+		return err
+	}
+	return br.r.copyN(w, n)
+}
+
+// copyVarInt reads a variable length integer of the block, copying its
+// serialization to w.
+func (br *BlockReader) copyVarInt(w io.Writer) (uint64, error) {
+	n, err := wire.ReadVarInt(&br.r, 0)
+	if err != nil {
+		return 0, err
+	}
+	return n, wire.WriteVarInt(w, 0, n)
+}
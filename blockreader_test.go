@@ -0,0 +1,165 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// blockReaderTestTx returns a transaction with inputs inputs and outputs
+// outputs paying to scripts of scriptSize bytes.
+func blockReaderTestTx(seed byte, inputs, outputs, scriptSize int) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for i := 0; i < inputs; i++ {
+		hash := chainhash.Hash{seed, byte(i)}
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, uint32(i)), []byte{seed, 0x51}, nil))
+	}
+	for i := 0; i < outputs; i++ {
+		script := bytes.Repeat([]byte{seed}, scriptSize)
+		tx.AddTxOut(wire.NewTxOut(int64(i), script))
+	}
+	return tx
+}
+
+func TestBlockReader(t *testing.T) {
+	block := wire.NewMsgBlock(&wire.BlockHeader{Version: 4, Timestamp: time.Unix(1600000000, 0), Nonce: 7})
+	for i := 0; i < 5; i++ {
+		block.AddTransaction(blockReaderTestTx(byte(i), i+1, 2*i+1, 25+i))
+	}
+	var buf bytes.Buffer
+	if err := block.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := NewBlockReader(bytes.NewReader(buf.Bytes()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if br.Header().BlockHash() != block.BlockHash() || br.TxCount() != 5 {
+		t.Fatalf("header %v with %d transactions", br.Header().BlockHash(), br.TxCount())
+	}
+	offset := int64(wire.MaxBlockHeaderPayload + wire.VarIntSerializeSize(5))
+	for i, want := range block.Transactions {
+		if i%2 == 1 {
+			got, size, err := br.Skip()
+			if err != nil || got != offset || size != want.SerializeSize() {
+				t.Fatalf("skipped transaction %d at offset %d of %d bytes: %v", i, got, size, err)
+			}
+		} else {
+			tx, got, err := br.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != offset || *tx.Hash() != want.TxHash() || tx.Index() != i {
+				t.Fatalf("transaction %d: %v at offset %d, index %d", i, tx.Hash(), got, tx.Index())
+			}
+		}
+		offset += int64(want.SerializeSize())
+	}
+	if _, _, err := br.Next(); err != io.EOF {
+		t.Fatalf("got %v after the last transaction", err)
+	}
+
+	// A block claiming a script of 1 GB, which is read no further.
+	huge := append([]byte(nil), buf.Bytes()[:offset-int64(block.Transactions[4].SerializeSize())]...)
+	huge = append(huge, 1, 0, 0, 0, 1)
+	huge = append(huge, make([]byte, 36)...)
+	huge = append(huge, 0xfe, 0, 0xca, 0x9a, 0x3b)
+
+	tests := []struct {
+		name         string
+		block        []byte
+		maxBlockSize int
+		err          error
+	}{
+		{"over the limit", buf.Bytes(), buf.Len() - 1, ErrBlockTooLarge},
+		{"truncated", buf.Bytes()[:buf.Len()-10], 0, io.ErrUnexpectedEOF},
+		{"huge script", huge, 0, ErrBlockTooLarge},
+	}
+	for _, test := range tests {
+		br, err := NewBlockReader(bytes.NewReader(test.block), test.maxBlockSize)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for err == nil {
+			_, _, err = br.Skip()
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		if _, _, again := br.Next(); again != err {
+			t.Errorf("%s: error is not sticky: %v", test.name, again)
+		}
+	}
+}
+
+func TestBlockReaderMemory(t *testing.T) {
+	// A block of almost MaxBlockSize bytes, made of the same transaction of
+	// about 1 MB, which is streamed without the block being serialized.
+	tx := blockReaderTestTx(1, 10, 2000, 500)
+	var txBuf, prefix bytes.Buffer
+	tx.Serialize(&txBuf)
+	count := MaxBlockSize / txBuf.Len()
+	header := wire.BlockHeader{Version: 4}
+	header.Serialize(&prefix)
+	wire.WriteVarInt(&prefix, 0, uint64(count))
+	readers := []io.Reader{&prefix}
+	for i := 0; i < count; i++ {
+		readers = append(readers, bytes.NewReader(txBuf.Bytes()))
+	}
+	size := prefix.Len() + count*txBuf.Len()
+	if size > MaxBlockSize || size < MaxBlockSize-txBuf.Len() {
+		t.Fatalf("block of %d bytes", size)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	br, err := NewBlockReader(io.MultiReader(readers...), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Transactions are parsed and skipped in turn.
+	var peak uint64
+	for i := 0; ; i++ {
+		var last runtime.MemStats
+		runtime.ReadMemStats(&last)
+		var parsed *btcutil.Tx
+		if i%2 == 0 {
+			parsed, _, err = br.Next()
+		} else {
+			_, _, err = br.Skip()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		runtime.ReadMemStats(&after)
+		if allocated := after.TotalAlloc - last.TotalAlloc; allocated > peak {
+			peak = allocated
+		}
+		if i < 2 && parsed != nil && *parsed.Hash() != tx.TxHash() {
+			t.Fatalf("transaction %d: %v", i, parsed.Hash())
+		}
+	}
+	runtime.ReadMemStats(&after)
+
+	// Parsing a transaction allocates about twice its size, more for the
+	// first one growing the buffer reused by the next ones, and skipping
+	// one next to nothing, so that reading the block, half of whose
+	// transactions are parsed, allocates less than its size.
+	if limit := uint64(5 * txBuf.Len()); peak > limit {
+		t.Errorf("reading a transaction allocated %d bytes, limit %d", peak, limit)
+	}
+	if total, limit := after.TotalAlloc-before.TotalAlloc, uint64(size); total > limit {
+		t.Errorf("reading the block allocated %d bytes, limit %d", total, limit)
+	}
+}
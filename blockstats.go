@@ -0,0 +1,314 @@
+package bchutil
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// FeeRatePercentiles are the fee rates of the transactions of a block,
+// weighted by their size as getblockstats weights them.
+type FeeRatePercentiles struct {
+	Min FeeRate `json:"min"`
+	P10 FeeRate `json:"p10"`
+	P25 FeeRate `json:"p25"`
+	P50 FeeRate `json:"p50"`
+	P75 FeeRate `json:"p75"`
+	P90 FeeRate `json:"p90"`
+	Max FeeRate `json:"max"`
+}
+
+// OutputTypeCounts are the numbers of outputs of a block by script type,
+// token prefixes skipped.
+type OutputTypeCounts struct {
+	P2PKH    int `json:"p2pkh"`
+	P2SH     int `json:"p2sh"`
+	P2SH32   int `json:"p2sh32"`
+	P2PK     int `json:"p2pk"`
+	Multisig int `json:"multisig"`
+	Data     int `json:"data"`
+	Other    int `json:"other"`
+
+	// Token is the number of outputs carrying tokens, also counted by
+	// the type of their script.
+	Token int `json:"token"`
+}
+
+// TokenActivity counts the tokens of the outputs of a block and, for the
+// transactions whose inputs are all known, the categories they create and
+// burn.
+type TokenActivity struct {
+	// Outputs are the outputs carrying tokens, FungibleOutputs and
+	// NFTOutputs those carrying fungible tokens and an NFT, and Categories
+	// the number of categories of the outputs.
+	Outputs         int `json:"outputs"`
+	FungibleOutputs int `json:"fungibleOutputs"`
+	NFTOutputs      int `json:"nftOutputs"`
+	Categories      int `json:"categories"`
+
+	// Geneses are the categories created, Burns the categories of which
+	// transactions burn tokens, and Invalid the transactions breaking the
+	// token rules, which valid blocks have none of.
+	Geneses int `json:"geneses"`
+	Burns   int `json:"burns"`
+	Invalid int `json:"invalid"`
+}
+
+// BlockStatsReport holds the statistics of a block computed by BlockStats.
+type BlockStatsReport struct {
+	Hash         string `json:"hash"`
+	Size         int    `json:"size"`
+	Transactions int    `json:"transactions"`
+	Inputs       int    `json:"inputs"`
+	Outputs      int    `json:"outputs"`
+
+	// Analyzed is the number of transactions, the coinbase aside, whose
+	// inputs were looked up: all of them, or the sample if Sampled.
+	Analyzed int  `json:"analyzed"`
+	Sampled  bool `json:"sampled"`
+
+	// AnalyzedInputs are the inputs of the analyzed transactions,
+	// KnownInputs those whose previous output was found, and
+	// PrevOutCoverage their percentage.
+	AnalyzedInputs  int     `json:"analyzedInputs"`
+	KnownInputs     int     `json:"knownInputs"`
+	PrevOutCoverage float64 `json:"prevOutCoverage"`
+
+	// FeeTransactions are the analyzed transactions whose previous
+	// outputs are all known, Fees the sum of their fees, and FeeSize the
+	// sum of their sizes.  EstimatedFees are the fees of all the
+	// transactions the coinbase aside, Fees extrapolated by size, which are
+	// Fees when every previous output is known and nothing is sampled.
+	FeeTransactions int            `json:"feeTransactions"`
+	Fees            btcutil.Amount `json:"fees"`
+	FeeSize         int            `json:"feeSize"`
+	EstimatedFees   btcutil.Amount `json:"estimatedFees"`
+
+	// FeeRates are the fee rates of the FeeTransactions.
+	FeeRates FeeRatePercentiles `json:"feeRates"`
+
+	OutputTypes OutputTypeCounts `json:"outputTypes"`
+	Tokens      TokenActivity    `json:"tokens"`
+}
+
+// blockStatsOptions are the options of BlockStats.
+type blockStatsOptions struct {
+	sampleEvery int
+}
+
+// BlockStatsOption is an option of BlockStats.
+type BlockStatsOption func(*blockStatsOptions)
+
+// BlockStatsSampling makes BlockStats look up the inputs of every nth
+// transaction only, the first one after the coinbase included, for quick
+// estimates of the fees of large blocks.  Outputs are always all counted.
+func BlockStatsSampling(n int) BlockStatsOption {
+	return func(o *blockStatsOptions) {
+		o.sampleEvery = n
+	}
+}
+
+// blockPrevOuts finds the outputs of a block, then those of a fetcher.
+type blockPrevOuts struct {
+	outputs map[wire.OutPoint]*wire.TxOut
+	fetcher PrevOutputFetcher
+}
+
+// FetchPrevOutput implements PrevOutputFetcher.
+func (p *blockPrevOuts) FetchPrevOutput(op wire.OutPoint) *wire.TxOut {
+	if txOut := p.outputs[op]; txOut != nil {
+		return txOut
+	}
+	if p.fetcher == nil {
+		return nil
+	}
+	return p.fetcher.FetchPrevOutput(op)
+}
+
+// feeRateSample is the fee rate and size of a transaction.
+type feeRateSample struct {
+	rate FeeRate
+	size int
+}
+
+// BlockStats returns the statistics of block: its fees and their rates,
+// the types of its outputs and its token activity.  The outputs spent are
+// those of the block, or fetched with fetcher, which may be nil: the fees are
+// those of the transactions whose outputs spent are all known, whose share
+// the report gives.  Token geneses are counted, and burns and the token rules
+// checked with ValidateTokenTx, for these transactions only.
+func BlockStats(block *btcutil.Block, fetcher PrevOutputFetcher, opts ...BlockStatsOption) (*BlockStatsReport,
+	error) {
+
+	o := blockStatsOptions{sampleEvery: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.sampleEvery < 1 {
+		return nil, fmt.Errorf("sampling every %d transactions", o.sampleEvery)
+	}
+	txs := block.Transactions()
+	r := &BlockStatsReport{
+		Hash:         block.Hash().String(),
+		Size:         block.MsgBlock().SerializeSize(),
+		Transactions: len(txs),
+		Sampled:      o.sampleEvery > 1,
+	}
+	prevOuts := &blockPrevOuts{outputs: make(map[wire.OutPoint]*wire.TxOut), fetcher: fetcher}
+	for _, tx := range txs {
+		for i, txOut := range tx.MsgTx().TxOut {
+			prevOuts.outputs[wire.OutPoint{Hash: *tx.Hash(), Index: uint32(i)}] = txOut
+		}
+	}
+
+	categories := make(map[chainhash.Hash]bool)
+	var samples []feeRateSample
+	nonCoinbaseSize, nonCoinbase := 0, 0
+	for idx, tx := range txs {
+		msgTx := tx.MsgTx()
+		r.Inputs += len(msgTx.TxIn)
+		r.Outputs += len(msgTx.TxOut)
+		for _, txOut := range msgTx.TxOut {
+			r.countOutput(txOut, categories)
+		}
+		if idx == 0 && IsCoinBaseTx(msgTx) {
+			continue
+		}
+		size := msgTx.SerializeSize()
+		nonCoinbaseSize += size
+		nonCoinbase++
+		if (nonCoinbase-1)%o.sampleEvery != 0 {
+			continue
+		}
+		r.Analyzed++
+		if fee, ok := r.analyze(msgTx, prevOuts); ok {
+			r.FeeTransactions++
+			r.Fees += fee
+			r.FeeSize += size
+			samples = append(samples, feeRateSample{TxFeeRate(fee, size), size})
+		}
+	}
+	r.Tokens.Categories = len(categories)
+
+	if r.AnalyzedInputs != 0 {
+		r.PrevOutCoverage = 100 * float64(r.KnownInputs) / float64(r.AnalyzedInputs)
+	}
+	if r.FeeSize != 0 {
+		r.EstimatedFees = btcutil.Amount(float64(r.Fees) * float64(nonCoinbaseSize) / float64(r.FeeSize))
+	}
+	r.FeeRates = feeRatePercentiles(samples)
+	return r, nil
+}
+
+// countOutput counts the type and tokens of txOut.
+func (r *BlockStatsReport) countOutput(txOut *wire.TxOut, categories map[chainhash.Hash]bool) {
+	token, pkScript, err := SplitTokenPrefix(txOut.PkScript)
+	if err != nil {
+		r.OutputTypes.Other++
+		return
+	}
+	if token != nil {
+		r.OutputTypes.Token++
+		r.Tokens.Outputs++
+		if token.Amount != 0 {
+			r.Tokens.FungibleOutputs++
+		}
+		if token.HasNFT {
+			r.Tokens.NFTOutputs++
+		}
+		categories[token.Category] = true
+	}
+	switch {
+	case isPayToScriptHash32(pkScript):
+		r.OutputTypes.P2SH32++
+		return
+	case len(pkScript) != 0 && pkScript[0] == txscript.OP_RETURN:
+		r.OutputTypes.Data++
+		return
+	}
+	switch txscript.GetScriptClass(pkScript) {
+	case txscript.PubKeyHashTy:
+		r.OutputTypes.P2PKH++
+	case txscript.ScriptHashTy:
+		r.OutputTypes.P2SH++
+	case txscript.PubKeyTy:
+		r.OutputTypes.P2PK++
+	case txscript.MultiSigTy:
+		r.OutputTypes.Multisig++
+	default:
+		r.OutputTypes.Other++
+	}
+}
+
+// analyze looks up the outputs spent by tx, and returns its fee if they are
+// all known.
+func (r *BlockStatsReport) analyze(tx *wire.MsgTx, prevOuts PrevOutputFetcher) (btcutil.Amount, bool) {
+	var in btcutil.Amount
+	known := 0
+	for _, txIn := range tx.TxIn {
+		if prevOut := prevOuts.FetchPrevOutput(txIn.PreviousOutPoint); prevOut != nil {
+			known++
+			in += btcutil.Amount(prevOut.Value)
+		}
+	}
+	r.AnalyzedInputs += len(tx.TxIn)
+	r.KnownInputs += known
+	if known != len(tx.TxIn) {
+		return 0, false
+	}
+
+	result, err := ValidateTokenTx(tx, prevOuts)
+	if err != nil {
+		r.Tokens.Invalid++
+	} else {
+		for _, acc := range result.Categories {
+			if acc.Genesis {
+				r.Tokens.Geneses++
+			}
+			if acc.BurnedAmount != 0 || acc.BurnedNFTs != 0 {
+				r.Tokens.Burns++
+			}
+		}
+	}
+
+	var out btcutil.Amount
+	for _, txOut := range tx.TxOut {
+		out += btcutil.Amount(txOut.Value)
+	}
+	return in - out, true
+}
+
+// feeRatePercentiles returns the percentiles of samples weighted by size.
+func feeRatePercentiles(samples []feeRateSample) FeeRatePercentiles {
+	if len(samples) == 0 {
+		return FeeRatePercentiles{}
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].rate < samples[j].rate })
+	total := 0
+	for _, s := range samples {
+		total += s.size
+	}
+	percentile := func(p int) FeeRate {
+		cum := 0
+		for _, s := range samples {
+			cum += s.size
+			if cum*100 >= total*p {
+				return s.rate
+			}
+		}
+		return samples[len(samples)-1].rate
+	}
+	return FeeRatePercentiles{
+		Min: samples[0].rate,
+		P10: percentile(10),
+		P25: percentile(25),
+		P50: percentile(50),
+		P75: percentile(75),
+		P90: percentile(90),
+		Max: samples[len(samples)-1].rate,
+	}
+}
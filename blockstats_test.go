@@ -0,0 +1,111 @@
+package bchutil
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestBlockStats(t *testing.T) {
+	p2pkh, _ := payToPubKeyHashScript(make([]byte, 20))
+	p2sh, _ := payToScriptHashScript(make([]byte, 20))
+	p2sh32 := append(append([]byte{txscript.OP_HASH256, txscript.OP_DATA_32}, make([]byte, 32)...),
+		txscript.OP_EQUAL)
+	data := []byte{txscript.OP_RETURN, txscript.OP_DATA_1, 1}
+
+	coinbase, _ := NewCoinbaseTx(CoinbaseSpec{Height: 1000, PkScript: p2pkh}, 0)
+	known := wire.OutPoint{Hash: chainhash.Hash{1}}
+	category := chainhash.Hash{2}
+	fetcher := testPrevOutputFetcher{
+		known:            wire.NewTxOut(100000, p2pkh),
+		{Hash: category}: wire.NewTxOut(50000, p2sh),
+	}
+
+	// parent pays 1000 satoshis of fees, child spending it 500, genesis
+	// creating tokens 2000, and unknown spends an unknown output.
+	parent := wire.NewMsgTx(wire.TxVersion)
+	parent.AddTxIn(wire.NewTxIn(&known, nil, nil))
+	parent.AddTxOut(wire.NewTxOut(90000, p2sh))
+	parent.AddTxOut(wire.NewTxOut(9000, p2sh32))
+	parent.AddTxOut(wire.NewTxOut(0, data))
+	child := wire.NewMsgTx(wire.TxVersion)
+	child.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: parent.TxHash()}, nil, nil))
+	child.AddTxOut(wire.NewTxOut(89500, p2pkh))
+	genesis := wire.NewMsgTx(wire.TxVersion)
+	genesis.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: category}, nil, nil))
+	genesis.AddTxOut(tokenChangeOutput(&TokenData{Category: category, Amount: 100}, p2pkh))
+	genesis.AddTxOut(tokenChangeOutput(&TokenData{Category: category, HasNFT: true}, p2pkh))
+	genesis.TxOut[0].Value, genesis.TxOut[1].Value = 24000, 24000
+	unknown := wire.NewMsgTx(wire.TxVersion)
+	unknown.AddTxIn(wire.NewTxIn(&known, nil, nil))
+	unknown.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{3}}, nil, nil))
+	unknown.AddTxOut(wire.NewTxOut(1000, p2pkh))
+
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{})
+	// The child comes first, as canonical ordering may put it.
+	for _, tx := range []*wire.MsgTx{coinbase, child, parent, genesis, unknown} {
+		msgBlock.AddTransaction(tx)
+	}
+	block := btcutil.NewBlock(msgBlock)
+
+	r, err := BlockStats(block, fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Transactions != 5 || r.Analyzed != 4 || r.Sampled || r.Inputs != 6 || r.Outputs != 8 {
+		t.Errorf("%d transactions, %d analyzed, %d inputs, %d outputs", r.Transactions, r.Analyzed, r.Inputs,
+			r.Outputs)
+	}
+	if r.AnalyzedInputs != 5 || r.KnownInputs != 4 || r.PrevOutCoverage != 80 {
+		t.Errorf("%d of %d inputs known, %v%%", r.KnownInputs, r.AnalyzedInputs, r.PrevOutCoverage)
+	}
+	feeSize := parent.SerializeSize() + child.SerializeSize() + genesis.SerializeSize()
+	if r.FeeTransactions != 3 || r.Fees != 3500 || r.FeeSize != feeSize {
+		t.Errorf("%d transactions paying %v in %d bytes", r.FeeTransactions, r.Fees, r.FeeSize)
+	}
+	estimated := btcutil.Amount(3500 * float64(feeSize+unknown.SerializeSize()) / float64(feeSize))
+	if r.EstimatedFees != estimated {
+		t.Errorf("estimated fees %v, want %v", r.EstimatedFees, estimated)
+	}
+	rates := r.FeeRates
+	if rates.Min != TxFeeRate(500, child.SerializeSize()) ||
+		rates.Max != TxFeeRate(2000, genesis.SerializeSize()) ||
+		rates.P50 != TxFeeRate(1000, parent.SerializeSize()) || rates.P10 != rates.Min || rates.P90 != rates.Max {
+		t.Errorf("fee rates %+v", rates)
+	}
+	if want := (OutputTypeCounts{P2PKH: 5, P2SH: 1, P2SH32: 1, Data: 1, Token: 2}); r.OutputTypes != want {
+		t.Errorf("output types %+v, want %+v", r.OutputTypes, want)
+	}
+	want := TokenActivity{Outputs: 2, FungibleOutputs: 1, NFTOutputs: 1, Categories: 1, Geneses: 1}
+	if r.Tokens != want {
+		t.Errorf("tokens %+v, want %+v", r.Tokens, want)
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"fees":3500`, `"prevOutCoverage":80`, `"p2sh32":1`, `"geneses":1`,
+		`"hash":"` + block.Hash().String() + `"`} {
+		if !strings.Contains(string(b), field) {
+			t.Errorf("%s not in %s", field, b)
+		}
+	}
+
+	// Sampling every other transaction analyzes the child and genesis.
+	r, err = BlockStats(block, fetcher, BlockStatsSampling(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Sampled || r.Analyzed != 2 || r.Fees != 2500 || r.OutputTypes.P2PKH != 5 {
+		t.Errorf("sampled: %d analyzed, fees %v, %d P2PKH outputs", r.Analyzed, r.Fees, r.OutputTypes.P2PKH)
+	}
+	if _, err := BlockStats(block, fetcher, BlockStatsSampling(0)); err == nil {
+		t.Error("sampling every 0 transactions")
+	}
+}
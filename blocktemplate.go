@@ -0,0 +1,366 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// blockTemplateVersion is the version of the headers of block
+	// templates, signaling no BIP 9 deployment.
+	blockTemplateVersion = 0x20000000
+
+	// maxCoinbaseScriptSigSize is the largest coinbase scriptSig.
+	maxCoinbaseScriptSigSize = 100
+)
+
+// CoinbaseSpec describes the coinbase transaction of a block.
+type CoinbaseSpec struct {
+	// Height is the height of the block, pushed first by the scriptSig as
+	// required by BIP 34.
+	Height int32
+
+	// PkScript is the output script paid the subsidy and the fees.
+	PkScript []byte
+
+	// ExtraData is pushed by the scriptSig after the height, such as an
+	// extra nonce or a pool tag.
+	ExtraData []byte
+
+	// Params is the network whose subsidy schedule the coinbase follows,
+	// the main network if nil.
+	Params *chaincfg.Params
+}
+
+// NewCoinbaseTx returns the coinbase transaction of spec, paying the subsidy
+// of the block and fees.  Coinbases that would be smaller than MinTxSize pad
+// ExtraData with zeros, and so do the scriptSigs that would be smaller than
+// the 2 bytes consensus requires.
+func NewCoinbaseTx(spec CoinbaseSpec, fees btcutil.Amount) (*wire.MsgTx, error) {
+	if spec.Height < 0 {
+		return nil, fmt.Errorf("negative block height %d", spec.Height)
+	}
+	if len(spec.PkScript) == 0 {
+		return nil, errors.New("no coinbase output script")
+	}
+	if err := CheckAmount(fees); err != nil {
+		return nil, fmt.Errorf("fees: %w", err)
+	}
+	value, err := AddChecked(CalcBlockSubsidy(spec.Height, spec.Params), fees)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(int64(value), spec.PkScript))
+	extraData := append([]byte(nil), spec.ExtraData...)
+	for {
+		builder := txscript.NewScriptBuilder().AddInt64(int64(spec.Height))
+		if len(extraData) != 0 {
+			builder.AddData(extraData)
+		}
+		if tx.TxIn[0].SignatureScript, err = builder.Script(); err != nil {
+			return nil, err
+		}
+		if size := tx.SerializeSize(); size < MinTxSize {
+			extraData = append(extraData, make([]byte, MinTxSize-size)...)
+			continue
+		}
+		// Heights up to 16 are pushed by a single opcode, and an OP_0
+		// follows them as in Bitcoin ABC.
+		if len(tx.TxIn[0].SignatureScript) < minCoinbaseScriptSigSize {
+			extraData = []byte{0}
+			continue
+		}
+		break
+	}
+	if n := len(tx.TxIn[0].SignatureScript); n > maxCoinbaseScriptSigSize {
+		return nil, fmt.Errorf("coinbase scriptSig of %d bytes, limit %d", n, maxCoinbaseScriptSigSize)
+	}
+	return tx, nil
+}
+
+// TxWithFee is a candidate transaction of a block template.
+type TxWithFee struct {
+	Tx  *btcutil.Tx
+	Fee btcutil.Amount
+
+	// SigChecks is the number of signature checks of the inputs of the
+	// transaction.
+	SigChecks int
+}
+
+// TemplateStats describes a block template and its headroom.
+type TemplateStats struct {
+	// Fees are the fees of the transactions, paid to the coinbase with
+	// Subsidy.
+	Fees    btcutil.Amount
+	Subsidy btcutil.Amount
+
+	// Size is the size of the block, of at most MaxSize bytes, and
+	// SigChecks the signature checks of its transactions, at most
+	// SigCheckLimit.
+	Size          int
+	MaxSize       int
+	SigChecks     int
+	SigCheckLimit int
+
+	// Transactions is the number of transactions selected, without the
+	// coinbase, and Skipped the number of candidates left out.
+	Transactions int
+	Skipped      int
+}
+
+// BuildBlockTemplate returns the block mining candidates on top of the block
+// prevHash, with target bits and timestamp now, and its stats.  Candidates are
+// selected with the other candidates they spend the outputs of, by decreasing
+// fee rate of these packages so that children pay for their parents, while
+// the block stays within maxSize bytes and sigCheckLimit signature checks.
+// Candidates spending the outputs of a candidate left out are left out too.
+// The transactions are in the canonical order, following the coinbase of
+// coinbaseSpec paying the subsidy and their fees, and the header commits to
+// their merkle root; its nonce is left for the miners.
+func BuildBlockTemplate(candidates []*TxWithFee, maxSize int, sigCheckLimit int, coinbaseSpec CoinbaseSpec,
+	prevHash chainhash.Hash, bits uint32, now time.Time) (*wire.MsgBlock, *TemplateStats, error) {
+
+	// The fees, unknown yet, do not change the size of the coinbase.
+	coinbase, err := NewCoinbaseTx(coinbaseSpec, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats := &TemplateStats{Subsidy: CalcBlockSubsidy(coinbaseSpec.Height, coinbaseSpec.Params), MaxSize: maxSize,
+		SigCheckLimit: sigCheckLimit}
+	// The transaction count is budgeted at its largest encoding.
+	stats.Size = wire.MaxBlockHeaderPayload + wire.MaxVarIntPayload + coinbase.SerializeSize()
+	if stats.Size > maxSize {
+		return nil, nil, fmt.Errorf("coinbase does not fit a block of %d bytes", maxSize)
+	}
+
+	selected, sel, err := SelectForBlock(candidates, nil, maxSize-stats.Size, sigCheckLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats.Fees, stats.Skipped = sel.Fees, sel.Skipped
+	stats.Size += sel.Size
+	stats.SigChecks = sel.SigChecks
+
+	if coinbase, err = NewCoinbaseTx(coinbaseSpec, stats.Fees); err != nil {
+		return nil, nil, err
+	}
+	txs := append([]*btcutil.Tx{btcutil.NewTx(coinbase)}, selected...)
+	SortTxsCTOR(txs)
+	stats.Transactions = len(txs) - 1
+	stats.Size += wire.VarIntSerializeSize(uint64(len(txs))) - wire.MaxVarIntPayload
+
+	block := &wire.MsgBlock{Header: wire.BlockHeader{
+		Version:    blockTemplateVersion,
+		PrevBlock:  prevHash,
+		MerkleRoot: CalcMerkleRoot(txs),
+		Timestamp:  time.Unix(now.Unix(), 0),
+		Bits:       bits,
+	}}
+	for _, tx := range txs {
+		block.Transactions = append(block.Transactions, tx.MsgTx())
+	}
+	return block, stats, nil
+}
+
+// SelectionStats describes the transactions selected for a block.
+type SelectionStats struct {
+	// Fees are the fees of the transactions, Size their size and SigChecks
+	// their signature checks.
+	Fees      btcutil.Amount
+	Size      int
+	SigChecks int
+
+	// Transactions is the number of transactions selected, and Skipped the
+	// number of candidates left out.
+	Transactions int
+	Skipped      int
+
+	// MarginalFeeRate is the fee rate of the last package selected, at the
+	// cutoff of the block, and ExcludedFeeRate the highest fee rate of the
+	// packages left out for lack of room, zero if all fit.
+	MarginalFeeRate FeeRate
+	ExcludedFeeRate FeeRate
+}
+
+// SelectForBlock selects the candidates of a block of at most maxSize bytes
+// of transactions and maxSigChecks signature checks.  Candidates are selected
+// with their ancestors, the other candidates they spend the outputs of, by
+// decreasing fee rate of these packages so that children pay for their
+// parents.  Packages that do not fit are left out, and their candidates with
+// them unless they fit in another package, the selection going on with
+// smaller packages until none fits.  The transactions are in the order of
+// their selection, parents before children, to be sorted in the canonical
+// order of blocks.
+//
+// The parents of the candidates are those of deps, the dependency graph of
+// the candidates and the unconfirmed transactions they spend, and candidates
+// whose parents in deps are not candidates are left out.  When deps is nil,
+// the candidates spending other outputs than those of candidates are assumed
+// to spend confirmed outputs.  Coinbases, nil and duplicate candidates are
+// left out.
+func SelectForBlock(candidates []*TxWithFee, deps *DependencyGraph, maxSize, maxSigChecks int) ([]*btcutil.Tx,
+	*SelectionStats, error) {
+
+	stats := &SelectionStats{}
+	valid := make([]*TxWithFee, 0, len(candidates))
+	index := make(map[chainhash.Hash]int, len(candidates))
+	for _, c := range candidates {
+		if c == nil || c.Tx == nil || IsCoinBaseTx(c.Tx.MsgTx()) {
+			stats.Skipped++
+			continue
+		}
+		if _, ok := index[*c.Tx.Hash()]; ok {
+			stats.Skipped++
+			continue
+		}
+		if err := CheckAmount(c.Fee); err != nil {
+			return nil, nil, fmt.Errorf("transaction %v: fee: %w", c.Tx.Hash(), err)
+		}
+		index[*c.Tx.Hash()] = len(valid)
+		valid = append(valid, c)
+	}
+	sel := newTemplateSelection(valid, index, deps)
+
+	var txs []*btcutil.Tx
+	for {
+		best, pkg := sel.bestPackage()
+		if best < 0 {
+			break
+		}
+		var fee btcutil.Amount
+		size, sigChecks := 0, 0
+		for _, i := range pkg {
+			fee += valid[i].Fee
+			size += sel.sizes[i]
+			sigChecks += valid[i].SigChecks
+		}
+		rate := TxFeeRate(fee, size)
+		if stats.Size+size > maxSize || stats.SigChecks+sigChecks > maxSigChecks {
+			// Its ancestors may still fit without it.
+			sel.excluded[best] = true
+			if rate > stats.ExcludedFeeRate {
+				stats.ExcludedFeeRate = rate
+			}
+			continue
+		}
+		for _, i := range pkg {
+			var err error
+			if stats.Fees, err = AddChecked(stats.Fees, valid[i].Fee); err != nil {
+				return nil, nil, err
+			}
+			sel.selected[i] = true
+			txs = append(txs, valid[i].Tx)
+		}
+		stats.Size += size
+		stats.SigChecks += sigChecks
+		stats.MarginalFeeRate = rate
+	}
+	stats.Transactions = len(txs)
+	stats.Skipped += len(valid) - len(txs)
+	return txs, stats, nil
+}
+
+// templateSelection selects the candidates of a block template by package,
+// each with the ancestors it spends the outputs of.
+type templateSelection struct {
+	candidates []*TxWithFee
+	sizes      []int
+
+	// parents are the indexes of the candidates spent by each candidate.
+	// selected and excluded are set for the candidates selected and left
+	// out.
+	parents  [][]int
+	selected []bool
+	excluded []bool
+}
+
+// newTemplateSelection returns the selection of candidates, of txids index,
+// whose parents are those of deps, or those spent among candidates if nil.
+// Candidates with parents in deps that are not candidates are left out.
+func newTemplateSelection(candidates []*TxWithFee, index map[chainhash.Hash]int,
+	deps *DependencyGraph) *templateSelection {
+
+	sel := &templateSelection{candidates: candidates, sizes: make([]int, len(candidates)),
+		parents: make([][]int, len(candidates)), selected: make([]bool, len(candidates)),
+		excluded: make([]bool, len(candidates))}
+	for i, c := range candidates {
+		sel.sizes[i] = c.Tx.MsgTx().SerializeSize()
+		if deps != nil {
+			for _, parent := range deps.Parents(c.Tx.Hash()) {
+				p, ok := index[parent]
+				if !ok {
+					sel.excluded[i] = true
+					continue
+				}
+				sel.parents[i] = append(sel.parents[i], p)
+			}
+			continue
+		}
+		seen := make(map[int]bool)
+		for _, txIn := range c.Tx.MsgTx().TxIn {
+			if p, ok := index[txIn.PreviousOutPoint.Hash]; ok && !seen[p] {
+				seen[p] = true
+				sel.parents[i] = append(sel.parents[i], p)
+			}
+		}
+	}
+	return sel
+}
+
+// bestPackage returns the candidate left whose package has the highest fee
+// rate, the first of equal ones, and its package: it and its ancestors not
+// selected yet, parents first.  It returns -1 when no candidate is left.
+func (sel *templateSelection) bestPackage() (int, []int) {
+	best, bestRate := -1, 0.0
+	var bestPkg []int
+	for i := range sel.candidates {
+		if sel.selected[i] || sel.excluded[i] {
+			continue
+		}
+		pkg, ok := sel.pkg(i, make(map[int]bool), nil)
+		if !ok {
+			continue
+		}
+		fee, size := 0.0, 0
+		for _, j := range pkg {
+			fee += float64(sel.candidates[j].Fee)
+			size += sel.sizes[j]
+		}
+		if rate := fee / float64(size); best < 0 || rate > bestRate {
+			best, bestRate, bestPkg = i, rate, pkg
+		}
+	}
+	return best, bestPkg
+}
+
+// pkg appends to pkg the ancestors of candidate i not selected yet, parents
+// first, and i.  Candidates needing an ancestor left out have no package.
+func (sel *templateSelection) pkg(i int, visited map[int]bool, pkg []int) ([]int, bool) {
+	if visited[i] {
+		return pkg, true
+	}
+	visited[i] = true
+	for _, p := range sel.parents[i] {
+		if sel.excluded[p] {
+			return nil, false
+		}
+		if !sel.selected[p] {
+			var ok bool
+			if pkg, ok = sel.pkg(p, visited, pkg); !ok {
+				return nil, false
+			}
+		}
+	}
+	return append(pkg, i), true
+}
@@ -0,0 +1,176 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestNewCoinbaseTx(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	tx, err := NewCoinbaseTx(CoinbaseSpec{Height: 840000, PkScript: pkScript, ExtraData: []byte("pool")}, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsCoinBaseTx(tx) || tx.TxOut[0].Value != 312501234 {
+		t.Errorf("got coinbase %v paying %d", tx.TxIn[0].PreviousOutPoint, tx.TxOut[0].Value)
+	}
+	want, _ := txscript.NewScriptBuilder().AddInt64(840000).AddData([]byte("pool")).Script()
+	if string(tx.TxIn[0].SignatureScript) != string(want) {
+		t.Errorf("got scriptSig %x, want %x", tx.TxIn[0].SignatureScript, want)
+	}
+
+	// Regtest halves the subsidy every 150 blocks.
+	spec := CoinbaseSpec{Height: 300, PkScript: pkScript, Params: &chaincfg.RegressionNetParams}
+	if tx, err := NewCoinbaseTx(spec, 0); err != nil || tx.TxOut[0].Value != 1250000000 {
+		t.Errorf("regtest coinbase: got %v, %v", tx, err)
+	}
+
+	// Coinbases paying short scripts are padded to the minimum size.
+	tx, err = NewCoinbaseTx(CoinbaseSpec{Height: 1, PkScript: []byte{txscript.OP_TRUE}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := tx.SerializeSize(); size < MinTxSize {
+		t.Errorf("got coinbase of %d bytes", size)
+	}
+	// Low heights push a single opcode, followed by OP_0.
+	tx, err = NewCoinbaseTx(CoinbaseSpec{Height: 1, PkScript: pkScript}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tx.TxIn[0].SignatureScript; string(got) != string([]byte{txscript.OP_1, txscript.OP_0}) {
+		t.Errorf("got scriptSig %x at height 1", got)
+	}
+	if _, err := NewCoinbaseTx(CoinbaseSpec{Height: 1, PkScript: pkScript, ExtraData: make([]byte, 99)}, 0); err == nil {
+		t.Error("oversized coinbase scriptSig accepted")
+	}
+}
+
+func TestBuildBlockTemplate(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	newTx := func(parent chainhash.Hash) *btcutil.Tx {
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&parent, 0), make([]byte, 100), nil))
+		tx.AddTxOut(wire.NewTxOut(10000, pkScript))
+		return btcutil.NewTx(tx)
+	}
+	parent := newTx(chainhash.Hash{1})
+	child := newTx(*parent.Hash())
+	orphan := newTx(chainhash.Hash{2})
+	rich := newTx(chainhash.Hash{3})
+	costly := newTx(chainhash.Hash{4})
+	txSize := parent.MsgTx().SerializeSize()
+	candidates := []*TxWithFee{
+		// The child pays the most, but follows its parent.
+		{Tx: child, Fee: 5000, SigChecks: 1},
+		{Tx: parent, Fee: 200, SigChecks: 1},
+		{Tx: orphan, Fee: 300, SigChecks: 1},
+		{Tx: rich, Fee: 3000, SigChecks: 1},
+		{Tx: costly, Fee: 2000, SigChecks: 10},
+		{Tx: rich, Fee: 3000, SigChecks: 1},
+	}
+	spec := CoinbaseSpec{Height: 840000, PkScript: pkScript}
+	coinbase, _ := NewCoinbaseTx(spec, 0)
+	// Room for all but one transaction.
+	maxSize := 80 + 1 + coinbase.SerializeSize() + 3*txSize + 8
+	now := time.Unix(1700000000, 999)
+
+	block, stats, err := BuildBlockTemplate(candidates, maxSize, 5, spec, chainhash.Hash{9}, 0x1d00ffff, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs := make([]*btcutil.Tx, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txs[i] = btcutil.NewTx(tx)
+	}
+	if err := CheckBlockTxs(txs, block.Header.MerkleRoot); err != nil {
+		t.Error(err)
+	}
+	included := make(map[chainhash.Hash]bool)
+	for _, tx := range txs[1:] {
+		included[*tx.Hash()] = true
+	}
+	// The costly transaction exceeds the signature checks, the orphan
+	// the size once the others are selected.
+	if len(included) != 3 || !included[*rich.Hash()] || !included[*parent.Hash()] || !included[*child.Hash()] {
+		t.Errorf("got %d transactions", len(included))
+	}
+	if stats.Fees != 8200 || stats.Transactions != 3 || stats.Skipped != 3 || stats.SigChecks != 3 {
+		t.Errorf("got stats %+v", stats)
+	}
+	if stats.Size != block.SerializeSize() || stats.Size > maxSize {
+		t.Errorf("got size %d, block of %d bytes", stats.Size, block.SerializeSize())
+	}
+	if want := int64(CalcBlockSubsidy(840000, nil) + 8200); block.Transactions[0].TxOut[0].Value != want {
+		t.Errorf("coinbase pays %d, want %d", block.Transactions[0].TxOut[0].Value, want)
+	}
+	header := block.Header
+	if header.PrevBlock != (chainhash.Hash{9}) || header.Bits != 0x1d00ffff || header.Timestamp.Unix() != now.Unix() {
+		t.Errorf("got header %+v", header)
+	}
+
+	if _, _, err := BuildBlockTemplate(nil, 100, 5, spec, chainhash.Hash{}, 0x1d00ffff, now); err == nil {
+		t.Error("block too small for the coinbase accepted")
+	}
+	candidates[0].Fee = -1
+	if _, _, err := BuildBlockTemplate(candidates, maxSize, 5, spec, chainhash.Hash{}, 0, now); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("got %v, want ErrInvalidAmount", err)
+	}
+}
+
+func TestSelectForBlock(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	newTx := func(parent chainhash.Hash) *btcutil.Tx {
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&parent, 0), make([]byte, 100), nil))
+		tx.AddTxOut(wire.NewTxOut(10000, pkScript))
+		return btcutil.NewTx(tx)
+	}
+	parent := newTx(chainhash.Hash{1})
+	child := newTx(*parent.Hash())
+	cheap := newTx(chainhash.Hash{2})
+	mid := newTx(chainhash.Hash{3})
+	txSize := parent.MsgTx().SerializeSize()
+	candidates := []*TxWithFee{
+		{Tx: child, Fee: 5000, SigChecks: 1},
+		{Tx: cheap, Fee: 100, SigChecks: 1},
+		{Tx: parent, Fee: 200, SigChecks: 1},
+		{Tx: mid, Fee: 1000, SigChecks: 1},
+	}
+
+	txs, stats, err := SelectForBlock(candidates, nil, 3*txSize, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The child pulls in its parent, ahead of the others.
+	if len(txs) != 3 || txs[0] != parent || txs[1] != child || txs[2] != mid {
+		t.Fatalf("got %v", txs)
+	}
+	if stats.Fees != 6200 || stats.Size != 3*txSize || stats.SigChecks != 3 || stats.Transactions != 3 ||
+		stats.Skipped != 1 {
+		t.Errorf("got stats %+v", stats)
+	}
+	if stats.MarginalFeeRate != TxFeeRate(1000, txSize) || stats.ExcludedFeeRate != TxFeeRate(100, txSize) {
+		t.Errorf("got fee rates %d and %d", stats.MarginalFeeRate, stats.ExcludedFeeRate)
+	}
+
+	// The parent of the graph, unconfirmed, is not a candidate.
+	deps, err := NewDependencyGraph([]*wire.MsgTx{parent.MsgTx(), child.MsgTx(), mid.MsgTx()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, stats, err = SelectForBlock([]*TxWithFee{candidates[0], candidates[3]}, deps, 10*txSize, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 1 || txs[0] != mid || stats.Skipped != 1 || stats.ExcludedFeeRate != 0 {
+		t.Errorf("got %v, stats %+v", txs, stats)
+	}
+}
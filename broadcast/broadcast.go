@@ -0,0 +1,164 @@
+// Package broadcast sends transactions to the network and maps the reasons
+// nodes reject them to typed errors.
+//
+// Nodes report the rejection of a transaction by sendrawtransaction with an
+// RPC error code and a message starting with the reject reason of the
+// mempool, such as "txn-mempool-conflict (code 18)".  MapRejectReason turns
+// them into a *RejectError wrapping one of the errors of this package, so
+// that callers retry or inform their users with errors.Is instead of matching
+// substrings.
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Broadcaster sends transactions to the network.
+type Broadcaster interface {
+	// Broadcast sends tx and returns its txid.  Transactions rejected by
+	// the node fail with a *RejectError.
+	Broadcast(ctx context.Context, tx *wire.MsgTx) (chainhash.Hash, error)
+}
+
+// BroadcastSigned sends the transaction of tx with b as it was when signed.
+// Transactions modified since they were signed, whose signatures no longer
+// hold, are not sent and fail with the error of Verify, wrapping
+// bchutil.ErrSignedTxMutated and naming the field differing.
+func BroadcastSigned(ctx context.Context, b Broadcaster, tx *bchutil.SignedTx) (chainhash.Hash, error) {
+	if err := tx.Verify(); err != nil {
+		return chainhash.Hash{}, err
+	}
+	return b.Broadcast(ctx, tx.MsgTx())
+}
+
+// RPC error codes of sendrawtransaction.
+const (
+	rpcDeserializationError = -22
+	rpcVerifyError          = -25
+	rpcVerifyRejected       = -26
+	rpcVerifyAlreadyInChain = -27
+)
+
+var (
+	// ErrRejected describes an error where a node rejected a transaction
+	// for a reason that has no error of its own.
+	ErrRejected = errors.New("transaction rejected")
+
+	// ErrMempoolConflict describes an error where a transaction spends an
+	// output already spent by a transaction of the mempool.
+	ErrMempoolConflict = errors.New("transaction conflicts with the mempool")
+
+	// ErrInsufficientFee describes an error where the fee of a transaction
+	// is below the relay fee or the minimum fee of a full mempool.
+	ErrInsufficientFee = errors.New("insufficient fee")
+
+	// ErrMissingInputs describes an error where a transaction spends
+	// outputs that are unknown or already spent by a block.
+	ErrMissingInputs = errors.New("missing or spent inputs")
+
+	// ErrMempoolChainTooLong describes an error where a transaction has
+	// more unconfirmed ancestors or descendants than the mempool accepts.
+	ErrMempoolChainTooLong = errors.New("too long unconfirmed chain")
+
+	// ErrAlreadyKnown describes an error where a transaction is already in
+	// the mempool or the chain.
+	ErrAlreadyKnown = errors.New("transaction already known")
+
+	// ErrNonStandard describes an error where a transaction is not
+	// standard, and nodes do not relay it although it is valid.
+	ErrNonStandard = errors.New("non-standard transaction")
+
+	// ErrInvalidTx describes an error where a transaction is invalid, or
+	// could not be decoded.
+	ErrInvalidTx = errors.New("invalid transaction")
+)
+
+// rejectReasons maps the prefixes of the reject messages of nodes to their
+// errors, the first matching prefix winning.
+var rejectReasons = []struct {
+	prefix string
+	err    error
+}{
+	{"txn-mempool-conflict", ErrMempoolConflict},
+	{"min relay fee not met", ErrInsufficientFee},
+	{"mempool min fee not met", ErrInsufficientFee},
+	{"insufficient priority", ErrInsufficientFee},
+	{"bad-txns-inputs-missingorspent", ErrMissingInputs},
+	{"missing inputs", ErrMissingInputs},
+	{"missing-inputs", ErrMissingInputs},
+	{"too-long-mempool-chain", ErrMempoolChainTooLong},
+	{"txn-already-known", ErrAlreadyKnown},
+	{"txn-already-in-mempool", ErrAlreadyKnown},
+	{"transaction already in block chain", ErrAlreadyKnown},
+	{"txn-already-confirmed", ErrAlreadyKnown},
+	{"scriptpubkey", ErrNonStandard},
+	{"scriptsig-size", ErrNonStandard},
+	{"scriptsig-not-pushonly", ErrNonStandard},
+	{"dust", ErrNonStandard},
+	{"tx-size", ErrNonStandard},
+	{"version", ErrNonStandard},
+	{"multi-op-return", ErrNonStandard},
+	{"oversize-op-return", ErrNonStandard},
+	{"non-final", ErrNonStandard},
+	{"non-bip68-final", ErrNonStandard},
+	{"non-mandatory-script-verify-flag", ErrNonStandard},
+	{"mandatory-script-verify-flag-failed", ErrInvalidTx},
+	{"bad-txns", ErrInvalidTx},
+	{"tx decode failed", ErrInvalidTx},
+}
+
+// RejectError is the rejection of a transaction by a node.
+type RejectError struct {
+	// Code is the RPC error code, and Message the reject message.
+	Code    int
+	Message string
+
+	// Err is the error of the reject reason, ErrRejected for unknown
+	// reasons.
+	Err error
+}
+
+// Error returns the reject message and code.
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("%v: %s (rpc code %d)", e.Err, e.Message, e.Code)
+}
+
+// Unwrap returns the error of the reject reason.
+func (e *RejectError) Unwrap() error {
+	return e.Err
+}
+
+// MapRejectReason returns the *RejectError of the rejection of a
+// transaction by sendrawtransaction with the RPC error code and message.
+// Reasons are matched on the start of message, case insensitively, and
+// unknown ones with code: decoding errors are ErrInvalidTx, transactions
+// already in the chain ErrAlreadyKnown, and other rejections ErrRejected.
+func MapRejectReason(code int, message string) *RejectError {
+	e := &RejectError{Code: code, Message: message, Err: ErrRejected}
+	reason := strings.ToLower(strings.TrimSpace(message))
+	for _, r := range rejectReasons {
+		if strings.HasPrefix(reason, r.prefix) {
+			e.Err = r.err
+			return e
+		}
+	}
+	switch code {
+	case rpcDeserializationError:
+		e.Err = ErrInvalidTx
+	case rpcVerifyAlreadyInChain:
+		e.Err = ErrAlreadyKnown
+	case rpcVerifyError:
+		// Older nodes report missing inputs with this code alone.
+		if strings.Contains(reason, "input") {
+			e.Err = ErrMissingInputs
+		}
+	}
+	return e
+}
@@ -0,0 +1,39 @@
+package broadcast
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMapRejectReason(t *testing.T) {
+	tests := []struct {
+		code    int
+		message string
+		err     error
+	}{
+		{-26, "txn-mempool-conflict (code 18)", ErrMempoolConflict},
+		{-26, "min relay fee not met, 100 < 219 (code 66)", ErrInsufficientFee},
+		{-26, "mempool min fee not met, 100 < 500 (code 66)", ErrInsufficientFee},
+		{-25, "bad-txns-inputs-missingorspent", ErrMissingInputs},
+		{-25, "Missing inputs", ErrMissingInputs},
+		{-26, "too-long-mempool-chain, too many unconfirmed ancestors [limit: 50] (code 64)", ErrMempoolChainTooLong},
+		{-27, "Transaction already in block chain", ErrAlreadyKnown},
+		{-26, "txn-already-known", ErrAlreadyKnown},
+		{-26, "dust (code 64)", ErrNonStandard},
+		{-26, "mandatory-script-verify-flag-failed (Signature must be zero for failed CHECK(MULTI)SIG operation)",
+			ErrInvalidTx},
+		{-22, "TX decode failed", ErrInvalidTx},
+		{-27, "already have it", ErrAlreadyKnown},
+		{-26, "something new (code 99)", ErrRejected},
+	}
+	for _, test := range tests {
+		err := MapRejectReason(test.code, test.message)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q: got %v, want %v", test.message, err, test.err)
+		}
+		var rejectErr *RejectError
+		if !errors.As(error(err), &rejectErr) || rejectErr.Code != test.code || rejectErr.Message != test.message {
+			t.Errorf("%q: got %#v", test.message, err)
+		}
+	}
+}
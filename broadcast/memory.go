@@ -0,0 +1,74 @@
+package broadcast
+
+import (
+	"context"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MemoryBroadcaster is a Broadcaster keeping the transactions broadcast in
+// memory, as a mempool would, for tests.  Transactions already broadcast
+// fail with ErrAlreadyKnown and those spending an output spent by another
+// with ErrMempoolConflict, in the *RejectError a node would return.  It is
+// safe for concurrent use.
+type MemoryBroadcaster struct {
+	// Reject, when set, is called before each transaction is accepted, and
+	// the transaction is rejected with the error it returns, such as one of
+	// MapRejectReason.
+	Reject func(tx *wire.MsgTx) error
+
+	mu    sync.Mutex
+	txs   []*wire.MsgTx
+	known map[chainhash.Hash]bool
+	spent map[wire.OutPoint]chainhash.Hash
+}
+
+// Broadcast accepts tx unless ctx is done, Reject rejects it, or it is known
+// or conflicts with a transaction accepted before.
+func (b *MemoryBroadcaster) Broadcast(ctx context.Context, tx *wire.MsgTx) (chainhash.Hash, error) {
+	if err := ctx.Err(); err != nil {
+		return chainhash.Hash{}, err
+	}
+	if b.Reject != nil {
+		if err := b.Reject(tx); err != nil {
+			return chainhash.Hash{}, err
+		}
+	}
+	txid := tx.TxHash()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.known[txid] {
+		return chainhash.Hash{}, MapRejectReason(rpcVerifyAlreadyInChain, "txn-already-known")
+	}
+	for _, txIn := range tx.TxIn {
+		if _, ok := b.spent[txIn.PreviousOutPoint]; ok {
+			return chainhash.Hash{}, MapRejectReason(rpcVerifyRejected, "txn-mempool-conflict (code 18)")
+		}
+	}
+	if b.known == nil {
+		b.known = make(map[chainhash.Hash]bool)
+		b.spent = make(map[wire.OutPoint]chainhash.Hash)
+	}
+	b.known[txid] = true
+	for _, txIn := range tx.TxIn {
+		b.spent[txIn.PreviousOutPoint] = txid
+	}
+	b.txs = append(b.txs, tx.Copy())
+	return txid, nil
+}
+
+// Transactions returns the transactions accepted, in their order.
+func (b *MemoryBroadcaster) Transactions() []*wire.MsgTx {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*wire.MsgTx(nil), b.txs...)
+}
+
+// Has returns whether the transaction txid was accepted.
+func (b *MemoryBroadcaster) Has(txid *chainhash.Hash) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.known[*txid]
+}
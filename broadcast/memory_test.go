@@ -0,0 +1,75 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testTx returns a transaction spending the output index of the transaction
+// hash.
+func testTx(hash chainhash.Hash, index uint32, value int64) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, index), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(value, []byte{0x51}))
+	return tx
+}
+
+func TestMemoryBroadcaster(t *testing.T) {
+	var _ Broadcaster = (*MemoryBroadcaster)(nil)
+	ctx := context.Background()
+	b := &MemoryBroadcaster{}
+	tx := testTx(chainhash.Hash{1}, 0, 1000)
+	txid, err := b.Broadcast(ctx, tx)
+	if err != nil || txid != tx.TxHash() || !b.Has(&txid) {
+		t.Fatalf("got %v, %v", txid, err)
+	}
+	if _, err := b.Broadcast(ctx, tx); !errors.Is(err, ErrAlreadyKnown) {
+		t.Errorf("got %v, want ErrAlreadyKnown", err)
+	}
+	if _, err := b.Broadcast(ctx, testTx(chainhash.Hash{1}, 0, 900)); !errors.Is(err, ErrMempoolConflict) {
+		t.Errorf("got %v, want ErrMempoolConflict", err)
+	}
+	if txs := b.Transactions(); len(txs) != 1 || txs[0].TxHash() != txid {
+		t.Errorf("got %d transactions", len(txs))
+	}
+
+	b.Reject = func(tx *wire.MsgTx) error {
+		return MapRejectReason(-26, "min relay fee not met, 0 < 191 (code 66)")
+	}
+	if _, err := b.Broadcast(ctx, testTx(chainhash.Hash{2}, 0, 1000)); !errors.Is(err, ErrInsufficientFee) {
+		t.Errorf("got %v, want ErrInsufficientFee", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := b.Broadcast(canceled, testTx(chainhash.Hash{3}, 0, 1000)); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestBroadcastSigned(t *testing.T) {
+	ctx := context.Background()
+	b := &MemoryBroadcaster{}
+	tx := testTx(chainhash.Hash{1}, 0, 1000)
+	signed := bchutil.NewSignedTx(tx)
+	tx.TxOut[0].Value = 900
+	if _, err := BroadcastSigned(ctx, b, signed); !errors.Is(err, bchutil.ErrSignedTxMutated) ||
+		!strings.Contains(err.Error(), "value of output 0") {
+		t.Errorf("got %v, want ErrSignedTxMutated", err)
+	}
+	if len(b.Transactions()) != 0 {
+		t.Fatal("mutated transaction broadcast")
+	}
+
+	tx.TxOut[0].Value = 1000
+	txid, err := BroadcastSigned(ctx, b, signed)
+	if err != nil || txid != signed.TxID() {
+		t.Fatalf("got %v, %v", txid, err)
+	}
+}
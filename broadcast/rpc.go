@@ -0,0 +1,118 @@
+package broadcast
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// maxResponseSize bounds the size of the responses read from a node.
+const maxResponseSize = 1 << 20
+
+// RPCBroadcaster broadcasts transactions with the sendrawtransaction call of
+// the JSON-RPC interface of a node, such as Bitcoin Cash Node.
+type RPCBroadcaster struct {
+	// URL is the address of the RPC server, such as
+	// http://127.0.0.1:8332, and User and Password its credentials.
+	URL      string
+	User     string
+	Password string
+
+	// HTTPClient is used to perform the requests.  http.DefaultClient is
+	// used when nil.
+	HTTPClient *http.Client
+
+	id uint64
+}
+
+func (b *RPCBroadcaster) httpClient() *http.Client {
+	if b.HTTPClient != nil {
+		return b.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// rpcRequest is a JSON-RPC request.
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+// rpcResponse is a JSON-RPC response.
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Broadcast sends tx with sendrawtransaction.  Rejections fail with the
+// *RejectError of MapRejectReason, and the other failures of the node with
+// errors carrying its message.
+func (b *RPCBroadcaster) Broadcast(ctx context.Context, tx *wire.MsgTx) (chainhash.Hash, error) {
+	body, err := json.Marshal(rpcRequest{
+		JSONRPC: "1.0",
+		ID:      atomic.AddUint64(&b.id, 1),
+		Method:  "sendrawtransaction",
+		Params:  []interface{}{bchutil.EncodeTxHex(tx)},
+	})
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", b.URL, bytes.NewReader(body))
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if b.User != "" || b.Password != "" {
+		httpReq.SetBasicAuth(b.User, b.Password)
+	}
+
+	resp, err := b.httpClient().Do(httpReq)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+
+	// Nodes report RPC errors with a JSON body, of status 500.
+	var rpcResp rpcResponse
+	if err := json.Unmarshal(respBody, &rpcResp); err != nil {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return chainhash.Hash{}, fmt.Errorf("node returned %s: %s", resp.Status,
+				strings.TrimSpace(string(respBody)))
+		}
+		return chainhash.Hash{}, fmt.Errorf("decoding sendrawtransaction response: %w", err)
+	}
+	if rpcResp.Error != nil {
+		return chainhash.Hash{}, MapRejectReason(rpcResp.Error.Code, rpcResp.Error.Message)
+	}
+	var txid string
+	if err := json.Unmarshal(rpcResp.Result, &txid); err != nil {
+		return chainhash.Hash{}, fmt.Errorf("decoding sendrawtransaction result: %w", err)
+	}
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return chainhash.Hash{}, fmt.Errorf("decoding sendrawtransaction result: %w", err)
+	}
+	if *hash != tx.TxHash() {
+		return chainhash.Hash{}, fmt.Errorf("node returned txid %v, want %v", hash, tx.TxHash())
+	}
+	return *hash, nil
+}
@@ -0,0 +1,66 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+func TestRPCBroadcaster(t *testing.T) {
+	var _ Broadcaster = (*RPCBroadcaster)(nil)
+	tx := testTx(chainhash.Hash{1}, 0, 1000)
+	reply := func(w http.ResponseWriter, req rpcRequest) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": tx.TxHash().String(), "error": nil,
+			"id": req.ID})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "pass" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		if req.Method != "sendrawtransaction" || len(req.Params) != 1 || req.Params[0] != bchutil.EncodeTxHex(tx) {
+			t.Errorf("got request %+v", req)
+		}
+		reply(w, req)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	b := &RPCBroadcaster{URL: server.URL, User: "user", Password: "pass"}
+	if txid, err := b.Broadcast(ctx, tx); err != nil || txid != tx.TxHash() {
+		t.Fatalf("got %v, %v", txid, err)
+	}
+
+	reply = func(w http.ResponseWriter, req rpcRequest) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": nil, "id": req.ID,
+			"error": map[string]interface{}{"code": -26, "message": "txn-mempool-conflict (code 18)"}})
+	}
+	_, err := b.Broadcast(ctx, tx)
+	var rejectErr *RejectError
+	if !errors.Is(err, ErrMempoolConflict) || !errors.As(err, &rejectErr) || rejectErr.Code != -26 {
+		t.Errorf("got %v, want ErrMempoolConflict", err)
+	}
+
+	reply = func(w http.ResponseWriter, req rpcRequest) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": chainhash.Hash{}.String(), "id": req.ID})
+	}
+	if _, err := b.Broadcast(ctx, tx); err == nil {
+		t.Error("wrong txid accepted")
+	}
+
+	b.Password = "wrong"
+	if _, err := b.Broadcast(ctx, tx); err == nil || errors.Is(err, ErrRejected) {
+		t.Errorf("got %v for an unauthorized request", err)
+	}
+}
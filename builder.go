@@ -0,0 +1,360 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// errTxLimits is returned by txFunder.fund when a transaction exceeds its
+// size, input or output limits.
+var errTxLimits = errors.New("transaction limits exceeded")
+
+// UnsignedTx is a transaction ready to be signed, with a summary of its
+// contents.
+type UnsignedTx struct {
+	Tx *wire.MsgTx
+
+	// PrevOuts holds the outputs spent by the inputs of Tx.
+	PrevOuts map[int]*wire.TxOut
+
+	Fee btcutil.Amount
+
+	// Size is the estimated size of the signed transaction.
+	Size int
+
+	// Recipients are the indexes of the payments made by the outputs of
+	// Tx, in order, the change output aside.
+	Recipients []int
+
+	// ChangeIndex is the index of the change output, or -1 when the change
+	// was below the dust threshold and left to the fee.
+	ChangeIndex int
+
+	// TokenChange are the indexes of the outputs returning the tokens of
+	// the inputs not sent.
+	TokenChange []int
+
+	// DenominatedChange are the indexes of the change outputs split by
+	// SetDenominatedChange, in which case ChangeIndex is -1.
+	DenominatedChange []int
+
+	// Parent is the transaction whose change is spent by the first input,
+	// if any.
+	Parent *UnsignedTx
+
+	// Params is the network set by TxBuilder.SetNetwork, nil if none, for
+	// which the transaction must be signed unless allowNetworkMismatch.
+	// Without it, the transaction must be signed for the network of
+	// firstAddr, the first address given to the builder, if any.
+	Params               *chaincfg.Params
+	firstAddr            NetworkAware
+	allowNetworkMismatch bool
+}
+
+// LinkParent makes the first input spend the change of Parent as it is now.
+// Signing a transaction changes its hash, so transactions spending the change
+// of their parent must be signed in order, calling LinkParent after the parent
+// is signed.
+func (u *UnsignedTx) LinkParent() {
+	if u.Parent == nil {
+		return
+	}
+	u.Tx.TxIn[0].PreviousOutPoint.Hash = u.Parent.Tx.TxHash()
+}
+
+// Sign signs all inputs of the transaction with SIGHASH_ALL using
+// SignTxOutput, after checking its tokens with ValidateTokenTransition.  The
+// inputs spending token outputs sign their token prefix.
+// Transactions of a builder with a network, set or that of the addresses
+// paid, fail with ErrNetworkMismatch when signed for another one, and so do
+// key databases of NewWIFKeyDB holding keys of another network.
+func (u *UnsignedTx) Sign(chainParams *chaincfg.Params, kdb txscript.KeyDB, sdb txscript.ScriptDB) error {
+	if err := u.checkNetwork(chainParams, kdb); err != nil {
+		return err
+	}
+	if err := u.ValidateTokenTransition(); err != nil {
+		return err
+	}
+	for i := range u.Tx.TxIn {
+		prevOut, ok := u.PrevOuts[i]
+		if !ok {
+			return fmt.Errorf("no previous output for input %d", i)
+		}
+		token, pkScript, err := SplitTokenPrefix(prevOut.PkScript)
+		if err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+		scriptSig, err := SignTxOutput(chainParams, u.Tx, i, pkScript,
+			txscript.SigHashAll|SigHashForkID, kdb, sdb, nil, prevOut.Value, WithTokenPrevout(token))
+		if err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+		u.Tx.TxIn[i].SignatureScript = scriptSig
+	}
+	return nil
+}
+
+// SignAll signs txs in order with UnsignedTx.Sign, linking each one to its
+// parent, if any, once the parent is signed.
+func SignAll(txs []*UnsignedTx, chainParams *chaincfg.Params, kdb txscript.KeyDB, sdb txscript.ScriptDB) error {
+	for i, u := range txs {
+		u.LinkParent()
+		if err := u.Sign(chainParams, kdb, sdb); err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// selectionPool returns the outputs of utxos that can fund transactions, those
+// without tokens that policy spends, largest first.
+func selectionPool(utxos []UTXO, policy SpendPolicy) []UTXO {
+	var pool []UTXO
+	for _, u := range utxos {
+		if !u.HasTokens() && policy.IsSpendable(u) {
+			pool = append(pool, u)
+		}
+	}
+	sort.SliceStable(pool, func(i, j int) bool { return pool[i].Amount > pool[j].Amount })
+	return pool
+}
+
+// txFunder adds the inputs and change of transactions.
+type txFunder struct {
+	feeRate      FeeRate
+	changeScript []byte
+
+	// maxTxSize is MaxStandardTxSize when not positive, and maxInputs
+	// and maxOutputs are not checked when not positive.
+	maxTxSize  int
+	maxInputs  int
+	maxOutputs int
+}
+
+// fund adds outputs of pool, in order, to the inputs of u until they pay its
+// outputs and fee, then adds change unless it is dust.  It returns the number
+// of outputs taken from pool.
+func (f *txFunder) fund(u *UnsignedTx, pool []UTXO) (int, error) {
+	maxTxSize := f.maxTxSize
+	if maxTxSize <= 0 {
+		maxTxSize = MaxStandardTxSize
+	}
+	tx := u.Tx
+	if f.maxOutputs > 0 && len(tx.TxOut) > f.maxOutputs {
+		return 0, errTxLimits
+	}
+	in, out, err := txValues(tx, u.PrevOuts)
+	if err != nil {
+		return 0, err
+	}
+
+	change, err := NewTxOut(0, f.changeScript)
+	if err != nil {
+		return 0, fmt.Errorf("change script: %w", err)
+	}
+	for used := 0; ; used++ {
+		if in >= out {
+			size, err := f.size(tx, u.PrevOuts, change)
+			if err != nil {
+				return 0, err
+			}
+			fee := f.feeRate.Fee(size)
+			change.Value = int64(in - out - fee)
+			if !IsDust(change) {
+				// Change is never given up to the fee.
+				if size > maxTxSize || (f.maxOutputs > 0 && len(tx.TxOut) == f.maxOutputs) {
+					return 0, errTxLimits
+				}
+				tx.AddTxOut(change)
+				u.ChangeIndex = len(tx.TxOut) - 1
+				u.Fee, u.Size = fee, size
+				return used, nil
+			}
+
+			size, err = f.size(tx, u.PrevOuts, nil)
+			if err != nil {
+				return 0, err
+			}
+			if size > maxTxSize {
+				return 0, errTxLimits
+			}
+			if in-out >= f.feeRate.Fee(size) {
+				u.Fee, u.Size = in-out, size
+				return used, nil
+			}
+		}
+
+		if used == len(pool) {
+			return 0, ErrInsufficientFunds
+		}
+		if f.maxInputs > 0 && len(tx.TxIn) == f.maxInputs {
+			return 0, errTxLimits
+		}
+		utxo := pool[used]
+		if _, err := AddInputFromUTXO(u, utxo); err != nil {
+			return 0, err
+		}
+		if in, err = AddChecked(in, utxo.Amount); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// size returns the estimated size of tx once signed, with change appended to
+// its outputs if not nil.
+func (f *txFunder) size(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut, change *wire.TxOut) (int, error) {
+	size, err := EstimateSignedSize(tx, prevOuts)
+	if err != nil || change == nil {
+		return size, err
+	}
+	size += change.SerializeSize()
+	if n := len(tx.TxOut); wire.VarIntSerializeSize(uint64(n+1)) != wire.VarIntSerializeSize(uint64(n)) {
+		size += 2
+	}
+	return size, nil
+}
+
+// TxBuilder builds transactions paying a set of outputs, funded by the
+// largest of the available outputs and sending the change to a change script.
+type TxBuilder struct {
+	txFunder
+	utxos   []UTXO
+	outputs []*wire.TxOut
+
+	// antiFeeSniping is set by SetAntiFeeSniping, minLockTime by
+	// SetMinLockTime and chainTip by SetChainTip.
+	antiFeeSniping bool
+	currentHeight  int32
+	minLockTime    uint32
+	chainTip       *chainTip
+	randInt        func(n int) (int, error)
+
+	// shuffleOutputs, shuffleInputs and pinnedOutputs are set by
+	// SetShuffle.
+	shuffleOutputs bool
+	shuffleInputs  bool
+	pinnedOutputs  map[int]bool
+
+	// validatePolicy is set by SetValidatePolicy.
+	validatePolicy bool
+
+	// spendPolicy is set by SetSpendPolicy.
+	spendPolicy SpendPolicy
+
+	// tokenInputs are added by AddTokenInputs, tokenChangeScript is set by
+	// SetTokenChange and allowTokenBurn by AllowTokenBurn.
+	tokenInputs       []UTXO
+	tokenChangeScript []byte
+	allowTokenBurn    map[chainhash.Hash]bool
+
+	// denominated is set by SetDenominatedChange.
+	denominated *denominatedChange
+
+	// params is set by SetNetwork and allowNetworkMismatch by
+	// AllowNetworkMismatch.  Without params, firstAddr is the first
+	// address given to AddPayment or SetChangeAddress.
+	params               *chaincfg.Params
+	firstAddr            NetworkAware
+	allowNetworkMismatch bool
+}
+
+// NewTxBuilder returns a TxBuilder paying feeRate and sending the change to
+// changeScript.
+func NewTxBuilder(feeRate FeeRate, changeScript []byte) *TxBuilder {
+	return &TxBuilder{txFunder: txFunder{feeRate: feeRate, changeScript: changeScript}}
+}
+
+// AddUTXOs makes utxos available to fund the transaction.  Outputs carrying
+// tokens and those the spend policy excludes, immature coinbase outputs by
+// default, are never spent.
+func (b *TxBuilder) AddUTXOs(utxos ...UTXO) {
+	b.utxos = append(b.utxos, utxos...)
+}
+
+// SetSpendPolicy replaces the zero SpendPolicy selecting the outputs of
+// AddUTXOs funding the transaction.  Without a TipHeight, the height set by
+// SetChainTip is used.
+func (b *TxBuilder) SetSpendPolicy(policy SpendPolicy) {
+	b.spendPolicy = policy
+}
+
+// fundingPolicy returns the spend policy of the funding outputs.
+func (b *TxBuilder) fundingPolicy() SpendPolicy {
+	policy := b.spendPolicy
+	if policy.TipHeight <= 0 && b.chainTip != nil {
+		policy.TipHeight = b.chainTip.height
+	}
+	return policy
+}
+
+// AddOutput adds txOut to the outputs paid by the transaction.
+func (b *TxBuilder) AddOutput(txOut *wire.TxOut) {
+	b.outputs = append(b.outputs, txOut)
+}
+
+// Build returns the transaction paying the outputs, followed by the token
+// change and the change if it is not dust, unless the outputs are shuffled.  Outputs below the dust
+// threshold are rejected with an error wrapping ErrDustOutput, and
+// ErrInsufficientFunds is returned when the available outputs can't cover the
+// outputs and fee.
+func (b *TxBuilder) Build() (*UnsignedTx, error) {
+	if len(b.outputs) == 0 {
+		return nil, errors.New("no output to pay")
+	}
+	if len(b.changeScript) == 0 {
+		return nil, errors.New("no change script")
+	}
+	u := NewUnsignedTx()
+	u.Params, u.firstAddr, u.allowNetworkMismatch = b.params, b.firstAddr, b.allowNetworkMismatch
+	for i, txOut := range b.outputs {
+		// Dust is reported with the other violations when the policy
+		// is validated.
+		if IsDust(txOut) && !b.validatePolicy {
+			return nil, fmt.Errorf("%w: output %d pays %v", ErrDustOutput, i, btcutil.Amount(txOut.Value))
+		}
+		out, err := NewTxOut(btcutil.Amount(txOut.Value), txOut.PkScript)
+		if err != nil {
+			return nil, fmt.Errorf("output %d: %w", i, err)
+		}
+		u.Tx.AddTxOut(out)
+		u.Recipients = append(u.Recipients, i)
+	}
+	if err := b.addTokenInputs(u); err != nil {
+		return nil, err
+	}
+	if _, err := b.fund(u, b.fundingPool()); err != nil {
+		if errors.Is(err, errTxLimits) {
+			return nil, errors.New("transaction exceeds the standard size")
+		}
+		return nil, err
+	}
+	if err := b.denominate(u); err != nil {
+		return nil, err
+	}
+	if err := b.shuffle(u); err != nil {
+		return nil, err
+	}
+	if err := b.setLockTime(u.Tx); err != nil {
+		return nil, err
+	}
+	utxos, err := prevOutUTXOs(u.Tx, u.PrevOuts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTokenBurns(utxos, u.Tx.TxOut, b.allowTokenBurn); err != nil {
+		return nil, err
+	}
+	if b.validatePolicy {
+		if err := u.ValidatePolicy(); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
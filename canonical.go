@@ -0,0 +1,99 @@
+package bchutil
+
+import (
+	"encoding/binary"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// minimalPush returns the smallest encoding of the push of data, as required
+// by the MINIMALDATA policy.
+func minimalPush(data []byte) []byte {
+	n := len(data)
+	switch {
+	case n == 0:
+		return []byte{txscript.OP_0}
+	case n == 1 && data[0] >= 1 && data[0] <= 16:
+		return []byte{txscript.OP_1 + data[0] - 1}
+	case n == 1 && data[0] == 0x81:
+		return []byte{txscript.OP_1NEGATE}
+	case n <= 75:
+		return append([]byte{byte(n)}, data...)
+	case n <= 0xff:
+		return append([]byte{txscript.OP_PUSHDATA1, byte(n)}, data...)
+	case n <= 0xffff:
+		return append([]byte{txscript.OP_PUSHDATA2, byte(n), byte(n >> 8)}, data...)
+	}
+	push := []byte{txscript.OP_PUSHDATA4, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(push[1:], uint32(n))
+	return append(push, data...)
+}
+
+// canonicalize re-encodes every push of ops minimally.
+func canonicalize(ops []parsedOpcode) ([]byte, bool) {
+	var script []byte
+	changed := false
+	for i := range ops {
+		if ops[i].isMinimalPush() {
+			script = append(script, ops[i].raw...)
+			continue
+		}
+		script = append(script, minimalPush(ops[i].data)...)
+		changed = true
+	}
+	return script, changed
+}
+
+// CanonicalizeScript re-encodes every data push of the locking script or
+// redeem script script with its smallest encoding, such as data pushes of
+// 1 to 16 with OP_1 to OP_16, so that spending it does not fail the
+// MINIMALDATA policy.  It returns the script and whether it changed.  The
+// data pushed is never changed, even when it is a number with a non-minimal
+// encoding, as the script may not use it as a number.  Truncated pushes fail
+// with an error wrapping ErrMalformedPush.
+//
+// Canonicalizing a redeem script changes its hash, so it must be done before
+// paying to it, never on the redeem script of outputs already paid to.  Use
+// CanonicalizeScriptSig for unlocking scripts.
+func CanonicalizeScript(script []byte) ([]byte, bool, error) {
+	ops, err := parseScript(script)
+	if err != nil {
+		return nil, false, err
+	}
+	canonical, changed := canonicalize(ops)
+	return canonical, changed, nil
+}
+
+// CanonicalizeScriptSig re-encodes the pushes of the unlocking script
+// scriptSig minimally, like CanonicalizeScript, and returns it and whether it
+// changed.  Only the push opcodes change: the signatures and redeem script
+// pushed, which other parties may have committed to, are unchanged byte for
+// byte, and the redeem script is not canonicalized.  scriptSigs that are not
+// push only fail with an error wrapping ErrNotPushOnly.
+func CanonicalizeScriptSig(scriptSig []byte) ([]byte, bool, error) {
+	ops, err := parseScript(scriptSig)
+	if err != nil {
+		return nil, false, err
+	}
+	if !isPushOnly(ops) {
+		return nil, false, ErrNotPushOnly
+	}
+	canonical, changed := canonicalize(ops)
+	return canonical, changed, nil
+}
+
+// IsMinimalPushScript returns whether every push of script uses its smallest
+// encoding, as CanonicalizeScript would leave it unchanged.  Truncated
+// scripts are not.
+func IsMinimalPushScript(script []byte) bool {
+	ops, err := parseScript(script)
+	if err != nil {
+		return false
+	}
+	for i := range ops {
+		if !ops[i].isMinimalPush() {
+			return false
+		}
+	}
+	return true
+}
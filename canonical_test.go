@@ -0,0 +1,73 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestCanonicalizeScript(t *testing.T) {
+	five := []byte{1, 2, 3, 4, 5}
+	for i, test := range []struct {
+		script, want []byte
+	}{
+		{[]byte{txscript.OP_DUP, txscript.OP_5, txscript.OP_ADD}, nil},
+		{append([]byte{txscript.OP_PUSHDATA1, 5}, five...), append([]byte{5}, five...)},
+		{append([]byte{txscript.OP_PUSHDATA4, 5, 0, 0, 0}, five...), append([]byte{5}, five...)},
+		{[]byte{txscript.OP_DATA_1, 5, txscript.OP_ADD}, []byte{txscript.OP_5, txscript.OP_ADD}},
+		{[]byte{txscript.OP_DATA_1, 0x81}, []byte{txscript.OP_1NEGATE}},
+		{[]byte{txscript.OP_PUSHDATA1, 0, txscript.OP_EQUAL}, []byte{txscript.OP_0, txscript.OP_EQUAL}},
+		// The data of pushes is unchanged, numbers included.
+		{[]byte{txscript.OP_PUSHDATA1, 2, 5, 0}, []byte{txscript.OP_DATA_2, 5, 0}},
+		{append([]byte{txscript.OP_PUSHDATA2, 76, 0}, make([]byte, 76)...),
+			append([]byte{txscript.OP_PUSHDATA1, 76}, make([]byte, 76)...)},
+	} {
+		got, changed, err := CanonicalizeScript(test.script)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		want := test.want
+		if want == nil {
+			want = test.script
+		}
+		if !bytes.Equal(got, want) || changed != (test.want != nil) {
+			t.Errorf("test %d: got %x, %v, want %x", i, got, changed, want)
+		}
+		if IsMinimalPushScript(test.script) != (test.want == nil) || !IsMinimalPushScript(got) {
+			t.Errorf("test %d: IsMinimalPushScript mismatch", i)
+		}
+	}
+
+	for _, script := range [][]byte{{txscript.OP_PUSHDATA1}, {txscript.OP_DATA_5, 1, 2}} {
+		if _, _, err := CanonicalizeScript(script); !errors.Is(err, ErrMalformedPush) {
+			t.Errorf("%x: got %v, want ErrMalformedPush", script, err)
+		}
+		if IsMinimalPushScript(script) {
+			t.Errorf("%x: truncated script is minimal", script)
+		}
+	}
+}
+
+func TestCanonicalizeScriptSig(t *testing.T) {
+	// The push of the redeem script changes, not the redeem script itself.
+	redeemScript := []byte{txscript.OP_PUSHDATA1, 1, 7, txscript.OP_EQUAL}
+	scriptSig := []byte{txscript.OP_PUSHDATA1, 1, 7, txscript.OP_PUSHDATA1, byte(len(redeemScript))}
+	scriptSig = append(scriptSig, redeemScript...)
+	got, changed, err := CanonicalizeScriptSig(scriptSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte{txscript.OP_7, byte(len(redeemScript))}, redeemScript...)
+	if !changed || !bytes.Equal(got, want) {
+		t.Errorf("got %x, %v, want %x", got, changed, want)
+	}
+	if redeem, _ := ExtractRedeemScript(got); !bytes.Equal(redeem, redeemScript) {
+		t.Errorf("redeem script changed to %x", redeem)
+	}
+
+	if _, _, err := CanonicalizeScriptSig([]byte{txscript.OP_1, txscript.OP_DUP}); !errors.Is(err, ErrNotPushOnly) {
+		t.Errorf("got %v, want ErrNotPushOnly", err)
+	}
+}
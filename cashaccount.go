@@ -0,0 +1,223 @@
+package bchutil
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// cashAccountProtocolID is the first push of Cash Account registrations.
+var cashAccountProtocolID = []byte{0x01, 0x01, 0x01, 0x01}
+
+const (
+	// cashAccountActivationHeight is the first block of Cash Account
+	// registrations, whose accounts are numbered from 100.
+	cashAccountActivationHeight = 563720
+
+	// cashAccountHeightOffset is subtracted from the heights of the
+	// registrations to number their accounts.
+	cashAccountHeightOffset = 563620
+
+	// maxCashAccountNameLen is the longest name of an account.
+	maxCashAccountNameLen = 99
+
+	// cashAccountCollisionLen is the length of the collision identifiers.
+	cashAccountCollisionLen = 10
+)
+
+// ErrInvalidCashAccount describes an error where a Cash Account registration
+// is not valid.
+var ErrInvalidCashAccount = errors.New("invalid Cash Account registration")
+
+// CashAccountPaymentType is the type of the payment data of a Cash Account.
+type CashAccountPaymentType byte
+
+// Payment types, with their token aware variants for SLP wallets.
+const (
+	CashAccountKeyHash          CashAccountPaymentType = 0x01
+	CashAccountScriptHash       CashAccountPaymentType = 0x02
+	CashAccountPaymentCode      CashAccountPaymentType = 0x03
+	CashAccountStealthKeys      CashAccountPaymentType = 0x04
+	CashAccountTokenKeyHash     CashAccountPaymentType = 0x81
+	CashAccountTokenScriptHash  CashAccountPaymentType = 0x82
+	CashAccountTokenPaymentCode CashAccountPaymentType = 0x83
+	CashAccountTokenStealthKeys CashAccountPaymentType = 0x84
+)
+
+// cashAccountPayloadSizes are the sizes of the payloads of the payment types,
+// those of the token variants included.
+var cashAccountPayloadSizes = map[CashAccountPaymentType]int{
+	CashAccountKeyHash:     20,
+	CashAccountScriptHash:  20,
+	CashAccountPaymentCode: PaymentCodeLen,
+	CashAccountStealthKeys: 66,
+}
+
+// payloadSize returns the size of the payloads of t, and whether t is known.
+func (t CashAccountPaymentType) payloadSize() (int, bool) {
+	size, ok := cashAccountPayloadSizes[t&^0x80]
+	return size, ok
+}
+
+// PaymentData is a payment method of a Cash Account: the hash of the
+// pay-to-pubkey-hash or pay-to-script-hash address, the BIP 47 payment code
+// or the stealth keys of its owner.
+type PaymentData struct {
+	Type    CashAccountPaymentType
+	Payload []byte
+}
+
+// CashAccountRegistration is the registration of a Cash Account.
+type CashAccountRegistration struct {
+	Name     string
+	Payments []PaymentData
+}
+
+// checkCashAccountName returns an error if name is not 1 to 99 ASCII letters,
+// digits and underscores.
+func checkCashAccountName(name string) error {
+	if len(name) == 0 || len(name) > maxCashAccountNameLen {
+		return fmt.Errorf("%w: name of %d characters, want 1 to %d", ErrInvalidCashAccount, len(name),
+			maxCashAccountNameLen)
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_') {
+			return fmt.Errorf("%w: character %q in name", ErrInvalidCashAccount, c)
+		}
+	}
+	return nil
+}
+
+// check returns an error if the payload of p does not have the size
+// of its type.
+func (p *PaymentData) check() error {
+	size, ok := p.Type.payloadSize()
+	if !ok {
+		return fmt.Errorf("%w: unknown payment type %#02x", ErrInvalidCashAccount, byte(p.Type))
+	}
+	if len(p.Payload) != size {
+		return fmt.Errorf("%w: payment type %#02x with %d byte payload, want %d", ErrInvalidCashAccount,
+			byte(p.Type), len(p.Payload), size)
+	}
+	return nil
+}
+
+// BuildCashAccountRegistration returns the OP_RETURN output registering the
+// Cash Account name paid with payments: the protocol identifier, the name
+// and a push of each payment type followed by its payload.  Names are 1 to
+// 99 ASCII letters, digits and underscores, at least one payment is
+// required, and the script must not exceed MaxDataCarrierSize.
+func BuildCashAccountRegistration(name string, payments []PaymentData) (*wire.TxOut, error) {
+	if err := checkCashAccountName(name); err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 {
+		return nil, fmt.Errorf("%w: no payment data", ErrInvalidCashAccount)
+	}
+	builder := NewScriptBuilder().AddOp(txscript.OP_RETURN).AddData(cashAccountProtocolID)
+	builder.AddData([]byte(name))
+	for i := range payments {
+		if err := payments[i].check(); err != nil {
+			return nil, err
+		}
+		builder.AddData(append([]byte{byte(payments[i].Type)}, payments[i].Payload...))
+	}
+	pkScript, err := builder.Script()
+	if err != nil {
+		return nil, err
+	}
+	if len(pkScript) > MaxDataCarrierSize {
+		return nil, fmt.Errorf("%w: registration script of %d bytes", ErrDataCarrierSize, len(pkScript))
+	}
+	return wire.NewTxOut(0, pkScript), nil
+}
+
+// ParseCashAccountRegistration parses the script of a registration output
+// built by BuildCashAccountRegistration.  Other scripts, and registrations
+// with an invalid name or payment, fail with ErrInvalidCashAccount.
+func ParseCashAccountRegistration(pkScript []byte) (*CashAccountRegistration, error) {
+	if len(pkScript) == 0 || pkScript[0] != txscript.OP_RETURN {
+		return nil, fmt.Errorf("%w: no OP_RETURN", ErrInvalidCashAccount)
+	}
+	ops, err := parseScript(pkScript[1:])
+	if err != nil || !isPushOnly(ops) {
+		return nil, fmt.Errorf("%w: not push only", ErrInvalidCashAccount)
+	}
+	if len(ops) == 0 || string(ops[0].data) != string(cashAccountProtocolID) {
+		return nil, fmt.Errorf("%w: no protocol identifier", ErrInvalidCashAccount)
+	}
+	if len(ops) < 3 {
+		return nil, fmt.Errorf("%w: no name or payment data", ErrInvalidCashAccount)
+	}
+	r := &CashAccountRegistration{Name: string(ops[1].data)}
+	if err := checkCashAccountName(r.Name); err != nil {
+		return nil, err
+	}
+	for _, op := range ops[2:] {
+		if len(op.data) == 0 {
+			return nil, fmt.Errorf("%w: empty payment data", ErrInvalidCashAccount)
+		}
+		p := PaymentData{Type: CashAccountPaymentType(op.data[0]), Payload: append([]byte(nil), op.data[1:]...)}
+		if err := p.check(); err != nil {
+			return nil, err
+		}
+		r.Payments = append(r.Payments, p)
+	}
+	return r, nil
+}
+
+// AccountNumberFromHeight returns the number of the accounts registered in
+// the block of height, from 100 for the first block of the protocol.
+func AccountNumberFromHeight(height int32) (int32, error) {
+	if height < cashAccountActivationHeight {
+		return 0, fmt.Errorf("%w: block %d before activation at %d", ErrInvalidCashAccount, height,
+			cashAccountActivationHeight)
+	}
+	return height - cashAccountHeightOffset, nil
+}
+
+// CashAccountCollisionHash returns the collision identifier of the account
+// registered by transaction txHash in block blockHash: the first four bytes
+// of the SHA-256 of both hashes, in their displayed byte order, as a decimal
+// number whose digits are reversed and padded with zeros to 10 digits.
+func CashAccountCollisionHash(blockHash, txHash *chainhash.Hash) string {
+	var data []byte
+	for _, h := range []*chainhash.Hash{blockHash, txHash} {
+		for i := chainhash.HashSize - 1; i >= 0; i-- {
+			data = append(data, h[i])
+		}
+	}
+	sum := sha256.Sum256(data)
+	digits := []byte(strconv.FormatUint(uint64(binary.BigEndian.Uint32(sum[:4])), 10))
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits) + strings.Repeat("0", cashAccountCollisionLen-len(digits))
+}
+
+// CashAccountIdentifier returns the identifier of the account name with
+// number and collision identifier collision, "Name#123.45", whose collision
+// part is the shortest prefix of collision that is not a prefix of others,
+// the collision identifiers of the other accounts with the same name and
+// number.  It is omitted when others is empty.
+func CashAccountIdentifier(name string, number int32, collision string, others []string) string {
+	id := fmt.Sprintf("%s#%d", name, number)
+	if len(others) == 0 {
+		return id
+	}
+	n := 1
+	for _, other := range others {
+		for n < len(collision) && strings.HasPrefix(other, collision[:n]) {
+			n++
+		}
+	}
+	return id + "." + collision[:n]
+}
@@ -0,0 +1,113 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+func TestCashAccountRegistration(t *testing.T) {
+	keyHash := PaymentData{Type: CashAccountKeyHash, Payload: bytes.Repeat([]byte{0x11}, 20)}
+	tokenHash := PaymentData{Type: CashAccountTokenScriptHash, Payload: bytes.Repeat([]byte{0x22}, 20)}
+	txOut, err := BuildCashAccountRegistration("Jonathan", []PaymentData{keyHash, tokenHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "6a040101010108" + hex.EncodeToString([]byte("Jonathan")) + "1501" + hex.EncodeToString(keyHash.Payload) +
+		"1582" + hex.EncodeToString(tokenHash.Payload)
+	if got := hex.EncodeToString(txOut.PkScript); got != want || txOut.Value != 0 {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	r, err := ParseCashAccountRegistration(txOut.PkScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, &CashAccountRegistration{Name: "Jonathan", Payments: []PaymentData{keyHash,
+		tokenHash}}) {
+		t.Errorf("got %+v", r)
+	}
+
+	for _, test := range []struct {
+		name     string
+		payments []PaymentData
+	}{
+		{"", []PaymentData{keyHash}},
+		{string(bytes.Repeat([]byte{'a'}, 100)), []PaymentData{keyHash}},
+		{"Jöhn", []PaymentData{keyHash}},
+		{"john doe", []PaymentData{keyHash}},
+		{"john", nil},
+		{"john", []PaymentData{{Type: CashAccountKeyHash, Payload: make([]byte, 19)}}},
+		{"john", []PaymentData{{Type: 0x05, Payload: make([]byte, 20)}}},
+		{"john", []PaymentData{{Type: CashAccountPaymentCode, Payload: make([]byte, PaymentCodeLen)},
+			{Type: CashAccountTokenPaymentCode, Payload: make([]byte, PaymentCodeLen)},
+			{Type: CashAccountStealthKeys, Payload: make([]byte, 66)}}},
+	} {
+		_, err := BuildCashAccountRegistration(test.name, test.payments)
+		if !errors.Is(err, ErrInvalidCashAccount) && !errors.Is(err, ErrDataCarrierSize) {
+			t.Errorf("%q %v: got %v", test.name, test.payments, err)
+		}
+	}
+
+	for _, script := range []string{
+		"",
+		"6a04534c5000",
+		"6a0401010101046a6f686e",
+		"6a0401010101046a6f686e00",
+		"6a0401010101046a6f686e020111",
+		"6a0401010101046a6f686e1505" + hex.EncodeToString(make([]byte, 20)),
+		"6a04010101010120" + "1501" + hex.EncodeToString(make([]byte, 20)),
+	} {
+		pkScript, _ := hex.DecodeString(script)
+		if _, err := ParseCashAccountRegistration(pkScript); !errors.Is(err, ErrInvalidCashAccount) {
+			t.Errorf("%s: got %v, want ErrInvalidCashAccount", script, err)
+		}
+	}
+}
+
+func TestAccountNumberFromHeight(t *testing.T) {
+	if n, err := AccountNumberFromHeight(563720); err != nil || n != 100 {
+		t.Errorf("got %d, %v", n, err)
+	}
+	if n, err := AccountNumberFromHeight(600000); err != nil || n != 36380 {
+		t.Errorf("got %d, %v", n, err)
+	}
+	if _, err := AccountNumberFromHeight(563719); !errors.Is(err, ErrInvalidCashAccount) {
+		t.Errorf("got %v, want ErrInvalidCashAccount", err)
+	}
+}
+
+func TestCashAccountCollision(t *testing.T) {
+	blockHash, _ := chainhash.NewHashFromStr("000000000000000002abbeff5f6fb22a0b3b5c2685c6ef4ed2d2257ed54e9dcb")
+	txHash, _ := chainhash.NewHashFromStr("590d1fdf7e00a3d3a8d7b2b5ef4e1e6b7599798d5bcef643e786bf8b4f7e483c")
+
+	// The hashes are concatenated as displayed.
+	data, _ := hex.DecodeString(blockHash.String() + txHash.String())
+	sum := sha256.Sum256(data)
+	digits := strconv.FormatUint(uint64(binary.BigEndian.Uint32(sum[:4])), 10)
+	collision := CashAccountCollisionHash(blockHash, txHash)
+	if len(collision) != 10 || collision[0] != digits[len(digits)-1] ||
+		collision[len(digits)-1] != digits[0] {
+		t.Fatalf("collision %s for %s", collision, digits)
+	}
+
+	for _, test := range []struct {
+		others []string
+		want   string
+	}{
+		{nil, "Jonathan#100"},
+		{[]string{"9999999999"}, "Jonathan#100.1"},
+		{[]string{"1299999999", "1399999999"}, "Jonathan#100.123"},
+		{[]string{"1234599999"}, "Jonathan#100.123456"},
+	} {
+		if got := CashAccountIdentifier("Jonathan", 100, "1234567890", test.others); got != test.want {
+			t.Errorf("%v: got %s, want %s", test.others, got, test.want)
+		}
+	}
+}
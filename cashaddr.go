@@ -1,9 +1,14 @@
 package bchutil
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcutil"
 	"golang.org/x/crypto/ripemd160"
@@ -32,6 +37,9 @@ var (
 	ErrInvalidFormat = errors.New("invalid format: version and/or checksum bytes missing")
 
 	Prefixes map[string]string
+
+	// prefixNets are the parameters of the networks of Prefixes, by name.
+	prefixNets = map[string]*chaincfg.Params{}
 )
 
 type AddressType int
@@ -46,6 +54,29 @@ func init() {
 	Prefixes[chaincfg.MainNetParams.Name] = "bitcoincash"
 	Prefixes[chaincfg.TestNet3Params.Name] = "bchtest"
 	Prefixes[chaincfg.RegressionNetParams.Name] = "bchreg"
+	Prefixes[ECashMainNetParams.Name] = "ecash"
+	Prefixes[ECashTestNetParams.Name] = "ectest"
+	for _, net := range []*chaincfg.Params{&chaincfg.MainNetParams, &chaincfg.TestNet3Params,
+		&chaincfg.RegressionNetParams, &ECashMainNetParams, &ECashTestNetParams} {
+		prefixNets[net.Name] = net
+	}
+}
+
+// RegisterPrefix sets the CashAddr prefix of the addresses of net, a network
+// of another chain than the ones of Prefixes.  Prefixes are made of lowercase
+// letters, as CashAddr does not allow digits in them.
+func RegisterPrefix(net *chaincfg.Params, prefix string) error {
+	if prefix == "" {
+		return errors.New("empty CashAddr prefix")
+	}
+	for i := 0; i < len(prefix); i++ {
+		if c := prefix[i]; c < 'a' || c > 'z' {
+			return fmt.Errorf("invalid character %q in CashAddr prefix", c)
+		}
+	}
+	Prefixes[net.Name] = prefix
+	prefixNets[net.Name] = net
+	return nil
 }
 
 type data []byte
@@ -114,7 +145,22 @@ func PolyMod(v data) uint64 {
 	 * corresponds to x^2 + v0*x + v1 mod g(x). As 1 mod g(x) = 1, that is the
 	 * starting value for `c`.
 	 */
-	c := uint64(1)
+	c := polyModUpdate(1, v)
+
+	/**
+	 * PolyMod computes what value to xor into the final values to make the
+	 * checksum 0. However, if we required that the checksum was 0, it would be
+	 * the case that appending a 0 to a valid list of values would result in a
+	 * new valid list. For that reason, cashaddr requires the resulting checksum
+	 * to be 1 instead.
+	 */
+	return c ^ 1
+}
+
+// polyModUpdate returns the state c of the PolyMod computation updated with the
+// values v, which lets the state of a prefix be computed once for many
+// addresses.
+func polyModUpdate(c uint64, v data) uint64 {
 	for _, d := range v {
 		/**
 		 * We want to update `c` to correspond to a polynomial with one extra
@@ -176,15 +222,7 @@ func PolyMod(v data) uint64 {
 			c ^= 0x1e4f43e470
 		}
 	}
-
-	/**
-	 * PolyMod computes what value to xor into the final values to make the
-	 * checksum 0. However, if we required that the checksum was 0, it would be
-	 * the case that appending a 0 to a valid list of values would result in a
-	 * new valid list. For that reason, cashaddr requires the resulting checksum
-	 * to be 1 instead.
-	 */
-	return c ^ 1
+	return c
 }
 
 /**
@@ -344,20 +382,32 @@ func CheckDecodeCashAddress(input string) (result []byte, prefix string, t Addre
 	if err != nil {
 		return data, prefix, P2PKH, err
 	}
-	data, err = convertBits(data, 5, 8, false)
+	result, t, err = unpackAddressData(data)
+	return result, prefix, t, err
+}
+
+// unpackAddressData returns the hash and type of the 5 bits values of a
+// CashAddr payload, without checksum.
+func unpackAddressData(values data) ([]byte, AddressType, error) {
+	data, err := convertBits(values, 5, 8, false)
 	if err != nil {
-		return data, prefix, P2PKH, err
+		return data, P2PKH, err
+	}
+	if len(data) == 33 && data[0] == 0x0b {
+		// Pay-to-script-hash with a 32 bytes hash.
+		return data[1:], P2SH, nil
 	}
 	if len(data) != 21 {
-		return data, prefix, P2PKH, errors.New("Incorrect data length")
+		return data, P2PKH, errors.New("Incorrect data length")
 	}
+	var t AddressType
 	switch data[0] {
 	case 0x00:
 		t = P2PKH
 	case 0x08:
 		t = P2SH
 	}
-	return data[1:21], prefix, t, nil
+	return data[1:21], t, nil
 }
 
 // encodeAddress returns a human-readable payment address given a ripemd160 hash
@@ -378,9 +428,16 @@ func DecodeAddress(addr string, defaultNet *chaincfg.Params) (btcutil.Address, e
 		return nil, errors.New("unknown network parameters")
 	}
 
-	// Add prefix if it does not exist
-	if len(addr) >= len(pre)+1 && addr[:len(pre)+1] != pre+":" {
+	// Add prefix if it does not exist, and reject the prefixes of other
+	// networks.
+	if i := strings.IndexByte(addr, ':'); i < 0 {
+		if addr == strings.ToUpper(addr) {
+			pre = strings.ToUpper(pre)
+		}
 		addr = pre + ":" + addr
+	} else if !strings.EqualFold(addr[:i], pre) {
+		return nil, fmt.Errorf("address prefix %q is not the prefix %q of network %s", addr[:i], pre,
+			defaultNet.Name)
 	}
 
 	// Switch on decoded length to determine the type.
@@ -391,6 +448,12 @@ func DecodeAddress(addr string, defaultNet *chaincfg.Params) (btcutil.Address, e
 		}
 		return nil, errors.New("decoded address is of unknown format")
 	}
+	return cashAddressFromData(decoded, typ, defaultNet)
+}
+
+// cashAddressFromData returns the CashAddr address of net with the hash and
+// type of a decoded payload.
+func cashAddressFromData(decoded []byte, typ AddressType, defaultNet *chaincfg.Params) (btcutil.Address, error) {
 	switch len(decoded) {
 	case ripemd160.Size: // P2PKH or P2SH
 		switch typ {
@@ -402,6 +465,9 @@ func DecodeAddress(addr string, defaultNet *chaincfg.Params) (btcutil.Address, e
 			return nil, ErrUnknownAddressType
 		}
 
+	case sha256.Size:
+		return newCashAddressScriptHash32FromHash(decoded, defaultNet)
+
 	default:
 		return nil, errors.New("decoded address is of unknown size")
 	}
@@ -553,6 +619,126 @@ func (a *CashAddressScriptHash) Hash160() *[ripemd160.Size]byte {
 	return &a.hash
 }
 
+// CashAddressScriptHash32 is an Address for a pay-to-script-hash output with
+// the 32 bytes hash of the May 2023 upgrade.
+type CashAddressScriptHash32 struct {
+	hash   [sha256.Size]byte
+	prefix string
+}
+
+// NewCashAddressScriptHash32 returns the CashAddressScriptHash32 of
+// serializedScript, hashed with double SHA-256.
+func NewCashAddressScriptHash32(serializedScript []byte, net *chaincfg.Params) (*CashAddressScriptHash32, error) {
+	return newCashAddressScriptHash32FromHash(chainhash.DoubleHashB(serializedScript), net)
+}
+
+// NewCashAddressScriptHash32FromHash returns a new CashAddressScriptHash32.
+// scriptHash must be 32 bytes.
+func NewCashAddressScriptHash32FromHash(scriptHash []byte, net *chaincfg.Params) (*CashAddressScriptHash32, error) {
+	return newCashAddressScriptHash32FromHash(scriptHash, net)
+}
+
+func newCashAddressScriptHash32FromHash(scriptHash []byte, net *chaincfg.Params) (*CashAddressScriptHash32, error) {
+	if len(scriptHash) != sha256.Size {
+		return nil, errors.New("scriptHash must be 32 bytes")
+	}
+	pre, ok := Prefixes[net.Name]
+	if !ok {
+		return nil, errors.New("unknown network parameters")
+	}
+	addr := &CashAddressScriptHash32{prefix: pre}
+	copy(addr.hash[:], scriptHash)
+	return addr, nil
+}
+
+// EncodeAddress returns the string encoding of the address.  Part of the
+// Address interface.
+func (a *CashAddressScriptHash32) EncodeAddress() string {
+	return CheckEncodeCashAddress(a.hash[:], a.prefix, P2SH)
+}
+
+// ScriptAddress returns the script hash.  Part of the Address interface.
+func (a *CashAddressScriptHash32) ScriptAddress() []byte {
+	return a.hash[:]
+}
+
+// IsForNet returns whether or not the address is associated with the passed
+// bitcoin cash network.
+func (a *CashAddressScriptHash32) IsForNet(net *chaincfg.Params) bool {
+	pre, ok := Prefixes[net.Name]
+	if !ok {
+		return false
+	}
+	return pre == a.prefix
+}
+
+// String returns the string encoding of the address.
+func (a *CashAddressScriptHash32) String() string {
+	return a.EncodeAddress()
+}
+
+// CashAddressPubKey is an Address for a pay-to-pubkey output.  It has no
+// CashAddr encoding of its own: it is encoded as the pay-to-pubkey-hash
+// address of its key, like btcutil.AddressPubKey is, while scripts pay to the
+// key itself.
+type CashAddressPubKey struct {
+	pubKey []byte
+	prefix string
+}
+
+// NewCashAddressPubKey returns a new CashAddressPubKey.  serializedPubKey must
+// be a compressed or uncompressed public key on the curve.
+func NewCashAddressPubKey(serializedPubKey []byte, net *chaincfg.Params) (*CashAddressPubKey, error) {
+	if !isPubKeyPush(serializedPubKey) {
+		return nil, errors.New("invalid serialized public key")
+	}
+	prefix, ok := Prefixes[net.Name]
+	if !ok {
+		return nil, errors.New("unknown network parameters")
+	}
+	return &CashAddressPubKey{pubKey: append([]byte(nil), serializedPubKey...), prefix: prefix}, nil
+}
+
+// EncodeAddress returns the string encoding of the pay-to-pubkey-hash address
+// of the public key.  Part of the Address interface.
+func (a *CashAddressPubKey) EncodeAddress() string {
+	return encodeCashAddress(btcutil.Hash160(a.pubKey), a.prefix, P2PKH)
+}
+
+// ScriptAddress returns the serialized public key, which is included in
+// pay-to-pubkey scripts.  Part of the Address interface.
+func (a *CashAddressPubKey) ScriptAddress() []byte {
+	return a.pubKey
+}
+
+// IsForNet returns whether or not the address is associated with the passed
+// bitcoin cash network.
+func (a *CashAddressPubKey) IsForNet(net *chaincfg.Params) bool {
+	pre, ok := Prefixes[net.Name]
+	if !ok {
+		return false
+	}
+	return pre == a.prefix
+}
+
+// String returns the string encoding of the address.
+func (a *CashAddressPubKey) String() string {
+	return a.EncodeAddress()
+}
+
+// PubKey returns the public key of the address.
+func (a *CashAddressPubKey) PubKey() *btcec.PublicKey {
+	pubKey, _ := btcec.ParsePubKey(a.pubKey, btcec.S256())
+	return pubKey
+}
+
+// AddressPubKeyHash returns the pay-to-pubkey-hash address of the public key.
+func (a *CashAddressPubKey) AddressPubKeyHash() *CashAddressPubKeyHash {
+	addr := &CashAddressPubKeyHash{prefix: a.prefix}
+	copy(addr.hash[:], btcutil.Hash160(a.pubKey))
+	return addr
+}
+
 // PayToAddrScript creates a new script to pay a transaction output to a the
 // specified address.
 func cashPayToAddrScript(addr btcutil.Address) ([]byte, error) {
@@ -570,6 +756,19 @@ func cashPayToAddrScript(addr btcutil.Address) ([]byte, error) {
 			return nil, errors.New(nilAddrErrStr)
 		}
 		return payToScriptHashScript(addr.ScriptAddress())
+
+	case *CashAddressScriptHash32:
+		if addr == nil {
+			return nil, errors.New(nilAddrErrStr)
+		}
+		return txscript.NewScriptBuilder().AddOp(txscript.OP_HASH256).AddData(addr.ScriptAddress()).
+			AddOp(txscript.OP_EQUAL).Script()
+
+	case *CashAddressPubKey:
+		if addr == nil {
+			return nil, errors.New(nilAddrErrStr)
+		}
+		return txscript.NewScriptBuilder().AddData(addr.ScriptAddress()).AddOp(txscript.OP_CHECKSIG).Script()
 	}
 	return nil, fmt.Errorf("unable to generate payment script for unsupported "+
 		"address type %T", addr)
@@ -594,14 +793,25 @@ func payToScriptHashScript(scriptHash []byte) ([]byte, error) {
 // ExtractPkScriptAddrs returns the type of script, addresses and required
 // signatures associated with the passed PkScript.  Note that it only works for
 // 'standard' transaction script types.  Any data such as public keys which are
-// invalid are omitted from the results.
+// invalid are omitted from the results.  The token prefix of the script, if
+// any, is skipped.
 func ExtractPkScriptAddrs(pkScript []byte, chainParams *chaincfg.Params) (btcutil.Address, error) {
+	_, pkScript, err := SplitTokenPrefix(pkScript)
+	if err != nil {
+		return nil, err
+	}
+	if isPayToScriptHash32(pkScript) {
+		return NewCashAddressScriptHash32FromHash(pkScript[2:34], chainParams)
+	}
 	// No valid addresses or required signatures if the script doesn't
 	// parse.
 	if len(pkScript) == 1+1+20+1 && pkScript[0] == 0xa9 && pkScript[1] == 0x14 && pkScript[22] == 0x87 {
 		return NewCashAddressScriptHashFromHash(pkScript[2:22], chainParams)
 	} else if len(pkScript) == 1+1+1+20+1+1 && pkScript[0] == 0x76 && pkScript[1] == 0xa9 && pkScript[2] == 0x14 && pkScript[23] == 0x88 && pkScript[24] == 0xac {
 		return NewCashAddressPubKeyHash(pkScript[3:23], chainParams)
+	} else if (len(pkScript) == 1+33+1 || len(pkScript) == 1+65+1) && int(pkScript[0]) == len(pkScript)-2 &&
+		pkScript[len(pkScript)-1] == txscript.OP_CHECKSIG {
+		return NewCashAddressPubKey(pkScript[1:len(pkScript)-1], chainParams)
 	}
 	return nil, errors.New("unknown script type")
 }
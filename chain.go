@@ -0,0 +1,202 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// DefaultMaxChainLength is the default length limit of chains of unconfirmed
+// transactions built by a ChainedBuilder, the ancestor limit nodes enforced
+// before the May 2021 upgrade.
+const DefaultMaxChainLength = 50
+
+// ErrChainTooLong describes an error where the only outputs that could fund a
+// transaction are at the end of chains of unconfirmed transactions that
+// already reached their length limit.
+var ErrChainTooLong = errors.New("unconfirmed chain too long")
+
+// ChainedTx is a transaction built by a ChainedBuilder.
+type ChainedTx struct {
+	UnsignedTx
+
+	// Depth is the length of the longest chain of unconfirmed
+	// transactions ending with this one.
+	Depth int
+}
+
+// ChainedBuilder builds and signs successive transactions, each one able to
+// spend the unconfirmed change of the previous ones.
+type ChainedBuilder struct {
+	FeeRate      FeeRate
+	ChangeScript []byte
+
+	// MaxChainLength limits the length of the chains of unconfirmed
+	// transactions.  DefaultMaxChainLength is used when it is not
+	// positive.
+	MaxChainLength int
+
+	Params   *chaincfg.Params
+	KeyDB    txscript.KeyDB
+	ScriptDB txscript.ScriptDB
+
+	// utxos holds the spendable outputs and txs the unconfirmed
+	// transactions built, in order.
+	utxos map[wire.OutPoint]UTXO
+	txs   []*ChainedTx
+}
+
+// AddUTXOs makes confirmed outputs available to fund transactions.
+func (c *ChainedBuilder) AddUTXOs(utxos ...UTXO) {
+	if c.utxos == nil {
+		c.utxos = make(map[wire.OutPoint]UTXO)
+	}
+	for _, u := range utxos {
+		c.utxos[u.OutPoint] = u
+	}
+}
+
+// Send builds and signs a transaction paying outputs, funded by the available
+// outputs including the change of previous transactions, and makes its change
+// available to the next ones.
+func (c *ChainedBuilder) Send(outputs ...*wire.TxOut) (*ChainedTx, error) {
+	maxLen := c.MaxChainLength
+	if maxLen <= 0 {
+		maxLen = DefaultMaxChainLength
+	}
+	var utxos []UTXO
+	skipped := false
+	for _, u := range c.utxos {
+		if c.depth(u.OutPoint.Hash) >= maxLen {
+			skipped = true
+			continue
+		}
+		utxos = append(utxos, u)
+	}
+	// Sort for the coin selection not to depend on the map order.
+	sort.Slice(utxos, func(i, j int) bool {
+		a, b := utxos[i].OutPoint, utxos[j].OutPoint
+		if cmp := bytes.Compare(a.Hash[:], b.Hash[:]); cmp != 0 {
+			return cmp < 0
+		}
+		return a.Index < b.Index
+	})
+
+	b := NewTxBuilder(c.FeeRate, c.ChangeScript)
+	b.AddUTXOs(utxos...)
+	for _, txOut := range outputs {
+		b.AddOutput(txOut)
+	}
+	u, err := b.Build()
+	if errors.Is(err, ErrInsufficientFunds) && skipped {
+		return nil, fmt.Errorf("%w: chains longer than %d transactions", ErrChainTooLong, maxLen)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := u.Sign(c.Params, c.KeyDB, c.ScriptDB); err != nil {
+		return nil, err
+	}
+
+	tx := &ChainedTx{UnsignedTx: *u}
+	for _, txIn := range u.Tx.TxIn {
+		if depth := c.depth(txIn.PreviousOutPoint.Hash); depth > tx.Depth {
+			tx.Depth = depth
+		}
+		delete(c.utxos, txIn.PreviousOutPoint)
+	}
+	tx.Depth++
+	c.txs = append(c.txs, tx)
+	if u.ChangeIndex >= 0 {
+		change := u.Tx.TxOut[u.ChangeIndex]
+		op := wire.OutPoint{Hash: u.Tx.TxHash(), Index: uint32(u.ChangeIndex)}
+		c.utxos[op] = UTXO{OutPoint: op, Amount: btcutil.Amount(change.Value), PkScript: change.PkScript}
+	}
+	return tx, nil
+}
+
+// depth returns the length of the longest chain of unconfirmed transactions
+// ending with txid, 0 if it is not a transaction of the builder.
+func (c *ChainedBuilder) depth(txid chainhash.Hash) int {
+	for _, tx := range c.txs {
+		if tx.Tx.TxHash() == txid {
+			return tx.Depth
+		}
+	}
+	return 0
+}
+
+// Confirmed records that the transaction txid was mined, which shortens the
+// unconfirmed chains it was part of.
+func (c *ChainedBuilder) Confirmed(txid chainhash.Hash) {
+	for i, tx := range c.txs {
+		if tx.Tx.TxHash() == txid {
+			c.txs = append(c.txs[:i], c.txs[i+1:]...)
+			break
+		}
+	}
+	// Transactions are in order, so parents are seen first.
+	for _, tx := range c.txs {
+		tx.Depth = 0
+		for _, txIn := range tx.Tx.TxIn {
+			if depth := c.depth(txIn.PreviousOutPoint.Hash); depth > tx.Depth {
+				tx.Depth = depth
+			}
+		}
+		tx.Depth++
+	}
+}
+
+// Invalidate records that the transaction txid won't confirm, usually because
+// one of its inputs was double spent, and returns the transactions spending
+// its outputs, directly or not, which must be built again.  The change of
+// those transactions is removed from the available outputs, and the other
+// outputs they spent are available again.  The outputs spent by txid itself
+// are not, since any of them may be the one spent elsewhere.
+func (c *ChainedBuilder) Invalidate(txid chainhash.Hash) []*ChainedTx {
+	invalid := map[chainhash.Hash]bool{txid: true}
+	var rebuild []*ChainedTx
+	var kept []*ChainedTx
+	for _, tx := range c.txs {
+		hash := tx.Tx.TxHash()
+		if hash == txid {
+			continue
+		}
+		for _, txIn := range tx.Tx.TxIn {
+			if invalid[txIn.PreviousOutPoint.Hash] {
+				invalid[hash] = true
+				break
+			}
+		}
+		if invalid[hash] {
+			rebuild = append(rebuild, tx)
+		} else {
+			kept = append(kept, tx)
+		}
+	}
+	c.txs = kept
+
+	for op := range c.utxos {
+		if invalid[op.Hash] {
+			delete(c.utxos, op)
+		}
+	}
+	for _, tx := range rebuild {
+		for i, txIn := range tx.Tx.TxIn {
+			op := txIn.PreviousOutPoint
+			if invalid[op.Hash] {
+				continue
+			}
+			prevOut := tx.PrevOuts[i]
+			c.utxos[op] = UTXO{OutPoint: op, Amount: btcutil.Amount(prevOut.Value), PkScript: prevOut.PkScript}
+		}
+	}
+	return rebuild
+}
@@ -0,0 +1,75 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestChainedBuilder(t *testing.T) {
+	key := signingTestKeys()[0]
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	dest, _ := payToPubKeyHashScript(make([]byte, 20))
+	c := &ChainedBuilder{
+		FeeRate:        1000,
+		ChangeScript:   pkScript,
+		MaxChainLength: 3,
+		Params:         &chaincfg.MainNetParams,
+		KeyDB: txscript.KeyClosure(func(addr btcutil.Address) (*btcec.PrivateKey, bool, error) {
+			return key, true, nil
+		}),
+	}
+	c.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 100000, PkScript: pkScript})
+
+	send := func(value int64) *ChainedTx {
+		tx, err := c.Send(wire.NewTxOut(value, dest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range tx.Tx.TxIn {
+			vm, _ := NewEngine(pkScript, tx.Tx, i, StandardScriptFlags, nil, tx.PrevOuts[i].Value)
+			if err := vm.Execute(); err != nil {
+				t.Fatalf("input %d: %v", i, err)
+			}
+		}
+		return tx
+	}
+	var txs []*ChainedTx
+	for i := 0; i < 3; i++ {
+		txs = append(txs, send(10000))
+		if txs[i].Depth != i+1 {
+			t.Errorf("transaction %d: got depth %d, want %d", i, txs[i].Depth, i+1)
+		}
+		if i > 0 && txs[i].Tx.TxIn[0].PreviousOutPoint.Hash != txs[i-1].Tx.TxHash() {
+			t.Errorf("transaction %d does not spend the previous change", i)
+		}
+	}
+	if _, err := c.Send(wire.NewTxOut(10000, dest)); !errors.Is(err, ErrChainTooLong) {
+		t.Fatalf("got %v, want ErrChainTooLong", err)
+	}
+
+	c.Confirmed(txs[0].Tx.TxHash())
+	if txs[1].Depth != 1 || txs[2].Depth != 2 {
+		t.Errorf("got depths %d and %d after confirmation", txs[1].Depth, txs[2].Depth)
+	}
+	extra := UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{2}}, Amount: 20000, PkScript: pkScript}
+	c.AddUTXOs(extra)
+	txs = append(txs, send(75000))
+	if len(txs[3].Tx.TxIn) != 2 || txs[3].Depth != 3 {
+		t.Fatalf("got %d inputs and depth %d", len(txs[3].Tx.TxIn), txs[3].Depth)
+	}
+
+	rebuild := c.Invalidate(txs[2].Tx.TxHash())
+	if len(rebuild) != 1 || rebuild[0] != txs[3] {
+		t.Fatalf("got %d transactions to rebuild", len(rebuild))
+	}
+	if len(c.utxos) != 1 || c.utxos[extra.OutPoint].Amount != extra.Amount {
+		t.Errorf("got available outputs %v", c.utxos)
+	}
+}
@@ -0,0 +1,74 @@
+package bchutil
+
+import (
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// isPayToScriptHash32 returns whether pkScript pays to the 32 bytes script
+// hash of the May 2023 upgrade.
+func isPayToScriptHash32(pkScript []byte) bool {
+	return len(pkScript) == 35 && pkScript[0] == txscript.OP_HASH256 &&
+		pkScript[1] == txscript.OP_DATA_32 && pkScript[34] == txscript.OP_EQUAL
+}
+
+// GetScriptClass returns the class of pkScript like txscript.GetScriptClass,
+// skipping its token prefix, if any, and classifying pay-to-script-hash
+// scripts with 32 bytes hashes as ScriptHashTy.  Scripts with an invalid
+// token prefix are NonStandardTy.
+func GetScriptClass(pkScript []byte) txscript.ScriptClass {
+	_, pkScript, err := SplitTokenPrefix(pkScript)
+	switch {
+	case err != nil:
+		return txscript.NonStandardTy
+	case isPayToScriptHash32(pkScript):
+		return txscript.ScriptHashTy
+	}
+	return txscript.GetScriptClass(pkScript)
+}
+
+// ClassifyOutput returns the class of the script of txOut, as returned by
+// GetScriptClass, the addresses it pays to and the tokens it carries, nil if
+// none.  Pay-to-pubkey and multisig scripts pay to the pay-to-pubkey-hash
+// addresses of their keys, and the other classes to no address but
+// pay-to-pubkey-hash and pay-to-script-hash ones.  Invalid token prefixes
+// fail with an error wrapping ErrInvalidTokenPrefix.
+func ClassifyOutput(txOut *wire.TxOut, chainParams *chaincfg.Params) (txscript.ScriptClass,
+	[]btcutil.Address, *TokenData, error) {
+
+	token, pkScript, err := SplitTokenPrefix(txOut.PkScript)
+	if err != nil {
+		return txscript.NonStandardTy, nil, nil, err
+	}
+	class := GetScriptClass(pkScript)
+	addrs, err := scriptAddrs(class, pkScript, chainParams)
+	return class, addrs, token, err
+}
+
+// scriptAddrs returns the addresses pkScript, without token prefix, of class
+// class pays to, as returned by ClassifyOutput.
+func scriptAddrs(class txscript.ScriptClass, pkScript []byte, chainParams *chaincfg.Params) ([]btcutil.Address,
+	error) {
+
+	var addrs []btcutil.Address
+	switch class {
+	case txscript.PubKeyHashTy, txscript.ScriptHashTy, txscript.PubKeyTy:
+		addr, err := ExtractPkScriptAddrs(pkScript, chainParams)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	case txscript.MultiSigTy:
+		pubKeys, _, _ := multisigPubKeys(pkScript)
+		for _, pubKey := range pubKeys {
+			addr, err := NewCashAddressPubKeyHash(btcutil.Hash160(pubKey), chainParams)
+			if err != nil {
+				return nil, err
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
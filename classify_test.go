@@ -0,0 +1,116 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestClassifyOutput(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	p2pkh, _ := NewCashAddressPubKeyHash(bytes.Repeat([]byte{1}, 20), params)
+	p2sh, _ := NewCashAddressScriptHashFromHash(bytes.Repeat([]byte{2}, 20), params)
+	p2sh32, _ := NewCashAddressScriptHash32FromHash(bytes.Repeat([]byte{3}, 32), params)
+
+	tokens := []*TokenData{nil}
+	for _, hasNFT := range []bool{false, true} {
+		for _, capability := range []NFTCapability{NFTImmutable, NFTMutable, NFTMinting} {
+			for _, commitment := range [][]byte{nil, {0xcc}, bytes.Repeat([]byte{0xcc}, MaxTokenCommitmentLen)} {
+				for _, amount := range []uint64{0, 1, 252, 253, 0x10000, math.MaxInt64} {
+					if !hasNFT && (capability != NFTImmutable || commitment != nil || amount == 0) {
+						continue
+					}
+					tokens = append(tokens, &TokenData{Category: chainhash.Hash{0xaa}, Amount: amount,
+						HasNFT: hasNFT, Capability: capability, Commitment: commitment})
+				}
+			}
+		}
+	}
+
+	for _, addr := range []interface {
+		EncodeAddress() string
+		ScriptAddress() []byte
+		IsForNet(*chaincfg.Params) bool
+		String() string
+	}{p2pkh, p2sh, p2sh32} {
+		pkScript, err := PayToAddrScript(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, token := range tokens {
+			script := pkScript
+			if token != nil {
+				script = append(token.Bytes(), pkScript...)
+			}
+			class, addrs, gotToken, err := ClassifyOutput(wire.NewTxOut(1000, script), params)
+			if err != nil {
+				t.Fatalf("%v, token %d: %v", addr, i, err)
+			}
+			wantClass := txscript.ScriptHashTy
+			if addr == p2pkh {
+				wantClass = txscript.PubKeyHashTy
+			}
+			if class != wantClass || GetScriptClass(script) != wantClass {
+				t.Errorf("%v, token %d: got class %v, want %v", addr, i, class, wantClass)
+			}
+			if len(addrs) != 1 || addrs[0].EncodeAddress() != addr.EncodeAddress() {
+				t.Errorf("%v, token %d: got addresses %v", addr, i, addrs)
+			}
+			if (token == nil) != (gotToken == nil) || (token != nil && !bytes.Equal(gotToken.Bytes(), token.Bytes())) {
+				t.Errorf("%v, token %d: got %+v, want %+v", addr, i, gotToken, token)
+			}
+		}
+	}
+
+	prefixed := func(script ...byte) []byte {
+		return append((&TokenData{Category: chainhash.Hash{0xaa}, Amount: 1}).Bytes(), script...)
+	}
+	nullData, _ := txscript.NullDataScript([]byte("data"))
+	reserved := append(append([]byte{tokenPrefix}, make([]byte, chainhash.HashSize)...), 0x90, 1)
+	for i, test := range []struct {
+		pkScript []byte
+		class    txscript.ScriptClass
+		err      error
+	}{
+		{prefixed(txscript.OP_TRUE), txscript.NonStandardTy, nil},
+		{append(reserved, nullData...), txscript.NonStandardTy, ErrInvalidTokenPrefix},
+		{prefixed(nullData...), txscript.NullDataTy, nil},
+		{[]byte{tokenPrefix, txscript.OP_RETURN}, txscript.NonStandardTy, ErrInvalidTokenPrefix},
+	} {
+		class, addrs, _, err := ClassifyOutput(wire.NewTxOut(0, test.pkScript), params)
+		if class != test.class || len(addrs) != 0 || !errors.Is(err, test.err) {
+			t.Errorf("test %d: got %v, %v, %v", i, class, addrs, err)
+		}
+	}
+
+	pubKey := signingTestKeys()[0].PubKey().SerializeCompressed()
+	p2pk, _ := txscript.NewScriptBuilder().AddData(pubKey).AddOp(txscript.OP_CHECKSIG).Script()
+	class, addrs, _, err := ClassifyOutput(wire.NewTxOut(1000, prefixed(p2pk...)), params)
+	if err != nil || class != txscript.PubKeyTy || len(addrs) != 1 {
+		t.Errorf("got %v, %v, %v", class, addrs, err)
+	}
+}
+
+func TestCashAddressScriptHash32(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	addr, err := NewCashAddressScriptHash32([]byte{txscript.OP_TRUE}, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeAddress(addr.EncodeAddress(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded.(*CashAddressScriptHash32); !ok || !bytes.Equal(decoded.ScriptAddress(), addr.ScriptAddress()) {
+		t.Errorf("got %v, want %v", decoded, addr)
+	}
+	if addr.EncodeAddress()[0] != 'p' {
+		t.Errorf("got %v", addr)
+	}
+}
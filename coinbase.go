@@ -0,0 +1,194 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// minCoinbaseScriptSigSize is the smallest coinbase scriptSig.
+const minCoinbaseScriptSigSize = 2
+
+// ErrCoinbaseHeight describes an error where a coinbase scriptSig does not
+// start with the height of its block as BIP 34 requires: a number push
+// encoded as the reference implementation does, with OP_0 for zero, OP_1 to
+// OP_16 for small numbers and the shortest push of the minimal number
+// otherwise.
+var ErrCoinbaseHeight = errors.New("invalid BIP 34 coinbase height")
+
+// IsCoinBaseTx returns whether tx is a coinbase transaction, whose only input
+// spends the null outpoint.
+func IsCoinBaseTx(tx *wire.MsgTx) bool {
+	if len(tx.TxIn) != 1 {
+		return false
+	}
+	op := tx.TxIn[0].PreviousOutPoint
+	return op.Index == wire.MaxPrevOutIndex && op.Hash == (chainhash.Hash{})
+}
+
+// PoolMatcher attributes the coinbases whose miner tag contains one of Tags
+// to the pool Name.
+type PoolMatcher struct {
+	Name string
+	Tags [][]byte
+}
+
+// DefaultPoolMatchers are the tags of well known pools, which callers can
+// extend and pass to WithPoolMatchers.
+var DefaultPoolMatchers = []PoolMatcher{
+	{Name: "ViaBTC", Tags: [][]byte{[]byte("/ViaBTC/")}},
+	{Name: "AntPool", Tags: [][]byte{[]byte("Mined by AntPool")}},
+	{Name: "BTC.com", Tags: [][]byte{[]byte("/BTC.COM/")}},
+	{Name: "BTC.TOP", Tags: [][]byte{[]byte("/BTC.TOP/")}},
+	{Name: "Bitcoin.com", Tags: [][]byte{[]byte("/pool.bitcoin.com/")}},
+	{Name: "Binance Pool", Tags: [][]byte{[]byte("/Binance/")}},
+	{Name: "Poolin", Tags: [][]byte{[]byte("/poolin.com")}},
+	{Name: "Mining-Dutch", Tags: [][]byte{[]byte("/Mining-Dutch/")}},
+	{Name: "Prohashing", Tags: [][]byte{[]byte("Prohashing")}},
+}
+
+// CoinbaseInfo is what a coinbase scriptSig tells about its block.
+type CoinbaseInfo struct {
+	// Height is the BIP 34 height of the block, if HasHeight.
+	Height    int32
+	HasHeight bool
+
+	// Tag is the rest of the scriptSig, in which miners put their name and
+	// extra nonces, and TagText its printable text, with each run of other
+	// bytes replaced by a space.
+	Tag     []byte
+	TagText string
+
+	// Pool is the name of the first pool matching the tag, "" if none.
+	Pool string
+}
+
+// coinbaseOptions are the options of ParseCoinbaseScriptSig.
+type coinbaseOptions struct {
+	params   *chaincfg.Params
+	height   int32
+	matchers []PoolMatcher
+}
+
+// CoinbaseOption is an option of ParseCoinbaseScriptSig.
+type CoinbaseOption func(*coinbaseOptions)
+
+// CoinbaseAtHeight makes ParseCoinbaseScriptSig parse the coinbase of the
+// block of height on the network of params: blocks before BIP 34 activated
+// have no height, and the others must have this one.
+func CoinbaseAtHeight(height int32, params *chaincfg.Params) CoinbaseOption {
+	return func(o *coinbaseOptions) {
+		o.params, o.height = params, height
+	}
+}
+
+// WithPoolMatchers makes ParseCoinbaseScriptSig attribute coinbases with
+// matchers instead of DefaultPoolMatchers.
+func WithPoolMatchers(matchers []PoolMatcher) CoinbaseOption {
+	return func(o *coinbaseOptions) {
+		o.matchers = matchers
+	}
+}
+
+// ParseCoinbaseScriptSig parses scriptSig, the scriptSig of a coinbase
+// transaction, into its BIP 34 block height and the miner tag following it.
+// The block is assumed to follow BIP 34, as every block has since 2013, unless
+// CoinbaseAtHeight tells its height: coinbases of earlier blocks start with
+// arbitrary data, often their difficulty bits, and some with pushes reading
+// as later heights.  Heights not encoded as BIP 34 requires fail with
+// ErrCoinbaseHeight.  Tags are attributed to pools by DefaultPoolMatchers or
+// those of WithPoolMatchers.
+func ParseCoinbaseScriptSig(scriptSig []byte, opts ...CoinbaseOption) (*CoinbaseInfo, error) {
+	o := coinbaseOptions{matchers: DefaultPoolMatchers}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if n := len(scriptSig); n < minCoinbaseScriptSigSize || n > maxCoinbaseScriptSigSize {
+		return nil, fmt.Errorf("coinbase scriptSig of %d bytes, want %d to %d", n, minCoinbaseScriptSigSize,
+			maxCoinbaseScriptSigSize)
+	}
+
+	info := &CoinbaseInfo{}
+	tag := scriptSig
+	if o.params == nil || o.height >= o.params.BIP0034Height {
+		height, n, err := coinbaseHeight(scriptSig)
+		if err != nil {
+			return nil, err
+		}
+		if o.params != nil && height != o.height {
+			return nil, fmt.Errorf("%w: height %d in the coinbase of block %d", ErrCoinbaseHeight, height,
+				o.height)
+		}
+		info.Height, info.HasHeight = height, true
+		tag = scriptSig[n:]
+	}
+	info.Tag = append([]byte(nil), tag...)
+	info.TagText = coinbaseTagText(tag)
+	for _, m := range o.matchers {
+		for _, t := range m.Tags {
+			if info.Pool == "" && len(t) != 0 && bytes.Contains(tag, t) {
+				info.Pool = m.Name
+			}
+		}
+	}
+	return info, nil
+}
+
+// coinbaseHeight returns the height starting scriptSig and the length of its
+// push, which must be the one the reference implementation serializes.
+func coinbaseHeight(scriptSig []byte) (int32, int, error) {
+	op := scriptSig[0]
+	var height scriptNum
+	n := 1
+	switch {
+	case op == txscript.OP_0:
+	case op >= txscript.OP_1 && op <= txscript.OP_16:
+		height = scriptNum(op - txscript.OP_1 + 1)
+	case op <= 4:
+		n += int(op)
+		if len(scriptSig) < n {
+			return 0, 0, fmt.Errorf("%w: %d byte push truncated", ErrCoinbaseHeight, op)
+		}
+		height, _ = makeScriptNum(scriptSig[1:n], false, 4)
+	default:
+		return 0, 0, fmt.Errorf("%w: scriptSig starts with %x, not a height push", ErrCoinbaseHeight, op)
+	}
+	if height < 0 {
+		return 0, 0, fmt.Errorf("%w: negative height %d", ErrCoinbaseHeight, height)
+	}
+	expected, _ := NewScriptBuilder().AddInt64(int64(height)).Script()
+	if !bytes.Equal(scriptSig[:n], expected) {
+		return 0, 0, fmt.Errorf("%w: height %d pushed as %x instead of %x", ErrCoinbaseHeight, height,
+			scriptSig[:n], expected)
+	}
+	return int32(height), n, nil
+}
+
+// coinbaseTagText returns the printable UTF-8 text of tag, with each run of
+// other bytes replaced by a space, trimmed.
+func coinbaseTagText(tag []byte) string {
+	var b strings.Builder
+	gap := false
+	for len(tag) != 0 {
+		r, size := utf8.DecodeRune(tag)
+		tag = tag[size:]
+		if r == utf8.RuneError && size == 1 || !unicode.IsPrint(r) {
+			gap = true
+			continue
+		}
+		if gap && b.Len() != 0 {
+			b.WriteByte(' ')
+		}
+		gap = false
+		b.WriteRune(r)
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,136 @@
+package bchutil
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestIsCoinBaseTx(t *testing.T) {
+	coinbase, _ := NewCoinbaseTx(CoinbaseSpec{Height: 1000, PkScript: []byte{0x51}}, 0)
+	if !IsCoinBaseTx(coinbase) {
+		t.Error("coinbase not detected")
+	}
+	for _, op := range []*wire.OutPoint{
+		wire.NewOutPoint(&chainhash.Hash{}, 0),
+		wire.NewOutPoint(&chainhash.Hash{1}, wire.MaxPrevOutIndex),
+	} {
+		tx := coinbase.Copy()
+		tx.TxIn[0].PreviousOutPoint = *op
+		if IsCoinBaseTx(tx) {
+			t.Errorf("spend of %v is a coinbase", op)
+		}
+	}
+	tx := coinbase.Copy()
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	if IsCoinBaseTx(tx) || IsCoinBaseTx(wire.NewMsgTx(wire.TxVersion)) {
+		t.Error("transaction with two or no inputs is a coinbase")
+	}
+}
+
+func TestCoinbaseHeight(t *testing.T) {
+	for _, height := range []int32{0, 1, 16, 17, 127, 128, 255, 256, 32767, 32768, 227931, 8388607, 8388608} {
+		tx, err := NewCoinbaseTx(CoinbaseSpec{Height: height, PkScript: []byte{0x51}}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := ParseCoinbaseScriptSig(tx.TxIn[0].SignatureScript, CoinbaseAtHeight(height,
+			&chaincfg.SimNetParams))
+		if err != nil || !info.HasHeight || info.Height != height {
+			t.Errorf("height %d: got %+v, %v", height, info, err)
+		}
+	}
+
+	for _, test := range []struct {
+		name      string
+		scriptSig string
+	}{
+		{"small number pushed as data", "0105ff"},
+		{"zero pushed as data", "0100ff"},
+		{"padded number", "04e0930400ff"},
+		{"OP_PUSHDATA1", "4c03e09304ff"},
+		{"negative number", "0181ff"},
+		{"truncated push", "03e093"},
+		{"no push", "6aff"},
+	} {
+		if _, err := ParseCoinbaseScriptSig(mustDecodeHex(test.scriptSig)); !errors.Is(err, ErrCoinbaseHeight) {
+			t.Errorf("%s: got %v, want ErrCoinbaseHeight", test.name, err)
+		}
+	}
+
+	// The first block of BIP 34 on the main network, whose height must be
+	// the one of the block.
+	bip34 := mustDecodeHex("035b7a03ff")
+	info, err := ParseCoinbaseScriptSig(bip34, CoinbaseAtHeight(227931, &chaincfg.MainNetParams))
+	if err != nil || info.Height != 227931 {
+		t.Errorf("got %+v, %v", info, err)
+	}
+	if _, err := ParseCoinbaseScriptSig(bip34, CoinbaseAtHeight(227932, &chaincfg.MainNetParams)); !errors.Is(err,
+		ErrCoinbaseHeight) {
+		t.Errorf("got %v, want ErrCoinbaseHeight", err)
+	}
+
+	for _, n := range []int{1, 101} {
+		if _, err := ParseCoinbaseScriptSig(make([]byte, n)); err == nil {
+			t.Errorf("%d byte scriptSig parsed", n)
+		}
+	}
+}
+
+func TestCoinbaseEarlyBlocks(t *testing.T) {
+	// The genesis block pushes its difficulty bits, which read as a height
+	// unless the block is known to precede BIP 34.
+	genesis := mustDecodeHex("04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72" +
+		"206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73")
+	info, err := ParseCoinbaseScriptSig(genesis, CoinbaseAtHeight(0, &chaincfg.MainNetParams))
+	if err != nil || info.HasHeight || len(info.Tag) != len(genesis) ||
+		!strings.HasSuffix(info.TagText, "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks") {
+		t.Errorf("got %+v, %v", info, err)
+	}
+	info, err = ParseCoinbaseScriptSig(genesis)
+	if err != nil || !info.HasHeight || info.Height != 0x1d00ffff {
+		t.Errorf("got %+v, %v", info, err)
+	}
+
+	// Blocks before BIP 34 pushed numbers reading as later heights, such
+	// as 1983702 in block 164384.
+	early := mustDecodeHex("03d6441e0101")
+	if info, err := ParseCoinbaseScriptSig(early, CoinbaseAtHeight(164384, &chaincfg.MainNetParams)); err != nil ||
+		info.HasHeight {
+		t.Errorf("got %+v, %v", info, err)
+	}
+	if info, err := ParseCoinbaseScriptSig(early); err != nil || info.Height != 1983702 {
+		t.Errorf("got %+v, %v", info, err)
+	}
+}
+
+func TestCoinbaseTag(t *testing.T) {
+	scriptSig := append(mustDecodeHex("03e0930408"), []byte("\x00\x01/ViaBTC/Mined by alice/\xfa\xbe\x00")...)
+	info, err := ParseCoinbaseScriptSig(scriptSig)
+	if err != nil || info.Height != 300000 || info.Pool != "ViaBTC" || info.TagText != "/ViaBTC/Mined by alice/" {
+		t.Fatalf("got %+v, %v", info, err)
+	}
+	matchers := append([]PoolMatcher{{Name: "Alice", Tags: [][]byte{[]byte("by alice")}}}, DefaultPoolMatchers...)
+	if info, _ := ParseCoinbaseScriptSig(scriptSig, WithPoolMatchers(matchers)); info.Pool != "Alice" {
+		t.Errorf("attributed to %q", info.Pool)
+	}
+	if info, _ := ParseCoinbaseScriptSig(scriptSig, WithPoolMatchers(nil)); info.Pool != "" {
+		t.Errorf("attributed to %q", info.Pool)
+	}
+	if got := coinbaseTagText([]byte("\x01a\xffé\x00\x00b ")); got != "a é b" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,173 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+var (
+	// ErrInsufficientTokens describes an error where the available outputs
+	// don't carry the fungible tokens to send.
+	ErrInsufficientTokens = errors.New("insufficient tokens")
+
+	// ErrNFTNotFound describes an error where no available output carries
+	// the NFT to send.
+	ErrNFTNotFound = errors.New("NFT not found")
+)
+
+// CoinSelector selects the outputs funding a transaction.
+type CoinSelector interface {
+	// SelectCoins returns outputs of utxos worth at least target.
+	SelectCoins(utxos []UTXO, target btcutil.Amount) ([]UTXO, error)
+}
+
+// LargestFirst is a CoinSelector selecting the largest outputs first.
+type LargestFirst struct {
+	// Policy selects the outputs that can be spent.
+	Policy SpendPolicy
+}
+
+// SelectCoins returns the largest outputs of utxos, without tokens and
+// spendable under s.Policy, worth at least target, or ErrInsufficientFunds.
+func (s LargestFirst) SelectCoins(utxos []UTXO, target btcutil.Amount) ([]UTXO, error) {
+	var selected []UTXO
+	var total btcutil.Amount
+	for _, u := range selectionPool(utxos, s.Policy) {
+		if total >= target {
+			break
+		}
+		selected = append(selected, u)
+		var err error
+		if total, err = AddChecked(total, u.Amount); err != nil {
+			return nil, err
+		}
+	}
+	if total < target {
+		return nil, fmt.Errorf("%w: %v available, %v needed", ErrInsufficientFunds, total, target)
+	}
+	return selected, nil
+}
+
+// NFTSelector identifies an NFT to spend.
+type NFTSelector struct {
+	Commitment []byte
+
+	// Capability, if not nil, is the required capability of the NFT.
+	Capability *NFTCapability
+}
+
+// matches returns whether t is the NFT selected.
+func (s *NFTSelector) matches(t *TokenData) bool {
+	return t.HasNFT && bytes.Equal(t.Commitment, s.Commitment) &&
+		(s.Capability == nil || *s.Capability == t.Capability)
+}
+
+// TokenSelection holds the inputs selected by SelectTokenCoins.
+type TokenSelection struct {
+	// TokenInputs carry tokens of the selected category, and FeeInputs
+	// carry no tokens.
+	TokenInputs []UTXO
+	FeeInputs   []UTXO
+
+	// FungibleChange is the fungible amount of the inputs not sent, by
+	// category.
+	FungibleChange map[chainhash.Hash]uint64
+
+	// Value is the value of all the inputs.
+	Value btcutil.Amount
+}
+
+// SelectTokenCoins selects outputs of utxos carrying fungibleTarget tokens of
+// category and, if nft is not nil, the NFT it identifies, then outputs
+// without tokens selected by feeSelector so that the inputs are worth
+// feeBudget.  Outputs carrying tokens of other categories are never selected,
+// and outputs carrying NFTs only when needed for the fungible amount, the
+// largest fungible amounts first.  Outputs with an invalid token prefix are
+// skipped.
+func SelectTokenCoins(utxos []UTXO, category chainhash.Hash, fungibleTarget uint64, nft *NFTSelector,
+	feeBudget btcutil.Amount, feeSelector CoinSelector) (*TokenSelection, error) {
+
+	sel := &TokenSelection{FungibleChange: make(map[chainhash.Hash]uint64)}
+	var fungible, withNFT, plain []UTXO
+	tokens := make(map[wire.OutPoint]*TokenData)
+	nftIdx := -1
+	for _, u := range utxos {
+		t, err := u.Token()
+		switch {
+		case err != nil:
+			continue
+		case t == nil:
+			plain = append(plain, u)
+			continue
+		case t.Category != category:
+			continue
+		}
+		tokens[u.OutPoint] = t
+		switch {
+		case nft != nil && nftIdx < 0 && nft.matches(t):
+			nftIdx = len(sel.TokenInputs)
+			sel.TokenInputs = append(sel.TokenInputs, u)
+		case t.Amount == 0:
+		case t.HasNFT:
+			withNFT = append(withNFT, u)
+		default:
+			fungible = append(fungible, u)
+		}
+	}
+	if nft != nil && nftIdx < 0 {
+		return nil, fmt.Errorf("%w: commitment %x of category %v", ErrNFTNotFound, nft.Commitment, category)
+	}
+
+	var amount uint64
+	if nftIdx >= 0 {
+		amount = tokens[sel.TokenInputs[nftIdx].OutPoint].Amount
+	}
+	for _, candidates := range [][]UTXO{fungible, withNFT} {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return tokens[candidates[i].OutPoint].Amount > tokens[candidates[j].OutPoint].Amount
+		})
+		for _, u := range candidates {
+			if amount >= fungibleTarget {
+				break
+			}
+			sel.TokenInputs = append(sel.TokenInputs, u)
+			amount += tokens[u.OutPoint].Amount
+		}
+	}
+	if amount < fungibleTarget {
+		return nil, fmt.Errorf("%w: %d of category %v available, %d needed", ErrInsufficientTokens, amount,
+			category, fungibleTarget)
+	}
+	if amount > fungibleTarget {
+		sel.FungibleChange[category] = amount - fungibleTarget
+	}
+
+	for _, u := range sel.TokenInputs {
+		var err error
+		if sel.Value, err = AddChecked(sel.Value, u.Amount); err != nil {
+			return nil, err
+		}
+	}
+	if sel.Value < feeBudget {
+		feeInputs, err := feeSelector.SelectCoins(plain, feeBudget-sel.Value)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range feeInputs {
+			if u.HasTokens() {
+				return nil, errors.New("coin selector returned an output with tokens")
+			}
+			sel.FeeInputs = append(sel.FeeInputs, u)
+			if sel.Value, err = AddChecked(sel.Value, u.Amount); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return sel, nil
+}
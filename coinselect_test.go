@@ -0,0 +1,145 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// tokenTestUTXO returns an output of 1000 satoshis carrying t, if not nil.
+func tokenTestUTXO(i byte, t *TokenData) UTXO {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	u := UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{i}}, Amount: 1000, PkScript: pkScript}
+	if t != nil {
+		u.TokenData = t.Bytes()
+	}
+	return u
+}
+
+func TestSelectTokenCoins(t *testing.T) {
+	category, other := chainhash.Hash{0xaa}, chainhash.Hash{0xbb}
+	utxos := []UTXO{
+		tokenTestUTXO(1, &TokenData{Category: category, Amount: 50}),
+		tokenTestUTXO(2, &TokenData{Category: category, Amount: 500, HasNFT: true}),
+		tokenTestUTXO(3, &TokenData{Category: other, Amount: 1000}),
+		tokenTestUTXO(4, &TokenData{Category: category, Amount: 80}),
+		tokenTestUTXO(5, &TokenData{Category: category, HasNFT: true, Commitment: []byte{1}}),
+		tokenTestUTXO(6, nil),
+		tokenTestUTXO(7, nil),
+	}
+	utxos[6].Amount = 5000
+
+	sel, err := SelectTokenCoins(utxos, category, 100, nil, 4000, LargestFirst{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sel.TokenInputs) != 2 || sel.TokenInputs[0].OutPoint.Hash[0] != 4 ||
+		sel.TokenInputs[1].OutPoint.Hash[0] != 1 {
+		t.Errorf("got token inputs %v", sel.TokenInputs)
+	}
+	if sel.FungibleChange[category] != 30 || len(sel.FungibleChange) != 1 {
+		t.Errorf("got fungible change %v", sel.FungibleChange)
+	}
+	if len(sel.FeeInputs) != 1 || sel.FeeInputs[0].OutPoint.Hash[0] != 7 || sel.Value != 7000 {
+		t.Errorf("got fee inputs %v worth %v", sel.FeeInputs, sel.Value)
+	}
+
+	// The NFT output is only spent when the other ones are not enough.
+	sel, err = SelectTokenCoins(utxos, category, 200, nil, 0, LargestFirst{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sel.TokenInputs) != 3 || sel.FungibleChange[category] != 430 || len(sel.FeeInputs) != 0 {
+		t.Errorf("got %d token inputs and change %v", len(sel.TokenInputs), sel.FungibleChange)
+	}
+
+	minting := NFTMinting
+	nft := &NFTSelector{Commitment: []byte{1}}
+	sel, err = SelectTokenCoins(utxos, category, 0, nft, 0, LargestFirst{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sel.TokenInputs) != 1 || sel.TokenInputs[0].OutPoint.Hash[0] != 5 {
+		t.Errorf("got token inputs %v", sel.TokenInputs)
+	}
+	nft.Capability = &minting
+	if _, err := SelectTokenCoins(utxos, category, 0, nft, 0, LargestFirst{}); !errors.Is(err, ErrNFTNotFound) {
+		t.Errorf("got %v, want ErrNFTNotFound", err)
+	}
+	if _, err := SelectTokenCoins(utxos, category, 631, nil, 0, LargestFirst{}); !errors.Is(err, ErrInsufficientTokens) {
+		t.Errorf("got %v, want ErrInsufficientTokens", err)
+	}
+	if _, err := SelectTokenCoins(utxos, category, 1, nil, 20000, LargestFirst{}); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+}
+
+func TestSpendPolicy(t *testing.T) {
+	tests := []struct {
+		utxo   UTXO
+		policy SpendPolicy
+		want   bool
+	}{
+		{UTXO{}, SpendPolicy{}, true},
+		{UTXO{}, SpendPolicy{ExcludeUnconfirmed: true}, false},
+		{UTXO{Confirmations: 1}, SpendPolicy{ExcludeUnconfirmed: true}, true},
+		{UTXO{Coinbase: true, Confirmations: CoinbaseMaturity - 1}, SpendPolicy{}, false},
+		{UTXO{Coinbase: true, Confirmations: CoinbaseMaturity}, SpendPolicy{}, true},
+		{UTXO{Coinbase: true}, SpendPolicy{SpendImmature: true}, true},
+		// The height of the output and the tip take precedence over a
+		// stale Confirmations.
+		{UTXO{Coinbase: true, Height: 1000}, SpendPolicy{TipHeight: 1098}, false},
+		{UTXO{Coinbase: true, Height: 1000}, SpendPolicy{TipHeight: 1099}, true},
+		{UTXO{Height: 1000, Confirmations: 5}, SpendPolicy{TipHeight: 999, ExcludeUnconfirmed: true}, false},
+		{UTXO{Coinbase: true, Height: 1000, Confirmations: CoinbaseMaturity}, SpendPolicy{}, true},
+	}
+	for i, test := range tests {
+		if got := test.policy.IsSpendable(test.utxo); got != test.want {
+			t.Errorf("%d: got %v, want %v", i, got, test.want)
+		}
+	}
+	if IsSpendable(UTXO{Coinbase: true, Height: 1}, 99) || !IsSpendable(UTXO{Coinbase: true, Height: 1}, 100) {
+		t.Error("wrong coinbase maturity")
+	}
+}
+
+func TestTxBuilderSpendPolicy(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	coinbase := tokenTestUTXO(1, nil)
+	coinbase.Amount, coinbase.Coinbase, coinbase.Height = 100000, true, 500
+	unconfirmed := tokenTestUTXO(2, nil)
+	unconfirmed.Amount = 50000
+
+	build := func(setup func(b *TxBuilder)) (*UnsignedTx, error) {
+		b := NewTxBuilder(1000, pkScript)
+		b.AddUTXOs(coinbase, unconfirmed)
+		b.AddOutput(wire.NewTxOut(30000, pkScript))
+		setup(b)
+		return b.Build()
+	}
+	spent := func(u *UnsignedTx) byte {
+		return u.Tx.TxIn[0].PreviousOutPoint.Hash[0]
+	}
+
+	// Without a tip, the coinbase output has no confirmation.
+	u, err := build(func(*TxBuilder) {})
+	if err != nil || spent(u) != 2 {
+		t.Fatalf("got %v, %v, want the unconfirmed output spent", u, err)
+	}
+	u, err = build(func(b *TxBuilder) { b.SetChainTip(599, time.Unix(0, 0)) })
+	if err != nil || spent(u) != 1 {
+		t.Fatalf("got %v, %v, want the coinbase output spent", u, err)
+	}
+	_, err = build(func(b *TxBuilder) { b.SetSpendPolicy(SpendPolicy{TipHeight: 598, ExcludeUnconfirmed: true}) })
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("got %v, want ErrInsufficientFunds", err)
+	}
+
+	sel, err := LargestFirst{Policy: SpendPolicy{SpendImmature: true}}.SelectCoins([]UTXO{coinbase, unconfirmed}, 1)
+	if err != nil || len(sel) != 1 || sel[0].OutPoint != coinbase.OutPoint {
+		t.Fatalf("got %v, %v, want the coinbase output", sel, err)
+	}
+}
@@ -0,0 +1,284 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// shortIDMask keeps the 6 low bytes of the SipHash of a txid, its BIP 152
+// short ID.
+const shortIDMask = 1<<48 - 1
+
+// ErrShortIDCollision describes an error where the short IDs of a compact
+// block are not unique, which leaves the receiver to fetch the full block.
+var ErrShortIDCollision = errors.New("short ID collision")
+
+// sipRound is a SipRound of the state v.
+func sipRound(v *[4]uint64) {
+	v[0] += v[1]
+	v[1] = bits.RotateLeft64(v[1], 13)
+	v[1] ^= v[0]
+	v[0] = bits.RotateLeft64(v[0], 32)
+	v[2] += v[3]
+	v[3] = bits.RotateLeft64(v[3], 16)
+	v[3] ^= v[2]
+	v[0] += v[3]
+	v[3] = bits.RotateLeft64(v[3], 21)
+	v[3] ^= v[0]
+	v[2] += v[1]
+	v[1] = bits.RotateLeft64(v[1], 17)
+	v[1] ^= v[2]
+	v[2] = bits.RotateLeft64(v[2], 32)
+}
+
+// sipHash24 returns the SipHash-2-4 of msg with the key k0, k1.
+func sipHash24(k0, k1 uint64, msg []byte) uint64 {
+	v := [4]uint64{k0 ^ 0x736f6d6570736575, k1 ^ 0x646f72616e646f6d, k0 ^ 0x6c7967656e657261,
+		k1 ^ 0x7465646279746573}
+	compress := func(m uint64) {
+		v[3] ^= m
+		sipRound(&v)
+		sipRound(&v)
+		v[0] ^= m
+	}
+	n := len(msg)
+	for ; len(msg) >= 8; msg = msg[8:] {
+		compress(binary.LittleEndian.Uint64(msg))
+	}
+	var last [8]byte
+	copy(last[:], msg)
+	last[7] = byte(n)
+	compress(binary.LittleEndian.Uint64(last[:]))
+	v[2] ^= 0xff
+	for i := 0; i < 4; i++ {
+		sipRound(&v)
+	}
+	return v[0] ^ v[1] ^ v[2] ^ v[3]
+}
+
+// CompactBlockSipKeys returns the SipHash keys of the short IDs of the
+// compact block of header sent with nonce: the two little endian numbers of
+// the first 16 bytes of the SHA-256 of the header followed by the little
+// endian nonce.
+func CompactBlockSipKeys(header *wire.BlockHeader, nonce uint64) [2]uint64 {
+	var buf bytes.Buffer
+	buf.Grow(BlockHeaderSize + 8)
+	header.Serialize(&buf)
+	binary.Write(&buf, binary.LittleEndian, nonce)
+	sum := sha256.Sum256(buf.Bytes())
+	return [2]uint64{binary.LittleEndian.Uint64(sum[:8]), binary.LittleEndian.Uint64(sum[8:16])}
+}
+
+// ShortID returns the BIP 152 short ID of the transaction txid in the
+// compact block of blockSipKeys: the 6 low bytes of the SipHash-2-4 of txid
+// keyed with them.
+func ShortID(txid chainhash.Hash, blockSipKeys [2]uint64) uint64 {
+	return sipHash24(blockSipKeys[0], blockSipKeys[1], txid[:]) & shortIDMask
+}
+
+// PrefilledTx is a transaction sent in full by a compact block.
+type PrefilledTx struct {
+	// Index is the index of the transaction in the block.
+	Index int
+	Tx    *wire.MsgTx
+}
+
+// CompactBlock is a BIP 152 compact block: the header of a block, the
+// transactions sent in full and the short IDs of the others, in the order of
+// the block.
+type CompactBlock struct {
+	Header    wire.BlockHeader
+	Nonce     uint64
+	ShortIDs  []uint64
+	Prefilled []PrefilledTx
+}
+
+// SipKeys returns the SipHash keys of the short IDs of cb.
+func (cb *CompactBlock) SipKeys() [2]uint64 {
+	return CompactBlockSipKeys(&cb.Header, cb.Nonce)
+}
+
+// TxCount returns the number of transactions of the block of cb.
+func (cb *CompactBlock) TxCount() int {
+	return len(cb.ShortIDs) + len(cb.Prefilled)
+}
+
+// BuildCompactBlock returns the compact block of block sent with nonce,
+// prefilling the coinbase and the transactions of the indexes prefilled, such
+// as those the receivers are unlikely to have.  Short IDs colliding in the
+// block fail with ErrShortIDCollision, as receivers would reject the compact
+// block: the block is to be sent in full, or with another nonce.
+func BuildCompactBlock(block *btcutil.Block, nonce uint64, prefilled []int) (*CompactBlock, error) {
+	txs := block.Transactions()
+	if len(txs) == 0 {
+		return nil, errors.New("block without transaction")
+	}
+	cb := &CompactBlock{Header: block.MsgBlock().Header, Nonce: nonce}
+	full := map[int]bool{0: true}
+	for _, i := range prefilled {
+		if i < 0 || i >= len(txs) {
+			return nil, fmt.Errorf("prefilled index %d of a block of %d transactions", i, len(txs))
+		}
+		full[i] = true
+	}
+	indexes := make([]int, 0, len(full))
+	for i := range full {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		cb.Prefilled = append(cb.Prefilled, PrefilledTx{Index: i, Tx: txs[i].MsgTx()})
+	}
+
+	keys := cb.SipKeys()
+	seen := make(map[uint64]int, len(txs)-len(full))
+	for i, tx := range txs {
+		if full[i] {
+			continue
+		}
+		id := ShortID(*tx.Hash(), keys)
+		if j, ok := seen[id]; ok {
+			return nil, fmt.Errorf("%w: transactions %d and %d have short ID %012x", ErrShortIDCollision, j, i,
+				id)
+		}
+		seen[id] = i
+		cb.ShortIDs = append(cb.ShortIDs, id)
+	}
+	return cb, nil
+}
+
+// ShortIDCollision is a short ID of a compact block matching several
+// transactions of the mempool.
+type ShortIDCollision struct {
+	// Slot is the index of the short ID, and TxIDs the transactions of the
+	// mempool it matches.
+	Slot    int
+	ShortID uint64
+	TxIDs   []chainhash.Hash
+}
+
+// ShortIDMatch is the reconciliation of the short IDs of a compact block with
+// a mempool.
+type ShortIDMatch struct {
+	// Txs are the transactions of the mempool matching each short ID, nil
+	// for those matching none or several, whose slots are Missing.
+	Txs     []*btcutil.Tx
+	Missing []int
+
+	// Collisions are the short IDs matching several transactions of the
+	// mempool, whose transactions must be requested as they cannot be told
+	// apart.
+	Collisions []ShortIDCollision
+}
+
+// MatchMempool matches the short IDs of a compact block of blockSipKeys with
+// the transactions of mempool, keyed by txid.  The slots of the short IDs
+// matching no transaction, or several, are missing: the slots of several are
+// reported as collisions rather than picking one of their transactions.
+// Short IDs repeated in the compact block fail with ErrShortIDCollision.
+func MatchMempool(shortIDs []uint64, blockSipKeys [2]uint64,
+	mempool map[chainhash.Hash]*btcutil.Tx) (*ShortIDMatch, error) {
+
+	return matchShortIDs(shortIDs, mempool, func(txid chainhash.Hash) uint64 {
+		return ShortID(txid, blockSipKeys)
+	})
+}
+
+// matchShortIDs matches shortIDs with mempool like MatchMempool, with the
+// short IDs of shortID.
+func matchShortIDs(shortIDs []uint64, mempool map[chainhash.Hash]*btcutil.Tx,
+	shortID func(chainhash.Hash) uint64) (*ShortIDMatch, error) {
+
+	slots := make(map[uint64]int, len(shortIDs))
+	for i, id := range shortIDs {
+		if j, ok := slots[id]; ok {
+			return nil, fmt.Errorf("%w: slots %d and %d have short ID %012x", ErrShortIDCollision, j, i, id)
+		}
+		slots[id] = i
+	}
+
+	m := &ShortIDMatch{Txs: make([]*btcutil.Tx, len(shortIDs))}
+	matches := make(map[int][]chainhash.Hash)
+	for txid, tx := range mempool {
+		if slot, ok := slots[shortID(txid)]; ok {
+			matches[slot] = append(matches[slot], txid)
+			m.Txs[slot] = tx
+		}
+	}
+	for slot := range shortIDs {
+		txids := matches[slot]
+		if len(txids) == 1 {
+			continue
+		}
+		m.Txs[slot] = nil
+		m.Missing = append(m.Missing, slot)
+		if len(txids) > 1 {
+			sort.Slice(txids, func(i, j int) bool { return compareTxIDs(&txids[i], &txids[j]) < 0 })
+			m.Collisions = append(m.Collisions, ShortIDCollision{Slot: slot, ShortID: shortIDs[slot],
+				TxIDs: txids})
+		}
+	}
+	return m, nil
+}
+
+// BlockMatch is the reconciliation of a compact block with a mempool.
+type BlockMatch struct {
+	// Txs are the transactions of the block, prefilled or found in the
+	// mempool, nil for those Missing, the indexes in the block to request
+	// with getblocktxn.
+	Txs     []*btcutil.Tx
+	Missing []int
+
+	// Collisions are those of the short IDs, whose slots are the indexes of
+	// the transactions in the block.
+	Collisions []ShortIDCollision
+}
+
+// MatchMempool matches the transactions of the block of cb with the
+// prefilled ones and mempool, keyed by txid, like MatchMempool.  Prefilled
+// indexes out of order or out of the block fail.
+func (cb *CompactBlock) MatchMempool(mempool map[chainhash.Hash]*btcutil.Tx) (*BlockMatch, error) {
+	m, err := MatchMempool(cb.ShortIDs, cb.SipKeys(), mempool)
+	if err != nil {
+		return nil, err
+	}
+	bm := &BlockMatch{Txs: make([]*btcutil.Tx, cb.TxCount())}
+	// blockIndex maps the slots of the short IDs to the indexes of the
+	// block, skipping the prefilled ones.
+	blockIndex := make([]int, 0, len(cb.ShortIDs))
+	prev := -1
+	for _, p := range cb.Prefilled {
+		if p.Index <= prev || p.Index >= len(bm.Txs) || p.Tx == nil {
+			return nil, fmt.Errorf("prefilled transaction at index %d of a block of %d", p.Index, len(bm.Txs))
+		}
+		for i := prev + 1; i < p.Index; i++ {
+			blockIndex = append(blockIndex, i)
+		}
+		bm.Txs[p.Index] = btcutil.NewTx(p.Tx)
+		prev = p.Index
+	}
+	for i := prev + 1; i < len(bm.Txs); i++ {
+		blockIndex = append(blockIndex, i)
+	}
+
+	for slot, tx := range m.Txs {
+		bm.Txs[blockIndex[slot]] = tx
+	}
+	for _, slot := range m.Missing {
+		bm.Missing = append(bm.Missing, blockIndex[slot])
+	}
+	for _, c := range m.Collisions {
+		c.Slot = blockIndex[c.Slot]
+		bm.Collisions = append(bm.Collisions, c)
+	}
+	return bm, nil
+}
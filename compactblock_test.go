@@ -0,0 +1,125 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestSipHash24(t *testing.T) {
+	// The vectors of the SipHash paper, keyed with the bytes 0 to 15 and
+	// hashing the bytes 0 to n-1.
+	const k0, k1 = 0x0706050403020100, 0x0f0e0d0c0b0a0908
+	msg := make([]byte, 15)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	tests := []struct {
+		n    int
+		want uint64
+	}{
+		{0, 0x726fdb47dd0e0e31},
+		{1, 0x74f839c593dc67fd},
+		{8, 0x93f5f5799a932462},
+		{15, 0xa129ca6149be45e5},
+	}
+	for _, test := range tests {
+		if got := sipHash24(k0, k1, msg[:test.n]); got != test.want {
+			t.Errorf("%d bytes: got %016x, want %016x", test.n, got, test.want)
+		}
+	}
+}
+
+// compactTestBlock returns a block of a coinbase and n transactions.
+func compactTestBlock(t *testing.T, n int) *btcutil.Block {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	coinbase, err := NewCoinbaseTx(CoinbaseSpec{Height: 1000, PkScript: pkScript}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{Nonce: 42})
+	msgBlock.AddTransaction(coinbase)
+	for i := 0; i < n; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{byte(i + 1)}}, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(1000, pkScript))
+		msgBlock.AddTransaction(tx)
+	}
+	return btcutil.NewBlock(msgBlock)
+}
+
+func TestCompactBlock(t *testing.T) {
+	block := compactTestBlock(t, 5)
+	txs := block.Transactions()
+	cb, err := BuildCompactBlock(block, 7, []int{3, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cb.Prefilled) != 2 || cb.Prefilled[0].Index != 0 || cb.Prefilled[1].Index != 3 ||
+		len(cb.ShortIDs) != 4 || cb.TxCount() != 6 {
+		t.Fatalf("prefilled %+v, %d short IDs", cb.Prefilled, len(cb.ShortIDs))
+	}
+	keys := CompactBlockSipKeys(&block.MsgBlock().Header, 7)
+	for slot, i := range []int{1, 2, 4, 5} {
+		if id := ShortID(*txs[i].Hash(), keys); cb.ShortIDs[slot] != id || id>>48 != 0 {
+			t.Errorf("slot %d: short ID %012x, want %012x", slot, cb.ShortIDs[slot], id)
+		}
+	}
+	if other := CompactBlockSipKeys(&block.MsgBlock().Header, 8); other == keys {
+		t.Error("nonce does not change the keys")
+	}
+
+	// The mempool has transactions 1 and 5, and other ones.
+	mempool := map[chainhash.Hash]*btcutil.Tx{*txs[1].Hash(): txs[1], *txs[5].Hash(): txs[5]}
+	for _, tx := range compactTestBlock(t, 20).Transactions()[6:] {
+		mempool[*tx.Hash()] = tx
+	}
+	m, err := cb.MatchMempool(mempool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tx := range m.Txs {
+		if found := i != 2 && i != 4; (tx != nil) != found || found && *tx.Hash() != *txs[i].Hash() {
+			t.Errorf("transaction %d: got %v", i, tx)
+		}
+	}
+	if len(m.Missing) != 2 || m.Missing[0] != 2 || m.Missing[1] != 4 || len(m.Collisions) != 0 {
+		t.Errorf("missing %v, collisions %+v", m.Missing, m.Collisions)
+	}
+
+	if _, err := BuildCompactBlock(block, 7, []int{6}); err == nil {
+		t.Error("prefilled a transaction out of the block")
+	}
+	cb.Prefilled[0], cb.Prefilled[1] = cb.Prefilled[1], cb.Prefilled[0]
+	if _, err := cb.MatchMempool(mempool); err == nil {
+		t.Error("matched prefilled transactions out of order")
+	}
+}
+
+func TestMatchMempoolCollisions(t *testing.T) {
+	txs := compactTestBlock(t, 3).Transactions()
+	// Finding txids of colliding 48 bit short IDs takes too long, so the
+	// short IDs are the first byte of the txids, of which a and b collide.
+	a, b, c := *txs[1].Hash(), *txs[2].Hash(), *txs[3].Hash()
+	a[0], b[0], c[0] = 1, 1, 2
+	mempool := map[chainhash.Hash]*btcutil.Tx{a: txs[1], b: txs[2], c: txs[3]}
+	shortID := func(txid chainhash.Hash) uint64 { return uint64(txid[0]) }
+	m, err := matchShortIDs([]uint64{1, 2}, mempool, shortID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Txs[0] != nil || m.Txs[1] != txs[3] || len(m.Missing) != 1 || m.Missing[0] != 0 {
+		t.Errorf("transactions %v, missing %v", m.Txs, m.Missing)
+	}
+	if len(m.Collisions) != 1 || m.Collisions[0].Slot != 0 || len(m.Collisions[0].TxIDs) != 2 {
+		t.Errorf("collisions %+v", m.Collisions)
+	}
+
+	var keys [2]uint64
+	if _, err := MatchMempool([]uint64{1, 2, 1}, keys, nil); !errors.Is(err, ErrShortIDCollision) {
+		t.Errorf("repeated short IDs: %v, want ErrShortIDCollision", err)
+	}
+}
@@ -0,0 +1,193 @@
+package bchutil
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// InputState is the signing state of a transaction input.
+type InputState int
+
+const (
+	// InputEmpty is the state of inputs without scriptSig.
+	InputEmpty InputState = iota
+
+	// InputPartial is the state of multisig inputs with fewer valid
+	// signatures than required.
+	InputPartial
+
+	// InputComplete is the state of inputs whose scriptSig satisfies the
+	// script of their previous output.
+	InputComplete
+
+	// InputInvalid is the state of inputs with a scriptSig that fails for
+	// another reason than missing signatures.
+	InputInvalid
+)
+
+// String returns the name of the state.
+func (s InputState) String() string {
+	switch s {
+	case InputEmpty:
+		return "empty"
+	case InputPartial:
+		return "partial"
+	case InputComplete:
+		return "complete"
+	case InputInvalid:
+		return "invalid"
+	}
+	return fmt.Sprintf("InputState(%d)", int(s))
+}
+
+// InputStatus describes the signing state of an input.
+type InputStatus struct {
+	Index int
+	State InputState
+
+	// Class is the class of the script of the previous output, as returned
+	// by GetScriptClass.
+	Class txscript.ScriptClass
+
+	// RedeemScript is the redeem script of pay-to-script-hash inputs,
+	// when the scriptSig includes it.
+	RedeemScript []byte
+
+	// Required is the number of signatures required by multisig scripts,
+	// Collected the number of valid signatures in the scriptSig and
+	// SignedPubKeys the public keys they were made with.
+	Required      int
+	Collected     int
+	SignedPubKeys [][]byte
+
+	// Err is the script error of incomplete inputs.
+	Err error
+}
+
+// IsComplete returns whether all inputs of tx satisfy the scripts of the
+// outputs they spend, held by prevOuts, along with the status of every input.
+// Scripts are executed with StandardScriptFlags.
+func IsComplete(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut) (bool, []InputStatus) {
+	sigHashes := txscript.NewTxSigHashes(tx)
+	complete := true
+	statuses := make([]InputStatus, len(tx.TxIn))
+	for i := range tx.TxIn {
+		statuses[i] = inputStatus(tx, i, prevOuts[i], sigHashes)
+		if statuses[i].State != InputComplete {
+			complete = false
+		}
+	}
+	return complete, statuses
+}
+
+// inputStatus returns the status of input idx of tx spending prevOut.
+func inputStatus(tx *wire.MsgTx, idx int, prevOut *wire.TxOut, sigHashes *txscript.TxSigHashes) InputStatus {
+	status := InputStatus{Index: idx, Class: txscript.NonStandardTy}
+	if prevOut == nil {
+		status.State = InputInvalid
+		status.Err = fmt.Errorf("no previous output for input %d", idx)
+		return status
+	}
+	token, pkScript, err := SplitTokenPrefix(prevOut.PkScript)
+	if err != nil {
+		status.State = InputInvalid
+		status.Err = err
+		return status
+	}
+	var tokenPrefix []byte
+	if token != nil {
+		tokenPrefix = token.Bytes()
+	}
+	status.Class = GetScriptClass(pkScript)
+	scriptSig := tx.TxIn[idx].SignatureScript
+	if len(scriptSig) == 0 {
+		status.State = InputEmpty
+		return status
+	}
+
+	ops, err := parseScript(scriptSig)
+	if err != nil {
+		status.State = InputInvalid
+		status.Err = err
+		return status
+	}
+	script := pkScript
+	pushes := ops
+	if status.Class == txscript.ScriptHashTy && len(ops) != 0 && isPushOnly(ops) {
+		status.RedeemScript = ops[len(ops)-1].data
+		script = status.RedeemScript
+		pushes = ops[:len(ops)-1]
+	}
+	if pubKeys, required, ok := multisigPubKeys(script); ok {
+		status.Required = required
+		status.SignedPubKeys = signedPubKeys(tx, idx, prevOut.Value, tokenPrefix, script, pushes, pubKeys,
+			sigHashes)
+		status.Collected = len(status.SignedPubKeys)
+	}
+
+	vm, err := NewEngine(prevOut.PkScript, tx, idx, StandardScriptFlags, sigHashes, prevOut.Value)
+	if err == nil {
+		err = vm.Execute()
+	}
+	switch {
+	case err == nil:
+		status.State = InputComplete
+	case status.Collected < status.Required:
+		status.State = InputPartial
+		status.Err = err
+	default:
+		status.State = InputInvalid
+		status.Err = err
+	}
+	return status
+}
+
+// multisigPubKeys returns the public keys and the number of required
+// signatures of a multisig script.
+func multisigPubKeys(script []byte) ([][]byte, int, bool) {
+	if txscript.GetScriptClass(script) != txscript.MultiSigTy {
+		return nil, 0, false
+	}
+	ops, err := parseScript(script)
+	if err != nil {
+		return nil, 0, false
+	}
+	var pubKeys [][]byte
+	for _, op := range ops[1 : len(ops)-2] {
+		pubKeys = append(pubKeys, op.data)
+	}
+	return pubKeys, int(ops[0].value-txscript.OP_1) + 1, true
+}
+
+// signedPubKeys returns the keys of pubKeys with a valid signature among the
+// pushes of a scriptSig, whatever their order, of an input spending an output
+// of tokenPrefix, nil if none.
+func signedPubKeys(tx *wire.MsgTx, idx int, amount int64, tokenPrefix, script []byte, pushes []parsedOpcode,
+	pubKeys [][]byte, sigHashes *txscript.TxSigHashes) [][]byte {
+
+	var signed [][]byte
+	for _, pubKey := range pubKeys {
+		if _, err := btcec.ParsePubKey(pubKey, btcec.S256()); err != nil {
+			continue
+		}
+		for _, op := range pushes {
+			sig := op.data
+			if len(sig) == 0 {
+				continue
+			}
+			hashType := txscript.SigHashType(sig[len(sig)-1])
+			if hashType&SigHashForkID == 0 || checkSigHashType(hashType) != nil {
+				continue
+			}
+			hash := calcSignatureHash(script, sigHashes, hashType, tx, idx, amount, 0, tokenPrefix)
+			if verifySignature(sig[:len(sig)-1], pubKey, hash, true) {
+				signed = append(signed, pubKey)
+				break
+			}
+		}
+	}
+	return signed
+}
@@ -0,0 +1,139 @@
+package bchutil
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestIsComplete(t *testing.T) {
+	keys := signingTestKeys()
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_2)
+	for _, key := range keys {
+		builder.AddData(key.PubKey().SerializeCompressed())
+	}
+	redeemScript, _ := builder.AddOp(txscript.OP_2).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	p2sh, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(keys[0].PubKey().SerializeCompressed()))
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	prevOuts := make(map[int]*wire.TxOut)
+	for i := 0; i < 3; i++ {
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(i + 1)}, 0), nil, nil))
+	}
+	prevOuts[0] = wire.NewTxOut(1000, p2pkh)
+	prevOuts[1] = wire.NewTxOut(2000, p2sh)
+	tx.AddTxOut(wire.NewTxOut(2500, p2pkh))
+
+	complete, statuses := IsComplete(tx, prevOuts)
+	if complete {
+		t.Fatal("unsigned transaction is complete")
+	}
+	for i, want := range []InputState{InputEmpty, InputEmpty, InputInvalid} {
+		if statuses[i].State != want {
+			t.Errorf("input %d: got state %v, want %v", i, statuses[i].State, want)
+		}
+	}
+
+	prevOuts[2] = wire.NewTxOut(3000, p2sh)
+	var err error
+	tx.TxIn[0].SignatureScript, err = SignatureScript(tx, 0, p2pkh, txscript.SigHashAll|SigHashForkID,
+		keys[0], true, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multisig := func(idx int, amt int64, keys ...*btcec.PrivateKey) []byte {
+		builder := txscript.NewScriptBuilder().AddOp(txscript.OP_0)
+		for _, key := range keys {
+			sig, err := RawTxInSignature(tx, idx, redeemScript, txscript.SigHashAll, key, amt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			builder.AddData(sig)
+		}
+		scriptSig, _ := builder.AddData(redeemScript).Script()
+		return scriptSig
+	}
+	tx.TxIn[1].SignatureScript = multisig(1, 2000, keys[1])
+	tx.TxIn[2].SignatureScript = multisig(2, 3000, keys...)
+
+	complete, statuses = IsComplete(tx, prevOuts)
+	if complete {
+		t.Fatal("partially signed transaction is complete")
+	}
+	for i, want := range []InputState{InputComplete, InputPartial, InputComplete} {
+		if statuses[i].State != want {
+			t.Errorf("input %d: got state %v, want %v (%v)", i, statuses[i].State, want, statuses[i].Err)
+		}
+	}
+	partial := statuses[1]
+	if partial.Class != txscript.ScriptHashTy || !bytes.Equal(partial.RedeemScript, redeemScript) {
+		t.Errorf("got class %v and redeem script %x", partial.Class, partial.RedeemScript)
+	}
+	if partial.Required != 2 || partial.Collected != 1 ||
+		!bytes.Equal(partial.SignedPubKeys[0], keys[1].PubKey().SerializeCompressed()) {
+		t.Errorf("got %d of %d signatures from %x", partial.Collected, partial.Required, partial.SignedPubKeys)
+	}
+
+	tx.TxIn[1].SignatureScript = multisig(1, 2000, keys...)
+	if complete, statuses = IsComplete(tx, prevOuts); !complete {
+		t.Fatalf("signed transaction is not complete: %+v", statuses)
+	}
+
+	// Signatures in the wrong order are all valid but fail the script.
+	tx.TxIn[1].SignatureScript = multisig(1, 2000, keys[1], keys[0])
+	if _, statuses = IsComplete(tx, prevOuts); statuses[1].State != InputInvalid ||
+		statuses[1].Collected != 2 {
+		t.Errorf("got %+v for signatures in the wrong order", statuses[1])
+	}
+}
+
+// TestIsCompleteTokenInputs checks inputs spending token outputs, locked by a
+// pay-to-pubkey-hash script and a 32 byte pay-to-script-hash multisig one.
+func TestIsCompleteTokenInputs(t *testing.T) {
+	keys := signingTestKeys()
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_2)
+	for _, key := range keys {
+		builder.AddData(key.PubKey().SerializeCompressed())
+	}
+	redeemScript, _ := builder.AddOp(txscript.OP_2).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	p2sh32, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_HASH256).
+		AddData(chainhash.DoubleHashB(redeemScript)).AddOp(txscript.OP_EQUAL).Script()
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(keys[0].PubKey().SerializeCompressed()))
+	token := &TokenData{Category: chainhash.Hash{5}, Amount: 10}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{2}, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(2500, append(token.Bytes(), p2pkh...)))
+	prevOuts := map[int]*wire.TxOut{
+		0: wire.NewTxOut(1000, append(token.Bytes(), p2pkh...)),
+		1: wire.NewTxOut(2000, append(token.Bytes(), p2sh32...)),
+	}
+	var err error
+	tx.TxIn[0].SignatureScript, err = SignatureScript(tx, 0, p2pkh, SigHashAllForkID, keys[0], true, 1000,
+		WithTokenPrevout(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := RawTxInSignature(tx, 1, redeemScript, SigHashAllForkID, keys[1], 2000, WithTokenPrevout(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TxIn[1].SignatureScript, _ = txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(sig).
+		AddData(redeemScript).Script()
+
+	_, statuses := IsComplete(tx, prevOuts)
+	if s := statuses[0]; s.State != InputComplete || s.Class != txscript.PubKeyHashTy {
+		t.Errorf("got %+v for the pay-to-pubkey-hash input", s)
+	}
+	if s := statuses[1]; s.State != InputPartial || s.Class != txscript.ScriptHashTy || s.Collected != 1 ||
+		s.Required != 2 || !bytes.Equal(s.RedeemScript, redeemScript) {
+		t.Errorf("got %+v for the multisig input", s)
+	}
+}
@@ -0,0 +1,189 @@
+package bchutil
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// FindConflicts returns the outpoints spent by both a and b, in the order of
+// the inputs of a.  A transaction does not conflict with itself.
+func FindConflicts(a, b *wire.MsgTx) []wire.OutPoint {
+	if a.TxHash() == b.TxHash() {
+		return nil
+	}
+	spent := make(map[wire.OutPoint]bool, len(b.TxIn))
+	for _, txIn := range b.TxIn {
+		spent[txIn.PreviousOutPoint] = true
+	}
+	var conflicts []wire.OutPoint
+	for _, txIn := range a.TxIn {
+		if spent[txIn.PreviousOutPoint] {
+			conflicts = append(conflicts, txIn.PreviousOutPoint)
+		}
+	}
+	return conflicts
+}
+
+// DoubleSpend is a transaction spending outputs that one seen before spends.
+type DoubleSpend struct {
+	// First is the transaction seen first spending OutPoints, which
+	// Respend spends too.
+	First     chainhash.Hash
+	Respend   chainhash.Hash
+	OutPoints []wire.OutPoint
+
+	// FeesKnown is set when the outputs spent by both transactions are
+	// known, with their fees and fee rates.
+	FeesKnown      bool
+	FirstFee       btcutil.Amount
+	RespendFee     btcutil.Amount
+	FirstFeeRate   FeeRate
+	RespendFeeRate FeeRate
+}
+
+// conflictEntry is a transaction of a ConflictIndex.
+type conflictEntry struct {
+	txid      chainhash.Hash
+	outPoints []wire.OutPoint
+	fee       btcutil.Amount
+	feeRate   FeeRate
+	feeKnown  bool
+}
+
+// ConflictIndex indexes the outpoints spent by a stream of transactions,
+// such as those of a mempool, to report the transactions double-spending
+// those seen before.  It holds the latest transactions, up to a bound, so
+// that its memory is bounded by the inputs of these transactions.  It is safe
+// for concurrent use.
+type ConflictIndex struct {
+	mu      sync.Mutex
+	maxTxs  int
+	fetcher PrevOutputFetcher
+
+	// spenders maps the outpoints to the entries of the transactions
+	// spending them, oldest first, txs the txids to their entry, and order
+	// holds the entries, oldest first.
+	spenders map[wire.OutPoint][]*list.Element
+	txs      map[chainhash.Hash]*list.Element
+	order    *list.List
+}
+
+// NewConflictIndex returns an index of at most maxTxs transactions, at least
+// one, computing their fees with the outputs of fetcher when not nil.
+func NewConflictIndex(maxTxs int, fetcher PrevOutputFetcher) *ConflictIndex {
+	if maxTxs < 1 {
+		maxTxs = 1
+	}
+	return &ConflictIndex{
+		maxTxs:   maxTxs,
+		fetcher:  fetcher,
+		spenders: make(map[wire.OutPoint][]*list.Element),
+		txs:      make(map[chainhash.Hash]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// newEntry returns the entry of tx, with its fee if the outputs it spends
+// are known.
+func (c *ConflictIndex) newEntry(tx *wire.MsgTx) *conflictEntry {
+	e := &conflictEntry{txid: tx.TxHash()}
+	prevOuts := make(map[int]*wire.TxOut, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		e.outPoints = append(e.outPoints, txIn.PreviousOutPoint)
+		if c.fetcher != nil {
+			prevOuts[i] = c.fetcher.FetchPrevOutput(txIn.PreviousOutPoint)
+		}
+	}
+	if in, out, err := txValues(tx, prevOuts); err == nil {
+		e.fee, e.feeRate, e.feeKnown = in-out, TxFeeRate(in-out, tx.SerializeSize()), true
+	}
+	return e
+}
+
+// Add indexes tx and returns the double spends it makes of the transactions
+// indexed, one per transaction whose outpoints it spends, in the order of
+// its inputs.  Respends are reported against the first transaction indexed
+// spending the outpoint, the oldest of those still indexed.  Adding a
+// transaction already indexed does nothing.  The oldest transactions are
+// dropped once the index holds its maximum.
+func (c *ConflictIndex) Add(tx *wire.MsgTx) []*DoubleSpend {
+	e := c.newEntry(tx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.txs[e.txid]; ok {
+		return nil
+	}
+
+	var doubleSpends []*DoubleSpend
+	byFirst := make(map[chainhash.Hash]*DoubleSpend)
+	for _, op := range e.outPoints {
+		spenders := c.spenders[op]
+		if len(spenders) == 0 {
+			continue
+		}
+		first := spenders[0].Value.(*conflictEntry)
+		ds := byFirst[first.txid]
+		if ds == nil {
+			ds = &DoubleSpend{First: first.txid, Respend: e.txid, FeesKnown: first.feeKnown && e.feeKnown}
+			if ds.FeesKnown {
+				ds.FirstFee, ds.FirstFeeRate = first.fee, first.feeRate
+				ds.RespendFee, ds.RespendFeeRate = e.fee, e.feeRate
+			}
+			byFirst[first.txid] = ds
+			doubleSpends = append(doubleSpends, ds)
+		}
+		ds.OutPoints = append(ds.OutPoints, op)
+	}
+
+	elem := c.order.PushBack(e)
+	c.txs[e.txid] = elem
+	for _, op := range e.outPoints {
+		c.spenders[op] = append(c.spenders[op], elem)
+	}
+	for c.order.Len() > c.maxTxs {
+		c.remove(c.order.Front())
+	}
+	return doubleSpends
+}
+
+// Remove drops the transaction txid from the index, such as once it is
+// mined, and returns whether it was indexed.
+func (c *ConflictIndex) Remove(txid *chainhash.Hash) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.txs[*txid]
+	if ok {
+		c.remove(elem)
+	}
+	return ok
+}
+
+// remove drops the entry of elem.  It must be called with the lock held.
+func (c *ConflictIndex) remove(elem *list.Element) {
+	e := c.order.Remove(elem).(*conflictEntry)
+	delete(c.txs, e.txid)
+	for _, op := range e.outPoints {
+		spenders := c.spenders[op][:0]
+		for _, spender := range c.spenders[op] {
+			if spender != elem {
+				spenders = append(spenders, spender)
+			}
+		}
+		if len(spenders) == 0 {
+			delete(c.spenders, op)
+		} else {
+			c.spenders[op] = spenders
+		}
+	}
+}
+
+// Len returns the number of transactions indexed.
+func (c *ConflictIndex) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
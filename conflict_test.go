@@ -0,0 +1,95 @@
+package bchutil
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// conflictTestTx returns a transaction spending ops and paying value.
+func conflictTestTx(value int64, ops ...wire.OutPoint) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for i := range ops {
+		tx.AddTxIn(wire.NewTxIn(&ops[i], nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(value, []byte{0x51}))
+	return tx
+}
+
+func TestFindConflicts(t *testing.T) {
+	op1, op2, op3 := wire.OutPoint{Hash: chainhash.Hash{1}}, wire.OutPoint{Hash: chainhash.Hash{2}},
+		wire.OutPoint{Hash: chainhash.Hash{3}}
+	a := conflictTestTx(1000, op1, op2, op3)
+	b := conflictTestTx(900, op3, op1)
+	conflicts := FindConflicts(a, b)
+	if len(conflicts) != 2 || conflicts[0] != op1 || conflicts[1] != op3 {
+		t.Errorf("conflicts %v", conflicts)
+	}
+	if conflicts := FindConflicts(a, a); conflicts != nil {
+		t.Errorf("transaction conflicts with itself: %v", conflicts)
+	}
+	if conflicts := FindConflicts(a, conflictTestTx(1000, wire.OutPoint{Hash: chainhash.Hash{4}})); conflicts != nil {
+		t.Errorf("conflicts %v", conflicts)
+	}
+}
+
+func TestConflictIndex(t *testing.T) {
+	op := func(b byte) wire.OutPoint { return wire.OutPoint{Hash: chainhash.Hash{b}} }
+	fetcher := testPrevOutputFetcher{op(1): wire.NewTxOut(10000, nil), op(2): wire.NewTxOut(10000, nil)}
+	c := NewConflictIndex(3, fetcher)
+
+	first := conflictTestTx(9000, op(1))
+	if ds := c.Add(first); ds != nil {
+		t.Fatalf("double spends %v", ds)
+	}
+	if ds := c.Add(first); ds != nil || c.Len() != 1 {
+		t.Fatalf("added again: %v, %d transactions", ds, c.Len())
+	}
+	other := conflictTestTx(9000, op(2), op(3))
+	c.Add(other)
+
+	// The respend pays a higher fee for both outputs.
+	respend := conflictTestTx(5000, op(1), op(2))
+	ds := c.Add(respend)
+	if len(ds) != 2 {
+		t.Fatalf("%d double spends", len(ds))
+	}
+	if ds[0].First != first.TxHash() || ds[0].Respend != respend.TxHash() || len(ds[0].OutPoints) != 1 ||
+		ds[0].OutPoints[0] != op(1) || ds[1].First != other.TxHash() || ds[1].OutPoints[0] != op(2) {
+		t.Errorf("double spends %+v, %+v", ds[0], ds[1])
+	}
+	if !ds[0].FeesKnown || ds[0].FirstFee != 1000 || ds[0].RespendFee != 15000 ||
+		ds[0].RespendFeeRate != TxFeeRate(15000, respend.SerializeSize()) {
+		t.Errorf("fees %+v", ds[0])
+	}
+	// The outputs of op(3) are unknown.
+	if ds[1].FeesKnown || ds[1].FirstFee != 0 {
+		t.Errorf("fees of unknown outputs %+v", ds[1])
+	}
+
+	// Respends are reported against the first spender.
+	if ds := c.Add(conflictTestTx(1000, op(1))); len(ds) != 1 || ds[0].First != first.TxHash() {
+		t.Errorf("double spends %+v", ds)
+	}
+
+	// The index holds the last 3 transactions: first was dropped.
+	if c.Len() != 3 {
+		t.Errorf("%d transactions", c.Len())
+	}
+	firstHash := first.TxHash()
+	if c.Remove(&firstHash) {
+		t.Error("first still indexed")
+	}
+	respendHash := respend.TxHash()
+	if !c.Remove(&respendHash) || c.Len() != 2 {
+		t.Errorf("respend not removed, %d transactions", c.Len())
+	}
+	// The last respend of op(1) is the only one left spending it.
+	if ds := c.Add(conflictTestTx(2000, op(1))); len(ds) != 1 || ds[0].FirstFee != 9000 {
+		t.Errorf("double spends %+v", ds)
+	}
+	if ds := c.Add(conflictTestTx(3000, op(5))); ds != nil {
+		t.Errorf("double spends %+v", ds)
+	}
+}
@@ -0,0 +1,94 @@
+package bchutil
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// BuildConsolidation returns the transactions spending utxos to dest at
+// feeRate, each paying the value of its inputs less its fee in its only
+// output.  Outputs worth less than minProfit once the fee of their input is
+// paid, as computed by EffectiveValue, are left unspent, with the outputs
+// carrying tokens and immature coinbase outputs.  The others are spent in
+// order, as many per transaction as fit MaxStandardTxSize and at most
+// maxInputsPerTx when positive.  Transactions whose output would be dust are
+// left out, and ErrInsufficientFunds is returned when no transaction is left.
+// The transactions are signed with SignAll.
+func BuildConsolidation(utxos []UTXO, dest btcutil.Address, feeRate FeeRate, maxInputsPerTx int,
+	minProfit btcutil.Amount) ([]*UnsignedTx, error) {
+
+	destScript, err := PayToAddrScript(dest)
+	if err != nil {
+		return nil, err
+	}
+	var spent []UTXO
+	for _, u := range utxos {
+		if u.HasTokens() || !(SpendPolicy{}).IsSpendable(u) {
+			continue
+		}
+		if value := EffectiveValue(u, feeRate); value > 0 && value >= minProfit {
+			spent = append(spent, u)
+		}
+	}
+
+	var txs []*UnsignedTx
+	for len(spent) != 0 {
+		u, n, err := buildConsolidationTx(spent, destScript, feeRate, maxInputsPerTx)
+		if err != nil {
+			return nil, err
+		}
+		spent = spent[n:]
+		if !IsDust(u.Tx.TxOut[0]) {
+			txs = append(txs, u)
+		}
+	}
+	if len(txs) == 0 {
+		return nil, fmt.Errorf("%w: no output worth consolidating", ErrInsufficientFunds)
+	}
+	return txs, nil
+}
+
+// buildConsolidationTx returns the transaction spending the first outputs of
+// utxos to destScript, as many as maxInputs and the standard size allow, and
+// the number of outputs it spends.
+func buildConsolidationTx(utxos []UTXO, destScript []byte, feeRate FeeRate,
+	maxInputs int) (*UnsignedTx, int, error) {
+
+	u := NewUnsignedTx()
+	u.Recipients = []int{0}
+	txOut, err := NewTxOut(0, destScript)
+	if err != nil {
+		return nil, 0, err
+	}
+	u.Tx.AddTxOut(txOut)
+	u.Size = u.Tx.SerializeSize()
+	var total btcutil.Amount
+	for _, utxo := range utxos {
+		if maxInputs > 0 && len(u.Tx.TxIn) == maxInputs {
+			break
+		}
+		// The effective value of the outputs is known, so is the size
+		// of their scriptSig.
+		scriptSigSize, _ := EstimateScriptSigSize(utxo.PkScript)
+		size := u.Size + EstimateInputSize(scriptSigSize) +
+			wire.VarIntSerializeSize(uint64(len(u.Tx.TxIn)+1)) - wire.VarIntSerializeSize(uint64(len(u.Tx.TxIn)))
+		if size > MaxStandardTxSize {
+			break
+		}
+		if total, err = AddChecked(total, utxo.Amount); err != nil {
+			return nil, 0, err
+		}
+		if _, err := AddInputFromUTXO(u, utxo); err != nil {
+			return nil, 0, err
+		}
+		u.Size = size
+	}
+	if len(u.Tx.TxIn) == 0 {
+		return nil, 0, fmt.Errorf("output %v does not fit a standard transaction", utxos[0].OutPoint)
+	}
+	u.Fee = feeRate.Fee(u.Size)
+	txOut.Value = int64(total - u.Fee)
+	return u, len(u.Tx.TxIn), nil
+}
@@ -0,0 +1,95 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestBuildConsolidation(t *testing.T) {
+	key := signingTestKeys()[0]
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	dest, err := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var utxos []UTXO
+	for i := 0; i < 25; i++ {
+		utxos = append(utxos, UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(i)}}, Amount: 1500,
+			PkScript: pkScript})
+	}
+	// Inputs cost 148 satoshis at 1 sat/B.
+	utxos = append(utxos,
+		UTXO{OutPoint: wire.OutPoint{Index: 1}, Amount: 148, PkScript: pkScript},
+		UTXO{OutPoint: wire.OutPoint{Index: 2}, Amount: 300, PkScript: pkScript},
+		UTXO{OutPoint: wire.OutPoint{Index: 3}, Amount: 5000, PkScript: pkScript,
+			TokenData: (&TokenData{Category: chainhash.Hash{1}, Amount: 1}).Bytes()},
+		UTXO{OutPoint: wire.OutPoint{Index: 4}, Amount: 5000, PkScript: pkScript, Coinbase: true,
+			Confirmations: CoinbaseMaturity - 1},
+		UTXO{OutPoint: wire.OutPoint{Index: 5}, Amount: 1500, PkScript: pkScript, Coinbase: true,
+			Confirmations: CoinbaseMaturity},
+	)
+
+	txs, err := BuildConsolidation(utxos, dest, 1000, 10, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 3 {
+		t.Fatalf("got %d transactions, want 3", len(txs))
+	}
+	spent := 0
+	for i, u := range txs {
+		if len(u.Tx.TxOut) != 1 || u.ChangeIndex != -1 {
+			t.Fatalf("transaction %d: %d outputs, change %d", i, len(u.Tx.TxOut), u.ChangeIndex)
+		}
+		var total btcutil.Amount
+		for j, txIn := range u.Tx.TxIn {
+			if txIn.PreviousOutPoint.Index == 1 || txIn.PreviousOutPoint.Index == 3 ||
+				txIn.PreviousOutPoint.Index == 4 {
+				t.Fatalf("transaction %d spends %v", i, txIn.PreviousOutPoint)
+			}
+			total += btcutil.Amount(u.PrevOuts[j].Value)
+		}
+		if got := btcutil.Amount(u.Tx.TxOut[0].Value) + u.Fee; got != total {
+			t.Errorf("transaction %d pays %v with its fee, spends %v", i, got, total)
+		}
+		spent += len(u.Tx.TxIn)
+	}
+	if len(txs[0].Tx.TxIn) != 10 || spent != 25+1 {
+		t.Fatalf("%d inputs in the first transaction, %d spent", len(txs[0].Tx.TxIn), spent)
+	}
+
+	err = SignAll(txs, &chaincfg.MainNetParams, txscript.KeyClosure(
+		func(btcutil.Address) (*btcec.PrivateKey, bool, error) {
+			return key, true, nil
+		}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range txs {
+		if size := u.Tx.SerializeSize(); size > u.Size || FeeRate(1000).Fee(size) > u.Fee {
+			t.Errorf("signed size %d, estimated %d for a fee of %v", size, u.Size, u.Fee)
+		}
+		for i := range u.Tx.TxIn {
+			vm, _ := NewEngine(pkScript, u.Tx, i, StandardScriptFlags, nil, u.PrevOuts[i].Value)
+			if err := vm.Execute(); err != nil {
+				t.Fatalf("input %d: %v", i, err)
+			}
+		}
+	}
+
+	// Unlimited inputs fit in one transaction.
+	if txs, err := BuildConsolidation(utxos, dest, 1000, 0, 0); err != nil || len(txs) != 1 ||
+		len(txs[0].Tx.TxIn) != 27 {
+		t.Fatalf("got %d transactions, %v", len(txs), err)
+	}
+	if _, err := BuildConsolidation(utxos, dest, 20000, 0, 0); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("got %v, want ErrInsufficientFunds", err)
+	}
+}
@@ -0,0 +1,80 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// ErrDuplicateInput describes an error where a transaction spends an output
+// twice.
+var ErrDuplicateInput = errors.New("output spent twice")
+
+// NewTxIn returns an input spending outPoint with sequence and no scriptSig.
+// wire.MaxTxInSequenceNum makes the input final, disabling the lock time of
+// the transaction unless another input is not final.
+func NewTxIn(outPoint wire.OutPoint, sequence uint32) *wire.TxIn {
+	return &wire.TxIn{PreviousOutPoint: outPoint, Sequence: sequence}
+}
+
+// NewTxOut returns an output paying amount to pkScript, which may start with a
+// token prefix.  Amounts out of range fail with an error wrapping
+// ErrInvalidAmount, and scripts larger than MaxScriptSize, the token prefix
+// aside, with ErrScriptLimit.
+func NewTxOut(amount btcutil.Amount, pkScript []byte) (*wire.TxOut, error) {
+	if err := CheckAmount(amount); err != nil {
+		return nil, err
+	}
+	_, script, err := SplitTokenPrefix(pkScript)
+	if err != nil {
+		return nil, err
+	}
+	if len(script) > MaxScriptSize {
+		return nil, fmt.Errorf("%w: %d byte output script", ErrScriptLimit, len(script))
+	}
+	return wire.NewTxOut(int64(amount), pkScript), nil
+}
+
+// NewTxOutToAddress returns the output paying amount to addr, checked like
+// NewTxOut.
+func NewTxOutToAddress(amount btcutil.Amount, addr btcutil.Address) (*wire.TxOut, error) {
+	pkScript, err := PayToAddrScript(addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewTxOut(amount, pkScript)
+}
+
+// NewUnsignedTx returns an UnsignedTx of an empty transaction, without
+// change, to add inputs to with AddInputFromUTXO.
+func NewUnsignedTx() *UnsignedTx {
+	return &UnsignedTx{
+		Tx:          wire.NewMsgTx(wire.TxVersion),
+		PrevOuts:    make(map[int]*wire.TxOut),
+		ChangeIndex: -1,
+	}
+}
+
+// AddInputFromUTXO appends a final input spending utxo to the transaction of
+// u and records the output it spends in u.PrevOuts, for signing and fee
+// computations, and returns the index of the input.  Outputs already spent by
+// the transaction fail with ErrDuplicateInput.
+func AddInputFromUTXO(u *UnsignedTx, utxo UTXO) (int, error) {
+	if err := CheckAmount(utxo.Amount); err != nil {
+		return 0, fmt.Errorf("output %v: %w", utxo.OutPoint, err)
+	}
+	for _, txIn := range u.Tx.TxIn {
+		if txIn.PreviousOutPoint == utxo.OutPoint {
+			return 0, fmt.Errorf("%w: %v", ErrDuplicateInput, utxo.OutPoint)
+		}
+	}
+	if u.PrevOuts == nil {
+		u.PrevOuts = make(map[int]*wire.TxOut)
+	}
+	idx := len(u.Tx.TxIn)
+	u.Tx.AddTxIn(NewTxIn(utxo.OutPoint, wire.MaxTxInSequenceNum))
+	u.PrevOuts[idx] = utxo.TxOut()
+	return idx, nil
+}
@@ -0,0 +1,85 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestNewTxOut(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	txOut, err := NewTxOut(1000, pkScript)
+	if err != nil || txOut.Value != 1000 || !bytes.Equal(txOut.PkScript, pkScript) {
+		t.Fatalf("got %+v, %v", txOut, err)
+	}
+	for _, amount := range []btcutil.Amount{-1, btcutil.MaxSatoshi + 1} {
+		if _, err := NewTxOut(amount, pkScript); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("%d satoshis: got %v, want ErrInvalidAmount", int64(amount), err)
+		}
+	}
+	if _, err := NewTxOut(0, make([]byte, MaxScriptSize+1)); !errors.Is(err, ErrScriptLimit) {
+		t.Errorf("got %v, want ErrScriptLimit", err)
+	}
+	// The token prefix is not part of the script.
+	prefix := (&TokenData{Category: chainhash.Hash{1}, Amount: 1}).Bytes()
+	if _, err := NewTxOut(1000, append(prefix, make([]byte, MaxScriptSize)...)); err != nil {
+		t.Error(err)
+	}
+
+	addr, _ := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.MainNetParams)
+	txOut, err = NewTxOutToAddress(1000, addr)
+	if err != nil || !bytes.Equal(txOut.PkScript, pkScript) {
+		t.Fatalf("got %+v, %v", txOut, err)
+	}
+}
+
+func TestAddInputFromUTXO(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	u := NewUnsignedTx()
+	utxos := []UTXO{
+		{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 1000, PkScript: pkScript},
+		{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}, Index: 1}, Amount: 2000, PkScript: pkScript,
+			TokenData: (&TokenData{Category: chainhash.Hash{1}, Amount: 1}).Bytes()},
+	}
+	for i, utxo := range utxos {
+		idx, err := AddInputFromUTXO(u, utxo)
+		if err != nil || idx != i {
+			t.Fatalf("got input %d, %v", idx, err)
+		}
+		txIn := u.Tx.TxIn[idx]
+		if txIn.PreviousOutPoint != utxo.OutPoint || txIn.Sequence != wire.MaxTxInSequenceNum ||
+			u.PrevOuts[idx].Value != int64(utxo.Amount) ||
+			!bytes.Equal(u.PrevOuts[idx].PkScript, utxo.TxOut().PkScript) {
+			t.Fatalf("input %d: %+v spending %+v", idx, txIn, u.PrevOuts[idx])
+		}
+	}
+	if _, err := AddInputFromUTXO(u, utxos[0]); !errors.Is(err, ErrDuplicateInput) {
+		t.Errorf("got %v, want ErrDuplicateInput", err)
+	}
+	if _, err := AddInputFromUTXO(u, UTXO{Amount: -1}); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("got %v, want ErrInvalidAmount", err)
+	}
+	if len(u.Tx.TxIn) != 2 || len(u.PrevOuts) != 2 {
+		t.Fatalf("%d inputs, %d previous outputs", len(u.Tx.TxIn), len(u.PrevOuts))
+	}
+
+	if txIn := NewTxIn(utxos[0].OutPoint, 0xfffffffe); txIn.Sequence != 0xfffffffe ||
+		txIn.SignatureScript != nil {
+		t.Errorf("got %+v", txIn)
+	}
+}
+
+func TestBuilderRejectsInvalidOutputs(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	b := NewTxBuilder(1000, pkScript)
+	b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 2e8, PkScript: pkScript})
+	b.AddOutput(wire.NewTxOut(1e8, make([]byte, MaxScriptSize+1)))
+	if _, err := b.Build(); !errors.Is(err, ErrScriptLimit) {
+		t.Fatalf("got %v, want ErrScriptLimit", err)
+	}
+}
@@ -0,0 +1,447 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+)
+
+var (
+	// ErrInvalidContractParam describes an error where a parameter of a
+	// contract template is missing, unknown, or of a value its type
+	// rejects.
+	ErrInvalidContractParam = errors.New("invalid contract parameter")
+
+	// ErrContractMismatch describes an error where a script is not an
+	// instance of a contract template.
+	ErrContractMismatch = errors.New("script does not match contract template")
+)
+
+// ContractParamType is the type of a parameter of a contract template.
+type ContractParamType int
+
+const (
+	// ContractParamBytes is data of at most MaxScriptElementSize bytes, a
+	// []byte.
+	ContractParamBytes ContractParamType = iota
+
+	// ContractParamPubKey is a public key, compressed or not, a []byte
+	// pushed as is or a *btcec.PublicKey pushed compressed.
+	ContractParamPubKey
+
+	// ContractParamInt is a number of at most 8 bytes, pushed minimally: a
+	// Go integer or a btcutil.Amount, in (-2^63, 2^63).
+	ContractParamInt
+
+	// ContractParamHash160 is a 20 byte hash, a []byte or a [20]byte.
+	ContractParamHash160
+
+	// ContractParamHash256 is a 32 byte hash, a []byte, a [32]byte or a
+	// chainhash.Hash, pushed in its byte order.
+	ContractParamHash256
+)
+
+// contractParamTypes are the types by their name in templates.
+var contractParamTypes = map[string]ContractParamType{
+	"bytes":   ContractParamBytes,
+	"pubkey":  ContractParamPubKey,
+	"int":     ContractParamInt,
+	"hash160": ContractParamHash160,
+	"hash256": ContractParamHash256,
+}
+
+// String returns the name of the type in templates.
+func (t ContractParamType) String() string {
+	for name, typ := range contractParamTypes {
+		if typ == t {
+			return name
+		}
+	}
+	return fmt.Sprintf("ContractParamType(%d)", int(t))
+}
+
+// ContractParam is a named parameter of a contract template.
+type ContractParam struct {
+	Name string
+	Type ContractParamType
+}
+
+// contractElem is an element of a contract template: assembled opcodes, or
+// the push of the parameter param.
+type contractElem struct {
+	script []byte
+	ops    int
+	param  ContractParam
+}
+
+// ContractTemplate is a contract template parsed by ParseContractTemplate.
+type ContractTemplate struct {
+	elems  []contractElem
+	params []ContractParam
+}
+
+// ParseContractTemplate parses a template made of the tokens of ParseASM and
+// of placeholders {{name:type}}, pushes of the parameter name of type bytes,
+// pubkey, int, hash160 or hash256, such as
+//
+//	OP_DUP OP_HASH160 {{ownerPkh:hash160}} OP_EQUALVERIFY OP_CHECKSIG
+//
+// A placeholder without type, {{name}}, is of type bytes.  A parameter may be
+// pushed several times, always with the same type.  Errors wrap
+// ErrInvalidTemplate, or ErrInvalidASM for the ASM between the placeholders.
+func ParseContractTemplate(tmpl string) (*ContractTemplate, error) {
+	t := &ContractTemplate{}
+	types := make(map[string]ContractParamType)
+	var asm []string
+	flush := func() error {
+		if len(asm) == 0 {
+			return nil
+		}
+		script, err := ParseASM(strings.Join(asm, " "))
+		if err != nil {
+			return err
+		}
+		ops, err := parseScript(script)
+		if err != nil {
+			return err
+		}
+		t.elems = append(t.elems, contractElem{script: script, ops: len(ops)})
+		asm = asm[:0]
+		return nil
+	}
+	for _, token := range strings.Fields(tmpl) {
+		if !strings.HasPrefix(token, "{{") {
+			asm = append(asm, token)
+			continue
+		}
+		param, err := parseContractPlaceholder(token)
+		if err != nil {
+			return nil, err
+		}
+		if typ, ok := types[param.Name]; !ok {
+			types[param.Name] = param.Type
+			t.params = append(t.params, param)
+		} else if typ != param.Type {
+			return nil, fmt.Errorf("%w: parameter %s of types %s and %s", ErrInvalidTemplate, param.Name, typ,
+				param.Type)
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		t.elems = append(t.elems, contractElem{param: param})
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(t.elems) == 0 {
+		return nil, fmt.Errorf("%w: empty template", ErrInvalidTemplate)
+	}
+	return t, nil
+}
+
+// parseContractPlaceholder parses the placeholder token.
+func parseContractPlaceholder(token string) (ContractParam, error) {
+	if !strings.HasSuffix(token, "}}") {
+		return ContractParam{}, fmt.Errorf("%w: placeholder %q", ErrInvalidTemplate, token)
+	}
+	parts := strings.SplitN(token[2:len(token)-2], ":", 2)
+	param := ContractParam{Name: parts[0], Type: ContractParamBytes}
+	if !isContractParamName(param.Name) {
+		return ContractParam{}, fmt.Errorf("%w: parameter name %q", ErrInvalidTemplate, param.Name)
+	}
+	if len(parts) == 2 {
+		typ, ok := contractParamTypes[parts[1]]
+		if !ok {
+			return ContractParam{}, fmt.Errorf("%w: parameter %s of unknown type %q", ErrInvalidTemplate,
+				param.Name, parts[1])
+		}
+		param.Type = typ
+	}
+	return param, nil
+}
+
+// isContractParamName returns whether name is a letter or underscore followed
+// by letters, digits and underscores.
+func isContractParamName(name string) bool {
+	for i, c := range name {
+		switch {
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// Params returns the parameters of the template, in the order of their
+// first placeholder.
+func (t *ContractTemplate) Params() []ContractParam {
+	return append([]ContractParam(nil), t.params...)
+}
+
+// CompiledContract is an instance of a contract template.
+type CompiledContract struct {
+	// Bytecode is the redeem script of the contract, locked by the
+	// pay-to-script-hash output of Address.
+	Bytecode []byte
+	Address  *CashAddressScriptHash32
+}
+
+// Compile returns the instance of the template of params, by name, for net.
+// Every parameter must be given a value of its type, and no other name may
+// be given.  Errors wrap ErrInvalidContractParam, or ErrScriptLimit for
+// scripts too large to be pushed as redeem scripts.
+func (t *ContractTemplate) Compile(params map[string]interface{}, net *chaincfg.Params) (*CompiledContract, error) {
+	data := make(map[string][]byte, len(t.params))
+	for _, p := range t.params {
+		v, ok := params[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s missing", ErrInvalidContractParam, p.Name)
+		}
+		d, err := encodeContractParam(p.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidContractParam, p.Name, err)
+		}
+		data[p.Name] = d
+	}
+	if len(params) != len(t.params) {
+		for name := range params {
+			if _, ok := data[name]; !ok {
+				return nil, fmt.Errorf("%w: %s is not a parameter of the template", ErrInvalidContractParam,
+					name)
+			}
+		}
+	}
+
+	bytecode := t.assemble(data)
+	if len(bytecode) > MaxScriptElementSize {
+		return nil, fmt.Errorf("%w: %d byte redeem script exceeds %d bytes", ErrScriptLimit, len(bytecode),
+			MaxScriptElementSize)
+	}
+	addr, err := NewCashAddressScriptHash32(bytecode, net)
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledContract{Bytecode: bytecode, Address: addr}, nil
+}
+
+// assemble returns the script of the template pushing the data of its
+// parameters.
+func (t *ContractTemplate) assemble(data map[string][]byte) []byte {
+	var script []byte
+	for _, elem := range t.elems {
+		if elem.script != nil {
+			script = append(script, elem.script...)
+		} else {
+			script = append(script, minimalPush(data[elem.param.Name])...)
+		}
+	}
+	return script
+}
+
+// Match returns the parameters of script, an instance of the template, with
+// the values Compile takes: []byte for bytes, hashes and public keys, and
+// int64 for numbers.  Scripts compiled otherwise than by Compile, such as
+// with non-minimal pushes or different values for the same parameter, fail
+// with ErrContractMismatch, as do parameters not of their type.
+func (t *ContractTemplate) Match(script []byte) (map[string]interface{}, error) {
+	ops, err := parseScript(script)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrContractMismatch, err)
+	}
+	params := make(map[string]interface{}, len(t.params))
+	data := make(map[string][]byte, len(t.params))
+	i := 0
+	for _, elem := range t.elems {
+		if elem.script != nil {
+			i += elem.ops
+			continue
+		}
+		if i >= len(ops) {
+			break
+		}
+		d, isPush := pushedData(ops[i].value, ops[i].data)
+		if !isPush {
+			return nil, fmt.Errorf("%w: opcode %d is not a push of %s", ErrContractMismatch, i, elem.param.Name)
+		}
+		i++
+		if _, ok := data[elem.param.Name]; ok {
+			continue
+		}
+		v, err := decodeContractParam(elem.param.Type, d)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrContractMismatch, elem.param.Name, err)
+		}
+		params[elem.param.Name] = v
+		data[elem.param.Name] = d
+	}
+	if i != len(ops) || len(data) != len(t.params) || !bytes.Equal(t.assemble(data), script) {
+		return nil, ErrContractMismatch
+	}
+	return params, nil
+}
+
+// CompileContract parses the template tmpl and compiles its instance of
+// params for net, as ParseContractTemplate and Compile do.
+func CompileContract(tmpl string, params map[string]interface{}, net *chaincfg.Params) (*CompiledContract,
+	error) {
+
+	t, err := ParseContractTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return t.Compile(params, net)
+}
+
+// DecompileMatch parses the template tmpl and returns the parameters of
+// script, one of its instances, as ParseContractTemplate and Match do.
+func DecompileMatch(script []byte, tmpl string) (map[string]interface{}, error) {
+	t, err := ParseContractTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return t.Match(script)
+}
+
+// encodeContractParam returns the data pushed for the value v of a parameter
+// of type typ.
+func encodeContractParam(typ ContractParamType, v interface{}) ([]byte, error) {
+	switch typ {
+	case ContractParamPubKey:
+		switch v := v.(type) {
+		case *btcec.PublicKey:
+			return v.SerializeCompressed(), nil
+		case []byte:
+			return v, checkContractPubKey(v)
+		}
+
+	case ContractParamInt:
+		n, err := contractInt(v)
+		if err != nil {
+			return nil, err
+		}
+		return scriptNum(n).Bytes(), nil
+
+	case ContractParamHash160:
+		switch v := v.(type) {
+		case [20]byte:
+			return v[:], nil
+		case []byte:
+			if len(v) != 20 {
+				return nil, fmt.Errorf("%d byte hash160", len(v))
+			}
+			return v, nil
+		}
+
+	case ContractParamHash256:
+		switch v := v.(type) {
+		case chainhash.Hash:
+			return v[:], nil
+		case *chainhash.Hash:
+			return v[:], nil
+		case [32]byte:
+			return v[:], nil
+		case []byte:
+			if len(v) != 32 {
+				return nil, fmt.Errorf("%d byte hash256", len(v))
+			}
+			return v, nil
+		}
+
+	case ContractParamBytes:
+		if v, ok := v.([]byte); ok {
+			if len(v) > MaxScriptElementSize {
+				return nil, fmt.Errorf("%d bytes exceed %d", len(v), MaxScriptElementSize)
+			}
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("%T value for a parameter of type %s", v, typ)
+}
+
+// contractInt returns the integer v, which must be encodable as a script
+// number of at most 8 bytes.
+func contractInt(v interface{}) (int64, error) {
+	var n int64
+	switch v := v.(type) {
+	case int:
+		n = int64(v)
+	case int8:
+		n = int64(v)
+	case int16:
+		n = int64(v)
+	case int32:
+		n = int64(v)
+	case int64:
+		n = v
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return 0, fmt.Errorf("number %d out of range", v)
+		}
+		n = int64(v)
+	case uint8:
+		n = int64(v)
+	case uint16:
+		n = int64(v)
+	case uint32:
+		n = int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("number %d out of range", v)
+		}
+		n = int64(v)
+	case btcutil.Amount:
+		n = int64(v)
+	default:
+		return 0, fmt.Errorf("%T value for a parameter of type %s", v, ContractParamInt)
+	}
+	// -2^63 is the only int64 whose encoding needs 9 bytes.
+	if n == math.MinInt64 {
+		return 0, fmt.Errorf("number %d out of range", n)
+	}
+	return n, nil
+}
+
+// checkContractPubKey returns an error unless pubKey is a compressed or
+// uncompressed public key on the curve.
+func checkContractPubKey(pubKey []byte) error {
+	if len(pubKey) != btcec.PubKeyBytesLenCompressed && len(pubKey) != btcec.PubKeyBytesLenUncompressed {
+		return fmt.Errorf("%d byte public key", len(pubKey))
+	}
+	_, err := btcec.ParsePubKey(pubKey, btcec.S256())
+	return err
+}
+
+// decodeContractParam returns the value of a parameter of type typ pushed as
+// data.
+func decodeContractParam(typ ContractParamType, data []byte) (interface{}, error) {
+	switch typ {
+	case ContractParamPubKey:
+		if err := checkContractPubKey(data); err != nil {
+			return nil, err
+		}
+	case ContractParamInt:
+		n, err := makeScriptNum(data, true, maxScriptNumLen)
+		if err != nil {
+			return nil, err
+		}
+		return int64(n), nil
+	case ContractParamHash160:
+		if len(data) != 20 {
+			return nil, fmt.Errorf("%d byte hash160", len(data))
+		}
+	case ContractParamHash256:
+		if len(data) != 32 {
+			return nil, fmt.Errorf("%d byte hash256", len(data))
+		}
+	}
+	return append([]byte{}, data...), nil
+}
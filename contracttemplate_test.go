@@ -0,0 +1,207 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// allowanceTemplate pays the beneficiary at most maxAmount per spend once
+// the lock time passes, or the owner at any time.
+const allowanceTemplate = `OP_IF
+	{{beneficiaryPk:pubkey}} OP_CHECKSIGVERIFY
+	{{unlockTime:int}} OP_CHECKLOCKTIMEVERIFY OP_DROP
+	0 OP_OUTPUTVALUE {{maxAmount:int}} OP_LESSTHANOREQUAL
+OP_ELSE
+	{{ownerPk:pubkey}} OP_CHECKSIG
+OP_ENDIF`
+
+func TestCompileContract(t *testing.T) {
+	owner, _ := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{1}, 32))
+	beneficiary, _ := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{2}, 32))
+	params := map[string]interface{}{
+		"beneficiaryPk": beneficiary.PubKey().SerializeCompressed(),
+		"ownerPk":       owner.PubKey(),
+		"unlockTime":    uint32(1700000000),
+		"maxAmount":     btcutil.Amount(100000),
+	}
+	c, err := CompileContract(allowanceTemplate, params, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := NewScriptBuilder().AddOp(txscript.OP_IF).AddData(beneficiary.PubKey().SerializeCompressed()).
+		AddOp(txscript.OP_CHECKSIGVERIFY).AddInt64(1700000000).AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).
+		AddOp(txscript.OP_DROP).AddOp(txscript.OP_0).AddOp(0xcc).AddInt64(100000).
+		AddOp(txscript.OP_LESSTHANOREQUAL).AddOp(txscript.OP_ELSE).AddData(owner.PubKey().SerializeCompressed()).
+		AddOp(txscript.OP_CHECKSIG).AddOp(txscript.OP_ENDIF).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.Bytecode, want) {
+		t.Fatalf("bytecode %x, want %x", c.Bytecode, want)
+	}
+	addr, _ := NewCashAddressScriptHash32(want, &chaincfg.MainNetParams)
+	if c.Address.String() != addr.String() {
+		t.Errorf("address %s, want %s", c.Address, addr)
+	}
+
+	got, err := DecompileMatch(c.Bytecode, allowanceTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantParams := map[string]interface{}{
+		"beneficiaryPk": beneficiary.PubKey().SerializeCompressed(),
+		"ownerPk":       owner.PubKey().SerializeCompressed(),
+		"unlockTime":    int64(1700000000),
+		"maxAmount":     int64(100000),
+	}
+	if !reflect.DeepEqual(got, wantParams) {
+		t.Errorf("params %v, want %v", got, wantParams)
+	}
+
+	// Another instance does not match with different constants.
+	tmpl, _ := ParseContractTemplate(allowanceTemplate)
+	wantParams["maxAmount"] = int64(-1)
+	other, err := tmpl.Compile(wantParams, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := tmpl.Match(other.Bytecode); got["maxAmount"] != int64(-1) {
+		t.Errorf("maxAmount %v, want -1", got["maxAmount"])
+	}
+	if len(tmpl.Params()) != 4 || tmpl.Params()[1] != (ContractParam{Name: "unlockTime", Type: ContractParamInt}) {
+		t.Errorf("params %v", tmpl.Params())
+	}
+}
+
+func TestCompileContractSpend(t *testing.T) {
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{3}, 32))
+	pubKey := key.PubKey().SerializeCompressed()
+	const tmpl = "OP_DUP OP_HASH160 {{pkh:hash160}} OP_EQUALVERIFY OP_CHECKSIG"
+	c, err := CompileContract(tmpl, map[string]interface{}{"pkh": btcutil.Hash160(pubKey)},
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := PayToAddrScript(c.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(9000, pkScript))
+	sig, err := SignInput(tx, 0, c.Bytecode, SigHashAllForkID, key, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TxIn[0].SignatureScript, _ = NewScriptBuilder().AddData(sig).AddData(pubKey).AddData(c.Bytecode).Script()
+	vm, err := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompileContractInvalid(t *testing.T) {
+	for _, tmpl := range []string{
+		"",
+		"{{a:uint}} OP_DROP",
+		"{{1a}} OP_DROP",
+		"{{a OP_DROP",
+		"{{a:int}} {{a:bytes}} OP_2DROP",
+		"OP_PUSHDATA1 {{a}}",
+		"OP_FOO {{a}}",
+	} {
+		if _, err := ParseContractTemplate(tmpl); err == nil {
+			t.Errorf("%q: expected an error", tmpl)
+		}
+	}
+
+	tmpl, err := ParseContractTemplate("{{pk:pubkey}} {{n:int}} {{h:hash160}} {{hh:hash256}} {{b}} OP_2DROP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{1}, 32))
+	valid := map[string]interface{}{
+		"pk": key.PubKey().SerializeUncompressed(),
+		"n":  int64(math.MaxInt64),
+		"h":  [20]byte{},
+		"hh": chainhash.Hash{},
+		"b":  []byte(nil),
+	}
+	c, err := tmpl.Compile(valid, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmpl.Match(c.Bytecode); err != nil {
+		t.Error(err)
+	}
+
+	for name, v := range map[string]interface{}{
+		"pk": key.PubKey().SerializeCompressed()[:32],
+		"n":  int64(math.MinInt64),
+		"h":  make([]byte, 32),
+		"hh": [20]byte{},
+		"b":  make([]byte, MaxScriptElementSize+1),
+	} {
+		params := make(map[string]interface{})
+		for k, v := range valid {
+			params[k] = v
+		}
+		params[name] = v
+		if _, err := tmpl.Compile(params, &chaincfg.MainNetParams); !errors.Is(err, ErrInvalidContractParam) {
+			t.Errorf("%s = %T: got %v, want ErrInvalidContractParam", name, v, err)
+		}
+		delete(params, name)
+		if _, err := tmpl.Compile(params, &chaincfg.MainNetParams); !errors.Is(err, ErrInvalidContractParam) {
+			t.Errorf("%s missing: got %v, want ErrInvalidContractParam", name, err)
+		}
+	}
+	valid["extra"] = 1
+	if _, err := tmpl.Compile(valid, &chaincfg.MainNetParams); !errors.Is(err, ErrInvalidContractParam) {
+		t.Errorf("unknown parameter: got %v, want ErrInvalidContractParam", err)
+	}
+}
+
+func TestContractTemplateMismatch(t *testing.T) {
+	tmpl, err := ParseContractTemplate("{{a:int}} OP_DROP {{a:int}} {{h:hash160}} OP_2DROP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := bytes.Repeat([]byte{0xab}, 20)
+	instance := append([]byte{txscript.OP_5, txscript.OP_DROP, txscript.OP_5, 20}, hash...)
+	instance = append(instance, txscript.OP_2DROP)
+	if got, err := tmpl.Match(instance); err != nil || got["a"] != int64(5) {
+		t.Fatalf("got %v, %v", got, err)
+	}
+
+	for i, script := range [][]byte{
+		nil,
+		instance[:len(instance)-1],
+		append(append([]byte(nil), instance...), txscript.OP_NOP),
+		// A different value for a.
+		append([]byte{txscript.OP_5, txscript.OP_DROP, txscript.OP_6, 20}, instance[4:]...),
+		// Non-minimal number.
+		append([]byte{1, 5, txscript.OP_DROP, 1, 5, 20}, instance[4:]...),
+		// A 19 byte hash.
+		append([]byte{txscript.OP_5, txscript.OP_DROP, txscript.OP_5, 19}, instance[5:]...),
+		append([]byte{txscript.OP_5, txscript.OP_NIP, txscript.OP_5, 20}, instance[4:]...),
+		{txscript.OP_5, txscript.OP_DROP, txscript.OP_DUP},
+	} {
+		if _, err := tmpl.Match(script); !errors.Is(err, ErrContractMismatch) {
+			t.Errorf("test %d: got %v, want ErrContractMismatch", i, err)
+		}
+	}
+}
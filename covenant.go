@@ -0,0 +1,108 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrCovenantMismatch describes an error where the items pushed to a
+// preimage covenant would fail its checks.
+var ErrCovenantMismatch = errors.New("covenant items mismatch")
+
+// CovenantItems are the stack items of the covenants written before native
+// introspection, which verify the sighash preimage pushed by the spender: the
+// script checks the transaction signature with OP_CHECKSIG, then the same
+// signature, without its sighash byte, over the SHA-256 of the preimage with
+// OP_CHECKDATASIG and the same key.  Both succeeding proves that the preimage
+// is that of the spending transaction, whose fields the script inspects.
+type CovenantItems struct {
+	// Preimage is the serialized sighash preimage.
+	Preimage []byte
+
+	// Signature is the transaction signature, sighash byte included,
+	// DataSig the same signature without the sighash byte, as
+	// OP_CHECKDATASIG needs it, and SigHashByte the sighash byte.
+	Signature   []byte
+	DataSig     []byte
+	SigHashByte byte
+}
+
+// SignCovenantInput signs input idx of tx, spending an output of value amt to
+// the covenant subScript, the script code of the signature, with key and
+// hashType, and returns the items for the covenant to verify.  The options
+// are those of SignInput.
+func SignCovenantInput(tx *wire.MsgTx, idx int, subScript []byte, hashType txscript.SigHashType,
+	key *btcec.PrivateKey, amt int64, opts ...SignOption) (*CovenantItems, error) {
+
+	b, err := ExplainSigHash(subScript, nil, hashType, tx, idx, amt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := SignInput(tx, idx, subScript, hashType, key, amt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &CovenantItems{
+		Preimage:    b.Preimage(),
+		Signature:   sig,
+		DataSig:     sig[:len(sig)-1],
+		SigHashByte: sig[len(sig)-1],
+	}, nil
+}
+
+// ScriptSig returns the scriptSig spending the pay-to-script-hash covenant
+// redeemScript with items: the pushes of the data signature, the sighash
+// byte, the preimage and redeemScript.  Items larger than MaxScriptElementSize fail with ErrScriptLimit.
+func (items *CovenantItems) ScriptSig(redeemScript []byte) ([]byte, error) {
+	return NewScriptBuilder().AddData(items.DataSig).AddData([]byte{items.SigHashByte}).
+		AddData(items.Preimage).AddData(redeemScript).Script()
+}
+
+// Verify simulates the checks of a covenant verifying items with pubKey when
+// they are pushed to spend input idx of tx, as SignCovenantInput signed it,
+// and returns an error wrapping ErrCovenantMismatch for the first one
+// failing.  The checks are, in order: the data signature and sighash byte
+// make the transaction signature, the sighash byte is the low byte of the
+// sighash type of the preimage, the preimage is that of the input, naming
+// the fields differing otherwise, and the signature signs it.
+func (items *CovenantItems) Verify(tx *wire.MsgTx, idx int, subScript []byte, amt int64,
+	pubKey *btcec.PublicKey, opts ...SignOption) error {
+
+	sig := items.Signature
+	if len(sig) == 0 || !bytes.Equal(sig[:len(sig)-1], items.DataSig) || sig[len(sig)-1] != items.SigHashByte {
+		return fmt.Errorf("%w: data signature and sighash byte are not the signature", ErrCovenantMismatch)
+	}
+	fields, err := ParseSigHashPreimage(items.Preimage)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCovenantMismatch, err)
+	}
+	if byte(fields.HashType) != items.SigHashByte {
+		return fmt.Errorf("%w: sighash byte %#x, preimage of %s", ErrCovenantMismatch, items.SigHashByte,
+			SigHashTypeString(fields.HashType))
+	}
+
+	want, err := ExplainSigHash(subScript, nil, txscript.SigHashType(items.SigHashByte), tx, idx, amt, opts...)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(items.Preimage, want.Preimage()) {
+		got := &SigHashBreakdown{Fields: fields.fields(), Digest: chainhash.DoubleHashB(items.Preimage)}
+		return fmt.Errorf("%w: preimage differs in %v", ErrCovenantMismatch, DiffSigHash(got, want))
+	}
+
+	// OP_CHECKDATASIG hashes the SHA-256 of the preimage pushed by the
+	// script once more, giving the digest OP_CHECKSIG verifies.
+	message := sha256.Sum256(items.Preimage)
+	if digest := sha256.Sum256(message[:]); !verifySignature(items.DataSig, pubKey.SerializeCompressed(),
+		digest[:], true) {
+		return fmt.Errorf("%w: invalid signature", ErrCovenantMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package bchutil
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestCovenantItems(t *testing.T) {
+	keys := signingTestKeys()
+	pub := hex.EncodeToString(keys[0].PubKey().SerializeCompressed())
+	// The spender pushes the data signature, the sighash byte and the
+	// preimage.
+	redeemScript, err := ParseASM("OP_SHA256 OP_2 OP_PICK OP_SWAP 0x" + pub + " OP_CHECKDATASIGVERIFY OP_CAT 0x" +
+		pub + " OP_CHECKSIG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(9000, pkScript))
+
+	for _, opts := range [][]SignOption{nil, {WithSchnorr()}} {
+		items, err := SignCovenantInput(tx, 0, redeemScript, SigHashAllForkID, keys[0], 10000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := items.Verify(tx, 0, redeemScript, 10000, keys[0].PubKey()); err != nil {
+			t.Fatal(err)
+		}
+		scriptSig, err := items.ScriptSig(redeemScript)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TxIn[0].SignatureScript = scriptSig
+		vm, err := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, 10000)
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			t.Fatalf("covenant fails: %v", err)
+		}
+
+		tests := []struct {
+			mutate func(items *CovenantItems)
+			amount int64
+			key    int
+			want   string
+		}{
+			{func(*CovenantItems) {}, 10001, 0, "preimage differs in [amount]"},
+			{func(*CovenantItems) {}, 10000, 1, "invalid signature"},
+			{func(items *CovenantItems) { items.DataSig = items.DataSig[1:] }, 10000, 0, "not the signature"},
+			{func(items *CovenantItems) { items.SigHashByte = byte(SigHashSingleForkID) }, 10000, 0,
+				"not the signature"},
+			{func(items *CovenantItems) { items.Preimage = items.Preimage[1:] }, 10000, 0,
+				"malformed sighash preimage"},
+		}
+		for i, test := range tests {
+			mutated := *items
+			test.mutate(&mutated)
+			err := mutated.Verify(tx, 0, redeemScript, test.amount, keys[test.key].PubKey())
+			if !errors.Is(err, ErrCovenantMismatch) || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("test %d: got %v, want %q", i, err, test.want)
+			}
+		}
+	}
+
+	// Other sighash types give their byte.
+	items, err := SignCovenantInput(tx, 0, redeemScript, SigHashSingleForkIDAnyOneCanPay, keys[0], 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items.SigHashByte != byte(SigHashSingleForkIDAnyOneCanPay) {
+		t.Errorf("got sighash byte %#x", items.SigHashByte)
+	}
+	if err := items.Verify(tx, 0, redeemScript, 10000, keys[0].PubKey()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,82 @@
+package bchutil
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// PrevOutputFetcher returns the outputs spent by transactions.
+type PrevOutputFetcher interface {
+	// FetchPrevOutput returns the output at op, or nil if unknown.
+	FetchPrevOutput(op wire.OutPoint) *wire.TxOut
+}
+
+// BuildCPFP returns a child of parent spending its output changeIdx, which
+// must pay to the pay-to-pubkey-hash address of key, to dest, and the fee rate
+// of the package of both transactions.  The child pays the fee bringing the
+// package to targetPackageRate, and at least MinRelayFeeRate for itself.
+// fetcher provides the outputs spent by parent, needed to compute its fee.  An
+// error wrapping ErrInsufficientFunds is returned when the change can't cover
+// the fee and a non-dust output.
+func BuildCPFP(parent *wire.MsgTx, changeIdx int, key *btcec.PrivateKey, dest btcutil.Address,
+	targetPackageRate FeeRate, fetcher PrevOutputFetcher) (*wire.MsgTx, FeeRate, error) {
+
+	if changeIdx < 0 || changeIdx >= len(parent.TxOut) {
+		return nil, 0, fmt.Errorf("output index %d out of range", changeIdx)
+	}
+	change := parent.TxOut[changeIdx]
+	compressedScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	uncompressedScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeUncompressed()))
+	compressed := bytes.Equal(change.PkScript, compressedScript)
+	if !compressed && !bytes.Equal(change.PkScript, uncompressedScript) {
+		return nil, 0, fmt.Errorf("output %d: %w", changeIdx, ErrKeyNotInScript)
+	}
+	destScript, err := PayToAddrScript(dest)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	prevOuts := make(map[int]*wire.TxOut, len(parent.TxIn))
+	for i, txIn := range parent.TxIn {
+		if prevOut := fetcher.FetchPrevOutput(txIn.PreviousOutPoint); prevOut != nil {
+			prevOuts[i] = prevOut
+		}
+	}
+	info, err := TxFeeInfo(parent, prevOuts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parent fee: %w", err)
+	}
+	parentFee, parentSize := info.Fee, info.Size
+
+	hash := parent.TxHash()
+	child := wire.NewMsgTx(wire.TxVersion)
+	child.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, uint32(changeIdx)), nil, nil))
+	txOut := wire.NewTxOut(0, destScript)
+	child.AddTxOut(txOut)
+	childSize := child.SerializeSize() + InputSize(txscript.PubKeyHashTy, InputSizeOptions{Uncompressed: !compressed}) -
+		EstimateInputSize(0)
+
+	// Round the package fee up for its rate to reach the target.
+	packageFee := btcutil.Amount((int64(targetPackageRate)*int64(parentSize+childSize) + 999) / 1000)
+	childFee := packageFee - parentFee
+	if minFee := MinRelayFeeRate.Fee(childSize); childFee < minFee {
+		childFee = minFee
+	}
+	txOut.Value = change.Value - int64(childFee)
+	if IsDust(txOut) {
+		return nil, 0, fmt.Errorf("%w: change of %v can't pay a fee of %v", ErrInsufficientFunds,
+			btcutil.Amount(change.Value), childFee)
+	}
+
+	child.TxIn[0].SignatureScript, err = SignatureScript(child, 0, change.PkScript,
+		txscript.SigHashAll|SigHashForkID, key, compressed, change.Value)
+	if err != nil {
+		return nil, 0, err
+	}
+	return child, TxFeeRate(parentFee+childFee, parentSize+child.SerializeSize()), nil
+}
@@ -0,0 +1,67 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testPrevOutputFetcher is a PrevOutputFetcher backed by a map.
+type testPrevOutputFetcher map[wire.OutPoint]*wire.TxOut
+
+func (f testPrevOutputFetcher) FetchPrevOutput(op wire.OutPoint) *wire.TxOut {
+	return f[op]
+}
+
+func TestBuildCPFP(t *testing.T) {
+	key := signingTestKeys()[0]
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	prevOut := wire.NewTxOut(100000, pkScript)
+	fetcher := testPrevOutputFetcher{{Hash: chainhash.Hash{1}}: prevOut}
+
+	// The parent pays 200 satoshis.
+	parent := wire.NewMsgTx(wire.TxVersion)
+	parent.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	parent.AddTxOut(wire.NewTxOut(60000, pkScript))
+	parent.AddTxOut(wire.NewTxOut(39800, pkScript))
+	scriptSig, err := SignatureScript(parent, 0, pkScript, txscript.SigHashAll|SigHashForkID, key, true,
+		prevOut.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.TxIn[0].SignatureScript = scriptSig
+
+	dest, _ := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.MainNetParams)
+	target := FeeRate(5000)
+	child, rate, err := BuildCPFP(parent, 1, key, dest, target, fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate < target {
+		t.Errorf("got package rate %d, want at least %d", rate, target)
+	}
+	childFee := 39800 - child.TxOut[0].Value
+	packageSize := parent.SerializeSize() + child.SerializeSize()
+	if got := TxFeeRate(btcutil.Amount(200+childFee), packageSize); got != rate {
+		t.Errorf("got package rate %d, computed %d", rate, got)
+	}
+	vm, _ := NewEngine(pkScript, child, 0, StandardScriptFlags, nil, 39800)
+	if err := vm.Execute(); err != nil {
+		t.Error(err)
+	}
+
+	if _, _, err := BuildCPFP(parent, 1, key, dest, FeeRate(100000), fetcher); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+	if _, _, err := BuildCPFP(parent, 1, signingTestKeys()[1], dest, target, fetcher); !errors.Is(err, ErrKeyNotInScript) {
+		t.Errorf("got %v, want ErrKeyNotInScript", err)
+	}
+	if _, _, err := BuildCPFP(parent, 1, key, dest, target, testPrevOutputFetcher{}); err == nil {
+		t.Error("unknown parent fee accepted")
+	}
+}
@@ -0,0 +1,108 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+)
+
+var (
+	// ErrCTORViolation describes an error where the transactions of a block
+	// following the coinbase are not in ascending txid order.
+	ErrCTORViolation = errors.New("transactions not in canonical order")
+
+	// ErrBadMerkleRoot describes an error where the merkle root of the
+	// transactions of a block is not the one of its header.
+	ErrBadMerkleRoot = errors.New("merkle root mismatch")
+)
+
+// compareTxIDs compares the txids a and b as the little endian numbers the
+// canonical transaction order sorts, which orders them as their hex forms.
+func compareTxIDs(a, b *chainhash.Hash) int {
+	for i := chainhash.HashSize - 1; i >= 0; i-- {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// SortTxsCTOR sorts the transactions of a block in the canonical transaction
+// order: the coinbase, at index 0, is left in place and the other
+// transactions are sorted by ascending txid, compared as little endian
+// numbers.
+func SortTxsCTOR(txs []*btcutil.Tx) {
+	if len(txs) < 2 {
+		return
+	}
+	rest := txs[1:]
+	sort.Slice(rest, func(i, j int) bool {
+		return compareTxIDs(rest[i].Hash(), rest[j].Hash()) < 0
+	})
+}
+
+// IsCTOROrdered returns whether the transactions of a block following the
+// coinbase are in strictly ascending txid order and, if not, the index of
+// the first transaction that is not greater than the previous one, or -1.
+func IsCTOROrdered(txs []*btcutil.Tx) (bool, int) {
+	for i := 2; i < len(txs); i++ {
+		if compareTxIDs(txs[i-1].Hash(), txs[i].Hash()) >= 0 {
+			return false, i
+		}
+	}
+	return true, -1
+}
+
+// CalcMerkleRoot returns the merkle root of the txids of txs, duplicating the
+// last hash of the levels of odd length.  It is zero without transaction.
+func CalcMerkleRoot(txs []*btcutil.Tx) chainhash.Hash {
+	if len(txs) == 0 {
+		return chainhash.Hash{}
+	}
+	level := make([]chainhash.Hash, len(txs))
+	for i, tx := range txs {
+		level[i] = *tx.Hash()
+	}
+	var buf [2 * chainhash.HashSize]byte
+	for len(level) > 1 {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		for i := 0; i < len(level)/2; i++ {
+			copy(buf[:chainhash.HashSize], level[2*i][:])
+			copy(buf[chainhash.HashSize:], level[2*i+1][:])
+			level[i] = chainhash.DoubleHashH(buf[:])
+		}
+		level = level[:len(level)/2]
+	}
+	return level[0]
+}
+
+// CheckBlockTxs checks the transactions of a block, whose header commits to
+// merkleRoot: the first must be the coinbase, the others must be in the
+// canonical order, failing with an error wrapping ErrCTORViolation, and their
+// merkle root must be merkleRoot, failing with ErrBadMerkleRoot.  The strict
+// order rejects duplicate transactions, and with them the mutated blocks of
+// CVE-2012-2459 whose merkle root is unchanged.
+func CheckBlockTxs(txs []*btcutil.Tx, merkleRoot chainhash.Hash) error {
+	if len(txs) == 0 {
+		return errors.New("block without transaction")
+	}
+	if !IsCoinBaseTx(txs[0].MsgTx()) {
+		return errors.New("first transaction of the block is not a coinbase")
+	}
+	if ok, i := IsCTOROrdered(txs); !ok {
+		return fmt.Errorf("%w: transaction %d, %v, follows %v", ErrCTORViolation, i, txs[i].Hash(),
+			txs[i-1].Hash())
+	}
+	if root := CalcMerkleRoot(txs); root != merkleRoot {
+		return fmt.Errorf("%w: %v, header commits to %v", ErrBadMerkleRoot, root, merkleRoot)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// ctorTestTxs returns a coinbase followed by n transactions.
+func ctorTestTxs(n int) []*btcutil.Tx {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), []byte{1, 2}, nil))
+	coinbase.AddTxOut(wire.NewTxOut(625000000, []byte{txscript.OP_TRUE}))
+	txs := []*btcutil.Tx{btcutil.NewTx(coinbase)}
+	for i := 0; i < n; i++ {
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(i)}, 0), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(1000, []byte{txscript.OP_TRUE}))
+		txs = append(txs, btcutil.NewTx(tx))
+	}
+	return txs
+}
+
+func TestSortTxsCTOR(t *testing.T) {
+	txs := ctorTestTxs(20)
+	coinbase := txs[0]
+	// The coinbase is the greatest transaction, and must stay first.
+	for compareTxIDs(coinbase.Hash(), txs[1].Hash()) < 0 {
+		coinbase.MsgTx().TxIn[0].SignatureScript[0]++
+		txs[0] = btcutil.NewTx(coinbase.MsgTx())
+		coinbase = txs[0]
+	}
+	SortTxsCTOR(txs)
+	if txs[0] != coinbase {
+		t.Fatal("coinbase moved")
+	}
+	if ok, i := IsCTOROrdered(txs); !ok {
+		t.Fatalf("not ordered at %d", i)
+	}
+	for i := 2; i < len(txs); i++ {
+		if txs[i-1].Hash().String() >= txs[i].Hash().String() {
+			t.Errorf("transaction %d: %v follows %v", i, txs[i].Hash(), txs[i-1].Hash())
+		}
+	}
+
+	txs[3], txs[4] = txs[4], txs[3]
+	if ok, i := IsCTOROrdered(txs); ok || i != 4 {
+		t.Errorf("got %v, %d, want false, 4", ok, i)
+	}
+	txs[4] = txs[3]
+	if ok, i := IsCTOROrdered(txs); ok || i != 4 {
+		t.Errorf("duplicate: got %v, %d, want false, 4", ok, i)
+	}
+}
+
+func TestCompareTxIDs(t *testing.T) {
+	// The last byte of a hash, the first of its hex form, is the most
+	// significant.
+	a, b := chainhash.Hash{0xff}, chainhash.Hash{31: 0x01}
+	if compareTxIDs(&a, &b) >= 0 || compareTxIDs(&b, &a) <= 0 || compareTxIDs(&a, &a) != 0 {
+		t.Errorf("%v and %v compared in the wrong byte order", a, b)
+	}
+	if a.String() >= b.String() {
+		t.Errorf("%v not before %v", a, b)
+	}
+}
+
+func TestCheckBlockTxs(t *testing.T) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	txs := []*btcutil.Tx{btcutil.NewTx(genesis.Transactions[0])}
+	if err := CheckBlockTxs(txs, genesis.Header.MerkleRoot); err != nil {
+		t.Error(err)
+	}
+
+	txs = ctorTestTxs(6)
+	SortTxsCTOR(txs)
+	root := CalcMerkleRoot(txs)
+	if err := CheckBlockTxs(txs, root); err != nil {
+		t.Error(err)
+	}
+	if err := CheckBlockTxs(txs, chainhash.Hash{}); !errors.Is(err, ErrBadMerkleRoot) {
+		t.Errorf("got %v, want ErrBadMerkleRoot", err)
+	}
+
+	// A block of 7 transactions duplicating its last one keeps its merkle
+	// root, and is rejected by the order.
+	mutated := append(append([]*btcutil.Tx(nil), txs...), txs[len(txs)-1])
+	if CalcMerkleRoot(mutated) != root {
+		t.Fatal("merkle root changed by duplication")
+	}
+	if err := CheckBlockTxs(mutated, root); !errors.Is(err, ErrCTORViolation) {
+		t.Errorf("got %v, want ErrCTORViolation", err)
+	}
+
+	txs[1], txs[2] = txs[2], txs[1]
+	if err := CheckBlockTxs(txs, CalcMerkleRoot(txs)); !errors.Is(err, ErrCTORViolation) {
+		t.Errorf("got %v, want ErrCTORViolation", err)
+	}
+	if err := CheckBlockTxs(txs[1:], CalcMerkleRoot(txs[1:])); err == nil {
+		t.Error("block without coinbase accepted")
+	}
+}
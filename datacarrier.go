@@ -0,0 +1,179 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// dataChunkHeaderLen is the length of the header of data carrier
+	// chunks: their index, the number of chunks and the checksum of the
+	// payload.
+	dataChunkHeaderLen = 6
+
+	// maxDataChunks is the largest number of chunks of a payload, whose
+	// index and count are single bytes.
+	maxDataChunks = 255
+)
+
+// ErrDataCarrierChunk describes an error where data carrier chunks don't
+// make a payload: a chunk is malformed, missing, out of order or from
+// another payload.
+var ErrDataCarrierChunk = errors.New("invalid data carrier chunk")
+
+// dataPushLen returns the length of the data push of n bytes.
+func dataPushLen(n int) int {
+	switch {
+	case n <= txscript.OP_DATA_75:
+		return 1 + n
+	case n <= 0xff:
+		return 2 + n
+	}
+	return 3 + n
+}
+
+// dataChunkCapacity returns the largest chunk whose OP_RETURN script, of
+// the OP_RETURN opcode and the data push of the chunk, fits in limit bytes.
+func dataChunkCapacity(limit int) int {
+	n := limit - 1
+	if n > MaxScriptElementSize {
+		n = MaxScriptElementSize
+	}
+	for n > 0 && 1+dataPushLen(n) > limit {
+		n--
+	}
+	return n
+}
+
+// SplitDataCarrier splits payload into the chunks of the OP_RETURN outputs
+// anchoring it, whose scripts are at most perOutputLimit bytes, or
+// MaxDataCarrierSize when it is not positive.  Each chunk is a single data
+// push starting with a header of 6 bytes: its index from 0, the number of
+// chunks, and the first 4 bytes of the SHA-256 of payload, followed by the
+// next part of payload.  Payloads needing more than 255 chunks, and limits
+// leaving no room for a part, fail with ErrDataCarrierSize.
+func SplitDataCarrier(payload []byte, perOutputLimit int) ([][]byte, error) {
+	if perOutputLimit <= 0 {
+		perOutputLimit = MaxDataCarrierSize
+	}
+	n := dataChunkCapacity(perOutputLimit) - dataChunkHeaderLen
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: %d byte outputs leave no room for data", ErrDataCarrierSize, perOutputLimit)
+	}
+	total := (len(payload) + n - 1) / n
+	if total == 0 {
+		total = 1
+	}
+	if total > maxDataChunks {
+		return nil, fmt.Errorf("%w: %d byte payload needs %d chunks, limit %d", ErrDataCarrierSize,
+			len(payload), total, maxDataChunks)
+	}
+	sum := sha256.Sum256(payload)
+	chunks := make([][]byte, total)
+	for i := range chunks {
+		part := payload[i*n:]
+		if len(part) > n {
+			part = part[:n]
+		}
+		chunk := append([]byte{byte(i), byte(total)}, sum[:4]...)
+		chunks[i] = append(chunk, part...)
+	}
+	return chunks, nil
+}
+
+// ReassembleDataCarrier returns the payload split into chunks by
+// SplitDataCarrier.  The chunks must all be there, in order, and from the
+// same payload, whose checksum must match, or the error wraps
+// ErrDataCarrierChunk.
+func ReassembleDataCarrier(chunks [][]byte) ([]byte, error) {
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%w: no chunk", ErrDataCarrierChunk)
+	}
+	var payload []byte
+	for i, chunk := range chunks {
+		switch {
+		case len(chunk) < dataChunkHeaderLen:
+			return nil, fmt.Errorf("%w: chunk %d of %d bytes", ErrDataCarrierChunk, i, len(chunk))
+		case int(chunk[0]) != i:
+			return nil, fmt.Errorf("%w: chunk %d at position %d", ErrDataCarrierChunk, chunk[0], i)
+		case int(chunk[1]) != len(chunks):
+			return nil, fmt.Errorf("%w: chunk %d of %d chunks, got %d", ErrDataCarrierChunk, i, chunk[1],
+				len(chunks))
+		case !bytes.Equal(chunk[2:dataChunkHeaderLen], chunks[0][2:dataChunkHeaderLen]):
+			return nil, fmt.Errorf("%w: chunk %d of another payload", ErrDataCarrierChunk, i)
+		}
+		payload = append(payload, chunk[dataChunkHeaderLen:]...)
+	}
+	if sum := sha256.Sum256(payload); !bytes.Equal(sum[:4], chunks[0][2:dataChunkHeaderLen]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrDataCarrierChunk)
+	}
+	return payload, nil
+}
+
+// DataChunkScript returns the OP_RETURN script of chunk.
+func DataChunkScript(chunk []byte) ([]byte, error) {
+	return NewScriptBuilder().AddOp(txscript.OP_RETURN).AddDataPush(chunk).Script()
+}
+
+// ParseDataChunkScript returns the chunk of pkScript, an OP_RETURN script
+// of a single data push, or fails with ErrDataCarrierChunk.
+func ParseDataChunkScript(pkScript []byte) ([]byte, error) {
+	if len(pkScript) == 0 || pkScript[0] != txscript.OP_RETURN {
+		return nil, fmt.Errorf("%w: no OP_RETURN", ErrDataCarrierChunk)
+	}
+	ops, err := parseScript(pkScript[1:])
+	if err != nil || len(ops) != 1 || !isPushOnly(ops) || len(ops[0].data) < dataChunkHeaderLen {
+		return nil, fmt.Errorf("%w: not a chunk push", ErrDataCarrierChunk)
+	}
+	return ops[0].data, nil
+}
+
+// AddLargeData splits payload with SplitDataCarrier and adds the OP_RETURN
+// outputs of its chunks with AddDataChunks, returning the chunks left for
+// the following transactions.
+func (b *TxBuilder) AddLargeData(payload []byte, perOutputLimit int) ([][]byte, error) {
+	chunks, err := SplitDataCarrier(payload, perOutputLimit)
+	if err != nil {
+		return nil, err
+	}
+	return b.AddDataChunks(chunks)
+}
+
+// AddDataChunks adds the OP_RETURN outputs of the first chunks, as many as
+// the MaxDataCarrierSize bytes of the OP_RETURN outputs of a standard
+// transaction allow, those already added included.  The chunks left are
+// returned: when there are some, the payload needs a chain of transactions,
+// each adding the chunks left by the one before.  Chunks whose output
+// exceeds MaxDataCarrierSize alone fail with ErrDataCarrierSize.
+func (b *TxBuilder) AddDataChunks(chunks [][]byte) ([][]byte, error) {
+	used := 0
+	for _, txOut := range b.outputs {
+		if isDataCarrier(txOut.PkScript) {
+			used += len(txOut.PkScript)
+		}
+	}
+	scripts := make([][]byte, len(chunks))
+	for i, chunk := range chunks {
+		pkScript, err := DataChunkScript(chunk)
+		if err != nil {
+			return nil, err
+		}
+		if len(pkScript) > MaxDataCarrierSize {
+			return nil, fmt.Errorf("%w: chunk %d script of %d bytes", ErrDataCarrierSize, i, len(pkScript))
+		}
+		scripts[i] = pkScript
+	}
+	for i, pkScript := range scripts {
+		if used+len(pkScript) > MaxDataCarrierSize {
+			return chunks[i:], nil
+		}
+		used += len(pkScript)
+		b.AddOutput(wire.NewTxOut(0, pkScript))
+	}
+	return nil, nil
+}
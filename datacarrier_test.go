@@ -0,0 +1,135 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestSplitDataCarrier(t *testing.T) {
+	payload := make([]byte, 1000)
+	for i := range payload {
+		payload[i] = byte(i * 7)
+	}
+	// The first chunks fill their output, but for the longer pushes of the
+	// chunks one byte longer.
+	tests := []struct {
+		limit, full int
+	}{
+		{0, 223}, {12, 12}, {77, 77}, {78, 77}, {79, 79}, {223, 223}, {258, 258}, {259, 258}, {600, 524},
+	}
+	for _, test := range tests {
+		limit := test.limit
+		chunks, err := SplitDataCarrier(payload, limit)
+		if err != nil {
+			t.Fatalf("limit %d: %v", limit, err)
+		}
+		if limit == 0 {
+			limit = MaxDataCarrierSize
+		}
+		for i, chunk := range chunks {
+			pkScript, err := DataChunkScript(chunk)
+			if err != nil || len(pkScript) > limit {
+				t.Errorf("limit %d: chunk %d script of %d bytes, %v", limit, i, len(pkScript), err)
+			}
+			parsed, err := ParseDataChunkScript(pkScript)
+			if err != nil || !bytes.Equal(parsed, chunk) {
+				t.Errorf("limit %d: chunk %d parsed as %x, %v", limit, i, parsed, err)
+			}
+		}
+		if full, _ := DataChunkScript(chunks[0]); len(full) != test.full {
+			t.Errorf("limit %d: first chunk script of %d bytes, want %d", limit, len(full), test.full)
+		}
+		got, err := ReassembleDataCarrier(chunks)
+		if err != nil || !bytes.Equal(got, payload) {
+			t.Errorf("limit %d: reassembled %d bytes, %v", limit, len(got), err)
+		}
+	}
+
+	chunks, _ := SplitDataCarrier(nil, 0)
+	if got, err := ReassembleDataCarrier(chunks); len(chunks) != 1 || err != nil || len(got) != 0 {
+		t.Errorf("empty payload: %d chunks, %x, %v", len(chunks), got, err)
+	}
+	if _, err := SplitDataCarrier(payload, 8); !errors.Is(err, ErrDataCarrierSize) {
+		t.Errorf("8 byte outputs: %v, want ErrDataCarrierSize", err)
+	}
+	if _, err := SplitDataCarrier(make([]byte, 255*215+1), 0); !errors.Is(err, ErrDataCarrierSize) {
+		t.Errorf("256 chunks: %v, want ErrDataCarrierSize", err)
+	}
+}
+
+func TestReassembleDataCarrier(t *testing.T) {
+	payload := bytes.Repeat([]byte("anchored document "), 30)
+	chunks, _ := SplitDataCarrier(payload, 100)
+	other, _ := SplitDataCarrier(bytes.Repeat([]byte("another document! "), 30), 100)
+	corrupted := append([]byte(nil), chunks[1]...)
+	corrupted[10] ^= 1
+
+	tests := [][][]byte{
+		nil,
+		chunks[:len(chunks)-1],
+		append([][]byte{chunks[1], chunks[0]}, chunks[2:]...),
+		append([][]byte{chunks[0], other[1]}, chunks[2:]...),
+		append([][]byte{chunks[0], corrupted}, chunks[2:]...),
+		append([][]byte{chunks[0], chunks[1][:5]}, chunks[2:]...),
+	}
+	for i, test := range tests {
+		if _, err := ReassembleDataCarrier(test); !errors.Is(err, ErrDataCarrierChunk) {
+			t.Errorf("%d: got %v, want ErrDataCarrierChunk", i, err)
+		}
+	}
+	if _, err := ParseDataChunkScript([]byte{0x6a, 0x51}); !errors.Is(err, ErrDataCarrierChunk) {
+		t.Errorf("got %v, want ErrDataCarrierChunk", err)
+	}
+}
+
+func TestTxBuilderAddLargeData(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	payload := make([]byte, 500)
+	var got [][]byte
+	var left [][]byte
+	var err error
+	for tx := 0; tx == 0 || len(left) != 0; tx++ {
+		b := NewTxBuilder(1000, pkScript)
+		b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(tx)}}, Amount: 1e6,
+			PkScript: pkScript})
+		if tx == 0 {
+			b.AddOutput(wire.NewTxOut(0, []byte{0x6a, 0x04, 't', 'e', 's', 't'}))
+			left, err = b.AddLargeData(payload, 80)
+		} else {
+			left, err = b.AddDataChunks(left)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.SetValidatePolicy()
+		u, err := b.Build()
+		if err != nil {
+			t.Fatalf("transaction %d: %v", tx, err)
+		}
+		for _, txOut := range u.Tx.TxOut {
+			if chunk, err := ParseDataChunkScript(txOut.PkScript); err == nil {
+				got = append(got, chunk)
+			}
+		}
+		if tx > 10 {
+			t.Fatal("payload never anchored")
+		}
+	}
+	// 80 byte outputs hold 71 bytes of payload, and two of them fit in each
+	// transaction.
+	if len(got) != 8 {
+		t.Errorf("%d chunks", len(got))
+	}
+	if reassembled, err := ReassembleDataCarrier(got); err != nil || !bytes.Equal(reassembled, payload) {
+		t.Errorf("reassembled %d bytes, %v", len(reassembled), err)
+	}
+
+	b := NewTxBuilder(1000, pkScript)
+	if _, err := b.AddLargeData(payload, 300); !errors.Is(err, ErrDataCarrierSize) {
+		t.Errorf("300 byte outputs: %v, want ErrDataCarrierSize", err)
+	}
+}
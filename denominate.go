@@ -0,0 +1,234 @@
+package bchutil
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/btcsuite/btcutil"
+)
+
+// denominationSpread is the number of the largest denominations that fit
+// among which each output of a plan is drawn.
+const denominationSpread = 3
+
+// ErrFeeBudgetExceeded describes an error where an amount can't be split in
+// denominations without paying more fee than budgeted.
+var ErrFeeBudgetExceeded = errors.New("fee budget exceeded")
+
+// e12 are the significands of the E12 series of preferred numbers, the
+// ladder of the standard tiers of CashFusion.
+var e12 = []int64{10, 12, 15, 18, 22, 27, 33, 39, 47, 56, 68, 82}
+
+// DenominationScheme is a ladder of standard output amounts, such as the
+// amounts of the outputs of fusion-style privacy protocols.
+type DenominationScheme struct {
+	// Denominations are the amounts of the outputs, ascending.
+	Denominations []btcutil.Amount
+
+	// FeeRate pays the outputs, of OutputSize bytes each, or of
+	// P2PKHOutputSize bytes when OutputSize is not positive.
+	FeeRate    FeeRate
+	OutputSize int
+
+	// MaxOutputs limits the outputs of plans when positive.
+	MaxOutputs int
+}
+
+// NewCashFusionScheme returns the scheme of the standard tiers of CashFusion,
+// the E12 series from 10000 satoshis to 8.2 million coins, paid at feeRate.
+func NewCashFusionScheme(feeRate FeeRate) DenominationScheme {
+	var denominations []btcutil.Amount
+	for scale := int64(1000); scale <= 1e13; scale *= 10 {
+		for _, m := range e12 {
+			denominations = append(denominations, btcutil.Amount(m*scale))
+		}
+	}
+	return DenominationScheme{Denominations: denominations, FeeRate: feeRate}
+}
+
+// NewBinaryScheme returns the scheme of the powers of two from 1024 satoshis
+// to 2^50 satoshis, paid at feeRate.
+func NewBinaryScheme(feeRate FeeRate) DenominationScheme {
+	var denominations []btcutil.Amount
+	for shift := uint(10); shift <= 50; shift++ {
+		denominations = append(denominations, btcutil.Amount(1)<<shift)
+	}
+	return DenominationScheme{Denominations: denominations, FeeRate: feeRate}
+}
+
+// outputSize returns the size of the outputs of the scheme.
+func (s *DenominationScheme) outputSize() int {
+	if s.OutputSize <= 0 {
+		return P2PKHOutputSize
+	}
+	return s.OutputSize
+}
+
+// validate checks that the denominations are ascending and above the dust
+// threshold of outputs of the size of the scheme.
+func (s *DenominationScheme) validate() error {
+	if len(s.Denominations) == 0 {
+		return errors.New("no denomination")
+	}
+	dust := 3 * DustRelayFeeRate.Fee(s.outputSize()+148)
+	for i, d := range s.Denominations {
+		if err := CheckAmount(d); err != nil {
+			return fmt.Errorf("denomination %v: %w", d, err)
+		}
+		if d < dust {
+			return fmt.Errorf("%w: denomination %v", ErrDustOutput, d)
+		}
+		if i > 0 && d <= s.Denominations[i-1] {
+			return fmt.Errorf("denomination %v does not follow %v in ascending order", d, s.Denominations[i-1])
+		}
+	}
+	return nil
+}
+
+// PlanDenominations splits total in denominations of scheme, leaving the rest
+// to the fee paying the outputs at the fee rate of the scheme.  Each output is
+// drawn at random with rng, crypto/rand when nil, among the largest
+// denominations that fit what is left.  Plans whose fee would exceed
+// feeBudget fail with ErrFeeBudgetExceeded, and amounts too small for a single
+// output with ErrInsufficientFunds.
+func PlanDenominations(total btcutil.Amount, feeBudget btcutil.Amount, scheme DenominationScheme,
+	rng io.Reader) ([]btcutil.Amount, error) {
+
+	if err := scheme.validate(); err != nil {
+		return nil, err
+	}
+	if err := CheckAmount(total); err != nil {
+		return nil, err
+	}
+	if rng == nil {
+		rng = rand.Reader
+	}
+	size := scheme.outputSize()
+
+	var plan []btcutil.Amount
+	var sum btcutil.Amount
+	for scheme.MaxOutputs <= 0 || len(plan) < scheme.MaxOutputs {
+		// The outputs drawn so far and the next one must stay paid.
+		left := total - sum - scheme.FeeRate.Fee((len(plan)+1)*size)
+		fit := 0
+		for fit < len(scheme.Denominations) && scheme.Denominations[fit] <= left {
+			fit++
+		}
+		if fit == 0 {
+			break
+		}
+		spread := denominationSpread
+		if fit < spread {
+			spread = fit
+		}
+		n, err := rand.Int(rng, big.NewInt(int64(spread)))
+		if err != nil {
+			return nil, err
+		}
+		d := scheme.Denominations[fit-1-int(n.Int64())]
+		plan = append(plan, d)
+		sum += d
+	}
+	if len(plan) == 0 {
+		return nil, fmt.Errorf("%w: %v below the smallest denomination and its fee", ErrInsufficientFunds, total)
+	}
+	if fee := total - sum; fee > feeBudget {
+		return nil, fmt.Errorf("%w: %d outputs leave a fee of %v, budget %v", ErrFeeBudgetExceeded, len(plan),
+			fee, feeBudget)
+	}
+	return plan, nil
+}
+
+// AddressSource provides fresh addresses, such as the unused addresses of a
+// wallet.
+type AddressSource interface {
+	// NextAddress returns an address not returned before.
+	NextAddress() (btcutil.Address, error)
+}
+
+// denominatedChange is the configuration set by SetDenominatedChange.
+type denominatedChange struct {
+	scheme    DenominationScheme
+	feeBudget btcutil.Amount
+	addrs     AddressSource
+	rng       io.Reader
+}
+
+// SetDenominatedChange makes the builder split the change in the outputs
+// planned by PlanDenominations with scheme, paid at the fee rate of the
+// builder, each to a fresh address of addrs.  The fee of the change outputs,
+// the value below the smallest denomination included, is at most feeBudget.
+// The change outputs are listed by UnsignedTx.DenominatedChange.
+func (b *TxBuilder) SetDenominatedChange(scheme DenominationScheme, feeBudget btcutil.Amount, addrs AddressSource,
+	rng io.Reader) {
+
+	b.denominated = &denominatedChange{scheme: scheme, feeBudget: feeBudget, addrs: addrs, rng: rng}
+}
+
+// denominate replaces the change of u, if any, with denominated change.
+func (b *TxBuilder) denominate(u *UnsignedTx) error {
+	if b.denominated == nil || u.ChangeIndex < 0 {
+		return nil
+	}
+	tx := u.Tx
+	change := tx.TxOut[u.ChangeIndex]
+	tx.TxOut = append(tx.TxOut[:u.ChangeIndex], tx.TxOut[u.ChangeIndex+1:]...)
+	u.ChangeIndex = -1
+	size, err := b.size(tx, u.PrevOuts, nil)
+	if err != nil {
+		return err
+	}
+	// The change outputs are paid by the change and the fee of its output.
+	fee := b.feeRate.Fee(size)
+	total := u.Fee - fee + btcutil.Amount(change.Value)
+
+	scheme := b.denominated.scheme
+	scheme.FeeRate = b.feeRate
+	plan, err := PlanDenominations(total, b.denominated.feeBudget, scheme, b.denominated.rng)
+	if err != nil {
+		return fmt.Errorf("denominating change: %w", err)
+	}
+	for i, d := range plan {
+		addr, err := b.denominated.addrs.NextAddress()
+		if err != nil {
+			return err
+		}
+		pkScript, err := PayToAddrScript(addr)
+		if err != nil {
+			return fmt.Errorf("change address %d (%v): %w", i, addr, err)
+		}
+		txOut, err := NewTxOut(d, pkScript)
+		if err != nil {
+			return fmt.Errorf("change address %d (%v): %w", i, addr, err)
+		}
+		if IsDust(txOut) {
+			return fmt.Errorf("%w: change output %v to %v", ErrDustOutput, d, addr)
+		}
+		u.DenominatedChange = append(u.DenominatedChange, len(tx.TxOut))
+		tx.AddTxOut(txOut)
+	}
+
+	maxTxSize := b.maxTxSize
+	if maxTxSize <= 0 {
+		maxTxSize = MaxStandardTxSize
+	}
+	if u.Size, err = b.size(tx, u.PrevOuts, nil); err != nil {
+		return err
+	}
+	if u.Size > maxTxSize || (b.maxOutputs > 0 && len(tx.TxOut) > b.maxOutputs) {
+		return errors.New("denominated change exceeds the transaction limits")
+	}
+	in, out, err := txValues(tx, u.PrevOuts)
+	if err != nil {
+		return err
+	}
+	u.Fee = in - out
+	if u.Fee < b.feeRate.Fee(u.Size) {
+		return fmt.Errorf("%w: denominated change leaves a fee of %v for %d bytes", ErrInsufficientFunds,
+			u.Fee, u.Size)
+	}
+	return nil
+}
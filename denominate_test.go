@@ -0,0 +1,160 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	mathrand "math/rand"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestCashFusionScheme(t *testing.T) {
+	s := NewCashFusionScheme(1000)
+	if err := s.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Denominations); n != 11*12 || s.Denominations[0] != 10000 || s.Denominations[1] != 12000 ||
+		s.Denominations[n-1] != 82e13 {
+		t.Fatalf("%d denominations from %v to %v", n, s.Denominations[0], s.Denominations[n-1])
+	}
+	s = NewBinaryScheme(1000)
+	if err := s.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanDenominations(t *testing.T) {
+	schemes := map[string]DenominationScheme{
+		"cashfusion": NewCashFusionScheme(1000),
+		"binary":     NewBinaryScheme(1000),
+	}
+	for name, scheme := range schemes {
+		denominations := make(map[btcutil.Amount]bool)
+		for _, d := range scheme.Denominations {
+			denominations[d] = true
+		}
+		seen := make(map[string]bool)
+		for seed := int64(0); seed < 20; seed++ {
+			const total = 12345678
+			plan, err := PlanDenominations(total, 20000, scheme, mathrand.New(mathrand.NewSource(seed)))
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			var sum btcutil.Amount
+			for _, d := range plan {
+				if !denominations[d] {
+					t.Fatalf("%s: %v is not a denomination", name, d)
+				}
+				sum += d
+			}
+			fee := total - sum
+			if fee < scheme.FeeRate.Fee(len(plan)*P2PKHOutputSize) || fee > 20000 {
+				t.Fatalf("%s: fee of %v for %d outputs", name, fee, len(plan))
+			}
+			seen[string(planKey(plan))] = true
+		}
+		if len(seen) < 2 {
+			t.Errorf("%s: every seed planned the same outputs", name)
+		}
+	}
+
+	scheme := NewCashFusionScheme(1000)
+	if _, err := PlanDenominations(10033, 1000, scheme, nil); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+	// 19999 satoshis fit a 12000 satoshis output at most, leaving more
+	// than the budget.
+	if _, err := PlanDenominations(19999, 1000, scheme, nil); !errors.Is(err, ErrFeeBudgetExceeded) {
+		t.Errorf("got %v, want ErrFeeBudgetExceeded", err)
+	}
+	scheme.MaxOutputs = 2
+	if plan, err := PlanDenominations(1e8, 1e8, scheme, nil); err != nil || len(plan) != 2 {
+		t.Errorf("got %v, %v with at most 2 outputs", plan, err)
+	}
+
+	dusty := DenominationScheme{Denominations: []btcutil.Amount{100, 1000}}
+	if _, err := PlanDenominations(1e6, 1e6, dusty, nil); !errors.Is(err, ErrDustOutput) {
+		t.Errorf("got %v, want ErrDustOutput", err)
+	}
+	unordered := DenominationScheme{Denominations: []btcutil.Amount{2000, 1000}}
+	if _, err := PlanDenominations(1e6, 1e6, unordered, nil); err == nil {
+		t.Error("unordered denominations accepted")
+	}
+}
+
+// planKey returns a key identifying plan.
+func planKey(plan []btcutil.Amount) []byte {
+	var key []byte
+	for _, d := range plan {
+		key = append(append(key, d.String()...), ',')
+	}
+	return key
+}
+
+// testAddressSource returns pay-to-pubkey-hash addresses of increasing
+// hashes.
+type testAddressSource struct {
+	n byte
+}
+
+func (s *testAddressSource) NextAddress() (btcutil.Address, error) {
+	s.n++
+	hash := make([]byte, 20)
+	hash[0] = s.n
+	return NewCashAddressPubKeyHash(hash, &chaincfg.MainNetParams)
+}
+
+func TestSetDenominatedChange(t *testing.T) {
+	key := signingTestKeys()[0]
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	dest, _ := payToPubKeyHashScript(make([]byte, 20))
+	b := NewTxBuilder(1000, pkScript)
+	b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 5e6, PkScript: pkScript})
+	b.AddOutput(wire.NewTxOut(1e6, dest))
+	addrs := &testAddressSource{}
+	b.SetDenominatedChange(NewCashFusionScheme(0), 15000, addrs, mathrand.New(mathrand.NewSource(1)))
+	b.SetShuffle(false)
+	u, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ChangeIndex != -1 || len(u.DenominatedChange) < 2 || int(addrs.n) != len(u.DenominatedChange) {
+		t.Fatalf("change %d, denominated change %v from %d addresses", u.ChangeIndex, u.DenominatedChange,
+			addrs.n)
+	}
+	if len(u.Tx.TxOut) != len(u.DenominatedChange)+1 {
+		t.Fatalf("%d outputs", len(u.Tx.TxOut))
+	}
+	var out btcutil.Amount
+	for i, txOut := range u.Tx.TxOut {
+		if bytes.Equal(txOut.PkScript, dest) && txOut.Value != 1e6 {
+			t.Fatalf("output %d pays %v to the recipient", i, btcutil.Amount(txOut.Value))
+		}
+		out += btcutil.Amount(txOut.Value)
+	}
+	for _, i := range u.DenominatedChange {
+		if bytes.Equal(u.Tx.TxOut[i].PkScript, dest) {
+			t.Fatalf("denominated change %d pays the recipient", i)
+		}
+	}
+	if u.Fee != 5e6-out || u.Fee < FeeRate(1000).Fee(u.Size) || u.Fee > FeeRate(1000).Fee(u.Size)+15000 {
+		t.Fatalf("fee %v for %d bytes", u.Fee, u.Size)
+	}
+	size, err := EstimateSignedSize(u.Tx, u.PrevOuts)
+	if err != nil || size != u.Size {
+		t.Fatalf("estimated %d bytes, %v, reported %d", size, err, u.Size)
+	}
+
+	// Small change can't be denominated within the budget.
+	b = NewTxBuilder(1000, pkScript)
+	b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 1e6 + 15000, PkScript: pkScript})
+	b.AddOutput(wire.NewTxOut(1e6, dest))
+	b.SetDenominatedChange(NewCashFusionScheme(0), 1000, &testAddressSource{}, nil)
+	if _, err := b.Build(); !errors.Is(err, ErrFeeBudgetExceeded) {
+		t.Fatalf("got %v, want ErrFeeBudgetExceeded", err)
+	}
+}
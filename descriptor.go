@@ -0,0 +1,543 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+const (
+	// descInputCharset is the set of characters descriptors are made of,
+	// ordered as required by the checksum algorithm.
+	descInputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+		"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+		"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+	// descChecksumLen is the number of characters of a descriptor checksum.
+	descChecksumLen = 8
+
+	// maxBareMultisigKeys is the maximum number of keys of a multisig
+	// descriptor which is not wrapped in sh().
+	maxBareMultisigKeys = 3
+
+	// maxScriptElementSize is the maximum size of an element pushed on the
+	// stack, which bounds the size of redeem scripts.
+	maxScriptElementSize = 520
+)
+
+var (
+	// ErrDescriptorChecksum describes an error where the checksum of a
+	// descriptor does not match.
+	ErrDescriptorChecksum = errors.New("descriptor checksum mismatch")
+
+	// ErrDescriptorNotSupported describes an error where a descriptor uses
+	// a script function that has no meaning on Bitcoin Cash.
+	ErrDescriptorNotSupported = errors.New("not supported on BCH")
+
+	// ErrNoAddress describes an error where a descriptor produces scripts
+	// that have no address form.
+	ErrNoAddress = errors.New("descriptor has no address form")
+)
+
+// unsupportedDescriptors lists the script functions of descriptors that
+// depend on segwit or taproot.
+var unsupportedDescriptors = map[string]bool{
+	"wpkh":  true,
+	"wsh":   true,
+	"tr":    true,
+	"combo": true,
+}
+
+// descPolyMod is the checksum function of descriptors.  It is the BCH code
+// CashAddr uses, with a different generator, over the symbols of the
+// expanded descriptor.
+func descPolyMod(symbols []byte) uint64 {
+	generator := [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d,
+		0x3706b1677a, 0x644d626ffd}
+	chk := uint64(1)
+	for _, value := range symbols {
+		top := chk >> 35
+		chk = (chk&0x7ffffffff)<<5 ^ uint64(value)
+		for i := uint(0); i < 5; i++ {
+			if (top>>i)&1 != 0 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// DescriptorChecksum returns the 8 character checksum of a descriptor given
+// without its checksum.
+func DescriptorChecksum(desc string) (string, error) {
+	var symbols, groups []byte
+	for i := 0; i < len(desc); i++ {
+		v := strings.IndexByte(descInputCharset, desc[i])
+		if v < 0 {
+			return "", fmt.Errorf("invalid descriptor character %q", desc[i])
+		}
+		symbols = append(symbols, byte(v&31))
+		groups = append(groups, byte(v>>5))
+		if len(groups) == 3 {
+			symbols = append(symbols, groups[0]*9+groups[1]*3+groups[2])
+			groups = groups[:0]
+		}
+	}
+	switch len(groups) {
+	case 1:
+		symbols = append(symbols, groups[0])
+	case 2:
+		symbols = append(symbols, groups[0]*3+groups[1])
+	}
+	symbols = append(symbols, make([]byte, descChecksumLen)...)
+
+	c := descPolyMod(symbols) ^ 1
+	checksum := make([]byte, descChecksumLen)
+	for i := range checksum {
+		checksum[i] = CHARSET[(c>>uint(5*(7-i)))&31]
+	}
+	return string(checksum), nil
+}
+
+// AddressEncoding selects how descriptor addresses are encoded.
+type AddressEncoding int
+
+const (
+	// CashAddrEncoding encodes addresses as CashAddr.
+	CashAddrEncoding AddressEncoding = iota
+
+	// LegacyEncoding encodes addresses in the base58 format shared with
+	// Bitcoin, for tooling which does not understand CashAddr.
+	LegacyEncoding
+)
+
+// DescriptorOutput is one output script produced by a descriptor.
+type DescriptorOutput struct {
+	Index    uint32
+	PkScript []byte
+
+	// Address is nil for scripts without an address form such as bare
+	// multisig.
+	Address btcutil.Address
+}
+
+// Descriptor is a parsed output script descriptor.  The pkh, sh, multi,
+// sortedmulti and raw script functions are supported, with keys given as hex
+// public keys, WIF private keys or extended keys followed by a derivation
+// path and an optional trailing wildcard.
+type Descriptor struct {
+	desc    string
+	root    descNode
+	params  *chaincfg.Params
+	isRange bool
+}
+
+// ParseDescriptor parses a descriptor for the passed network.  When the
+// descriptor carries a checksum it is verified.
+func ParseDescriptor(desc string, params *chaincfg.Params) (*Descriptor, error) {
+	if i := strings.IndexByte(desc, '#'); i >= 0 {
+		checksum, err := DescriptorChecksum(desc[:i])
+		if err != nil {
+			return nil, err
+		}
+		if desc[i+1:] != checksum {
+			return nil, ErrDescriptorChecksum
+		}
+		desc = desc[:i]
+	}
+
+	p := &descParser{params: params}
+	root, err := p.parseScript(desc, descTop)
+	if err != nil {
+		return nil, err
+	}
+	return &Descriptor{desc: desc, root: root, params: params, isRange: p.isRange}, nil
+}
+
+// String returns the descriptor with its checksum.
+func (d *Descriptor) String() string {
+	checksum, _ := DescriptorChecksum(d.desc)
+	return d.desc + "#" + checksum
+}
+
+// IsRange returns whether the descriptor has a wildcard and produces a
+// different script for every index.
+func (d *Descriptor) IsRange() bool {
+	return d.isRange
+}
+
+// PkScript returns the output script of the descriptor at index.  The index
+// is ignored by descriptors without wildcard.
+func (d *Descriptor) PkScript(index uint32) ([]byte, error) {
+	return d.root.script(index)
+}
+
+// Address returns the address of the descriptor at index.
+func (d *Descriptor) Address(index uint32, encoding AddressEncoding) (btcutil.Address, error) {
+	pkScript, err := d.PkScript(index)
+	if err != nil {
+		return nil, err
+	}
+	return d.scriptAddress(pkScript, encoding)
+}
+
+// Derive returns the outputs of the descriptor for the indexes in
+// [start, end].
+func (d *Descriptor) Derive(start, end uint32, encoding AddressEncoding) ([]DescriptorOutput, error) {
+	if end < start {
+		return nil, errors.New("invalid index range")
+	}
+	if !d.isRange {
+		end = start
+	}
+	outputs := make([]DescriptorOutput, 0, end-start+1)
+	for i := start; ; i++ {
+		pkScript, err := d.PkScript(i)
+		if err != nil {
+			return nil, fmt.Errorf("index %d: %v", i, err)
+		}
+		addr, err := d.scriptAddress(pkScript, encoding)
+		if err != nil && err != ErrNoAddress {
+			return nil, err
+		}
+		outputs = append(outputs, DescriptorOutput{Index: i, PkScript: pkScript, Address: addr})
+		if i == end {
+			break
+		}
+	}
+	return outputs, nil
+}
+
+// scriptAddress returns the address paying to pkScript.
+func (d *Descriptor) scriptAddress(pkScript []byte, encoding AddressEncoding) (btcutil.Address, error) {
+	addr, err := ExtractPkScriptAddrs(pkScript, d.params)
+	if err != nil {
+		return nil, ErrNoAddress
+	}
+	if encoding == LegacyEncoding {
+		switch addr.(type) {
+		case *CashAddressPubKeyHash:
+			return btcutil.NewAddressPubKeyHash(addr.ScriptAddress(), d.params)
+		case *CashAddressScriptHash:
+			return btcutil.NewAddressScriptHashFromHash(addr.ScriptAddress(), d.params)
+		}
+	}
+	return addr, nil
+}
+
+// descContext is the position of a script expression in the descriptor,
+// which restricts the functions allowed.
+type descContext int
+
+const (
+	descTop descContext = iota
+	descP2SH
+)
+
+// descNode is a script expression of a descriptor.
+type descNode interface {
+	script(index uint32) ([]byte, error)
+}
+
+type pkhNode struct {
+	key *descKey
+}
+
+func (n *pkhNode) script(index uint32) ([]byte, error) {
+	pubKey, err := n.key.pubKeyBytes(index)
+	if err != nil {
+		return nil, err
+	}
+	return payToPubKeyHashScript(btcutil.Hash160(pubKey))
+}
+
+type shNode struct {
+	inner descNode
+}
+
+func (n *shNode) script(index uint32) ([]byte, error) {
+	redeemScript, err := n.inner.script(index)
+	if err != nil {
+		return nil, err
+	}
+	if len(redeemScript) > maxScriptElementSize {
+		return nil, fmt.Errorf("redeem script is %d bytes, more than the %d allowed",
+			len(redeemScript), maxScriptElementSize)
+	}
+	return payToScriptHashScript(btcutil.Hash160(redeemScript))
+}
+
+type multiNode struct {
+	required int
+	keys     []*descKey
+	sorted   bool
+}
+
+func (n *multiNode) script(index uint32) ([]byte, error) {
+	pubKeys := make([][]byte, 0, len(n.keys))
+	for _, key := range n.keys {
+		pubKey, err := key.pubKeyBytes(index)
+		if err != nil {
+			return nil, err
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	if n.sorted {
+		sort.Slice(pubKeys, func(i, j int) bool {
+			return bytes.Compare(pubKeys[i], pubKeys[j]) < 0
+		})
+	}
+
+	builder := txscript.NewScriptBuilder().AddInt64(int64(n.required))
+	for _, pubKey := range pubKeys {
+		builder.AddData(pubKey)
+	}
+	builder.AddInt64(int64(len(pubKeys)))
+	builder.AddOp(txscript.OP_CHECKMULTISIG)
+	return builder.Script()
+}
+
+type rawNode struct {
+	pkScript []byte
+}
+
+func (n *rawNode) script(uint32) ([]byte, error) {
+	return n.pkScript, nil
+}
+
+// descKey is a key expression of a descriptor.
+type descKey struct {
+	pubKey     []byte
+	extKey     *hdkeychain.ExtendedKey
+	path       Path
+	wildcard   bool
+	hardenedWC bool
+}
+
+// pubKeyBytes returns the serialized public key the key expression resolves
+// to at index.
+func (k *descKey) pubKeyBytes(index uint32) ([]byte, error) {
+	if k.extKey == nil {
+		return k.pubKey, nil
+	}
+	key, err := k.path.Derive(k.extKey)
+	if err != nil {
+		return nil, err
+	}
+	if k.wildcard {
+		if index >= hdkeychain.HardenedKeyStart {
+			return nil, errors.New("wildcard index out of range")
+		}
+		if k.hardenedWC {
+			index += hdkeychain.HardenedKeyStart
+		}
+		key, err = key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pubKey, err := key.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	return pubKey.SerializeCompressed(), nil
+}
+
+// descParser holds the state of the parsing of one descriptor.
+type descParser struct {
+	params  *chaincfg.Params
+	isRange bool
+}
+
+// splitFunc splits "name(args)" into its name and arguments.
+func splitFunc(expr string) (string, string, bool) {
+	open := strings.IndexByte(expr, '(')
+	if open <= 0 || !strings.HasSuffix(expr, ")") {
+		return "", "", false
+	}
+	return expr[:open], expr[open+1 : len(expr)-1], true
+}
+
+// splitArgs splits a comma separated argument list, ignoring the commas
+// nested in parentheses.
+func splitArgs(args string) ([]string, error) {
+	var (
+		parts []string
+		depth int
+		start int
+	)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, args[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("unbalanced parentheses")
+	}
+	return append(parts, args[start:]), nil
+}
+
+func (p *descParser) parseScript(expr string, ctx descContext) (descNode, error) {
+	name, args, ok := splitFunc(expr)
+	if !ok {
+		return nil, fmt.Errorf("invalid script expression %q", expr)
+	}
+	if unsupportedDescriptors[name] {
+		return nil, fmt.Errorf("%s(): %w", name, ErrDescriptorNotSupported)
+	}
+
+	switch name {
+	case "pkh":
+		key, err := p.parseKey(args)
+		if err != nil {
+			return nil, err
+		}
+		return &pkhNode{key: key}, nil
+
+	case "sh":
+		if ctx != descTop {
+			return nil, errors.New("sh() is only allowed at the top level")
+		}
+		inner, err := p.parseScript(args, descP2SH)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := inner.(*rawNode); ok {
+			return nil, errors.New("raw() is only allowed at the top level")
+		}
+		return &shNode{inner: inner}, nil
+
+	case "multi", "sortedmulti":
+		parts, err := splitArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("%s() needs a threshold and at least one key", name)
+		}
+		required, err := strconv.Atoi(parts[0])
+		if err != nil || required < 1 || required > len(parts)-1 {
+			return nil, fmt.Errorf("invalid %s() threshold %q", name, parts[0])
+		}
+		if ctx == descTop && len(parts)-1 > maxBareMultisigKeys {
+			return nil, fmt.Errorf("bare %s() can have at most %d keys",
+				name, maxBareMultisigKeys)
+		}
+		if len(parts)-1 > txscript.MaxPubKeysPerMultiSig {
+			return nil, fmt.Errorf("%s() can have at most %d keys",
+				name, txscript.MaxPubKeysPerMultiSig)
+		}
+		node := &multiNode{required: required, sorted: name == "sortedmulti"}
+		for _, part := range parts[1:] {
+			key, err := p.parseKey(part)
+			if err != nil {
+				return nil, err
+			}
+			node.keys = append(node.keys, key)
+		}
+		return node, nil
+
+	case "raw":
+		if ctx != descTop {
+			return nil, errors.New("raw() is only allowed at the top level")
+		}
+		pkScript, err := hex.DecodeString(args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid raw() script: %v", err)
+		}
+		return &rawNode{pkScript: pkScript}, nil
+	}
+	return nil, fmt.Errorf("unknown script function %s()", name)
+}
+
+func (p *descParser) parseKey(expr string) (*descKey, error) {
+	// Key origin information is only informative.
+	if strings.HasPrefix(expr, "[") {
+		end := strings.IndexByte(expr, ']')
+		if end < 0 {
+			return nil, errors.New("unterminated key origin")
+		}
+		origin := strings.SplitN(expr[1:end], "/", 2)
+		if fp, err := hex.DecodeString(origin[0]); err != nil || len(fp) != 4 {
+			return nil, fmt.Errorf("invalid key origin fingerprint %q", origin[0])
+		}
+		if len(origin) == 2 {
+			if _, err := ParseDerivationPath(origin[1]); err != nil {
+				return nil, err
+			}
+		}
+		expr = expr[end+1:]
+	}
+
+	if raw, err := hex.DecodeString(expr); err == nil {
+		if _, err := btcec.ParsePubKey(raw, btcec.S256()); err != nil {
+			return nil, fmt.Errorf("invalid public key %q: %v", expr, err)
+		}
+		return &descKey{pubKey: raw}, nil
+	}
+
+	parts := strings.SplitN(expr, "/", 2)
+	if wif, err := btcutil.DecodeWIF(parts[0]); err == nil && len(parts) == 1 {
+		if !wif.IsForNet(p.params) {
+			return nil, errors.New("private key is for another network")
+		}
+		return &descKey{pubKey: wif.SerializePubKey()}, nil
+	}
+
+	// SLIP-132 keys, such as the zpubs of some wallets, are the keys of
+	// their standard xpubs.
+	extKey, _, err := DecodeExtendedKey(parts[0], p.params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %q: %w", parts[0], err)
+	}
+	key := &descKey{extKey: extKey}
+	if len(parts) == 1 {
+		return key, nil
+	}
+
+	path := parts[1]
+	switch {
+	case path == "*" || strings.HasSuffix(path, "/*"):
+		key.wildcard = true
+		path = strings.TrimSuffix(strings.TrimSuffix(path, "*"), "/")
+	case path == "*'" || path == "*h" || strings.HasSuffix(path, "/*'") ||
+		strings.HasSuffix(path, "/*h"):
+		key.wildcard = true
+		key.hardenedWC = true
+		path = strings.TrimSuffix(path[:len(path)-2], "/")
+	}
+	if path != "" {
+		key.path, err = ParseDerivationPath(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if (key.hardenedWC || key.path.IsHardened()) && !extKey.IsPrivate() {
+		return nil, errors.New("hardened derivation requires a private extended key")
+	}
+	if key.wildcard {
+		p.isRange = true
+	}
+	return key, nil
+}
@@ -0,0 +1,204 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+var descriptorChecksums = []struct {
+	desc     string
+	checksum string
+}{
+	{"raw(deadbeef)", "89f8spxm"},
+	{"pkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)", "8fhd9pwu"},
+}
+
+func TestDescriptorChecksum(t *testing.T) {
+	for _, test := range descriptorChecksums {
+		checksum, err := DescriptorChecksum(test.desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if checksum != test.checksum {
+			t.Errorf("%s: checksum %s, want %s", test.desc, checksum, test.checksum)
+		}
+		d, err := ParseDescriptor(test.desc+"#"+test.checksum, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Errorf("%s: %v", test.desc, err)
+			continue
+		}
+		if d.String() != test.desc+"#"+test.checksum {
+			t.Errorf("%s: String() = %s", test.desc, d)
+		}
+	}
+
+	if _, err := ParseDescriptor("raw(deadbeef)#89f8spxx", &chaincfg.MainNetParams); err != ErrDescriptorChecksum {
+		t.Errorf("expected ErrDescriptorChecksum, got %v", err)
+	}
+}
+
+// descTestKey returns the master key of BIP32 test vector 1.
+func descTestKey() *hdkeychain.ExtendedKey {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	return master
+}
+
+func TestDescriptorPkScript(t *testing.T) {
+	pubKey, _ := hex.DecodeString("02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5")
+	pkh, _ := payToPubKeyHashScript(btcutil.Hash160(pubKey))
+
+	d, err := ParseDescriptor("pkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.IsRange() {
+		t.Error("descriptor without wildcard is a range")
+	}
+	pkScript, _ := d.PkScript(0)
+	if !bytes.Equal(pkScript, pkh) {
+		t.Errorf("pkScript %x, want %x", pkScript, pkh)
+	}
+
+	d, err = ParseDescriptor("sh(multi(1,02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5))", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redeemScript, _ := hex.DecodeString("512102c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee551ae")
+	want, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+	pkScript, _ = d.PkScript(0)
+	if !bytes.Equal(pkScript, want) {
+		t.Errorf("pkScript %x, want %x", pkScript, want)
+	}
+	addr, err := d.Address(0, LegacyEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := addr.(*btcutil.AddressScriptHash); !ok {
+		t.Errorf("legacy encoding returned %T", addr)
+	}
+
+	d, _ = ParseDescriptor("multi(1,02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)", &chaincfg.MainNetParams)
+	if _, err := d.Address(0, CashAddrEncoding); err != ErrNoAddress {
+		t.Errorf("bare multisig: expected ErrNoAddress, got %v", err)
+	}
+}
+
+func TestDescriptorSortedMulti(t *testing.T) {
+	keys := []string{
+		"03fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a1460297556",
+		"02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5",
+	}
+	sorted, err := ParseDescriptor("sh(sortedmulti(1,"+keys[0]+","+keys[1]+"))", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multi, err := ParseDescriptor("sh(multi(1,"+keys[1]+","+keys[0]+"))", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := sorted.PkScript(0)
+	b, _ := multi.PkScript(0)
+	if !bytes.Equal(a, b) {
+		t.Error("sortedmulti does not sort its keys")
+	}
+}
+
+func TestDescriptorDerive(t *testing.T) {
+	master := descTestKey()
+	d, err := ParseDescriptor("pkh("+master.String()+"/0'/1/*)", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.IsRange() {
+		t.Error("descriptor with wildcard is not a range")
+	}
+	outputs, err := d.Derive(0, 2, CashAddrEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 3 {
+		t.Fatalf("derived %d outputs, want 3", len(outputs))
+	}
+
+	// The same keys derived from the public m/0'/1 key.
+	child, _ := master.Child(hdkeychain.HardenedKeyStart)
+	child, _ = child.Child(1)
+	xpub, _ := child.Neuter()
+	parent, err := ParseDescriptor("pkh("+xpub.String()+"/*)", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, out := range outputs {
+		pkScript, err := parent.PkScript(out.Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pkScript, out.PkScript) {
+			t.Errorf("index %d: pkScript %x, want %x", out.Index, out.PkScript, pkScript)
+		}
+		if _, ok := out.Address.(*CashAddressPubKeyHash); !ok {
+			t.Errorf("index %d: address is %T", out.Index, out.Address)
+		}
+	}
+	if outputs[0].Address.String() == outputs[1].Address.String() {
+		t.Error("wildcard derived the same address twice")
+	}
+}
+
+func TestDescriptorInvalid(t *testing.T) {
+	unsupported := []string{
+		"wpkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)",
+		"sh(wsh(multi(1,02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)))",
+		"tr(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)",
+	}
+	for _, desc := range unsupported {
+		if _, err := ParseDescriptor(desc, &chaincfg.MainNetParams); !errors.Is(err, ErrDescriptorNotSupported) {
+			t.Errorf("%s: expected ErrDescriptorNotSupported, got %v", desc, err)
+		}
+	}
+
+	xpub, _ := descTestKey().Neuter()
+	invalid := []string{
+		"pkh(02c6047f)",
+		"sh(sh(raw(deadbeef)))",
+		"sh(raw(deadbeef))",
+		"multi(3,02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)",
+		"pkh(" + xpub.String() + "/0'/*)",
+		"pkh(" + xpub.String() + "/x/*)",
+		"foo(00)",
+	}
+	for _, desc := range invalid {
+		if _, err := ParseDescriptor(desc, &chaincfg.MainNetParams); err == nil {
+			t.Errorf("%s: expected an error", desc)
+		}
+	}
+	if _, err := ParseDescriptor("pkh("+xpub.String()+"/*)", &chaincfg.TestNet3Params); err == nil {
+		t.Error("mainnet key accepted on testnet")
+	}
+}
+
+func TestDescriptorSLIP132Key(t *testing.T) {
+	xpub, _ := bip84Account(t).Neuter()
+	zpub, err := ParseDescriptor("pkh("+bip84AccountZpub+"/0/*)", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standard, err := ParseDescriptor("pkh("+xpub.String()+"/0/*)", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint32(0); i < 3; i++ {
+		a, _ := zpub.PkScript(i)
+		b, _ := standard.PkScript(i)
+		if !bytes.Equal(a, b) {
+			t.Errorf("index %d: script %x, want %x", i, a, b)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Fabcien/bchutil/sig"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrDeviceSignature describes an error where a signature returned by a
+// signing device is malformed or does not verify.
+var ErrDeviceSignature = errors.New("invalid device signature")
+
+// DeviceInput is what a hardware signing device needs to sign one input.  It
+// holds the fields of the BIP143 signature preimage, with the hashes of the
+// prevouts, sequences and outputs already computed so that the host streams
+// a few hundred bytes per input instead of the whole transaction.
+type DeviceInput struct {
+	Index int
+
+	Version      int32
+	HashPrevOuts chainhash.Hash
+	HashSequence chainhash.Hash
+	OutPoint     wire.OutPoint
+	ScriptCode   []byte
+	Amount       int64
+	Sequence     uint32
+	HashOutputs  chainhash.Hash
+	LockTime     uint32
+	HashType     txscript.SigHashType
+
+	// TokenPrefix is the CashTokens prefix of the spent output, committed
+	// to between OutPoint and ScriptCode, nil if none.
+	TokenPrefix []byte
+
+	// Paths are the derivation paths of the keys expected to sign.
+	Paths []Path
+}
+
+// Preimage returns the serialized BIP143 preimage of the input, as hashed by
+// the device before signing.
+func (in *DeviceInput) Preimage() []byte {
+	f := &SigHashFields{
+		Version:      in.Version,
+		HashPrevouts: in.HashPrevOuts,
+		HashSequence: in.HashSequence,
+		OutPoint:     in.OutPoint,
+		TokenPrefix:  in.TokenPrefix,
+		ScriptCode:   in.ScriptCode,
+		Amount:       in.Amount,
+		Sequence:     in.Sequence,
+		HashOutputs:  in.HashOutputs,
+		LockTime:     in.LockTime,
+		HashType:     in.HashType,
+	}
+	return f.preimage()
+}
+
+// SigHash returns the digest signed for the input.
+func (in *DeviceInput) SigHash() []byte {
+	return chainhash.DoubleHashB(in.Preimage())
+}
+
+// DeviceSession adapts a SigningRequest to the streaming protocols of
+// hardware wallets.  Next yields the inputs to send to the device one at a
+// time, and AddSignature assembles the signatures it returns.
+type DeviceSession struct {
+	req       *SigningRequest
+	sigHashes *txscript.TxSigHashes
+	next      int
+	resp      *SigningResponse
+}
+
+// NewDeviceSession returns a session signing the inputs of req.
+func NewDeviceSession(req *SigningRequest) (*DeviceSession, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return &DeviceSession{
+		req:       req,
+		sigHashes: txscript.NewTxSigHashes(req.Tx),
+		resp:      &SigningResponse{TxID: req.Tx.TxHash()},
+	}, nil
+}
+
+// Next returns the next input to sign, or false when all inputs were
+// returned.
+func (s *DeviceSession) Next() (*DeviceInput, bool) {
+	if s.next >= len(s.req.Inputs) {
+		return nil, false
+	}
+	in := s.input(s.next)
+	s.next++
+	return in, true
+}
+
+// Input returns the payload of input idx.
+func (s *DeviceSession) Input(idx int) (*DeviceInput, error) {
+	if idx < 0 || idx >= len(s.req.Inputs) {
+		return nil, fmt.Errorf("input index %d out of range", idx)
+	}
+	return s.input(idx), nil
+}
+
+// input builds the payload of input idx, zeroing the hashes excluded by its
+// sighash type as calcBip143SignatureHash does.
+func (s *DeviceSession) input(idx int) *DeviceInput {
+	signing := &s.req.Inputs[idx]
+	f := txSigHashFields(signing.scriptCode(), s.sigHashes, signing.HashType, s.req.Tx, idx,
+		int64(signing.Amount), 0, signing.TokenData)
+	return &DeviceInput{
+		Index:        idx,
+		Version:      f.Version,
+		HashPrevOuts: f.HashPrevouts,
+		HashSequence: f.HashSequence,
+		OutPoint:     f.OutPoint,
+		ScriptCode:   f.ScriptCode,
+		Amount:       f.Amount,
+		TokenPrefix:  f.TokenPrefix,
+		Sequence:     f.Sequence,
+		HashOutputs:  f.HashOutputs,
+		LockTime:     f.LockTime,
+		HashType:     f.HashType,
+		Paths:        signing.Paths,
+	}
+}
+
+// AddSignature records the DER signature returned by the device for input idx
+// with pubKey after checking that it verifies.  The sighash type byte is
+// appended by the session.
+func (s *DeviceSession) AddSignature(idx int, pubKey, der []byte) error {
+	in, err := s.Input(idx)
+	if err != nil {
+		return err
+	}
+	key, err := btcec.ParsePubKey(pubKey, btcec.S256())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDeviceSignature, err)
+	}
+	parsed, err := sig.ParseDERSignature(der, true)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDeviceSignature, err)
+	}
+	if !sig.IsLowS(parsed) {
+		return fmt.Errorf("%w: high S value", ErrDeviceSignature)
+	}
+	if !parsed.Verify(in.SigHash(), key) {
+		return fmt.Errorf("%w: input %d signature does not verify", ErrDeviceSignature, idx)
+	}
+
+	signature := make([]byte, 0, len(der)+1)
+	signature = append(signature, der...)
+	signature = append(signature, byte(in.HashType))
+	s.resp.Signatures = append(s.resp.Signatures, InputSignature{
+		Index:     uint32(idx),
+		PubKey:    pubKey,
+		Signature: signature,
+	})
+	return nil
+}
+
+// Response returns the signatures collected so far as a SigningResponse.
+func (s *DeviceSession) Response() *SigningResponse {
+	return s.resp
+}
+
+// Tx returns the transaction with the collected signatures applied.
+func (s *DeviceSession) Tx() (*wire.MsgTx, error) {
+	return ApplyResponse(s.req.Tx, s.resp)
+}
@@ -0,0 +1,167 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/Fabcien/bchutil/sig"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// fakeDevice signs like a hardware wallet: it only sees the streamed input
+// payloads and derives its keys from its own master key.
+type fakeDevice struct {
+	master *hdkeychain.ExtendedKey
+}
+
+func (d *fakeDevice) sign(in *DeviceInput) (pubKey, der []byte, err error) {
+	key, err := in.Paths[0].Derive(d.master)
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, err := key.ECPrivKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err := priv.Sign(in.SigHash())
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv.PubKey().SerializeCompressed(), sig.Serialize(), nil
+}
+
+func deviceTestRequest(t *testing.T, master *hdkeychain.ExtendedKey) *SigningRequest {
+	var keys []*btcec.PrivateKey
+	for i := uint32(0); i < 2; i++ {
+		key, _ := BIP44Path(0, 0, i).Derive(master)
+		priv, err := key.ECPrivKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, priv)
+	}
+	return signingTestRequest(keys)
+}
+
+func TestDeviceSession(t *testing.T) {
+	device := &fakeDevice{master: descTestKey()}
+	req := deviceTestRequest(t, device.master)
+	req.Inputs[1].HashType |= txscript.SigHashAnyOneCanPay
+
+	session, err := NewDeviceSession(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for in, ok := session.Next(); ok; in, ok = session.Next() {
+		want, _ := req.SigHash(in.Index)
+		if !bytes.Equal(in.SigHash(), want) {
+			t.Errorf("input %d: payload digest differs from the transaction digest", in.Index)
+		}
+		pubKey, der, err := device.sign(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := session.AddSignature(in.Index, pubKey, der); err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	if count != len(req.Inputs) {
+		t.Errorf("iterated over %d inputs, want %d", count, len(req.Inputs))
+	}
+
+	if err := req.ValidateResponse(session.Response()); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := session.Tx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) == 0 {
+			t.Errorf("input %d is not signed", i)
+		}
+	}
+}
+
+// TestDeviceTokenInput signs an input spending a token output, whose digest
+// commits to the token prefix the payload carries.
+func TestDeviceTokenInput(t *testing.T) {
+	device := &fakeDevice{master: descTestKey()}
+	req := deviceTestRequest(t, device.master)
+	token := &TokenData{Category: chainhash.Hash{4}, HasNFT: true, Capability: NFTMutable}
+	req.Inputs[0].TokenData = token.Bytes()
+
+	session, err := NewDeviceSession(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in, ok := session.Next(); ok; in, ok = session.Next() {
+		pubKey, der, err := device.sign(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := session.AddSignature(in.Index, pubKey, der); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in, _ := session.Input(0)
+	if !bytes.Equal(in.TokenPrefix, token.Bytes()) {
+		t.Fatalf("got token prefix %x", in.TokenPrefix)
+	}
+	tx, err := session.Tx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript := append(token.Bytes(), req.Inputs[0].PkScript...)
+	vm, err := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, int64(req.Inputs[0].Amount))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Execute(); err != nil {
+		t.Errorf("token input signature: %v", err)
+	}
+}
+
+func TestDeviceBadSignature(t *testing.T) {
+	device := &fakeDevice{master: descTestKey()}
+	req := deviceTestRequest(t, device.master)
+	session, err := NewDeviceSession(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in0, _ := session.Next()
+	in1, _ := session.Next()
+	pubKey, der, _ := device.sign(in0)
+
+	// A signature for another input.
+	if err := session.AddSignature(in1.Index, pubKey, der); !errors.Is(err, ErrDeviceSignature) {
+		t.Errorf("expected ErrDeviceSignature, got %v", err)
+	}
+
+	// The same signature with a high S value, which Serialize would
+	// canonicalize.
+	parsed, _ := sig.ParseDERSignature(der, true)
+	highS := sig.SerializeDER(&btcec.Signature{R: parsed.R, S: new(big.Int).Sub(btcec.S256().N, parsed.S)})
+	if err := session.AddSignature(in0.Index, pubKey, highS); !errors.Is(err, ErrDeviceSignature) {
+		t.Errorf("high S: expected ErrDeviceSignature, got %v", err)
+	}
+	if err := session.AddSignature(in0.Index, pubKey, der[:len(der)-1]); !errors.Is(err, ErrDeviceSignature) {
+		t.Errorf("truncated signature: expected ErrDeviceSignature, got %v", err)
+	}
+	if err := session.AddSignature(in0.Index, []byte{0x02}, der); !errors.Is(err, ErrDeviceSignature) {
+		t.Errorf("bad public key: expected ErrDeviceSignature, got %v", err)
+	}
+	if _, err := session.Input(2); err == nil {
+		t.Error("out of range input accepted")
+	}
+	if len(session.Response().Signatures) != 0 {
+		t.Error("invalid signatures were recorded")
+	}
+}
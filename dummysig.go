@@ -0,0 +1,143 @@
+package bchutil
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Placeholders of the signatures of scriptSigs, of the largest ECDSA DER
+// encoding and of the Schnorr length, with their sighash type.
+var (
+	dummyECDSASignature   = append(make([]byte, 72), byte(SigHashAllForkID))
+	dummySchnorrSignature = append(make([]byte, SchnorrSignatureLen), byte(SigHashAllForkID))
+)
+
+// DummySignatureScript returns a placeholder scriptSig of the size of the
+// largest scriptSig spending a script of class, so that fees can be computed
+// before the transaction is signed.  Its signatures are Schnorr signatures
+// when schnorr is set and otherwise ECDSA signatures of the largest DER
+// encoding, and pay-to-pubkey-hash scripts are spent with a compressed or
+// uncompressed public key.  redeemScript is the multisig script of bare
+// multisig scripts, and the redeem script, pushed last, of pay-to-script-hash
+// scripts.
+func DummySignatureScript(class txscript.ScriptClass, redeemScript []byte, schnorr bool,
+	compressedPubKey bool) ([]byte, error) {
+
+	builder := txscript.NewScriptBuilder()
+	if err := addDummySignatures(builder, class, redeemScript, schnorr, compressedPubKey); err != nil {
+		return nil, err
+	}
+	if class == txscript.ScriptHashTy {
+		builder.AddData(redeemScript)
+	}
+	return builder.Script()
+}
+
+// addDummySignatures adds to builder the placeholder pushes spending a script
+// of class, without the redeem script of pay-to-script-hash scripts.
+func addDummySignatures(builder *txscript.ScriptBuilder, class txscript.ScriptClass, redeemScript []byte,
+	schnorr bool, compressedPubKey bool) error {
+
+	sig := dummyECDSASignature
+	if schnorr {
+		sig = dummySchnorrSignature
+	}
+	switch class {
+	case txscript.PubKeyHashTy:
+		pubKey := make([]byte, 65)
+		if compressedPubKey {
+			pubKey = make([]byte, 33)
+		}
+		builder.AddData(sig).AddData(pubKey)
+	case txscript.PubKeyTy:
+		builder.AddData(sig)
+	case txscript.MultiSigTy:
+		pubKeys, nRequired, ok := multisigPubKeys(redeemScript)
+		if !ok {
+			return fmt.Errorf("%w: script is not multisig", ErrNonStandardScript)
+		}
+		if schnorr {
+			// The bitfield is pushed in the most bytes it may take.
+			builder.AddData(bytes.Repeat([]byte{0xff}, (len(pubKeys)+7)/8))
+		} else {
+			builder.AddOp(txscript.OP_0)
+		}
+		for i := 0; i < nRequired; i++ {
+			builder.AddData(sig)
+		}
+	case txscript.ScriptHashTy:
+		redeemClass := txscript.GetScriptClass(redeemScript)
+		if redeemClass == txscript.ScriptHashTy {
+			return fmt.Errorf("%w: pay-to-script-hash redeem script", ErrNonStandardScript)
+		}
+		return addDummySignatures(builder, redeemClass, redeemScript, schnorr, compressedPubKey)
+	default:
+		return fmt.Errorf("%w: cannot sign %v scripts", ErrNonStandardScript, class)
+	}
+	return nil
+}
+
+// FillDummySignatures sets the scriptSigs of the inputs of tx without scriptSig
+// to placeholders of the size EstimateSignedSize assumes, ECDSA signatures and
+// compressed public keys, so that tx.SerializeSize is the size of the signed
+// transaction.  prevOuts holds the outputs spent by those inputs, whose
+// scripts may start with a token prefix.  tx is left unchanged on errors.
+func FillDummySignatures(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut) error {
+	scriptSigs := make(map[int][]byte)
+	for i, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) != 0 {
+			continue
+		}
+		prevOut, ok := prevOuts[i]
+		if !ok || prevOut == nil {
+			return fmt.Errorf("no previous output for input %d", i)
+		}
+		_, pkScript, err := SplitTokenPrefix(prevOut.PkScript)
+		if err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+		class := txscript.GetScriptClass(pkScript)
+		if class == txscript.ScriptHashTy {
+			return fmt.Errorf("input %d: pay-to-script-hash output without redeem script", i)
+		}
+		if scriptSigs[i], err = DummySignatureScript(class, pkScript, false, true); err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	for i, scriptSig := range scriptSigs {
+		tx.TxIn[i].SignatureScript = scriptSig
+	}
+	return nil
+}
+
+// StripDummySignatures clears the scriptSigs of tx pushing a placeholder
+// signature, as set by FillDummySignatures or DummySignatureScript, and
+// returns the number of inputs cleared.
+func StripDummySignatures(tx *wire.MsgTx) int {
+	n := 0
+	for _, txIn := range tx.TxIn {
+		if isDummySignatureScript(txIn.SignatureScript) {
+			txIn.SignatureScript = nil
+			n++
+		}
+	}
+	return n
+}
+
+// isDummySignatureScript returns whether scriptSig pushes a placeholder
+// signature.
+func isDummySignatureScript(scriptSig []byte) bool {
+	ops, err := parseScript(scriptSig)
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if bytes.Equal(op.data, dummyECDSASignature) || bytes.Equal(op.data, dummySchnorrSignature) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package bchutil
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestDummySignatureScript(t *testing.T) {
+	keys := signingTestKeys()
+	var pubKeys []*btcutil.AddressPubKey
+	for _, key := range keys {
+		pubKey, _ := btcutil.NewAddressPubKey(key.PubKey().SerializeCompressed(), &chaincfg.MainNetParams)
+		pubKeys = append(pubKeys, pubKey)
+	}
+	multisig, err := txscript.MultiSigScript(pubKeys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pk, _ := txscript.PayToAddrScript(pubKeys[0])
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(keys[0].PubKey().SerializeCompressed()))
+
+	// The placeholders are as large as estimated.
+	for _, pkScript := range [][]byte{p2pkh, p2pk, multisig} {
+		class := txscript.GetScriptClass(pkScript)
+		scriptSig, err := DummySignatureScript(class, pkScript, false, true)
+		if err != nil {
+			t.Fatalf("%v: %v", class, err)
+		}
+		if want, _ := EstimateScriptSigSize(pkScript); len(scriptSig) != want {
+			t.Errorf("%v: %d bytes, estimated %d", class, len(scriptSig), want)
+		}
+	}
+
+	tests := []struct {
+		class        txscript.ScriptClass
+		redeemScript []byte
+		schnorr      bool
+		compressed   bool
+		size         int
+	}{
+		{txscript.PubKeyHashTy, nil, false, false, P2PKHUncompressedScriptSigSize},
+		{txscript.PubKeyHashTy, nil, true, true, 1 + 65 + 1 + 33},
+		{txscript.PubKeyTy, nil, true, true, 1 + 65},
+		// The bitfield of 2 keys is pushed in 2 bytes.
+		{txscript.MultiSigTy, multisig, true, true, 2 + 2*(1+65)},
+		{txscript.ScriptHashTy, multisig, false, true, 1 + 2*maxSigPushSize + 1 + len(multisig)},
+		{txscript.ScriptHashTy, multisig, true, true, 2 + 2*(1+65) + 1 + len(multisig)},
+	}
+	for _, test := range tests {
+		scriptSig, err := DummySignatureScript(test.class, test.redeemScript, test.schnorr, test.compressed)
+		if err != nil {
+			t.Fatalf("%v: %v", test.class, err)
+		}
+		if len(scriptSig) != test.size {
+			t.Errorf("%v schnorr %v: %d bytes, want %d", test.class, test.schnorr, len(scriptSig), test.size)
+		}
+	}
+
+	for _, class := range []txscript.ScriptClass{txscript.NullDataTy, txscript.NonStandardTy, txscript.MultiSigTy} {
+		if _, err := DummySignatureScript(class, p2pkh, false, true); err == nil {
+			t.Errorf("%v: no error", class)
+		}
+	}
+}
+
+func TestFillDummySignatures(t *testing.T) {
+	keys := signingTestKeys()
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(keys[0].PubKey().SerializeCompressed()))
+	tx := engineTestTx(nil)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&tx.TxIn[0].PreviousOutPoint.Hash, 1), []byte{txscript.OP_TRUE}, nil))
+	prevOuts := map[int]*wire.TxOut{0: wire.NewTxOut(2000, p2pkh)}
+
+	estimated, err := EstimateSignedSize(tx, prevOuts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := FillDummySignatures(tx, prevOuts); err != nil {
+		t.Fatal(err)
+	}
+	if size := tx.SerializeSize(); size != estimated {
+		t.Errorf("filled size %d, estimated %d", size, estimated)
+	}
+
+	// The signed transaction is no larger.
+	signed := tx.Copy()
+	signed.TxIn[0].SignatureScript, err = txscript.SignatureScript(signed, 0, p2pkh, SigHashAllForkID, keys[0], true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := StripDummySignatures(signed); n != 0 {
+		t.Errorf("%d signed inputs stripped", n)
+	}
+
+	if n := StripDummySignatures(tx); n != 1 {
+		t.Errorf("%d inputs stripped, want 1", n)
+	}
+	if tx.TxIn[0].SignatureScript != nil || !bytes.Equal(tx.TxIn[1].SignatureScript, []byte{txscript.OP_TRUE}) {
+		t.Error("wrong scriptSigs stripped")
+	}
+
+	// Unknown redeem scripts fail without changing the transaction.
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&tx.TxIn[0].PreviousOutPoint.Hash, 2), nil, nil))
+	p2sh, _ := txscript.PayToAddrScript(mustScriptHash(t, p2pkh))
+	prevOuts[2] = wire.NewTxOut(1000, p2sh)
+	if err := FillDummySignatures(tx, prevOuts); err == nil {
+		t.Error("pay-to-script-hash input filled")
+	}
+	if tx.TxIn[0].SignatureScript != nil {
+		t.Error("transaction changed on error")
+	}
+}
+
+func mustScriptHash(t *testing.T, script []byte) btcutil.Address {
+	addr, err := btcutil.NewAddressScriptHash(script, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
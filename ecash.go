@@ -0,0 +1,46 @@
+package bchutil
+
+import (
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// eCash (XEC) shares the transaction format and the fork id signatures of
+// Bitcoin Cash, so its addresses and transactions are handled like those of
+// BCH with the following network parameters, whose CashAddr prefixes are
+// ecash and ectest.  They are not registered with chaincfg.Register, which
+// rejects the networks sharing the magic of BCH, so they must be passed
+// explicitly.
+var (
+	// ECashMainNetParams are the parameters of the eCash main network.
+	ECashMainNetParams = ecashParams(chaincfg.MainNetParams, "ecash-mainnet", MainnetMagic, "8333",
+		[]chaincfg.DNSSeed{
+			{Host: "seed.bitcoinabc.org", HasFiltering: true},
+			{Host: "seed.deadalnix.me", HasFiltering: true},
+		})
+
+	// ECashTestNetParams are the parameters of the eCash test network.
+	ECashTestNetParams = ecashParams(chaincfg.TestNet3Params, "ecash-testnet", TestnetMagic, "18333",
+		[]chaincfg.DNSSeed{
+			{Host: "testnet-seed.bitcoinabc.org", HasFiltering: true},
+			{Host: "testnet-seed.deadalnix.me", HasFiltering: true},
+		})
+)
+
+// ecashParams returns the parameters of an eCash network, derived from those
+// of the Bitcoin network base.
+func ecashParams(base chaincfg.Params, name string, net wire.BitcoinNet, port string,
+	seeds []chaincfg.DNSSeed) chaincfg.Params {
+
+	base.Name = name
+	base.Net = net
+	base.DefaultPort = port
+	base.DNSSeeds = seeds
+	base.Bech32HRPSegwit = ""
+	return base
+}
+
+// IsECash returns whether params are the parameters of an eCash network.
+func IsECash(params *chaincfg.Params) bool {
+	return params.Name == ECashMainNetParams.Name || params.Name == ECashTestNetParams.Name
+}
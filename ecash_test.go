@@ -0,0 +1,85 @@
+package bchutil
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestECashAddresses(t *testing.T) {
+	hash := btcutil.Hash160(signingTestKeys()[0].PubKey().SerializeCompressed())
+	bch, _ := NewCashAddressPubKeyHash(hash, &chaincfg.MainNetParams)
+	xec, err := NewCashAddressPubKeyHash(hash, &ECashMainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xec.IsForNet(&chaincfg.MainNetParams) || !xec.IsForNet(&ECashMainNetParams) ||
+		bch.IsForNet(&ECashMainNetParams) {
+		t.Error("addresses match the network of the other chain")
+	}
+
+	if xec.EncodeAddress() == bch.EncodeAddress() {
+		t.Error("addresses of both chains have the same checksum")
+	}
+	for _, s := range []string{xec.EncodeAddress(), "ecash:" + xec.EncodeAddress(),
+		strings.ToUpper(xec.EncodeAddress()), "ECASH:" + strings.ToUpper(xec.EncodeAddress())} {
+		decoded, err := DecodeAddress(s, &ECashMainNetParams)
+		if err != nil || decoded.EncodeAddress() != xec.EncodeAddress() {
+			t.Errorf("%s: got %v, %v", s, decoded, err)
+		}
+	}
+	for _, s := range []string{xec.EncodeAddress(), "ecash:" + xec.EncodeAddress(),
+		"bitcoincash:" + xec.EncodeAddress()} {
+		if _, err := DecodeAddress(s, &chaincfg.MainNetParams); err == nil {
+			t.Errorf("%s: decoded eCash address on BCH", s)
+		}
+	}
+	if _, err := DecodeAddress(bch.EncodeAddress(), &ECashMainNetParams); err == nil {
+		t.Error("decoded BCH address on eCash")
+	}
+
+	converted, err := ToCashAddress(bch, &ECashMainNetParams)
+	if err != nil || converted.EncodeAddress() != xec.EncodeAddress() {
+		t.Errorf("got %v, %v, want %s", converted, err, xec)
+	}
+	if converted, _ := ToCashAddress(xec, &ECashMainNetParams); converted != btcutil.Address(xec) {
+		t.Error("re-encoded address of the network")
+	}
+	want, _ := PayToAddrScript(bch)
+	if script, err := PayToAddrScript(xec); err != nil || !bytes.Equal(script, want) {
+		t.Errorf("got script %x, %v, want %x", script, err, want)
+	}
+
+	test, _ := NewCashAddressScriptHashFromHash(hash, &ECashTestNetParams)
+	if decoded, err := DecodeAddress("ectest:"+test.EncodeAddress(), &ECashTestNetParams); err != nil ||
+		!decoded.IsForNet(&ECashTestNetParams) {
+		t.Errorf("got %v, %v", decoded, err)
+	}
+	if seeds := GetDNSSeed(&ECashMainNetParams); len(seeds) == 0 || seeds[0].Host != "seed.bitcoinabc.org" {
+		t.Errorf("got seeds %v", seeds)
+	}
+}
+
+func TestRegisterPrefix(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.Name = "ecash-regtest"
+	if err := RegisterPrefix(&params, "ecreg"); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(Prefixes, params.Name)
+	addr, err := NewCashAddressPubKeyHash(make([]byte, 20), &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err := DecodeAddress("ecreg:"+addr.EncodeAddress(), &params); err != nil || !decoded.IsForNet(&params) {
+		t.Errorf("got %v, %v", decoded, err)
+	}
+	for _, prefix := range []string{"", "EcReg", "ec:reg", "ecreg2"} {
+		if err := RegisterPrefix(&params, prefix); err == nil {
+			t.Errorf("registered prefix %q", prefix)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// eciesMagic is the prefix of messages encrypted by Electron Cash.
+var eciesMagic = []byte("BIE1")
+
+const (
+	// eciesOverhead is the size of an encrypted message minus its
+	// ciphertext: the magic prefix, the compressed ephemeral public key and
+	// the HMAC-SHA256 tag.
+	eciesOverhead = 4 + btcec.PubKeyBytesLenCompressed + sha256.Size
+)
+
+var (
+	// ErrInvalidCiphertext describes an error where an encrypted message is
+	// too short, does not start with the BIE1 magic, or does not decrypt to
+	// correctly padded plaintext.
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+	// ErrInvalidMAC describes an error where the authentication tag of an
+	// encrypted message does not match, because the message was tampered
+	// with or was encrypted to another key.
+	ErrInvalidMAC = errors.New("invalid MAC")
+)
+
+// eciesKeys derives the AES IV, AES key and HMAC key from the shared point of
+// the ECDH exchange.  The compressed serialization of the point is hashed with
+// SHA-512 and the digest split into 16 bytes of IV, 16 bytes of AES-128 key
+// and 32 bytes of MAC key.
+func eciesKeys(priv *btcec.PrivateKey, pub *btcec.PublicKey) (iv, keyE, keyM []byte) {
+	x, y := btcec.S256().ScalarMult(pub.X, pub.Y, priv.D.Bytes())
+	shared := (&btcec.PublicKey{Curve: btcec.S256(), X: x, Y: y}).SerializeCompressed()
+	key := sha512.Sum512(shared)
+	return key[0:16], key[16:32], key[32:64]
+}
+
+// Encrypt encrypts plaintext to pubKey in the format used by the "encrypt
+// message" feature of Electron Cash.  The result is the raw message; Electron
+// Cash displays and expects it base64 encoded.
+func Encrypt(pubKey *btcec.PublicKey, plaintext []byte) ([]byte, error) {
+	ephemeral, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	return encryptWithEphemeral(pubKey, ephemeral, plaintext)
+}
+
+// encryptWithEphemeral encrypts plaintext to pubKey using the passed
+// ephemeral key.
+func encryptWithEphemeral(pubKey *btcec.PublicKey, ephemeral *btcec.PrivateKey,
+	plaintext []byte) ([]byte, error) {
+
+	iv, keyE, keyM := eciesKeys(ephemeral, pubKey)
+
+	block, err := aes.NewCipher(keyE)
+	if err != nil {
+		return nil, err
+	}
+	padLen := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := make([]byte, len(plaintext)+padLen)
+	copy(padded, plaintext)
+	for i := len(plaintext); i < len(padded); i++ {
+		padded[i] = byte(padLen)
+	}
+
+	out := make([]byte, 0, eciesOverhead+len(padded))
+	out = append(out, eciesMagic...)
+	out = append(out, ephemeral.PubKey().SerializeCompressed()...)
+	ciphertext := out[len(out) : len(out)+len(padded)]
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	out = out[:len(out)+len(padded)]
+
+	mac := hmac.New(sha256.New, keyM)
+	mac.Write(out)
+	return mac.Sum(out), nil
+}
+
+// Decrypt decrypts a message encrypted to the public key of priv by Encrypt or
+// by Electron Cash.  The ciphertext must already be base64 decoded.
+func Decrypt(priv *btcec.PrivateKey, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < eciesOverhead+aes.BlockSize ||
+		!bytes.Equal(ciphertext[:4], eciesMagic) {
+		return nil, ErrInvalidCiphertext
+	}
+	ephemeral, err := btcec.ParsePubKey(ciphertext[4:4+btcec.PubKeyBytesLenCompressed], btcec.S256())
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	iv, keyE, keyM := eciesKeys(priv, ephemeral)
+
+	macOffset := len(ciphertext) - sha256.Size
+	mac := hmac.New(sha256.New, keyM)
+	mac.Write(ciphertext[:macOffset])
+	if !hmac.Equal(mac.Sum(nil), ciphertext[macOffset:]) {
+		return nil, ErrInvalidMAC
+	}
+
+	encrypted := ciphertext[4+btcec.PubKeyBytesLenCompressed : macOffset]
+	if len(encrypted)%aes.BlockSize != 0 {
+		return nil, ErrInvalidCiphertext
+	}
+	block, err := aes.NewCipher(keyE)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, encrypted)
+
+	// Strip the PKCS#7 padding.
+	padLen := int(plaintext[len(plaintext)-1])
+	if padLen == 0 || padLen > aes.BlockSize {
+		return nil, ErrInvalidCiphertext
+	}
+	for _, b := range plaintext[len(plaintext)-padLen:] {
+		if int(b) != padLen {
+			return nil, ErrInvalidCiphertext
+		}
+	}
+	return plaintext[:len(plaintext)-padLen], nil
+}
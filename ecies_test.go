@@ -0,0 +1,113 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// eciesTestKey returns the key Electrum and Electron Cash derive from the
+// password "pw123" in their message encryption tests: PBKDF2-HMAC-SHA512 of
+// the password with an empty salt and 1024 iterations, reduced modulo the
+// curve order.
+func eciesTestKey() *btcec.PrivateKey {
+	secret := pbkdf2SHA512([]byte("pw123"), nil, 1024)
+	d := new(big.Int).SetBytes(secret)
+	d.Mod(d, btcec.S256().N)
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), d.Bytes())
+	return priv
+}
+
+// pbkdf2SHA512 computes the first 64 byte block of PBKDF2-HMAC-SHA512.
+func pbkdf2SHA512(password, salt []byte, iter int) []byte {
+	prf := hmac.New(sha512.New, password)
+	prf.Write(salt)
+	prf.Write([]byte{0, 0, 0, 1})
+	u := prf.Sum(nil)
+	t := append([]byte(nil), u...)
+	for i := 1; i < iter; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range t {
+			t[j] ^= u[j]
+		}
+	}
+	return t
+}
+
+// Messages encrypted by Electrum, from which Electron Cash forked its message
+// encryption, for the key returned by eciesTestKey.
+var eciesFixtures = []struct {
+	ciphertext string
+	plaintext  []byte
+}{
+	{
+		"QklFMQMDFtgT3zWSQsa+Uie8H/WvfUjlu9UN9OJtTt3KlgKeSTi6SQfuhcg1uIz9hp3WIUOFGTLr4RNQBdjPNqzXwhkcPi2Xsbiw6UCNJncVPJ6QBg==",
+		[]byte("me<(s_s)>age"),
+	},
+	{
+		"QklFMQKXOXbylOQTSMGfo4MFRwivAxeEEkewWQrpdYTzjPhqjHcGBJwdIhB7DyRfRQihuXx1y0ZLLv7XxLzrILzkl/H4YUtZB4uWjuOAcmxQH4i/Og==",
+		[]byte("me<(s_s)>age"),
+	},
+}
+
+func TestDecryptFixtures(t *testing.T) {
+	priv := eciesTestKey()
+	for i, f := range eciesFixtures {
+		ciphertext, err := base64.StdEncoding.DecodeString(f.ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plaintext, err := Decrypt(priv, ciphertext)
+		if err != nil {
+			t.Errorf("fixture %d: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(plaintext, f.plaintext) {
+			t.Errorf("fixture %d: decrypted to %q", i, plaintext)
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	priv := eciesTestKey()
+	for _, msg := range [][]byte{nil, []byte("hello"), bytes.Repeat([]byte("hey_there"), 100), make([]byte, 16)} {
+		ciphertext, err := Encrypt(priv.PubKey(), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(ciphertext, []byte("BIE1")) {
+			t.Error("missing magic")
+		}
+		if b := ciphertext[4]; b != 0x02 && b != 0x03 {
+			t.Error("ephemeral key is not compressed")
+		}
+		plaintext, err := Decrypt(priv, ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plaintext, msg) {
+			t.Errorf("decrypted %q, want %q", plaintext, msg)
+		}
+
+		ciphertext[len(ciphertext)-40] ^= 1
+		if _, err := Decrypt(priv, ciphertext); err != ErrInvalidMAC {
+			t.Errorf("tampered message: expected ErrInvalidMAC, got %v", err)
+		}
+	}
+
+	other, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x01})
+	ciphertext, _ := Encrypt(priv.PubKey(), []byte("hello"))
+	if _, err := Decrypt(other, ciphertext); err != ErrInvalidMAC {
+		t.Errorf("wrong key: expected ErrInvalidMAC, got %v", err)
+	}
+	if _, err := Decrypt(priv, ciphertext[:40]); err != ErrInvalidCiphertext {
+		t.Errorf("truncated message: expected ErrInvalidCiphertext, got %v", err)
+	}
+}
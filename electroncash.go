@@ -0,0 +1,453 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// ErrElectronCashFormat describes an error where a partial transaction is not
+// in the form Electron Cash serializes them.
+var ErrElectronCashFormat = errors.New("invalid Electron Cash partial transaction")
+
+// Prefixes of the keys of incomplete Electron Cash inputs, and the placeholder
+// of their missing signatures.
+const (
+	electronCashXPub      = 0xff
+	electronCashOldMPK    = 0xfe
+	electronCashNoSigByte = 0xff
+)
+
+// ElectronCashXPubKey is a key of an incomplete Electron Cash input, which
+// Electron Cash serializes with its derivation so that cosigners find theirs:
+// a public key, or a BIP 32 extended public key or an old Electrum master
+// public key, and the change and index of the key.
+type ElectronCashXPubKey struct {
+	// Raw is the serialized key, as pushed in the scriptSig.
+	Raw []byte
+
+	// PubKey is the public key, derived from the master key.
+	PubKey []byte
+
+	// XPub is the extended public key, or MasterPubKey the 64 byte old
+	// master public key, and Path the change and index of the key.
+	XPub         string
+	MasterPubKey []byte
+	Path         Path
+}
+
+// ElectronCashInput is an input of an Electron Cash partial transaction.
+// Complete inputs keep their scriptSig in the transaction, and their other
+// fields are not set.
+type ElectronCashInput struct {
+	Complete bool
+
+	// Amount is the value of the output spent, serialized with incomplete
+	// inputs for offline signing.
+	Amount btcutil.Amount
+
+	// NumSig is the number of signatures required, and RedeemScript the
+	// multisig redeem script with the public keys, nil for pay-to-pubkey-hash
+	// inputs.
+	NumSig       int
+	RedeemScript []byte
+
+	// XPubKeys are the keys of the input, in the order of the script, and
+	// Signatures their signatures with sighash type, nil when missing.
+	XPubKeys   []ElectronCashXPubKey
+	Signatures [][]byte
+}
+
+// ElectronCashPartialTx is a transaction partially signed by Electron Cash.
+type ElectronCashPartialTx struct {
+	// Tx is the transaction, whose incomplete inputs have no scriptSig.
+	Tx     *wire.MsgTx
+	Inputs []ElectronCashInput
+}
+
+// electronCashFile is the transaction file of Electron Cash.
+type electronCashFile struct {
+	Hex      string `json:"hex"`
+	Complete bool   `json:"complete"`
+	Final    bool   `json:"final"`
+}
+
+// ParseElectronCashPartialTx parses raw, a transaction saved by Electron Cash
+// before all its signatures are collected, as its JSON file, hex or binary.
+// Incomplete Electron Cash inputs push a placeholder for each missing
+// signature and, instead of the public keys, the extended keys they derive
+// from, and are followed by the amount spent; they return with their keys and
+// signatures and their scriptSig is cleared from the transaction.  Other
+// inputs are returned complete.
+func ParseElectronCashPartialTx(raw []byte) (*ElectronCashPartialTx, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) != 0 && raw[0] == '{' {
+		var file electronCashFile
+		if err := json.Unmarshal(raw, &file); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrElectronCashFormat, err)
+		}
+		raw = []byte(file.Hex)
+	}
+	if decoded, err := hex.DecodeString(string(raw)); err == nil {
+		raw = decoded
+	}
+
+	d := txDecoder{raw: raw}
+	p := &ElectronCashPartialTx{Tx: &wire.MsgTx{Version: int32(d.uint32("version"))}}
+	nIn, capacity := d.count("input count", minTxInSize)
+	p.Tx.TxIn = make([]*wire.TxIn, 0, capacity)
+	for i := 0; i < nIn && d.err == nil; i++ {
+		txIn := &wire.TxIn{}
+		copy(txIn.PreviousOutPoint.Hash[:], d.bytes(fmt.Sprintf("input %d outpoint hash", i), chainhash.HashSize))
+		txIn.PreviousOutPoint.Index = d.uint32(fmt.Sprintf("input %d outpoint index", i))
+		txIn.SignatureScript = d.varBytes(fmt.Sprintf("input %d scriptSig", i))
+		txIn.Sequence = d.uint32(fmt.Sprintf("input %d sequence", i))
+		if d.err != nil {
+			break
+		}
+		in, err := parseElectronCashScriptSig(txIn.SignatureScript)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		if !in.Complete {
+			in.Amount = btcutil.Amount(binary.LittleEndian.Uint64(d.bytes(fmt.Sprintf("input %d value", i), 8)))
+			txIn.SignatureScript = nil
+		}
+		p.Tx.TxIn = append(p.Tx.TxIn, txIn)
+		p.Inputs = append(p.Inputs, *in)
+	}
+	nOut, capacity := d.count("output count", minTxOutSize)
+	p.Tx.TxOut = make([]*wire.TxOut, 0, capacity)
+	for i := 0; i < nOut && d.err == nil; i++ {
+		txOut := &wire.TxOut{}
+		txOut.Value = int64(binary.LittleEndian.Uint64(d.bytes(fmt.Sprintf("output %d value", i), 8)))
+		txOut.PkScript = d.varBytes(fmt.Sprintf("output %d pkScript", i))
+		p.Tx.TxOut = append(p.Tx.TxOut, txOut)
+	}
+	p.Tx.LockTime = d.uint32("locktime")
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.pos != len(raw) {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTxTrailingBytes, len(raw)-d.pos)
+	}
+	return p, nil
+}
+
+// parseElectronCashScriptSig parses the scriptSig of an input, incomplete if
+// it is a pay-to-pubkey-hash or multisig scriptSig of Electron Cash with fewer
+// signatures than required.
+func parseElectronCashScriptSig(scriptSig []byte) (*ElectronCashInput, error) {
+	complete := &ElectronCashInput{Complete: true}
+	ops, err := parseScript(scriptSig)
+	if err != nil || len(ops) < 2 || !isPushOnly(ops) {
+		return complete, nil
+	}
+
+	var in ElectronCashInput
+	var pushes [][]byte
+	switch {
+	case len(ops) == 2 && len(ops[0].data) != 0:
+		in.NumSig = 1
+		pushes = [][]byte{ops[1].data}
+		in.Signatures = [][]byte{ops[0].data}
+	case ops[0].value == txscript.OP_0 && len(ops) >= 3:
+		redeemOps, err := parseScript(ops[len(ops)-1].data)
+		if err != nil || len(redeemOps) < 4 || redeemOps[len(redeemOps)-1].value != txscript.OP_CHECKMULTISIG {
+			return complete, nil
+		}
+		m, n := redeemOps[0].value, redeemOps[len(redeemOps)-2].value
+		if m < txscript.OP_1 || m > txscript.OP_16 || n < m || n > txscript.OP_16 ||
+			len(redeemOps) != int(n-txscript.OP_1)+4 {
+			return complete, nil
+		}
+		in.NumSig = int(m-txscript.OP_1) + 1
+		for _, op := range redeemOps[1 : len(redeemOps)-2] {
+			pushes = append(pushes, op.data)
+		}
+		for _, op := range ops[1 : len(ops)-1] {
+			in.Signatures = append(in.Signatures, op.data)
+		}
+	default:
+		return complete, nil
+	}
+
+	// Complete scriptSigs have as many signatures as required, and
+	// incomplete ones a push for each key.
+	nSigs := 0
+	for i, sig := range in.Signatures {
+		if len(sig) == 1 && sig[0] == electronCashNoSigByte {
+			in.Signatures[i] = nil
+		} else {
+			nSigs++
+		}
+	}
+	if nSigs == in.NumSig {
+		return complete, nil
+	}
+	if len(in.Signatures) != len(pushes) {
+		return nil, fmt.Errorf("%w: %d signatures for %d keys", ErrElectronCashFormat, len(in.Signatures),
+			len(pushes))
+	}
+
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_1 + byte(in.NumSig-1))
+	for _, push := range pushes {
+		xPubKey, err := parseElectronCashXPubKey(push)
+		if err != nil {
+			return nil, err
+		}
+		in.XPubKeys = append(in.XPubKeys, *xPubKey)
+		builder.AddData(xPubKey.PubKey)
+	}
+	if ops[0].value == txscript.OP_0 {
+		in.RedeemScript, err = builder.AddOp(txscript.OP_1 + byte(len(pushes)-1)).
+			AddOp(txscript.OP_CHECKMULTISIG).Script()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &in, nil
+}
+
+// parseElectronCashXPubKey parses a key of an incomplete input: a public key,
+// 0xff followed by a serialized extended public key, or 0xfe followed by an
+// old master public key, and a 2 byte little endian change and index.
+func parseElectronCashXPubKey(raw []byte) (*ElectronCashXPubKey, error) {
+	x := &ElectronCashXPubKey{Raw: raw}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("%w: empty key", ErrElectronCashFormat)
+	}
+	switch raw[0] {
+	case electronCashXPub:
+		if len(raw) != 1+78+4 {
+			return nil, fmt.Errorf("%w: %d byte extended key", ErrElectronCashFormat, len(raw))
+		}
+		b := raw[1:79]
+		xpub := hdkeychain.NewExtendedKey(b[0:4], b[45:78], b[13:45], b[5:9], b[4],
+			binary.BigEndian.Uint32(b[9:13]), false)
+		x.XPub = xpub.String()
+		x.Path = electronCashPath(raw[79:])
+		child, err := x.Path.Derive(xpub)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrElectronCashFormat, err)
+		}
+		pubKey, err := child.ECPubKey()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrElectronCashFormat, err)
+		}
+		x.PubKey = pubKey.SerializeCompressed()
+	case electronCashOldMPK:
+		if len(raw) != 1+64+4 {
+			return nil, fmt.Errorf("%w: %d byte old master key", ErrElectronCashFormat, len(raw))
+		}
+		x.MasterPubKey = raw[1:65]
+		x.Path = electronCashPath(raw[65:])
+		pubKey, err := oldElectrumPubKey(x.MasterPubKey, x.Path[0], x.Path[1])
+		if err != nil {
+			return nil, err
+		}
+		x.PubKey = pubKey
+	default:
+		if _, err := btcec.ParsePubKey(raw, btcec.S256()); err != nil {
+			return nil, fmt.Errorf("%w: key %x: %v", ErrElectronCashFormat, raw, err)
+		}
+		x.PubKey = raw
+	}
+	return x, nil
+}
+
+// electronCashPath returns the change and index serialized as 2 byte little
+// endian integers.
+func electronCashPath(b []byte) Path {
+	return Path{uint32(binary.LittleEndian.Uint16(b[0:2])), uint32(binary.LittleEndian.Uint16(b[2:4]))}
+}
+
+// oldElectrumPubKey returns the uncompressed public key of index and change
+// derived from mpk, an old Electrum master public key: mpk plus the point of
+// the double SHA-256 of "index:change:" and mpk.
+func oldElectrumPubKey(mpk []byte, change, index uint32) ([]byte, error) {
+	curve := btcec.S256()
+	x, y := new(big.Int).SetBytes(mpk[:32]), new(big.Int).SetBytes(mpk[32:])
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("%w: old master key not on the curve", ErrElectronCashFormat)
+	}
+	seq := chainhash.DoubleHashB(append([]byte(fmt.Sprintf("%d:%d:", index, change)), mpk...))
+	sx, sy := curve.ScalarBaseMult(seq)
+	pubKey := btcec.PublicKey{Curve: curve}
+	pubKey.X, pubKey.Y = curve.Add(x, y, sx, sy)
+	return pubKey.SerializeUncompressed(), nil
+}
+
+// Complete returns whether every input has the signatures it requires.
+func (p *ElectronCashPartialTx) Complete() bool {
+	for i := range p.Inputs {
+		if !p.Inputs[i].complete() {
+			return false
+		}
+	}
+	return true
+}
+
+// complete returns whether the input has the signatures it requires.
+func (in *ElectronCashInput) complete() bool {
+	return in.Complete || countSignatures(in.Signatures) >= in.NumSig
+}
+
+// AddSignature sets sig, a signature with sighash type, as the signature of
+// pubKey in input idx.  Signatures are not checked, which the script engine
+// can do once the transaction is complete.
+func (p *ElectronCashPartialTx) AddSignature(idx int, pubKey, sig []byte) error {
+	if idx < 0 || idx >= len(p.Inputs) {
+		return fmt.Errorf("input index %d out of range", idx)
+	}
+	in := &p.Inputs[idx]
+	if in.complete() {
+		return fmt.Errorf("input %d is complete", idx)
+	}
+	for i := range in.XPubKeys {
+		if bytes.Equal(in.XPubKeys[i].PubKey, pubKey) {
+			in.Signatures[i] = sig
+			return nil
+		}
+	}
+	return fmt.Errorf("input %d: public key %x not in the input", idx, pubKey)
+}
+
+// Sign adds the signatures of the incomplete inputs whose keys derive from
+// accountKey, an extended private key whose extended public key is that of
+// keys of the inputs, with SIGHASH_ALL|SIGHASH_FORKID as Electron Cash does.
+// Multisig signatures are ECDSA signatures, the only ones legacy multisig
+// scriptSigs accept.  It returns the number of signatures added.
+func (p *ElectronCashPartialTx) Sign(accountKey *hdkeychain.ExtendedKey, opts ...SignOption) (int, error) {
+	o := newSignOptions(opts)
+	if err := o.validate(); err != nil {
+		return 0, err
+	}
+	added := 0
+	for idx := range p.Inputs {
+		in := &p.Inputs[idx]
+		if in.complete() {
+			continue
+		}
+		o := o
+		subScript := in.RedeemScript
+		if subScript == nil {
+			subScript, _ = payToPubKeyHashScript(btcutil.Hash160(in.XPubKeys[0].PubKey))
+		} else {
+			o.schnorr = false
+		}
+		for i := range in.XPubKeys {
+			x := &in.XPubKeys[i]
+			if x.XPub == "" || in.Signatures[i] != nil {
+				continue
+			}
+			child, err := x.Path.Derive(accountKey)
+			if err != nil {
+				return added, fmt.Errorf("input %d: %w", idx, err)
+			}
+			pubKey, err := child.ECPubKey()
+			if err != nil || !bytes.Equal(pubKey.SerializeCompressed(), x.PubKey) {
+				continue
+			}
+			priv, err := child.ECPrivKey()
+			if err != nil {
+				return added, fmt.Errorf("input %d: %w", idx, err)
+			}
+			sig, err := o.signInput(p.Tx, idx, subScript, SigHashAllForkID, priv, int64(in.Amount))
+			if err != nil {
+				return added, err
+			}
+			in.Signatures[i] = sig
+			added++
+		}
+	}
+	return added, nil
+}
+
+// SerializeElectronCashPartialTx returns the JSON transaction file of p, which
+// Electron Cash loads to add the missing signatures or broadcast it.  Inputs
+// with the signatures they require get their final scriptSig, and the others
+// are serialized incomplete, with the amount they spend.
+func SerializeElectronCashPartialTx(p *ElectronCashPartialTx) ([]byte, error) {
+	if len(p.Inputs) != len(p.Tx.TxIn) {
+		return nil, fmt.Errorf("%d inputs for %d transaction inputs", len(p.Inputs), len(p.Tx.TxIn))
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, p.Tx.Version)
+	wire.WriteVarInt(&buf, 0, uint64(len(p.Tx.TxIn)))
+	for i, txIn := range p.Tx.TxIn {
+		in := &p.Inputs[i]
+		scriptSig, err := in.scriptSig(txIn)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		buf.Write(txIn.PreviousOutPoint.Hash[:])
+		binary.Write(&buf, binary.LittleEndian, txIn.PreviousOutPoint.Index)
+		wire.WriteVarBytes(&buf, 0, scriptSig)
+		binary.Write(&buf, binary.LittleEndian, txIn.Sequence)
+		if !in.complete() {
+			binary.Write(&buf, binary.LittleEndian, uint64(in.Amount))
+		}
+	}
+	wire.WriteVarInt(&buf, 0, uint64(len(p.Tx.TxOut)))
+	for _, txOut := range p.Tx.TxOut {
+		wire.WriteTxOut(&buf, 0, p.Tx.Version, txOut)
+	}
+	binary.Write(&buf, binary.LittleEndian, p.Tx.LockTime)
+
+	return json.Marshal(electronCashFile{Hex: hex.EncodeToString(buf.Bytes()), Complete: p.Complete()})
+}
+
+// scriptSig returns the scriptSig of the input of txIn: that of txIn for
+// complete inputs, the final one for inputs with the signatures required, and
+// otherwise the incomplete Electron Cash one.
+func (in *ElectronCashInput) scriptSig(txIn *wire.TxIn) ([]byte, error) {
+	if in.Complete {
+		return txIn.SignatureScript, nil
+	}
+	if len(in.Signatures) != len(in.XPubKeys) || len(in.XPubKeys) == 0 {
+		return nil, fmt.Errorf("%d signatures for %d keys", len(in.Signatures), len(in.XPubKeys))
+	}
+	complete := in.complete()
+	if in.RedeemScript == nil {
+		builder := txscript.NewScriptBuilder()
+		if complete {
+			return builder.AddData(in.Signatures[0]).AddData(in.XPubKeys[0].PubKey).Script()
+		}
+		return builder.AddData([]byte{electronCashNoSigByte}).AddData(in.XPubKeys[0].Raw).Script()
+	}
+	if complete {
+		builder, err := multisigScriptSigBuilder(in.Signatures, in.NumSig)
+		if err != nil {
+			return nil, err
+		}
+		return builder.AddData(in.RedeemScript).Script()
+	}
+
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_0)
+	redeem := txscript.NewScriptBuilder().AddOp(txscript.OP_1 + byte(in.NumSig-1))
+	for i, sig := range in.Signatures {
+		if sig == nil {
+			sig = []byte{electronCashNoSigByte}
+		}
+		builder.AddData(sig)
+		redeem.AddData(in.XPubKeys[i].Raw)
+	}
+	redeemScript, err := redeem.AddOp(txscript.OP_1 + byte(len(in.XPubKeys)-1)).
+		AddOp(txscript.OP_CHECKMULTISIG).Script()
+	if err != nil {
+		return nil, err
+	}
+	return builder.AddData(redeemScript).Script()
+}
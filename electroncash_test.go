@@ -0,0 +1,206 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// electronCashTestTx is a 2-of-3 multisig spend of 100000 satoshis in the
+// form Electron Cash saves it after the first signature: OP_0, a signature or
+// the 0xff placeholder for each key, and the redeem script with the extended
+// keys of the cosigners, derived with change 0 and index 5, followed by the
+// amount after the sequence.
+const electronCashTestTx = "0200000001ab00000000000000000000000000000000000000000000000000000000000000010000" +
+	"00fd53010001ff48304502210082254d4feb881ee18bcd825c4c265b1dfa01fe873f6fe82152f663512afded7702200d9e2b" +
+	"329ca1b9692927453c77eaa8ad7187b1be430f178dcf6317ae2bd4f48f4101ff4d0201524c53ff0488b21e00000000000000" +
+	"00005340d438dd04202dac6c596390c4747a958db82889cd8cabad18b6a7fb4711c60253dee90bdff9eed793c398f679c133" +
+	"25a5e1ae7b5db2b6d0a2f8cb05c9ad2d49000005004c53ff0488b21e000000000000000000abceef54a258b708f60fc04e6f" +
+	"dd0f842270c23416dd42461279313fe7dccd0802785c6ee41ef2d6da2cb01c7db2a718621f4304c12b57c53548b2130e68e4" +
+	"205e000005004c53ff0488b21e00000000000000000022b29dd3ce203995fd130aab8341c1c0c70b7a3f0e64e2875c1eb664" +
+	"418f8e5f039822622cf330b98e52e7357135bc93e1e5606a57a9819408734598fe5677b1340000050053aefeffffffa08601" +
+	"000000000001b8820100000000001976a914000000000000000000000000000000000000000088ac60ae0a00"
+
+// electronCashTestKey returns the master key of cosigner i of
+// electronCashTestTx.
+func electronCashTestKey(i byte) *hdkeychain.ExtendedKey {
+	key, _ := hdkeychain.NewMaster(bytes.Repeat([]byte{i}, 32), &chaincfg.MainNetParams)
+	return key
+}
+
+func TestParseElectronCashPartialTx(t *testing.T) {
+	raw, _ := hex.DecodeString(electronCashTestTx)
+	file, _ := json.Marshal(map[string]interface{}{"hex": electronCashTestTx, "complete": false, "final": false})
+	for _, encoded := range [][]byte{raw, []byte(electronCashTestTx + "\n"), file} {
+		p, err := ParseElectronCashPartialTx(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Inputs) != 1 || len(p.Tx.TxIn[0].SignatureScript) != 0 || p.Tx.LockTime != 700000 ||
+			len(p.Tx.TxOut) != 1 || p.Tx.TxOut[0].Value != 99000 {
+			t.Fatalf("got %+v", p)
+		}
+	}
+	p, _ := ParseElectronCashPartialTx(raw)
+	in := p.Inputs[0]
+	if in.Complete || in.Amount != 100000 || in.NumSig != 2 || len(in.XPubKeys) != 3 ||
+		countSignatures(in.Signatures) != 1 || in.Signatures[1] == nil || p.Complete() {
+		t.Fatalf("got input %+v", in)
+	}
+	for _, x := range in.XPubKeys {
+		if !strings.HasPrefix(x.XPub, "xpub") || len(x.PubKey) != 33 || len(x.Path) != 2 || x.Path[1] != 5 {
+			t.Errorf("got key %+v", x)
+		}
+	}
+	pubKeys, nRequired, ok := multisigPubKeys(in.RedeemScript)
+	if !ok || nRequired != 2 || !bytes.Equal(pubKeys[2], in.XPubKeys[2].PubKey) {
+		t.Errorf("redeem script %x", in.RedeemScript)
+	}
+
+	// Serialized again, the transaction is the one Electron Cash saved.
+	out, err := SerializeElectronCashPartialTx(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved electronCashFile
+	if err := json.Unmarshal(out, &saved); err != nil || saved.Hex != electronCashTestTx || saved.Complete {
+		t.Fatalf("got %s, %v", out, err)
+	}
+
+	for _, bad := range []string{
+		electronCashTestTx[:len(electronCashTestTx)-2],
+		electronCashTestTx + "00",
+		strings.Replace(electronCashTestTx, "4c53ff0488b21e", "4c53fe0488b21e", 1),
+	} {
+		if _, err := ParseElectronCashPartialTx([]byte(bad)); err == nil {
+			t.Errorf("%s parsed", bad)
+		}
+	}
+	if _, err := ParseElectronCashPartialTx([]byte("{")); !errors.Is(err, ErrElectronCashFormat) {
+		t.Errorf("got %v, want ErrElectronCashFormat", err)
+	}
+}
+
+func TestSignElectronCashPartialTx(t *testing.T) {
+	p, err := ParseElectronCashPartialTx([]byte(electronCashTestTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := electronCashTestKey(4)
+	if n, err := p.Sign(other); n != 0 || err != nil {
+		t.Fatalf("%d signatures of another key, %v", n, err)
+	}
+	added := 0
+	for i := byte(1); i <= 3; i++ {
+		n, err := p.Sign(electronCashTestKey(i), WithSchnorr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		added += n
+	}
+	if added != 1 || !p.Complete() {
+		t.Fatalf("%d signatures added", added)
+	}
+	if err := p.AddSignature(0, p.Inputs[0].XPubKeys[0].PubKey, []byte{1}); err == nil {
+		t.Error("signature added to a complete input")
+	}
+
+	out, err := SerializeElectronCashPartialTx(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	final, err := ParseElectronCashPartialTx(out)
+	if err != nil || !final.Complete() || !final.Inputs[0].Complete {
+		t.Fatalf("got %+v, %v", final, err)
+	}
+	pkScript, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).
+		AddData(btcutil.Hash160(p.Inputs[0].RedeemScript)).AddOp(txscript.OP_EQUAL).Script()
+	vm, err := NewEngine(pkScript, final.Tx, 0, StandardScriptFlags, nil, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Execute(); err != nil {
+		t.Fatalf("final scriptSig %x: %v", final.Tx.TxIn[0].SignatureScript, err)
+	}
+}
+
+// TestElectronCashExports gates the interoperability with the files exported
+// by Electron Cash multisig wallets in testdata/electroncash, saved with
+// "Save transaction" after the first signature of a cosigner, each with a
+// .xprv file holding the account key of another cosigner, as Electron Cash
+// shows it.  Each file must parse, serialize back to the hex saved, and take
+// the signatures of the other key until its inputs verify with the engine.
+func TestElectronCashExports(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "electroncash", "*.txn"))
+	if len(files) == 0 {
+		t.Skip("no Electron Cash export in testdata/electroncash")
+	}
+	for _, name := range files {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var saved electronCashFile
+		if err := json.Unmarshal(raw, &saved); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		p, err := ParseElectronCashPartialTx(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if p.Complete() {
+			t.Fatalf("%s: complete", name)
+		}
+		out, err := SerializeElectronCashPartialTx(p)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var again electronCashFile
+		if err := json.Unmarshal(out, &again); err != nil || again.Hex != strings.ToLower(saved.Hex) {
+			t.Fatalf("%s: serialized as %s, %v", name, out, err)
+		}
+
+		xprv, err := ioutil.ReadFile(strings.TrimSuffix(name, ".txn") + ".xprv")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		key, err := hdkeychain.NewKeyFromString(strings.TrimSpace(string(xprv)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := p.Sign(key); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !p.Complete() {
+			t.Fatalf("%s: incomplete after the second signature", name)
+		}
+		if out, err = SerializeElectronCashPartialTx(p); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		final, err := ParseElectronCashPartialTx(out)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for i, in := range p.Inputs {
+			pkScript, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).
+				AddData(btcutil.Hash160(in.RedeemScript)).AddOp(txscript.OP_EQUAL).Script()
+			vm, err := NewEngine(pkScript, final.Tx, i, StandardScriptFlags, nil, int64(in.Amount))
+			if err == nil {
+				err = vm.Execute()
+			}
+			if err != nil {
+				t.Errorf("%s: input %d: %v", name, i, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package bchutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Heights of the unconfirmed transactions of Electrum histories.
+const (
+	// ElectrumMempoolHeight is the height of the transactions of the
+	// mempool whose inputs are all confirmed.
+	ElectrumMempoolHeight = 0
+
+	// ElectrumUnconfirmedParentHeight is the height of the transactions of
+	// the mempool spending unconfirmed outputs.
+	ElectrumUnconfirmedParentHeight = -1
+)
+
+// ElectrumScriptHash returns the script hash identifying pkScript in the
+// Electrum protocol: the SHA-256 of the script, in the reversed byte order of
+// txids, as hex.
+func ElectrumScriptHash(pkScript []byte) string {
+	return chainhash.Hash(sha256.Sum256(pkScript)).String()
+}
+
+// HistoryEntry is a transaction of the history of a script hash.
+type HistoryEntry struct {
+	TxHash chainhash.Hash
+
+	// Height is the height of the block of the transaction, or
+	// ElectrumMempoolHeight or ElectrumUnconfirmedParentHeight for
+	// unconfirmed transactions.
+	Height int32
+
+	// Position is the index of the transaction in its block, which orders
+	// the transactions of a block.  Entries of the same block with the
+	// same position keep their order, as returned by servers.
+	Position int
+}
+
+// confirmed returns whether the transaction of e is in a block.
+func (e *HistoryEntry) confirmed() bool {
+	return e.Height > 0
+}
+
+// SortHistory sorts history in the order of Electrum servers: confirmed
+// transactions by height and position in their block, then the unconfirmed
+// ones, those whose inputs are confirmed first, by txid.
+func SortHistory(history []HistoryEntry) {
+	sort.SliceStable(history, func(i, j int) bool {
+		a, b := &history[i], &history[j]
+		if a.confirmed() != b.confirmed() {
+			return a.confirmed()
+		}
+		if a.confirmed() {
+			if a.Height != b.Height {
+				return a.Height < b.Height
+			}
+			return a.Position < b.Position
+		}
+		if a.Height != b.Height {
+			return a.Height > b.Height
+		}
+		return a.TxHash.String() < b.TxHash.String()
+	})
+}
+
+// StatusHash returns the Electrum status of history, the transactions of a
+// script hash: the hex SHA-256 of their "txid:height:" strings concatenated
+// in the order of SortHistory, as servers such as Fulcrum notify subscribers
+// of.  The status of an empty history is "", which servers send as null.
+// history is not modified.
+func StatusHash(history []HistoryEntry) string {
+	if len(history) == 0 {
+		return ""
+	}
+	sorted := append([]HistoryEntry(nil), history...)
+	SortHistory(sorted)
+	var b strings.Builder
+	for i := range sorted {
+		b.WriteString(sorted[i].TxHash.String())
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatInt(int64(sorted[i].Height), 10))
+		b.WriteByte(':')
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// HistoryDiff is the difference between two histories of a script hash.
+type HistoryDiff struct {
+	// Added are the entries of transactions that are new, and Removed those
+	// of transactions that left the history, evicted from the mempool,
+	// double spent or reorganized out.
+	Added   []HistoryEntry
+	Removed []HistoryEntry
+
+	// Changed are the new entries of the transactions whose height
+	// changed, mostly on confirmation.
+	Changed []HistoryEntry
+}
+
+// Empty returns whether the histories are the same.
+func (d *HistoryDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffHistory returns the difference from the history old to cur, each sorted
+// as by SortHistory.
+func DiffHistory(old, cur []HistoryEntry) *HistoryDiff {
+	heights := make(map[chainhash.Hash]int32, len(old))
+	for i := range old {
+		heights[old[i].TxHash] = old[i].Height
+	}
+	d := &HistoryDiff{}
+	seen := make(map[chainhash.Hash]bool, len(cur))
+	for _, e := range cur {
+		seen[e.TxHash] = true
+		height, ok := heights[e.TxHash]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, e)
+		case height != e.Height:
+			d.Changed = append(d.Changed, e)
+		}
+	}
+	for _, e := range old {
+		if !seen[e.TxHash] {
+			d.Removed = append(d.Removed, e)
+		}
+	}
+	SortHistory(d.Added)
+	SortHistory(d.Removed)
+	SortHistory(d.Changed)
+	return d
+}
@@ -0,0 +1,77 @@
+package bchutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+func TestElectrumScriptHash(t *testing.T) {
+	// The example of the Electrum protocol documentation, the script of
+	// 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa.
+	pkScript := mustDecodeHex("76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac")
+	want := "8b01df4e368ea28f8dc0423bcf7a4923e3a12d307c875e47a0cfbf90b5c39161"
+	if got := ElectrumScriptHash(pkScript); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestStatusHash(t *testing.T) {
+	hashA, hashB, hashC := chainhash.Hash{0xaa}, chainhash.Hash{0xbb}, chainhash.Hash{0xcc}
+	hashD, hashE := chainhash.Hash{0x01, 0xdd}, chainhash.Hash{0x02, 0xee}
+	history := []HistoryEntry{
+		{TxHash: hashE, Height: ElectrumUnconfirmedParentHeight},
+		{TxHash: hashD, Height: ElectrumMempoolHeight},
+		{TxHash: hashC, Height: 700001},
+		{TxHash: hashB, Height: 700000, Position: 7},
+		{TxHash: hashA, Height: 700000, Position: 3},
+	}
+	preimage := hashA.String() + ":700000:" + hashB.String() + ":700000:" + hashC.String() + ":700001:" +
+		hashD.String() + ":0:" + hashE.String() + ":-1:"
+	sum := sha256.Sum256([]byte(preimage))
+	if got := StatusHash(history); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("got status %s", got)
+	}
+	if history[0].TxHash != hashE {
+		t.Error("history modified")
+	}
+	if got := StatusHash(nil); got != "" {
+		t.Errorf("got status %q of an empty history", got)
+	}
+
+	// Unconfirmed transactions of the same height are sorted by txid.
+	mempool := []HistoryEntry{{TxHash: hashE}, {TxHash: hashD}}
+	SortHistory(mempool)
+	if mempool[0].TxHash != hashD {
+		t.Errorf("got %v first", mempool[0].TxHash)
+	}
+}
+
+func TestDiffHistory(t *testing.T) {
+	old := []HistoryEntry{
+		{TxHash: chainhash.Hash{1}, Height: 100},
+		{TxHash: chainhash.Hash{2}, Height: 0},
+		{TxHash: chainhash.Hash{3}, Height: -1},
+	}
+	cur := []HistoryEntry{
+		{TxHash: chainhash.Hash{5}, Height: 0},
+		{TxHash: chainhash.Hash{1}, Height: 100},
+		{TxHash: chainhash.Hash{2}, Height: 101},
+		{TxHash: chainhash.Hash{4}, Height: 101, Position: 2},
+	}
+	d := DiffHistory(old, cur)
+	want := &HistoryDiff{
+		Added:   []HistoryEntry{{TxHash: chainhash.Hash{4}, Height: 101, Position: 2}, {TxHash: chainhash.Hash{5}}},
+		Removed: []HistoryEntry{{TxHash: chainhash.Hash{3}, Height: -1}},
+		Changed: []HistoryEntry{{TxHash: chainhash.Hash{2}, Height: 101}},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got %+v", d)
+	}
+	if d.Empty() || !DiffHistory(cur, cur).Empty() {
+		t.Error("wrong Empty")
+	}
+}
@@ -0,0 +1,1424 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/Fabcien/bchutil/sig"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// ScriptFlags select the rules the script interpreter enforces.
+type ScriptFlags uint32
+
+const (
+	// ScriptBip16 enables pay-to-script-hash evaluation (BIP 16).
+	ScriptBip16 ScriptFlags = 1 << iota
+
+	// ScriptVerifyStrictEncoding requires strict DER signatures, defined
+	// sighash types and well formed public keys.  Signatures using
+	// SIGHASH_FORKID must use it exactly when ScriptEnableSighashForkID is
+	// set.
+	ScriptVerifyStrictEncoding
+
+	// ScriptVerifyDERSignatures requires strict DER signatures (BIP 66).
+	ScriptVerifyDERSignatures
+
+	// ScriptVerifyLowS requires ECDSA signatures to have an S value in the
+	// lower half of the curve order.
+	ScriptVerifyLowS
+
+	// ScriptVerifyNullFail requires failed signature checks to have empty
+	// signatures.
+	ScriptVerifyNullFail
+
+	// ScriptVerifyMinimalData requires data pushes and numbers to use their
+	// smallest encoding.
+	ScriptVerifyMinimalData
+
+	// ScriptVerifySigPushOnly requires scriptSigs to only push data.
+	ScriptVerifySigPushOnly
+
+	// ScriptVerifyCleanStack requires a single item to be left on the
+	// stack.  It requires ScriptBip16.
+	ScriptVerifyCleanStack
+
+	// ScriptVerifyCheckLockTimeVerify enables OP_CHECKLOCKTIMEVERIFY
+	// (BIP 65).
+	ScriptVerifyCheckLockTimeVerify
+
+	// ScriptVerifyCheckSequenceVerify enables OP_CHECKSEQUENCEVERIFY
+	// (BIP 112).
+	ScriptVerifyCheckSequenceVerify
+
+	// ScriptDiscourageUpgradableNops makes the NOP opcodes reserved for
+	// soft forks fail.
+	ScriptDiscourageUpgradableNops
+
+	// ScriptEnableSighashForkID makes signatures commit to the amount of
+	// the input with the replay protected digest of Bitcoin Cash.
+	ScriptEnableSighashForkID
+
+	// ScriptEnableP2SH32 enables pay-to-script-hash with 32 byte hashes,
+	// as activated in May 2023.  It only applies with ScriptBip16.
+	ScriptEnableP2SH32
+
+	// ScriptEnableSchnorr makes 64 byte signatures of OP_CHECKSIG and
+	// OP_CHECKDATASIG Schnorr signatures, as activated in May 2019.
+	// Without it they are ECDSA signatures.
+	ScriptEnableSchnorr
+
+	// ScriptEnableSchnorrMultisig enables the Schnorr mode of
+	// OP_CHECKMULTISIG selected by a non-empty dummy, as activated in
+	// November 2019.  Without it the dummy is ignored.
+	ScriptEnableSchnorrMultisig
+)
+
+// StandardScriptFlags are the flags of the current Bitcoin Cash consensus and
+// standardness rules.
+const StandardScriptFlags = ScriptBip16 | ScriptVerifyStrictEncoding |
+	ScriptVerifyDERSignatures | ScriptVerifyLowS |
+	ScriptVerifyNullFail | ScriptVerifyMinimalData | ScriptVerifySigPushOnly |
+	ScriptVerifyCleanStack | ScriptVerifyCheckLockTimeVerify |
+	ScriptVerifyCheckSequenceVerify | ScriptDiscourageUpgradableNops |
+	ScriptEnableSighashForkID | ScriptEnableP2SH32 | ScriptEnableSchnorr |
+	ScriptEnableSchnorrMultisig
+
+// ConsensusScriptFlags are the flags of the rules every block must follow,
+// the standardness rules aside.
+const ConsensusScriptFlags = StandardScriptFlags &^ ScriptDiscourageUpgradableNops
+
+var (
+	// ErrEvalFalse describes an error where a script leaves an empty stack
+	// or a false value on top of it.
+	ErrEvalFalse = errors.New("script evaluated to false")
+
+	// ErrVerifyFailed describes an error where a VERIFY operation finds a
+	// false value.
+	ErrVerifyFailed = errors.New("verify failed")
+
+	// ErrEarlyReturn describes an error where OP_RETURN is executed.
+	ErrEarlyReturn = errors.New("OP_RETURN executed")
+
+	// ErrInvalidStackOperation describes an error where an operation needs
+	// more stack items than available.
+	ErrInvalidStackOperation = errors.New("invalid stack operation")
+
+	// ErrUnbalancedConditional describes an error where OP_ELSE or
+	// OP_ENDIF has no matching OP_IF, or a script ends inside a
+	// conditional.
+	ErrUnbalancedConditional = errors.New("unbalanced conditional")
+
+	// ErrBadOpcode describes an error where a disabled, reserved or
+	// unknown opcode is executed.  Disabled opcodes fail even in branches
+	// that are not executed.
+	ErrBadOpcode = errors.New("bad opcode")
+
+	// ErrUnsupportedOpcode describes an error where a native introspection
+	// or CashTokens opcode, which the engine does not implement, is
+	// executed.  The scripts may be valid on the chain, and the engine can
+	// not tell.
+	ErrUnsupportedOpcode = errors.New("unsupported opcode")
+
+	// ErrInvalidNumber describes an error where a numeric operand is too
+	// long or a result overflows.
+	ErrInvalidNumber = errors.New("invalid number")
+
+	// ErrMinimalData describes an error where a push or a number does not
+	// use its smallest encoding.
+	ErrMinimalData = errors.New("non-minimal encoding")
+
+	// ErrInvalidOperand describes an error where the operands of a
+	// splice or bitwise operation are out of range or of different sizes.
+	ErrInvalidOperand = errors.New("invalid operand")
+
+	// ErrDivideByZero describes an error where OP_DIV or OP_MOD divide by
+	// zero.
+	ErrDivideByZero = errors.New("division by zero")
+
+	// ErrSigEncoding describes an error where a signature is not strictly
+	// encoded or has an invalid sighash type.
+	ErrSigEncoding = errors.New("invalid signature encoding")
+
+	// ErrPubKeyEncoding describes an error where a public key is not
+	// strictly encoded.
+	ErrPubKeyEncoding = errors.New("invalid public key encoding")
+
+	// ErrNullFail describes an error where a failed signature check has a
+	// non empty signature.
+	ErrNullFail = errors.New("failed signature check with non-null signature")
+
+	// ErrCleanStack describes an error where a script leaves more than one
+	// item on the stack.
+	ErrCleanStack = errors.New("stack not clean after execution")
+
+	// ErrNotPushOnly describes an error where a scriptSig contains other
+	// operations than pushes.
+	ErrNotPushOnly = errors.New("scriptSig is not push only")
+
+	// ErrScriptLimit describes an error where a script exceeds a size,
+	// operation count or stack size limit.
+	ErrScriptLimit = errors.New("script limit exceeded")
+
+	// ErrUnsatisfiedLockTime describes an error where the lock time or
+	// sequence of the transaction does not satisfy OP_CHECKLOCKTIMEVERIFY
+	// or OP_CHECKSEQUENCEVERIFY.
+	ErrUnsatisfiedLockTime = errors.New("unsatisfied lock time")
+
+	// ErrDiscourageUpgradableNops describes an error where a reserved NOP
+	// is executed with ScriptDiscourageUpgradableNops.
+	ErrDiscourageUpgradableNops = errors.New("upgradable NOP executed")
+)
+
+// lockTimeThreshold is the lock time below which lock times are block
+// heights, and above which they are timestamps.
+const lockTimeThreshold = 500000000
+
+// Engine executes the scripts spending one input of a transaction with the
+// Bitcoin Cash rules.  The token prefix of the output spent is committed to
+// by the signatures, but native introspection and CashTokens opcodes are not
+// supported yet.
+type Engine struct {
+	scripts    [][]parsedOpcode
+	scriptIdx  int
+	opIdx      int
+	codeSepIdx int
+	condStack  []bool
+	dstack     [][]byte
+	astack     [][]byte
+	savedStack [][]byte
+	numOps     int
+	sigChecks  int
+	bip16      bool
+
+	// steps counts the calls of Step, replayed to report failures.
+	steps int
+
+	// vmLimits replaces the operation count and 520 byte item limits with
+	// those of the May 2025 VM limits, whose costs are counted by cost.
+	vmLimits bool
+	cost     operationCost
+
+	tx        *wire.MsgTx
+	txIdx     int
+	flags     ScriptFlags
+	sigHashes *txscript.TxSigHashes
+	amount    int64
+
+	// token is the token data of the output spent, nil if none.
+	token *TokenData
+
+	// deferSchnorr is set by DeferSchnorr, which collects the Schnorr
+	// signatures in deferred.
+	deferSchnorr bool
+	deferred     []SchnorrVerifyItem
+
+	// recordSigs is set by RecordSignatures, which collects the valid
+	// signatures in recorded.
+	recordSigs bool
+	recorded   []CheckedSignature
+}
+
+// CheckedSignature is a valid signature checked by the scripts: Signature,
+// without sighash type, signs Digest with PubKey, as serialized in the
+// scripts.
+type CheckedSignature struct {
+	PubKey    []byte
+	Signature []byte
+	Digest    []byte
+}
+
+// NewEngine returns an engine executing the scriptSig of input txIdx of tx
+// and scriptPubKey, the script of the output it spends, holding amount.  A
+// CashTokens prefix of scriptPubKey is split from the script executed, and
+// committed to by the signatures checked.  sigHashes may be nil, or shared by
+// the engines of all inputs of tx.
+func NewEngine(scriptPubKey []byte, tx *wire.MsgTx, txIdx int, flags ScriptFlags,
+	sigHashes *txscript.TxSigHashes, amount int64) (*Engine, error) {
+
+	if txIdx < 0 || txIdx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("input index %d out of range", txIdx)
+	}
+	if flags&ScriptVerifyCleanStack != 0 && flags&ScriptBip16 == 0 {
+		return nil, errors.New("ScriptVerifyCleanStack requires ScriptBip16")
+	}
+	token, scriptPubKey, err := SplitTokenPrefix(scriptPubKey)
+	if err != nil {
+		return nil, err
+	}
+	if sigHashes == nil {
+		sigHashes = txscript.NewTxSigHashes(tx)
+	}
+	vm := &Engine{
+		tx:        tx,
+		txIdx:     txIdx,
+		flags:     flags,
+		sigHashes: sigHashes,
+		amount:    amount,
+		token:     token,
+	}
+
+	for _, script := range [][]byte{tx.TxIn[txIdx].SignatureScript, scriptPubKey} {
+		if len(script) > MaxScriptSize {
+			return nil, fmt.Errorf("%w: %d byte script", ErrScriptLimit, len(script))
+		}
+		ops, err := parseScript(script)
+		if err != nil {
+			return nil, err
+		}
+		vm.scripts = append(vm.scripts, ops)
+	}
+	if vm.hasFlag(ScriptVerifySigPushOnly) && !isPushOnly(vm.scripts[0]) {
+		return nil, ErrNotPushOnly
+	}
+	if vm.hasFlag(ScriptBip16) && vm.isScriptHash(scriptPubKey) {
+		if !isPushOnly(vm.scripts[0]) {
+			return nil, ErrNotPushOnly
+		}
+		vm.bip16 = true
+	}
+	return vm, nil
+}
+
+// isScriptHash returns whether script is a pay-to-script-hash output script
+// evaluated by the engine.
+func (vm *Engine) isScriptHash(script []byte) bool {
+	if len(script) == 23 && script[0] == txscript.OP_HASH160 &&
+		script[1] == txscript.OP_DATA_20 && script[22] == txscript.OP_EQUAL {
+		return true
+	}
+	return vm.hasFlag(ScriptEnableP2SH32) && len(script) == 35 &&
+		script[0] == txscript.OP_HASH256 && script[1] == txscript.OP_DATA_32 &&
+		script[34] == txscript.OP_EQUAL
+}
+
+func (vm *Engine) hasFlag(flag ScriptFlags) bool {
+	return vm.flags&flag == flag
+}
+
+// Execute runs the scripts and returns nil if they succeed.
+func (vm *Engine) Execute() error {
+	for {
+		done, err := vm.Step()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// SigChecks returns the number of signature checks counted so far, as defined
+// by the May 2020 upgrade: one per non-null signature checked by OP_CHECKSIG
+// and OP_CHECKDATASIG, and one per public key for OP_CHECKMULTISIG with any
+// non-null signature.
+func (vm *Engine) SigChecks() int {
+	return vm.sigChecks
+}
+
+// DeferSchnorr makes the engine collect the Schnorr signatures it checks
+// instead of verifying them, when ScriptVerifyNullFail makes any invalid one
+// fail the scripts.  Execute then succeeds as if they were valid, and the
+// input is valid when BatchVerifySchnorr also accepts DeferredSchnorr.
+func (vm *Engine) DeferSchnorr() {
+	vm.deferSchnorr = true
+}
+
+// DeferredSchnorr returns the Schnorr signatures collected since DeferSchnorr.
+func (vm *Engine) DeferredSchnorr() []SchnorrVerifyItem {
+	return vm.deferred
+}
+
+// RecordSignatures makes the engine collect the valid signatures it checks,
+// including deferred Schnorr signatures.
+func (vm *Engine) RecordSignatures() {
+	vm.recordSigs = true
+}
+
+// Signatures returns the signatures collected since RecordSignatures.
+func (vm *Engine) Signatures() []CheckedSignature {
+	return vm.recorded
+}
+
+// Step executes the next opcode and returns whether execution is over.
+func (vm *Engine) Step() (done bool, err error) {
+	if vm.scriptIdx >= len(vm.scripts) {
+		return true, nil
+	}
+	vm.steps++
+	script := vm.scripts[vm.scriptIdx]
+	if vm.opIdx < len(script) {
+		if err := vm.executeOpcode(&script[vm.opIdx]); err != nil {
+			return true, vm.execError(vm.scriptIdx, vm.opIdx, err)
+		}
+		vm.opIdx++
+		if len(vm.dstack)+len(vm.astack) > MaxStackSize {
+			return true, vm.execError(vm.scriptIdx, vm.opIdx-1,
+				fmt.Errorf("%w: more than %d stack items", ErrScriptLimit, MaxStackSize))
+		}
+	}
+	return vm.advance()
+}
+
+// advance moves to the next script when the current one is over.
+func (vm *Engine) advance() (bool, error) {
+	for vm.opIdx >= len(vm.scripts[vm.scriptIdx]) {
+		scriptIdx, end := vm.scriptIdx, len(vm.scripts[vm.scriptIdx])
+		if len(vm.condStack) != 0 {
+			return true, vm.execError(scriptIdx, end, ErrUnbalancedConditional)
+		}
+		vm.astack = nil
+		vm.numOps = 0
+		vm.opIdx = 0
+		vm.codeSepIdx = 0
+
+		switch {
+		case vm.scriptIdx == 0 && vm.bip16:
+			vm.savedStack = append([][]byte(nil), vm.dstack...)
+		case vm.scriptIdx == 1 && vm.bip16:
+			if err := vm.checkTop(); err != nil {
+				return true, vm.execError(scriptIdx, end, err)
+			}
+			if len(vm.savedStack) == 0 {
+				return true, vm.execError(scriptIdx, end, ErrInvalidStackOperation)
+			}
+			redeemScript := vm.savedStack[len(vm.savedStack)-1]
+			ops, err := parseScript(redeemScript)
+			if err != nil {
+				return true, vm.execError(scriptIdx, end, err)
+			}
+			vm.scripts = append(vm.scripts, ops)
+			vm.dstack = vm.savedStack[:len(vm.savedStack)-1]
+		}
+
+		vm.scriptIdx++
+		if vm.scriptIdx >= len(vm.scripts) {
+			if err := vm.checkFinal(); err != nil {
+				return true, vm.execError(scriptIdx, end, err)
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkTop returns an error unless the top of the stack is true.
+func (vm *Engine) checkTop() error {
+	if len(vm.dstack) == 0 {
+		return fmt.Errorf("%w: empty stack", ErrEvalFalse)
+	}
+	if !asBool(vm.dstack[len(vm.dstack)-1]) {
+		return ErrEvalFalse
+	}
+	return nil
+}
+
+// checkFinal checks the stack once all scripts are executed.
+func (vm *Engine) checkFinal() error {
+	if err := vm.checkTop(); err != nil {
+		return err
+	}
+	if vm.hasFlag(ScriptVerifyCleanStack) && len(vm.dstack) != 1 {
+		return fmt.Errorf("%w: %d items left", ErrCleanStack, len(vm.dstack))
+	}
+	return nil
+}
+
+// executing returns whether all enclosing conditionals are true.
+func (vm *Engine) executing() bool {
+	for _, c := range vm.condStack {
+		if !c {
+			return false
+		}
+	}
+	return true
+}
+
+func (vm *Engine) push(v []byte) {
+	vm.dstack = append(vm.dstack, v)
+	vm.cost.pushedBytes += len(v)
+}
+
+// maxElementSize returns the largest item that can be pushed to the stack.
+func (vm *Engine) maxElementSize() int {
+	if vm.vmLimits {
+		return maxVMLimitsElementSize
+	}
+	return MaxScriptElementSize
+}
+
+func (vm *Engine) pushNum(n scriptNum) {
+	vm.push(n.Bytes())
+}
+
+// need returns an error if the stack holds fewer than n items.
+func (vm *Engine) need(n int) error {
+	if len(vm.dstack) < n {
+		return ErrInvalidStackOperation
+	}
+	return nil
+}
+
+func (vm *Engine) pop() ([]byte, error) {
+	if err := vm.need(1); err != nil {
+		return nil, err
+	}
+	v := vm.dstack[len(vm.dstack)-1]
+	vm.dstack = vm.dstack[:len(vm.dstack)-1]
+	return v, nil
+}
+
+// peek returns the item n positions below the top of the stack.
+func (vm *Engine) peek(n int) ([]byte, error) {
+	if err := vm.need(n + 1); err != nil {
+		return nil, err
+	}
+	return vm.dstack[len(vm.dstack)-1-n], nil
+}
+
+func (vm *Engine) popNum() (scriptNum, error) {
+	v, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	return makeScriptNum(v, vm.hasFlag(ScriptVerifyMinimalData), maxScriptNumLen)
+}
+
+func (vm *Engine) popBool() (bool, error) {
+	v, err := vm.pop()
+	return asBool(v), err
+}
+
+// popNums pops n numbers, returned in stack order.
+func (vm *Engine) popNums(n int) ([]scriptNum, error) {
+	if err := vm.need(n); err != nil {
+		return nil, err
+	}
+	nums := make([]scriptNum, n)
+	for i := n - 1; i >= 0; i-- {
+		num, err := vm.popNum()
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = num
+	}
+	return nums, nil
+}
+
+// isDisabledOpcode returns whether op fails even when not executed.
+func isDisabledOpcode(op byte) bool {
+	switch op {
+	case txscript.OP_VERIF, txscript.OP_VERNOTIF, txscript.OP_INVERT,
+		txscript.OP_2MUL, txscript.OP_2DIV, txscript.OP_LSHIFT, txscript.OP_RSHIFT:
+		return true
+	}
+	return false
+}
+
+// executeOpcode executes op.
+func (vm *Engine) executeOpcode(op *parsedOpcode) error {
+	if isDisabledOpcode(op.value) {
+		return fmt.Errorf("%w: disabled opcode %#x", ErrBadOpcode, op.value)
+	}
+	if len(op.data) > vm.maxElementSize() {
+		return fmt.Errorf("%w: %d byte push", ErrScriptLimit, len(op.data))
+	}
+	if op.value > txscript.OP_16 && !vm.vmLimits {
+		vm.numOps++
+		if vm.numOps > MaxOpsPerScript {
+			return fmt.Errorf("%w: more than %d operations", ErrScriptLimit, MaxOpsPerScript)
+		}
+	}
+
+	executing := vm.executing()
+	isConditional := op.value >= txscript.OP_IF && op.value <= txscript.OP_ENDIF
+	if !executing && !isConditional {
+		return nil
+	}
+	if op.value <= txscript.OP_PUSHDATA4 {
+		if vm.hasFlag(ScriptVerifyMinimalData) && !op.isMinimalPush() {
+			return fmt.Errorf("%w: push of %d bytes", ErrMinimalData, len(op.data))
+		}
+		vm.push(op.data)
+		return nil
+	}
+
+	switch op.value {
+	case txscript.OP_1NEGATE:
+		vm.pushNum(-1)
+	case txscript.OP_1, txscript.OP_2, txscript.OP_3, txscript.OP_4,
+		txscript.OP_5, txscript.OP_6, txscript.OP_7, txscript.OP_8,
+		txscript.OP_9, txscript.OP_10, txscript.OP_11, txscript.OP_12,
+		txscript.OP_13, txscript.OP_14, txscript.OP_15, txscript.OP_16:
+		vm.pushNum(scriptNum(op.value - txscript.OP_1 + 1))
+
+	case txscript.OP_NOP:
+	case txscript.OP_NOP1, txscript.OP_NOP4, txscript.OP_NOP5, txscript.OP_NOP6,
+		txscript.OP_NOP7, txscript.OP_NOP8, txscript.OP_NOP9, txscript.OP_NOP10:
+		return vm.upgradableNop(op.value)
+
+	case txscript.OP_IF, txscript.OP_NOTIF:
+		cond := false
+		if executing {
+			v, err := vm.pop()
+			if err != nil {
+				return err
+			}
+			cond = asBool(v)
+			if op.value == txscript.OP_NOTIF {
+				cond = !cond
+			}
+		}
+		vm.condStack = append(vm.condStack, cond)
+	case txscript.OP_ELSE:
+		if len(vm.condStack) == 0 {
+			return ErrUnbalancedConditional
+		}
+		vm.condStack[len(vm.condStack)-1] = !vm.condStack[len(vm.condStack)-1]
+	case txscript.OP_ENDIF:
+		if len(vm.condStack) == 0 {
+			return ErrUnbalancedConditional
+		}
+		vm.condStack = vm.condStack[:len(vm.condStack)-1]
+
+	case txscript.OP_VERIFY:
+		ok, err := vm.popBool()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrVerifyFailed
+		}
+	case txscript.OP_RETURN:
+		return ErrEarlyReturn
+
+	case txscript.OP_CHECKLOCKTIMEVERIFY:
+		if !vm.hasFlag(ScriptVerifyCheckLockTimeVerify) {
+			return vm.upgradableNop(op.value)
+		}
+		return vm.checkLockTime()
+	case txscript.OP_CHECKSEQUENCEVERIFY:
+		if !vm.hasFlag(ScriptVerifyCheckSequenceVerify) {
+			return vm.upgradableNop(op.value)
+		}
+		return vm.checkSequence()
+
+	case txscript.OP_CODESEPARATOR:
+		vm.codeSepIdx = vm.opIdx + 1
+
+	case txscript.OP_CHECKSIG, txscript.OP_CHECKSIGVERIFY:
+		return vm.opCheckSig(op.value == txscript.OP_CHECKSIGVERIFY)
+	case txscript.OP_CHECKMULTISIG, txscript.OP_CHECKMULTISIGVERIFY:
+		return vm.opCheckMultiSig(op.value == txscript.OP_CHECKMULTISIGVERIFY)
+	case opCheckDataSig, opCheckDataSigVerify:
+		return vm.opCheckDataSig(op.value == opCheckDataSigVerify)
+
+	default:
+		if done, err := vm.executeStackOpcode(op.value); done {
+			return err
+		}
+		if done, err := vm.executeDataOpcode(op.value); done {
+			return err
+		}
+		if done, err := vm.executeNumericOpcode(op.value); done {
+			return err
+		}
+		if op.value >= opInputIndex && op.value <= opOutputTokenAmount {
+			return fmt.Errorf("%w: %#x", ErrUnsupportedOpcode, op.value)
+		}
+		return fmt.Errorf("%w: %#x", ErrBadOpcode, op.value)
+	}
+	return nil
+}
+
+// upgradableNop executes a NOP reserved for soft forks.
+func (vm *Engine) upgradableNop(op byte) error {
+	if vm.hasFlag(ScriptDiscourageUpgradableNops) {
+		return fmt.Errorf("%w: %#x", ErrDiscourageUpgradableNops, op)
+	}
+	return nil
+}
+
+// stackOpcodeArgs is the number of items each stack manipulation opcode
+// works on.
+var stackOpcodeArgs = map[byte]int{
+	txscript.OP_TOALTSTACK: 1, txscript.OP_2DROP: 2, txscript.OP_2DUP: 2,
+	txscript.OP_3DUP: 3, txscript.OP_2OVER: 4, txscript.OP_2ROT: 6,
+	txscript.OP_2SWAP: 4, txscript.OP_IFDUP: 1, txscript.OP_DROP: 1,
+	txscript.OP_DUP: 1, txscript.OP_NIP: 2, txscript.OP_OVER: 2,
+	txscript.OP_ROT: 3, txscript.OP_SWAP: 2, txscript.OP_TUCK: 2,
+	txscript.OP_FROMALTSTACK: 0, txscript.OP_DEPTH: 0,
+	txscript.OP_PICK: 1, txscript.OP_ROLL: 1,
+}
+
+// executeStackOpcode executes the stack manipulation opcodes.  It returns
+// false if op is not one of them.
+func (vm *Engine) executeStackOpcode(op byte) (bool, error) {
+	n, ok := stackOpcodeArgs[op]
+	if !ok {
+		return false, nil
+	}
+	if err := vm.need(n); err != nil {
+		return true, err
+	}
+	s := vm.dstack
+	top := len(s) - 1
+
+	switch op {
+	case txscript.OP_TOALTSTACK:
+		vm.astack = append(vm.astack, s[top])
+		vm.dstack = s[:top]
+	case txscript.OP_FROMALTSTACK:
+		if len(vm.astack) == 0 {
+			return true, fmt.Errorf("%w: empty alt stack", ErrInvalidStackOperation)
+		}
+		vm.push(vm.astack[len(vm.astack)-1])
+		vm.astack = vm.astack[:len(vm.astack)-1]
+	case txscript.OP_2DROP:
+		vm.dstack = s[:top-1]
+	case txscript.OP_2DUP:
+		vm.push(s[top-1])
+		vm.push(s[top])
+	case txscript.OP_3DUP:
+		vm.push(s[top-2])
+		vm.push(s[top-1])
+		vm.push(s[top])
+	case txscript.OP_2OVER:
+		vm.push(s[top-3])
+		vm.push(s[top-2])
+	case txscript.OP_2ROT:
+		a, b := s[top-5], s[top-4]
+		copy(s[top-5:], s[top-3:])
+		s[top-1], s[top] = a, b
+	case txscript.OP_2SWAP:
+		s[top-3], s[top-2], s[top-1], s[top] = s[top-1], s[top], s[top-3], s[top-2]
+	case txscript.OP_IFDUP:
+		if asBool(s[top]) {
+			vm.push(s[top])
+		}
+	case txscript.OP_DEPTH:
+		vm.pushNum(scriptNum(len(s)))
+	case txscript.OP_DROP:
+		vm.dstack = s[:top]
+	case txscript.OP_DUP:
+		vm.push(s[top])
+	case txscript.OP_NIP:
+		s[top-1] = s[top]
+		vm.dstack = s[:top]
+	case txscript.OP_OVER:
+		vm.push(s[top-1])
+	case txscript.OP_PICK, txscript.OP_ROLL:
+		idx, err := vm.popNum()
+		if err != nil {
+			return true, err
+		}
+		s = vm.dstack
+		if idx < 0 || int64(idx) >= int64(len(s)) {
+			return true, fmt.Errorf("%w: index %d out of range", ErrInvalidStackOperation, idx)
+		}
+		pos := len(s) - 1 - int(idx)
+		v := s[pos]
+		if op == txscript.OP_ROLL {
+			copy(s[pos:], s[pos+1:])
+			vm.dstack = s[:len(s)-1]
+		}
+		vm.push(v)
+	case txscript.OP_ROT:
+		s[top-2], s[top-1], s[top] = s[top-1], s[top], s[top-2]
+	case txscript.OP_SWAP:
+		s[top-1], s[top] = s[top], s[top-1]
+	case txscript.OP_TUCK:
+		vm.dstack = append(s[:top-1], s[top], s[top-1], s[top])
+		vm.cost.pushedBytes += len(s[top])
+	}
+	return true, nil
+}
+
+// executeDataOpcode executes the splice, bitwise and hashing opcodes.  It
+// returns false if op is not one of them.
+func (vm *Engine) executeDataOpcode(op byte) (bool, error) {
+	switch op {
+	case txscript.OP_CAT:
+		a, b, err := vm.popPair()
+		if err != nil {
+			return true, err
+		}
+		if len(a)+len(b) > vm.maxElementSize() {
+			return true, fmt.Errorf("%w: %d byte result", ErrScriptLimit, len(a)+len(b))
+		}
+		vm.push(append(append([]byte(nil), a...), b...))
+	case opSplit:
+		n, err := vm.popNum()
+		if err != nil {
+			return true, err
+		}
+		data, err := vm.pop()
+		if err != nil {
+			return true, err
+		}
+		if n < 0 || int64(n) > int64(len(data)) {
+			return true, fmt.Errorf("%w: split at %d of %d bytes", ErrInvalidOperand, n, len(data))
+		}
+		vm.push(append([]byte(nil), data[:n]...))
+		vm.push(append([]byte(nil), data[n:]...))
+	case opNum2Bin:
+		size, err := vm.popNum()
+		if err != nil {
+			return true, err
+		}
+		if size < 0 || size > scriptNum(vm.maxElementSize()) {
+			return true, fmt.Errorf("%w: size %d", ErrScriptLimit, size)
+		}
+		v, err := vm.pop()
+		if err != nil {
+			return true, err
+		}
+		num := minimallyEncode(v)
+		if int64(len(num)) > int64(size) {
+			return true, fmt.Errorf("%w: %d byte number does not fit in %d bytes",
+				ErrInvalidOperand, len(num), size)
+		}
+		var sign byte
+		if len(num) > 0 {
+			sign = num[len(num)-1] & 0x80
+			num[len(num)-1] &= 0x7f
+		}
+		for int64(len(num)) < int64(size) {
+			num = append(num, 0)
+		}
+		if len(num) > 0 {
+			num[len(num)-1] |= sign
+		}
+		vm.push(num)
+	case opBin2Num:
+		v, err := vm.pop()
+		if err != nil {
+			return true, err
+		}
+		num := minimallyEncode(v)
+		if len(num) > maxScriptNumLen {
+			return true, fmt.Errorf("%w: %d byte number", ErrInvalidNumber, len(num))
+		}
+		vm.push(num)
+	case txscript.OP_SIZE:
+		v, err := vm.peek(0)
+		if err != nil {
+			return true, err
+		}
+		vm.pushNum(scriptNum(len(v)))
+	case opReverseBytes:
+		v, err := vm.pop()
+		if err != nil {
+			return true, err
+		}
+		r := make([]byte, len(v))
+		for i, b := range v {
+			r[len(v)-1-i] = b
+		}
+		vm.push(r)
+
+	case txscript.OP_AND, txscript.OP_OR, txscript.OP_XOR:
+		a, b, err := vm.popPair()
+		if err != nil {
+			return true, err
+		}
+		if len(a) != len(b) {
+			return true, fmt.Errorf("%w: operands of %d and %d bytes", ErrInvalidOperand, len(a), len(b))
+		}
+		r := make([]byte, len(a))
+		for i := range a {
+			switch op {
+			case txscript.OP_AND:
+				r[i] = a[i] & b[i]
+			case txscript.OP_OR:
+				r[i] = a[i] | b[i]
+			default:
+				r[i] = a[i] ^ b[i]
+			}
+		}
+		vm.push(r)
+	case txscript.OP_EQUAL, txscript.OP_EQUALVERIFY:
+		a, b, err := vm.popPair()
+		if err != nil {
+			return true, err
+		}
+		eq := bytes.Equal(a, b)
+		if op == txscript.OP_EQUALVERIFY {
+			if !eq {
+				return true, ErrVerifyFailed
+			}
+			return true, nil
+		}
+		vm.push(fromBool(eq))
+
+	case txscript.OP_RIPEMD160, txscript.OP_SHA1, txscript.OP_SHA256,
+		txscript.OP_HASH160, txscript.OP_HASH256:
+		v, err := vm.pop()
+		if err != nil {
+			return true, err
+		}
+		vm.cost.hashIterations += hashDigestIterations(len(v),
+			op == txscript.OP_HASH160 || op == txscript.OP_HASH256)
+		switch op {
+		case txscript.OP_RIPEMD160:
+			h := ripemd160.New()
+			h.Write(v)
+			vm.push(h.Sum(nil))
+		case txscript.OP_SHA1:
+			h := sha1.Sum(v)
+			vm.push(h[:])
+		case txscript.OP_SHA256:
+			h := sha256.Sum256(v)
+			vm.push(h[:])
+		case txscript.OP_HASH160:
+			vm.push(btcutil.Hash160(v))
+		default:
+			vm.push(chainhash.DoubleHashB(v))
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// popPair pops two items, returned in stack order.
+func (vm *Engine) popPair() (a, b []byte, err error) {
+	if err := vm.need(2); err != nil {
+		return nil, nil, err
+	}
+	b, _ = vm.pop()
+	a, _ = vm.pop()
+	return a, b, nil
+}
+
+// executeNumericOpcode executes the arithmetic opcodes.  It returns false if
+// op is not one of them.
+func (vm *Engine) executeNumericOpcode(op byte) (bool, error) {
+	switch op {
+	case txscript.OP_1ADD, txscript.OP_1SUB, txscript.OP_NEGATE, txscript.OP_ABS,
+		txscript.OP_NOT, txscript.OP_0NOTEQUAL:
+		n, err := vm.popNum()
+		if err != nil {
+			return true, err
+		}
+		switch op {
+		case txscript.OP_1ADD:
+			n, err = addNum(n, 1)
+		case txscript.OP_1SUB:
+			n, err = subNum(n, 1)
+		case txscript.OP_NEGATE:
+			n = -n
+		case txscript.OP_ABS:
+			if n < 0 {
+				n = -n
+			}
+		case txscript.OP_NOT:
+			n = boolNum(n == 0)
+		default:
+			n = boolNum(n != 0)
+		}
+		if err != nil {
+			return true, err
+		}
+		vm.pushNum(n)
+
+	case txscript.OP_ADD, txscript.OP_SUB, txscript.OP_MUL, txscript.OP_DIV,
+		txscript.OP_MOD, txscript.OP_BOOLAND, txscript.OP_BOOLOR,
+		txscript.OP_NUMEQUAL, txscript.OP_NUMEQUALVERIFY, txscript.OP_NUMNOTEQUAL,
+		txscript.OP_LESSTHAN, txscript.OP_GREATERTHAN, txscript.OP_LESSTHANOREQUAL,
+		txscript.OP_GREATERTHANOREQUAL, txscript.OP_MIN, txscript.OP_MAX:
+		if n := len(vm.dstack); n >= 2 && (op == txscript.OP_MUL || op == txscript.OP_DIV ||
+			op == txscript.OP_MOD) {
+			vm.cost.arithmetic += len(vm.dstack[n-2]) * len(vm.dstack[n-1])
+		}
+		nums, err := vm.popNums(2)
+		if err != nil {
+			return true, err
+		}
+		a, b := nums[0], nums[1]
+		var r scriptNum
+		switch op {
+		case txscript.OP_ADD:
+			r, err = addNum(a, b)
+		case txscript.OP_SUB:
+			r, err = subNum(a, b)
+		case txscript.OP_MUL:
+			r, err = mulNum(a, b)
+		case txscript.OP_DIV, txscript.OP_MOD:
+			if b == 0 {
+				return true, ErrDivideByZero
+			}
+			if op == txscript.OP_DIV {
+				r = a / b
+			} else {
+				r = a % b
+			}
+		case txscript.OP_BOOLAND:
+			r = boolNum(a != 0 && b != 0)
+		case txscript.OP_BOOLOR:
+			r = boolNum(a != 0 || b != 0)
+		case txscript.OP_NUMEQUAL, txscript.OP_NUMEQUALVERIFY:
+			r = boolNum(a == b)
+		case txscript.OP_NUMNOTEQUAL:
+			r = boolNum(a != b)
+		case txscript.OP_LESSTHAN:
+			r = boolNum(a < b)
+		case txscript.OP_GREATERTHAN:
+			r = boolNum(a > b)
+		case txscript.OP_LESSTHANOREQUAL:
+			r = boolNum(a <= b)
+		case txscript.OP_GREATERTHANOREQUAL:
+			r = boolNum(a >= b)
+		case txscript.OP_MIN:
+			r = a
+			if b < a {
+				r = b
+			}
+		case txscript.OP_MAX:
+			r = a
+			if b > a {
+				r = b
+			}
+		}
+		if err != nil {
+			return true, err
+		}
+		if op == txscript.OP_NUMEQUALVERIFY {
+			if r == 0 {
+				return true, ErrVerifyFailed
+			}
+			return true, nil
+		}
+		vm.pushNum(r)
+
+	case txscript.OP_WITHIN:
+		nums, err := vm.popNums(3)
+		if err != nil {
+			return true, err
+		}
+		vm.pushNum(boolNum(nums[1] <= nums[0] && nums[0] < nums[2]))
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func boolNum(b bool) scriptNum {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// checkLockTime executes OP_CHECKLOCKTIMEVERIFY.
+func (vm *Engine) checkLockTime() error {
+	v, err := vm.peek(0)
+	if err != nil {
+		return err
+	}
+	lockTime, err := makeScriptNum(v, vm.hasFlag(ScriptVerifyMinimalData), 5)
+	if err != nil {
+		return err
+	}
+	if lockTime < 0 {
+		return fmt.Errorf("%w: negative lock time", ErrUnsatisfiedLockTime)
+	}
+	if err := verifyLockTime(int64(vm.tx.LockTime), lockTimeThreshold, int64(lockTime)); err != nil {
+		return err
+	}
+	if vm.tx.TxIn[vm.txIdx].Sequence == wire.MaxTxInSequenceNum {
+		return fmt.Errorf("%w: input is final", ErrUnsatisfiedLockTime)
+	}
+	return nil
+}
+
+// checkSequence executes OP_CHECKSEQUENCEVERIFY.
+func (vm *Engine) checkSequence() error {
+	v, err := vm.peek(0)
+	if err != nil {
+		return err
+	}
+	n, err := makeScriptNum(v, vm.hasFlag(ScriptVerifyMinimalData), 5)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("%w: negative sequence", ErrUnsatisfiedLockTime)
+	}
+	sequence := int64(n)
+	if sequence&wire.SequenceLockTimeDisabled != 0 {
+		return nil
+	}
+	if vm.tx.Version < 2 {
+		return fmt.Errorf("%w: transaction version %d", ErrUnsatisfiedLockTime, vm.tx.Version)
+	}
+	txSequence := int64(vm.tx.TxIn[vm.txIdx].Sequence)
+	if txSequence&wire.SequenceLockTimeDisabled != 0 {
+		return fmt.Errorf("%w: input sequence lock disabled", ErrUnsatisfiedLockTime)
+	}
+	mask := int64(wire.SequenceLockTimeIsSeconds | wire.SequenceLockTimeMask)
+	return verifyLockTime(txSequence&mask, wire.SequenceLockTimeIsSeconds, sequence&mask)
+}
+
+// verifyLockTime checks that txLockTime is of the same kind as lockTime,
+// heights or times as told apart by threshold, and not before it.
+func verifyLockTime(txLockTime, threshold, lockTime int64) error {
+	if (txLockTime < threshold) != (lockTime < threshold) {
+		return fmt.Errorf("%w: lock time types differ", ErrUnsatisfiedLockTime)
+	}
+	if lockTime > txLockTime {
+		return fmt.Errorf("%w: %d is after %d", ErrUnsatisfiedLockTime, lockTime, txLockTime)
+	}
+	return nil
+}
+
+// checkDataSigEncoding checks a signature without sighash type.  64 byte
+// signatures are Schnorr signatures.
+func (vm *Engine) checkDataSigEncoding(sig []byte) error {
+	if len(sig) == 0 {
+		return nil
+	}
+	return vm.checkSigEncoding(sig)
+}
+
+// isSchnorr returns whether sig, without sighash type, is a Schnorr
+// signature.
+func (vm *Engine) isSchnorr(sig []byte) bool {
+	return len(sig) == SchnorrSignatureLen && vm.hasFlag(ScriptEnableSchnorr)
+}
+
+// checkSigEncoding checks a signature that can't be empty, such as the part
+// of a transaction signature before its sighash type.
+func (vm *Engine) checkSigEncoding(body []byte) error {
+	if vm.isSchnorr(body) {
+		return nil
+	}
+	if vm.strictDER() {
+		if err := sig.CheckDEREncoding(body); err != nil {
+			return fmt.Errorf("%w: not strict DER: %v", ErrSigEncoding, err)
+		}
+	}
+	if vm.hasFlag(ScriptVerifyLowS) && !sig.HasLowS(body) {
+		return fmt.Errorf("%w: high S value", ErrSigEncoding)
+	}
+	return nil
+}
+
+// checkTxSigEncoding checks a transaction signature with its sighash type.
+func (vm *Engine) checkTxSigEncoding(sig []byte) error {
+	if len(sig) == 0 {
+		return nil
+	}
+	if vm.hasFlag(ScriptVerifyStrictEncoding) {
+		hashType := txscript.SigHashType(sig[len(sig)-1])
+		if err := checkSigHashType(hashType); err != nil {
+			return fmt.Errorf("%w: %v", ErrSigEncoding, err)
+		}
+		forkID := hashType&SigHashForkID != 0
+		if forkID != vm.hasFlag(ScriptEnableSighashForkID) {
+			return fmt.Errorf("%w: unexpected use of SIGHASH_FORKID", ErrSigEncoding)
+		}
+	}
+	return vm.checkSigEncoding(sig[:len(sig)-1])
+}
+
+// checkPubKeyEncoding checks the encoding of a public key.
+func (vm *Engine) checkPubKeyEncoding(pubKey []byte) error {
+	if !vm.hasFlag(ScriptVerifyStrictEncoding) {
+		return nil
+	}
+	if len(pubKey) == 33 && (pubKey[0] == 0x02 || pubKey[0] == 0x03) {
+		return nil
+	}
+	if len(pubKey) == 65 && pubKey[0] == 0x04 {
+		return nil
+	}
+	return ErrPubKeyEncoding
+}
+
+// strictDER returns whether ECDSA signatures must be strict DER.
+func (vm *Engine) strictDER() bool {
+	return vm.flags&(ScriptVerifyStrictEncoding|ScriptVerifyDERSignatures|ScriptVerifyLowS) != 0
+}
+
+// verifySignature returns whether sig, a Schnorr signature if 64 bytes long
+// and an ECDSA signature otherwise, signs hash with pubKey.  ECDSA signatures
+// are parsed leniently unless strictDER is set.
+func verifySignature(sig, pubKey, hash []byte, strictDER bool) bool {
+	if len(sig) == SchnorrSignatureLen {
+		pub, err := btcec.ParsePubKey(pubKey, btcec.S256())
+		return err == nil && VerifySchnorr(pub, hash, sig)
+	}
+	return verifyECDSA(sig, pubKey, hash, strictDER)
+}
+
+// verifyECDSA returns whether der is an ECDSA signature of hash by pubKey,
+// parsed as lax DER unless strictDER is set.
+func verifyECDSA(der, pubKey, hash []byte, strictDER bool) bool {
+	pub, err := btcec.ParsePubKey(pubKey, btcec.S256())
+	if err != nil {
+		return false
+	}
+	s, err := sig.ParseDERSignature(der, strictDER)
+	return err == nil && s.Verify(hash, pub)
+}
+
+// verifySignature verifies sig like verifySignature, or defers it when it is
+// a Schnorr signature the engine collects, and records it if valid.
+func (vm *Engine) verifySignature(sig, pubKey, hash []byte) bool {
+	ok := vm.checkSignature(sig, pubKey, hash)
+	if ok && vm.recordSigs {
+		vm.recorded = append(vm.recorded, CheckedSignature{PubKey: pubKey, Signature: sig, Digest: hash})
+	}
+	return ok
+}
+
+// checkSignature verifies or defers sig for verifySignature.
+func (vm *Engine) checkSignature(sig, pubKey, hash []byte) bool {
+	if !vm.isSchnorr(sig) {
+		return verifyECDSA(sig, pubKey, hash, vm.strictDER())
+	}
+	if !vm.deferSchnorr || !vm.hasFlag(ScriptVerifyNullFail) {
+		return verifySignature(sig, pubKey, hash, vm.strictDER())
+	}
+	pub, err := btcec.ParsePubKey(pubKey, btcec.S256())
+	if err != nil {
+		return false
+	}
+	vm.deferred = append(vm.deferred, SchnorrVerifyItem{PubKey: pub, Signature: sig, Digest: hash})
+	return true
+}
+
+// sigHash returns the digest signed by a signature of the current script
+// with hashType.  Legacy digests cover the script without the signatures
+// being checked.
+func (vm *Engine) sigHash(hashType txscript.SigHashType, sigs ...[]byte) ([]byte, error) {
+	script := vm.scripts[vm.scriptIdx][vm.codeSepIdx:]
+	if hashType&SigHashForkID != 0 && vm.hasFlag(ScriptEnableSighashForkID) {
+		scriptCode := unparseScript(script)
+		var tokenPrefix []byte
+		if vm.token != nil {
+			tokenPrefix = vm.token.Bytes()
+		}
+		vm.cost.hashIterations += hashDigestIterations(bip143PreimageLen+len(tokenPrefix)+
+			wire.VarIntSerializeSize(uint64(len(scriptCode)))+len(scriptCode), true)
+		return calcSignatureHash(scriptCode, vm.sigHashes, hashType, vm.tx, vm.txIdx, vm.amount, 0,
+			tokenPrefix), nil
+	}
+
+	var kept []parsedOpcode
+next:
+	for _, op := range script {
+		if op.value <= txscript.OP_PUSHDATA4 {
+			for _, sig := range sigs {
+				if len(sig) != 0 && bytes.Equal(op.data, sig) {
+					continue next
+				}
+			}
+		}
+		kept = append(kept, op)
+	}
+	return txscript.CalcSignatureHash(unparseScript(kept), hashType, vm.tx, vm.txIdx)
+}
+
+// checkTxSig returns whether sig, with its sighash type, is a valid signature
+// of the transaction by pubKey.
+func (vm *Engine) checkTxSig(sig, pubKey []byte, sigs ...[]byte) (bool, error) {
+	if err := vm.checkTxSigEncoding(sig); err != nil {
+		return false, err
+	}
+	if err := vm.checkPubKeyEncoding(pubKey); err != nil {
+		return false, err
+	}
+	if len(sig) == 0 {
+		return false, nil
+	}
+	hash, err := vm.sigHash(txscript.SigHashType(sig[len(sig)-1]), sigs...)
+	if err != nil {
+		return false, nil
+	}
+	return vm.verifySignature(sig[:len(sig)-1], pubKey, hash), nil
+}
+
+// checkResult ends a signature operation with its result.
+func (vm *Engine) checkResult(ok, verify bool, sigs ...[]byte) error {
+	if !ok && vm.hasFlag(ScriptVerifyNullFail) {
+		for _, sig := range sigs {
+			if len(sig) != 0 {
+				return ErrNullFail
+			}
+		}
+	}
+	if verify {
+		if !ok {
+			return ErrVerifyFailed
+		}
+		return nil
+	}
+	vm.push(fromBool(ok))
+	return nil
+}
+
+// opCheckSig executes OP_CHECKSIG and OP_CHECKSIGVERIFY.
+func (vm *Engine) opCheckSig(verify bool) error {
+	sig, pubKey, err := vm.popPair()
+	if err != nil {
+		return err
+	}
+	ok, err := vm.checkTxSig(sig, pubKey, sig)
+	if err != nil {
+		return err
+	}
+	if len(sig) != 0 {
+		vm.sigChecks++
+	}
+	return vm.checkResult(ok, verify, sig)
+}
+
+// opCheckMultiSig executes OP_CHECKMULTISIG and OP_CHECKMULTISIGVERIFY with
+// ECDSA signatures.
+func (vm *Engine) opCheckMultiSig(verify bool) error {
+	nKeys, err := vm.popNum()
+	if err != nil {
+		return err
+	}
+	if nKeys < 0 || nKeys > MaxPubKeysPerMultiSig {
+		return fmt.Errorf("%w: %d public keys", ErrScriptLimit, nKeys)
+	}
+	vm.numOps += int(nKeys)
+	if vm.numOps > MaxOpsPerScript && !vm.vmLimits {
+		return fmt.Errorf("%w: more than %d operations", ErrScriptLimit, MaxOpsPerScript)
+	}
+	pubKeys := make([][]byte, nKeys)
+	for i := range pubKeys {
+		if pubKeys[i], err = vm.pop(); err != nil {
+			return err
+		}
+	}
+	nSigs, err := vm.popNum()
+	if err != nil {
+		return err
+	}
+	if nSigs < 0 || nSigs > nKeys {
+		return fmt.Errorf("%w: %d signatures for %d keys", ErrScriptLimit, nSigs, nKeys)
+	}
+	sigs := make([][]byte, nSigs)
+	for i := range sigs {
+		if sigs[i], err = vm.pop(); err != nil {
+			return err
+		}
+	}
+	dummy, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if len(dummy) != 0 && vm.hasFlag(ScriptEnableSchnorrMultisig) {
+		return vm.opCheckSchnorrMultiSig(dummy, sigs, pubKeys, verify)
+	}
+
+	// Legacy multisig counts a check per key unless all signatures are
+	// null.
+	for _, sig := range sigs {
+		if len(sig) != 0 {
+			vm.sigChecks += len(pubKeys)
+			break
+		}
+	}
+
+	ok := true
+	for isig, ikey := 0, 0; isig < len(sigs); ikey++ {
+		if len(sigs)-isig > len(pubKeys)-ikey {
+			ok = false
+			break
+		}
+		sig := sigs[isig]
+		if len(sig) != 0 && vm.isSchnorr(sig[:len(sig)-1]) {
+			return fmt.Errorf("%w: Schnorr signature in legacy multisig", ErrSigEncoding)
+		}
+		valid, err := vm.checkTxSig(sig, pubKeys[ikey], sigs...)
+		if err != nil {
+			return err
+		}
+		if valid {
+			isig++
+		}
+	}
+	return vm.checkResult(ok, verify, sigs...)
+}
+
+// opCheckSchnorrMultiSig ends OP_CHECKMULTISIG and OP_CHECKMULTISIGVERIFY
+// in the Schnorr mode of the November 2019 upgrade, selected by a non-empty
+// dummy.  The dummy is a little-endian bitfield whose bit i is set when the
+// key i of the script, counting from the deepest in the stack, is checked.
+// sigs and pubKeys are in the order they were popped, and every signature
+// must be a valid Schnorr signature of its key, in the order of the keys.
+func (vm *Engine) opCheckSchnorrMultiSig(bitfield []byte, sigs, pubKeys [][]byte, verify bool) error {
+	if len(bitfield) != (len(pubKeys)+7)/8 {
+		return fmt.Errorf("%w: %d byte bitfield for %d public keys", ErrInvalidOperand,
+			len(bitfield), len(pubKeys))
+	}
+	var checkBits uint32
+	for i, b := range bitfield {
+		checkBits |= uint32(b) << (8 * uint(i))
+	}
+	if checkBits>>uint(len(pubKeys)) != 0 {
+		return fmt.Errorf("%w: bitfield %x selects keys out of range", ErrInvalidOperand, bitfield)
+	}
+	if n := bits.OnesCount32(checkBits); n != len(sigs) {
+		return fmt.Errorf("%w: bitfield selects %d keys for %d signatures", ErrInvalidOperand, n, len(sigs))
+	}
+
+	key := 0
+	for i := range sigs {
+		for checkBits>>uint(key)&1 == 0 {
+			key++
+		}
+		sig, pubKey := sigs[len(sigs)-1-i], pubKeys[len(pubKeys)-1-key]
+		if len(sig) != SchnorrSignatureLen+1 {
+			return fmt.Errorf("%w: ECDSA signature in Schnorr multisig", ErrSigEncoding)
+		}
+		ok, err := vm.checkTxSig(sig, pubKey)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: invalid signature %d of Schnorr multisig", ErrNullFail, i)
+		}
+		vm.sigChecks++
+		key++
+	}
+	return vm.checkResult(true, verify)
+}
+
+// opCheckDataSig executes OP_CHECKDATASIG and OP_CHECKDATASIGVERIFY.
+func (vm *Engine) opCheckDataSig(verify bool) error {
+	if err := vm.need(3); err != nil {
+		return err
+	}
+	pubKey, _ := vm.pop()
+	msg, _ := vm.pop()
+	sig, _ := vm.pop()
+	if err := vm.checkDataSigEncoding(sig); err != nil {
+		return err
+	}
+	if err := vm.checkPubKeyEncoding(pubKey); err != nil {
+		return err
+	}
+	hash := sha256.Sum256(msg)
+	vm.cost.hashIterations += hashDigestIterations(len(msg), false)
+	if len(sig) != 0 {
+		vm.sigChecks++
+	}
+	ok := len(sig) != 0 && vm.verifySignature(sig, pubKey, hash[:])
+	return vm.checkResult(ok, verify, sig)
+}
@@ -0,0 +1,204 @@
+package bchutil
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestEngineMainnet executes the inputs of the mainnet transactions of the
+// sighash tests.
+func TestEngineMainnet(t *testing.T) {
+	for i, test := range SigHashTestVectors {
+		raw, _ := hex.DecodeString(test.RawTx)
+		tx, err := btcutil.NewTxFromBytes(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgTx := tx.MsgTx()
+		sigHashes := txscript.NewTxSigHashes(msgTx)
+		for j, in := range test.Inputs {
+			pubKey, _ := hex.DecodeString(in.Pubkey)
+			pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(pubKey))
+			vm, err := NewEngine(pkScript, msgTx, j, StandardScriptFlags, sigHashes, in.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := vm.Execute(); err != nil {
+				t.Errorf("tx %d input %d: %v", i, j, err)
+			}
+			vm, _ = NewEngine(pkScript, msgTx, j, StandardScriptFlags, sigHashes, in.Value+1)
+			if err := vm.Execute(); !errors.Is(err, ErrNullFail) {
+				t.Errorf("tx %d input %d: got %v with the wrong amount", i, j, err)
+			}
+		}
+	}
+}
+
+// engineTestTx returns a transaction spending one output with scriptSig.
+func engineTestTx(scriptSig []byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), scriptSig, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, nil))
+	return tx
+}
+
+func TestEngineScripts(t *testing.T) {
+	tests := []struct {
+		scriptSig string
+		pkScript  string
+		err       error
+	}{
+		{"", "51", nil},
+		{"", "00", ErrEvalFalse},
+		{"", "", ErrEvalFalse},
+		{"5152", "935387", nil},                        // 1 2 ADD 3 EQUAL
+		{"52", "53955687", nil},                        // 2 3 MUL 6 EQUAL
+		{"", "516300630067516868", nil},                // 1 IF 0 IF 0 ELSE 1 ENDIF ENDIF
+		{"", "006300675168", nil},                      // 0 IF 0 ELSE 1 ENDIF
+		{"", "5163", ErrUnbalancedConditional},         // 1 IF
+		{"", "68", ErrUnbalancedConditional},           // ENDIF
+		{"", "6a", ErrEarlyReturn},                     // RETURN
+		{"", "00638d6851", ErrBadOpcode},               // 0 IF 2MUL ENDIF 1
+		{"", "0063ba6851", nil},                        // 0 IF CHECKDATASIG ENDIF 1
+		{"", "c0", ErrUnsupportedOpcode},               // INPUTINDEX
+		{"", "5151", ErrCleanStack},                    // 1 1
+		{"", "510096", ErrDivideByZero},                // 1 0 DIV
+		{"", "0201020203047e040102030487", nil},        // CAT
+		{"", "03010203527f538802010287", nil},          // SPLIT
+		{"", "03010203bc0303020187", nil},              // REVERSEBYTES
+		{"", "525480040200000087", nil},                // 2 4 NUM2BIN
+		{"", "4f528002018087", nil},                    // -1 2 NUM2BIN
+		{"", "0201", ErrMalformedPush},                 // truncated push
+		{"0101", "51", ErrMinimalData},                 // non-minimal push of 1
+		{"51", "7551", nil},                            // DROP 1
+		{"51", "75", ErrEvalFalse},                     // DROP
+		{"", "b1", ErrInvalidStackOperation},           // CHECKLOCKTIMEVERIFY
+		{"", "b0", ErrDiscourageUpgradableNops},        // NOP1
+		{"", "08ffffffffffffff7f8b", ErrInvalidNumber}, // MaxInt64 1ADD
+	}
+	for i, test := range tests {
+		scriptSig, _ := hex.DecodeString(test.scriptSig)
+		pkScript, _ := hex.DecodeString(test.pkScript)
+		tx := engineTestTx(scriptSig)
+		vm, err := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, 1000)
+		if err == nil {
+			err = vm.Execute()
+		}
+		if !errors.Is(err, test.err) || (err != nil && test.err == nil) {
+			t.Errorf("test %d: got %v, want %v", i, err, test.err)
+		}
+	}
+}
+
+func TestEngineP2SHMultisig(t *testing.T) {
+	keys := signingTestKeys()
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_2)
+	for _, key := range keys {
+		builder.AddData(key.PubKey().SerializeCompressed())
+	}
+	redeemScript, _ := builder.AddOp(txscript.OP_2).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	pkScript, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+
+	tx := engineTestTx(nil)
+	sign := func(keys ...*btcec.PrivateKey) []byte {
+		builder := txscript.NewScriptBuilder().AddOp(txscript.OP_0)
+		for _, key := range keys {
+			sig, err := RawTxInSignature(tx, 0, redeemScript, txscript.SigHashAll, key, 5000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			builder.AddData(sig)
+		}
+		scriptSig, _ := builder.AddData(redeemScript).Script()
+		return scriptSig
+	}
+
+	tests := []struct {
+		keys []*btcec.PrivateKey
+		err  error
+	}{
+		{keys, nil},
+		{[]*btcec.PrivateKey{keys[1], keys[0]}, ErrNullFail},
+		{keys[:1], ErrInvalidStackOperation},
+	}
+	for i, test := range tests {
+		tx.TxIn[0].SignatureScript = sign(test.keys...)
+		vm, err := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Execute(); !errors.Is(err, test.err) || (err != nil && test.err == nil) {
+			t.Errorf("test %d: got %v, want %v", i, err, test.err)
+		}
+	}
+}
+
+func TestEngineSchnorr(t *testing.T) {
+	key := signingTestKeys()[0]
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	tx := engineTestTx(nil)
+	hashType := txscript.SigHashAll | SigHashForkID
+	hash := calcBip143SignatureHash(pkScript, txscript.NewTxSigHashes(tx), hashType, tx, 0, 1000)
+	sig, err := SignSchnorr(key, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TxIn[0].SignatureScript, _ = txscript.NewScriptBuilder().
+		AddData(append(sig, byte(hashType))).
+		AddData(key.PubKey().SerializeCompressed()).Script()
+	vm, err := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestEngineTokenPrevout spends a token output, whose signatures commit to
+// its token prefix.
+func TestEngineTokenPrevout(t *testing.T) {
+	key := signingTestKeys()[0]
+	lockingScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	token := &TokenData{Category: chainhash.Hash{7}, HasNFT: true, Commitment: []byte{1, 2}, Amount: 100}
+	pkScript := append(token.Bytes(), lockingScript...)
+	other := *token
+	other.Amount++
+
+	tests := []struct {
+		opts []SignOption
+		err  error
+	}{
+		{[]SignOption{WithTokenPrevout(token)}, nil},
+		{nil, ErrNullFail},
+		{[]SignOption{WithTokenPrevout(&other)}, ErrNullFail},
+	}
+	for i, test := range tests {
+		tx := engineTestTx(nil)
+		scriptSig, err := SignatureScript(tx, 0, lockingScript, SigHashAllForkID, key, true, 1000, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TxIn[0].SignatureScript = scriptSig
+		vm, err := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Execute(); !errors.Is(err, test.err) || (err != nil && test.err == nil) {
+			t.Errorf("test %d: got %v, want %v", i, err, test.err)
+		}
+	}
+
+	malformed := append([]byte{0xef}, lockingScript...)
+	if _, err := NewEngine(malformed, engineTestTx(nil), 0, StandardScriptFlags, nil, 1000); !errors.Is(err,
+		ErrInvalidTokenPrefix) {
+		t.Errorf("got %v for a malformed token prefix", err)
+	}
+}
@@ -0,0 +1,387 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// ErrInvalidEscrowPayout describes an error where a payout spends outputs
+// that are not those of its escrow, or pays others than the buyer and the
+// seller.
+var ErrInvalidEscrowPayout = errors.New("invalid escrow payout")
+
+// EscrowRole is a party of an Escrow.
+type EscrowRole int
+
+const (
+	// EscrowBuyer is the party funding the escrow, refunded if the deal
+	// falls through.
+	EscrowBuyer EscrowRole = iota
+
+	// EscrowSeller is the party paid by the escrow once the deal is done.
+	EscrowSeller
+
+	// EscrowArbiter is the party settling disputes, whose signature and the
+	// signature of either the buyer or the seller spend the escrow.
+	EscrowArbiter
+)
+
+// String returns the name of the role.
+func (r EscrowRole) String() string {
+	switch r {
+	case EscrowBuyer:
+		return "buyer"
+	case EscrowSeller:
+		return "seller"
+	case EscrowArbiter:
+		return "arbiter"
+	}
+	return fmt.Sprintf("EscrowRole(%d)", int(r))
+}
+
+// Escrow is the 2-of-3 multisig of a buyer, a seller and an arbiter, behind a
+// pay-to-script-hash address.  Any two of them spend its outputs with a
+// payout releasing the funds to the seller, refunding the buyer, or splitting
+// the funds between both as decided by the arbiter.
+type Escrow struct {
+	// pubKeys are the compressed public keys of the parties, by role.
+	pubKeys [3][]byte
+
+	redeemScript []byte
+	pkScript     []byte
+	address      btcutil.Address
+}
+
+// NewEscrow returns the escrow of the buyer, seller and arbiter public keys,
+// whose redeem script is the multisig script of the keys sorted by their
+// compressed encoding, behind a pay-to-script-hash address of params with a
+// 20 bytes hash.
+func NewEscrow(buyerPub, sellerPub, arbiterPub *btcec.PublicKey, params *chaincfg.Params) (*Escrow, error) {
+	return newEscrow([]*btcec.PublicKey{buyerPub, sellerPub, arbiterPub}, params, false)
+}
+
+// NewEscrowP2SH32 returns the escrow of the public keys like NewEscrow, behind
+// a pay-to-script-hash address with a 32 bytes hash.
+func NewEscrowP2SH32(buyerPub, sellerPub, arbiterPub *btcec.PublicKey, params *chaincfg.Params) (*Escrow, error) {
+	return newEscrow([]*btcec.PublicKey{buyerPub, sellerPub, arbiterPub}, params, true)
+}
+
+func newEscrow(pubKeys []*btcec.PublicKey, params *chaincfg.Params, p2sh32 bool) (*Escrow, error) {
+	e := &Escrow{}
+	for role, pubKey := range pubKeys {
+		if pubKey == nil {
+			return nil, fmt.Errorf("no %v public key", EscrowRole(role))
+		}
+		e.pubKeys[role] = pubKey.SerializeCompressed()
+		for other := 0; other < role; other++ {
+			if bytes.Equal(e.pubKeys[role], e.pubKeys[other]) {
+				return nil, fmt.Errorf("%v and %v public keys are the same", EscrowRole(other),
+					EscrowRole(role))
+			}
+		}
+	}
+
+	sorted := append([][]byte(nil), e.pubKeys[:]...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	builder := NewScriptBuilder().AddOp(txscript.OP_2)
+	for _, pubKey := range sorted {
+		builder.AddData(pubKey)
+	}
+	var err error
+	if e.redeemScript, err = builder.AddOp(txscript.OP_3).AddOp(txscript.OP_CHECKMULTISIG).Script(); err != nil {
+		return nil, err
+	}
+
+	if p2sh32 {
+		e.address, err = NewCashAddressScriptHash32(e.redeemScript, params)
+	} else {
+		e.address, err = NewCashAddressScriptHash(e.redeemScript, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.pkScript, err = PayToAddrScript(e.address); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Address returns the address funding the escrow.
+func (e *Escrow) Address() btcutil.Address {
+	return e.address
+}
+
+// RedeemScript returns the multisig redeem script of the escrow.
+func (e *Escrow) RedeemScript() []byte {
+	return e.redeemScript
+}
+
+// PkScript returns the output script of the address of the escrow.
+func (e *Escrow) PkScript() []byte {
+	return e.pkScript
+}
+
+// partyScript returns the pay-to-pubkey-hash script paying role.
+func (e *Escrow) partyScript(role EscrowRole) []byte {
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(e.pubKeys[role]))
+	return pkScript
+}
+
+// BuildRelease returns the payout of utxos, outputs of the escrow, to the
+// seller, who receives their value less the fee at feeRate.
+func (e *Escrow) BuildRelease(utxos []UTXO, feeRate FeeRate) (*EscrowPayout, error) {
+	return e.buildPayout(utxos, feeRate, EscrowSeller, 0)
+}
+
+// BuildRefund returns the payout of utxos, outputs of the escrow, to the
+// buyer, who receives their value less the fee at feeRate.
+func (e *Escrow) BuildRefund(utxos []UTXO, feeRate FeeRate) (*EscrowPayout, error) {
+	return e.buildPayout(utxos, feeRate, EscrowBuyer, 0)
+}
+
+// BuildSplit returns the payout of utxos, outputs of the escrow, paying
+// sellerAmount to the seller and refunding the rest to the buyer, less the fee
+// at feeRate.  Splits leaving either party a dust output fail.
+func (e *Escrow) BuildSplit(utxos []UTXO, feeRate FeeRate, sellerAmount btcutil.Amount) (*EscrowPayout, error) {
+	if sellerAmount <= 0 {
+		return nil, fmt.Errorf("seller amount %v is not positive", sellerAmount)
+	}
+	return e.buildPayout(utxos, feeRate, EscrowBuyer, sellerAmount)
+}
+
+// buildPayout returns the payout of utxos paying the value left by
+// otherAmount and the fee to role, and otherAmount, if not zero, to the other
+// of the buyer and the seller.
+func (e *Escrow) buildPayout(utxos []UTXO, feeRate FeeRate, role EscrowRole,
+	otherAmount btcutil.Amount) (*EscrowPayout, error) {
+
+	if len(utxos) == 0 {
+		return nil, fmt.Errorf("%w: no output to spend", ErrInsufficientFunds)
+	}
+	if err := CheckAmount(otherAmount); err != nil {
+		return nil, err
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	var total btcutil.Amount
+	for i := range utxos {
+		tx.AddTxIn(wire.NewTxIn(&utxos[i].OutPoint, nil, nil))
+		var err error
+		if total, err = AddChecked(total, utxos[i].Amount); err != nil {
+			return nil, err
+		}
+	}
+	if otherAmount != 0 {
+		other := EscrowBuyer
+		if role == EscrowBuyer {
+			other = EscrowSeller
+		}
+		tx.AddTxOut(wire.NewTxOut(int64(otherAmount), e.partyScript(other)))
+	}
+	txOut := wire.NewTxOut(0, e.partyScript(role))
+	tx.AddTxOut(txOut)
+
+	inputSize := InputSize(txscript.ScriptHashTy, InputSizeOptions{RequiredSigs: 2, PubKeys: 3})
+	fee := feeRate.Fee(tx.SerializeSize() + len(tx.TxIn)*(inputSize-EstimateInputSize(0)))
+	txOut.Value = int64(total - otherAmount - fee)
+	for _, txOut := range tx.TxOut {
+		if IsDust(txOut) {
+			return nil, fmt.Errorf("%w: %v in escrow, %v to the seller, fee of %v", ErrInsufficientFunds,
+				total, otherAmount, fee)
+		}
+	}
+	return e.Payout(tx, utxos)
+}
+
+// EscrowPayout is a transaction spending outputs of an Escrow, with the
+// signatures of its parties collected so far.
+type EscrowPayout struct {
+	Tx *wire.MsgTx
+
+	// Inputs are the outputs spent by the inputs of Tx, in order, and Fee
+	// the fee Tx pays.
+	Inputs []UTXO
+	Fee    btcutil.Amount
+
+	escrow *Escrow
+
+	// sigs are the signatures of the inputs, by role and index.
+	sigs map[EscrowRole]map[int][]byte
+}
+
+// Payout returns the payout of the unsigned transaction tx, spending inputs,
+// such as a payout built by another party.  The inputs of tx must spend the
+// outputs of inputs, outputs of the escrow without tokens, and its outputs
+// must pay the buyer and the seller only, at most once each; other payouts
+// fail with ErrInvalidEscrowPayout.
+func (e *Escrow) Payout(tx *wire.MsgTx, inputs []UTXO) (*EscrowPayout, error) {
+	if len(tx.TxIn) != len(inputs) {
+		return nil, fmt.Errorf("%w: %d outputs spent by %d inputs", ErrInvalidEscrowPayout, len(inputs),
+			len(tx.TxIn))
+	}
+	spent := make(map[wire.OutPoint]bool, len(inputs))
+	var in btcutil.Amount
+	for i, txIn := range tx.TxIn {
+		u := &inputs[i]
+		switch {
+		case txIn.PreviousOutPoint != u.OutPoint:
+			return nil, fmt.Errorf("%w: input %d spends %v, not %v", ErrInvalidEscrowPayout, i,
+				txIn.PreviousOutPoint, u.OutPoint)
+		case spent[u.OutPoint]:
+			return nil, fmt.Errorf("%w: %v spent twice", ErrInvalidEscrowPayout, u.OutPoint)
+		case !bytes.Equal(u.PkScript, e.pkScript):
+			return nil, fmt.Errorf("%w: input %d spends an output not paying the escrow",
+				ErrInvalidEscrowPayout, i)
+		case u.HasTokens():
+			return nil, fmt.Errorf("%w: input %d spends tokens", ErrInvalidEscrowPayout, i)
+		case len(txIn.SignatureScript) != 0:
+			return nil, fmt.Errorf("%w: input %d is already signed", ErrInvalidEscrowPayout, i)
+		}
+		spent[u.OutPoint] = true
+		var err error
+		if in, err = AddChecked(in, u.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(tx.TxOut) == 0 {
+		return nil, fmt.Errorf("%w: no output", ErrInvalidEscrowPayout)
+	}
+	paid := make(map[EscrowRole]bool)
+	var out btcutil.Amount
+	for i, txOut := range tx.TxOut {
+		role := EscrowArbiter
+		for _, party := range []EscrowRole{EscrowBuyer, EscrowSeller} {
+			if bytes.Equal(txOut.PkScript, e.partyScript(party)) {
+				role = party
+			}
+		}
+		if role == EscrowArbiter || paid[role] {
+			return nil, fmt.Errorf("%w: output %d does not pay the buyer or the seller once",
+				ErrInvalidEscrowPayout, i)
+		}
+		paid[role] = true
+		var err error
+		if out, err = AddChecked(out, btcutil.Amount(txOut.Value)); err != nil {
+			return nil, fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+	if out > in {
+		return nil, fmt.Errorf("%w: %v paid from %v", ErrNegativeFee, out, in)
+	}
+	return &EscrowPayout{Tx: tx, Inputs: inputs, Fee: in - out, escrow: e,
+		sigs: make(map[EscrowRole]map[int][]byte)}, nil
+}
+
+// prevOuts returns the outputs spent by the payout, by input index.
+func (p *EscrowPayout) prevOuts() map[int]*wire.TxOut {
+	prevOuts := make(map[int]*wire.TxOut, len(p.Inputs))
+	for i := range p.Inputs {
+		prevOuts[i] = p.Inputs[i].TxOut()
+	}
+	return prevOuts
+}
+
+// SignAs signs every input of the payout with key, the key of role, records
+// the signatures and returns them to be sent to the other parties.  The
+// options are those of SignInput and WithFeeLimits; the sighash type is
+// SigHashAllForkID.
+func (p *EscrowPayout) SignAs(role EscrowRole, key *btcec.PrivateKey, opts ...SignOption) ([]InputSignature, error) {
+	if role < EscrowBuyer || role > EscrowArbiter {
+		return nil, fmt.Errorf("unknown escrow role %v", role)
+	}
+	pubKey := key.PubKey().SerializeCompressed()
+	if !bytes.Equal(pubKey, p.escrow.pubKeys[role]) {
+		return nil, fmt.Errorf("%w: key is not the %v key of the escrow", ErrKeyNotInScript, role)
+	}
+	o := newSignOptions(append([]SignOption{WithSigHashes(txscript.NewTxSigHashes(p.Tx))}, opts...))
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	if err := o.checkFee(p.Tx, p.prevOuts()); err != nil {
+		return nil, err
+	}
+	if err := o.checkPrevOuts(p.Tx, p.prevOuts()); err != nil {
+		return nil, err
+	}
+
+	sigs := make([]InputSignature, 0, len(p.Tx.TxIn))
+	for i := range p.Tx.TxIn {
+		sig, err := o.signInput(p.Tx, i, p.escrow.redeemScript, SigHashAllForkID, key, int64(p.Inputs[i].Amount))
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		sigs = append(sigs, InputSignature{Index: uint32(i), PubKey: pubKey, Signature: sig})
+	}
+	if err := p.AddSignatures(role, sigs); err != nil {
+		return nil, err
+	}
+	return sigs, nil
+}
+
+// AddSignatures records sigs, signatures of the inputs of the payout by the
+// key of role, returned by SignAs to another party.  They must be valid
+// signatures of their input, of sighash type SigHashAllForkID.
+func (p *EscrowPayout) AddSignatures(role EscrowRole, sigs []InputSignature) error {
+	if role < EscrowBuyer || role > EscrowArbiter {
+		return fmt.Errorf("unknown escrow role %v", role)
+	}
+	pubKey := p.escrow.pubKeys[role]
+	sigHashes := txscript.NewTxSigHashes(p.Tx)
+	for _, s := range sigs {
+		idx := int(s.Index)
+		switch {
+		case idx >= len(p.Tx.TxIn):
+			return fmt.Errorf("input index %d out of range", s.Index)
+		case !bytes.Equal(s.PubKey, pubKey):
+			return fmt.Errorf("input %d: signature of a key other than the %v key", idx, role)
+		case len(s.Signature) == 0 || txscript.SigHashType(s.Signature[len(s.Signature)-1]) != SigHashAllForkID:
+			return fmt.Errorf("input %d: %w: %v signature is not %s", idx, ErrUnsupportedSigHashType, role,
+				SigHashTypeString(SigHashAllForkID))
+		}
+		hash := calcBip143SignatureHash(p.escrow.redeemScript, sigHashes, SigHashAllForkID, p.Tx, idx,
+			int64(p.Inputs[idx].Amount))
+		if !verifySignature(s.Signature[:len(s.Signature)-1], pubKey, hash, true) {
+			return fmt.Errorf("input %d: %v signature does not verify", idx, role)
+		}
+	}
+	if p.sigs[role] == nil {
+		p.sigs[role] = make(map[int][]byte)
+	}
+	for _, s := range sigs {
+		p.sigs[role][int(s.Index)] = s.Signature
+	}
+	return nil
+}
+
+// Combine returns a copy of the transaction of the payout whose inputs are
+// spent with the signatures of two parties, all ECDSA or all Schnorr
+// signatures for each input.
+func (p *EscrowPayout) Combine() (*wire.MsgTx, error) {
+	tx := p.Tx.Copy()
+	for i, txIn := range tx.TxIn {
+		var sigs []InputSignature
+		for _, role := range []EscrowRole{EscrowBuyer, EscrowSeller, EscrowArbiter} {
+			if sig, ok := p.sigs[role][i]; ok {
+				sigs = append(sigs, InputSignature{Index: uint32(i), PubKey: p.escrow.pubKeys[role],
+					Signature: sig})
+			}
+		}
+		if len(sigs) < 2 {
+			return nil, fmt.Errorf("input %d: signatures of %d parties, 2 needed", i, len(sigs))
+		}
+		scriptSig, err := CombineSignatures(p.escrow.redeemScript, sigs)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		txIn.SignatureScript = scriptSig
+	}
+	return tx, nil
+}
@@ -0,0 +1,188 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func escrowTestKeys() []*btcec.PrivateKey {
+	var keys []*btcec.PrivateKey
+	for i := byte(1); i <= 3; i++ {
+		key, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{i})
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func escrowTestUTXOs(e *Escrow) []UTXO {
+	return []UTXO{
+		{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 60000, PkScript: e.PkScript()},
+		{OutPoint: wire.OutPoint{Hash: chainhash.Hash{2}, Index: 1}, Amount: 40000, PkScript: e.PkScript()},
+	}
+}
+
+// verifyEscrowTx runs the scripts of the inputs of tx.
+func verifyEscrowTx(t *testing.T, tx *wire.MsgTx, utxos []UTXO) {
+	t.Helper()
+	for i, u := range utxos {
+		vm, err := NewEngine(u.PkScript, tx, i, StandardScriptFlags, nil, int64(u.Amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Fatalf("input %d: %v", i, err)
+		}
+	}
+}
+
+func TestEscrowRelease(t *testing.T) {
+	keys := escrowTestKeys()
+	for _, newEscrow := range []func(a, b, c *btcec.PublicKey, params *chaincfg.Params) (*Escrow, error){
+		NewEscrow, NewEscrowP2SH32} {
+
+		e, err := newEscrow(keys[0].PubKey(), keys[1].PubKey(), keys[2].PubKey(), &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		utxos := escrowTestUTXOs(e)
+		payout, err := e.BuildRelease(utxos, MinRelayFeeRate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payout.Tx.TxOut) != 1 || payout.Tx.TxOut[0].Value != int64(100000-payout.Fee) {
+			t.Fatalf("wrong release outputs")
+		}
+
+		// The seller signs a copy of the payout received from the buyer.
+		buyerSigs, err := payout.SignAs(EscrowBuyer, keys[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := payout.Combine(); err == nil {
+			t.Error("payout combined with one signature")
+		}
+		received, err := e.Payout(payout.Tx.Copy(), utxos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := received.AddSignatures(EscrowBuyer, buyerSigs); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := received.SignAs(EscrowSeller, keys[1]); err != nil {
+			t.Fatal(err)
+		}
+		tx, err := received.Combine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifyEscrowTx(t, tx, utxos)
+		if fee := payout.Fee; fee < MinRelayFeeRate.Fee(tx.SerializeSize()) {
+			t.Errorf("fee %v for %d bytes", fee, tx.SerializeSize())
+		}
+	}
+}
+
+func TestEscrowRefundAndSplit(t *testing.T) {
+	keys := escrowTestKeys()
+	e, err := NewEscrow(keys[0].PubKey(), keys[1].PubKey(), keys[2].PubKey(), &chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utxos := escrowTestUTXOs(e)
+
+	refund, err := e.BuildRefund(utxos, MinRelayFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := refund.SignAs(EscrowSeller, keys[1], WithSchnorr()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := refund.SignAs(EscrowArbiter, keys[2], WithSchnorr()); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := refund.Combine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyEscrowTx(t, tx, utxos)
+
+	split, err := e.BuildSplit(utxos, MinRelayFeeRate, 30000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if split.Tx.TxOut[0].Value != 30000 || split.Tx.TxOut[1].Value != int64(70000-split.Fee) {
+		t.Errorf("wrong split outputs")
+	}
+	for _, role := range []EscrowRole{EscrowBuyer, EscrowArbiter} {
+		if _, err := split.SignAs(role, keys[role]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tx, err = split.Combine(); err != nil {
+		t.Fatal(err)
+	}
+	verifyEscrowTx(t, tx, utxos)
+
+	if _, err := e.BuildSplit(utxos, MinRelayFeeRate, 99900); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("dust split: got %v, want ErrInsufficientFunds", err)
+	}
+	if _, err := split.SignAs(EscrowSeller, keys[0]); !errors.Is(err, ErrKeyNotInScript) {
+		t.Errorf("wrong key: got %v, want ErrKeyNotInScript", err)
+	}
+	sigs, _ := split.SignAs(EscrowBuyer, keys[0])
+	if err := split.AddSignatures(EscrowSeller, sigs); err == nil {
+		t.Error("buyer signatures added as the seller")
+	}
+	if _, err := NewEscrow(keys[0].PubKey(), keys[0].PubKey(), keys[2].PubKey(), &chaincfg.MainNetParams); err == nil {
+		t.Error("escrow with the same buyer and seller key")
+	}
+}
+
+func TestEscrowPayoutValidation(t *testing.T) {
+	keys := escrowTestKeys()
+	e, _ := NewEscrow(keys[0].PubKey(), keys[1].PubKey(), keys[2].PubKey(), &chaincfg.MainNetParams)
+	utxos := escrowTestUTXOs(e)
+	payout, err := e.BuildRelease(utxos, MinRelayFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := payToPubKeyHashScript(btcutil.Hash160(keys[2].PubKey().SerializeCompressed()))
+
+	tests := []struct {
+		name   string
+		modify func(tx *wire.MsgTx, utxos []UTXO)
+	}{
+		{"arbiter output", func(tx *wire.MsgTx, utxos []UTXO) { tx.TxOut[0].PkScript = other }},
+		{"extra output", func(tx *wire.MsgTx, utxos []UTXO) {
+			tx.AddTxOut(wire.NewTxOut(1000, tx.TxOut[0].PkScript))
+		}},
+		{"foreign input", func(tx *wire.MsgTx, utxos []UTXO) { utxos[1].PkScript = other }},
+		{"token input", func(tx *wire.MsgTx, utxos []UTXO) {
+			utxos[0].TokenData = (&TokenData{Amount: 1}).Bytes()
+		}},
+		{"other outpoint", func(tx *wire.MsgTx, utxos []UTXO) { tx.TxIn[0].PreviousOutPoint.Index = 7 }},
+	}
+	for _, test := range tests {
+		tx := payout.Tx.Copy()
+		inputs := escrowTestUTXOs(e)
+		test.modify(tx, inputs)
+		if _, err := e.Payout(tx, inputs); !errors.Is(err, ErrInvalidEscrowPayout) {
+			t.Errorf("%s: got %v, want ErrInvalidEscrowPayout", test.name, err)
+		}
+	}
+
+	tx := payout.Tx.Copy()
+	tx.TxOut[0].Value = 200000
+	if _, err := e.Payout(tx, utxos); !errors.Is(err, ErrNegativeFee) {
+		t.Errorf("got %v, want ErrNegativeFee", err)
+	}
+	if _, err := payout.SignAs(EscrowBuyer, keys[0], WithFeeLimits(0, 100)); !errors.Is(err, ErrAbsurdFee) {
+		t.Errorf("got %v, want ErrAbsurdFee", err)
+	}
+}
@@ -0,0 +1,244 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// serializedExtKeyLen is the length of a serialized extended key, followed
+// by a 4 byte checksum in its base58 encoding.
+const serializedExtKeyLen = 78
+
+var (
+	// ErrUnknownKeyVersion describes an error where the version bytes of an
+	// extended key are those of no known network and format.
+	ErrUnknownKeyVersion = errors.New("unknown extended key version")
+
+	// ErrSLIP132Key describes an error where an extended key has the
+	// SLIP-132 version bytes of a segwit format, refused by strict decoding.
+	ErrSLIP132Key = errors.New("SLIP-132 extended key")
+)
+
+// ExtendedKeyFormat is the script type the version bytes of an extended key
+// declare under SLIP-132.  The segwit formats are meaningless on Bitcoin
+// Cash, but their keys are BIP32 keys all the same.
+type ExtendedKeyFormat int
+
+const (
+	// ExtendedKeyStandard is the BIP32 format of the network, xpub and
+	// xprv on mainnet, tpub and tprv on testnet and regtest.
+	ExtendedKeyStandard ExtendedKeyFormat = iota
+
+	// ExtendedKeyNestedSegwit is P2WPKH nested in P2SH, ypub and upub.
+	ExtendedKeyNestedSegwit
+
+	// ExtendedKeySegwit is P2WPKH, zpub and vpub.
+	ExtendedKeySegwit
+
+	// ExtendedKeyNestedSegwitMultisig is P2WSH nested in P2SH, Ypub and
+	// Upub.
+	ExtendedKeyNestedSegwitMultisig
+
+	// ExtendedKeySegwitMultisig is P2WSH, Zpub and Vpub.
+	ExtendedKeySegwitMultisig
+)
+
+// String returns the name of the format.
+func (f ExtendedKeyFormat) String() string {
+	switch f {
+	case ExtendedKeyStandard:
+		return "standard"
+	case ExtendedKeyNestedSegwit:
+		return "p2wpkh-p2sh"
+	case ExtendedKeySegwit:
+		return "p2wpkh"
+	case ExtendedKeyNestedSegwitMultisig:
+		return "p2wsh-p2sh"
+	case ExtendedKeySegwitMultisig:
+		return "p2wsh"
+	}
+	return fmt.Sprintf("ExtendedKeyFormat(%d)", int(f))
+}
+
+// extKeyVersions are the public and private version bytes of a format.
+type extKeyVersions struct {
+	format    ExtendedKeyFormat
+	pub, priv [4]byte
+}
+
+// slip132Versions are the SLIP-132 versions of the segwit formats, by the
+// standard public version of the networks they are for.
+var slip132Versions = map[[4]byte][]extKeyVersions{
+	chaincfg.MainNetParams.HDPublicKeyID: {
+		{format: ExtendedKeyNestedSegwit, pub: [4]byte{0x04, 0x9d, 0x7c, 0xb2}, priv: [4]byte{0x04, 0x9d, 0x78, 0x78}},
+		{format: ExtendedKeySegwit, pub: [4]byte{0x04, 0xb2, 0x47, 0x46}, priv: [4]byte{0x04, 0xb2, 0x43, 0x0c}},
+		{format: ExtendedKeyNestedSegwitMultisig, pub: [4]byte{0x02, 0x95, 0xb4, 0x3f},
+			priv: [4]byte{0x02, 0x95, 0xb0, 0x05}},
+		{format: ExtendedKeySegwitMultisig, pub: [4]byte{0x02, 0xaa, 0x7e, 0xd3},
+			priv: [4]byte{0x02, 0xaa, 0x7a, 0x99}},
+	},
+	chaincfg.TestNet3Params.HDPublicKeyID: {
+		{format: ExtendedKeyNestedSegwit, pub: [4]byte{0x04, 0x4a, 0x52, 0x62}, priv: [4]byte{0x04, 0x4a, 0x4e, 0x28}},
+		{format: ExtendedKeySegwit, pub: [4]byte{0x04, 0x5f, 0x1c, 0xf6}, priv: [4]byte{0x04, 0x5f, 0x18, 0xbc}},
+		{format: ExtendedKeyNestedSegwitMultisig, pub: [4]byte{0x02, 0x42, 0x89, 0xef},
+			priv: [4]byte{0x02, 0x42, 0x85, 0xb5}},
+		{format: ExtendedKeySegwitMultisig, pub: [4]byte{0x02, 0x57, 0x54, 0x83},
+			priv: [4]byte{0x02, 0x57, 0x50, 0x48}},
+	},
+}
+
+// networkExtKeyVersions returns the versions of the extended keys of params,
+// the standard ones first.  Networks sharing standard versions, such as
+// testnet and regtest, share SLIP-132 ones.
+func networkExtKeyVersions(params *chaincfg.Params) []extKeyVersions {
+	versions := []extKeyVersions{{format: ExtendedKeyStandard, pub: params.HDPublicKeyID,
+		priv: params.HDPrivateKeyID}}
+	return append(versions, slip132Versions[params.HDPublicKeyID]...)
+}
+
+// findExtKeyVersion returns the versions of params having version, public or
+// private.
+func findExtKeyVersion(params *chaincfg.Params, version [4]byte) (extKeyVersions, bool, bool) {
+	for _, v := range networkExtKeyVersions(params) {
+		if version == v.pub || version == v.priv {
+			return v, version == v.priv, true
+		}
+	}
+	return extKeyVersions{}, false, false
+}
+
+// KeyMeta describes the encoding of an extended key DecodeExtendedKey
+// decoded.
+type KeyMeta struct {
+	// Version is the version of the string decoded, and Format the format
+	// it declares.
+	Version [4]byte
+	Format  ExtendedKeyFormat
+
+	// Private is whether the key is private.
+	Private bool
+
+	// Converted is whether the key had SLIP-132 version bytes, replaced by
+	// those of the standard format.  The key material is the same, but
+	// the wallet exporting it may derive other paths than BIP44 ones: the
+	// user is to be warned the addresses may not be those of the wallet.
+	Converted bool
+}
+
+// extKeyOptions are the options of DecodeExtendedKey.
+type extKeyOptions struct {
+	strict bool
+}
+
+// ExtendedKeyOption is an option of DecodeExtendedKey.
+type ExtendedKeyOption func(*extKeyOptions)
+
+// StrictExtendedKeyVersion makes DecodeExtendedKey reject the SLIP-132 keys
+// with ErrSLIP132Key rather than converting them.
+func StrictExtendedKeyVersion() ExtendedKeyOption {
+	return func(o *extKeyOptions) {
+		o.strict = true
+	}
+}
+
+// DecodeExtendedKey decodes the base58 extended key s of params, public or
+// private.  Keys of the SLIP-132 formats, such as ypub and zpub, are
+// converted to the standard format of params, and flagged as Converted in
+// their KeyMeta, unless StrictExtendedKeyVersion rejects them.  Keys of
+// another network fail with an error wrapping ErrNetworkMismatch, and
+// versions of no known network with ErrUnknownKeyVersion.  The key returned
+// is for params, to be derived and used in descriptors as any other.
+func DecodeExtendedKey(s string, params *chaincfg.Params, opts ...ExtendedKeyOption) (*hdkeychain.ExtendedKey,
+	KeyMeta, error) {
+
+	var o extKeyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	decoded := base58.Decode(s)
+	if len(decoded) != serializedExtKeyLen+4 {
+		return nil, KeyMeta{}, hdkeychain.ErrInvalidKeyLen
+	}
+	payload := decoded[:serializedExtKeyLen]
+	if !bytes.Equal(decoded[serializedExtKeyLen:], chainhash.DoubleHashB(payload)[:4]) {
+		return nil, KeyMeta{}, hdkeychain.ErrBadChecksum
+	}
+
+	var meta KeyMeta
+	copy(meta.Version[:], payload[:4])
+	versions, private, ok := findExtKeyVersion(params, meta.Version)
+	if !ok {
+		for _, net := range knownNetworks {
+			if _, _, ok := findExtKeyVersion(net, meta.Version); ok {
+				return nil, KeyMeta{}, fmt.Errorf("%w: extended key for %s, want %s", ErrNetworkMismatch,
+					net.Name, params.Name)
+			}
+		}
+		return nil, KeyMeta{}, fmt.Errorf("%w: %x", ErrUnknownKeyVersion, meta.Version)
+	}
+	meta.Format = versions.format
+	meta.Private = private
+	if meta.Format != ExtendedKeyStandard {
+		if o.strict {
+			return nil, KeyMeta{}, fmt.Errorf("%w: %s key", ErrSLIP132Key, meta.Format)
+		}
+		meta.Converted = true
+	}
+
+	key, err := hdkeychain.NewKeyFromString(encodeExtKeyVersion(payload, params, private))
+	if err != nil {
+		return nil, KeyMeta{}, err
+	}
+	if key.IsPrivate() != private {
+		return nil, KeyMeta{}, errors.New("extended key data does not match its version")
+	}
+	return key, meta, nil
+}
+
+// EncodeExtendedKey returns the base58 encoding of key, which must be for
+// params, with the version bytes of format, to export it back to the wallets
+// of SLIP-132 formats.  ExtendedKeyStandard encodes key as its String method
+// does.  Formats without versions for params fail with ErrUnknownKeyVersion.
+func EncodeExtendedKey(key *hdkeychain.ExtendedKey, format ExtendedKeyFormat, params *chaincfg.Params) (string,
+	error) {
+
+	if err := CheckNetwork(params, "extended key", key); err != nil {
+		return "", err
+	}
+	for _, v := range networkExtKeyVersions(params) {
+		if v.format != format {
+			continue
+		}
+		version := v.pub
+		if key.IsPrivate() {
+			version = v.priv
+		}
+		payload := base58.Decode(key.String())[:serializedExtKeyLen]
+		copy(payload, version[:])
+		return encodeExtKeyPayload(payload), nil
+	}
+	return "", fmt.Errorf("%w: no %s keys on %s", ErrUnknownKeyVersion, format, params.Name)
+}
+
+// encodeExtKeyVersion returns the base58 encoding of the serialized extended
+// key payload with the standard version of params.
+func encodeExtKeyVersion(payload []byte, params *chaincfg.Params, private bool) string {
+	version := params.HDPublicKeyID
+	if private {
+		version = params.HDPrivateKeyID
+	}
+	standard := append(append([]byte(nil), version[:]...), payload[4:]...)
+	return encodeExtKeyPayload(standard)
+}
+
+// encodeExtKeyPayload returns the base58 encoding of the serialized extended
+// key payload followed by its checksum.
+func encodeExtKeyPayload(payload []byte) string {
+	return base58.Encode(append(payload, chainhash.DoubleHashB(payload)[:4]...))
+}
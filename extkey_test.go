@@ -0,0 +1,177 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// BIP84 test vectors of the account m/84'/0'/0' of the mnemonic "abandon ...
+// about".
+const (
+	bip84AccountZpub = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	bip84AccountZprv = "zprvAdG4iTXWBoARxkkzNpNh8r6Qag3irQB8PzEMkAFeTRXxHpbF9z4QgEvBRmfvqWvGp42t42nvgGpNgYSJA9iefm1yYNZKEm7z6qUWCroSQnE"
+)
+
+func bip84Account(t *testing.T) *hdkeychain.ExtendedKey {
+	t.Helper()
+	master, err := MasterKeyFromMnemonic(
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := ParseDerivationPath("m/84'/0'/0'")
+	account, err := path.Derive(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account
+}
+
+func TestDecodeExtendedKey(t *testing.T) {
+	account := bip84Account(t)
+	xpub, _ := account.Neuter()
+	tests := []struct {
+		s    string
+		want string
+		meta KeyMeta
+	}{
+		{account.String(), account.String(), KeyMeta{Version: chaincfg.MainNetParams.HDPrivateKeyID, Private: true}},
+		{xpub.String(), xpub.String(), KeyMeta{Version: chaincfg.MainNetParams.HDPublicKeyID}},
+		{bip84AccountZprv, account.String(), KeyMeta{Version: [4]byte{0x04, 0xb2, 0x43, 0x0c},
+			Format: ExtendedKeySegwit, Private: true, Converted: true}},
+		{bip84AccountZpub, xpub.String(), KeyMeta{Version: [4]byte{0x04, 0xb2, 0x47, 0x46},
+			Format: ExtendedKeySegwit, Converted: true}},
+	}
+	for _, test := range tests {
+		key, meta, err := DecodeExtendedKey(test.s, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Errorf("%s: %v", test.s, err)
+			continue
+		}
+		if key.String() != test.want {
+			t.Errorf("%s: key %s, want %s", test.s, key, test.want)
+		}
+		if meta != test.meta {
+			t.Errorf("%s: meta %+v, want %+v", test.s, meta, test.meta)
+		}
+		if !key.IsForNet(&chaincfg.MainNetParams) {
+			t.Errorf("%s: key not for mainnet", test.s)
+		}
+	}
+
+	if _, _, err := DecodeExtendedKey(bip84AccountZpub, &chaincfg.MainNetParams,
+		StrictExtendedKeyVersion()); !errors.Is(err, ErrSLIP132Key) {
+		t.Errorf("strict zpub: got %v, want ErrSLIP132Key", err)
+	}
+	if _, _, err := DecodeExtendedKey(xpub.String(), &chaincfg.MainNetParams,
+		StrictExtendedKeyVersion()); err != nil {
+		t.Errorf("strict xpub: %v", err)
+	}
+}
+
+func TestDecodeExtendedKeyNetworks(t *testing.T) {
+	account := bip84Account(t)
+
+	// Regtest has the versions of testnet, SLIP-132 ones included.
+	testnet, _ := hdkeychain.NewKeyFromString(account.String())
+	testnet.SetNet(&chaincfg.TestNet3Params)
+	upub, err := EncodeExtendedKey(testnet, ExtendedKeyNestedSegwit, &chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upub[:4] != "uprv" {
+		t.Errorf("testnet key %s, want uprv", upub)
+	}
+	key, meta, err := DecodeExtendedKey(upub, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.String() != testnet.String() || meta.Format != ExtendedKeyNestedSegwit || !meta.Converted {
+		t.Errorf("regtest key %s %+v, want %s", key, meta, testnet)
+	}
+
+	if _, _, err := DecodeExtendedKey(upub, &chaincfg.MainNetParams); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("testnet key on mainnet: got %v, want ErrNetworkMismatch", err)
+	}
+	if _, _, err := DecodeExtendedKey(bip84AccountZpub, &chaincfg.TestNet3Params); !errors.Is(err,
+		ErrNetworkMismatch) {
+		t.Errorf("zpub on testnet: got %v, want ErrNetworkMismatch", err)
+	}
+	if _, err := EncodeExtendedKey(account, ExtendedKeySegwit, &chaincfg.SimNetParams); !errors.Is(err,
+		ErrNetworkMismatch) {
+		t.Errorf("mainnet key on simnet: got %v, want ErrNetworkMismatch", err)
+	}
+	account.SetNet(&chaincfg.SimNetParams)
+	if _, err := EncodeExtendedKey(account, ExtendedKeySegwit, &chaincfg.SimNetParams); !errors.Is(err,
+		ErrUnknownKeyVersion) {
+		t.Errorf("simnet zprv: got %v, want ErrUnknownKeyVersion", err)
+	}
+}
+
+func TestEncodeExtendedKey(t *testing.T) {
+	account := bip84Account(t)
+	xpub, _ := account.Neuter()
+	for _, test := range []struct {
+		key    *hdkeychain.ExtendedKey
+		format ExtendedKeyFormat
+		want   string
+	}{
+		{account, ExtendedKeySegwit, bip84AccountZprv},
+		{xpub, ExtendedKeySegwit, bip84AccountZpub},
+		{xpub, ExtendedKeyStandard, xpub.String()},
+	} {
+		s, err := EncodeExtendedKey(test.key, test.format, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != test.want {
+			t.Errorf("%s key %s, want %s", test.format, s, test.want)
+		}
+	}
+
+	// Every format round trips.
+	for format := ExtendedKeyStandard; format <= ExtendedKeySegwitMultisig; format++ {
+		s, err := EncodeExtendedKey(xpub, format, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, meta, err := DecodeExtendedKey(s, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.String() != xpub.String() || meta.Format != format || meta.Private {
+			t.Errorf("%s: decoded %s %+v", format, key, meta)
+		}
+	}
+}
+
+func TestDecodeExtendedKeyInvalid(t *testing.T) {
+	b := []byte(bip84AccountZpub)
+	b[len(b)-1] = 'a'
+	if _, _, err := DecodeExtendedKey(string(b), &chaincfg.MainNetParams); err != hdkeychain.ErrBadChecksum {
+		t.Errorf("corrupted key: got %v, want ErrBadChecksum", err)
+	}
+	if _, _, err := DecodeExtendedKey("xpub", &chaincfg.MainNetParams); err != hdkeychain.ErrInvalidKeyLen {
+		t.Errorf("short key: got %v, want ErrInvalidKeyLen", err)
+	}
+	payload := make([]byte, serializedExtKeyLen)
+	copy(payload, []byte{0x01, 0x02, 0x03, 0x04})
+	if _, _, err := DecodeExtendedKey(encodeExtKeyPayload(payload), &chaincfg.MainNetParams); !errors.Is(err,
+		ErrUnknownKeyVersion) {
+		t.Errorf("unknown version: got %v, want ErrUnknownKeyVersion", err)
+	}
+
+	// A public version with private key data.
+	account := bip84Account(t)
+	zprv, _ := EncodeExtendedKey(account, ExtendedKeySegwit, &chaincfg.MainNetParams)
+	payload = base58.Decode(zprv)[:serializedExtKeyLen]
+	copy(payload, []byte{0x04, 0xb2, 0x47, 0x46})
+	if _, _, err := DecodeExtendedKey(encodeExtKeyPayload(payload), &chaincfg.MainNetParams); err == nil {
+		t.Error("private key data with a public version accepted")
+	}
+}
@@ -0,0 +1,196 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+var (
+	// ErrAbsurdFee describes an error where the fee of a transaction
+	// exceeds the limits set by the caller.
+	ErrAbsurdFee = errors.New("absurdly high fee")
+
+	// ErrNegativeFee describes an error where the outputs of a transaction
+	// spend more than its inputs.
+	ErrNegativeFee = errors.New("outputs exceed inputs")
+)
+
+// FeeRate is a fee rate in satoshis per 1000 bytes.
+type FeeRate btcutil.Amount
+
+// MinRelayFeeRate is the lowest fee rate of the transactions nodes relay.
+const MinRelayFeeRate FeeRate = 1000
+
+// Fee returns the fee of a transaction of size bytes at rate r.
+func (r FeeRate) Fee(size int) btcutil.Amount {
+	return btcutil.Amount(int64(r) * int64(size) / 1000)
+}
+
+// TxFeeRate returns the rate of a fee paid by a transaction of size bytes.
+func TxFeeRate(fee btcutil.Amount, size int) FeeRate {
+	if size <= 0 {
+		return 0
+	}
+	return FeeRate(int64(fee) * 1000 / int64(size))
+}
+
+// TxFee returns the fee of tx, the difference between the values of the
+// outputs it spends, held by prevOuts, and its outputs.
+func TxFee(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut) (btcutil.Amount, error) {
+	in, out, err := txValues(tx, prevOuts)
+	if err != nil {
+		return 0, err
+	}
+	return in - out, nil
+}
+
+// FeeInfo describes the values and fee of a transaction, as returned by
+// TxFeeInfo.
+type FeeInfo struct {
+	// In is the value of the outputs spent by the transaction and Out the
+	// value of its outputs, in satoshis: tokens are not counted.
+	In  btcutil.Amount
+	Out btcutil.Amount
+
+	// Fee is In less Out, and Rate its rate for the Size bytes of the
+	// serialized transaction.
+	Fee  btcutil.Amount
+	Size int
+	Rate FeeRate
+
+	// TokenOutputs is the number of outputs carrying CashTokens.
+	TokenOutputs int
+}
+
+// TxFeeInfo returns the values, fee and fee rate of tx, spending the outputs
+// held by prevOuts.  Missing previous outputs fail, like values out of range,
+// and outputs worth more than the inputs fail with ErrNegativeFee.  The rate
+// uses the serialized size of tx as is, as VerifyFee does.
+func TxFeeInfo(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut) (*FeeInfo, error) {
+	in, out, err := txValues(tx, prevOuts)
+	if err != nil {
+		return nil, err
+	}
+	if out > in {
+		return nil, fmt.Errorf("%w by %v", ErrNegativeFee, out-in)
+	}
+	info := &FeeInfo{In: in, Out: out, Fee: in - out, Size: tx.SerializeSize()}
+	info.Rate = TxFeeRate(info.Fee, info.Size)
+	for _, txOut := range tx.TxOut {
+		if len(txOut.PkScript) != 0 && txOut.PkScript[0] == tokenPrefix {
+			info.TokenOutputs++
+		}
+	}
+	return info, nil
+}
+
+// VerifyFee returns an error wrapping ErrAbsurdFee if the fee of tx exceeds
+// maxAbsoluteFee or its rate exceeds maxFeeRate, and ErrNegativeFee if its
+// outputs spend more than its inputs.  A zero limit is not checked.
+//
+// The rate uses the serialized size of tx as is.  Before signing, scriptSigs
+// are missing and the rate is higher than the one of the signed transaction.
+func VerifyFee(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut, maxFeeRate FeeRate,
+	maxAbsoluteFee btcutil.Amount) error {
+
+	info, err := TxFeeInfo(tx, prevOuts)
+	if err != nil {
+		return err
+	}
+	if maxAbsoluteFee != 0 && info.Fee > maxAbsoluteFee {
+		return fmt.Errorf("%w: fee %v exceeds %v", ErrAbsurdFee, info.Fee, maxAbsoluteFee)
+	}
+	if maxFeeRate != 0 && info.Fee > maxFeeRate.Fee(info.Size) {
+		return fmt.Errorf("%w: fee %v for %d bytes exceeds %d sat/kB", ErrAbsurdFee, info.Fee, info.Size,
+			int64(maxFeeRate))
+	}
+	return nil
+}
+
+// MinRelayFee returns the smallest fee of a transaction of txSize bytes that
+// nodes relaying transactions of at least relayFeePerKB accept in their
+// mempool, rounded like Bitcoin Cash Node: down to the satoshi, but at least
+// one satoshi for a positive rate.  Nodes no longer relay free transactions
+// by priority, so that the size is the serialized size, not the modified size
+// that discounted the inputs of old coins.
+func MinRelayFee(txSize int, relayFeePerKB FeeRate) btcutil.Amount {
+	fee := relayFeePerKB.Fee(txSize)
+	if fee == 0 && txSize > 0 && relayFeePerKB > 0 {
+		fee = 1
+	}
+	return fee
+}
+
+// InsufficientFeeError describes a transaction paying less than the minimum
+// relay fee.
+type InsufficientFeeError struct {
+	Size   int
+	Fee    btcutil.Amount
+	MinFee btcutil.Amount
+}
+
+// Error returns the fee, the minimum and the fee missing.
+func (e *InsufficientFeeError) Error() string {
+	return fmt.Sprintf("%v: fee %v for %d bytes, want %v, %d satoshis more", ErrFeeTooLow, e.Fee, e.Size,
+		e.MinFee, int64(e.Missing()))
+}
+
+// Unwrap returns ErrFeeTooLow.
+func (e *InsufficientFeeError) Unwrap() error {
+	return ErrFeeTooLow
+}
+
+// Missing returns the fee to add for the transaction to be relayed, assuming
+// its size does not change.
+func (e *InsufficientFeeError) Missing() btcutil.Amount {
+	return e.MinFee - e.Fee
+}
+
+// CheckMempoolAcceptFee returns an *InsufficientFeeError if tx, spending the
+// outputs of prevOuts, pays less than MinRelayFee at relayFeePerKB, as nodes
+// check before accepting it in their mempool.  The size of inputs without
+// scriptSig is estimated with EstimateSignedSize.
+func CheckMempoolAcceptFee(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut, relayFeePerKB FeeRate) error {
+	size, err := EstimateSignedSize(tx, prevOuts)
+	if err != nil {
+		return err
+	}
+	return checkMempoolAcceptFee(tx, prevOuts, size, relayFeePerKB)
+}
+
+// checkMempoolAcceptFee is CheckMempoolAcceptFee for a transaction of size
+// bytes.
+func checkMempoolAcceptFee(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut, size int, relayFeePerKB FeeRate) error {
+	fee, err := TxFee(tx, prevOuts)
+	if err != nil {
+		return err
+	}
+	if minFee := MinRelayFee(size, relayFeePerKB); fee < minFee {
+		return &InsufficientFeeError{Size: size, Fee: fee, MinFee: minFee}
+	}
+	return nil
+}
+
+// DustRelayFeeRate is the fee rate nodes use to compute the dust threshold.
+const DustRelayFeeRate FeeRate = 1000
+
+// DustThreshold returns the smallest value of an output paying to pkScript
+// that nodes relay: three times the fee of the output and of the 148 bytes
+// input spending it at DustRelayFeeRate, 546 satoshis for pay-to-pubkey-hash.
+// Unspendable outputs, such as OP_RETURN ones, have no threshold.
+func DustThreshold(pkScript []byte) btcutil.Amount {
+	if (len(pkScript) > 0 && pkScript[0] == txscript.OP_RETURN) || len(pkScript) > MaxScriptSize {
+		return 0
+	}
+	size := wire.NewTxOut(0, pkScript).SerializeSize() + 148
+	return 3 * DustRelayFeeRate.Fee(size)
+}
+
+// IsDust returns whether txOut is below the dust threshold.
+func IsDust(txOut *wire.TxOut) bool {
+	return btcutil.Amount(txOut.Value) < DustThreshold(txOut.PkScript)
+}
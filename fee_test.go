@@ -0,0 +1,146 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestVerifyFee(t *testing.T) {
+	paths := map[int]Path{
+		0: BIP44Path(0, ExternalChain, 0),
+		1: BIP44Path(0, ExternalChain, 1),
+	}
+	// 30000 satoshis in, 5000 out.
+	tx, prevOuts := pathSignTestTx(t, paths)
+	size := tx.SerializeSize()
+
+	tests := []struct {
+		value          int64
+		maxFeeRate     FeeRate
+		maxAbsoluteFee btcutil.Amount
+		err            error
+	}{
+		{29500, 0, 500, nil},
+		{29499, 0, 500, ErrAbsurdFee},
+		{29500, FeeRate(500 * 1000 / size), 0, ErrAbsurdFee},
+		{29500, FeeRate(500*1000/size + 1), 0, nil},
+		{0, 0, 0, nil},
+		{30001, 0, 0, ErrNegativeFee},
+	}
+	for i, test := range tests {
+		tx.TxOut[0].Value = test.value
+		err := VerifyFee(tx, prevOuts, test.maxFeeRate, test.maxAbsoluteFee)
+		if !errors.Is(err, test.err) || (err != nil && test.err == nil) {
+			t.Errorf("test %d: got %v, want %v", i, err, test.err)
+		}
+	}
+
+	delete(prevOuts, 1)
+	if err := VerifyFee(tx, prevOuts, 0, 0); err == nil {
+		t.Error("missing previous output accepted")
+	}
+}
+
+func TestMinRelayFee(t *testing.T) {
+	tests := []struct {
+		size int
+		rate FeeRate
+		fee  btcutil.Amount
+	}{
+		{226, 1000, 226},
+		{226, 1500, 339},
+		{1999, 1, 1},
+		{100, 1, 1},
+		{0, 1000, 0},
+		{226, 0, 0},
+	}
+	for _, test := range tests {
+		if fee := MinRelayFee(test.size, test.rate); fee != test.fee {
+			t.Errorf("%d bytes at %d sat/kB: got %v, want %v", test.size, test.rate, fee, test.fee)
+		}
+	}
+
+	paths := map[int]Path{0: BIP44Path(0, ExternalChain, 0)}
+	tx, prevOuts := pathSignTestTx(t, paths)
+	size, _ := EstimateSignedSize(tx, prevOuts)
+	fee, _ := TxFee(tx, prevOuts)
+	minFee := MinRelayFee(size, 2000)
+	tx.TxOut[0].Value += int64(fee - minFee + 10)
+	err := CheckMempoolAcceptFee(tx, prevOuts, 2000)
+	var feeErr *InsufficientFeeError
+	if !errors.As(err, &feeErr) || !errors.Is(err, ErrFeeTooLow) {
+		t.Fatalf("got %v, want an InsufficientFeeError", err)
+	}
+	if feeErr.Size != size || feeErr.MinFee != minFee || feeErr.Missing() != 10 {
+		t.Errorf("got %+v", feeErr)
+	}
+	tx.TxOut[0].Value -= int64(feeErr.Missing())
+	if err := CheckMempoolAcceptFee(tx, prevOuts, 2000); err != nil {
+		t.Errorf("bumped by the missing fee: %v", err)
+	}
+}
+
+func TestTxFeeInfo(t *testing.T) {
+	token := tokenTestUTXO(1, &TokenData{Category: chainhash.Hash{0xaa}, Amount: 10})
+	plain := tokenTestUTXO(2, nil)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&token.OutPoint, nil, nil))
+	tx.AddTxIn(wire.NewTxIn(&plain.OutPoint, nil, nil))
+	tx.AddTxOut(token.TxOut())
+	tx.AddTxOut(wire.NewTxOut(700, plain.PkScript))
+	prevOuts := map[int]*wire.TxOut{0: token.TxOut(), 1: plain.TxOut()}
+
+	info, err := TxFeeInfo(tx, prevOuts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := tx.SerializeSize()
+	want := FeeInfo{In: 2000, Out: 1700, Fee: 300, Size: size, Rate: TxFeeRate(300, size), TokenOutputs: 1}
+	if *info != want {
+		t.Errorf("got %+v, want %+v", *info, want)
+	}
+
+	tx.TxOut[1].Value = 1001
+	if _, err := TxFeeInfo(tx, prevOuts); !errors.Is(err, ErrNegativeFee) {
+		t.Errorf("got %v, want ErrNegativeFee", err)
+	}
+	delete(prevOuts, 1)
+	if _, err := TxFeeInfo(tx, prevOuts); err == nil {
+		t.Error("missing previous output accepted")
+	}
+}
+
+func TestSignWithFeeLimits(t *testing.T) {
+	paths := map[int]Path{
+		0: BIP44Path(0, ExternalChain, 0),
+		1: BIP44Path(0, ExternalChain, 1),
+	}
+	tx, prevOuts := pathSignTestTx(t, paths)
+	hashType := txscript.SigHashAll | SigHashForkID
+	limits := WithFeeLimits(FeeRate(10000), btcutil.Amount(10000))
+
+	err := SignInputsWithPaths(tx, prevOuts, hashType, nil, descTestKey(), paths, limits)
+	if !errors.Is(err, ErrAbsurdFee) {
+		t.Fatalf("got %v, want ErrAbsurdFee", err)
+	}
+	for i, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) != 0 {
+			t.Errorf("input %d was signed despite the fee", i)
+		}
+	}
+	if err := SignInputsWithPaths(tx, prevOuts, hashType, nil, descTestKey(), paths, limits,
+		WithHighFee()); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, prevOuts = pathSignTestTx(t, paths)
+	tx.AddTxOut(wire.NewTxOut(24000, prevOuts[1].PkScript))
+	if err := SignInputsWithPaths(tx, prevOuts, hashType, nil, descTestKey(), paths, limits); err != nil {
+		t.Fatal(err)
+	}
+}
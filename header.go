@@ -0,0 +1,148 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// BlockHeaderSize is the size of a serialized block header.
+const BlockHeaderSize = 80
+
+// maxTimeOffset is how far in the future the timestamp of a block header may
+// be.
+const maxTimeOffset = 2 * time.Hour
+
+var (
+	// ErrTimeTooNew describes an error where the timestamp of a block
+	// header is more than two hours in the future.
+	ErrTimeTooNew = errors.New("block timestamp too far in the future")
+
+	// ErrHeaderChainBroken describes an error where a block header does
+	// not reference the hash of the previous header of a chain.
+	ErrHeaderChainBroken = errors.New("block header does not follow the previous header")
+)
+
+// ParseBlockHeader parses the serialization of a block header, which must be
+// exactly 80 bytes long.
+func ParseBlockHeader(b []byte) (*wire.BlockHeader, error) {
+	if len(b) != BlockHeaderSize {
+		return nil, fmt.Errorf("block header of %d bytes, want %d", len(b), BlockHeaderSize)
+	}
+	var header wire.BlockHeader
+	if err := header.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// Header is a block header whose hash is computed once.
+type Header struct {
+	header wire.BlockHeader
+
+	hashOnce sync.Once
+	hash     chainhash.Hash
+}
+
+// NewHeader returns the Header of a copy of header.
+func NewHeader(header *wire.BlockHeader) *Header {
+	return &Header{header: *header}
+}
+
+// ParseHeader parses the 80 byte serialization of a block header like
+// ParseBlockHeader.
+func ParseHeader(b []byte) (*Header, error) {
+	header, err := ParseBlockHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	return NewHeader(header), nil
+}
+
+// ParseHeaderChain parses b, the concatenated serializations of block headers
+// in chain order, as returned by Electrum servers, and checks that every
+// header references the hash of the previous one.
+func ParseHeaderChain(b []byte) ([]*Header, error) {
+	if len(b)%BlockHeaderSize != 0 {
+		return nil, fmt.Errorf("header chain of %d bytes is not a multiple of %d", len(b), BlockHeaderSize)
+	}
+	headers := make([]*Header, 0, len(b)/BlockHeaderSize)
+	for i := 0; i < len(b); i += BlockHeaderSize {
+		h, err := ParseHeader(b[i : i+BlockHeaderSize])
+		if err != nil {
+			return nil, fmt.Errorf("header %d: %v", len(headers), err)
+		}
+		if n := len(headers); n > 0 {
+			if prev := headers[n-1].BlockHash(); h.header.PrevBlock != prev {
+				return nil, fmt.Errorf("%w: header %d references %v, want %v", ErrHeaderChainBroken, n,
+					h.header.PrevBlock, prev)
+			}
+		}
+		headers = append(headers, h)
+	}
+	return headers, nil
+}
+
+// BlockHeader returns a copy of the block header.
+func (h *Header) BlockHeader() *wire.BlockHeader {
+	header := h.header
+	return &header
+}
+
+// Bytes returns the 80 byte serialization of the header.
+func (h *Header) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.Grow(BlockHeaderSize)
+	h.header.Serialize(&buf)
+	return buf.Bytes()
+}
+
+// BlockHash returns the hash of the header, computed on the first call.
+func (h *Header) BlockHash() chainhash.Hash {
+	h.hashOnce.Do(func() {
+		h.hash = h.header.BlockHash()
+	})
+	return h.hash
+}
+
+// PrevBlock returns the hash of the previous block.
+func (h *Header) PrevBlock() chainhash.Hash {
+	return h.header.PrevBlock
+}
+
+// Timestamp returns the time the block was created at.
+func (h *Header) Timestamp() time.Time {
+	return h.header.Timestamp
+}
+
+// Bits returns the compact target of the block.
+func (h *Header) Bits() uint32 {
+	return h.header.Bits
+}
+
+// Target returns the target of the block, which its hash must not exceed.
+func (h *Header) Target() *big.Int {
+	return CompactToBig(h.header.Bits)
+}
+
+// ValidateBasic checks the proof of work of the header against its target and
+// powLimit, the ProofOfWorkLimit of the network, like CheckProofOfWork, and
+// returns an error wrapping ErrTimeTooNew if its timestamp is more than two
+// hours after now.  The checks needing previous headers, of the target and of
+// the median time past, are left to the caller.
+func (h *Header) ValidateBasic(now time.Time, powLimit *big.Int) error {
+	hash := h.BlockHash()
+	if err := checkProofOfWork(&hash, h.header.Bits, powLimit); err != nil {
+		return err
+	}
+	if h.header.Timestamp.After(now.Add(maxTimeOffset)) {
+		return fmt.Errorf("%w: %v, now %v", ErrTimeTooNew, h.header.Timestamp.UTC(), now.UTC())
+	}
+	return nil
+}
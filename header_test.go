@@ -0,0 +1,97 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// regtestHeaderChain returns n regtest block headers following the genesis
+// block, mined at its minimal difficulty.
+func regtestHeaderChain(n int) []*wire.BlockHeader {
+	params := &chaincfg.RegressionNetParams
+	prev := params.GenesisBlock.Header
+	headers := []*wire.BlockHeader{&prev}
+	for i := 1; i <= n; i++ {
+		header := wire.BlockHeader{Version: 1, PrevBlock: headers[i-1].BlockHash(),
+			Timestamp: prev.Timestamp.Add(time.Duration(i) * 10 * time.Minute), Bits: params.PowLimitBits}
+		for CheckProofOfWork(&header, params.PowLimit) != nil {
+			header.Nonce++
+		}
+		headers = append(headers, &header)
+	}
+	return headers
+}
+
+func TestParseBlockHeader(t *testing.T) {
+	var buf bytes.Buffer
+	genesis := chaincfg.MainNetParams.GenesisBlock.Header
+	genesis.Serialize(&buf)
+	raw := buf.Bytes()
+
+	h, err := ParseHeader(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.BlockHash() != *chaincfg.MainNetParams.GenesisHash || h.BlockHash() != genesis.BlockHash() {
+		t.Errorf("got hash %v", h.BlockHash())
+	}
+	if !bytes.Equal(h.Bytes(), raw) {
+		t.Error("header does not round trip")
+	}
+	if h.Bits() != 0x1d00ffff || h.Timestamp().Unix() != 1231006505 ||
+		h.Target().Cmp(CompactToBig(0x1d00ffff)) != 0 {
+		t.Errorf("got bits %08x, timestamp %v", h.Bits(), h.Timestamp())
+	}
+	for _, b := range [][]byte{raw[:79], append(raw, 0)} {
+		if _, err := ParseBlockHeader(b); err == nil {
+			t.Errorf("parsed header of %d bytes", len(b))
+		}
+	}
+}
+
+func TestHeaderValidateBasic(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	h := NewHeader(&params.GenesisBlock.Header)
+	now := h.Timestamp().Add(-time.Hour)
+	if err := h.ValidateBasic(now, params.PowLimit); err != nil {
+		t.Error(err)
+	}
+	if err := h.ValidateBasic(now.Add(-2*time.Hour), params.PowLimit); !errors.Is(err, ErrTimeTooNew) {
+		t.Errorf("got %v, want ErrTimeTooNew", err)
+	}
+	header := params.GenesisBlock.Header
+	header.Nonce++
+	if err := NewHeader(&header).ValidateBasic(now, params.PowLimit); !errors.Is(err, ErrHashAboveTarget) {
+		t.Errorf("got %v, want ErrHashAboveTarget", err)
+	}
+}
+
+func TestParseHeaderChain(t *testing.T) {
+	chain := regtestHeaderChain(3)
+	var buf bytes.Buffer
+	for _, header := range chain {
+		header.Serialize(&buf)
+	}
+	headers, err := ParseHeaderChain(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != len(chain) || headers[3].BlockHash() != chain[3].BlockHash() ||
+		headers[3].PrevBlock() != chain[2].BlockHash() {
+		t.Errorf("got %d headers", len(headers))
+	}
+
+	raw := buf.Bytes()
+	if _, err := ParseHeaderChain(raw[:len(raw)-1]); err == nil {
+		t.Error("truncated chain accepted")
+	}
+	swapped := append(append(append([]byte(nil), raw[:80]...), raw[160:240]...), raw[80:160]...)
+	if _, err := ParseHeaderChain(swapped); !errors.Is(err, ErrHeaderChainBroken) {
+		t.Errorf("got %v, want ErrHeaderChainBroken", err)
+	}
+}
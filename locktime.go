@@ -0,0 +1,362 @@
+package bchutil
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// medianTimeBlocks is the number of blocks whose timestamps give the median
+// time past.
+const medianTimeBlocks = 11
+
+// CalcPastMedianTime returns the median time past of the chain ending with
+// headers, in chain order: the median timestamp of its last 11 headers.  Near
+// the genesis block, chains of fewer headers use all of them, as consensus
+// does.
+func CalcPastMedianTime(headers []*wire.BlockHeader) (time.Time, error) {
+	if len(headers) == 0 {
+		return time.Time{}, errors.New("no block header")
+	}
+	if len(headers) > medianTimeBlocks {
+		headers = headers[len(headers)-medianTimeBlocks:]
+	}
+	timestamps := make([]int64, len(headers))
+	for i, header := range headers {
+		if header == nil {
+			return time.Time{}, fmt.Errorf("block header %d is nil", i)
+		}
+		timestamps[i] = header.Timestamp.Unix()
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return time.Unix(timestamps[len(timestamps)/2], 0), nil
+}
+
+// LockTimeSatisfied returns whether lockTime, a block height below 500000000
+// and a timestamp otherwise, allows a transaction in the block following the
+// chain tip of height and median time past medianTime.  A zero lock time is
+// always satisfied.
+func LockTimeSatisfied(lockTime uint32, height int32, medianTime time.Time) bool {
+	if lockTime == 0 {
+		return true
+	}
+	if lockTime < txscript.LockTimeThreshold {
+		return int64(lockTime) <= int64(height)
+	}
+	return int64(lockTime) < medianTime.Unix()
+}
+
+// NonFinalTxError describes why a transaction is not final in a block.
+type NonFinalTxError struct {
+	// LockTime is the lock time of the transaction, a block height if
+	// ByHeight and a timestamp otherwise.
+	LockTime uint32
+	ByHeight bool
+
+	// BlockHeight and BlockTime are those the lock time was compared to.
+	BlockHeight int32
+	BlockTime   time.Time
+
+	// Inputs are the indexes of the inputs whose sequence is not final,
+	// which make the lock time enforced.
+	Inputs []int
+}
+
+// Error returns the lock time, what it was compared to and the inputs
+// enforcing it.
+func (e *NonFinalTxError) Error() string {
+	inputs := make([]string, len(e.Inputs))
+	for i, index := range e.Inputs {
+		inputs[i] = strconv.Itoa(index)
+	}
+	if e.ByHeight {
+		return fmt.Sprintf("%v: lock time at height %d not below block height %d, enforced by inputs %s",
+			ErrUnsatisfiedLockTime, e.LockTime, e.BlockHeight, strings.Join(inputs, ", "))
+	}
+	return fmt.Sprintf("%v: lock time %v not before block time %v, enforced by inputs %s",
+		ErrUnsatisfiedLockTime, time.Unix(int64(e.LockTime), 0).UTC(), e.BlockTime.UTC(),
+		strings.Join(inputs, ", "))
+}
+
+// Unwrap returns ErrUnsatisfiedLockTime.
+func (e *NonFinalTxError) Unwrap() error {
+	return ErrUnsatisfiedLockTime
+}
+
+// IsFinalizedTransaction returns whether tx may be included in the block of
+// height blockHeight and time blockTime, the median time past of the previous
+// block since BIP 113: its lock time is zero, or below blockHeight if below
+// 500000000 and below blockTime otherwise, or the sequences of all its inputs
+// are final, which disables the lock time whatever its value.
+func IsFinalizedTransaction(tx *wire.MsgTx, blockHeight int32, blockTime time.Time) bool {
+	return CheckFinalizedTransaction(tx, blockHeight, blockTime) == nil
+}
+
+// CheckFinalizedTransaction is like IsFinalizedTransaction, returning a
+// *NonFinalTxError explaining why tx is not final.
+func CheckFinalizedTransaction(tx *wire.MsgTx, blockHeight int32, blockTime time.Time) error {
+	if tx.LockTime == 0 {
+		return nil
+	}
+	byHeight := tx.LockTime < txscript.LockTimeThreshold
+	if byHeight && int64(tx.LockTime) < int64(blockHeight) ||
+		!byHeight && int64(tx.LockTime) < blockTime.Unix() {
+		return nil
+	}
+	var inputs []int
+	for i, txIn := range tx.TxIn {
+		if txIn.Sequence != wire.MaxTxInSequenceNum {
+			inputs = append(inputs, i)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil
+	}
+	return &NonFinalTxError{
+		LockTime:    tx.LockTime,
+		ByHeight:    byHeight,
+		BlockHeight: blockHeight,
+		BlockTime:   blockTime,
+		Inputs:      inputs,
+	}
+}
+
+// CheckFinalTx returns an error wrapping ErrUnsatisfiedLockTime if tx cannot
+// be included in the block following the chain tip of height and median time
+// past medianTime, a *NonFinalTxError from CheckFinalizedTransaction.
+func CheckFinalTx(tx *wire.MsgTx, height int32, medianTime time.Time) error {
+	return CheckFinalizedTransaction(tx, height+1, medianTime)
+}
+
+// Relative lock times of the sequences of inputs (BIP 68) count blocks, or
+// 512 seconds, from the output spent.
+const (
+	// MaxRelativeLockBlocks is the largest relative lock time of sequences
+	// in blocks, and MaxRelativeLockSeconds in seconds.
+	MaxRelativeLockBlocks  = wire.SequenceLockTimeMask
+	MaxRelativeLockSeconds = wire.SequenceLockTimeMask << wire.SequenceLockTimeGranularity
+)
+
+// SequenceLock is the relative lock time of a transaction, the lock times of
+// its inputs combined: the last block height and median time past at which
+// the transaction can't be mined yet, -1 when not locked by heights or times.
+type SequenceLock struct {
+	MinHeight int32
+	MinTime   int64
+}
+
+// Satisfied returns whether the lock allows the transaction in the block
+// following the chain tip of height tipHeight and median time past tipMTP.
+func (l *SequenceLock) Satisfied(tipHeight int32, tipMTP time.Time) bool {
+	return int64(l.MinHeight) < int64(tipHeight)+1 && l.MinTime < tipMTP.Unix()
+}
+
+// CalcSequenceLock returns the relative lock time of tx, spending prevOuts in
+// the order of its inputs, as nodes compute it: each input whose sequence
+// does not have the disable flag set locks the transaction until the number
+// of blocks, or of 512 seconds if it has the type flag set, of its sequence
+// have passed since the output it spends was confirmed.  Time-based locks
+// count from the MedianTime of the outputs.  Unconfirmed outputs, without a
+// Height, are taken to be confirmed by the block following the chain tip of
+// height tipHeight and median time past tipMTP.  Transactions of a version
+// below 2 are not locked.
+func CalcSequenceLock(tx *wire.MsgTx, prevOuts []*UTXO, tipHeight int32, tipMTP time.Time) (*SequenceLock, error) {
+	if len(prevOuts) != len(tx.TxIn) {
+		return nil, fmt.Errorf("%d outputs spent by %d inputs", len(prevOuts), len(tx.TxIn))
+	}
+	lock := &SequenceLock{MinHeight: -1, MinTime: -1}
+	if tx.Version < 2 {
+		return lock, nil
+	}
+	for i, txIn := range tx.TxIn {
+		if txIn.Sequence&wire.SequenceLockTimeDisabled != 0 {
+			continue
+		}
+		prevOut := prevOuts[i]
+		if prevOut == nil {
+			return nil, fmt.Errorf("input %d: unknown output spent", i)
+		}
+		height, medianTime := prevOut.Height, prevOut.MedianTime
+		if height <= 0 {
+			height, medianTime = tipHeight+1, tipMTP
+		}
+		value := int64(txIn.Sequence & wire.SequenceLockTimeMask)
+		if txIn.Sequence&wire.SequenceLockTimeIsSeconds != 0 {
+			if t := medianTime.Unix() + value<<wire.SequenceLockTimeGranularity - 1; t > lock.MinTime {
+				lock.MinTime = t
+			}
+		} else if h := int64(height) + value - 1; h > int64(lock.MinHeight) {
+			lock.MinHeight = int32(h)
+		}
+	}
+	return lock, nil
+}
+
+// CheckSequenceLocks returns an error wrapping ErrUnsatisfiedLockTime if the
+// relative lock time of tx, spending prevOuts as by CalcSequenceLock, does
+// not allow it in the block following the chain tip of height tipHeight and
+// median time past tipMTP.
+func CheckSequenceLocks(tx *wire.MsgTx, prevOuts []*UTXO, tipHeight int32, tipMTP time.Time) error {
+	lock, err := CalcSequenceLock(tx, prevOuts, tipHeight, tipMTP)
+	if err != nil {
+		return err
+	}
+	switch {
+	case int64(lock.MinHeight) >= int64(tipHeight)+1:
+		return fmt.Errorf("%w: relative lock until height %d, chain tip at height %d", ErrUnsatisfiedLockTime,
+			lock.MinHeight, tipHeight)
+	case lock.MinTime >= tipMTP.Unix():
+		return fmt.Errorf("%w: relative lock until %v, median time past %v", ErrUnsatisfiedLockTime,
+			time.Unix(lock.MinTime, 0).UTC(), tipMTP.UTC())
+	}
+	return nil
+}
+
+// SequenceForRelativeLock returns the sequence of an input locked until blocks
+// blocks, or seconds seconds, have passed since the output it spends was
+// confirmed, as required to spend outputs locked by OP_CHECKSEQUENCEVERIFY.
+// Only one of blocks and seconds can be set, and seconds are rounded up to a
+// multiple of 512, so that the lock is never shorter than requested.  The
+// transaction must be of version 2 at least for the lock to be enforced.
+func SequenceForRelativeLock(blocks int, seconds int) (uint32, error) {
+	switch {
+	case blocks < 0 || seconds < 0:
+		return 0, errors.New("negative relative lock time")
+	case blocks != 0 && seconds != 0:
+		return 0, errors.New("relative lock time in both blocks and seconds")
+	case blocks > MaxRelativeLockBlocks:
+		return 0, fmt.Errorf("relative lock time of %d blocks, limit %d", blocks, MaxRelativeLockBlocks)
+	case seconds > MaxRelativeLockSeconds:
+		return 0, fmt.Errorf("relative lock time of %d seconds, limit %d", seconds, MaxRelativeLockSeconds)
+	case seconds != 0:
+		units := (seconds + 1<<wire.SequenceLockTimeGranularity - 1) >> wire.SequenceLockTimeGranularity
+		return wire.SequenceLockTimeIsSeconds | uint32(units), nil
+	}
+	return uint32(blocks), nil
+}
+
+// RelativeLockTime is a relative lock time of BIP 68, encoded as the
+// sequence of the inputs it locks and the argument of OP_CHECKSEQUENCEVERIFY.
+type RelativeLockTime uint32
+
+// NewRelativeLockTime returns the relative lock time of blocks blocks, or
+// seconds seconds, with SequenceForRelativeLock.
+func NewRelativeLockTime(blocks int, seconds int) (RelativeLockTime, error) {
+	sequence, err := SequenceForRelativeLock(blocks, seconds)
+	return RelativeLockTime(sequence), err
+}
+
+// Sequence returns the sequence of the inputs locked by l.
+func (l RelativeLockTime) Sequence() uint32 {
+	return uint32(l)
+}
+
+// SetAntiFeeSniping makes the builder set the lock time of the transaction
+// to currentHeight, the height of the chain tip, like Bitcoin Core does to
+// discourage miners from reorganizing the chain to take the fees of recent
+// blocks.  One time in ten, the lock time is moved back by up to 100 blocks so
+// that transactions delayed by privacy tools don't stand out.
+func (b *TxBuilder) SetAntiFeeSniping(currentHeight int32) {
+	b.antiFeeSniping = true
+	b.currentHeight = currentHeight
+}
+
+// SetMinLockTime makes the builder set the lock time of the transaction to at
+// least lockTime, as required to spend outputs locked by
+// OP_CHECKLOCKTIMEVERIFY.  It takes precedence over SetAntiFeeSniping, which
+// is ignored when lockTime is a timestamp.
+func (b *TxBuilder) SetMinLockTime(lockTime uint32) error {
+	if b.minLockTime != 0 && (b.minLockTime < txscript.LockTimeThreshold) !=
+		(lockTime < txscript.LockTimeThreshold) {
+		return errors.New("cannot mix block height and time lock times")
+	}
+	if lockTime > b.minLockTime {
+		b.minLockTime = lockTime
+	}
+	return nil
+}
+
+// SetChainTip makes the builder check that the transaction can be mined in the
+// block following the chain tip of height and median time past medianTime,
+// returning an error wrapping ErrUnsatisfiedLockTime for refunds of outputs
+// locked by OP_CHECKLOCKTIMEVERIFY whose lock time has not passed yet.
+func (b *TxBuilder) SetChainTip(height int32, medianTime time.Time) {
+	b.chainTip = &chainTip{height: height, medianTime: medianTime}
+}
+
+// chainTip is the chain tip set by SetChainTip.
+type chainTip struct {
+	height     int32
+	medianTime time.Time
+}
+
+// setLockTime sets the lock time of tx as requested by SetAntiFeeSniping and
+// SetMinLockTime, making the sequences of its inputs non-final for the lock
+// time to be enforced.
+func (b *TxBuilder) setLockTime(tx *wire.MsgTx) error {
+	lockTime := b.minLockTime
+	if b.antiFeeSniping && lockTime < txscript.LockTimeThreshold && b.currentHeight > 0 {
+		randInt := b.randInt
+		if randInt == nil {
+			randInt = cryptoRandInt
+		}
+		height := int64(b.currentHeight)
+		backOff, err := randInt(10)
+		if err != nil {
+			return err
+		}
+		if backOff == 0 {
+			blocks, err := randInt(100)
+			if err != nil {
+				return err
+			}
+			height -= int64(blocks)
+			if height < 0 {
+				height = 0
+			}
+		}
+		if uint32(height) > lockTime {
+			lockTime = uint32(height)
+		}
+	}
+	if lockTime != 0 {
+		tx.LockTime = lockTime
+		for _, txIn := range tx.TxIn {
+			if txIn.Sequence == wire.MaxTxInSequenceNum {
+				txIn.Sequence = wire.MaxTxInSequenceNum - 1
+			}
+		}
+		// The lock time must be enforced up to its own height or time,
+		// for OP_CHECKLOCKTIMEVERIFY to pass and not to be disabled by
+		// final sequences.
+		if IsFinalizedTransaction(tx, int32(lockTime), time.Unix(int64(lockTime), 0)) {
+			return fmt.Errorf("lock time %d is not enforced by the sequences of the inputs", lockTime)
+		}
+	}
+	if b.antiFeeSniping && lockTime < txscript.LockTimeThreshold && b.currentHeight > 0 &&
+		lockTime <= uint32(b.currentHeight) &&
+		!IsFinalizedTransaction(tx, b.currentHeight+1, time.Time{}) {
+		return fmt.Errorf("lock time %d does not allow the transaction in the next block", lockTime)
+	}
+	if b.chainTip != nil {
+		return CheckFinalTx(tx, b.chainTip.height, b.chainTip.medianTime)
+	}
+	return nil
+}
+
+// cryptoRandInt returns a uniform random integer in [0, n) from crypto/rand.
+func cryptoRandInt(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(v.Int64()), nil
+}
@@ -0,0 +1,300 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestAntiFeeSniping(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	newBuilder := func(rolls ...int) *TxBuilder {
+		b := NewTxBuilder(1000, pkScript)
+		b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 100000, PkScript: pkScript})
+		b.AddOutput(wire.NewTxOut(10000, pkScript))
+		b.randInt = func(n int) (int, error) {
+			roll := rolls[0]
+			rolls = rolls[1:]
+			return roll, nil
+		}
+		return b
+	}
+
+	tests := []struct {
+		rolls       []int
+		minLockTime uint32
+		lockTime    uint32
+	}{
+		{[]int{1}, 0, 700000},
+		{[]int{0, 42}, 0, 699958},
+		{[]int{1}, 700100, 700100},
+		{[]int{0, 99}, 699950, 699950},
+		{nil, 1600000000, 1600000000},
+	}
+	for i, test := range tests {
+		b := newBuilder(test.rolls...)
+		b.SetAntiFeeSniping(700000)
+		if test.minLockTime != 0 {
+			if err := b.SetMinLockTime(test.minLockTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		u, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Tx.LockTime != test.lockTime {
+			t.Errorf("test %d: got lock time %d, want %d", i, u.Tx.LockTime, test.lockTime)
+		}
+		for j, txIn := range u.Tx.TxIn {
+			if txIn.Sequence == wire.MaxTxInSequenceNum {
+				t.Errorf("test %d: input %d is final", i, j)
+			}
+		}
+	}
+
+	b := newBuilder()
+	if err := b.SetMinLockTime(500); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetMinLockTime(1600000000); err == nil {
+		t.Error("mixed lock time types accepted")
+	}
+	u, err := newBuilder().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Tx.LockTime != 0 || u.Tx.TxIn[0].Sequence != wire.MaxTxInSequenceNum {
+		t.Error("lock time set without option")
+	}
+}
+
+func TestCalcPastMedianTime(t *testing.T) {
+	headers := func(timestamps ...int64) []*wire.BlockHeader {
+		hs := make([]*wire.BlockHeader, len(timestamps))
+		for i, ts := range timestamps {
+			hs[i] = &wire.BlockHeader{Timestamp: time.Unix(ts, 0)}
+		}
+		return hs
+	}
+	tests := []struct {
+		timestamps []int64
+		median     int64
+	}{
+		{[]int64{100}, 100},
+		{[]int64{100, 300}, 300},
+		{[]int64{300, 100, 200}, 200},
+		{[]int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, 6},
+		// Only the last 11 headers count, in any order.
+		{[]int64{1000, 1000, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1}, 6},
+	}
+	for i, test := range tests {
+		mtp, err := CalcPastMedianTime(headers(test.timestamps...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mtp.Unix() != test.median {
+			t.Errorf("test %d: got %d, want %d", i, mtp.Unix(), test.median)
+		}
+	}
+	if _, err := CalcPastMedianTime(nil); err == nil {
+		t.Error("no header accepted")
+	}
+}
+
+func TestCheckFinalTx(t *testing.T) {
+	mtp := time.Unix(1600000000, 0)
+	tests := []struct {
+		lockTime  uint32
+		satisfied bool
+	}{
+		{0, true},
+		{699999, true},
+		{700000, true},
+		{700001, false},
+		{1599999999, true},
+		{1600000000, false},
+	}
+	for _, test := range tests {
+		if got := LockTimeSatisfied(test.lockTime, 700000, mtp); got != test.satisfied {
+			t.Errorf("lock time %d: got %v, want %v", test.lockTime, got, test.satisfied)
+		}
+		tx := engineTestTx(nil)
+		tx.LockTime = test.lockTime
+		tx.TxIn[0].Sequence = 0
+		if err := CheckFinalTx(tx, 700000, mtp); (err == nil) != test.satisfied ||
+			(err != nil && !errors.Is(err, ErrUnsatisfiedLockTime)) {
+			t.Errorf("lock time %d: got %v", test.lockTime, err)
+		}
+		// Final sequences disable the lock time.
+		tx.TxIn[0].Sequence = wire.MaxTxInSequenceNum
+		if err := CheckFinalTx(tx, 700000, mtp); err != nil {
+			t.Errorf("lock time %d, final input: %v", test.lockTime, err)
+		}
+	}
+}
+
+func TestIsFinalizedTransaction(t *testing.T) {
+	blockTime := time.Unix(1600000000, 0)
+	tests := []struct {
+		lockTime  uint32
+		sequences []uint32
+		inputs    []int
+	}{
+		{0, []uint32{0}, nil},
+		{699999, []uint32{0}, nil},
+		{700000, []uint32{0, wire.MaxTxInSequenceNum, 1}, []int{0, 2}},
+		{700001, []uint32{wire.MaxTxInSequenceNum - 1}, []int{0}},
+		// Final sequences disable any lock time.
+		{700001, []uint32{wire.MaxTxInSequenceNum, wire.MaxTxInSequenceNum}, nil},
+		{1599999999, []uint32{0}, nil},
+		{1600000000, []uint32{0}, []int{0}},
+		{1600000000, []uint32{wire.MaxTxInSequenceNum}, nil},
+	}
+	for _, test := range tests {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		for _, sequence := range test.sequences {
+			txIn := wire.NewTxIn(&wire.OutPoint{}, nil, nil)
+			txIn.Sequence = sequence
+			tx.AddTxIn(txIn)
+		}
+		tx.LockTime = test.lockTime
+		if final := IsFinalizedTransaction(tx, 700000, blockTime); final != (test.inputs == nil) {
+			t.Errorf("lock time %d, sequences %x: final %v", test.lockTime, test.sequences, final)
+		}
+		err := CheckFinalizedTransaction(tx, 700000, blockTime)
+		var nonFinal *NonFinalTxError
+		if test.inputs == nil {
+			if err != nil {
+				t.Errorf("lock time %d, sequences %x: %v", test.lockTime, test.sequences, err)
+			}
+			continue
+		}
+		if !errors.As(err, &nonFinal) || !errors.Is(err, ErrUnsatisfiedLockTime) {
+			t.Errorf("lock time %d, sequences %x: got %v", test.lockTime, test.sequences, err)
+			continue
+		}
+		if nonFinal.LockTime != test.lockTime || nonFinal.ByHeight != (test.lockTime < 500000000) ||
+			fmt.Sprint(nonFinal.Inputs) != fmt.Sprint(test.inputs) {
+			t.Errorf("lock time %d, sequences %x: got %+v", test.lockTime, test.sequences, nonFinal)
+		}
+	}
+}
+
+func TestTxBuilderChainTip(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	build := func(lockTime uint32) error {
+		b := NewTxBuilder(1000, pkScript)
+		b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 100000, PkScript: pkScript})
+		b.AddOutput(wire.NewTxOut(10000, pkScript))
+		b.SetChainTip(700000, time.Unix(1600000000, 0))
+		if err := b.SetMinLockTime(lockTime); err != nil {
+			t.Fatal(err)
+		}
+		_, err := b.Build()
+		return err
+	}
+	if err := build(700000); err != nil {
+		t.Error(err)
+	}
+	if err := build(700001); !errors.Is(err, ErrUnsatisfiedLockTime) {
+		t.Errorf("got %v, want ErrUnsatisfiedLockTime", err)
+	}
+	if err := build(1600000000); !errors.Is(err, ErrUnsatisfiedLockTime) {
+		t.Errorf("got %v, want ErrUnsatisfiedLockTime", err)
+	}
+}
+
+func TestSequenceForRelativeLock(t *testing.T) {
+	tests := []struct {
+		blocks, seconds int
+		sequence        uint32
+		ok              bool
+	}{
+		{0, 0, 0, true},
+		{144, 0, 144, true},
+		{MaxRelativeLockBlocks, 0, 0xffff, true},
+		{0, 512, wire.SequenceLockTimeIsSeconds | 1, true},
+		{0, 513, wire.SequenceLockTimeIsSeconds | 2, true},
+		{0, MaxRelativeLockSeconds, wire.SequenceLockTimeIsSeconds | 0xffff, true},
+		{MaxRelativeLockBlocks + 1, 0, 0, false},
+		{0, MaxRelativeLockSeconds + 1, 0, false},
+		{1, 512, 0, false},
+		{-1, 0, 0, false},
+	}
+	for _, test := range tests {
+		sequence, err := SequenceForRelativeLock(test.blocks, test.seconds)
+		if (err == nil) != test.ok || sequence != test.sequence {
+			t.Errorf("%d blocks, %d seconds: got %#x, %v", test.blocks, test.seconds, sequence, err)
+		}
+	}
+}
+
+func TestCalcSequenceLock(t *testing.T) {
+	tipHeight, tipMTP := int32(1000), time.Unix(1700000000, 0)
+	coinMTP := tipMTP.Add(-10 * time.Hour)
+	blocks10, _ := SequenceForRelativeLock(10, 0)
+	blocks20, _ := SequenceForRelativeLock(20, 0)
+	hour, _ := SequenceForRelativeLock(0, 3600)
+	confirmed := &UTXO{Height: 990, MedianTime: coinMTP}
+	unconfirmed := &UTXO{}
+
+	newTx := func(version int32, sequences ...uint32) *wire.MsgTx {
+		tx := wire.NewMsgTx(version)
+		for i, sequence := range sequences {
+			txIn := wire.NewTxIn(&wire.OutPoint{Index: uint32(i)}, nil, nil)
+			txIn.Sequence = sequence
+			tx.AddTxIn(txIn)
+		}
+		return tx
+	}
+	tests := []struct {
+		name     string
+		tx       *wire.MsgTx
+		prevOuts []*UTXO
+		lock     SequenceLock
+		ok       bool
+	}{
+		{"version 1", newTx(1, blocks10), []*UTXO{confirmed}, SequenceLock{-1, -1}, true},
+		{"disabled", newTx(2, wire.SequenceLockTimeDisabled|blocks20), []*UTXO{nil}, SequenceLock{-1, -1}, true},
+		{"final", newTx(2, wire.MaxTxInSequenceNum), []*UTXO{confirmed}, SequenceLock{-1, -1}, true},
+		// Confirmed at 990, the next block is 10 blocks later, but not
+		// 20.
+		{"blocks", newTx(2, blocks10, blocks20), []*UTXO{confirmed, confirmed}, SequenceLock{1009, -1}, false},
+		{"blocks passed", newTx(2, blocks10), []*UTXO{confirmed}, SequenceLock{999, -1}, true},
+		// 3600 seconds round up to 4096, 8 units of 512, from ten hours
+		// before the tip.
+		{"time", newTx(2, hour, blocks10), []*UTXO{confirmed, confirmed},
+			SequenceLock{999, coinMTP.Unix() + 4096 - 1}, true},
+		{"unconfirmed", newTx(2, hour, 1), []*UTXO{unconfirmed, unconfirmed},
+			SequenceLock{1001, tipMTP.Unix() + 4096 - 1}, false},
+	}
+	for _, test := range tests {
+		lock, err := CalcSequenceLock(test.tx, test.prevOuts, tipHeight, tipMTP)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if *lock != test.lock || lock.Satisfied(tipHeight, tipMTP) != test.ok {
+			t.Errorf("%s: got %+v, satisfied %v", test.name, *lock, lock.Satisfied(tipHeight, tipMTP))
+		}
+		err = CheckSequenceLocks(test.tx, test.prevOuts, tipHeight, tipMTP)
+		if test.ok != (err == nil) || (err != nil && !errors.Is(err, ErrUnsatisfiedLockTime)) {
+			t.Errorf("%s: CheckSequenceLocks returned %v", test.name, err)
+		}
+	}
+
+	// The lock counts from the confirmation of the output: the block of
+	// height 1010 may include the transaction waiting 20 blocks.
+	lock, _ := CalcSequenceLock(newTx(2, blocks20), []*UTXO{confirmed}, tipHeight, tipMTP)
+	if lock.Satisfied(1008, tipMTP) || !lock.Satisfied(1009, tipMTP) {
+		t.Errorf("lock %+v satisfied at the wrong height", *lock)
+	}
+	if _, err := CalcSequenceLock(newTx(2, blocks10), nil, tipHeight, tipMTP); err == nil {
+		t.Errorf("missing outputs accepted")
+	}
+}
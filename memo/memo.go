@@ -0,0 +1,350 @@
+// Package memo builds and parses the actions of the memo.cash protocol, the
+// posts, likes and follows of an on-chain social network.
+//
+// An action is an OP_RETURN output whose first push is the two byte prefix of
+// its type, 0x6d followed by the action code, and whose following pushes are
+// the fields of the action: texts, transaction hashes or address hashes.  The
+// whole script must not exceed the 223 bytes relayed by nodes, which bounds
+// the texts of each action; builders truncate longer texts to their last
+// complete UTF-8 character within the limit.
+package memo
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ActionType is the code of a memo action, its 2 byte prefix.
+type ActionType uint16
+
+// Action types.
+const (
+	ActionSetName           ActionType = 0x6d01
+	ActionPost              ActionType = 0x6d02
+	ActionReply             ActionType = 0x6d03
+	ActionLike              ActionType = 0x6d04
+	ActionSetProfileText    ActionType = 0x6d05
+	ActionFollow            ActionType = 0x6d06
+	ActionUnfollow          ActionType = 0x6d07
+	ActionSetProfilePicture ActionType = 0x6d0a
+	ActionTopicPost         ActionType = 0x6d0c
+)
+
+// Length limits of the texts, in bytes, that fill the script of their action
+// to bchutil.MaxDataCarrierSize.
+const (
+	// MaxTextSize is the limit of names, posts, profile texts and
+	// picture URLs.
+	MaxTextSize = 217
+
+	// MaxReplySize is the limit of replies.
+	MaxReplySize = 184
+
+	// MaxTopicPostSize is the limit of the topic and the message of topic
+	// posts together.
+	MaxTopicPostSize = 214
+)
+
+// memoPrefix is the first byte of the prefixes of the actions.
+const memoPrefix = 0x6d
+
+var (
+	// ErrNotMemo describes an error where an output script is not a memo
+	// action.
+	ErrNotMemo = errors.New("not a memo action")
+
+	// ErrUnknownAction describes an error where a memo action has a type
+	// this package does not know.
+	ErrUnknownAction = errors.New("unknown memo action")
+
+	// ErrTextTooLong describes an error where the text of an action exceeds
+	// the limit of its type.
+	ErrTextTooLong = errors.New("memo text too long")
+)
+
+// actionNames are the names of the action types.
+var actionNames = map[ActionType]string{
+	ActionSetName:           "set name",
+	ActionPost:              "post",
+	ActionReply:             "reply",
+	ActionLike:              "like",
+	ActionSetProfileText:    "set profile text",
+	ActionFollow:            "follow",
+	ActionUnfollow:          "unfollow",
+	ActionSetProfilePicture: "set profile picture",
+	ActionTopicPost:         "topic post",
+}
+
+// String returns the name of the action type.
+func (t ActionType) String() string {
+	if name, ok := actionNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ActionType(%#04x)", uint16(t))
+}
+
+// Action is a memo action.  The fields set depend on its type.
+type Action struct {
+	Type ActionType
+
+	// Text is the name, post, reply, profile text, picture URL or topic
+	// post message.
+	Text string
+
+	// TxHash is the hash of the transaction of the post replied to or
+	// liked, pushed in the byte order of the wire protocol.
+	TxHash chainhash.Hash
+
+	// AddressHash is the hash of the pay-to-pubkey-hash address followed
+	// or unfollowed.
+	AddressHash [20]byte
+
+	// Topic is the topic of a topic post.
+	Topic string
+}
+
+// truncate returns the longest prefix of s of at most n bytes ending with a
+// complete UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// textAction returns the action of type t with text, truncated to n bytes.
+func textAction(t ActionType, text string, n int) (*Action, error) {
+	if text == "" {
+		return nil, fmt.Errorf("empty %v text", t)
+	}
+	if !utf8.ValidString(text) {
+		return nil, fmt.Errorf("%v text is not valid UTF-8", t)
+	}
+	return &Action{Type: t, Text: truncate(text, n)}, nil
+}
+
+// SetName returns the action setting the name of the sender.
+func SetName(name string) (*Action, error) {
+	return textAction(ActionSetName, name, MaxTextSize)
+}
+
+// PostMemo returns the action posting message.
+func PostMemo(message string) (*Action, error) {
+	return textAction(ActionPost, message, MaxTextSize)
+}
+
+// Reply returns the action replying message to the post of the transaction
+// txHash.
+func Reply(txHash chainhash.Hash, message string) (*Action, error) {
+	a, err := textAction(ActionReply, message, MaxReplySize)
+	if err != nil {
+		return nil, err
+	}
+	a.TxHash = txHash
+	return a, nil
+}
+
+// Like returns the action liking the post of the transaction txHash, whose
+// outputs may tip its author.
+func Like(txHash chainhash.Hash) *Action {
+	return &Action{Type: ActionLike, TxHash: txHash}
+}
+
+// SetProfileText returns the action setting the profile text of the sender.
+func SetProfileText(text string) (*Action, error) {
+	return textAction(ActionSetProfileText, text, MaxTextSize)
+}
+
+// SetProfilePicture returns the action setting the picture of the sender to
+// the image at url.
+func SetProfilePicture(url string) (*Action, error) {
+	if len(url) > MaxTextSize {
+		return nil, fmt.Errorf("%w: URL of %d bytes, limit %d", ErrTextTooLong, len(url), MaxTextSize)
+	}
+	return textAction(ActionSetProfilePicture, url, MaxTextSize)
+}
+
+// Follow returns the action following the user of the pay-to-pubkey-hash
+// address of addressHash.
+func Follow(addressHash [20]byte) *Action {
+	return &Action{Type: ActionFollow, AddressHash: addressHash}
+}
+
+// Unfollow returns the action unfollowing the user of the pay-to-pubkey-hash
+// address of addressHash.
+func Unfollow(addressHash [20]byte) *Action {
+	return &Action{Type: ActionUnfollow, AddressHash: addressHash}
+}
+
+// PostTopic returns the action posting message in topic.  The message is
+// truncated to the bytes the topic leaves.
+func PostTopic(topic, message string) (*Action, error) {
+	if topic == "" || !utf8.ValidString(topic) {
+		return nil, fmt.Errorf("invalid topic %q", topic)
+	}
+	if len(topic) >= MaxTopicPostSize {
+		return nil, fmt.Errorf("%w: topic of %d bytes, limit %d", ErrTextTooLong, len(topic), MaxTopicPostSize-1)
+	}
+	a, err := textAction(ActionTopicPost, message, MaxTopicPostSize-len(topic))
+	if err != nil {
+		return nil, err
+	}
+	a.Topic = topic
+	return a, nil
+}
+
+// checkText returns an error if text exceeds n bytes.
+func checkText(field, text string, n int) error {
+	if len(text) > n {
+		return fmt.Errorf("%w: %s of %d bytes, limit %d", ErrTextTooLong, field, len(text), n)
+	}
+	return nil
+}
+
+// Script returns the OP_RETURN script of the action.  Texts exceeding the
+// limit of the type fail with ErrTextTooLong.
+func (a *Action) Script() ([]byte, error) {
+	// Memo texts are never pushed as small integers, even single bytes.
+	b := bchutil.NewScriptBuilder().AddOp(txscript.OP_RETURN).AddDataPush([]byte{memoPrefix, byte(a.Type)})
+	switch a.Type {
+	case ActionSetName, ActionPost, ActionSetProfileText, ActionSetProfilePicture:
+		if err := checkText("text", a.Text, MaxTextSize); err != nil {
+			return nil, err
+		}
+		b.AddDataPush([]byte(a.Text))
+	case ActionReply:
+		if err := checkText("reply", a.Text, MaxReplySize); err != nil {
+			return nil, err
+		}
+		b.AddDataPush(a.TxHash[:]).AddDataPush([]byte(a.Text))
+	case ActionLike:
+		b.AddDataPush(a.TxHash[:])
+	case ActionFollow, ActionUnfollow:
+		b.AddDataPush(a.AddressHash[:])
+	case ActionTopicPost:
+		if err := checkText("topic post", a.Topic+a.Text, MaxTopicPostSize); err != nil {
+			return nil, err
+		}
+		b.AddDataPush([]byte(a.Topic)).AddDataPush([]byte(a.Text))
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownAction, a.Type)
+	}
+	return b.Script()
+}
+
+// Output returns the zero value OP_RETURN output of the action.
+func (a *Action) Output() (*wire.TxOut, error) {
+	script, err := a.Script()
+	if err != nil {
+		return nil, err
+	}
+	return wire.NewTxOut(0, script), nil
+}
+
+// AddMemoAction adds the output of the action to the outputs paid by b.
+func AddMemoAction(b *bchutil.TxBuilder, a *Action) error {
+	txOut, err := a.Output()
+	if err != nil {
+		return err
+	}
+	b.AddOutput(txOut)
+	return nil
+}
+
+// pushes returns the data pushed by script, which must only push data.
+func pushes(script []byte) ([][]byte, error) {
+	var data [][]byte
+	for i := 0; i < len(script); {
+		op := script[i]
+		i++
+		var n int
+		switch {
+		case op == txscript.OP_0:
+		case op <= txscript.OP_DATA_75:
+			n = int(op)
+		case op == txscript.OP_PUSHDATA1 && i < len(script):
+			n = int(script[i])
+			i++
+		case op == txscript.OP_PUSHDATA2 && i+1 < len(script):
+			n = int(script[i]) | int(script[i+1])<<8
+			i += 2
+		default:
+			return nil, fmt.Errorf("opcode %#x is not a data push", op)
+		}
+		if len(script)-i < n {
+			return nil, errors.New("truncated push")
+		}
+		data = append(data, script[i:i+n])
+		i += n
+	}
+	return data, nil
+}
+
+// ParseMemo parses pkScript, the script of a memo action.  Scripts that are
+// not OP_RETURN data starting with a memo prefix fail with ErrNotMemo, and
+// actions of other types than those of this package with ErrUnknownAction.
+func ParseMemo(pkScript []byte) (*Action, error) {
+	if len(pkScript) == 0 || pkScript[0] != txscript.OP_RETURN {
+		return nil, fmt.Errorf("%w: no OP_RETURN", ErrNotMemo)
+	}
+	data, err := pushes(pkScript[1:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotMemo, err)
+	}
+	if len(data) == 0 || len(data[0]) != 2 || data[0][0] != memoPrefix {
+		return nil, fmt.Errorf("%w: no memo prefix", ErrNotMemo)
+	}
+	a := &Action{Type: ActionType(memoPrefix)<<8 | ActionType(data[0][1])}
+	fields := data[1:]
+
+	var sizes []int
+	switch a.Type {
+	case ActionSetName, ActionPost, ActionSetProfileText, ActionSetProfilePicture:
+		sizes = []int{-1}
+	case ActionReply:
+		sizes = []int{chainhash.HashSize, -1}
+	case ActionLike:
+		sizes = []int{chainhash.HashSize}
+	case ActionFollow, ActionUnfollow:
+		sizes = []int{20}
+	case ActionTopicPost:
+		sizes = []int{-1, -1}
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownAction, a.Type)
+	}
+	if len(fields) != len(sizes) {
+		return nil, fmt.Errorf("%w: %v with %d fields", ErrNotMemo, a.Type, len(fields))
+	}
+	for i, size := range sizes {
+		switch {
+		case size < 0 && !utf8.Valid(fields[i]):
+			return nil, fmt.Errorf("%w: %v text is not valid UTF-8", ErrNotMemo, a.Type)
+		case size >= 0 && len(fields[i]) != size:
+			return nil, fmt.Errorf("%w: %v field of %d bytes", ErrNotMemo, a.Type, len(fields[i]))
+		}
+	}
+
+	switch a.Type {
+	case ActionReply:
+		copy(a.TxHash[:], fields[0])
+		a.Text = string(fields[1])
+	case ActionLike:
+		copy(a.TxHash[:], fields[0])
+	case ActionFollow, ActionUnfollow:
+		copy(a.AddressHash[:], fields[0])
+	case ActionTopicPost:
+		a.Topic, a.Text = string(fields[0]), string(fields[1])
+	default:
+		a.Text = string(fields[0])
+	}
+	return a, nil
+}
@@ -0,0 +1,149 @@
+package memo
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestActions(t *testing.T) {
+	txHash := chainhash.Hash{0xaa, 0xbb}
+	var addressHash [20]byte
+	addressHash[0] = 0xcc
+	must := must(t)
+	tests := []struct {
+		action *Action
+		script string
+	}{
+		{must(SetName("alice")), "6a026d0105616c696365"},
+		{must(PostMemo("hi")), "6a026d02026869"},
+		{must(Reply(txHash, "ok")), "6a026d0320aabb" + strings.Repeat("00", 30) + "026f6b"},
+		{Like(txHash), "6a026d0420aabb" + strings.Repeat("00", 30)},
+		{must(SetProfileText("x")), "6a026d050178"},
+		{Follow(addressHash), "6a026d0614cc" + strings.Repeat("00", 19)},
+		{Unfollow(addressHash), "6a026d0714cc" + strings.Repeat("00", 19)},
+		{must(SetProfilePicture("https://i.imgur.com/a.png")), "6a026d0a"},
+		{must(PostTopic("bch", "gm")), "6a026d0c0362636802676d"},
+	}
+	for _, test := range tests {
+		script, err := test.action.Script()
+		if err != nil {
+			t.Errorf("%v: %v", test.action.Type, err)
+			continue
+		}
+		if got := hex.EncodeToString(script); !strings.HasPrefix(got, test.script) {
+			t.Errorf("%v: got %s, want %s", test.action.Type, got, test.script)
+		}
+		parsed, err := ParseMemo(script)
+		if err != nil || !reflect.DeepEqual(parsed, test.action) {
+			t.Errorf("%v: parsed %+v, %v", test.action.Type, parsed, err)
+		}
+	}
+}
+
+func TestActionLimits(t *testing.T) {
+	// Texts are truncated to fill the script to the data carrier limit, at
+	// a character boundary.
+	post := must(t)(PostMemo(strings.Repeat("a", 216) + "éé"))
+	if post.Text != strings.Repeat("a", 216) {
+		t.Errorf("truncated to %q", post.Text)
+	}
+	full := must(t)(PostMemo(strings.Repeat("a", 300)))
+	reply := must(t)(Reply(chainhash.Hash{}, strings.Repeat("b", 300)))
+	topic := must(t)(PostTopic(strings.Repeat("t", 100), strings.Repeat("c", 300)))
+	for _, a := range []*Action{full, reply, topic} {
+		script, err := a.Script()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(script) > bchutil.MaxDataCarrierSize || len(script) < bchutil.MaxDataCarrierSize-1 {
+			t.Errorf("%v: script of %d bytes", a.Type, len(script))
+		}
+	}
+	if len(reply.Text) != MaxReplySize || len(topic.Text) != MaxTopicPostSize-100 {
+		t.Errorf("reply of %d bytes, topic post of %d", len(reply.Text), len(topic.Text))
+	}
+
+	long := &Action{Type: ActionPost, Text: strings.Repeat("a", MaxTextSize+1)}
+	if _, err := long.Script(); !errors.Is(err, ErrTextTooLong) {
+		t.Errorf("got %v, want ErrTextTooLong", err)
+	}
+	if _, err := SetProfilePicture("https://" + strings.Repeat("a", MaxTextSize)); !errors.Is(err, ErrTextTooLong) {
+		t.Errorf("got %v, want ErrTextTooLong", err)
+	}
+	for _, text := range []string{"", "\xff"} {
+		if _, err := PostMemo(text); err == nil {
+			t.Errorf("posted %q", text)
+		}
+	}
+	if _, err := (&Action{Type: 0x6d99}).Script(); !errors.Is(err, ErrUnknownAction) {
+		t.Errorf("got %v, want ErrUnknownAction", err)
+	}
+}
+
+func must(t *testing.T) func(*Action, error) *Action {
+	return func(a *Action, err error) *Action {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+}
+
+func TestParseMemo(t *testing.T) {
+	for _, test := range []struct {
+		script string
+		err    error
+	}{
+		{"", ErrNotMemo},
+		{"76a914", ErrNotMemo},
+		{"6a", ErrNotMemo},
+		{"6a04534c5000", ErrNotMemo},
+		{"6a026d0251", ErrNotMemo},
+		{"6a026d0201ff", ErrNotMemo},
+		{"6a026d020161026162", ErrNotMemo},
+		{"6a026d0410aabb", ErrNotMemo},
+		{"6a026d0205616c69", ErrNotMemo},
+		{"6a026d9903616263", ErrUnknownAction},
+	} {
+		script, _ := hex.DecodeString(test.script)
+		if _, err := ParseMemo(script); !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.script, err, test.err)
+		}
+	}
+
+	// Single byte texts are pushed by their length.
+	script, _ := must(t)(PostMemo("\x05")).Script()
+	if a, err := ParseMemo(script); err != nil || a.Text != "\x05" {
+		t.Errorf("got %+v, %v", a, err)
+	}
+}
+
+func TestAddMemoAction(t *testing.T) {
+	pkScript, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+		AddData(make([]byte, 20)).AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).Script()
+	b := bchutil.NewTxBuilder(1000, pkScript)
+	b.AddUTXOs(bchutil.UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 10000, PkScript: pkScript})
+	if err := AddMemoAction(b, must(t)(PostMemo("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, err := ParseMemo(unsigned.Tx.TxOut[0].PkScript); err != nil || a.Text != "hello" ||
+		unsigned.Tx.TxOut[0].Value != 0 {
+		t.Errorf("got %+v, %v", a, err)
+	}
+	if err := AddMemoAction(b, &Action{Type: ActionPost, Text: strings.Repeat("a", 300)}); err == nil {
+		t.Error("too long post added")
+	}
+}
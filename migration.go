@@ -0,0 +1,497 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// maxMigrationDecimals is the largest number of decimals of the
+	// CashTokens of a migration, whose base units must fit the amounts.
+	maxMigrationDecimals = 18
+
+	// migrationFundingInputs is the number of P2PKH inputs funding a
+	// distribution transaction that its size budget leaves room for, with
+	// a P2PKH change output.
+	migrationFundingInputs = 4
+)
+
+// ErrMigrationMismatch describes an error where the transactions of an SLP
+// migration do not create or distribute the CashTokens of its plan.
+var ErrMigrationMismatch = errors.New("migration does not match its plan")
+
+// migrationOptions are the options of PlanMigration.
+type migrationOptions struct {
+	decimals  int
+	maxTxSize int
+}
+
+// MigrationOption is an option of PlanMigration.
+type MigrationOption func(*migrationOptions)
+
+// MigrationDecimals sets the decimals of the CashTokens, those of the SLP
+// token by default, which the metadata of the category should tell wallets.
+// The SLP amounts are multiplied by 10 to the power of the added decimals, or
+// divided for fewer decimals, the holders then receiving their share of the
+// supply rounded down and the units left going to the largest remainders.
+func MigrationDecimals(decimals byte) MigrationOption {
+	return func(o *migrationOptions) {
+		o.decimals = int(decimals)
+	}
+}
+
+// MigrationMaxTxSize sets the largest size of the transactions of the
+// migration, MaxStandardTxSize by default.
+func MigrationMaxTxSize(size int) MigrationOption {
+	return func(o *migrationOptions) {
+		o.maxTxSize = size
+	}
+}
+
+// MigrationRecipient is a holder of the SLP token receiving CashTokens.
+type MigrationRecipient struct {
+	Address  btcutil.Address
+	PkScript []byte
+
+	// SLPAmount is the balance of the holder in base units of the SLP
+	// token, and Amount the CashTokens it receives.
+	SLPAmount uint64
+	Amount    uint64
+}
+
+// MigrationBatch is the recipients of a distribution transaction.
+type MigrationBatch struct {
+	Recipients []MigrationRecipient
+
+	// Amount is the CashTokens sent to the recipients, and Value the
+	// satoshis of their outputs, each paying the dust threshold of its
+	// token output.
+	Amount uint64
+	Value  btcutil.Amount
+}
+
+// MigrationPlan is the migration of the holders of an SLP token to a
+// CashTokens category: a genesis transaction creating the supply in one
+// fungible output for each distribution transaction, which sends them to
+// the recipients of its batch.
+type MigrationPlan struct {
+	// SLPTokenID, Ticker and Name are those of the SLP token.
+	SLPTokenID chainhash.Hash
+	Ticker     []byte
+	Name       []byte
+
+	// SLPDecimals and Decimals are the decimals of the SLP token and of
+	// the CashTokens.
+	SLPDecimals byte
+	Decimals    byte
+
+	// SLPSupply is the sum of the balances of the snapshot, and Supply the
+	// CashTokens they map to, created by the genesis transaction.
+	SLPSupply uint64
+	Supply    uint64
+
+	// Minting is set when the SLP token has a mint baton: the genesis
+	// transaction also creates a minting NFT of the category.
+	Minting bool
+
+	Batches []MigrationBatch
+
+	// Dropped are the holders whose balance maps to no CashTokens, with
+	// fewer decimals.
+	Dropped []MigrationRecipient
+
+	// Category is the category of the CashTokens, set by BuildGenesis.
+	Category chainhash.Hash
+
+	maxTxSize int
+}
+
+// PlanMigration returns the plan of the migration of the holders of the SLP
+// fungible token of slpGenesis, the message of its GENESIS transaction whose
+// TokenID is set by the caller, to CashTokens.  The balances are the
+// snapshot of the holders, by CashAddr or legacy address of params as
+// ValidateAddresses reads them, in base units of the SLP token; addresses of
+// the same script are merged.  The recipients are split
+// into batches whose distribution transactions, with their funding inputs,
+// stay within the size limit.
+func PlanMigration(slpGenesis *SLPMessage, balances map[string]TokenAmount, params *chaincfg.Params,
+	opts ...MigrationOption) (*MigrationPlan, error) {
+
+	if slpGenesis.TxType != SLPGenesis || slpGenesis.TokenType != SLPFungible {
+		return nil, fmt.Errorf("%w: %s of token type %#x, want a fungible GENESIS", ErrInvalidSLP,
+			slpGenesis.TxType, slpGenesis.TokenType)
+	}
+	o := migrationOptions{decimals: int(slpGenesis.Decimals), maxTxSize: MaxStandardTxSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.decimals > maxMigrationDecimals {
+		return nil, fmt.Errorf("%d CashTokens decimals, limit %d", o.decimals, maxMigrationDecimals)
+	}
+	p := &MigrationPlan{
+		SLPTokenID:  slpGenesis.TokenID,
+		Ticker:      slpGenesis.Ticker,
+		Name:        slpGenesis.Name,
+		SLPDecimals: slpGenesis.Decimals,
+		Decimals:    byte(o.decimals),
+		Minting:     slpGenesis.MintBatonVout != 0,
+		maxTxSize:   o.maxTxSize,
+	}
+
+	recipients, err := migrationRecipients(slpGenesis.Decimals, balances, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("no SLP holder")
+	}
+	for _, r := range recipients {
+		if p.SLPSupply+r.SLPAmount < p.SLPSupply {
+			return nil, fmt.Errorf("%w: SLP supply above %d", ErrTokenAmountOverflow, uint64(math.MaxUint64))
+		}
+		p.SLPSupply += r.SLPAmount
+	}
+	if p.Supply, err = p.mapSupply(); err != nil {
+		return nil, err
+	}
+	p.allocate(recipients)
+
+	var kept []MigrationRecipient
+	for _, r := range recipients {
+		if r.Amount == 0 {
+			p.Dropped = append(p.Dropped, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	if err := p.batch(kept); err != nil {
+		return nil, err
+	}
+	if err := p.verifyPlan(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// migrationRecipients returns the recipients of balances, sorted by address,
+// merging the addresses of the same script.
+func migrationRecipients(decimals byte, balances map[string]TokenAmount,
+	params *chaincfg.Params) ([]MigrationRecipient, error) {
+
+	addrs := make([]string, 0, len(balances))
+	for addr := range balances {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	validations, err := ValidateAddresses(addrs, params)
+	if err != nil {
+		return nil, err
+	}
+	var recipients []MigrationRecipient
+	byScript := make(map[string]int)
+	for i, s := range addrs {
+		balance := balances[s]
+		if balance.Decimals != decimals {
+			return nil, fmt.Errorf("%w: balance of %s with %d decimals, token has %d", ErrInvalidTokenAmount, s,
+				balance.Decimals, decimals)
+		}
+		if balance.Units == 0 {
+			continue
+		}
+		if err := validations[i].Err; err != nil {
+			return nil, fmt.Errorf("holder %s: %w", s, err)
+		}
+		addr := validations[i].Address
+		pkScript, err := PayToAddrScript(addr)
+		if err != nil {
+			return nil, fmt.Errorf("holder %s: %w", s, err)
+		}
+		if i, ok := byScript[string(pkScript)]; ok {
+			r := &recipients[i]
+			if r.SLPAmount+balance.Units < r.SLPAmount {
+				return nil, fmt.Errorf("%w: balance of %s", ErrTokenAmountOverflow, s)
+			}
+			r.SLPAmount += balance.Units
+			continue
+		}
+		byScript[string(pkScript)] = len(recipients)
+		recipients = append(recipients, MigrationRecipient{Address: addr, PkScript: pkScript,
+			SLPAmount: balance.Units})
+	}
+	return recipients, nil
+}
+
+// scale returns the numerator and denominator mapping SLP base units to
+// CashTokens base units.
+func (p *MigrationPlan) scale() (num, den *big.Int) {
+	ten := big.NewInt(10)
+	return new(big.Int).Exp(ten, big.NewInt(int64(p.Decimals)), nil),
+		new(big.Int).Exp(ten, big.NewInt(int64(p.SLPDecimals)), nil)
+}
+
+// mapSupply returns the CashTokens of the SLP supply, rounded down, which
+// must be a valid CashTokens amount.
+func (p *MigrationPlan) mapSupply() (uint64, error) {
+	num, den := p.scale()
+	supply := new(big.Int).SetUint64(p.SLPSupply)
+	supply.Mul(supply, num).Quo(supply, den)
+	if supply.Sign() == 0 || supply.Cmp(big.NewInt(math.MaxInt64)) > 0 {
+		return 0, fmt.Errorf("%w: SLP supply of %d units maps to %v CashTokens, want 1 to %d",
+			ErrTokenAmountOverflow, p.SLPSupply, supply, int64(math.MaxInt64))
+	}
+	return supply.Uint64(), nil
+}
+
+// allocate sets the CashTokens of recipients, their balance mapped and
+// rounded down, the units of the supply left going to the largest
+// remainders, the first ones of equal remainders.
+func (p *MigrationPlan) allocate(recipients []MigrationRecipient) {
+	num, den := p.scale()
+	remainders := make([]*big.Int, len(recipients))
+	var allocated uint64
+	for i := range recipients {
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(new(big.Int).SetUint64(recipients[i].SLPAmount), num), den,
+			new(big.Int))
+		recipients[i].Amount = q.Uint64()
+		remainders[i] = r
+		allocated += recipients[i].Amount
+	}
+	order := make([]int, len(recipients))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return remainders[order[i]].Cmp(remainders[order[j]]) > 0 })
+	for _, i := range order[:p.Supply-allocated] {
+		recipients[i].Amount++
+	}
+}
+
+// distributionOverhead returns the size of a distribution transaction but
+// for its token outputs: its token input and funding inputs, all P2PKH, and
+// the change output.
+func distributionOverhead() int {
+	return 4 + 3 + (1+migrationFundingInputs)*EstimateInputSize(P2PKHScriptSigSize) + 3 + P2PKHOutputSize + 4
+}
+
+// batch splits recipients into the batches of the plan.
+func (p *MigrationPlan) batch(recipients []MigrationRecipient) error {
+	var b MigrationBatch
+	size := distributionOverhead()
+	for _, r := range recipients {
+		txOut := tokenChangeOutput(&TokenData{Amount: r.Amount}, r.PkScript)
+		n := txOut.SerializeSize()
+		if size+n > p.maxTxSize {
+			if len(b.Recipients) == 0 {
+				return fmt.Errorf("distribution to %v exceeds %d bytes", r.Address, p.maxTxSize)
+			}
+			p.Batches = append(p.Batches, b)
+			b, size = MigrationBatch{}, distributionOverhead()
+		}
+		b.Recipients = append(b.Recipients, r)
+		b.Amount += r.Amount
+		b.Value += btcutil.Amount(txOut.Value)
+		size += n
+	}
+	if len(b.Recipients) != 0 {
+		p.Batches = append(p.Batches, b)
+	}
+	return nil
+}
+
+// verifyPlan checks that the supply is that of the SLP supply and the
+// decimals, and that the batches distribute it.
+func (p *MigrationPlan) verifyPlan() error {
+	supply, err := p.mapSupply()
+	if err != nil {
+		return err
+	}
+	if supply != p.Supply {
+		return fmt.Errorf("%w: supply %d, SLP supply of %d units maps to %d", ErrMigrationMismatch, p.Supply,
+			p.SLPSupply, supply)
+	}
+	var distributed uint64
+	for i, b := range p.Batches {
+		var amount uint64
+		for _, r := range b.Recipients {
+			amount += r.Amount
+		}
+		if amount != b.Amount {
+			return fmt.Errorf("%w: batch %d sends %d, recipients receive %d", ErrMigrationMismatch, i,
+				b.Amount, amount)
+		}
+		distributed += amount
+	}
+	if distributed != p.Supply {
+		return fmt.Errorf("%w: %d distributed of a supply of %d", ErrMigrationMismatch, distributed, p.Supply)
+	}
+	return nil
+}
+
+// newMigrationBuilder returns the builder of a transaction of the plan.
+func (p *MigrationPlan) newMigrationBuilder(funding []UTXO, changeScript []byte, feeRate FeeRate) *TxBuilder {
+	b := NewTxBuilder(feeRate, changeScript)
+	b.maxTxSize = p.maxTxSize
+	b.AddUTXOs(funding...)
+	return b
+}
+
+// BuildGenesis returns the genesis transaction of the category, spending
+// genesisInput, an output 0 without tokens whose transaction hash becomes
+// the Category of the plan.  It sends issuerScript, a script of a
+// token-aware address of the issuer, the fungible tokens of each batch in
+// output i for batch i, followed by the minting NFT of the category if the
+// plan mints.  The funding outputs pay the fee and the dust of the token
+// outputs, the change going to changeScript.
+func (p *MigrationPlan) BuildGenesis(genesisInput UTXO, funding []UTXO, issuerScript, changeScript []byte,
+	feeRate FeeRate) (*UnsignedTx, error) {
+
+	if genesisInput.OutPoint.Index != 0 || genesisInput.HasTokens() {
+		return nil, fmt.Errorf("genesis input %v is not an output 0 without tokens", genesisInput.OutPoint)
+	}
+	category := genesisInput.OutPoint.Hash
+	b := p.newMigrationBuilder(funding, changeScript, feeRate)
+	b.AddTokenInputs(genesisInput)
+	for _, batch := range p.Batches {
+		b.AddOutput(tokenChangeOutput(&TokenData{Category: category, Amount: batch.Amount}, issuerScript))
+	}
+	if p.Minting {
+		b.AddOutput(tokenChangeOutput(&TokenData{Category: category, HasNFT: true, Capability: NFTMinting},
+			issuerScript))
+	}
+	u, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	p.Category = category
+	return u, nil
+}
+
+// DistributionInput returns the output of genesis, the transaction of
+// BuildGenesis, holding the tokens of batch i.
+func (p *MigrationPlan) DistributionInput(genesis *wire.MsgTx, i int) (UTXO, error) {
+	if i < 0 || i >= len(p.Batches) || i >= len(genesis.TxOut) {
+		return UTXO{}, fmt.Errorf("no batch %d", i)
+	}
+	txOut := genesis.TxOut[i]
+	token, pkScript, err := SplitTokenPrefix(txOut.PkScript)
+	if err != nil {
+		return UTXO{}, err
+	}
+	u := UTXO{OutPoint: wire.OutPoint{Hash: genesis.TxHash(), Index: uint32(i)},
+		Amount: btcutil.Amount(txOut.Value), PkScript: pkScript}
+	if token != nil {
+		u.TokenData = token.Bytes()
+	}
+	return u, nil
+}
+
+// BuildDistribution returns the distribution transaction of batch i,
+// sending the CashTokens of tokenInput, the output of DistributionInput, to
+// its recipients.  The funding outputs, P2PKH outputs of which the plan
+// leaves room for 4, pay the fee and the dust of the token outputs, the
+// change going to changeScript.
+func (p *MigrationPlan) BuildDistribution(i int, tokenInput UTXO, funding []UTXO, changeScript []byte,
+	feeRate FeeRate) (*UnsignedTx, error) {
+
+	if i < 0 || i >= len(p.Batches) {
+		return nil, fmt.Errorf("no batch %d", i)
+	}
+	batch := &p.Batches[i]
+	token, err := tokenInput.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || token.Category != p.Category || token.Amount != batch.Amount || token.HasNFT {
+		return nil, fmt.Errorf("%w: token input %v does not hold the %d tokens of batch %d",
+			ErrMigrationMismatch, tokenInput.OutPoint, batch.Amount, i)
+	}
+	b := p.newMigrationBuilder(funding, changeScript, feeRate)
+	b.AddTokenInputs(tokenInput)
+	for _, r := range batch.Recipients {
+		b.AddOutput(tokenChangeOutput(&TokenData{Category: p.Category, Amount: r.Amount}, r.PkScript))
+	}
+	return b.Build()
+}
+
+// Verify checks that genesis and distributions, the transactions of
+// BuildGenesis and of BuildDistribution for each batch in order, create the
+// supply of the plan, which must be that of the SLP supply at the decimals
+// of the plan, and send each recipient its tokens, failing with an error
+// wrapping ErrMigrationMismatch.
+func (p *MigrationPlan) Verify(genesis *wire.MsgTx, distributions []*wire.MsgTx) error {
+	if err := p.verifyPlan(); err != nil {
+		return err
+	}
+	if len(genesis.TxIn) == 0 || len(distributions) != len(p.Batches) {
+		return fmt.Errorf("%w: %d distributions of %d batches", ErrMigrationMismatch, len(distributions),
+			len(p.Batches))
+	}
+	genesisSpent := false
+	for _, txIn := range genesis.TxIn {
+		genesisSpent = genesisSpent || txIn.PreviousOutPoint == wire.OutPoint{Hash: p.Category}
+	}
+	if !genesisSpent {
+		return fmt.Errorf("%w: genesis does not spend output 0 of %v", ErrMigrationMismatch, p.Category)
+	}
+	var created uint64
+	minting := false
+	for i, txOut := range genesis.TxOut {
+		token, _, err := SplitTokenPrefix(txOut.PkScript)
+		if err != nil {
+			return fmt.Errorf("%w: genesis output %d: %v", ErrMigrationMismatch, i, err)
+		}
+		if token == nil || token.Category != p.Category {
+			continue
+		}
+		if token.HasNFT {
+			minting = minting || token.Capability == NFTMinting
+			continue
+		}
+		if i >= len(p.Batches) || token.Amount != p.Batches[i].Amount {
+			return fmt.Errorf("%w: genesis output %d creates %d tokens", ErrMigrationMismatch, i, token.Amount)
+		}
+		created += token.Amount
+	}
+	if created != p.Supply || minting != p.Minting {
+		return fmt.Errorf("%w: genesis creates %d tokens of a supply of %d, minting NFT %v", ErrMigrationMismatch,
+			created, p.Supply, minting)
+	}
+
+	genesisHash := genesis.TxHash()
+	for i, tx := range distributions {
+		spends := false
+		for _, txIn := range tx.TxIn {
+			spends = spends || txIn.PreviousOutPoint == wire.OutPoint{Hash: genesisHash, Index: uint32(i)}
+		}
+		if !spends {
+			return fmt.Errorf("%w: distribution %d does not spend genesis output %d", ErrMigrationMismatch, i, i)
+		}
+		received := make(map[string]uint64)
+		for _, txOut := range tx.TxOut {
+			token, pkScript, err := SplitTokenPrefix(txOut.PkScript)
+			if err != nil || token == nil || token.Category != p.Category {
+				continue
+			}
+			received[string(pkScript)] += token.Amount
+		}
+		for _, r := range p.Batches[i].Recipients {
+			if got := received[string(r.PkScript)]; got != r.Amount {
+				return fmt.Errorf("%w: distribution %d sends %v %d tokens, want %d", ErrMigrationMismatch, i,
+					r.Address, got, r.Amount)
+			}
+			delete(received, string(r.PkScript))
+		}
+		if len(received) != 0 {
+			return fmt.Errorf("%w: distribution %d sends tokens to other scripts", ErrMigrationMismatch, i)
+		}
+	}
+	return nil
+}
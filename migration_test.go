@@ -0,0 +1,142 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// migrationTestHolder returns the CashAddr address of the holder i.
+func migrationTestHolder(i byte) string {
+	addr, _ := NewCashAddressPubKeyHash(append(make([]byte, 19), i), &chaincfg.RegressionNetParams)
+	return addr.String()
+}
+
+func TestPlanMigration(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	genesis := &SLPMessage{TokenType: SLPFungible, TxType: SLPGenesis, TokenID: chainhash.Hash{9},
+		Ticker: []byte("TKN"), Decimals: 2, MintBatonVout: 2}
+	legacy, _ := btcutil.NewAddressPubKeyHash(append(make([]byte, 19), 1), params)
+	balances := map[string]TokenAmount{legacy.String(): {Units: 50, Decimals: 2}}
+	for i := byte(1); i <= 8; i++ {
+		balances[migrationTestHolder(i)] = TokenAmount{Units: uint64(i) * 100, Decimals: 2}
+	}
+	balances[migrationTestHolder(9)] = TokenAmount{Decimals: 2}
+
+	p, err := PlanMigration(genesis, balances, params, MigrationDecimals(4), MigrationMaxTxSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SLPSupply != 3650 || p.Supply != 365000 || p.Decimals != 4 || !p.Minting || p.SLPTokenID != genesis.TokenID {
+		t.Errorf("supply %d of %d SLP units, %d decimals", p.Supply, p.SLPSupply, p.Decimals)
+	}
+	// The legacy address of holder 1 is merged with its CashAddr address,
+	// and the holder without balance left out.
+	recipients := 0
+	for _, b := range p.Batches {
+		recipients += len(b.Recipients)
+		for _, r := range b.Recipients {
+			if r.Amount != r.SLPAmount*100 {
+				t.Errorf("%v receives %d for %d SLP units", r.Address, r.Amount, r.SLPAmount)
+			}
+		}
+	}
+	if recipients != 8 || len(p.Batches) < 2 || p.Batches[0].Recipients[0].SLPAmount != 150 {
+		t.Fatalf("%d recipients in %d batches", recipients, len(p.Batches))
+	}
+
+	issuerScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	genesisInput := UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 1e5, PkScript: issuerScript}
+	funding := func(n byte) []UTXO {
+		return []UTXO{{OutPoint: wire.OutPoint{Hash: chainhash.Hash{2, n}}, Amount: 1e6, PkScript: issuerScript}}
+	}
+	u, err := p.BuildGenesis(genesisInput, funding(0), issuerScript, issuerScript, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Category != genesisInput.OutPoint.Hash {
+		t.Errorf("category %v", p.Category)
+	}
+	var distributions []*wire.MsgTx
+	for i := range p.Batches {
+		tokenInput, err := p.DistributionInput(u.Tx, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := p.BuildDistribution(i, tokenInput, funding(byte(i+1)), issuerScript, 1000)
+		if err != nil {
+			t.Fatalf("distribution %d: %v", i, err)
+		}
+		if size := d.Tx.SerializeSize(); size > 1000 {
+			t.Errorf("distribution %d of %d bytes", i, size)
+		}
+		if err := d.ValidateTokenTransition(); err != nil {
+			t.Errorf("distribution %d: %v", i, err)
+		}
+		distributions = append(distributions, d.Tx)
+	}
+	if err := p.Verify(u.Tx, distributions); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.BuildDistribution(1, genesisInput, nil, issuerScript, 1000); !errors.Is(err,
+		ErrMigrationMismatch) {
+		t.Errorf("distribution of another input: %v", err)
+	}
+
+	tampered := distributions[0].Copy()
+	token, pkScript, _ := SplitTokenPrefix(tampered.TxOut[0].PkScript)
+	token.Amount--
+	tampered.TxOut[0].PkScript = append(token.Bytes(), pkScript...)
+	if err := p.Verify(u.Tx, append([]*wire.MsgTx{tampered}, distributions[1:]...)); !errors.Is(err,
+		ErrMigrationMismatch) {
+		t.Errorf("tampered distribution: %v, want ErrMigrationMismatch", err)
+	}
+	if err := p.Verify(u.Tx, distributions[1:]); !errors.Is(err, ErrMigrationMismatch) {
+		t.Errorf("missing distribution: %v, want ErrMigrationMismatch", err)
+	}
+}
+
+func TestPlanMigrationFewerDecimals(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	genesis := &SLPMessage{TokenType: SLPFungible, TxType: SLPGenesis, Decimals: 2}
+	balances := map[string]TokenAmount{
+		migrationTestHolder(1): {Units: 150, Decimals: 2},
+		migrationTestHolder(2): {Units: 150, Decimals: 2},
+		migrationTestHolder(3): {Units: 100, Decimals: 2},
+		migrationTestHolder(4): {Units: 40, Decimals: 2},
+	}
+	p, err := PlanMigration(genesis, balances, params, MigrationDecimals(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The 4.4 tokens map to 4, the unit left going to the first of the
+	// largest remainders.
+	if p.Supply != 4 || p.Minting || len(p.Batches) != 1 || len(p.Dropped) != 1 {
+		t.Fatalf("supply %d in %d batches, %d dropped", p.Supply, len(p.Batches), len(p.Dropped))
+	}
+	var got []uint64
+	for _, r := range p.Batches[0].Recipients {
+		got = append(got, r.Amount)
+	}
+	if len(got) != 3 || got[0] != 2 || got[1] != 1 || got[2] != 1 {
+		t.Errorf("amounts %v", got)
+	}
+
+	if _, err := PlanMigration(&SLPMessage{TokenType: SLPNFT1Group, TxType: SLPGenesis}, balances,
+		params); !errors.Is(err, ErrInvalidSLP) {
+		t.Errorf("NFT1 group: %v, want ErrInvalidSLP", err)
+	}
+	balances[migrationTestHolder(5)] = TokenAmount{Units: 1, Decimals: 3}
+	if _, err := PlanMigration(genesis, balances, params); !errors.Is(err, ErrInvalidTokenAmount) {
+		t.Errorf("balance of other decimals: %v, want ErrInvalidTokenAmount", err)
+	}
+	mainnet, _ := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.MainNetParams)
+	if _, err := PlanMigration(genesis, map[string]TokenAmount{mainnet.String(): {Units: 1, Decimals: 2}},
+		params); err == nil {
+		t.Error("holder of another network")
+	}
+}
@@ -0,0 +1,156 @@
+package bchutil
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// seedIterations is the number of PBKDF2 iterations of the BIP39 seed
+	// derivation.
+	seedIterations = 2048
+
+	// seedLen is the length in bytes of a BIP39 seed.
+	seedLen = 64
+)
+
+var (
+	// ErrInvalidEntropyLen describes an error where the entropy of a
+	// mnemonic is not a multiple of 32 bits between 128 and 256 bits.
+	ErrInvalidEntropyLen = errors.New("entropy length must be a multiple of 32 bits between 128 and 256 bits")
+
+	// ErrInvalidMnemonic describes an error where a mnemonic has a number of
+	// words that does not match any entropy length, or contains a word that
+	// is not part of the wordlist.
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+	// ErrMnemonicChecksum describes an error where the checksum of a
+	// mnemonic does not match, usually because of a mistyped word.
+	ErrMnemonicChecksum = errors.New("mnemonic checksum mismatch")
+)
+
+// bip39Index maps the words of bip39English to their index.
+var bip39Index = func() map[string]int {
+	index := make(map[string]int, len(bip39English))
+	for i, word := range bip39English {
+		index[word] = i
+	}
+	return index
+}()
+
+// checkEntropyBits returns whether bits is a valid BIP39 entropy length.
+func checkEntropyBits(bits int) error {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return ErrInvalidEntropyLen
+	}
+	return nil
+}
+
+// NewMnemonic returns a new random mnemonic of entropyBits bits of entropy,
+// which must be 128 for a 12 word mnemonic to 256 for a 24 word one.
+func NewMnemonic(entropyBits int) (string, error) {
+	if err := checkEntropyBits(entropyBits); err != nil {
+		return "", err
+	}
+	entropy := make([]byte, entropyBits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	return NewMnemonicFromEntropy(entropy)
+}
+
+// NewMnemonicFromEntropy returns the mnemonic encoding entropy.
+func NewMnemonicFromEntropy(entropy []byte) (string, error) {
+	if err := checkEntropyBits(len(entropy) * 8); err != nil {
+		return "", err
+	}
+
+	// The entropy is followed by the first len/32 bits of its hash and
+	// split in groups of 11 bits, each selecting a word.
+	checksumBits := uint(len(entropy) / 4)
+	hash := sha256.Sum256(entropy)
+	n := new(big.Int).SetBytes(entropy)
+	n.Lsh(n, checksumBits)
+	n.Or(n, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	count := (len(entropy)*8 + int(checksumBits)) / 11
+	words := make([]string, count)
+	mask := big.NewInt(2047)
+	for i := count - 1; i >= 0; i-- {
+		words[i] = bip39English[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// mnemonicEntropy returns the entropy encoded by a mnemonic after checking its
+// words and checksum.
+func mnemonicEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(norm.NFKD.String(mnemonic))
+	if len(words)%3 != 0 || checkEntropyBits(len(words)*11*32/33) != nil {
+		return nil, fmt.Errorf("%w: %d words", ErrInvalidMnemonic, len(words))
+	}
+
+	n := new(big.Int)
+	for _, word := range words {
+		i, ok := bip39Index[word]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		n.Lsh(n, 11)
+		n.Or(n, big.NewInt(int64(i)))
+	}
+
+	checksumBits := uint(len(words) / 3)
+	checksum := byte(new(big.Int).And(n, big.NewInt(1<<checksumBits-1)).Int64())
+	n.Rsh(n, checksumBits)
+
+	entropy := make([]byte, len(words)*11*32/33/8)
+	n.FillBytes(entropy)
+	hash := sha256.Sum256(entropy)
+	if hash[0]>>(8-checksumBits) != checksum {
+		return nil, ErrMnemonicChecksum
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic checks that every word of mnemonic is part of the BIP39
+// English wordlist and that its checksum matches.
+func ValidateMnemonic(mnemonic string) error {
+	_, err := mnemonicEntropy(mnemonic)
+	return err
+}
+
+// SeedFromMnemonic validates mnemonic and returns the 64 byte seed it
+// derives with passphrase.  Both are NFKD normalized first, as required by
+// BIP39, so that a passphrase typed with precomposed accented characters
+// recovers the same wallet as one typed with combining marks.
+func SeedFromMnemonic(mnemonic, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	words := strings.Join(strings.Fields(norm.NFKD.String(mnemonic)), " ")
+	salt := "mnemonic" + norm.NFKD.String(passphrase)
+	return pbkdf2.Key([]byte(words), []byte(salt), seedIterations, seedLen, sha512.New), nil
+}
+
+// MasterKeyFromMnemonic returns the BIP32 master key of the seed of
+// mnemonic and passphrase, serialized with the version bytes of params.  The
+// key is the root of BIP44Path derivation.
+func MasterKeyFromMnemonic(mnemonic, passphrase string, params *chaincfg.Params) (*hdkeychain.ExtendedKey, error) {
+	seed, err := SeedFromMnemonic(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return hdkeychain.NewMaster(seed, params)
+}
@@ -0,0 +1,111 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Multiset is an elliptic curve multiset hash (ECMH) of a multiset of byte
+// strings, the commitment of the UTXO set of nodes: each element is mapped to
+// a point of secp256k1, and the multiset to the sum of the points, so that
+// elements are added and removed in constant time, in any order.  The zero
+// Multiset is the empty multiset.
+type Multiset struct {
+	// x and y are the affine coordinates of the sum, nil or zero for the
+	// point at infinity.
+	x, y *big.Int
+}
+
+// multisetPoint returns the point of secp256k1 of an element, that of the
+// secp256k1 multiset module: the SHA-256 of the element is prefixed with a
+// little-endian counter, counting from 0, until the SHA-256 of both is the x
+// coordinate of a point, whose y coordinate is the even square root.
+func multisetPoint(element []byte) (*big.Int, *big.Int) {
+	curve := btcec.S256()
+	var buf [8 + sha256.Size]byte
+	digest := sha256.Sum256(element)
+	copy(buf[8:], digest[:])
+	for counter := uint64(0); ; counter++ {
+		binary.LittleEndian.PutUint64(buf[:8], counter)
+		trial := sha256.Sum256(buf[:])
+		x := new(big.Int).SetBytes(trial[:])
+		if x.Cmp(curve.P) >= 0 {
+			continue
+		}
+		y2 := new(big.Int).Mul(x, x)
+		y2.Mul(y2, x).Add(y2, curve.B).Mod(y2, curve.P)
+		if y := new(big.Int).ModSqrt(y2, curve.P); y != nil {
+			if y.Bit(0) == 1 {
+				y.Sub(curve.P, y)
+			}
+			return x, y
+		}
+	}
+}
+
+// add adds the point (x, y) to the sum.
+func (m *Multiset) add(x, y *big.Int) {
+	if m.x == nil {
+		m.x, m.y = new(big.Int), new(big.Int)
+	}
+	m.x, m.y = btcec.S256().Add(m.x, m.y, x, y)
+}
+
+// Add adds element to the multiset.
+func (m *Multiset) Add(element []byte) {
+	m.add(multisetPoint(element))
+}
+
+// Remove removes element from the multiset.  Removing an element that was
+// not added is not an error, and is undone by adding it.
+func (m *Multiset) Remove(element []byte) {
+	x, y := multisetPoint(element)
+	m.add(x, y.Sub(btcec.S256().P, y))
+}
+
+// AddUTXO adds the serialization of u by UTXOCommitmentSerialization.
+func (m *Multiset) AddUTXO(u *UTXO) {
+	m.Add(UTXOCommitmentSerialization(u))
+}
+
+// RemoveUTXO removes the serialization of u by UTXOCommitmentSerialization.
+func (m *Multiset) RemoveUTXO(u *UTXO) {
+	m.Remove(UTXOCommitmentSerialization(u))
+}
+
+// Hash returns the hash of the multiset: zero for the empty multiset, and the
+// SHA-256 of the 32 bytes big-endian x and y coordinates of the sum
+// otherwise.
+func (m *Multiset) Hash() [32]byte {
+	if m.x == nil || (m.x.Sign() == 0 && m.y.Sign() == 0) {
+		return [32]byte{}
+	}
+	var coords [64]byte
+	m.x.FillBytes(coords[:32])
+	m.y.FillBytes(coords[32:])
+	return sha256.Sum256(coords[:])
+}
+
+// UTXOCommitmentSerialization returns the serialization of u that nodes add
+// to the multiset of their UTXO set: the outpoint, the height of the output
+// times two plus one for coinbase outputs as a little-endian uint32, and the
+// output, whose script starts with the token prefix if any.  Height must be
+// that of the block confirming the output, as nodes only commit to confirmed
+// outputs.
+func UTXOCommitmentSerialization(u *UTXO) []byte {
+	var buf bytes.Buffer
+	buf.Write(u.OutPoint.Hash[:])
+	binary.Write(&buf, binary.LittleEndian, u.OutPoint.Index)
+	code := uint32(u.Height) * 2
+	if u.Coinbase {
+		code |= 1
+	}
+	binary.Write(&buf, binary.LittleEndian, code)
+	wire.WriteTxOut(&buf, 0, 0, u.TxOut())
+	return buf.Bytes()
+}
@@ -0,0 +1,146 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// multisetTestVectors are the test vectors of the ECMH specification, with
+// the point of each element, the hash of the multiset of the element alone,
+// and that of the multiset of the element and the previous ones.
+var multisetTestVectors = []struct {
+	element    string
+	x, y       string
+	hash       string
+	cumulative string
+}{
+	{
+		"982051fd1e4ba744bbbe680e1fee14677ba1a3c3540bf7b1cdb606e857233e0e00000000010000000100f2052a0100000043410496b538e853519c726a2c91e61ec11600ae1390813a627c66fb8be7947be63c52da7589379515d4e0a604f8141781e62294721166bf621e73a82cbf2342c858eeac",
+		"4f9a5dce69067bf28603e73a7af4c3650b16539b95bad05eee95dfc94d1efe2c",
+		"346d5b777881f2729e7f89b2de4e8e79c7f2f42d1a0b25a8f10becb66e2d0f98",
+		"f883195933a687170c34fa1adec66fe2861889279fb12c03a3fb0ca68ad87893",
+		"f883195933a687170c34fa1adec66fe2861889279fb12c03a3fb0ca68ad87893",
+	},
+	{
+		"d5fdcc541e25de1c7a5addedf24858b8bb665c9f36ef744ee42c316022c90f9b00000000020000000100f2052a010000004341047211a824f55b505228e4c3d5194c1fcfaa15a456abdf37f9b9d97a4040afc073dee6c89064984f03385237d92167c13e236446b417ab79a0fcae412ae3316b77ac",
+		"68cf91eb2388a0287c13d46011c73fb8efb6be89c0867a47feccb2d11c390d2d",
+		"f42ba72b1079d3d941881836f88b5dcd7c207a6a4839f129272c77ebb7194d42",
+		"ef85d123a15da95d8aff92623ad1e1c9fcda3baa801bd40bc567a83a6fdcf3e2",
+		"fabafd38d07370982a34547daf5b57b8a4398696d6fd2294788abda07b1faaaf",
+	},
+	{
+		"44f672226090d85db9a9f2fbfe5f0f9609b387af7be5b7fbb7a1767c831c9e9900000000030000000100f2052a0100000043410494b9d3e76c5b1629ecf97fff95d7a4bbdac87cc26099ada28066c6ff1eb9191223cd897194a08d0c2726c5747f1db49e8cf90e75dc3e3550ae9b30086f3cd5aaac",
+		"359c6f59859d1d5af8e7081905cb6bb734c010be8680c14b5a89ee315694fc2b",
+		"fb6ba531d4bd83b14c970ad1bec332a8ae9a05706cd5df7fd91a2f2cc32482fe",
+		"cfadf40fc017faff5e04ccc0a2fae0fd616e4226dd7c03b1334a7a610468edff",
+		"1cbccda23d7ce8c5a8b008008e1738e6bf9cffb1d5b86a92a4e62b5394a636e2",
+	},
+}
+
+func TestMultiset(t *testing.T) {
+	var empty Multiset
+	if empty.Hash() != ([32]byte{}) {
+		t.Fatalf("empty multiset hash %x", empty.Hash())
+	}
+
+	var all Multiset
+	for i, test := range multisetTestVectors {
+		element, _ := hex.DecodeString(test.element)
+		x, y := multisetPoint(element)
+		if hex.EncodeToString(x.Bytes()) != test.x || hex.EncodeToString(y.Bytes()) != test.y {
+			t.Errorf("vector %d: point (%x, %x)", i, x, y)
+		}
+		var m Multiset
+		m.Add(element)
+		if h := m.Hash(); hex.EncodeToString(h[:]) != test.hash {
+			t.Errorf("vector %d: hash %x, want %s", i, h, test.hash)
+		}
+		all.Add(element)
+		if h := all.Hash(); hex.EncodeToString(h[:]) != test.cumulative {
+			t.Errorf("vector %d: cumulative hash %x, want %s", i, h, test.cumulative)
+		}
+	}
+	for i := len(multisetTestVectors) - 1; i > 0; i-- {
+		element, _ := hex.DecodeString(multisetTestVectors[i].element)
+		all.Remove(element)
+		if h := all.Hash(); hex.EncodeToString(h[:]) != multisetTestVectors[i-1].cumulative {
+			t.Errorf("removing vector %d: hash %x", i, h)
+		}
+	}
+
+	elements := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("a")}
+	var forward, backward Multiset
+	for i := range elements {
+		forward.Add(elements[i])
+		backward.Add(elements[len(elements)-1-i])
+	}
+	if forward.Hash() != backward.Hash() {
+		t.Errorf("hash depends on the order of the elements")
+	}
+
+	// Elements are counted: removing one "a" leaves a multiset other than
+	// the one without "a".
+	forward.Remove([]byte("a"))
+	var once Multiset
+	for _, e := range elements[:3] {
+		once.Add(e)
+	}
+	if forward.Hash() != once.Hash() {
+		t.Errorf("removing an element does not undo adding it")
+	}
+	var withoutA Multiset
+	withoutA.Add([]byte("b"))
+	withoutA.Add([]byte("c"))
+	if forward.Hash() == withoutA.Hash() {
+		t.Errorf("elements added twice are not counted twice")
+	}
+	for _, e := range elements[:3] {
+		forward.Remove(e)
+	}
+	if forward.Hash() != ([32]byte{}) {
+		t.Errorf("hash of the emptied multiset %x", forward.Hash())
+	}
+
+	// Removing an element that is not in the multiset is undone by adding
+	// it.
+	var m Multiset
+	m.Remove([]byte("d"))
+	if m.Hash() == ([32]byte{}) {
+		t.Errorf("removing an absent element left the multiset empty")
+	}
+	m.Add([]byte("d"))
+	if m.Hash() != ([32]byte{}) {
+		t.Errorf("adding back a removed element does not empty the multiset")
+	}
+}
+
+func TestUTXOCommitmentSerialization(t *testing.T) {
+	hash, _ := chainhash.NewHashFromStr("0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098")
+	u := &UTXO{
+		OutPoint: *wire.NewOutPoint(hash, 0),
+		Amount:   5000000000,
+		PkScript: []byte{0x51},
+		Coinbase: true,
+		Height:   1,
+	}
+	want, _ := hex.DecodeString("982051fd1e4ba744bbbe680e1fee14677ba1a3c3540bf7b1cdb606e857233e0e" +
+		"00000000" + "03000000" + "00f2052a01000000" + "0151")
+	if got := UTXOCommitmentSerialization(u); !bytes.Equal(got, want) {
+		t.Fatalf("serialization %x, want %x", got, want)
+	}
+
+	var m, n Multiset
+	m.AddUTXO(u)
+	n.Add(want)
+	if m.Hash() != n.Hash() {
+		t.Errorf("AddUTXO does not add the serialization")
+	}
+	m.RemoveUTXO(u)
+	if m.Hash() != ([32]byte{}) {
+		t.Errorf("RemoveUTXO does not remove the serialization")
+	}
+}
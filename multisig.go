@@ -0,0 +1,349 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var (
+	// ErrMixedMultiSigSignatures describes an error where ECDSA and
+	// Schnorr signatures are combined in a multisig scriptSig, which
+	// neither mode of OP_CHECKMULTISIG accepts.
+	ErrMixedMultiSigSignatures = errors.New("ECDSA and Schnorr signatures mixed in multisig")
+
+	// ErrUnmatchedSignature describes an error where a signature is not
+	// valid for any key of a multisig script.
+	ErrUnmatchedSignature = errors.New("signature valid for no key of the script")
+)
+
+// multisigBitfield returns the dummy of a Schnorr multisig checking the keys
+// whose bits are set in checkBits, of a script with nKeys keys.
+func multisigBitfield(checkBits uint32, nKeys int) []byte {
+	bitfield := make([]byte, (nKeys+7)/8)
+	for i := range bitfield {
+		bitfield[i] = byte(checkBits >> (8 * uint(i)))
+	}
+	return bitfield
+}
+
+// CombineSignatures returns the scriptSig spending the pay-to-script-hash
+// multisig redeemScript with sigs, the signatures of its keys collected from
+// the cosigners.  The signatures of the first keys of the script are used, as
+// many as required, and must be all ECDSA or all Schnorr signatures:
+//
+//   - ECDSA signatures give the legacy form OP_0 <sig>... <redeemScript>
+//   - Schnorr signatures give the Schnorr form <bitfield> <sig>...
+//     <redeemScript>, whose bitfield sets the bits of the keys signing
+//
+// Signatures mixing both fail with ErrMixedMultiSigSignatures.  Signatures are
+// not checked against the transaction, which IsComplete can do.
+func CombineSignatures(redeemScript []byte, sigs []InputSignature) ([]byte, error) {
+	pubKeys, nRequired, ok := multisigPubKeys(redeemScript)
+	if !ok {
+		return nil, fmt.Errorf("%w: redeem script is not multisig", ErrNonStandardScript)
+	}
+
+	bySlot := make([][]byte, len(pubKeys))
+	schnorr, ecdsa := false, false
+	for _, sig := range sigs {
+		slot := -1
+		for i, pubKey := range pubKeys {
+			if bytes.Equal(pubKey, sig.PubKey) {
+				slot = i
+				break
+			}
+		}
+		if slot < 0 {
+			return nil, fmt.Errorf("public key %x not in the redeem script", sig.PubKey)
+		}
+		if len(sig.Signature) == SchnorrSignatureLen+1 {
+			schnorr = true
+		} else {
+			ecdsa = true
+		}
+		bySlot[slot] = sig.Signature
+	}
+	if schnorr && ecdsa {
+		return nil, ErrMixedMultiSigSignatures
+	}
+
+	if n := countSignatures(bySlot); n < nRequired {
+		return nil, fmt.Errorf("%d signatures for %d-of-%d multisig", n, nRequired, len(pubKeys))
+	}
+	builder, err := multisigScriptSigBuilder(bySlot, nRequired)
+	if err != nil {
+		return nil, err
+	}
+	return builder.AddData(redeemScript).Script()
+}
+
+// countSignatures returns the number of slots holding a signature.
+func countSignatures(bySlot [][]byte) int {
+	n := 0
+	for _, sig := range bySlot {
+		if sig != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// multisigScriptSigBuilder returns the builder of a multisig scriptSig pushing
+// the signatures of bySlot, indexed by the position of their key in the
+// script, up to nRequired of them from the first keys.  All ECDSA signatures
+// give the legacy form and all Schnorr signatures the Schnorr form, and mixed
+// signatures fail with ErrMixedMultiSigSignatures.
+func multisigScriptSigBuilder(bySlot [][]byte, nRequired int) (*txscript.ScriptBuilder, error) {
+	var checkBits uint32
+	var used [][]byte
+	schnorr, ecdsa := false, false
+	for i, sig := range bySlot {
+		if sig != nil && len(used) < nRequired {
+			used = append(used, sig)
+			checkBits |= 1 << uint(i)
+			if len(sig) == SchnorrSignatureLen+1 {
+				schnorr = true
+			} else {
+				ecdsa = true
+			}
+		}
+	}
+	if schnorr && ecdsa {
+		return nil, ErrMixedMultiSigSignatures
+	}
+
+	builder := txscript.NewScriptBuilder()
+	if schnorr {
+		builder.AddData(multisigBitfield(checkBits, len(bySlot)))
+	} else {
+		builder.AddOp(txscript.OP_0)
+	}
+	for _, sig := range used {
+		builder.AddData(sig)
+	}
+	return builder, nil
+}
+
+// OrderSignatures returns sigs, signatures of input idx of tx spending
+// prevOut with the multisig script redeemScript, bare or redeemed by
+// pay-to-script-hash, in the order of the keys of the script they are valid
+// for, as OP_CHECKMULTISIG requires.  Each signature is checked against the
+// keys not signed yet with its own sighash type, so that signatures returned
+// by cosigners in any order are placed right.  Signatures of keys signed
+// before are dropped as duplicates, and signatures valid for no key are
+// reported by an error wrapping ErrUnmatchedSignature, returned with the
+// signatures that matched.
+func OrderSignatures(redeemScript []byte, sigs [][]byte, tx *wire.MsgTx, idx int, prevOut *UTXO) ([][]byte, error) {
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("input index %d out of range", idx)
+	}
+	pubKeys, _, ok := multisigPubKeys(redeemScript)
+	if !ok {
+		return nil, fmt.Errorf("%w: script is not multisig", ErrNonStandardScript)
+	}
+	o := signOptions{sigHashes: txscript.NewTxSigHashes(tx)}
+	if prevOut.HasTokens() {
+		token, _, err := ParseTokenData(prevOut.TokenData)
+		if err != nil {
+			return nil, err
+		}
+		o.token = token
+	}
+	bySlot, unmatched := o.orderSignatures(pubKeys, sigs, tx, idx, redeemScript, int64(prevOut.Amount))
+
+	var ordered [][]byte
+	for _, sig := range bySlot {
+		if sig != nil {
+			ordered = append(ordered, sig)
+		}
+	}
+	if len(unmatched) != 0 {
+		return ordered, fmt.Errorf("%w: signatures %v", ErrUnmatchedSignature, unmatched)
+	}
+	return ordered, nil
+}
+
+// orderSignatures places sigs in the slots of the keys of pubKeys they are
+// valid for, with the digests of o, and returns the signatures by slot and the
+// indexes of sigs valid for no key.
+func (o *signOptions) orderSignatures(pubKeys [][]byte, sigs [][]byte, tx *wire.MsgTx, idx int,
+	subScript []byte, amt int64) ([][]byte, []int) {
+
+	bySlot := make([][]byte, len(pubKeys))
+	digests := make(map[txscript.SigHashType][]byte)
+	var unmatched []int
+	for i, sig := range sigs {
+		if len(sig) == 0 {
+			unmatched = append(unmatched, i)
+			continue
+		}
+		hashType := txscript.SigHashType(sig[len(sig)-1])
+		if hashType&SigHashForkID == 0 || checkSigHashType(hashType) != nil {
+			unmatched = append(unmatched, i)
+			continue
+		}
+		digest, ok := digests[hashType]
+		if !ok {
+			digest = o.sigHash(tx, idx, subScript, hashType, amt)
+			digests[hashType] = digest
+		}
+		matched := false
+		for slot, pubKey := range pubKeys {
+			if !verifySignature(sig[:len(sig)-1], pubKey, digest, true) {
+				continue
+			}
+			// A signature of a key signed already is a duplicate,
+			// unless the key is listed again.
+			matched = true
+			if bySlot[slot] == nil {
+				bySlot[slot] = sig
+				break
+			}
+		}
+		if !matched {
+			unmatched = append(unmatched, i)
+		}
+	}
+	return bySlot, unmatched
+}
+
+// MultisigSignature is a signature pushed by a multisig scriptSig.
+type MultisigSignature struct {
+	// Signature is the pushed signature, with its sighash type.
+	Signature []byte
+
+	// PubKey is the key of the script the signature is valid for, nil if
+	// it is not valid for any key it was checked against.
+	PubKey []byte
+}
+
+// MultisigStatus describes the signatures of a multisig scriptSig.
+type MultisigStatus struct {
+	RedeemScript []byte
+
+	// PubKeys are the keys of the redeem script, in script order, of which
+	// Required must sign.
+	PubKeys  [][]byte
+	Required int
+
+	// Schnorr is set for scriptSigs of the Schnorr form, whose dummy is the
+	// bitfield of the keys signing.
+	Schnorr bool
+
+	// Signatures are the signatures of the scriptSig, in order.
+	// SignedPubKeys are the keys with a valid signature, in script order,
+	// and InvalidSignatures the signatures valid for none.
+	Signatures        []MultisigSignature
+	SignedPubKeys     [][]byte
+	InvalidSignatures [][]byte
+}
+
+// Complete returns whether the valid signatures meet the threshold of the
+// script.
+func (s *MultisigStatus) Complete() bool {
+	return len(s.SignedPubKeys) >= s.Required
+}
+
+// VerifyMultisigScriptSig checks the signatures of the scriptSig of input idx
+// of tx, spending the pay-to-script-hash multisig output prevOut, which may be
+// partially signed.  Every signature is checked against the replay protected
+// digest of its own sighash type, committing to the tokens of prevOut, and
+// matched to keys as OP_CHECKMULTISIG does:
+//
+//   - in the legacy form, each signature is tried against the keys following
+//     the key of the previous valid signature, in script order
+//   - in the Schnorr form, each signature is checked against the next key
+//     whose bit is set in the bitfield
+//
+// Unlike the opcode, checking continues past invalid signatures, so every
+// valid signature is reported.  Redeem scripts that are not multisig fail
+// with an error wrapping ErrNonStandardScript.
+func VerifyMultisigScriptSig(tx *wire.MsgTx, idx int, prevOut *UTXO) (*MultisigStatus, error) {
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("input index %d out of range", idx)
+	}
+	scriptSig := tx.TxIn[idx].SignatureScript
+	redeemScript, err := checkedRedeemScript(scriptSig, prevOut.PkScript)
+	if err != nil {
+		return nil, err
+	}
+	pubKeys, required, ok := multisigPubKeys(redeemScript)
+	if !ok {
+		return nil, fmt.Errorf("%w: redeem script is not multisig", ErrNonStandardScript)
+	}
+	ops, _ := parseScript(scriptSig)
+	if len(ops) < 2 {
+		return nil, fmt.Errorf("%w: missing multisig dummy", ErrMalformedScriptSig)
+	}
+	status := &MultisigStatus{RedeemScript: redeemScript, PubKeys: pubKeys, Required: required}
+
+	dummy, _ := pushedData(ops[0].value, ops[0].data)
+	var keys []int
+	if status.Schnorr = len(dummy) != 0; status.Schnorr {
+		if len(dummy) != (len(pubKeys)+7)/8 {
+			return nil, fmt.Errorf("%w: bitfield of %d bytes for %d keys", ErrMalformedScriptSig,
+				len(dummy), len(pubKeys))
+		}
+		for i := range pubKeys {
+			if dummy[i/8]&(1<<uint(i%8)) != 0 {
+				keys = append(keys, i)
+			}
+		}
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx)
+	valid := func(sig, pubKey []byte) bool {
+		hashType := txscript.SigHashType(sig[len(sig)-1])
+		if hashType&SigHashForkID == 0 || checkSigHashType(hashType) != nil {
+			return false
+		}
+		if status.Schnorr != (len(sig) == SchnorrSignatureLen+1) {
+			return false
+		}
+		hash := calcSignatureHash(redeemScript, sigHashes, hashType, tx, idx, int64(prevOut.Amount), 0,
+			prevOut.TokenData)
+		return verifySignature(sig[:len(sig)-1], pubKey, hash, true)
+	}
+
+	signed := make([]bool, len(pubKeys))
+	next := 0
+	for _, op := range ops[1 : len(ops)-1] {
+		sig, _ := pushedData(op.value, op.data)
+		if len(sig) == 0 {
+			continue
+		}
+		s := MultisigSignature{Signature: sig}
+		if status.Schnorr {
+			if next < len(keys) {
+				if valid(sig, pubKeys[keys[next]]) {
+					s.PubKey = pubKeys[keys[next]]
+					signed[keys[next]] = true
+				}
+				next++
+			}
+		} else {
+			for i := next; i < len(pubKeys); i++ {
+				if valid(sig, pubKeys[i]) {
+					s.PubKey = pubKeys[i]
+					signed[i] = true
+					next = i + 1
+					break
+				}
+			}
+		}
+		if s.PubKey == nil {
+			status.InvalidSignatures = append(status.InvalidSignatures, sig)
+		}
+		status.Signatures = append(status.Signatures, s)
+	}
+	for i, ok := range signed {
+		if ok {
+			status.SignedPubKeys = append(status.SignedPubKeys, pubKeys[i])
+		}
+	}
+	return status, nil
+}
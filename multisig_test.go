@@ -0,0 +1,337 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestSchnorrMultiSig(t *testing.T) {
+	c, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x03})
+	keys := append(signingTestKeys(), c)
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_2)
+	for _, key := range keys {
+		builder.AddData(key.PubKey().SerializeCompressed())
+	}
+	redeemScript, _ := builder.AddOp(txscript.OP_3).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	pkScript, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+	tx := engineTestTx(nil)
+
+	sign := func(key *btcec.PrivateKey, opts ...SignOption) InputSignature {
+		sig, err := RawTxInSignature(tx, 0, redeemScript, txscript.SigHashAll, key, 5000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return InputSignature{PubKey: key.PubKey().SerializeCompressed(), Signature: sig}
+	}
+	execute := func(scriptSig []byte) error {
+		tx.TxIn[0].SignatureScript = scriptSig
+		vm, err := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, 5000)
+		if err != nil {
+			return err
+		}
+		return vm.Execute()
+	}
+
+	schnorrSigs := []InputSignature{sign(keys[2], WithSchnorr()), sign(keys[0], WithSchnorr())}
+	scriptSig, err := CombineSignatures(redeemScript, schnorrSigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keys 0 and 2 sign: the bitfield 0b101 is pushed with OP_5.
+	if scriptSig[0] != txscript.OP_5 {
+		t.Errorf("got dummy opcode %#x, want OP_5", scriptSig[0])
+	}
+	if err := execute(scriptSig); err != nil {
+		t.Fatalf("Schnorr multisig: %v", err)
+	}
+	parsed, err := ParseScriptSig(scriptSig, pkScript)
+	if err != nil || len(parsed.Signatures) != 2 || parsed.Signatures[0].Schnorr == nil {
+		t.Errorf("got %+v, %v", parsed, err)
+	}
+	tx.TxIn[0].SignatureScript = scriptSig
+	if complete, status := IsComplete(tx, nil); complete && len(status) == 0 {
+		t.Error("complete without previous outputs")
+	}
+
+	ecdsaSigs := []InputSignature{sign(keys[1]), sign(keys[2])}
+	legacy, err := CombineSignatures(redeemScript, ecdsaSigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy[0] != txscript.OP_0 {
+		t.Errorf("got dummy opcode %#x, want OP_0", legacy[0])
+	}
+	if err := execute(legacy); err != nil {
+		t.Fatalf("legacy multisig: %v", err)
+	}
+
+	if _, err := CombineSignatures(redeemScript, []InputSignature{schnorrSigs[0], ecdsaSigs[0]}); !errors.Is(err,
+		ErrMixedMultiSigSignatures) {
+		t.Errorf("got %v, want ErrMixedMultiSigSignatures", err)
+	}
+	if _, err := CombineSignatures(redeemScript, schnorrSigs[:1]); err == nil {
+		t.Error("combined too few signatures")
+	}
+	if _, err := CombineSignatures(pkScript, schnorrSigs); !errors.Is(err, ErrNonStandardScript) {
+		t.Errorf("got %v, want ErrNonStandardScript", err)
+	}
+
+	// Scripts the engine rejects.
+	raw := func(dummy []byte, sigs ...InputSignature) []byte {
+		b := txscript.NewScriptBuilder()
+		if dummy == nil {
+			b.AddOp(txscript.OP_0)
+		} else {
+			b.AddData(dummy)
+		}
+		for _, sig := range sigs {
+			b.AddData(sig.Signature)
+		}
+		script, _ := b.AddData(redeemScript).Script()
+		return script
+	}
+	for i, test := range []struct {
+		scriptSig []byte
+		err       error
+	}{
+		{raw([]byte{0x03}, schnorrSigs[1], schnorrSigs[0]), ErrNullFail},
+		{raw([]byte{0x05}, schnorrSigs[0], schnorrSigs[1]), ErrNullFail},
+		{raw([]byte{0x07}, schnorrSigs[1], schnorrSigs[0]), ErrInvalidOperand},
+		{raw([]byte{0x0d}, schnorrSigs[1], schnorrSigs[0]), ErrInvalidOperand},
+		{raw([]byte{0x05, 0x00}, schnorrSigs[1], schnorrSigs[0]), ErrInvalidOperand},
+		{raw([]byte{0x06}, ecdsaSigs...), ErrSigEncoding},
+		{raw(nil, schnorrSigs[1], schnorrSigs[0]), ErrSigEncoding},
+	} {
+		if err := execute(test.scriptSig); !errors.Is(err, test.err) {
+			t.Errorf("test %d: got %v, want %v", i, err, test.err)
+		}
+	}
+}
+
+func TestSignTxOutputSchnorrMultiSig(t *testing.T) {
+	keys := signingTestKeys()
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_1)
+	for _, key := range keys {
+		builder.AddData(key.PubKey().SerializeCompressed())
+	}
+	pkScript, _ := builder.AddOp(txscript.OP_2).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	tx := engineTestTx(nil)
+
+	kdb := txscript.KeyClosure(func(addr btcutil.Address) (*btcec.PrivateKey, bool, error) {
+		if bytes.Equal(addr.ScriptAddress(), keys[1].PubKey().SerializeCompressed()) {
+			return keys[1], true, nil
+		}
+		return nil, false, errors.New("unknown key")
+	})
+	scriptSig, err := SignTxOutput(&chaincfg.MainNetParams, tx, 0, pkScript, txscript.SigHashAll, kdb, nil, nil,
+		1000, WithSchnorr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{txscript.OP_2, txscript.OP_DATA_65}; !bytes.Equal(scriptSig[:2], want) {
+		t.Errorf("got scriptSig %x", scriptSig)
+	}
+	tx.TxIn[0].SignatureScript = scriptSig
+	vm, err := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Execute(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyMultisigScriptSig(t *testing.T) {
+	c, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x03})
+	keys := append(signingTestKeys(), c)
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_2)
+	for _, key := range keys {
+		builder.AddData(key.PubKey().SerializeCompressed())
+	}
+	redeemScript, _ := builder.AddOp(txscript.OP_3).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	pkScript, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+	prevOut := &UTXO{Amount: 5000, PkScript: pkScript}
+	tx := engineTestTx(nil)
+
+	sig := func(key *btcec.PrivateKey, opts ...SignOption) []byte {
+		sig, err := RawTxInSignature(tx, 0, redeemScript, txscript.SigHashAll, key, 5000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	pubKey := func(i int) []byte { return keys[i].PubKey().SerializeCompressed() }
+	scriptSig := func(dummy []byte, sigs ...[]byte) []byte {
+		b := txscript.NewScriptBuilder()
+		if dummy == nil {
+			b.AddOp(txscript.OP_0)
+		} else {
+			b.AddData(dummy)
+		}
+		for _, sig := range sigs {
+			b.AddData(sig)
+		}
+		script, _ := b.AddData(redeemScript).Script()
+		return script
+	}
+	wrongAmount, _ := RawTxInSignature(tx, 0, redeemScript, txscript.SigHashAll, keys[1], 4000)
+
+	tests := []struct {
+		name      string
+		scriptSig []byte
+		schnorr   bool
+		signed    [][]byte
+		invalid   int
+		complete  bool
+	}{
+		{"partial", scriptSig(nil, sig(keys[2])), false, [][]byte{pubKey(2)}, 0, false},
+		{"complete", scriptSig(nil, sig(keys[0]), sig(keys[2])), false, [][]byte{pubKey(0), pubKey(2)}, 0, true},
+		{"out of order", scriptSig(nil, sig(keys[2]), sig(keys[0])), false, [][]byte{pubKey(2)}, 1, false},
+		{"wrong amount", scriptSig(nil, wrongAmount, sig(keys[2])), false, [][]byte{pubKey(2)}, 1, false},
+		{"schnorr", scriptSig([]byte{0x06}, sig(keys[1], WithSchnorr()), sig(keys[2], WithSchnorr())), true,
+			[][]byte{pubKey(1), pubKey(2)}, 0, true},
+		{"schnorr bitfield", scriptSig([]byte{0x05}, sig(keys[1], WithSchnorr()), sig(keys[2], WithSchnorr())),
+			true, [][]byte{pubKey(2)}, 1, false},
+		{"ecdsa in schnorr form", scriptSig([]byte{0x06}, sig(keys[1]), sig(keys[2])), true, nil, 2, false},
+	}
+	for _, test := range tests {
+		tx.TxIn[0].SignatureScript = test.scriptSig
+		status, err := VerifyMultisigScriptSig(tx, 0, prevOut)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if status.Schnorr != test.schnorr || status.Required != 2 || len(status.PubKeys) != 3 {
+			t.Errorf("%s: got Schnorr %v and %d-of-%d", test.name, status.Schnorr, status.Required,
+				len(status.PubKeys))
+		}
+		if len(status.SignedPubKeys) != len(test.signed) {
+			t.Errorf("%s: got signed keys %x, want %x", test.name, status.SignedPubKeys, test.signed)
+		} else {
+			for i := range test.signed {
+				if !bytes.Equal(status.SignedPubKeys[i], test.signed[i]) {
+					t.Errorf("%s: got signed keys %x, want %x", test.name, status.SignedPubKeys, test.signed)
+				}
+			}
+		}
+		if len(status.InvalidSignatures) != test.invalid {
+			t.Errorf("%s: got %d invalid signatures, want %d", test.name, len(status.InvalidSignatures),
+				test.invalid)
+		}
+		if status.Complete() != test.complete {
+			t.Errorf("%s: got complete %v", test.name, status.Complete())
+		}
+	}
+
+	tx.TxIn[0].SignatureScript = scriptSig(nil, sig(keys[0]))
+	if _, err := VerifyMultisigScriptSig(tx, 0, &UTXO{PkScript: redeemScript}); !errors.Is(err,
+		ErrNonStandardScript) {
+		t.Errorf("got %v, want ErrNonStandardScript", err)
+	}
+	otherScript, _ := payToScriptHashScript(make([]byte, 20))
+	if _, err := VerifyMultisigScriptSig(tx, 0, &UTXO{PkScript: otherScript}); !errors.Is(err,
+		ErrRedeemScriptMismatch) {
+		t.Errorf("got %v, want ErrRedeemScriptMismatch", err)
+	}
+}
+
+func TestOrderSignatures(t *testing.T) {
+	c, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x03})
+	keys := append(signingTestKeys(), c)
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_2)
+	for _, key := range keys {
+		builder.AddData(key.PubKey().SerializeCompressed())
+	}
+	redeemScript, _ := builder.AddOp(txscript.OP_3).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	tx := engineTestTx(nil)
+	prevOut := &UTXO{Amount: 5000}
+
+	sign := func(key *btcec.PrivateKey, hashType txscript.SigHashType) []byte {
+		sig, err := RawTxInSignature(tx, 0, redeemScript, hashType, key, 5000,
+			AllowDangerousSigHash(txscript.SigHashNone|txscript.SigHashAnyOneCanPay))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	first := sign(keys[0], txscript.SigHashNone|txscript.SigHashAnyOneCanPay)
+	third := sign(keys[2], txscript.SigHashAll)
+	ordered, err := OrderSignatures(redeemScript, [][]byte{third, first, third}, tx, 0, prevOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ordered) != 2 || !bytes.Equal(ordered[0], first) || !bytes.Equal(ordered[1], third) {
+		t.Fatalf("wrong order %x", ordered)
+	}
+
+	// Signatures of another amount match no key.
+	other, _ := RawTxInSignature(tx, 0, redeemScript, txscript.SigHashAll, keys[1], 5001)
+	ordered, err = OrderSignatures(redeemScript, [][]byte{other, third}, tx, 0, prevOut)
+	if !errors.Is(err, ErrUnmatchedSignature) || len(ordered) != 1 || !bytes.Equal(ordered[0], third) {
+		t.Errorf("got %x, %v, want the third signature and ErrUnmatchedSignature", ordered, err)
+	}
+
+	// Signatures committing to tokens only match with them.
+	token := &TokenData{Amount: 10}
+	tokenSig, _ := RawTxInSignature(tx, 0, redeemScript, txscript.SigHashAll, keys[1], 5000,
+		WithTokenPrevout(token))
+	if _, err := OrderSignatures(redeemScript, [][]byte{tokenSig}, tx, 0, prevOut); !errors.Is(err,
+		ErrUnmatchedSignature) {
+		t.Errorf("got %v, want ErrUnmatchedSignature", err)
+	}
+	tokenOut := &UTXO{Amount: 5000, TokenData: token.Bytes()}
+	if ordered, err := OrderSignatures(redeemScript, [][]byte{tokenSig}, tx, 0, tokenOut); err != nil ||
+		len(ordered) != 1 {
+		t.Errorf("got %x, %v", ordered, err)
+	}
+}
+
+func TestSignTxOutputMergesMultiSig(t *testing.T) {
+	c, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x03})
+	keys := append(signingTestKeys(), c)
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_2)
+	for _, key := range keys {
+		builder.AddData(key.PubKey().SerializeCompressed())
+	}
+	redeemScript, _ := builder.AddOp(txscript.OP_3).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	pkScript, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+	tx := engineTestTx(nil)
+	sdb := txscript.ScriptClosure(func(btcutil.Address) ([]byte, error) { return redeemScript, nil })
+	kdb := func(key *btcec.PrivateKey) txscript.KeyDB {
+		return txscript.KeyClosure(func(addr btcutil.Address) (*btcec.PrivateKey, bool, error) {
+			if bytes.Equal(addr.ScriptAddress(), key.PubKey().SerializeCompressed()) {
+				return key, true, nil
+			}
+			return nil, false, errors.New("unknown key")
+		})
+	}
+
+	// The last key signs first: its signature must still come last.
+	for _, opts := range [][]SignOption{nil, {WithSchnorr()}} {
+		partial, err := SignTxOutput(&chaincfg.MainNetParams, tx, 0, pkScript, txscript.SigHashAll, kdb(keys[2]),
+			sdb, nil, 5000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptSig, err := SignTxOutput(&chaincfg.MainNetParams, tx, 0, pkScript, txscript.SigHashAll, kdb(keys[0]),
+			sdb, partial, 5000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TxIn[0].SignatureScript = scriptSig
+		vm, err := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Errorf("%d options: %v", len(opts), err)
+		}
+		tx.TxIn[0].SignatureScript = nil
+	}
+}
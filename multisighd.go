@@ -0,0 +1,199 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// ErrAddressNotDerived describes an error where an address is not among those
+// a wallet derived.
+var ErrAddressNotDerived = errors.New("address not derived by the wallet")
+
+// maxP2SHMultisigKeys is the largest number of compressed keys of a multisig
+// redeem script fitting the 520 bytes of a push.
+const maxP2SHMultisigKeys = 15
+
+// MultisigAddress is an address of a multisig HD wallet.
+type MultisigAddress struct {
+	Change, Index uint32
+
+	// RedeemScript is the multisig script of the child keys of the
+	// cosigners, Address its pay-to-script-hash address and Address32 its
+	// pay-to-script-hash address with a 32 byte hash.
+	RedeemScript []byte
+	Address      *CashAddressScriptHash
+	Address32    *CashAddressScriptHash32
+}
+
+// MultisigHDWallet derives the addresses of an m-of-n multisig wallet whose
+// cosigners have account extended keys, from the children of each at the same
+// path, as every cosigner derives them independently.  It is safe for
+// concurrent use.
+type MultisigHDWallet struct {
+	xpubs    []*hdkeychain.ExtendedKey
+	required int
+	params   *chaincfg.Params
+	sorted   bool
+
+	mu sync.Mutex
+
+	// branches are the change nodes of the cosigners, by change.
+	branches map[uint32][]*hdkeychain.ExtendedKey
+
+	// derived are the addresses derived, by path and by script hash.
+	derived  map[[2]uint32]*MultisigAddress
+	byScript map[string]*MultisigAddress
+}
+
+// NewMultisigHDWallet returns the wallet whose addresses require m signatures
+// of the cosigners of xpubs, their account extended keys, on the network of
+// params.  With sorted, the keys of the redeem scripts are sorted, as BIP 67
+// and Electron Cash multisig wallets do, and otherwise they are in the order of
+// xpubs.  Private keys are neutered, and keys of networks other than params
+// fail with ErrNetworkMismatch.
+func NewMultisigHDWallet(xpubs []*hdkeychain.ExtendedKey, m int, params *chaincfg.Params,
+	sorted bool) (*MultisigHDWallet, error) {
+
+	if len(xpubs) == 0 || len(xpubs) > maxP2SHMultisigKeys {
+		return nil, fmt.Errorf("%d cosigners, want 1 to %d", len(xpubs), maxP2SHMultisigKeys)
+	}
+	if m < 1 || m > len(xpubs) {
+		return nil, fmt.Errorf("%d-of-%d multisig", m, len(xpubs))
+	}
+	w := &MultisigHDWallet{
+		required: m,
+		params:   params,
+		sorted:   sorted,
+		branches: make(map[uint32][]*hdkeychain.ExtendedKey),
+		derived:  make(map[[2]uint32]*MultisigAddress),
+		byScript: make(map[string]*MultisigAddress),
+	}
+	for i, xpub := range xpubs {
+		if err := CheckNetwork(params, fmt.Sprintf("cosigner %d key", i), xpub); err != nil {
+			return nil, err
+		}
+		pub, err := xpub.Neuter()
+		if err != nil {
+			return nil, fmt.Errorf("cosigner %d: %w", i, err)
+		}
+		w.xpubs = append(w.xpubs, pub)
+	}
+	return w, nil
+}
+
+// branch returns the change nodes of the cosigners, deriving them the first
+// time.  It must be called with the lock held.
+func (w *MultisigHDWallet) branch(change uint32) ([]*hdkeychain.ExtendedKey, error) {
+	if nodes, ok := w.branches[change]; ok {
+		return nodes, nil
+	}
+	nodes := make([]*hdkeychain.ExtendedKey, len(w.xpubs))
+	for i, xpub := range w.xpubs {
+		node, err := xpub.Child(change)
+		if err != nil {
+			return nil, fmt.Errorf("cosigner %d: %w", i, err)
+		}
+		nodes[i] = node
+	}
+	w.branches[change] = nodes
+	return nodes, nil
+}
+
+// DeriveAddress returns the address of change and index, whose redeem script
+// has the child keys of the cosigners at change/index of their account keys.
+// Addresses are cached, and so are the change nodes of the cosigners, so that
+// deriving many addresses derives one child of each cosigner per address.
+func (w *MultisigHDWallet) DeriveAddress(change, index uint32) (*MultisigAddress, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if addr, ok := w.derived[[2]uint32{change, index}]; ok {
+		return addr, nil
+	}
+
+	nodes, err := w.branch(change)
+	if err != nil {
+		return nil, err
+	}
+	pubKeys := make([][]byte, len(nodes))
+	for i, node := range nodes {
+		child, err := node.Child(index)
+		if err != nil {
+			return nil, fmt.Errorf("cosigner %d: %w", i, err)
+		}
+		pubKey, err := child.ECPubKey()
+		if err != nil {
+			return nil, fmt.Errorf("cosigner %d: %w", i, err)
+		}
+		pubKeys[i] = pubKey.SerializeCompressed()
+	}
+	if w.sorted {
+		sort.Slice(pubKeys, func(i, j int) bool {
+			return bytes.Compare(pubKeys[i], pubKeys[j]) < 0
+		})
+	}
+	builder := NewScriptBuilder().AddInt64(int64(w.required))
+	for _, pubKey := range pubKeys {
+		builder.AddData(pubKey)
+	}
+	redeemScript, err := builder.AddInt64(int64(len(pubKeys))).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	if err != nil {
+		return nil, err
+	}
+
+	addr := &MultisigAddress{Change: change, Index: index, RedeemScript: redeemScript}
+	if addr.Address, err = NewCashAddressScriptHash(redeemScript, w.params); err != nil {
+		return nil, err
+	}
+	if addr.Address32, err = NewCashAddressScriptHash32(redeemScript, w.params); err != nil {
+		return nil, err
+	}
+	w.derived[[2]uint32{change, index}] = addr
+	w.byScript[string(addr.Address.ScriptAddress())] = addr
+	w.byScript[string(addr.Address32.ScriptAddress())] = addr
+	return addr, nil
+}
+
+// DeriveRange returns the count addresses of change from index start.
+func (w *MultisigHDWallet) DeriveRange(change, start, count uint32) ([]*MultisigAddress, error) {
+	addrs := make([]*MultisigAddress, 0, count)
+	for i := uint32(0); i < count; i++ {
+		addr, err := w.DeriveAddress(change, start+i)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// RedeemScriptFor returns the address derived whose script hash is that of
+// addr, a pay-to-script-hash address with a 20 or 32 byte hash in any
+// encoding, to find the redeem script spending it.  Only the addresses
+// derived before, by DeriveAddress or DeriveRange, are known: others fail with
+// ErrAddressNotDerived, and addresses of other networks with both
+// ErrWrongNetwork and ErrNetworkMismatch.
+func (w *MultisigHDWallet) RedeemScriptFor(addr btcutil.Address) (*MultisigAddress, error) {
+	switch addr.(type) {
+	case *btcutil.AddressScriptHash, *CashAddressScriptHash, *CashAddressScriptHash32:
+	default:
+		return nil, fmt.Errorf("%w: %T is not pay-to-script-hash", ErrInvalidAddress, addr)
+	}
+	if !addr.IsForNet(w.params) {
+		return nil, fmt.Errorf("%w: %w: %s", ErrWrongNetwork, ErrNetworkMismatch, addr)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	derived, ok := w.byScript[string(addr.ScriptAddress())]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAddressNotDerived, addr)
+	}
+	return derived, nil
+}
@@ -0,0 +1,148 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+func TestMultisigHDWallet(t *testing.T) {
+	var xpubs []*hdkeychain.ExtendedKey
+	for i := byte(1); i <= 3; i++ {
+		xpub, _ := electronCashTestKey(i).Neuter()
+		xpubs = append(xpubs, xpub)
+	}
+	w, err := NewMultisigHDWallet(xpubs, 2, &chaincfg.MainNetParams, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The redeem script is the one of the Electron Cash wallet of the same
+	// keys.
+	p, _ := ParseElectronCashPartialTx([]byte(electronCashTestTx))
+	addr, err := w.DeriveAddress(0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(addr.RedeemScript, p.Inputs[0].RedeemScript) {
+		t.Fatalf("redeem script %x, Electron Cash %x", addr.RedeemScript, p.Inputs[0].RedeemScript)
+	}
+	if again, _ := w.DeriveAddress(0, 5); again != addr {
+		t.Error("address derived again")
+	}
+
+	// Unsorted keys are in the order of the cosigners.
+	unsorted, _ := NewMultisigHDWallet(xpubs, 2, &chaincfg.MainNetParams, false)
+	unsortedAddr, err := unsorted.DeriveAddress(0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeys, _, _ := multisigPubKeys(unsortedAddr.RedeemScript)
+	child, _ := Path{0, 5}.Derive(xpubs[2])
+	pubKey, _ := child.ECPubKey()
+	if !bytes.Equal(pubKeys[2], pubKey.SerializeCompressed()) ||
+		bytes.Equal(unsortedAddr.RedeemScript, addr.RedeemScript) {
+		t.Errorf("unsorted redeem script %x", unsortedAddr.RedeemScript)
+	}
+
+	addrs, err := w.DeriveRange(1, 0, 20)
+	if err != nil || len(addrs) != 20 || addrs[7].Change != 1 || addrs[7].Index != 7 {
+		t.Fatalf("got %d addresses, %v", len(addrs), err)
+	}
+	legacy, _ := btcutil.NewAddressScriptHash(addrs[7].RedeemScript, &chaincfg.MainNetParams)
+	for _, a := range []btcutil.Address{addrs[7].Address, addrs[7].Address32, legacy} {
+		found, err := w.RedeemScriptFor(a)
+		if err != nil || found != addrs[7] {
+			t.Errorf("%s: got %+v, %v", a, found, err)
+		}
+	}
+	other, _ := NewCashAddressScriptHash([]byte{1}, &chaincfg.MainNetParams)
+	if _, err := w.RedeemScriptFor(other); !errors.Is(err, ErrAddressNotDerived) {
+		t.Errorf("got %v, want ErrAddressNotDerived", err)
+	}
+	testnet, _ := NewCashAddressScriptHash(addrs[7].RedeemScript, &chaincfg.TestNet3Params)
+	if _, err := w.RedeemScriptFor(testnet); !errors.Is(err, ErrWrongNetwork) ||
+		!errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("got %v, want ErrWrongNetwork and ErrNetworkMismatch", err)
+	}
+	if _, err := w.DeriveAddress(hdkeychain.HardenedKeyStart, 0); err == nil {
+		t.Error("hardened child of a public key derived")
+	}
+
+	for _, m := range []int{0, 4} {
+		if _, err := NewMultisigHDWallet(xpubs, m, &chaincfg.MainNetParams, true); err == nil {
+			t.Errorf("%d-of-3 wallet created", m)
+		}
+	}
+	if _, err := NewMultisigHDWallet(xpubs, 2, &chaincfg.TestNet3Params, true); !errors.Is(err,
+		ErrNetworkMismatch) {
+		t.Errorf("mainnet keys for testnet: %v, want ErrNetworkMismatch", err)
+	}
+}
+
+// electronCashMultisigWallet is a multisig wallet of Electron Cash in
+// testdata/electroncash: the account xpubs of its cosigners, as Electron Cash
+// shows them, and the first receiving and change addresses of its Addresses
+// tab.
+type electronCashMultisigWallet struct {
+	M         int      `json:"m"`
+	XPubs     []string `json:"xpubs"`
+	Receiving []string `json:"receiving"`
+	Change    []string `json:"change"`
+}
+
+// TestMultisigHDWalletElectronCash checks the addresses derived from the
+// xpubs of the Electron Cash multisig wallets of testdata/electroncash
+// against those Electron Cash derives, with sorted keys as it does.
+func TestMultisigHDWalletElectronCash(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "electroncash", "*.multisig.json"))
+	if len(files) == 0 {
+		t.Skip("no Electron Cash multisig wallet in testdata/electroncash")
+	}
+	for _, name := range files {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wallet electronCashMultisigWallet
+		if err := json.Unmarshal(raw, &wallet); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var xpubs []*hdkeychain.ExtendedKey
+		for _, s := range wallet.XPubs {
+			xpub, err := hdkeychain.NewKeyFromString(s)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			xpubs = append(xpubs, xpub)
+		}
+		w, err := NewMultisigHDWallet(xpubs, wallet.M, &chaincfg.MainNetParams, true)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for change, addrs := range [][]string{wallet.Receiving, wallet.Change} {
+			for i, s := range addrs {
+				want, err := DecodeAddress(s, &chaincfg.MainNetParams)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				got, err := w.DeriveAddress(uint32(change), uint32(i))
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				wantScript, _ := PayToAddrScript(want)
+				gotScript, _ := PayToAddrScript(got.Address)
+				if !bytes.Equal(gotScript, wantScript) {
+					t.Errorf("%s: address %d/%d is %s, Electron Cash has %s", name, change, i, got.Address, s)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// messageMagic prefixes the messages signed by wallets, so that signatures
+// of messages can't sign transactions.
+const messageMagic = "Bitcoin Signed Message:\n"
+
+// multisigProofMagic starts the binary serialization of multisig proofs, and
+// multisigProofVersion is the version of their binary and JSON
+// serializations.
+var multisigProofMagic = []byte("MSGP")
+
+const multisigProofVersion = 1
+
+// ErrInvalidMultisigProof describes an error where a multisig message proof
+// can't be decoded, or does not prove that enough keys of its address signed
+// the message.
+var ErrInvalidMultisigProof = errors.New("invalid multisig message proof")
+
+// MessageDigest returns the digest of message signed by wallets: the double
+// SHA-256 of the message magic and message, each prefixed by its length.
+func MessageDigest(message string) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarString(&buf, 0, messageMagic)
+	wire.WriteVarString(&buf, 0, message)
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+// MultisigMessageSignature is the signature of a message by a key of a
+// multisig script.
+type MultisigMessageSignature struct {
+	// PubKey is the key as serialized in the script, and Signature its
+	// DER encoded ECDSA signature, or Schnorr signature, of the message
+	// digest.
+	PubKey    []byte
+	Signature []byte
+}
+
+// MultisigProof proves that keys of a pay-to-script-hash multisig address
+// signed a message, which message signatures recovering a single key can't
+// prove.
+type MultisigProof struct {
+	RedeemScript []byte
+	Signatures   []MultisigMessageSignature
+}
+
+// SignMultisigMessage returns the proof of keys, keys of the multisig
+// redeemScript, signing message with ECDSA.  The signatures are in the order
+// of the keys in the script.  The proof verifies if keys hold at least as
+// many keys as the script requires.
+func SignMultisigMessage(redeemScript []byte, message string, keys []*btcec.PrivateKey) (*MultisigProof, error) {
+	pubKeys, _, ok := multisigPubKeys(redeemScript)
+	if !ok {
+		return nil, fmt.Errorf("%w: redeem script is not multisig", ErrNonStandardScript)
+	}
+	signers := make([]*btcec.PrivateKey, len(pubKeys))
+	for _, key := range keys {
+		slot := -1
+		for i, pubKey := range pubKeys {
+			if bytes.Equal(pubKey, key.PubKey().SerializeCompressed()) ||
+				bytes.Equal(pubKey, key.PubKey().SerializeUncompressed()) {
+				slot = i
+				break
+			}
+		}
+		if slot < 0 {
+			return nil, fmt.Errorf("public key %x not in the redeem script", key.PubKey().SerializeCompressed())
+		}
+		signers[slot] = key
+	}
+
+	digest := MessageDigest(message)
+	proof := &MultisigProof{RedeemScript: redeemScript}
+	for i, key := range signers {
+		if key == nil {
+			continue
+		}
+		sig, err := key.Sign(digest)
+		if err != nil {
+			return nil, err
+		}
+		proof.Signatures = append(proof.Signatures,
+			MultisigMessageSignature{PubKey: pubKeys[i], Signature: sig.Serialize()})
+	}
+	return proof, nil
+}
+
+// VerifyMultisigMessage checks that proof proves that keys of addr signed
+// message: the redeem script of proof must hash to addr, a pay-to-script-hash
+// address, and at least as many keys of the script as it requires must have
+// a valid signature.  It returns the keys with a valid signature, in the
+// order of the script, and an error wrapping ErrInvalidMultisigProof if they
+// are too few.
+func VerifyMultisigMessage(addr btcutil.Address, proof *MultisigProof, message string) ([][]byte, error) {
+	pkScript, err := PayToAddrScript(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRedeemScriptHash(proof.RedeemScript, pkScript); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMultisigProof, err)
+	}
+	pubKeys, required, ok := multisigPubKeys(proof.RedeemScript)
+	if !ok {
+		return nil, fmt.Errorf("%w: redeem script is not multisig", ErrInvalidMultisigProof)
+	}
+
+	digest := MessageDigest(message)
+	var signed [][]byte
+	for _, pubKey := range pubKeys {
+		for _, sig := range proof.Signatures {
+			if bytes.Equal(sig.PubKey, pubKey) && verifySignature(sig.Signature, pubKey, digest, true) {
+				signed = append(signed, pubKey)
+				break
+			}
+		}
+	}
+	if len(signed) < required {
+		return signed, fmt.Errorf("%w: %d valid signatures for %d-of-%d multisig", ErrInvalidMultisigProof,
+			len(signed), required, len(pubKeys))
+	}
+	return signed, nil
+}
+
+// MarshalBinary returns the binary serialization of the proof.
+func (p *MultisigProof) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(multisigProofMagic)
+	buf.WriteByte(multisigProofVersion)
+	wire.WriteVarBytes(&buf, 0, p.RedeemScript)
+	wire.WriteVarInt(&buf, 0, uint64(len(p.Signatures)))
+	for _, sig := range p.Signatures {
+		wire.WriteVarBytes(&buf, 0, sig.PubKey)
+		wire.WriteVarBytes(&buf, 0, sig.Signature)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a proof serialized by MarshalBinary.
+func (p *MultisigProof) UnmarshalBinary(data []byte) error {
+	if len(data) < len(multisigProofMagic)+1 || !bytes.Equal(data[:len(multisigProofMagic)], multisigProofMagic) {
+		return fmt.Errorf("%w: bad magic", ErrInvalidMultisigProof)
+	}
+	if version := data[len(multisigProofMagic)]; version != multisigProofVersion {
+		return fmt.Errorf("%w: unknown version %d", ErrInvalidMultisigProof, version)
+	}
+	r := bytes.NewReader(data[len(multisigProofMagic)+1:])
+	var proof MultisigProof
+	var err error
+	if proof.RedeemScript, err = wire.ReadVarBytes(r, 0, MaxScriptSize, "redeemScript"); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMultisigProof, err)
+	}
+	n, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMultisigProof, err)
+	}
+	if n > txscript.MaxPubKeysPerMultiSig {
+		return fmt.Errorf("%w: %d signatures", ErrInvalidMultisigProof, n)
+	}
+	for i := uint64(0); i < n; i++ {
+		var sig MultisigMessageSignature
+		if sig.PubKey, err = wire.ReadVarBytes(r, 0, btcec.PubKeyBytesLenUncompressed, "pubKey"); err != nil {
+			return fmt.Errorf("%w: signature %d: %v", ErrInvalidMultisigProof, i, err)
+		}
+		// DER signatures take at most 72 bytes.
+		if sig.Signature, err = wire.ReadVarBytes(r, 0, 72, "signature"); err != nil {
+			return fmt.Errorf("%w: signature %d: %v", ErrInvalidMultisigProof, i, err)
+		}
+		proof.Signatures = append(proof.Signatures, sig)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%w: trailing data", ErrInvalidMultisigProof)
+	}
+	*p = proof
+	return nil
+}
+
+// String returns the base64 encoding of the binary serialization of the
+// proof, a compact form to paste in messages.
+func (p *MultisigProof) String() string {
+	b, _ := p.MarshalBinary()
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// ParseMultisigProof decodes a proof encoded by String.
+func ParseMultisigProof(s string) (*MultisigProof, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMultisigProof, err)
+	}
+	p := new(MultisigProof)
+	if err := p.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// jsonMultisigMessageSignature is the JSON form of a MultisigMessageSignature.
+type jsonMultisigMessageSignature struct {
+	PubKey    string `json:"pubKey"`
+	Signature string `json:"signature"`
+}
+
+// jsonMultisigProof is the JSON form of a MultisigProof.
+type jsonMultisigProof struct {
+	Version      int                            `json:"version"`
+	RedeemScript string                         `json:"redeemScript"`
+	Signatures   []jsonMultisigMessageSignature `json:"signatures"`
+}
+
+// MarshalJSON returns the JSON serialization of the proof, with the script,
+// keys and signatures hex encoded.
+func (p *MultisigProof) MarshalJSON() ([]byte, error) {
+	j := jsonMultisigProof{
+		Version:      multisigProofVersion,
+		RedeemScript: hex.EncodeToString(p.RedeemScript),
+		Signatures:   make([]jsonMultisigMessageSignature, len(p.Signatures)),
+	}
+	for i, sig := range p.Signatures {
+		j.Signatures[i] = jsonMultisigMessageSignature{
+			PubKey:    hex.EncodeToString(sig.PubKey),
+			Signature: hex.EncodeToString(sig.Signature),
+		}
+	}
+	return json.Marshal(&j)
+}
+
+// UnmarshalJSON decodes a proof serialized by MarshalJSON.
+func (p *MultisigProof) UnmarshalJSON(data []byte) error {
+	var j jsonMultisigProof
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.Version != multisigProofVersion {
+		return fmt.Errorf("%w: unknown version %d", ErrInvalidMultisigProof, j.Version)
+	}
+	var proof MultisigProof
+	var err error
+	if proof.RedeemScript, err = hex.DecodeString(j.RedeemScript); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMultisigProof, err)
+	}
+	for i, js := range j.Signatures {
+		var sig MultisigMessageSignature
+		if sig.PubKey, err = hex.DecodeString(js.PubKey); err != nil {
+			return fmt.Errorf("%w: signature %d: %v", ErrInvalidMultisigProof, i, err)
+		}
+		if sig.Signature, err = hex.DecodeString(js.Signature); err != nil {
+			return fmt.Errorf("%w: signature %d: %v", ErrInvalidMultisigProof, i, err)
+		}
+		proof.Signatures = append(proof.Signatures, sig)
+	}
+	*p = proof
+	return nil
+}
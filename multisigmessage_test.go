@@ -0,0 +1,80 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestMultisigMessage(t *testing.T) {
+	var keys []*btcec.PrivateKey
+	var addrPubKeys []*btcutil.AddressPubKey
+	for i := byte(1); i <= 3; i++ {
+		key, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{i})
+		keys = append(keys, key)
+		pub, _ := btcutil.NewAddressPubKey(key.PubKey().SerializeCompressed(), &chaincfg.MainNetParams)
+		addrPubKeys = append(addrPubKeys, pub)
+	}
+	redeemScript, _ := txscript.MultiSigScript(addrPubKeys, 2)
+	addr, _ := NewCashAddressScriptHash(redeemScript, &chaincfg.MainNetParams)
+	addr32, _ := NewCashAddressScriptHash32(redeemScript, &chaincfg.MainNetParams)
+	const message = "I control this address"
+
+	proof, err := SignMultisigMessage(redeemScript, message, []*btcec.PrivateKey{keys[2], keys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]byte{addrPubKeys[0].ScriptAddress(), addrPubKeys[2].ScriptAddress()}
+	for _, a := range []btcutil.Address{addr, addr32} {
+		signed, err := VerifyMultisigMessage(a, proof, message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(signed, want) {
+			t.Errorf("got signers %x, want %x", signed, want)
+		}
+	}
+
+	decoded, err := ParseMultisigProof(proof.String())
+	if err != nil || !reflect.DeepEqual(decoded, proof) {
+		t.Errorf("base64 round trip: got %+v, %v", decoded, err)
+	}
+	b, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded = new(MultisigProof)
+	if err := json.Unmarshal(b, decoded); err != nil || !reflect.DeepEqual(decoded, proof) {
+		t.Errorf("JSON round trip: got %+v, %v", decoded, err)
+	}
+
+	// A signature of another message doesn't count.
+	other, _ := SignMultisigMessage(redeemScript, "something else", keys[1:2])
+	tampered := &MultisigProof{RedeemScript: redeemScript,
+		Signatures: []MultisigMessageSignature{proof.Signatures[0], other.Signatures[0]}}
+	signed, err := VerifyMultisigMessage(addr, tampered, message)
+	if !errors.Is(err, ErrInvalidMultisigProof) || len(signed) != 1 || !bytes.Equal(signed[0], want[0]) {
+		t.Errorf("got %x, %v, want one signer and ErrInvalidMultisigProof", signed, err)
+	}
+	otherScript, _ := txscript.MultiSigScript(addrPubKeys, 1)
+	otherAddr, _ := NewCashAddressScriptHash(otherScript, &chaincfg.MainNetParams)
+	if _, err := VerifyMultisigMessage(otherAddr, proof, message); !errors.Is(err, ErrInvalidMultisigProof) {
+		t.Errorf("other address: got %v, want ErrInvalidMultisigProof", err)
+	}
+
+	stranger, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{9})
+	if _, err := SignMultisigMessage(redeemScript, message, []*btcec.PrivateKey{stranger}); err == nil {
+		t.Error("key not in the script accepted")
+	}
+	b, _ = proof.MarshalBinary()
+	if err := decoded.UnmarshalBinary(append(b, 0)); !errors.Is(err, ErrInvalidMultisigProof) {
+		t.Errorf("trailing data: got %v, want ErrInvalidMultisigProof", err)
+	}
+}
@@ -0,0 +1,573 @@
+// Package musig is an experimental implementation of MuSig 2-of-2 key and
+// signature aggregation over the Bitcoin Cash Schnorr signatures of the May
+// 2019 upgrade, for payment channels to lock their funds to a single key
+// rather than a 2-of-2 multisig script.
+//
+// AggregateKeys combines the keys of the two parties into one, each weighted
+// by a coefficient hashing both keys, so that neither party can choose its
+// key as a function of the other's to control the aggregate.  The outputs of
+// the aggregate key are ordinary pay-to-pubkey-hash outputs, spent by an
+// ordinary 65 byte Schnorr signature produced in three steps by a Session of
+// each party:
+//
+//  1. the parties exchange the commitments to their nonces, Commitment;
+//  2. they exchange their nonces, Nonce, checked against the commitments;
+//  3. they exchange their partial signatures, Sign, which Combine checks and
+//     adds into the signature.
+//
+// Sessions are serialized with Serialize and ParseSession, so that the steps
+// following the signature of a session, or its record, can run in another
+// process.  Private keys are never part of a session.
+//
+// A nonce signing two messages, or one message with two aggregate nonces,
+// reveals the private key.  Sessions draw their nonce themselves, bind it to
+// their message, and erase it once they sign: a session signs at most once.
+// The nonce is never serialized, so that no copy of a session signs with it
+// again: a session signs in the process that drew its nonce, and the sessions
+// parsed from its serialization, before or after it signed, cannot sign.
+package musig
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// formatVersion is the version of the binary serialization of sessions.
+const formatVersion = 1
+
+// sessionMagic prefixes the binary serialization of sessions.
+var sessionMagic = []byte("BMSG")
+
+// Flags of the serialization of sessions, for the fields present.  hasNonce
+// marks a secret nonce, which sessions never serialize, and is rejected.
+const (
+	hasNonce byte = 1 << iota
+	hasPeerCommitment
+	hasPeerNonce
+	hasPartialSig
+)
+
+var (
+	// ErrInvalidKey describes an error where the keys of the parties can't
+	// be aggregated, or a key is not that of a session.
+	ErrInvalidKey = errors.New("invalid key")
+
+	// ErrInvalidRound describes an error where a step of a session is run
+	// before the steps it depends on.
+	ErrInvalidRound = errors.New("session step out of order")
+
+	// ErrCommitmentMismatch describes an error where the nonce of the peer
+	// is not the one it committed to, or the peer changed its commitment.
+	ErrCommitmentMismatch = errors.New("nonce commitment mismatch")
+
+	// ErrNonceReuse describes an error where a session signs after its
+	// nonce was used, which would reveal the private key, or without the
+	// nonce, which sessions parsed by ParseSession do not have.
+	ErrNonceReuse = errors.New("nonce already used")
+
+	// ErrInvalidPartialSig describes an error where the partial signature
+	// of the peer is malformed or does not sign the session.
+	ErrInvalidPartialSig = errors.New("invalid partial signature")
+
+	// ErrInvalidSession describes an error where a serialized session is
+	// malformed.
+	ErrInvalidSession = errors.New("invalid session")
+)
+
+// taggedHash returns the SHA-256 of data prefixed by the SHA-256 of tag
+// twice, as BIP 340 does, keeping the hashes of the protocol apart.
+func taggedHash(tag string, data ...[]byte) []byte {
+	t := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(t[:])
+	h.Write(t[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// AggregateKey is the aggregate key of two parties.
+type AggregateKey struct {
+	// keys are the keys of the parties, in the order of their compressed
+	// serialization, and coefs their coefficients.
+	keys  [2]*btcec.PublicKey
+	coefs [2]*big.Int
+	pub   *btcec.PublicKey
+}
+
+// AggregateKeys returns the aggregate key a1·P1 + a2·P2 of the keys a and b,
+// in either order, where the coefficient of each key is the hash of both
+// keys and its own, so that a party can't pick a key cancelling the other's.
+// The keys must differ.
+func AggregateKeys(a, b *btcec.PublicKey) (*AggregateKey, error) {
+	ka, kb := a.SerializeCompressed(), b.SerializeCompressed()
+	switch bytes.Compare(ka, kb) {
+	case 0:
+		return nil, fmt.Errorf("%w: both parties have the same key", ErrInvalidKey)
+	case 1:
+		a, b = b, a
+		ka, kb = kb, ka
+	}
+	curve := btcec.S256()
+	list := taggedHash("BCH/MuSig/KeyList", ka, kb)
+	k := &AggregateKey{keys: [2]*btcec.PublicKey{a, b}}
+	var x, y *big.Int
+	for i, key := range [][]byte{ka, kb} {
+		coef := new(big.Int).SetBytes(taggedHash("BCH/MuSig/Coefficient", list, key))
+		k.coefs[i] = coef.Mod(coef, curve.N)
+		px, py := curve.ScalarMult(k.keys[i].X, k.keys[i].Y, k.coefs[i].Bytes())
+		if x == nil {
+			x, y = px, py
+		} else {
+			x, y = curve.Add(x, y, px, py)
+		}
+	}
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, fmt.Errorf("%w: aggregate key is the point at infinity", ErrInvalidKey)
+	}
+	k.pub = &btcec.PublicKey{Curve: curve, X: x, Y: y}
+	return k, nil
+}
+
+// PublicKey returns the aggregate key.
+func (k *AggregateKey) PublicKey() *btcec.PublicKey {
+	return k.pub
+}
+
+// Address returns the pay-to-pubkey-hash address of the aggregate key on
+// net, whose outputs the sessions of the parties spend.
+func (k *AggregateKey) Address(net *chaincfg.Params) (*bchutil.CashAddressPubKeyHash, error) {
+	return bchutil.NewCashAddressPubKeyHash(btcutil.Hash160(k.pub.SerializeCompressed()), net)
+}
+
+// coefficient returns the coefficient of key, one of the keys of k.
+func (k *AggregateKey) coefficient(key *btcec.PublicKey) (*big.Int, bool) {
+	for i := range k.keys {
+		if k.keys[i].IsEqual(key) {
+			return k.coefs[i], true
+		}
+	}
+	return nil, false
+}
+
+// Session is the state of the signing of a message by one of the parties of
+// an aggregate key.
+type Session struct {
+	agg      *AggregateKey
+	pubKey   *btcec.PublicKey
+	peer     *btcec.PublicKey
+	sigHash  []byte
+	hashType txscript.SigHashType
+
+	// nonce is the secret nonce of the session, nil once it signs or when
+	// parsed, and noncePub its point.
+	nonce    *big.Int
+	noncePub *btcec.PublicKey
+
+	peerCommitment []byte
+	peerNonce      *btcec.PublicKey
+	partialSig     *big.Int
+}
+
+// NewSession starts the signing of sigHash, the digest of a signature of
+// hashType, by the party of key with the party of peer, drawing its nonce.
+// The sighash type must have SigHashForkID.
+func NewSession(key *btcec.PrivateKey, peer *btcec.PublicKey, sigHash []byte,
+	hashType txscript.SigHashType) (*Session, error) {
+
+	s, err := newSession(key.PubKey(), peer, sigHash, hashType)
+	if err != nil {
+		return nil, err
+	}
+	curve := btcec.S256()
+	var entropy [32]byte
+	for s.nonce == nil || s.nonce.Sign() == 0 {
+		if _, err := io.ReadFull(rand.Reader, entropy[:]); err != nil {
+			return nil, err
+		}
+		// The key and the message are mixed in, so that a failing
+		// random source does not repeat the nonces of other messages.
+		var d [32]byte
+		key.D.FillBytes(d[:])
+		k := new(big.Int).SetBytes(taggedHash("BCH/MuSig/Nonce", entropy[:], d[:],
+			s.agg.pub.SerializeCompressed(), sigHash))
+		s.nonce = k.Mod(k, curve.N)
+	}
+	x, y := curve.ScalarBaseMult(s.nonce.Bytes())
+	s.noncePub = &btcec.PublicKey{Curve: curve, X: x, Y: y}
+	return s, nil
+}
+
+// NewInputSession starts the signing of input idx of tx, spending an output
+// of value amt paying the aggregate key of key and peer, with hashType as
+// NewSession does.  The options are those of bchutil.CalcSignatureHash.
+func NewInputSession(key *btcec.PrivateKey, peer *btcec.PublicKey, tx *wire.MsgTx, idx int, amt int64,
+	hashType txscript.SigHashType, opts ...bchutil.SignOption) (*Session, error) {
+
+	agg, err := AggregateKeys(key.PubKey(), peer)
+	if err != nil {
+		return nil, err
+	}
+	subScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+		AddData(btcutil.Hash160(agg.pub.SerializeCompressed())).AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_CHECKSIG).Script()
+	if err != nil {
+		return nil, err
+	}
+	sigHash, err := bchutil.CalcSignatureHash(subScript, hashType, tx, idx, amt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewSession(key, peer, sigHash, hashType)
+}
+
+// newSession returns the session without nonce of the party of pubKey.
+func newSession(pubKey, peer *btcec.PublicKey, sigHash []byte, hashType txscript.SigHashType) (*Session, error) {
+	if len(sigHash) != 32 {
+		return nil, errors.New("Schnorr signatures are over 32 byte digests")
+	}
+	base := hashType &^ (txscript.SigHashAnyOneCanPay | bchutil.SigHashForkID)
+	if hashType&bchutil.SigHashForkID == 0 || base < txscript.SigHashAll || base > txscript.SigHashSingle {
+		return nil, fmt.Errorf("%w: %#x", bchutil.ErrUnsupportedSigHashType, uint32(hashType))
+	}
+	agg, err := AggregateKeys(pubKey, peer)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{
+		agg:      agg,
+		pubKey:   pubKey,
+		peer:     peer,
+		sigHash:  append([]byte(nil), sigHash...),
+		hashType: hashType,
+	}, nil
+}
+
+// AggregateKey returns the aggregate key of the session.
+func (s *Session) AggregateKey() *AggregateKey {
+	return s.agg
+}
+
+// SigHash returns the digest the session signs.
+func (s *Session) SigHash() []byte {
+	return append([]byte(nil), s.sigHash...)
+}
+
+// nonceCommitment returns the commitment to the nonce point r.
+func nonceCommitment(r *btcec.PublicKey) []byte {
+	return taggedHash("BCH/MuSig/NonceCommitment", r.SerializeCompressed())
+}
+
+// Commitment returns the commitment to the nonce of the session, to send to
+// the peer, the first step.
+func (s *Session) Commitment() []byte {
+	return nonceCommitment(s.noncePub)
+}
+
+// SetPeerCommitment sets the commitment of the peer to its nonce, received
+// in the first step.  Commitments differing from the one set fail with
+// ErrCommitmentMismatch.
+func (s *Session) SetPeerCommitment(commitment []byte) error {
+	if len(commitment) != sha256.Size {
+		return fmt.Errorf("%w: %d byte commitment", ErrCommitmentMismatch, len(commitment))
+	}
+	if s.peerCommitment != nil {
+		if !bytes.Equal(s.peerCommitment, commitment) {
+			return fmt.Errorf("%w: peer changed its commitment", ErrCommitmentMismatch)
+		}
+		return nil
+	}
+	s.peerCommitment = append([]byte(nil), commitment...)
+	return nil
+}
+
+// Nonce returns the nonce point of the session, to send to the peer in the
+// second step, once its commitment is set.
+func (s *Session) Nonce() (*btcec.PublicKey, error) {
+	if s.peerCommitment == nil {
+		return nil, fmt.Errorf("%w: nonce revealed before the peer's commitment is set", ErrInvalidRound)
+	}
+	return s.noncePub, nil
+}
+
+// SetPeerNonce sets the nonce point of the peer, received in the second step,
+// which must be the one it committed to.
+func (s *Session) SetPeerNonce(nonce *btcec.PublicKey) error {
+	if s.peerCommitment == nil {
+		return fmt.Errorf("%w: peer nonce set before its commitment", ErrInvalidRound)
+	}
+	if !bytes.Equal(nonceCommitment(nonce), s.peerCommitment) {
+		return ErrCommitmentMismatch
+	}
+	s.peerNonce = nonce
+	return nil
+}
+
+// challenge returns the aggregate nonce point of the session, whether the
+// nonces are negated for its y to be a quadratic residue, and the challenge
+// of the signature.
+func (s *Session) challenge() (*big.Int, bool, *big.Int, error) {
+	curve := btcec.S256()
+	rx, ry := curve.Add(s.noncePub.X, s.noncePub.Y, s.peerNonce.X, s.peerNonce.Y)
+	if rx.Sign() == 0 && ry.Sign() == 0 {
+		return nil, false, nil, errors.New("aggregate nonce is the point at infinity")
+	}
+	var r [32]byte
+	rx.FillBytes(r[:])
+	h := sha256.New()
+	h.Write(r[:])
+	h.Write(s.agg.pub.SerializeCompressed())
+	h.Write(s.sigHash)
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return rx, big.Jacobi(ry, curve.P) != 1, e.Mod(e, curve.N), nil
+}
+
+// Sign returns the 32 byte partial signature of the session with key, to
+// send to the peer in the third step, once the nonce of the peer is set.  The
+// nonce of the session is erased: sessions sign once, and fail with
+// ErrNonceReuse after.
+func (s *Session) Sign(key *btcec.PrivateKey) ([]byte, error) {
+	if !key.PubKey().IsEqual(s.pubKey) {
+		return nil, fmt.Errorf("%w: not the key of the session", ErrInvalidKey)
+	}
+	if s.nonce == nil && s.partialSig == nil {
+		return nil, fmt.Errorf("%w: the nonce of a parsed session is not serialized", ErrNonceReuse)
+	}
+	if s.nonce == nil {
+		return nil, ErrNonceReuse
+	}
+	if s.peerNonce == nil {
+		return nil, fmt.Errorf("%w: signing before the peer's nonce is set", ErrInvalidRound)
+	}
+	_, negate, e, err := s.challenge()
+	if err != nil {
+		return nil, err
+	}
+	n := btcec.S256().N
+	k := s.nonce
+	if negate {
+		k = new(big.Int).Sub(n, k)
+	}
+	coef, _ := s.agg.coefficient(s.pubKey)
+	sig := new(big.Int).Mul(e, coef)
+	sig.Mul(sig, key.D)
+	sig.Add(sig, k)
+	sig.Mod(sig, n)
+	zeroScalar(k)
+	zeroScalar(s.nonce)
+	s.nonce = nil
+	s.partialSig = sig
+
+	var b [32]byte
+	sig.FillBytes(b[:])
+	return b[:], nil
+}
+
+// Combine returns the signature of the session, 64 bytes of Schnorr
+// signature by the aggregate key followed by the sighash type, adding the
+// partial signatures of the session and of the peer, received in the third
+// step.  Partial signatures of the peer not signing the session fail with
+// ErrInvalidPartialSig.
+func (s *Session) Combine(peerPartialSig []byte) ([]byte, error) {
+	if s.partialSig == nil {
+		return nil, fmt.Errorf("%w: combining before signing", ErrInvalidRound)
+	}
+	curve := btcec.S256()
+	peerSig := new(big.Int).SetBytes(peerPartialSig)
+	if len(peerPartialSig) != 32 || peerSig.Cmp(curve.N) >= 0 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidPartialSig)
+	}
+	rx, negate, e, err := s.challenge()
+	if err != nil {
+		return nil, err
+	}
+
+	// s·G = R + e·a·P for the nonce point R of the peer, negated as its
+	// nonce is.
+	coef, _ := s.agg.coefficient(s.peer)
+	ea := new(big.Int).Mul(e, coef)
+	ea.Mod(ea, curve.N)
+	px, py := curve.ScalarMult(s.peer.X, s.peer.Y, ea.Bytes())
+	ny := s.peerNonce.Y
+	if negate {
+		ny = new(big.Int).Sub(curve.P, ny)
+	}
+	wantX, wantY := curve.Add(s.peerNonce.X, ny, px, py)
+	gotX, gotY := curve.ScalarBaseMult(peerSig.Bytes())
+	if gotX.Cmp(wantX) != 0 || gotY.Cmp(wantY) != 0 {
+		return nil, ErrInvalidPartialSig
+	}
+
+	sum := new(big.Int).Add(s.partialSig, peerSig)
+	sum.Mod(sum, curve.N)
+	sig := make([]byte, bchutil.SchnorrSignatureLen+1)
+	rx.FillBytes(sig[:32])
+	sum.FillBytes(sig[32:bchutil.SchnorrSignatureLen])
+	sig[bchutil.SchnorrSignatureLen] = byte(s.hashType)
+	if !bchutil.VerifySchnorr(s.agg.pub, s.sigHash, sig[:bchutil.SchnorrSignatureLen]) {
+		return nil, errors.New("aggregate signature does not verify")
+	}
+	return sig, nil
+}
+
+// zeroScalar clears the secret scalar x.
+func zeroScalar(x *big.Int) {
+	words := x.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	x.SetInt64(0)
+}
+
+// Serialize returns the binary serialization of the session, without
+// private key or secret nonce: the session parsed from it can't sign, and
+// fails with ErrNonceReuse, but runs the other steps.
+func (s *Session) Serialize() []byte {
+	var buf bytes.Buffer
+	buf.Write(sessionMagic)
+	buf.WriteByte(formatVersion)
+	var flags byte
+	if s.peerCommitment != nil {
+		flags |= hasPeerCommitment
+	}
+	if s.peerNonce != nil {
+		flags |= hasPeerNonce
+	}
+	if s.partialSig != nil {
+		flags |= hasPartialSig
+	}
+	buf.WriteByte(flags)
+	buf.Write(s.pubKey.SerializeCompressed())
+	buf.Write(s.peer.SerializeCompressed())
+	buf.Write(s.sigHash)
+	buf.WriteByte(byte(s.hashType))
+	buf.Write(s.noncePub.SerializeCompressed())
+	if s.peerCommitment != nil {
+		buf.Write(s.peerCommitment)
+	}
+	if s.peerNonce != nil {
+		buf.Write(s.peerNonce.SerializeCompressed())
+	}
+	if s.partialSig != nil {
+		var scalar [32]byte
+		s.partialSig.FillBytes(scalar[:])
+		buf.Write(scalar[:])
+	}
+	return buf.Bytes()
+}
+
+// ParseSession decodes a session serialized by Serialize.
+func ParseSession(data []byte) (*Session, error) {
+	s, err := readSession(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSession, err)
+	}
+	return s, nil
+}
+
+func readSession(rd *bytes.Reader) (*Session, error) {
+	header := make([]byte, len(sessionMagic)+2)
+	if _, err := io.ReadFull(rd, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(sessionMagic)], sessionMagic) {
+		return nil, errors.New("bad magic")
+	}
+	if header[len(sessionMagic)] != formatVersion {
+		return nil, fmt.Errorf("unknown version %d", header[len(sessionMagic)])
+	}
+	flags := header[len(sessionMagic)+1]
+	switch {
+	case flags&^(hasNonce|hasPeerCommitment|hasPeerNonce|hasPartialSig) != 0:
+		return nil, fmt.Errorf("unknown flags %#x", flags)
+	case flags&hasNonce != 0:
+		return nil, errors.New("secret nonce in a serialized session")
+	case flags&hasPeerNonce != 0 && flags&hasPeerCommitment == 0,
+		flags&hasPartialSig != 0 && flags&hasPeerNonce == 0:
+		return nil, errors.New("missing step")
+	}
+
+	readPubKey := func() (*btcec.PublicKey, error) {
+		b := make([]byte, btcec.PubKeyBytesLenCompressed)
+		if _, err := io.ReadFull(rd, b); err != nil {
+			return nil, err
+		}
+		return btcec.ParsePubKey(b, btcec.S256())
+	}
+	readBytes := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(rd, b)
+		return b, err
+	}
+	readScalar := func() (*big.Int, error) {
+		b, err := readBytes(32)
+		if err != nil {
+			return nil, err
+		}
+		x := new(big.Int).SetBytes(b)
+		if x.Sign() == 0 || x.Cmp(btcec.S256().N) >= 0 {
+			return nil, errors.New("scalar out of range")
+		}
+		return x, nil
+	}
+
+	pubKey, err := readPubKey()
+	if err != nil {
+		return nil, err
+	}
+	peer, err := readPubKey()
+	if err != nil {
+		return nil, err
+	}
+	sigHash, err := readBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	hashType, err := rd.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSession(pubKey, peer, sigHash, txscript.SigHashType(hashType))
+	if err != nil {
+		return nil, err
+	}
+	if s.noncePub, err = readPubKey(); err != nil {
+		return nil, err
+	}
+	if flags&hasPeerCommitment != 0 {
+		if s.peerCommitment, err = readBytes(sha256.Size); err != nil {
+			return nil, err
+		}
+	}
+	if flags&hasPeerNonce != 0 {
+		nonce, err := readPubKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.SetPeerNonce(nonce); err != nil {
+			return nil, err
+		}
+	}
+	if flags&hasPartialSig != 0 {
+		if s.partialSig, err = readScalar(); err != nil {
+			return nil, err
+		}
+	}
+	if rd.Len() != 0 {
+		return nil, errors.New("trailing data")
+	}
+	return s, nil
+}
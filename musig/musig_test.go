@@ -0,0 +1,276 @@
+package musig
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var sigHashAll = txscript.SigHashAll | bchutil.SigHashForkID
+
+func testKeys() (*btcec.PrivateKey, *btcec.PrivateKey) {
+	a, _ := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{1}, 32))
+	b, _ := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{2}, 32))
+	return a, b
+}
+
+// exchange runs the three steps between the sessions a and b, passing b
+// through its serialization once it signs, and returns the signatures they
+// combine.
+func exchange(t *testing.T, keyA, keyB *btcec.PrivateKey, a, b *Session) ([]byte, []byte) {
+	t.Helper()
+	if err := a.SetPeerCommitment(b.Commitment()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetPeerCommitment(a.Commitment()); err != nil {
+		t.Fatal(err)
+	}
+	nonceA, err := a.Nonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonceB, err := b.Nonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetPeerNonce(nonceB); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetPeerNonce(nonceA); err != nil {
+		t.Fatal(err)
+	}
+	partialA, err := a.Sign(keyA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partialB, err := b.Sign(keyB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err = ParseSession(b.Serialize()); err != nil {
+		t.Fatal(err)
+	}
+	sigA, err := a.Combine(partialB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigB, err := b.Combine(partialA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sigA, sigB
+}
+
+func TestAggregateKeys(t *testing.T) {
+	a, b := testKeys()
+	ab, err := AggregateKeys(a.PubKey(), b.PubKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ba, err := AggregateKeys(b.PubKey(), a.PubKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ab.PublicKey().IsEqual(ba.PublicKey()) {
+		t.Error("aggregate key depends on the order of the keys")
+	}
+
+	// The aggregate key is not the plain sum of the keys, which the peer
+	// could cancel with a rogue key.
+	curve := btcec.S256()
+	x, y := curve.Add(a.PubKey().X, a.PubKey().Y, b.PubKey().X, b.PubKey().Y)
+	if ab.PublicKey().X.Cmp(x) == 0 && ab.PublicKey().Y.Cmp(y) == 0 {
+		t.Error("aggregate key is the sum of the keys")
+	}
+	rogueY := new(big.Int).Sub(curve.P, a.PubKey().Y)
+	bx, by := curve.ScalarBaseMult(bytes.Repeat([]byte{3}, 32))
+	rx, ry := curve.Add(bx, by, a.PubKey().X, rogueY)
+	rogue, err := AggregateKeys(a.PubKey(), &btcec.PublicKey{Curve: curve, X: rx, Y: ry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rogue.PublicKey().X.Cmp(bx) == 0 {
+		t.Error("rogue key controls the aggregate key")
+	}
+
+	if _, err := AggregateKeys(a.PubKey(), a.PubKey()); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("same keys: got %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestSessionSpend(t *testing.T) {
+	keyA, keyB := testKeys()
+	agg, _ := AggregateKeys(keyA.PubKey(), keyB.PubKey())
+	addr, err := agg.Address(&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, _ := bchutil.PayToAddrScript(addr)
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(99000, pkScript))
+	a, err := NewInputSession(keyA, keyB.PubKey(), tx, 0, 100000, sigHashAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewInputSession(keyB, keyA.PubKey(), tx, 0, 100000, sigHashAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigA, sigB := exchange(t, keyA, keyB, a, b)
+	if len(sigA) != 65 || !bytes.Equal(sigA, sigB) || sigA[64] != byte(sigHashAll) {
+		t.Fatalf("signatures %x and %x", sigA, sigB)
+	}
+
+	tx.TxIn[0].SignatureScript, _ = txscript.NewScriptBuilder().AddData(sigA).
+		AddData(agg.PublicKey().SerializeCompressed()).Script()
+	vm, err := bchutil.NewEngine(pkScript, tx, 0, bchutil.StandardScriptFlags, nil, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Execute(); err != nil {
+		t.Fatalf("aggregate signature rejected: %v", err)
+	}
+}
+
+func TestSessionMisuse(t *testing.T) {
+	keyA, keyB := testKeys()
+	sigHash := chainhash.DoubleHashB([]byte("message"))
+	newSessions := func() (*Session, *Session) {
+		a, err := NewSession(keyA, keyB.PubKey(), sigHash, sigHashAll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewSession(keyB, keyA.PubKey(), sigHash, sigHashAll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a, b
+	}
+
+	a, b := newSessions()
+	if _, err := a.Nonce(); !errors.Is(err, ErrInvalidRound) {
+		t.Errorf("nonce before commitment: got %v, want ErrInvalidRound", err)
+	}
+	if _, err := a.Sign(keyA); !errors.Is(err, ErrInvalidRound) {
+		t.Errorf("sign before nonces: got %v, want ErrInvalidRound", err)
+	}
+	if err := a.SetPeerCommitment(b.Commitment()); err != nil {
+		t.Fatal(err)
+	}
+	_, other := newSessions()
+	if err := a.SetPeerCommitment(other.Commitment()); !errors.Is(err, ErrCommitmentMismatch) {
+		t.Errorf("changed commitment: got %v, want ErrCommitmentMismatch", err)
+	}
+	b.SetPeerCommitment(a.Commitment())
+	if err := a.SetPeerNonce(other.noncePub); !errors.Is(err, ErrCommitmentMismatch) {
+		t.Errorf("uncommitted nonce: got %v, want ErrCommitmentMismatch", err)
+	}
+	nonceA, _ := a.Nonce()
+	nonceB, _ := b.Nonce()
+	a.SetPeerNonce(nonceB)
+	b.SetPeerNonce(nonceA)
+
+	// The nonce is not in the serialization: no session restored from a
+	// snapshot taken before signing signs, the first restore or the second.
+	snapshot := a.Serialize()
+	for i := 0; i < 2; i++ {
+		restored, err := ParseSession(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := restored.Sign(keyA); !errors.Is(err, ErrNonceReuse) {
+			t.Errorf("restore %d of an unsigned session: got %v, want ErrNonceReuse", i, err)
+		}
+	}
+	if bytes.Contains(snapshot, a.nonce.Bytes()) {
+		t.Error("secret nonce in the serialization")
+	}
+	if _, err := a.Sign(keyB); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("peer key: got %v, want ErrInvalidKey", err)
+	}
+	partialA, err := a.Sign(keyA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The nonce is gone once used, from the session and its serialization.
+	if _, err := a.Sign(keyA); !errors.Is(err, ErrNonceReuse) {
+		t.Errorf("second signature: got %v, want ErrNonceReuse", err)
+	}
+	parsed, err := ParseSession(a.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parsed.Sign(keyA); !errors.Is(err, ErrNonceReuse) {
+		t.Errorf("parsed signed session: got %v, want ErrNonceReuse", err)
+	}
+
+	if _, err := b.Combine(partialA); !errors.Is(err, ErrInvalidRound) {
+		t.Errorf("combine before signing: got %v, want ErrInvalidRound", err)
+	}
+	partialB, _ := b.Sign(keyB)
+	bad := append([]byte(nil), partialB...)
+	bad[31] ^= 1
+	if _, err := a.Combine(bad); !errors.Is(err, ErrInvalidPartialSig) {
+		t.Errorf("bad partial signature: got %v, want ErrInvalidPartialSig", err)
+	}
+	sig, err := parsed.Combine(partialB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bchutil.VerifySchnorr(a.AggregateKey().PublicKey(), sigHash, sig[:64]) {
+		t.Error("signature does not verify")
+	}
+
+	if _, err := NewSession(keyA, keyB.PubKey(), sigHash, txscript.SigHashAll); !errors.Is(err,
+		bchutil.ErrUnsupportedSigHashType) {
+		t.Errorf("no fork ID: got %v, want ErrUnsupportedSigHashType", err)
+	}
+}
+
+func TestSessionNonces(t *testing.T) {
+	keyA, keyB := testKeys()
+	sigHash := chainhash.DoubleHashB([]byte("message"))
+	a, _ := NewSession(keyA, keyB.PubKey(), sigHash, sigHashAll)
+	a2, _ := NewSession(keyA, keyB.PubKey(), sigHash, sigHashAll)
+	if bytes.Equal(a.Commitment(), a2.Commitment()) {
+		t.Error("sessions share their nonce")
+	}
+}
+
+func TestParseSessionInvalid(t *testing.T) {
+	keyA, keyB := testKeys()
+	a, _ := NewSession(keyA, keyB.PubKey(), make([]byte, 32), sigHashAll)
+	data := a.Serialize()
+	if _, err := ParseSession(data); err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range [][]byte{
+		nil,
+		data[:len(data)-1],
+		append(append([]byte(nil), data...), 0),
+		append([]byte("XXXX"), data[4:]...),
+		append(append([]byte(nil), data[:5]...), append([]byte{hasPartialSig}, data[6:]...)...),
+	} {
+		if _, err := ParseSession(data); !errors.Is(err, ErrInvalidSession) {
+			t.Errorf("test %d: got %v, want ErrInvalidSession", i, err)
+		}
+	}
+
+	// Serializations with a secret nonce are rejected.
+	withNonce := append(append([]byte(nil), data[:5]...), hasNonce)
+	withNonce = append(append(withNonce, data[6:]...), bytes.Repeat([]byte{1}, 32)...)
+	if _, err := ParseSession(withNonce); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("secret nonce: got %v, want ErrInvalidSession", err)
+	}
+}
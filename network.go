@@ -0,0 +1,235 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+// ErrNetworkMismatch describes an error where keys, addresses or
+// transactions of different networks are combined, such as a testnet address
+// paid by a transaction built for mainnet.
+var ErrNetworkMismatch = errors.New("network mismatch")
+
+// NetworkAware is implemented by what belongs to a network: the btcutil
+// addresses, those of this package included, WIF private keys and HD
+// extended keys.
+type NetworkAware interface {
+	IsForNet(net *chaincfg.Params) bool
+}
+
+// knownNetworks are the networks whose names errors give.
+var knownNetworks = []*chaincfg.Params{
+	&chaincfg.MainNetParams,
+	&chaincfg.TestNet3Params,
+	&chaincfg.RegressionNetParams,
+	&chaincfg.SimNetParams,
+}
+
+// networkParams returns the first known network of v, nil if none.  Testnet
+// and regtest WIF keys and legacy addresses are the same, and are given
+// testnet3.
+func networkParams(v NetworkAware) *chaincfg.Params {
+	for _, net := range knownNetworks {
+		if v.IsForNet(net) {
+			return net
+		}
+	}
+	return nil
+}
+
+// networkName returns the name of the first known network of v.
+func networkName(v NetworkAware) string {
+	if net := networkParams(v); net != nil {
+		return net.Name
+	}
+	return "unknown network"
+}
+
+// CheckNetwork returns an error wrapping ErrNetworkMismatch if v, described
+// by what, is not for the network of params.
+func CheckNetwork(params *chaincfg.Params, what string, v NetworkAware) error {
+	if !v.IsForNet(params) {
+		return fmt.Errorf("%w: %s for %s, want %s", ErrNetworkMismatch, what, networkName(v), params.Name)
+	}
+	return nil
+}
+
+// SameNetwork returns whether a and b are for one of the same known networks.
+func SameNetwork(a, b NetworkAware) bool {
+	for _, net := range knownNetworks {
+		if a.IsForNet(net) && b.IsForNet(net) {
+			return true
+		}
+	}
+	return false
+}
+
+// wifKey is a private key of the key database of NewWIFKeyDB.
+type wifKey struct {
+	key        *btcec.PrivateKey
+	compressed bool
+}
+
+// wifKeyDB is the key database of NewWIFKeyDB.  UnsignedTx.Sign checks its
+// WIF keys against the network signed for.
+type wifKeyDB struct {
+	wifs []*btcutil.WIF
+	keys map[string]wifKey
+}
+
+// NewWIFKeyDB returns the key database of the signing functions holding
+// wifs, which must be for the network of params, as the addresses of the
+// scripts signed are.  Each key is found by its pay-to-pubkey-hash and
+// pay-to-pubkey addresses, with the public key compressed as its WIF tells.
+func NewWIFKeyDB(params *chaincfg.Params, wifs ...*btcutil.WIF) (txscript.KeyDB, error) {
+	db, err := newWIFKeyDB(params, true, wifs)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// newWIFKeyDB returns the key database of wifs, checking their network if
+// check.
+func newWIFKeyDB(params *chaincfg.Params, check bool, wifs []*btcutil.WIF) (*wifKeyDB, error) {
+	db := &wifKeyDB{wifs: wifs, keys: make(map[string]wifKey)}
+	if check {
+		if err := db.checkNetwork(params); err != nil {
+			return nil, err
+		}
+	}
+	for _, wif := range wifs {
+		pubKey := wif.SerializePubKey()
+		k := wifKey{wif.PrivKey, wif.CompressPubKey}
+		db.keys[string(btcutil.Hash160(pubKey))] = k
+		db.keys[string(pubKey)] = k
+	}
+	return db, nil
+}
+
+// GetKey returns the key of addr, implementing txscript.KeyDB.
+func (db *wifKeyDB) GetKey(addr btcutil.Address) (*btcec.PrivateKey, bool, error) {
+	k, ok := db.keys[string(addr.ScriptAddress())]
+	if !ok {
+		return nil, false, fmt.Errorf("no key for address %s", addr)
+	}
+	return k.key, k.compressed, nil
+}
+
+// checkNetwork returns an error if a key of the database is not for the
+// network of params.
+func (db *wifKeyDB) checkNetwork(params *chaincfg.Params) error {
+	for i, wif := range db.wifs {
+		if err := CheckNetwork(params, fmt.Sprintf("WIF key %d", i), wif); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetNetwork makes the builder build transactions for the network of
+// params: AddPayment and SetChangeAddress fail with ErrNetworkMismatch for
+// addresses of other networks, and so do the transactions built when signed
+// for another network.  Without it, the network is that of the first address
+// given to AddPayment or SetChangeAddress.
+func (b *TxBuilder) SetNetwork(params *chaincfg.Params) {
+	b.params = params
+}
+
+// AllowNetworkMismatch disables the network checks of SetNetwork, for the
+// rare transactions that combine networks on purpose, such as those of test
+// networks sharing their address encodings.
+func (b *TxBuilder) AllowNetworkMismatch() {
+	b.allowNetworkMismatch = true
+}
+
+// checkNetwork returns an error if v is not for the network of the builder,
+// that of SetNetwork or else of the first address checked, which v becomes
+// without one.
+func (b *TxBuilder) checkNetwork(what string, v NetworkAware) error {
+	switch {
+	case b.allowNetworkMismatch:
+		return nil
+	case b.params != nil:
+		return CheckNetwork(b.params, what, v)
+	case b.firstAddr == nil:
+		b.firstAddr = v
+	case !SameNetwork(b.firstAddr, v):
+		return fmt.Errorf("%w: %s for %s, other addresses for %s", ErrNetworkMismatch, what, networkName(v),
+			networkName(b.firstAddr))
+	}
+	return nil
+}
+
+// AddPayment adds the output paying amount to addr, which must be for the
+// network of the builder.
+func (b *TxBuilder) AddPayment(addr btcutil.Address, amount btcutil.Amount) error {
+	if err := b.checkNetwork("address "+addr.String(), addr); err != nil {
+		return err
+	}
+	txOut, err := NewTxOut(amount, nil)
+	if err != nil {
+		return err
+	}
+	if txOut.PkScript, err = PayToAddrScript(addr); err != nil {
+		return err
+	}
+	b.AddOutput(txOut)
+	return nil
+}
+
+// SetChangeAddress sends the change to addr, which must be for the network
+// of the builder, instead of the change script of NewTxBuilder.
+func (b *TxBuilder) SetChangeAddress(addr btcutil.Address) error {
+	if err := b.checkNetwork("change address "+addr.String(), addr); err != nil {
+		return err
+	}
+	changeScript, err := PayToAddrScript(addr)
+	if err != nil {
+		return err
+	}
+	b.changeScript = changeScript
+	return nil
+}
+
+// checkNetwork returns an error if the transaction was built for a network
+// other than that of params, or if kdb holds WIF keys of another network.
+func (u *UnsignedTx) checkNetwork(params *chaincfg.Params, kdb txscript.KeyDB) error {
+	if u.allowNetworkMismatch || params == nil {
+		return nil
+	}
+	switch {
+	case u.Params != nil && params.Net != u.Params.Net:
+		return fmt.Errorf("%w: transaction for %s signed for %s", ErrNetworkMismatch, u.Params.Name, params.Name)
+	case u.Params == nil && u.firstAddr != nil && !u.firstAddr.IsForNet(params):
+		return fmt.Errorf("%w: transaction for %s signed for %s", ErrNetworkMismatch, networkName(u.firstAddr),
+			params.Name)
+	}
+	if db, ok := kdb.(*wifKeyDB); ok {
+		return db.checkNetwork(params)
+	}
+	return nil
+}
+
+// SignWithWIFs signs all inputs of the transaction as Sign does, for the
+// network of its builder, with the keys of wifs, which must be for that
+// network unless the builder allowed network mismatches.
+func (u *UnsignedTx) SignWithWIFs(wifs ...*btcutil.WIF) error {
+	params := u.Params
+	if params == nil && u.firstAddr != nil {
+		params = networkParams(u.firstAddr)
+	}
+	if params == nil {
+		return errors.New("no network, set by TxBuilder.SetNetwork or the addresses paid")
+	}
+	kdb, err := newWIFKeyDB(params, !u.allowNetworkMismatch, wifs)
+	if err != nil {
+		return err
+	}
+	return u.Sign(params, kdb, nil)
+}
@@ -0,0 +1,154 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestCheckNetwork(t *testing.T) {
+	key := signingTestKeys()[0]
+	wif, _ := btcutil.NewWIF(key, &chaincfg.TestNet3Params, true)
+	mainnet, _ := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.MainNetParams)
+	regtest, _ := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.RegressionNetParams)
+	xpub := electronCashTestKey(1)
+
+	if err := CheckNetwork(&chaincfg.MainNetParams, "address", mainnet); err != nil {
+		t.Error(err)
+	}
+	err := CheckNetwork(&chaincfg.MainNetParams, "WIF key", wif)
+	if !errors.Is(err, ErrNetworkMismatch) || err.Error() != "network mismatch: WIF key for testnet3, want mainnet" {
+		t.Errorf("got %v", err)
+	}
+	if err := CheckNetwork(&chaincfg.TestNet3Params, "xpub", xpub); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("got %v, want ErrNetworkMismatch", err)
+	}
+
+	// Testnet and regtest WIF keys are the same.
+	if !SameNetwork(wif, regtest) || SameNetwork(wif, mainnet) || !SameNetwork(xpub, mainnet) {
+		t.Error("wrong SameNetwork")
+	}
+}
+
+func TestTxBuilderNetwork(t *testing.T) {
+	key := signingTestKeys()[0]
+	mainnetWIF, _ := btcutil.NewWIF(key, &chaincfg.MainNetParams, true)
+	testnetWIF, _ := btcutil.NewWIF(key, &chaincfg.TestNet3Params, true)
+	from, _ := NewCashAddressPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()),
+		&chaincfg.MainNetParams)
+	fromScript, _ := PayToAddrScript(from)
+	to, _ := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.MainNetParams)
+	testnetTo, _ := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.TestNet3Params)
+
+	newBuilder := func() *TxBuilder {
+		b := NewTxBuilder(1000, fromScript)
+		b.SetNetwork(&chaincfg.MainNetParams)
+		b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 1e6, PkScript: fromScript})
+		return b
+	}
+
+	b := newBuilder()
+	if err := b.AddPayment(testnetTo, 50000); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("testnet payment: %v, want ErrNetworkMismatch", err)
+	}
+	if err := b.SetChangeAddress(testnetTo); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("testnet change: %v, want ErrNetworkMismatch", err)
+	}
+	if err := b.AddPayment(to, 50000); err != nil {
+		t.Fatal(err)
+	}
+	u, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Params != &chaincfg.MainNetParams || len(u.Tx.TxOut) != 2 {
+		t.Fatalf("network %v, %d outputs", u.Params, len(u.Tx.TxOut))
+	}
+	if err := u.SignWithWIFs(testnetWIF); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("testnet WIF: %v, want ErrNetworkMismatch", err)
+	}
+	kdb, _ := NewWIFKeyDB(&chaincfg.TestNet3Params, testnetWIF)
+	if err := u.Sign(&chaincfg.TestNet3Params, kdb, nil); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("signed for testnet: %v, want ErrNetworkMismatch", err)
+	}
+	if _, err := NewWIFKeyDB(&chaincfg.MainNetParams, testnetWIF); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("key database: %v, want ErrNetworkMismatch", err)
+	}
+	if err := u.SignWithWIFs(mainnetWIF); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := NewEngine(fromScript, u.Tx, 0, StandardScriptFlags, nil, 1e6)
+	if err == nil {
+		err = vm.Execute()
+	}
+	if err != nil {
+		t.Fatalf("signed input fails: %v", err)
+	}
+
+	// The override allows both.
+	b = newBuilder()
+	b.AllowNetworkMismatch()
+	if err := b.AddPayment(testnetTo, 50000); err != nil {
+		t.Fatal(err)
+	}
+	if u, err = b.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.SignWithWIFs(testnetWIF); err != nil {
+		t.Fatal(err)
+	}
+
+	// Builders without a network take that of the first address.
+	b = NewTxBuilder(1000, fromScript)
+	b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 1e6, PkScript: fromScript})
+	if err := b.AddPayment(testnetTo, 50000); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetChangeAddress(from); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("mainnet change: %v, want ErrNetworkMismatch", err)
+	}
+	b = NewTxBuilder(1000, fromScript)
+	b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 1e6, PkScript: fromScript})
+	if err := b.AddPayment(to, 50000); err != nil {
+		t.Fatal(err)
+	}
+	err = b.AddPayment(testnetTo, 50000)
+	if !errors.Is(err, ErrNetworkMismatch) ||
+		err.Error() != "network mismatch: address "+testnetTo.String()+" for testnet3, other addresses for mainnet" {
+		t.Errorf("testnet payment: %v", err)
+	}
+	if u, err = b.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Sign(&chaincfg.TestNet3Params, kdb, nil); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("signed for testnet: %v, want ErrNetworkMismatch", err)
+	}
+	if err := u.SignWithWIFs(testnetWIF); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("testnet WIF: %v, want ErrNetworkMismatch", err)
+	}
+	if err := u.SignWithWIFs(mainnetWIF); err != nil {
+		t.Fatal(err)
+	}
+
+	// Builders paying scripts only have no network, but the WIF keys of
+	// the key database are checked against that signed for.
+	b = NewTxBuilder(1000, fromScript)
+	b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 1e6, PkScript: fromScript})
+	b.AddOutput(wire.NewTxOut(50000, fromScript))
+	if u, err = b.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.SignWithWIFs(mainnetWIF); err == nil {
+		t.Error("signed without a network")
+	}
+	if err := u.Sign(&chaincfg.MainNetParams, kdb, nil); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("testnet keys signing for mainnet: %v, want ErrNetworkMismatch", err)
+	}
+	if err := u.Sign(&chaincfg.TestNet3Params, kdb, nil); err != nil {
+		t.Fatal(err)
+	}
+}
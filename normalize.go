@@ -0,0 +1,69 @@
+package bchutil
+
+import (
+	"fmt"
+
+	"github.com/Fabcien/bchutil/sig"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// NormalizeSignature returns derSig, a strict DER ECDSA signature followed by
+// its sighash type, with S in its low form as required by the LOW_S policy,
+// and whether S was changed.  Signatures that already have a low S are
+// returned unchanged.  Schnorr signatures have no such malleability and are
+// rejected like any other non-DER signature.
+func NormalizeSignature(derSig []byte) ([]byte, bool, error) {
+	if len(derSig) == SchnorrSignatureLen+1 {
+		return nil, false, fmt.Errorf("%w: Schnorr signature", ErrSigEncoding)
+	}
+	s, ok := parseSignaturePush(derSig)
+	if !ok {
+		return nil, false, fmt.Errorf("%w: not a strict DER signature", ErrSigEncoding)
+	}
+	if sig.IsLowS(s.ECDSA) {
+		return derSig, false, nil
+	}
+	return append(sig.SerializeDER(sig.NormalizeS(s.ECDSA)), byte(s.HashType)), true, nil
+}
+
+// NormalizeAllSignatures rewrites the scriptSigs of tx so that all their
+// ECDSA signatures have a low S, and returns the indexes of the inputs that
+// were changed.  Pushes that are not strict DER signatures, Schnorr
+// signatures included, are left untouched.  No scriptSig is changed if one of
+// them can't be parsed.
+func NormalizeAllSignatures(tx *wire.MsgTx) ([]int, error) {
+	scriptSigs := make(map[int][]byte)
+	var changed []int
+	for i, txIn := range tx.TxIn {
+		ops, err := parseScript(txIn.SignatureScript)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		modified := false
+		for j := range ops {
+			if sig, ok := parseSignaturePush(ops[j].data); !ok || sig.ECDSA == nil {
+				continue
+			}
+			normalized, ok, err := NormalizeSignature(ops[j].data)
+			if err != nil || !ok {
+				continue
+			}
+			raw, err := txscript.NewScriptBuilder().AddData(normalized).Script()
+			if err != nil {
+				return nil, fmt.Errorf("input %d: %w", i, err)
+			}
+			ops[j] = parsedOpcode{value: raw[0], data: normalized, raw: raw}
+			modified = true
+		}
+		if modified {
+			scriptSigs[i] = unparseScript(ops)
+			changed = append(changed, i)
+		}
+	}
+
+	for i, scriptSig := range scriptSigs {
+		tx.TxIn[i].SignatureScript = scriptSig
+	}
+	return changed, nil
+}
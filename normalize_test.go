@@ -0,0 +1,88 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// highSSignature returns sig, a low-S DER signature followed by a sighash
+// type, with S replaced by its high form.
+func highSSignature(t *testing.T, sig []byte) []byte {
+	parsed, err := btcec.ParseDERSignature(sig[:len(sig)-1], btcec.S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(n *big.Int) []byte {
+		b := n.Bytes()
+		if b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return append([]byte{0x02, byte(len(b))}, b...)
+	}
+	r := encode(parsed.R)
+	s := encode(new(big.Int).Sub(btcec.S256().N, parsed.S))
+	der := append([]byte{0x30, byte(len(r) + len(s))}, append(r, s...)...)
+	return append(der, sig[len(sig)-1])
+}
+
+func TestNormalizeSignature(t *testing.T) {
+	keys := signingTestKeys()
+	tx := engineTestTx(nil)
+	tx.AddTxIn(wire.NewTxIn(&tx.TxIn[0].PreviousOutPoint, nil, nil))
+	tx.TxIn[1].PreviousOutPoint.Index++
+	var pkScripts [][]byte
+	for i, key := range keys {
+		pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+		pkScripts = append(pkScripts, pkScript)
+		scriptSig, err := SignatureScript(tx, i, pkScript, txscript.SigHashAll|SigHashForkID, key, true, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TxIn[i].SignatureScript = scriptSig
+	}
+
+	pushes, _ := txscript.PushedData(tx.TxIn[1].SignatureScript)
+	lowS := pushes[0]
+	normalized, changed, err := NormalizeSignature(lowS)
+	if err != nil || changed || !bytes.Equal(normalized, lowS) {
+		t.Fatalf("low-S signature changed: %x, %v", normalized, err)
+	}
+	highS := highSSignature(t, lowS)
+	normalized, changed, err = NormalizeSignature(highS)
+	if err != nil || !changed || !bytes.Equal(normalized, lowS) {
+		t.Fatalf("got %x, %v, want %x", normalized, err, lowS)
+	}
+	schnorrSig := append(bytes.Repeat([]byte{0x11}, SchnorrSignatureLen), byte(txscript.SigHashAll))
+	if _, _, err := NormalizeSignature(schnorrSig); !errors.Is(err, ErrSigEncoding) {
+		t.Errorf("got %v for a Schnorr signature, want ErrSigEncoding", err)
+	}
+
+	signed := tx.Copy()
+	tx.TxIn[1].SignatureScript, _ = txscript.NewScriptBuilder().AddData(highS).
+		AddData(pushes[1]).Script()
+	vm, _ := NewEngine(pkScripts[1], tx, 1, StandardScriptFlags, nil, 1000)
+	if err := vm.Execute(); !errors.Is(err, ErrSigEncoding) {
+		t.Fatalf("high-S signature: got %v, want ErrSigEncoding", err)
+	}
+	changedInputs, err := NormalizeAllSignatures(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changedInputs, []int{1}) {
+		t.Errorf("got changed inputs %v, want [1]", changedInputs)
+	}
+	for i := range tx.TxIn {
+		if !bytes.Equal(tx.TxIn[i].SignatureScript, signed.TxIn[i].SignatureScript) {
+			t.Errorf("input %d: got scriptSig %x, want %x", i, tx.TxIn[i].SignatureScript,
+				signed.TxIn[i].SignatureScript)
+		}
+	}
+}
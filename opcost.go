@@ -0,0 +1,199 @@
+package bchutil
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Costs and limits of the May 2025 VM limits upgrade, for standard
+// transactions.
+const (
+	// baseInstructionCost is the cost of every instruction evaluated,
+	// executed or not.
+	baseInstructionCost = 100
+
+	// sigCheckCost is the cost of every signature check.
+	sigCheckCost = 26000
+
+	// hashDigestIterationCost is the cost of every iteration of the
+	// compression function of a hash.
+	hashDigestIterationCost = 192
+
+	// densityControlBaseLength is added to the length of the unlocking
+	// bytecode to compute the budgets of an input.
+	densityControlBaseLength = 41
+
+	// opCostBudgetPerByte is the operation cost budget of every byte of
+	// the density control length.
+	opCostBudgetPerByte = 800
+
+	// maxVMLimitsElementSize is the largest item that can be pushed to the
+	// stack.
+	maxVMLimitsElementSize = 10000
+
+	// bip143PreimageLen is the length of the BIP 143 signing serialization
+	// without its script code.
+	bip143PreimageLen = 156
+)
+
+// operationCost accumulates the costs of an execution that depend on the
+// data processed.
+type operationCost struct {
+	// pushedBytes counts the bytes pushed to the stack, by push opcodes and
+	// opcodes copying or computing items alike.
+	pushedBytes int
+
+	// hashIterations counts the iterations of the compression functions of
+	// the hashes computed by hashing and signature opcodes.
+	hashIterations int
+
+	// arithmetic is the product of the operand lengths of OP_MUL, OP_DIV
+	// and OP_MOD.
+	arithmetic int
+}
+
+// hashDigestIterations returns the iterations of the compression function of
+// a hash with 64 byte blocks of n bytes, followed by a second hash of the
+// digest if double is set.
+func hashDigestIterations(n int, double bool) int {
+	iterations := 1 + (n+8)/64
+	if double {
+		iterations++
+	}
+	return iterations
+}
+
+// CostContributor is the cost of the executions of an opcode.
+type CostContributor struct {
+	Opcode string
+	Count  int
+	Cost   int
+}
+
+// CostReport is the operation cost of an input, as defined by the May 2025 VM
+// limits upgrade.
+type CostReport struct {
+	// Cost is the operation cost of the input, the sum of the other costs,
+	// and Limit its budget.
+	Cost  int
+	Limit int
+
+	// HashIterations are the hash digest iterations executed, and
+	// HashIterationLimit their limit.
+	HashIterations     int
+	HashIterationLimit int
+
+	SigChecks int
+
+	// InstructionCost, PushCost, HashCost, SigCheckCost and ArithmeticCost
+	// are the costs of the instructions evaluated, the bytes pushed to the
+	// stack, the hash digest iterations, the signature checks and the
+	// operands of OP_MUL, OP_DIV and OP_MOD.
+	InstructionCost int
+	PushCost        int
+	HashCost        int
+	SigCheckCost    int
+	ArithmeticCost  int
+
+	// Contributors are the costs by opcode, most costly first.
+	Contributors []CostContributor
+}
+
+// WithinLimits returns whether the operation cost and hash digest iterations
+// fit the budget of the input.
+func (r *CostReport) WithinLimits() bool {
+	return r.Cost <= r.Limit && r.HashIterations <= r.HashIterationLimit
+}
+
+// EstimateOperationCost executes scriptSig and pkScript, spending input idx of
+// tx whose spent output is in prevOuts, and returns their operation cost as
+// defined by the May 2025 VM limits upgrade for standard transactions.  The
+// budgets of the input derive from the length of scriptSig: an operation cost
+// of 800 and half a hash digest iteration per byte, counting 41 more bytes.
+// Scripts are executed with StandardScriptFlags, but without the operation
+// count and 520 byte item limits the upgrade replaces, and signatures are
+// only hashed with the replay protected digest.
+//
+// A failing execution returns the report of the opcodes executed with its
+// error.
+func EstimateOperationCost(scriptSig, pkScript []byte, tx *wire.MsgTx, idx int,
+	prevOuts map[int]*wire.TxOut) (CostReport, error) {
+
+	var report CostReport
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return report, fmt.Errorf("input index %d out of range", idx)
+	}
+	prevOut := prevOuts[idx]
+	if prevOut == nil {
+		return report, fmt.Errorf("no previous output for input %d", idx)
+	}
+	densityLen := densityControlBaseLength + len(scriptSig)
+	report.Limit = densityLen * opCostBudgetPerByte
+	report.HashIterationLimit = densityLen / 2
+
+	tx = tx.Copy()
+	tx.TxIn[idx].SignatureScript = scriptSig
+	vm, err := NewEngine(pkScript, tx, idx, StandardScriptFlags, nil, prevOut.Value)
+	if err != nil {
+		return report, err
+	}
+	vm.vmLimits = true
+
+	byOpcode := make(map[string]*CostContributor)
+	for {
+		var opcode string
+		if vm.scriptIdx < len(vm.scripts) && vm.opIdx < len(vm.scripts[vm.scriptIdx]) {
+			opcode = opcodeNames[vm.scripts[vm.scriptIdx][vm.opIdx].value]
+		}
+		before, sigChecks := vm.cost, vm.sigChecks
+		done, err := vm.Step()
+
+		if opcode != "" {
+			cost := report.add(before, vm.cost, vm.sigChecks-sigChecks)
+			c := byOpcode[opcode]
+			if c == nil {
+				c = &CostContributor{Opcode: opcode}
+				byOpcode[opcode] = c
+			}
+			c.Count++
+			c.Cost += cost
+		}
+		if done {
+			for _, c := range byOpcode {
+				report.Contributors = append(report.Contributors, *c)
+			}
+			sort.Slice(report.Contributors, func(i, j int) bool {
+				ci, cj := report.Contributors[i], report.Contributors[j]
+				if ci.Cost != cj.Cost {
+					return ci.Cost > cj.Cost
+				}
+				return ci.Opcode < cj.Opcode
+			})
+			return report, err
+		}
+	}
+}
+
+// add adds the costs of an instruction, which changed the costs of the
+// engine from before to after and checked sigChecks signatures, and returns
+// its cost.
+func (r *CostReport) add(before, after operationCost, sigChecks int) int {
+	pushCost := after.pushedBytes - before.pushedBytes
+	hashIterations := after.hashIterations - before.hashIterations
+	hashCost := hashIterations * hashDigestIterationCost
+	arithmeticCost := after.arithmetic - before.arithmetic
+
+	r.InstructionCost += baseInstructionCost
+	r.PushCost += pushCost
+	r.HashIterations += hashIterations
+	r.HashCost += hashCost
+	r.SigChecks += sigChecks
+	r.SigCheckCost += sigChecks * sigCheckCost
+	r.ArithmeticCost += arithmeticCost
+
+	cost := baseInstructionCost + pushCost + hashCost + sigChecks*sigCheckCost + arithmeticCost
+	r.Cost += cost
+	return cost
+}
@@ -0,0 +1,86 @@
+package bchutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestEstimateOperationCost(t *testing.T) {
+	keys := signingTestKeys()
+	pubKey := keys[0].PubKey().SerializeCompressed()
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(pubKey))
+	tx := engineTestTx(nil)
+	prevOuts := map[int]*wire.TxOut{0: wire.NewTxOut(1000, p2pkh)}
+	scriptSig, err := SignatureScript(tx, 0, p2pkh, txscript.SigHashAll|SigHashForkID, keys[0], true, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigLen := len(scriptSig) - 1 - 34
+
+	report, err := EstimateOperationCost(scriptSig, p2pkh, tx, 0, prevOuts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The hash of the public key and the signing serialization, with a
+	// 25 byte script code, hashed twice.
+	wantIterations := 2 + 4
+	want := CostReport{
+		Limit:              (41 + len(scriptSig)) * 800,
+		HashIterations:     wantIterations,
+		HashIterationLimit: (41 + len(scriptSig)) / 2,
+		SigChecks:          1,
+		InstructionCost:    700,
+		PushCost:           sigLen + 33 + 33 + 20 + 20 + 1,
+		HashCost:           wantIterations * 192,
+		SigCheckCost:       26000,
+	}
+	want.Cost = want.InstructionCost + want.PushCost + want.HashCost + want.SigCheckCost
+	report.Contributors = nil
+	if report.Cost != want.Cost || report.Limit != want.Limit || report.HashIterations != want.HashIterations ||
+		report.HashIterationLimit != want.HashIterationLimit || report.SigChecks != want.SigChecks ||
+		report.PushCost != want.PushCost || report.InstructionCost != want.InstructionCost ||
+		report.HashCost != want.HashCost || report.SigCheckCost != want.SigCheckCost {
+		t.Errorf("got %+v, want %+v", report, want)
+	}
+	if !report.WithinLimits() {
+		t.Error("P2PKH spend exceeds the limits")
+	}
+
+	report, _ = EstimateOperationCost(scriptSig, p2pkh, tx, 0, prevOuts)
+	if top := report.Contributors[0]; top.Opcode != "OP_CHECKSIG" || top.Count != 1 {
+		t.Errorf("got top contributor %+v", top)
+	}
+
+	// More than 201 operations are allowed, within the budget.
+	nops, _ := ParseASM(strings.Repeat("OP_NOP ", 300) + "1")
+	report, err = EstimateOperationCost(nil, nops, tx, 0, prevOuts)
+	if err != nil || !report.WithinLimits() || report.Cost != 301*100+1 {
+		t.Errorf("got %+v, %v", report, err)
+	}
+
+	// Hashing is limited to half an iteration per byte.
+	hashes, _ := ParseASM("1" + strings.Repeat(" OP_SHA256", 21))
+	report, err = EstimateOperationCost(nil, hashes, tx, 0, prevOuts)
+	if err != nil || report.WithinLimits() || report.HashIterations != 21 {
+		t.Errorf("got %+v, %v", report, err)
+	}
+	if _, err := EstimateOperationCost([]byte{txscript.OP_1, txscript.OP_DROP}, hashes, tx, 0,
+		prevOuts); err != ErrNotPushOnly {
+		t.Errorf("got %v, want ErrNotPushOnly", err)
+	}
+
+	// Arithmetic costs the product of the operand lengths.
+	mul, _ := ParseASM("0x102030 0x0102 OP_MUL OP_DROP 1")
+	report, err = EstimateOperationCost(nil, mul, tx, 0, prevOuts)
+	if err != nil || report.ArithmeticCost != 6 {
+		t.Errorf("got %+v, %v", report, err)
+	}
+
+	if _, err := EstimateOperationCost(nil, mul, tx, 0, nil); err == nil {
+		t.Error("estimated without previous output")
+	}
+}
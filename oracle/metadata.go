@@ -0,0 +1,108 @@
+package oracle
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// MetadataType is the type of the content of a metadata message, a negative
+// number taking the place of the price sequence of price messages.
+type MetadataType int32
+
+// Metadata types, as oracles.cash numbers them: those of the oracle from -1
+// and those of its price source from -51.
+const (
+	OperatorName              MetadataType = -1
+	OperatorWebsite           MetadataType = -2
+	RelayServer               MetadataType = -3
+	StartingTimestamp         MetadataType = -4
+	EndingTimestamp           MetadataType = -5
+	AttestationScaling        MetadataType = -6
+	AttestationPeriod         MetadataType = -7
+	OperatorHash              MetadataType = -8
+	SourceName                MetadataType = -51
+	SourceWebsite             MetadataType = -52
+	SourceNumeratorUnitName   MetadataType = -53
+	SourceNumeratorUnitCode   MetadataType = -54
+	SourceDenominatorUnitName MetadataType = -55
+	SourceDenominatorUnitCode MetadataType = -56
+)
+
+// MetadataMessage is a message of an oracle announcing metadata, such as
+// the scaling of its prices.
+type MetadataMessage struct {
+	// Timestamp and MessageSequence are those of PriceMessage.
+	Timestamp       uint32
+	MessageSequence int32
+
+	Type MetadataType
+
+	// Content is the UTF-8 text of the metadata, numbers included.
+	Content string
+}
+
+// BuildMetadataMessage returns the message of m.
+func BuildMetadataMessage(m *MetadataMessage) []byte {
+	msg := make([]byte, headerLen+4, headerLen+4+len(m.Content))
+	binary.LittleEndian.PutUint32(msg[0:], m.Timestamp)
+	binary.LittleEndian.PutUint32(msg[4:], uint32(m.MessageSequence))
+	binary.LittleEndian.PutUint32(msg[8:], uint32(m.Type))
+	return append(msg, m.Content...)
+}
+
+// ParseMetadataMessage parses the metadata message msg, whose message
+// sequence must be positive, type negative and content UTF-8, or fails with
+// ErrInvalidMessage.
+func ParseMetadataMessage(msg []byte) (*MetadataMessage, error) {
+	if len(msg) < headerLen+4 {
+		return nil, fmt.Errorf("%w: metadata message of %d bytes, want at least %d", ErrInvalidMessage,
+			len(msg), headerLen+4)
+	}
+	m := &MetadataMessage{
+		Timestamp:       binary.LittleEndian.Uint32(msg[0:]),
+		MessageSequence: int32(binary.LittleEndian.Uint32(msg[4:])),
+		Type:            MetadataType(binary.LittleEndian.Uint32(msg[8:])),
+		Content:         string(msg[headerLen+4:]),
+	}
+	switch {
+	case m.MessageSequence <= 0:
+		return nil, fmt.Errorf("%w: message sequence %d", ErrInvalidMessage, m.MessageSequence)
+	case m.Type >= 0:
+		return nil, fmt.Errorf("%w: metadata type %d", ErrInvalidMessage, m.Type)
+	case !utf8.ValidString(m.Content):
+		return nil, fmt.Errorf("%w: content is not UTF-8", ErrInvalidMessage)
+	}
+	return m, nil
+}
+
+// NewScaleMessage returns the metadata message of sequence seq at timestamp
+// announcing that the prices of the oracle are multiplied by scale.
+func NewScaleMessage(timestamp uint32, seq int32, scale uint32) *MetadataMessage {
+	return &MetadataMessage{
+		Timestamp:       timestamp,
+		MessageSequence: seq,
+		Type:            AttestationScaling,
+		Content:         strconv.FormatUint(uint64(scale), 10),
+	}
+}
+
+// Scale returns the scaling of an AttestationScaling message, a positive
+// decimal number, or fails with ErrInvalidMessage.
+func (m *MetadataMessage) Scale() (uint32, error) {
+	if m.Type != AttestationScaling {
+		return 0, fmt.Errorf("%w: metadata type %d is not the attestation scaling", ErrInvalidMessage, m.Type)
+	}
+	scale, err := strconv.ParseUint(m.Content, 10, 32)
+	if err != nil || scale == 0 {
+		return 0, fmt.Errorf("%w: attestation scaling %q", ErrInvalidMessage, m.Content)
+	}
+	return uint32(scale), nil
+}
+
+// ScaledPrice returns the price of m divided by scale, the attestation
+// scaling of its oracle.
+func ScaledPrice(m *PriceMessage, scale uint32) float64 {
+	return float64(m.Price) / float64(scale)
+}
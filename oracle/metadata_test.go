@@ -0,0 +1,53 @@
+package oracle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMetadataMessage(t *testing.T) {
+	m := NewScaleMessage(1650000000, 7, 100)
+	msg := BuildMetadataMessage(m)
+	if len(msg) != 15 || msg[8] != 0xfa || msg[11] != 0xff || string(msg[12:]) != "100" {
+		t.Fatalf("message %x", msg)
+	}
+	parsed, err := ParseMetadataMessage(msg)
+	if err != nil || *parsed != *m {
+		t.Fatalf("got %+v, %v", parsed, err)
+	}
+	if scale, err := parsed.Scale(); err != nil || scale != 100 {
+		t.Errorf("scale %d, %v", scale, err)
+	}
+	if price := ScaledPrice(&PriceMessage{Price: 29815}, 100); price != 298.15 {
+		t.Errorf("price %v", price)
+	}
+
+	name := &MetadataMessage{Timestamp: 1650000000, MessageSequence: 8, Type: OperatorName,
+		Content: "General Protocols"}
+	if parsed, err := ParseMetadataMessage(BuildMetadataMessage(name)); err != nil || *parsed != *name {
+		t.Errorf("got %+v, %v", parsed, err)
+	}
+	if _, err := name.Scale(); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("scale of a name: %v, want ErrInvalidMessage", err)
+	}
+
+	tests := []*MetadataMessage{
+		{MessageSequence: 0, Type: OperatorName},
+		{MessageSequence: 1, Type: 5},
+		{MessageSequence: 1, Type: OperatorName, Content: "\xff"},
+	}
+	for i, test := range tests {
+		if _, err := ParseMetadataMessage(BuildMetadataMessage(test)); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("%d: got %v, want ErrInvalidMessage", i, err)
+		}
+	}
+	if _, err := ParseMetadataMessage(msg[:11]); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("truncated: got %v, want ErrInvalidMessage", err)
+	}
+	for _, content := range []string{"0", "-1", "1.5", ""} {
+		m.Content = content
+		if _, err := m.Scale(); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("scale %q: got %v, want ErrInvalidMessage", content, err)
+		}
+	}
+}
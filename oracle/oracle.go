@@ -0,0 +1,138 @@
+// Package oracle builds, parses, signs and verifies the messages of price
+// oracles in the oracles.cash format, which AnyHedge contracts and others
+// check on chain with OP_CHECKDATASIG.
+//
+// Every message starts with its timestamp, in seconds since the Unix epoch,
+// and its sequence number among the messages of the oracle, both as 4 byte
+// little-endian integers.  Price messages follow them with the sequence
+// number of the price among the prices of the oracle and the price, scaled
+// by the attestation scaling of the oracle, also as 4 byte little-endian
+// integers.  Metadata messages instead follow them with the negative type of
+// the metadata and its content.  The oracle signs the SHA-256 of the message,
+// as OP_CHECKDATASIG verifies it.
+package oracle
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/Fabcien/bchutil/sig"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// PriceMessageLen is the length of price messages.
+const PriceMessageLen = 16
+
+// headerLen is the length of the timestamp and message sequence starting
+// every message.
+const headerLen = 8
+
+var (
+	// ErrInvalidMessage describes an error where a message is not in the
+	// oracles.cash format.
+	ErrInvalidMessage = errors.New("invalid oracle message")
+
+	// ErrNotPriceMessage describes an error where a message is a metadata
+	// message, parsed as a price message.
+	ErrNotPriceMessage = errors.New("not a price message")
+
+	// ErrInvalidSignature describes an error where a message is not signed
+	// by the oracle.
+	ErrInvalidSignature = errors.New("invalid oracle signature")
+)
+
+// PriceMessage is a price attested by an oracle.
+type PriceMessage struct {
+	// Timestamp is the time of the message, in seconds since the Unix
+	// epoch.
+	Timestamp uint32
+
+	// MessageSequence is the sequence number of the message among all the
+	// messages of the oracle, and PriceSequence that of the price among
+	// its prices, both starting at 1.
+	MessageSequence int32
+	PriceSequence   int32
+
+	// Price is the price, multiplied by the attestation scaling of the
+	// oracle.
+	Price int32
+}
+
+// BuildPriceMessage returns the message of m.
+func BuildPriceMessage(m *PriceMessage) []byte {
+	msg := make([]byte, PriceMessageLen)
+	binary.LittleEndian.PutUint32(msg[0:], m.Timestamp)
+	binary.LittleEndian.PutUint32(msg[4:], uint32(m.MessageSequence))
+	binary.LittleEndian.PutUint32(msg[8:], uint32(m.PriceSequence))
+	binary.LittleEndian.PutUint32(msg[12:], uint32(m.Price))
+	return msg
+}
+
+// ParsePriceMessage parses the price message msg, which must be
+// PriceMessageLen bytes long, with positive sequences and price, and a price
+// sequence not exceeding the message sequence, as every price is a message.
+// Metadata messages fail with ErrNotPriceMessage and other invalid messages
+// with ErrInvalidMessage.
+func ParsePriceMessage(msg []byte) (*PriceMessage, error) {
+	if len(msg) >= headerLen+4 && int32(binary.LittleEndian.Uint32(msg[8:])) < 0 {
+		return nil, fmt.Errorf("%w: metadata type %d", ErrNotPriceMessage,
+			int32(binary.LittleEndian.Uint32(msg[8:])))
+	}
+	if len(msg) != PriceMessageLen {
+		return nil, fmt.Errorf("%w: price message of %d bytes, want %d", ErrInvalidMessage, len(msg),
+			PriceMessageLen)
+	}
+	m := &PriceMessage{
+		Timestamp:       binary.LittleEndian.Uint32(msg[0:]),
+		MessageSequence: int32(binary.LittleEndian.Uint32(msg[4:])),
+		PriceSequence:   int32(binary.LittleEndian.Uint32(msg[8:])),
+		Price:           int32(binary.LittleEndian.Uint32(msg[12:])),
+	}
+	switch {
+	case m.MessageSequence <= 0:
+		return nil, fmt.Errorf("%w: message sequence %d", ErrInvalidMessage, m.MessageSequence)
+	case m.PriceSequence == 0:
+		return nil, fmt.Errorf("%w: price sequence 0", ErrInvalidMessage)
+	case m.PriceSequence > m.MessageSequence:
+		return nil, fmt.Errorf("%w: price sequence %d after message sequence %d", ErrInvalidMessage,
+			m.PriceSequence, m.MessageSequence)
+	case m.Price <= 0:
+		return nil, fmt.Errorf("%w: price %d", ErrInvalidMessage, m.Price)
+	}
+	return m, nil
+}
+
+// SignOracleMessage returns the 64 byte Schnorr signature of msg by key, that
+// of its SHA-256 as OP_CHECKDATASIG verifies it.
+func SignOracleMessage(key *btcec.PrivateKey, msg []byte) ([]byte, error) {
+	hash := sha256.Sum256(msg)
+	return bchutil.SignSchnorr(key, hash[:])
+}
+
+// VerifyOracleMessage returns an error wrapping ErrInvalidSignature unless
+// signature is a signature of msg by pubKey that OP_CHECKDATASIG accepts
+// under the standard rules: a 64 byte Schnorr signature, or a strict DER
+// ECDSA signature with a low S value, of the SHA-256 of msg.
+func VerifyOracleMessage(pubKey *btcec.PublicKey, signature, msg []byte) error {
+	hash := sha256.Sum256(msg)
+	if len(signature) == bchutil.SchnorrSignatureLen {
+		if !bchutil.VerifySchnorr(pubKey, hash[:], signature) {
+			return fmt.Errorf("%w: Schnorr signature does not verify", ErrInvalidSignature)
+		}
+		return nil
+	}
+	s, err := sig.ParseDERSignature(signature, true)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	if !sig.IsLowS(s) {
+		return fmt.Errorf("%w: high S value", ErrInvalidSignature)
+	}
+	if !s.Verify(hash[:], pubKey) {
+		return fmt.Errorf("%w: ECDSA signature does not verify", ErrInvalidSignature)
+	}
+	return nil
+}
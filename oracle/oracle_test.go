@@ -0,0 +1,147 @@
+package oracle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/Fabcien/bchutil/sig"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestPriceMessage(t *testing.T) {
+	m := &PriceMessage{Timestamp: 1650000000, MessageSequence: 1000, PriceSequence: 900, Price: 29815}
+	msg := BuildPriceMessage(m)
+	if want := "80005962e80300008403000077740000"; hex.EncodeToString(msg) != want {
+		t.Fatalf("message %x, want %s", msg, want)
+	}
+	parsed, err := ParsePriceMessage(msg)
+	if err != nil || *parsed != *m {
+		t.Fatalf("got %+v, %v", parsed, err)
+	}
+
+	tests := []struct {
+		msg  []byte
+		want error
+	}{
+		{msg[:15], ErrInvalidMessage},
+		{append(msg, 0), ErrInvalidMessage},
+		{BuildPriceMessage(&PriceMessage{MessageSequence: 0, PriceSequence: 1, Price: 1}), ErrInvalidMessage},
+		{BuildPriceMessage(&PriceMessage{MessageSequence: 1, PriceSequence: 0, Price: 1}), ErrInvalidMessage},
+		{BuildPriceMessage(&PriceMessage{MessageSequence: 1, PriceSequence: 2, Price: 1}), ErrInvalidMessage},
+		{BuildPriceMessage(&PriceMessage{MessageSequence: 2, PriceSequence: 1, Price: 0}), ErrInvalidMessage},
+		{BuildPriceMessage(&PriceMessage{MessageSequence: 2, PriceSequence: 1, Price: -5}), ErrInvalidMessage},
+		{BuildMetadataMessage(NewScaleMessage(1650000000, 1, 100)), ErrNotPriceMessage},
+	}
+	for i, test := range tests {
+		if _, err := ParsePriceMessage(test.msg); !errors.Is(err, test.want) {
+			t.Errorf("%d: got %v, want %v", i, err, test.want)
+		}
+	}
+}
+
+func TestSignOracleMessage(t *testing.T) {
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{1}, 32))
+	other, _ := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{2}, 32))
+	msg := BuildPriceMessage(&PriceMessage{Timestamp: 1650000000, MessageSequence: 2, PriceSequence: 1,
+		Price: 29815})
+
+	schnorr, err := SignOracleMessage(key, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := chainhash.HashB(msg)
+	ecdsa, _ := key.Sign(hash)
+	for _, signature := range [][]byte{schnorr, ecdsa.Serialize()} {
+		if err := VerifyOracleMessage(key.PubKey(), signature, msg); err != nil {
+			t.Errorf("%x: %v", signature, err)
+		}
+		if err := VerifyOracleMessage(other.PubKey(), signature, msg); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("other key: %v, want ErrInvalidSignature", err)
+		}
+		if err := VerifyOracleMessage(key.PubKey(), signature, msg[1:]); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("other message: %v, want ErrInvalidSignature", err)
+		}
+
+		// OP_CHECKDATASIG accepts the signature of the message.
+		scriptSig, _ := bchutil.NewScriptBuilder().AddData(signature).AddData(msg).Script()
+		pkScript, _ := bchutil.NewScriptBuilder().AddData(key.PubKey().SerializeCompressed()).
+			AddOpName("OP_CHECKDATASIG").Script()
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, scriptSig, nil))
+		tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+		vm, err := bchutil.NewEngine(pkScript, tx, 0, bchutil.StandardScriptFlags, nil, 1000)
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			t.Errorf("%x: OP_CHECKDATASIG fails: %v", signature, err)
+		}
+	}
+
+	// Signatures with a high S value are not standard.
+	highS := sig.SerializeDER(&btcec.Signature{R: ecdsa.R, S: new(big.Int).Sub(btcec.S256().N, ecdsa.S)})
+	if err := VerifyOracleMessage(key.PubKey(), highS, msg); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("high S: %v, want ErrInvalidSignature", err)
+	}
+}
+
+// feedMessage is a message of an oracles.cash feed, as its relay serves them
+// in hex.
+type feedMessage struct {
+	PublicKey string `json:"publicKey"`
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+// TestOraclesCashFeeds verifies the messages of the public oracles.cash feeds
+// saved in testdata, JSON arrays of feedMessage.  Each message must parse as
+// a price or metadata message and its signature verify, but not for another
+// message.
+func TestOraclesCashFeeds(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if len(files) == 0 {
+		t.Skip("no oracles.cash feed message in testdata")
+	}
+	for _, name := range files {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var feed []feedMessage
+		if err := json.Unmarshal(raw, &feed); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for i, m := range feed {
+			pubKeyBytes, _ := hex.DecodeString(m.PublicKey)
+			msg, _ := hex.DecodeString(m.Message)
+			signature, _ := hex.DecodeString(m.Signature)
+			pubKey, err := btcec.ParsePubKey(pubKeyBytes, btcec.S256())
+			if err != nil {
+				t.Fatalf("%s: message %d: %v", name, i, err)
+			}
+			if _, err := ParsePriceMessage(msg); errors.Is(err, ErrNotPriceMessage) {
+				_, err = ParseMetadataMessage(msg)
+			}
+			if err != nil {
+				t.Errorf("%s: message %d: %v", name, i, err)
+			}
+			if err := VerifyOracleMessage(pubKey, signature, msg); err != nil {
+				t.Errorf("%s: message %d: %v", name, i, err)
+			}
+			msg[0] ^= 1
+			if err := VerifyOracleMessage(pubKey, signature, msg); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("%s: message %d changed: %v, want ErrInvalidSignature", name, i, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+const (
+	// BIP44Purpose is the BIP43 purpose of BIP44 derivation.
+	BIP44Purpose = 44
+
+	// CoinTypeBCH is the SLIP44 coin type of Bitcoin Cash.
+	CoinTypeBCH = 145
+)
+
+// ErrInvalidPath describes an error where a derivation path string is
+// malformed or has an index out of range.
+var ErrInvalidPath = errors.New("invalid derivation path")
+
+// Path is a BIP32 derivation path.  Hardened indexes include
+// hdkeychain.HardenedKeyStart.
+type Path []uint32
+
+// ParseDerivationPath parses a path such as "m/44'/145'/0'/0/12".  Hardened
+// components are marked with ' or h, and the leading "m/" is optional.
+// Components must be below 2^31; larger indexes can only be expressed with a
+// hardened marker.
+func ParseDerivationPath(s string) (Path, error) {
+	if s == "m" || s == "" {
+		return Path{}, nil
+	}
+	s = strings.TrimPrefix(s, "m/")
+
+	elems := strings.Split(s, "/")
+	path := make(Path, 0, len(elems))
+	for _, elem := range elems {
+		hardened := strings.HasSuffix(elem, "'") || strings.HasSuffix(elem, "h")
+		if hardened {
+			elem = elem[:len(elem)-1]
+		}
+		// ParseUint accepts a leading '+', which isn't part of the syntax.
+		if elem == "" || elem[0] < '0' || elem[0] > '9' {
+			return nil, fmt.Errorf("%w: invalid component %q", ErrInvalidPath, elem)
+		}
+		i, err := strconv.ParseUint(elem, 10, 32)
+		if err != nil || i >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("%w: invalid component %q", ErrInvalidPath, elem)
+		}
+		if hardened {
+			i += hdkeychain.HardenedKeyStart
+		}
+		path = append(path, uint32(i))
+	}
+	return path, nil
+}
+
+// BIP44Path returns the m/44'/145'/account'/change/index path of a Bitcoin
+// Cash address.
+func BIP44Path(account, change, index uint32) Path {
+	return Path{
+		hdkeychain.HardenedKeyStart + BIP44Purpose,
+		hdkeychain.HardenedKeyStart + CoinTypeBCH,
+		hdkeychain.HardenedKeyStart + account,
+		change,
+		index,
+	}
+}
+
+// String returns the path in the format parsed by ParseDerivationPath, with
+// ' as the hardened marker.
+func (p Path) String() string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, i := range p {
+		b.WriteByte('/')
+		if i >= hdkeychain.HardenedKeyStart {
+			b.WriteString(strconv.FormatUint(uint64(i-hdkeychain.HardenedKeyStart), 10))
+			b.WriteByte('\'')
+		} else {
+			b.WriteString(strconv.FormatUint(uint64(i), 10))
+		}
+	}
+	return b.String()
+}
+
+// Extend returns a new path made of p followed by indexes.  p is not
+// modified.
+func (p Path) Extend(indexes ...uint32) Path {
+	path := make(Path, 0, len(p)+len(indexes))
+	path = append(path, p...)
+	return append(path, indexes...)
+}
+
+// IsHardened returns whether any component of the path is hardened, in which
+// case it can only be derived from a private key.
+func (p Path) IsHardened() bool {
+	for _, i := range p {
+		if i >= hdkeychain.HardenedKeyStart {
+			return true
+		}
+	}
+	return false
+}
+
+// Derive walks the path from key.
+func (p Path) Derive(key *hdkeychain.ExtendedKey) (*hdkeychain.ExtendedKey, error) {
+	for _, i := range p {
+		var err error
+		key, err = key.Child(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,71 @@
+package bchutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+func TestParseDerivationPath(t *testing.T) {
+	const h = hdkeychain.HardenedKeyStart
+	valid := []struct {
+		path string
+		want Path
+		str  string
+	}{
+		{"m/44'/145'/0'/0/12", Path{h + 44, h + 145, h, 0, 12}, "m/44'/145'/0'/0/12"},
+		{"44h/145h/0h/1/0", Path{h + 44, h + 145, h, 1, 0}, "m/44'/145'/0'/1/0"},
+		{"m/2147483647'", Path{h + h - 1}, "m/2147483647'"},
+		{"m", Path{}, "m"},
+		{"0", Path{0}, "m/0"},
+	}
+	for _, test := range valid {
+		path, err := ParseDerivationPath(test.path)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(path, test.want) {
+			t.Errorf("%s: parsed %v, want %v", test.path, []uint32(path), []uint32(test.want))
+		}
+		if path.String() != test.str {
+			t.Errorf("%s: String() = %s, want %s", test.path, path, test.str)
+		}
+	}
+
+	invalid := []string{"m/", "m/2147483648'", "m/2147483648", "m/-1", "m/+1", "m/1''", "m/a", "m//1", "m/1/", "n/1", "m/1 "}
+	for _, path := range invalid {
+		if _, err := ParseDerivationPath(path); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%q: expected ErrInvalidPath, got %v", path, err)
+		}
+	}
+}
+
+func TestPathExtend(t *testing.T) {
+	account := BIP44Path(0, 0, 0)[:3]
+	external := account.Extend(0)
+	if external.String() != "m/44'/145'/0'/0" {
+		t.Errorf("extended path is %s", external)
+	}
+	if len(account) != 3 {
+		t.Error("Extend modified the path")
+	}
+
+	master := descTestKey()
+	key, err := BIP44Path(0, 1, 5).Derive(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountKey, _ := account.Derive(master)
+	xpub, _ := accountKey.Neuter()
+	want, _ := Path{1, 5}.Derive(xpub)
+	if key.String() == want.String() {
+		t.Error("Derive returned a public key for a private master")
+	}
+	keyPub, _ := key.Neuter()
+	if keyPub.String() != want.String() {
+		t.Error("private and public derivation disagree")
+	}
+}
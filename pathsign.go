@@ -0,0 +1,213 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// ErrKeyNotInScript describes an error where the key derived for an input is
+// not the key its previous output pays to, usually because of a wrong path.
+var ErrKeyNotInScript = errors.New("derived key does not match the previous output script")
+
+// SignInputWithPath derives the key at path from accountKey, checks that
+// prevOut pays to it with a pay-to-pubkey-hash or pay-to-pubkey script, and
+// returns the scriptSig spending input idx of tx.  The signature commits to
+// the tokens of prevOut, if any.  The derived private key is wiped before
+// returning.
+func SignInputWithPath(tx *wire.MsgTx, idx int, prevOut *wire.TxOut, hashType txscript.SigHashType,
+	accountKey *hdkeychain.ExtendedKey, path Path, opts ...SignOption) ([]byte, error) {
+
+	o := newSignOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	sig, pubKey, isP2PK, err := signInputWithPath(tx, idx, prevOut, hashType, accountKey, path, o)
+	if err != nil {
+		return nil, err
+	}
+	return pathScriptSig(sig, pubKey, isP2PK)
+}
+
+// pathScriptSig returns the scriptSig of a signature by pubKey, spending a
+// pay-to-pubkey output if isP2PK is set and a pay-to-pubkey-hash one
+// otherwise.
+func pathScriptSig(sig, pubKey []byte, isP2PK bool) ([]byte, error) {
+	builder := txscript.NewScriptBuilder().AddData(sig)
+	if !isP2PK {
+		builder.AddData(pubKey)
+	}
+	return builder.Script()
+}
+
+// signInputWithPath returns the signature of input idx of tx by the key at
+// path, with its compressed public key and whether prevOut is pay-to-pubkey.
+// The tokens of prevOut take precedence over the ones of o.
+func signInputWithPath(tx *wire.MsgTx, idx int, prevOut *wire.TxOut, hashType txscript.SigHashType,
+	accountKey *hdkeychain.ExtendedKey, path Path, o signOptions) (sig, pubKey []byte, isP2PK bool, err error) {
+
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, nil, false, fmt.Errorf("input index %d out of range", idx)
+	}
+	key, err := path.Derive(accountKey)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	priv, err := key.ECPrivKey()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer zeroScalar(priv.D)
+
+	token, pkScript, err := SplitTokenPrefix(prevOut.PkScript)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("input %d: %w", idx, err)
+	}
+	if token != nil {
+		o.token = token
+	}
+	pubKey = priv.PubKey().SerializeCompressed()
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(pubKey))
+	p2pk, _ := txscript.NewScriptBuilder().AddData(pubKey).AddOp(txscript.OP_CHECKSIG).Script()
+	isP2PK = bytes.Equal(pkScript, p2pk)
+	if !isP2PK && !bytes.Equal(pkScript, p2pkh) {
+		return nil, nil, false, fmt.Errorf("input %d, path %v: %w", idx, path, ErrKeyNotInScript)
+	}
+
+	sig, err = o.signInput(tx, idx, pkScript, hashType, priv, prevOut.Value)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return sig, pubKey, isP2PK, nil
+}
+
+// SignInputsWithPaths signs the inputs of tx listed in paths with the keys
+// derived from accountKey, setting their scriptSigs.  prevOuts holds the
+// outputs spent by those inputs.  Inputs are signed with hashType unless
+// hashTypes, which may be nil, overrides it.  Nothing is modified if any input
+// fails.  With WithFeeLimits, prevOuts must hold the outputs spent by all
+// inputs to check the fee.  When it does, transactions destroying the tokens
+// of the spent outputs are refused unless allowed by AllowTokenBurn.
+func SignInputsWithPaths(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut, hashType txscript.SigHashType,
+	hashTypes map[int]txscript.SigHashType, accountKey *hdkeychain.ExtendedKey, paths map[int]Path,
+	opts ...SignOption) error {
+
+	o := newSignOptions(opts)
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if err := o.checkFee(tx, prevOuts); err != nil {
+		return err
+	}
+	if err := o.checkPrevOuts(tx, prevOuts); err != nil {
+		return err
+	}
+	if err := o.checkTokenBurns(tx, prevOuts); err != nil {
+		return err
+	}
+	if o.sigHashes == nil {
+		o.sigHashes = txscript.NewTxSigHashes(tx)
+	}
+
+	indexes := make([]int, 0, len(paths))
+	for idx := range paths {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	scriptSigs := make(map[int][]byte, len(paths))
+	for _, idx := range indexes {
+		prevOut, ok := prevOuts[idx]
+		if !ok {
+			return fmt.Errorf("no previous output for input %d", idx)
+		}
+		inputHashType := hashType
+		if ht, ok := hashTypes[idx]; ok {
+			inputHashType = ht
+		}
+		if err := checkSigHashType(inputHashType); err != nil {
+			return fmt.Errorf("input %d: %w", idx, err)
+		}
+		sig, pubKey, isP2PK, err := signInputWithPath(tx, idx, prevOut, inputHashType, accountKey, paths[idx], o)
+		if err != nil {
+			return err
+		}
+		scriptSig, err := pathScriptSig(sig, pubKey, isP2PK)
+		if err != nil {
+			return err
+		}
+		scriptSigs[idx] = scriptSig
+	}
+	for idx, scriptSig := range scriptSigs {
+		tx.TxIn[idx].SignatureScript = scriptSig
+	}
+	return nil
+}
+
+// Sign answers the request with the keys derived from masterKey along the
+// first path of every input.  Inputs without path are left out of the
+// response; only pay-to-pubkey-hash and pay-to-pubkey inputs can be signed,
+// the latter with their scriptSig in the response too.
+// WithFeeLimits checks the fee with the amounts of the request inputs, and
+// requests destroying the tokens of their inputs are refused unless allowed by
+// AllowTokenBurn.
+func (r *SigningRequest) Sign(masterKey *hdkeychain.ExtendedKey, opts ...SignOption) (*SigningResponse, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	prevOuts := make(map[int]*wire.TxOut, len(r.Inputs))
+	utxos := make([]UTXO, len(r.Inputs))
+	for i, in := range r.Inputs {
+		prevOuts[i] = wire.NewTxOut(int64(in.Amount), append(append([]byte(nil), in.TokenData...), in.PkScript...))
+		utxos[i] = UTXO{OutPoint: r.Tx.TxIn[i].PreviousOutPoint, Amount: in.Amount, PkScript: in.PkScript,
+			TokenData: in.TokenData}
+	}
+	o := newSignOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	if err := o.checkFee(r.Tx, prevOuts); err != nil {
+		return nil, err
+	}
+	if err := o.checkPrevOuts(r.Tx, prevOuts); err != nil {
+		return nil, err
+	}
+	if err := checkTokenBurns(utxos, r.Tx.TxOut, o.allowTokenBurn); err != nil {
+		return nil, err
+	}
+	if o.sigHashes == nil {
+		o.sigHashes = txscript.NewTxSigHashes(r.Tx)
+	}
+
+	resp := &SigningResponse{TxID: r.Tx.TxHash()}
+	for i, in := range r.Inputs {
+		if len(in.Paths) == 0 {
+			continue
+		}
+		sig, pubKey, isP2PK, err := signInputWithPath(r.Tx, i, prevOuts[i], in.HashType, masterKey, in.Paths[0], o)
+		if err != nil {
+			return nil, err
+		}
+		resp.Signatures = append(resp.Signatures, InputSignature{
+			Index:     uint32(i),
+			PubKey:    pubKey,
+			Signature: sig,
+		})
+		// ApplyResponse builds pay-to-pubkey-hash scriptSigs from the
+		// signatures alone.
+		if isP2PK {
+			scriptSig, err := pathScriptSig(sig, pubKey, true)
+			if err != nil {
+				return nil, err
+			}
+			resp.ScriptSigs = append(resp.ScriptSigs, InputScript{Index: uint32(i), ScriptSig: scriptSig})
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,198 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// pathSignTestTx returns a transaction spending one pay-to-pubkey-hash output
+// for each path, paying to the key derived from master along it.
+func pathSignTestTx(t *testing.T, paths map[int]Path) (*wire.MsgTx, map[int]*wire.TxOut) {
+	master := descTestKey()
+	tx := wire.NewMsgTx(wire.TxVersion)
+	prevOuts := make(map[int]*wire.TxOut)
+	for i := 0; i < len(paths); i++ {
+		key, err := paths[i].Derive(master)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, _ := key.ECPubKey()
+		pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(pub.SerializeCompressed()))
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(i + 1)}, 0), nil, nil))
+		prevOuts[i] = wire.NewTxOut(int64(10000*(i+1)), pkScript)
+	}
+	tx.AddTxOut(wire.NewTxOut(5000, prevOuts[0].PkScript))
+	return tx, prevOuts
+}
+
+func TestSignInputsWithPaths(t *testing.T) {
+	paths := map[int]Path{
+		0: BIP44Path(0, ExternalChain, 0),
+		1: BIP44Path(0, ChangeChain, 3),
+	}
+	tx, prevOuts := pathSignTestTx(t, paths)
+	hashType := txscript.SigHashAll | SigHashForkID
+	if err := SignInputsWithPaths(tx, prevOuts, hashType, nil, descTestKey(), paths); err != nil {
+		t.Fatal(err)
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx)
+	for i, txIn := range tx.TxIn {
+		pushes, err := txscript.PushedData(txIn.SignatureScript)
+		if err != nil || len(pushes) != 2 {
+			t.Fatalf("input %d: unexpected scriptSig %x", i, txIn.SignatureScript)
+		}
+		sig, err := btcec.ParseDERSignature(pushes[0][:len(pushes[0])-1], btcec.S256())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := btcec.ParsePubKey(pushes[1], btcec.S256())
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := calcBip143SignatureHash(prevOuts[i].PkScript, sigHashes, hashType, tx, i, prevOuts[i].Value)
+		if !sig.Verify(hash, pub) {
+			t.Errorf("input %d: signature does not verify", i)
+		}
+	}
+}
+
+func TestSignInputWithWrongPath(t *testing.T) {
+	paths := map[int]Path{
+		0: BIP44Path(0, ExternalChain, 0),
+		1: BIP44Path(0, ExternalChain, 1),
+	}
+	tx, prevOuts := pathSignTestTx(t, paths)
+	paths[1] = BIP44Path(0, ExternalChain, 2)
+	err := SignInputsWithPaths(tx, prevOuts, txscript.SigHashAll|SigHashForkID, nil, descTestKey(), paths)
+	if !errors.Is(err, ErrKeyNotInScript) {
+		t.Fatalf("got %v, want ErrKeyNotInScript", err)
+	}
+	for i, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) != 0 {
+			t.Errorf("input %d was signed despite the error", i)
+		}
+	}
+}
+
+func TestSigningRequestSign(t *testing.T) {
+	master := descTestKey()
+	var keys []*btcec.PrivateKey
+	for i := uint32(0); i < 2; i++ {
+		key, err := BIP44Path(0, 0, i).Derive(master)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, _ := key.ECPrivKey()
+		keys = append(keys, priv)
+	}
+	req := signingTestRequest(keys)
+	resp, err := req.Sign(master, AllowDangerousSigHash(txscript.SigHashSingle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Signatures) != 2 {
+		t.Fatalf("got %d signatures, want 2", len(resp.Signatures))
+	}
+	if err := req.ValidateResponse(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pay-to-pubkey inputs are answered with their scriptSig, the signature
+	// alone.
+	req.Inputs[1].PkScript, _ = txscript.NewScriptBuilder().AddData(keys[1].PubKey().SerializeCompressed()).
+		AddOp(txscript.OP_CHECKSIG).Script()
+	if resp, err = req.Sign(master, AllowDangerousSigHash(txscript.SigHashSingle)); err != nil {
+		t.Fatal(err)
+	}
+	if err := req.ValidateResponse(resp); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := ApplyResponse(req.Tx, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushes, err := txscript.PushedData(signed.TxIn[1].SignatureScript); err != nil || len(pushes) != 1 {
+		t.Errorf("pay-to-pubkey scriptSig %x", signed.TxIn[1].SignatureScript)
+	}
+	for i, in := range req.Inputs {
+		vm, err := NewEngine(in.PkScript, signed, i, StandardScriptFlags, nil, int64(in.Amount))
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			t.Errorf("input %d: %v", i, err)
+		}
+	}
+}
+
+func TestSignInputsMixedHashTypes(t *testing.T) {
+	paths := map[int]Path{
+		0: BIP44Path(0, ExternalChain, 0),
+		1: BIP44Path(0, ExternalChain, 1),
+		2: BIP44Path(0, ExternalChain, 2),
+	}
+	tx, prevOuts := pathSignTestTx(t, paths)
+	tx.AddTxOut(wire.NewTxOut(7000, prevOuts[1].PkScript))
+	hashTypes := map[int]txscript.SigHashType{
+		1: txscript.SigHashAll | txscript.SigHashAnyOneCanPay | SigHashForkID,
+		2: txscript.SigHashNone | SigHashForkID,
+	}
+	err := SignInputsWithPaths(tx, prevOuts, txscript.SigHashAll|SigHashForkID, hashTypes,
+		descTestKey(), paths, AllowDangerousSigHash(txscript.SigHashNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []txscript.SigHashType{txscript.SigHashAll | SigHashForkID, hashTypes[1], hashTypes[2]}
+	sigHashes := txscript.NewTxSigHashes(tx)
+	for i, txIn := range tx.TxIn {
+		pushes, _ := txscript.PushedData(txIn.SignatureScript)
+		if got := txscript.SigHashType(pushes[0][len(pushes[0])-1]); got != want[i] {
+			t.Errorf("input %d: got sighash type %#x, want %#x", i, got, want[i])
+		}
+		vm, err := NewEngine(prevOuts[i].PkScript, tx, i, StandardScriptFlags, sigHashes, prevOuts[i].Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Errorf("input %d: %v", i, err)
+		}
+	}
+
+	// The ANYONECANPAY input stays valid when inputs are added, and the
+	// NONE input when outputs change.
+	addInput := tx.Copy()
+	addInput.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{9}, 0), nil, nil))
+	changeOutput := tx.Copy()
+	changeOutput.TxOut[0].Value--
+	for _, test := range []struct {
+		tx    *wire.MsgTx
+		valid []bool
+	}{
+		{addInput, []bool{false, true, false}},
+		{changeOutput, []bool{false, false, true}},
+	} {
+		sigHashes := txscript.NewTxSigHashes(test.tx)
+		for i, valid := range test.valid {
+			vm, _ := NewEngine(prevOuts[i].PkScript, test.tx, i, StandardScriptFlags,
+				sigHashes, prevOuts[i].Value)
+			if err := vm.Execute(); (err == nil) != valid {
+				t.Errorf("input %d: got %v after changing the transaction", i, err)
+			}
+		}
+	}
+
+	hashTypes[2] = txscript.SigHashType(0x04) | SigHashForkID
+	err = SignInputsWithPaths(tx, prevOuts, txscript.SigHashAll|SigHashForkID, hashTypes,
+		descTestKey(), paths)
+	if !errors.Is(err, ErrUnsupportedSigHashType) {
+		t.Errorf("got %v, want ErrUnsupportedSigHashType", err)
+	}
+}
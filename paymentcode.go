@@ -0,0 +1,343 @@
+package bchutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+const (
+	// PaymentCodeVersion is the only payment code version supported.
+	PaymentCodeVersion = 0x01
+
+	// PaymentCodeLen is the length of a serialized version 1 payment code.
+	PaymentCodeLen = 80
+
+	// PaymentCodePurpose is the BIP43 purpose of payment code derivation.
+	PaymentCodePurpose = 47
+
+	// paymentCodeNetID is the base58 version byte of payment codes.  It
+	// makes encoded payment codes start with "PM8T".
+	paymentCodeNetID = 0x47
+)
+
+var (
+	// ErrInvalidPaymentCode describes an error where a payment code can
+	// not be decoded because of its length, version or public key.
+	ErrInvalidPaymentCode = errors.New("invalid payment code")
+
+	// ErrNotNotification describes an error where a script is not the
+	// OP_RETURN output of a notification transaction.
+	ErrNotNotification = errors.New("not a payment code notification")
+)
+
+// PaymentCode is a BIP47 version 1 reusable payment code.
+type PaymentCode struct {
+	features  byte
+	pubKey    [33]byte
+	chainCode [32]byte
+}
+
+// DerivePaymentCodeKey derives the m/47'/coinType'/account' node of master
+// from which payment codes and their keys are created.  Bitcoin Cash wallets
+// use coin type 145.
+func DerivePaymentCodeKey(master *hdkeychain.ExtendedKey, coinType, account uint32) (*hdkeychain.ExtendedKey, error) {
+	path := Path{
+		hdkeychain.HardenedKeyStart + PaymentCodePurpose,
+		hdkeychain.HardenedKeyStart + coinType,
+		hdkeychain.HardenedKeyStart + account,
+	}
+	return path.Derive(master)
+}
+
+// NewPaymentCode returns the payment code of a node derived with
+// DerivePaymentCodeKey.  Both private and public nodes are accepted.
+func NewPaymentCode(key *hdkeychain.ExtendedKey) (*PaymentCode, error) {
+	pubKey, err := key.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	pc := &PaymentCode{}
+	copy(pc.pubKey[:], pubKey.SerializeCompressed())
+	copy(pc.chainCode[:], extendedKeyChainCode(key))
+	return pc, nil
+}
+
+// extendedKeyChainCode returns the chain code of an extended key.  The key
+// does not expose it, so it is read back from the serialized form, which is
+// 4 bytes of version, 1 of depth, 4 of parent fingerprint and 4 of child
+// number followed by the 32 bytes chain code.
+func extendedKeyChainCode(key *hdkeychain.ExtendedKey) []byte {
+	decoded := base58.Decode(key.String())
+	return decoded[13:45]
+}
+
+// NewPaymentCodeFromBytes decodes the 80 byte binary form of a payment code.
+func NewPaymentCodeFromBytes(b []byte) (*PaymentCode, error) {
+	if len(b) != PaymentCodeLen || b[0] != PaymentCodeVersion {
+		return nil, ErrInvalidPaymentCode
+	}
+	if b[2] != 0x02 && b[2] != 0x03 {
+		return nil, ErrInvalidPaymentCode
+	}
+	if _, err := btcec.ParsePubKey(b[2:35], btcec.S256()); err != nil {
+		return nil, ErrInvalidPaymentCode
+	}
+	pc := &PaymentCode{features: b[1]}
+	copy(pc.pubKey[:], b[2:35])
+	copy(pc.chainCode[:], b[35:67])
+	return pc, nil
+}
+
+// ParsePaymentCode decodes the base58 form of a payment code.
+func ParsePaymentCode(s string) (*PaymentCode, error) {
+	decoded, version, err := base58.CheckDecode(s)
+	if err != nil {
+		if err == base58.ErrChecksum {
+			return nil, ErrChecksumMismatch
+		}
+		return nil, ErrInvalidPaymentCode
+	}
+	if version != paymentCodeNetID {
+		return nil, ErrInvalidPaymentCode
+	}
+	return NewPaymentCodeFromBytes(decoded)
+}
+
+// Bytes returns the 80 byte binary form of the payment code.
+func (pc *PaymentCode) Bytes() []byte {
+	b := make([]byte, PaymentCodeLen)
+	b[0] = PaymentCodeVersion
+	b[1] = pc.features
+	copy(b[2:35], pc.pubKey[:])
+	copy(b[35:67], pc.chainCode[:])
+	return b
+}
+
+// String returns the base58 form of the payment code.
+func (pc *PaymentCode) String() string {
+	return base58.CheckEncode(pc.Bytes(), paymentCodeNetID)
+}
+
+// PubKey returns the public key of the payment code.
+func (pc *PaymentCode) PubKey() *btcec.PublicKey {
+	pubKey, _ := btcec.ParsePubKey(pc.pubKey[:], btcec.S256())
+	return pubKey
+}
+
+// extendedKey returns the extended public key the payment code encodes.
+func (pc *PaymentCode) extendedKey() *hdkeychain.ExtendedKey {
+	return hdkeychain.NewExtendedKey(chaincfg.MainNetParams.HDPublicKeyID[:],
+		pc.pubKey[:], pc.chainCode[:], []byte{0, 0, 0, 0}, 3, 0, false)
+}
+
+// childPubKey returns the public key of the i-th non hardened child of the
+// payment code.
+func (pc *PaymentCode) childPubKey(i uint32) (*btcec.PublicKey, error) {
+	child, err := pc.extendedKey().Child(i)
+	if err != nil {
+		return nil, err
+	}
+	return child.ECPubKey()
+}
+
+// NotificationPubKey returns the public key notification transactions to
+// the owner of the payment code must pay to.
+func (pc *PaymentCode) NotificationPubKey() (*btcec.PublicKey, error) {
+	return pc.childPubKey(0)
+}
+
+// NotificationAddress returns the address notification transactions to the
+// owner of the payment code must pay to.
+func (pc *PaymentCode) NotificationAddress(params *chaincfg.Params) (*CashAddressPubKeyHash, error) {
+	pubKey, err := pc.NotificationPubKey()
+	if err != nil {
+		return nil, err
+	}
+	return NewCashAddressPubKeyHash(btcutil.Hash160(pubKey.SerializeCompressed()), params)
+}
+
+// NotificationKey returns the private key matching the notification address
+// of a payment code node derived with DerivePaymentCodeKey.
+func NotificationKey(key *hdkeychain.ExtendedKey) (*btcec.PrivateKey, error) {
+	child, err := key.Child(0)
+	if err != nil {
+		return nil, err
+	}
+	return child.ECPrivKey()
+}
+
+// sharedSecret returns the x coordinate of the ECDH point of priv and pub.
+func sharedSecret(priv *btcec.PrivateKey, pub *btcec.PublicKey) []byte {
+	x, _ := btcec.S256().ScalarMult(pub.X, pub.Y, priv.D.Bytes())
+	secret := make([]byte, 32)
+	xb := x.Bytes()
+	copy(secret[32-len(xb):], xb)
+	return secret
+}
+
+// blindingMask returns the 64 byte mask applied to the public key x
+// coordinate and chain code of a payment code in a notification transaction.
+func blindingMask(secret []byte, outpoint wire.OutPoint) []byte {
+	var o [36]byte
+	copy(o[:32], outpoint.Hash[:])
+	o[32] = byte(outpoint.Index)
+	o[33] = byte(outpoint.Index >> 8)
+	o[34] = byte(outpoint.Index >> 16)
+	o[35] = byte(outpoint.Index >> 24)
+
+	mac := hmac.New(sha512.New, o[:])
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// applyMask xors the public key x coordinate and the chain code of a
+// serialized payment code with the mask.
+func applyMask(payload, mask []byte) {
+	for i := 0; i < 64; i++ {
+		payload[3+i] ^= mask[i]
+	}
+}
+
+// BlindedPaymentCode returns the payload of the notification transaction
+// sending the payment code pc to the owner of recipient.  designatedKey is
+// the private key of the designated input, the one whose public key is
+// exposed first in the notification transaction, and outpoint is the
+// outpoint that input spends.
+func BlindedPaymentCode(pc, recipient *PaymentCode, designatedKey *btcec.PrivateKey,
+	outpoint wire.OutPoint) ([]byte, error) {
+
+	notifPubKey, err := recipient.NotificationPubKey()
+	if err != nil {
+		return nil, err
+	}
+	payload := pc.Bytes()
+	applyMask(payload, blindingMask(sharedSecret(designatedKey, notifPubKey), outpoint))
+	return payload, nil
+}
+
+// NotificationScript returns the OP_RETURN script of the notification
+// transaction sending the payment code pc to the owner of recipient.  See
+// BlindedPaymentCode for the meaning of designatedKey and outpoint.
+func NotificationScript(pc, recipient *PaymentCode, designatedKey *btcec.PrivateKey,
+	outpoint wire.OutPoint) ([]byte, error) {
+
+	payload, err := BlindedPaymentCode(pc, recipient, designatedKey, outpoint)
+	if err != nil {
+		return nil, err
+	}
+	return txscript.NullDataScript(payload)
+}
+
+// ParseNotification recovers the payment code sent in a notification
+// transaction.  notificationKey is the private key of the recipient's
+// notification address, designatedPubKey the public key exposed by the
+// designated input and outpoint the outpoint spent by that input.
+func ParseNotification(pkScript []byte, notificationKey *btcec.PrivateKey,
+	designatedPubKey *btcec.PublicKey, outpoint wire.OutPoint) (*PaymentCode, error) {
+
+	pushes, err := txscript.PushedData(pkScript)
+	if err != nil || len(pkScript) == 0 || pkScript[0] != txscript.OP_RETURN ||
+		len(pushes) != 1 || len(pushes[0]) != PaymentCodeLen {
+		return nil, ErrNotNotification
+	}
+	payload := make([]byte, PaymentCodeLen)
+	copy(payload, pushes[0])
+	applyMask(payload, blindingMask(sharedSecret(notificationKey, designatedPubKey), outpoint))
+	return NewPaymentCodeFromBytes(payload)
+}
+
+// paymentSecret returns the scalar shared between the two parties for one
+// payment address, or an error if it is out of range and the address index
+// must be skipped.
+func paymentSecret(priv *btcec.PrivateKey, pub *btcec.PublicKey) (*big.Int, error) {
+	h := sha256.Sum256(sharedSecret(priv, pub))
+	s := new(big.Int).SetBytes(h[:])
+	if s.Sign() == 0 || s.Cmp(btcec.S256().N) >= 0 {
+		return nil, errors.New("shared secret out of range, skip the index")
+	}
+	return s, nil
+}
+
+// SendPubKey returns the public key of the index-th address the owner of the
+// payment code node key pays the owner of recipient to.
+func SendPubKey(key *hdkeychain.ExtendedKey, recipient *PaymentCode, index uint32) (*btcec.PublicKey, error) {
+	priv, err := NotificationKey(key)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := recipient.childPubKey(index)
+	if err != nil {
+		return nil, err
+	}
+	s, err := paymentSecret(priv, pub)
+	if err != nil {
+		return nil, fmt.Errorf("index %d: %v", index, err)
+	}
+
+	curve := btcec.S256()
+	sx, sy := curve.ScalarBaseMult(s.Bytes())
+	x, y := curve.Add(pub.X, pub.Y, sx, sy)
+	return &btcec.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// SendAddress returns the index-th CashAddr the owner of the payment code
+// node key pays the owner of recipient to.
+func SendAddress(key *hdkeychain.ExtendedKey, recipient *PaymentCode, index uint32,
+	params *chaincfg.Params) (*CashAddressPubKeyHash, error) {
+
+	pub, err := SendPubKey(key, recipient, index)
+	if err != nil {
+		return nil, err
+	}
+	return NewCashAddressPubKeyHash(btcutil.Hash160(pub.SerializeCompressed()), params)
+}
+
+// ReceiveKey returns the private key of the index-th address the owner of
+// sender pays the owner of the payment code node key to.
+func ReceiveKey(key *hdkeychain.ExtendedKey, sender *PaymentCode, index uint32) (*btcec.PrivateKey, error) {
+	child, err := key.Child(index)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := child.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := sender.NotificationPubKey()
+	if err != nil {
+		return nil, err
+	}
+	s, err := paymentSecret(priv, pub)
+	if err != nil {
+		return nil, fmt.Errorf("index %d: %v", index, err)
+	}
+
+	d := new(big.Int).Add(priv.D, s)
+	d.Mod(d, btcec.S256().N)
+	received, _ := btcec.PrivKeyFromBytes(btcec.S256(), d.Bytes())
+	return received, nil
+}
+
+// ReceiveAddress returns the index-th CashAddr the owner of sender pays the
+// owner of the payment code node key to.
+func ReceiveAddress(key *hdkeychain.ExtendedKey, sender *PaymentCode, index uint32,
+	params *chaincfg.Params) (*CashAddressPubKeyHash, error) {
+
+	priv, err := ReceiveKey(key, sender, index)
+	if err != nil {
+		return nil, err
+	}
+	return NewCashAddressPubKeyHash(btcutil.Hash160(priv.PubKey().SerializeCompressed()), params)
+}
@@ -0,0 +1,267 @@
+package bchutil
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// BIP47 test vectors, https://gist.github.com/SamouraiDev/6aad669604c5930864bd
+var (
+	aliceSeed = "64dca76abc9c6f0cf3d212d248c380c4622c8f93b2c425ec6a5567fd5db57e10d3e6f94a2f6af4ac2edb8998072aad92098db73558c323777abf5bd1082d970a"
+	bobSeed   = "87eaaac5a539ab028df44d9110defbef3797ddb805ca309f61a69ff96dbaa7ab5b24038cf029edec5235d933110f0aea8aeecf939ed14fc20730bba71e4b1110"
+
+	alicePaymentCode = "PM8TJTLJbPRGxSbc8EJi42Wrr6QbNSaSSVJ5Y3E4pbCYiTHUskHg13935Ubb7q8tx9GVbh2UuRnBc3WSyJHhUrw8KhprKnn9eDznYGieTzFcwQRya4GA"
+	bobPaymentCode   = "PM8TJS2JxQ5ztXUpBBRnpTbcUXbUHy2T1abfrb3KkAAtMEGNbey4oumH7Hc578WgQJhPjBxteQ5GHHToTYHE3A1w6p7tU6KSoFmWBVbFGjKPisZDbP97"
+
+	aliceNotification = "1JDdmqFLhpzcUwPeinhJbUPw4Co3aWLyzW"
+	bobNotification   = "1ChvUUvht2hUQufHBXF8NgLhW8SwE2ecGV"
+
+	aliceToBob = []string{
+		"141fi7TY3h936vRUKh1qfUZr8rSBuYbVBK",
+		"12u3Uued2fuko2nY4SoSFGCoGLCBUGPkk6",
+		"1FsBVhT5dQutGwaPePTYMe5qvYqqjxyftc",
+		"1CZAmrbKL6fJ7wUxb99aETwXhcGeG3CpeA",
+		"1KQvRShk6NqPfpr4Ehd53XUhpemBXtJPTL",
+		"1KsLV2F47JAe6f8RtwzfqhjVa8mZEnTM7t",
+		"1DdK9TknVwvBrJe7urqFmaxEtGF2TMWxzD",
+		"16DpovNuhQJH7JUSZQFLBQgQYS4QB9Wy8e",
+		"17qK2RPGZMDcci2BLQ6Ry2PDGJErrNojT5",
+		"1GxfdfP286uE24qLZ9YRP3EWk2urqXgC4s",
+	}
+
+	designatedWIF      = "Kx983SRhAZpAhj7Aac1wUXMJ6XZeyJKqCxJJ49dxEbYCT4a1ozRD"
+	designatedOutpoint = "86f411ab1c8e70ae8a0795ab7a6757aea6e4d5ae1826fc7b8f00c597d500609c01000000"
+	notificationScript = "6a4c50010002063e4eb95e62791b06c50e1a3a942e1ecaaa9afbbeb324d16ae6821e091611fa96c0cf048f607fe51a0327f5e2528979311c78cb2de0d682c61e1180fc3d543b00000000000000000000000000"
+)
+
+func paymentCodeKey(t *testing.T, seedHex string, coinType uint32) *hdkeychain.ExtendedKey {
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := DerivePaymentCodeKey(master, coinType, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// sameHash checks that the CashAddr addr pays the same hash as the legacy
+// address used in the BIP47 vectors.
+func sameHash(t *testing.T, addr btcutil.Address, legacy string) bool {
+	legacyAddr, err := btcutil.DecodeAddress(legacy, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(addr.ScriptAddress()) == string(legacyAddr.ScriptAddress())
+}
+
+func TestPaymentCode(t *testing.T) {
+	aliceKey := paymentCodeKey(t, aliceSeed, 0)
+	bobKey := paymentCodeKey(t, bobSeed, 0)
+
+	alice, err := NewPaymentCode(aliceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.String() != alicePaymentCode {
+		t.Errorf("wrong payment code %s", alice)
+	}
+	bob, err := ParsePaymentCode(bobPaymentCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.String() != bobPaymentCode {
+		t.Error("payment code does not round trip")
+	}
+	if pc, _ := NewPaymentCode(bobKey); pc.String() != bobPaymentCode {
+		t.Errorf("wrong payment code %s", pc)
+	}
+
+	addr, err := alice.NotificationAddress(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameHash(t, addr, aliceNotification) {
+		t.Errorf("wrong notification address %s", addr)
+	}
+	addr, err = bob.NotificationAddress(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameHash(t, addr, bobNotification) {
+		t.Errorf("wrong notification address %s", addr)
+	}
+
+	for i, legacy := range aliceToBob {
+		send, err := SendAddress(aliceKey, bob, uint32(i), &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameHash(t, send, legacy) {
+			t.Errorf("wrong send address %d: %s", i, send)
+		}
+		receive, err := ReceiveAddress(bobKey, alice, uint32(i), &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receive.String() != send.String() {
+			t.Errorf("receive address %d %s does not match send address %s", i, receive, send)
+		}
+	}
+
+	if _, err := ParsePaymentCode(alicePaymentCode[:len(alicePaymentCode)-1] + "B"); err == nil {
+		t.Error("corrupted payment code decoded")
+	}
+}
+
+func TestPaymentCodeNotification(t *testing.T) {
+	aliceKey := paymentCodeKey(t, aliceSeed, 0)
+	bobKey := paymentCodeKey(t, bobSeed, 0)
+	alice, _ := NewPaymentCode(aliceKey)
+	bob, _ := NewPaymentCode(bobKey)
+
+	wif, err := btcutil.DecodeWIF(designatedWIF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawOutpoint, _ := hex.DecodeString(designatedOutpoint)
+	hash, _ := chainhash.NewHash(rawOutpoint[:32])
+	outpoint := wire.OutPoint{Hash: *hash, Index: 1}
+
+	script, err := NotificationScript(alice, bob, wif.PrivKey, outpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(script) != notificationScript {
+		t.Errorf("wrong notification script %x", script)
+	}
+
+	notifKey, err := NotificationKey(bobKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, err := ParseNotification(script, notifKey, wif.PrivKey.PubKey(), outpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.String() != alicePaymentCode {
+		t.Errorf("wrong payment code %s recovered from notification", received)
+	}
+
+	other, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x01})
+	if pc, err := ParseNotification(script, notifKey, other.PubKey(), outpoint); err == nil &&
+		pc.String() == alicePaymentCode {
+		t.Error("notification decoded with the wrong designated key")
+	}
+}
+
+// TestPaymentCodeBCH derives payment codes on the Bitcoin Cash coin type and
+// checks both sides agree on the payment addresses and notification payload.
+func TestPaymentCodeBCH(t *testing.T) {
+	aliceKey := paymentCodeKey(t, aliceSeed, 145)
+	bobKey := paymentCodeKey(t, bobSeed, 145)
+	alice, _ := NewPaymentCode(aliceKey)
+	bob, _ := NewPaymentCode(bobKey)
+	if alice.String() == alicePaymentCode {
+		t.Fatal("coin type was not used in the derivation")
+	}
+
+	for i := uint32(0); i < 5; i++ {
+		send, err := SendAddress(aliceKey, bob, i, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		receive, err := ReceiveAddress(bobKey, alice, i, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if send.String() != receive.String() {
+			t.Errorf("address %d mismatch: %s != %s", i, send, receive)
+		}
+	}
+
+	designated, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x2a})
+	outpoint := wire.OutPoint{Index: 3}
+	script, err := NotificationScript(alice, bob, designated, outpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifKey, _ := NotificationKey(bobKey)
+	received, err := ParseNotification(script, notifKey, designated.PubKey(), outpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.String() != alice.String() {
+		t.Error("notification does not round trip")
+	}
+}
+
+// bchWalletPaymentCode is the payment code a BCH wallet shows for its
+// mnemonic, on coin type 145 and account 0, with its notification address.
+type bchWalletPaymentCode struct {
+	Mnemonic            string `json:"mnemonic"`
+	Passphrase          string `json:"passphrase"`
+	PaymentCode         string `json:"paymentCode"`
+	NotificationAddress string `json:"notificationAddress"`
+}
+
+// TestPaymentCodeBCHWallets checks the payment codes of the BCH wallets
+// saved in testdata/bip47 against those derived from their mnemonic, for
+// on-chain interoperability.
+func TestPaymentCodeBCHWallets(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "bip47", "*.json"))
+	if len(files) == 0 {
+		t.Skip("no BCH wallet payment code in testdata/bip47")
+	}
+	for _, name := range files {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wallet bchWalletPaymentCode
+		if err := json.Unmarshal(raw, &wallet); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		master, err := MasterKeyFromMnemonic(wallet.Mnemonic, wallet.Passphrase, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		key, err := DerivePaymentCodeKey(master, 145, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		pc, err := NewPaymentCode(key)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if pc.String() != wallet.PaymentCode {
+			t.Errorf("%s: payment code %s, wallet has %s", name, pc, wallet.PaymentCode)
+		}
+		notification, err := pc.NotificationAddress(&chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want, err := DecodeAddress(wallet.NotificationAddress, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(notification.ScriptAddress()) != string(want.ScriptAddress()) {
+			t.Errorf("%s: notification address %s, wallet has %s", name, notification, wallet.NotificationAddress)
+		}
+	}
+}
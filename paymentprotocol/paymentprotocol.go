@@ -0,0 +1,434 @@
+// Package paymentprotocol implements the client side of the JSON payment
+// protocol used by BitPay style payment processors.
+//
+// A payment request is fetched from the invoice URL with the
+// application/payment-request media type.  The processor signs the response
+// body and transmits the signature in the x-identity, x-signature-type and
+// x-signature headers, together with a digest header carrying the SHA-256 of
+// the body.  Once the request is verified its outputs can be funded and the
+// signed transaction posted back with the application/payment media type.
+package paymentprotocol
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// PaymentRequestType is the media type used to fetch a payment request.
+	PaymentRequestType = "application/payment-request"
+
+	// PaymentType is the media type used to post a payment.
+	PaymentType = "application/payment"
+
+	// PaymentACKType is the media type of the processor's reply to a
+	// payment.
+	PaymentACKType = "application/payment-ack"
+
+	// Currency is the only currency code accepted by this package.
+	Currency = "BCH"
+
+	// maxResponseSize bounds the size of the responses read from a payment
+	// processor.
+	maxResponseSize = 1 << 20
+)
+
+var (
+	// ErrExpired describes an error where the payment request is past its
+	// expiration time.
+	ErrExpired = errors.New("payment request has expired")
+
+	// ErrNetworkMismatch describes an error where the payment request is
+	// for a different network or chain than the one requested by the caller.
+	ErrNetworkMismatch = errors.New("payment request network mismatch")
+
+	// ErrBadDigest describes an error where the digest header does not
+	// match the received body.
+	ErrBadDigest = errors.New("payment request digest mismatch")
+
+	// ErrBadSignature describes an error where the signature over the
+	// payment request does not verify against the declared identity key.
+	ErrBadSignature = errors.New("invalid payment request signature")
+
+	// ErrUntrustedIdentity describes an error where the identity key used
+	// to sign the payment request was rejected by the caller.
+	ErrUntrustedIdentity = errors.New("untrusted payment request identity")
+
+	// ErrNoOutputs describes an error where the payment request does not
+	// contain any output to pay.
+	ErrNoOutputs = errors.New("payment request has no outputs")
+)
+
+// networkNames maps the network field of a payment request to the chain
+// parameters it describes.
+var networkNames = map[string]string{
+	"main": chaincfg.MainNetParams.Name,
+	"test": chaincfg.TestNet3Params.Name,
+}
+
+// Output is a single output requested by the payment processor.  Processors
+// either send a CashAddr address or a hex encoded locking script.
+type Output struct {
+	Amount  int64  `json:"amount"`
+	Address string `json:"address,omitempty"`
+	Script  string `json:"script,omitempty"`
+}
+
+// PaymentRequest is the JSON payment request returned by a processor.
+type PaymentRequest struct {
+	Network            string    `json:"network"`
+	Currency           string    `json:"currency"`
+	RequiredFeePerByte float64   `json:"requiredFeePerByte"`
+	Outputs            []Output  `json:"outputs"`
+	Time               time.Time `json:"time"`
+	Expires            time.Time `json:"expires"`
+	Memo               string    `json:"memo"`
+	PaymentURL         string    `json:"paymentUrl"`
+	PaymentID          string    `json:"paymentId"`
+
+	// IdentityKey is the public key that signed the request.  It is not
+	// part of the JSON body but is filled in from the x-identity header
+	// once the signature verified.
+	IdentityKey *btcec.PublicKey `json:"-"`
+
+	txOuts []*wire.TxOut
+}
+
+// TxOuts returns the outputs of the payment request as transaction outputs
+// ready to be added to the paying transaction.
+func (r *PaymentRequest) TxOuts() []*wire.TxOut {
+	txOuts := make([]*wire.TxOut, 0, len(r.txOuts))
+	for _, txOut := range r.txOuts {
+		txOuts = append(txOuts, wire.NewTxOut(txOut.Value, txOut.PkScript))
+	}
+	return txOuts
+}
+
+// TotalAmount returns the sum of the amounts of all requested outputs.
+func (r *PaymentRequest) TotalAmount() btcutil.Amount {
+	var total btcutil.Amount
+	for _, txOut := range r.txOuts {
+		total += btcutil.Amount(txOut.Value)
+	}
+	return total
+}
+
+// Payment is the body posted to the processor to pay a request.
+type Payment struct {
+	Currency     string   `json:"currency"`
+	Transactions []string `json:"transactions"`
+	RefundTo     string   `json:"refundTo,omitempty"`
+	Memo         string   `json:"memo,omitempty"`
+}
+
+// PaymentACK is the reply of the processor to a payment.
+type PaymentACK struct {
+	Payment Payment `json:"payment"`
+	Memo    string  `json:"memo"`
+}
+
+// ParsePaymentRequest parses and verifies a payment request body together
+// with the response headers it was received with.  The digest header must
+// match the body, the x-signature must verify against the x-identity key,
+// the request must be for the passed network and must not be expired at
+// the passed time.
+func ParsePaymentRequest(body []byte, header http.Header, params *chaincfg.Params, now time.Time) (*PaymentRequest, error) {
+	identityKey, err := verifyHeaders(body, header)
+	if err != nil {
+		return nil, err
+	}
+
+	var req PaymentRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("malformed payment request: %v", err)
+	}
+	req.IdentityKey = identityKey
+
+	if req.Currency != Currency {
+		return nil, fmt.Errorf("%w: currency %q", ErrNetworkMismatch, req.Currency)
+	}
+	if networkNames[req.Network] != params.Name {
+		return nil, fmt.Errorf("%w: network %q", ErrNetworkMismatch, req.Network)
+	}
+	if !req.Expires.IsZero() && !now.Before(req.Expires) {
+		return nil, ErrExpired
+	}
+	if len(req.Outputs) == 0 {
+		return nil, ErrNoOutputs
+	}
+
+	for i, out := range req.Outputs {
+		txOut, err := outputToTxOut(out, params)
+		if err != nil {
+			return nil, fmt.Errorf("output %d: %w", i, err)
+		}
+		req.txOuts = append(req.txOuts, txOut)
+	}
+	return &req, nil
+}
+
+// verifyHeaders checks the digest and signature headers of a payment
+// request and returns the identity key which signed it.
+func verifyHeaders(body []byte, header http.Header) (*btcec.PublicKey, error) {
+	digest := sha256.Sum256(body)
+
+	digestHeader := header.Get("Digest")
+	if !strings.HasPrefix(digestHeader, "SHA-256=") {
+		return nil, ErrBadDigest
+	}
+	expected, err := hex.DecodeString(strings.TrimPrefix(digestHeader, "SHA-256="))
+	if err != nil || !bytes.Equal(expected, digest[:]) {
+		return nil, ErrBadDigest
+	}
+
+	if sigType := header.Get("X-Signature-Type"); sigType != "ecc" {
+		return nil, fmt.Errorf("unsupported signature type %q", sigType)
+	}
+
+	keyBytes, err := hex.DecodeString(header.Get("X-Identity"))
+	if err != nil {
+		return nil, fmt.Errorf("malformed identity key: %v", err)
+	}
+	identityKey, err := btcec.ParsePubKey(keyBytes, btcec.S256())
+	if err != nil {
+		return nil, fmt.Errorf("malformed identity key: %v", err)
+	}
+
+	sigBytes, err := hex.DecodeString(header.Get("X-Signature"))
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+	sig, err := btcec.ParseDERSignature(sigBytes, btcec.S256())
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+	if !sig.Verify(digest[:], identityKey) {
+		return nil, ErrBadSignature
+	}
+	return identityKey, nil
+}
+
+// outputToTxOut converts a requested output to a transaction output, making
+// sure the locking script is one that is valid on Bitcoin Cash.
+func outputToTxOut(out Output, params *chaincfg.Params) (*wire.TxOut, error) {
+	if out.Amount <= 0 || out.Amount > btcutil.MaxSatoshi {
+		return nil, fmt.Errorf("invalid amount %d", out.Amount)
+	}
+
+	var pkScript []byte
+	switch {
+	case out.Address != "":
+		addr, err := bchutil.DecodeAddress(out.Address, params)
+		if err != nil {
+			return nil, fmt.Errorf("%w: address %q: %v",
+				ErrNetworkMismatch, out.Address, err)
+		}
+		pkScript, err = bchutil.PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		if out.Script != "" {
+			script, err := hex.DecodeString(out.Script)
+			if err != nil || !bytes.Equal(script, pkScript) {
+				return nil, errors.New("address and script disagree")
+			}
+		}
+
+	case out.Script != "":
+		var err error
+		pkScript, err = hex.DecodeString(out.Script)
+		if err != nil {
+			return nil, fmt.Errorf("malformed script: %v", err)
+		}
+		if txscript.IsWitnessProgram(pkScript) {
+			return nil, fmt.Errorf("%w: segwit script", ErrNetworkMismatch)
+		}
+		if _, err := bchutil.ExtractPkScriptAddrs(pkScript, params); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNetworkMismatch, err)
+		}
+
+	default:
+		return nil, errors.New("output has no address or script")
+	}
+	return wire.NewTxOut(out.Amount, pkScript), nil
+}
+
+// Client fetches payment requests and posts payments to a payment processor.
+type Client struct {
+	// HTTPClient is used to perform the requests.  http.DefaultClient is
+	// used when nil.
+	HTTPClient *http.Client
+
+	// Params are the chain parameters payment requests must be for.
+	Params *chaincfg.Params
+
+	// CheckIdentity, when set, is called with the key that signed a
+	// payment request so the caller can check it against the keys
+	// published by the processor.  Returning an error rejects the request.
+	CheckIdentity func(key *btcec.PublicKey) error
+
+	// Now returns the current time.  time.Now is used when nil.
+	Now func() time.Time
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// FetchPaymentRequest retrieves, parses and verifies the payment request
+// served at url.
+func (c *Client) FetchPaymentRequest(url string) (*PaymentRequest, error) {
+	httpReq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", PaymentRequestType)
+	httpReq.Header.Set("X-Currency", Currency)
+
+	resp, err := c.httpClient().Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := ParsePaymentRequest(body, resp.Header, c.Params, c.now())
+	if err != nil {
+		return nil, err
+	}
+	if c.CheckIdentity != nil {
+		if err := c.CheckIdentity(req.IdentityKey); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUntrustedIdentity, err)
+		}
+	}
+	return req, nil
+}
+
+// NewPayment builds the payment body for the passed signed transaction.  The
+// refund address is optional and is encoded as a CashAddr.
+func NewPayment(tx *wire.MsgTx, refundTo btcutil.Address, memo string) (*Payment, error) {
+	var buf bytes.Buffer
+	buf.Grow(tx.SerializeSize())
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	payment := &Payment{
+		Currency:     Currency,
+		Transactions: []string{hex.EncodeToString(buf.Bytes())},
+		Memo:         memo,
+	}
+	if refundTo != nil {
+		payment.RefundTo = refundTo.EncodeAddress()
+	}
+	return payment, nil
+}
+
+// SendPayment posts the payment to the payment URL of the request.  The
+// payment is checked to pay every output of the request before it is sent.
+func (c *Client) SendPayment(req *PaymentRequest, tx *wire.MsgTx, refundTo btcutil.Address) (*PaymentACK, error) {
+	if !req.Expires.IsZero() && !c.now().Before(req.Expires) {
+		return nil, ErrExpired
+	}
+	if err := CheckPaysRequest(req, tx); err != nil {
+		return nil, err
+	}
+
+	payment, err := NewPayment(tx, refundTo, "")
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(payment)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", req.PaymentURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", PaymentType)
+	httpReq.Header.Set("Accept", PaymentACKType)
+
+	resp, err := c.httpClient().Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var ack PaymentACK
+	if err := json.Unmarshal(respBody, &ack); err != nil {
+		return nil, fmt.Errorf("malformed payment ack: %v", err)
+	}
+	return &ack, nil
+}
+
+// CheckPaysRequest returns an error unless the transaction contains every
+// output requested by the payment request.
+func CheckPaysRequest(req *PaymentRequest, tx *wire.MsgTx) error {
+	used := make([]bool, len(tx.TxOut))
+	for i, want := range req.txOuts {
+		found := false
+		for j, txOut := range tx.TxOut {
+			if used[j] || txOut.Value != want.Value ||
+				!bytes.Equal(txOut.PkScript, want.PkScript) {
+				continue
+			}
+			used[j] = true
+			found = true
+			break
+		}
+		if !found {
+			return fmt.Errorf("transaction does not pay requested output %d", i)
+		}
+	}
+	return nil
+}
+
+// readBody reads a bounded response body and turns non 2xx statuses into
+// errors carrying the processor's message.
+func readBody(resp *http.Response) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("payment processor returned %s: %s",
+			resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
@@ -0,0 +1,180 @@
+package paymentprotocol
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var testNow = time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func signedHeader(t *testing.T, key *btcec.PrivateKey, body []byte) http.Header {
+	digest := sha256.Sum256(body)
+	sig, err := key.Sign(digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make(http.Header)
+	header.Set("Content-Type", PaymentRequestType)
+	header.Set("Digest", "SHA-256="+hex.EncodeToString(digest[:]))
+	header.Set("X-Identity", hex.EncodeToString(key.PubKey().SerializeCompressed()))
+	header.Set("X-Signature-Type", "ecc")
+	header.Set("X-Signature", hex.EncodeToString(sig.Serialize()))
+	return header
+}
+
+func testRequestBody(t *testing.T, network string, outputs []Output) []byte {
+	body, err := json.Marshal(map[string]interface{}{
+		"network":            network,
+		"currency":           "BCH",
+		"requiredFeePerByte": 1,
+		"outputs":            outputs,
+		"time":               testNow.Add(-time.Minute),
+		"expires":            testNow.Add(15 * time.Minute),
+		"memo":               "Payment request for invoice 1234",
+		"paymentUrl":         "https://example.com/i/1234",
+		"paymentId":          "1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestParsePaymentRequest(t *testing.T) {
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x01})
+	outputs := []Output{{Amount: 39300, Address: "qr95sy3j9xwd2ap32xkykttr4cvcu7as4y0qverfuy"}}
+	body := testRequestBody(t, "main", outputs)
+
+	req, err := ParsePaymentRequest(body, signedHeader(t, key, body), &chaincfg.MainNetParams, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txOuts := req.TxOuts()
+	if len(txOuts) != 1 || txOuts[0].Value != 39300 {
+		t.Fatalf("unexpected outputs %v", txOuts)
+	}
+	if hex.EncodeToString(txOuts[0].PkScript) != "76a914cb481232299cd5743151ac4b2d63ae198e7bb0a988ac" {
+		t.Errorf("unexpected output script %x", txOuts[0].PkScript)
+	}
+	if !req.IdentityKey.IsEqual(key.PubKey()) {
+		t.Error("identity key not recorded")
+	}
+
+	// Expired.
+	_, err = ParsePaymentRequest(body, signedHeader(t, key, body), &chaincfg.MainNetParams, testNow.Add(time.Hour))
+	if err != ErrExpired {
+		t.Errorf("expected ErrExpired, got %v", err)
+	}
+
+	// Wrong network.
+	_, err = ParsePaymentRequest(body, signedHeader(t, key, body), &chaincfg.TestNet3Params, testNow)
+	if !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("expected ErrNetworkMismatch, got %v", err)
+	}
+
+	// Segwit output script.
+	body = testRequestBody(t, "main", []Output{{Amount: 1000, Script: "0014751e76e8199196d454941c45d1b3a323f1433bd6"}})
+	_, err = ParsePaymentRequest(body, signedHeader(t, key, body), &chaincfg.MainNetParams, testNow)
+	if !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("expected ErrNetworkMismatch, got %v", err)
+	}
+
+	// Tampered body.
+	header := signedHeader(t, key, body)
+	body[len(body)-2] = 'x'
+	_, err = ParsePaymentRequest(body, header, &chaincfg.MainNetParams, testNow)
+	if err != ErrBadDigest {
+		t.Errorf("expected ErrBadDigest, got %v", err)
+	}
+
+	// Signature by another key.
+	body = testRequestBody(t, "main", outputs)
+	header = signedHeader(t, key, body)
+	other, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x02})
+	header.Set("X-Identity", hex.EncodeToString(other.PubKey().SerializeCompressed()))
+	_, err = ParsePaymentRequest(body, header, &chaincfg.MainNetParams, testNow)
+	if err != ErrBadSignature {
+		t.Errorf("expected ErrBadSignature, got %v", err)
+	}
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x01})
+	outputs := []Output{{Amount: 39300, Address: "qr95sy3j9xwd2ap32xkykttr4cvcu7as4y0qverfuy"}}
+	body := testRequestBody(t, "main", outputs)
+
+	var posted Payment
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			if r.Header.Get("Accept") != PaymentRequestType {
+				http.Error(w, "bad accept", http.StatusBadRequest)
+				return
+			}
+			for k, v := range signedHeader(t, key, body) {
+				w.Header()[k] = v
+			}
+			w.Write(body)
+		case "POST":
+			b, _ := ioutil.ReadAll(r.Body)
+			if err := json.Unmarshal(b, &posted); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(PaymentACK{Payment: posted, Memo: "thanks"})
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{
+		Params: &chaincfg.MainNetParams,
+		Now:    func() time.Time { return testNow },
+	}
+	req, err := client.FetchPaymentRequest(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.PaymentURL = server.URL
+
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	if _, err := client.SendPayment(req, tx, nil); err == nil {
+		t.Error("payment missing the requested output was sent")
+	}
+	for _, txOut := range req.TxOuts() {
+		tx.AddTxOut(txOut)
+	}
+
+	refund, err := bchutil.DecodeAddress("qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack, err := client.SendPayment(req, tx, refund)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.Memo != "thanks" {
+		t.Errorf("unexpected ack memo %q", ack.Memo)
+	}
+	if posted.Currency != "BCH" || len(posted.Transactions) != 1 ||
+		posted.RefundTo != refund.EncodeAddress() {
+		t.Errorf("unexpected payment body %+v", posted)
+	}
+
+	client.CheckIdentity = func(*btcec.PublicKey) error { return errors.New("unknown key") }
+	if _, err := client.FetchPaymentRequest(server.URL); !errors.Is(err, ErrUntrustedIdentity) {
+		t.Errorf("expected ErrUntrustedIdentity, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package bchutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+var (
+	// ErrDustOutput describes an error where an output pays less than the
+	// dust threshold.
+	ErrDustOutput = errors.New("output below the dust threshold")
+
+	// ErrInsufficientFunds describes an error where the available outputs
+	// can't cover the amounts paid by a transaction and its fee.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+// Payout is a payment to a recipient of BuildPayoutBatches.
+type Payout struct {
+	Address btcutil.Address
+	Amount  btcutil.Amount
+}
+
+// PayoutOptions are the options of BuildPayoutBatches.
+type PayoutOptions struct {
+	// FundingScripts are the scripts of the wallet, whose outputs are
+	// fetched from the UTXO source.  Their scriptSig size must be known
+	// to EstimateScriptSigSize.
+	FundingScripts [][]byte
+
+	// ChangeScript receives the change of every transaction.
+	ChangeScript []byte
+
+	// MaxTxSize is the largest estimated size of a signed transaction.
+	// MaxStandardTxSize is used when it is not positive.
+	MaxTxSize int
+
+	// MaxInputs and MaxOutputs, change included, limit the inputs and
+	// outputs of every transaction when positive.
+	MaxInputs  int
+	MaxOutputs int
+
+	// ChainChange makes every transaction spend the change of the previous
+	// one, which can then be spent before any of them confirm.
+	ChainChange bool
+
+	// SpendPolicy selects the outputs of the funding scripts that can be
+	// spent.
+	SpendPolicy SpendPolicy
+}
+
+// BuildPayoutBatches pays recipients, in order, with as few transactions as
+// the size and input and output limits of opts allow, funded by the outputs
+// of source paying to opts.FundingScripts, largest first, at feeRate.  Outputs
+// carrying tokens are never spent.  Payouts below the dust threshold are
+// rejected before anything is built, with an error wrapping ErrDustOutput.
+func BuildPayoutBatches(ctx context.Context, recipients []Payout, source UTXOSource, feeRate FeeRate,
+	opts *PayoutOptions) ([]*UnsignedTx, error) {
+
+	if opts == nil || len(opts.ChangeScript) == 0 {
+		return nil, errors.New("no change script")
+	}
+	b := &payoutBatcher{txFunder: txFunder{
+		feeRate:      feeRate,
+		changeScript: opts.ChangeScript,
+		maxTxSize:    opts.MaxTxSize,
+		maxInputs:    opts.MaxInputs,
+		maxOutputs:   opts.MaxOutputs,
+	}}
+	for i, r := range recipients {
+		pkScript, err := PayToAddrScript(r.Address)
+		if err != nil {
+			return nil, fmt.Errorf("recipient %d (%v): %w", i, r.Address, err)
+		}
+		txOut := wire.NewTxOut(int64(r.Amount), pkScript)
+		if IsDust(txOut) {
+			return nil, fmt.Errorf("%w: recipient %d (%v) is paid %v", ErrDustOutput, i, r.Address, r.Amount)
+		}
+		b.outputs = append(b.outputs, txOut)
+	}
+
+	utxos, err := source.UTXOs(ctx, opts.FundingScripts)
+	if err != nil {
+		return nil, err
+	}
+	b.pool = selectionPool(utxos, opts.SpendPolicy)
+
+	var batches []*UnsignedTx
+	var parent *UnsignedTx
+	for next := 0; next < len(b.outputs); {
+		var batch *UnsignedTx
+		var used int
+		for end := next + 1; end <= len(b.outputs); end++ {
+			tx, n, err := b.build(parent, next, end)
+			if errors.Is(err, errTxLimits) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			batch, used = tx, n
+		}
+		if batch == nil {
+			return nil, fmt.Errorf("recipient %d (%v) does not fit in a transaction", next,
+				recipients[next].Address)
+		}
+		b.pool = b.pool[used:]
+		next += len(batch.Recipients)
+		batches = append(batches, batch)
+
+		parent = nil
+		if opts.ChainChange && batch.ChangeIndex >= 0 {
+			parent = batch
+		}
+	}
+	return batches, nil
+}
+
+// payoutBatcher builds the transactions of BuildPayoutBatches.
+type payoutBatcher struct {
+	txFunder
+
+	// outputs pays the recipients, and pool holds the outputs not spent
+	// by previous batches.
+	outputs []*wire.TxOut
+	pool    []UTXO
+}
+
+// build returns the transaction paying outputs start to end, spending the
+// change of parent, if any, and the first outputs of the pool, with the number
+// of outputs taken from the pool.
+func (b *payoutBatcher) build(parent *UnsignedTx, start, end int) (*UnsignedTx, int, error) {
+	batch := &UnsignedTx{
+		Tx:          wire.NewMsgTx(wire.TxVersion),
+		PrevOuts:    make(map[int]*wire.TxOut),
+		ChangeIndex: -1,
+		Parent:      parent,
+	}
+	tx := batch.Tx
+	if parent != nil {
+		hash := parent.Tx.TxHash()
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, uint32(parent.ChangeIndex)), nil, nil))
+		batch.PrevOuts[0] = parent.Tx.TxOut[parent.ChangeIndex]
+	}
+	for i := start; i < end; i++ {
+		tx.AddTxOut(b.outputs[i])
+		batch.Recipients = append(batch.Recipients, i)
+	}
+	used, err := b.fund(batch, b.pool)
+	if errors.Is(err, ErrInsufficientFunds) {
+		return nil, 0, fmt.Errorf("%w to pay recipients %d to %d", err, start, end-1)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return batch, used, nil
+}
@@ -0,0 +1,110 @@
+package bchutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testUTXOSource is a UTXOSource returning the same outputs for any script.
+type testUTXOSource []UTXO
+
+func (s testUTXOSource) UTXOs(ctx context.Context, pkScripts [][]byte) ([]UTXO, error) {
+	return s, nil
+}
+
+func TestBuildPayoutBatches(t *testing.T) {
+	key := signingTestKeys()[0]
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	var source testUTXOSource
+	for i := 0; i < 20; i++ {
+		source = append(source, UTXO{
+			OutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(i)}},
+			Amount:   btcutil.Amount(10000 * (i + 1)),
+			PkScript: pkScript,
+		})
+	}
+	source[19].TokenData = []byte{0x10}
+
+	var recipients []Payout
+	for i := 0; i < 50; i++ {
+		addr, _ := NewCashAddressPubKeyHash(chainhash.HashB([]byte{byte(i)})[:20], &chaincfg.MainNetParams)
+		recipients = append(recipients, Payout{Address: addr, Amount: btcutil.Amount(1000 + 100*i)})
+	}
+	opts := &PayoutOptions{
+		FundingScripts: [][]byte{pkScript},
+		ChangeScript:   pkScript,
+		MaxOutputs:     12,
+		ChainChange:    true,
+	}
+	feeRate := FeeRate(1000)
+	batches, err := BuildPayoutBatches(context.Background(), recipients, source, feeRate, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 5 {
+		t.Fatalf("got %d batches, want 5", len(batches))
+	}
+
+	paid := 0
+	for i, batch := range batches {
+		tx := batch.Tx
+		if len(tx.TxOut) > opts.MaxOutputs {
+			t.Errorf("batch %d: got %d outputs", i, len(tx.TxOut))
+		}
+		for j, r := range batch.Recipients {
+			if r != paid || tx.TxOut[j].Value != int64(recipients[r].Amount) {
+				t.Errorf("batch %d: output %d pays recipient %d", i, j, r)
+			}
+			paid++
+		}
+		if (batch.Parent != nil) != (i > 0) {
+			t.Errorf("batch %d: unexpected parent", i)
+		}
+		batch.LinkParent()
+		for j, txIn := range tx.TxIn {
+			if txIn.PreviousOutPoint.Hash == source[19].OutPoint.Hash {
+				t.Errorf("batch %d spends the token output", i)
+			}
+			scriptSig, err := SignatureScript(tx, j, pkScript, txscript.SigHashAll|SigHashForkID, key, true,
+				batch.PrevOuts[j].Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			txIn.SignatureScript = scriptSig
+		}
+		fee, err := TxFee(tx, batch.PrevOuts)
+		if err != nil || fee != batch.Fee {
+			t.Errorf("batch %d: got fee %v, want %v (%v)", i, fee, batch.Fee, err)
+		}
+		if size := tx.SerializeSize(); size > batch.Size || fee < feeRate.Fee(size) {
+			t.Errorf("batch %d: fee %v for %d bytes, estimated %d", i, fee, size, batch.Size)
+		}
+		for j := range tx.TxIn {
+			vm, _ := NewEngine(pkScript, tx, j, StandardScriptFlags, nil, batch.PrevOuts[j].Value)
+			if err := vm.Execute(); err != nil {
+				t.Errorf("batch %d, input %d: %v", i, j, err)
+			}
+		}
+	}
+	if paid != len(recipients) {
+		t.Errorf("paid %d recipients, want %d", paid, len(recipients))
+	}
+
+	recipients[7].Amount = 545
+	_, err = BuildPayoutBatches(context.Background(), recipients, source, feeRate, opts)
+	if !errors.Is(err, ErrDustOutput) {
+		t.Errorf("got %v, want ErrDustOutput", err)
+	}
+	recipients[7].Amount = 1000000000
+	_, err = BuildPayoutBatches(context.Background(), recipients, source, feeRate, opts)
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+}
@@ -0,0 +1,73 @@
+package bchutil
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// ErrInvalidTweak describes an error where the tweak of a commitment is not a
+// valid scalar, or makes the tweaked key the point at infinity, which happens
+// with negligible probability: another commitment must be used.
+var ErrInvalidTweak = errors.New("invalid pay-to-contract tweak")
+
+// commitmentTweak returns the tweak committing the key pub to commitment:
+// SHA-256 of the 33 byte compressed pub followed by commitment, read as a big
+// endian number, which must be below the order of the curve.
+func commitmentTweak(pub *btcec.PublicKey, commitment []byte) (*big.Int, error) {
+	h := sha256.New()
+	h.Write(pub.SerializeCompressed())
+	h.Write(commitment)
+	t := new(big.Int).SetBytes(h.Sum(nil))
+	if t.Cmp(btcec.S256().N) >= 0 {
+		return nil, ErrInvalidTweak
+	}
+	return t, nil
+}
+
+// TweakPublicKey returns the pay-to-contract key P' = P + H(P || c)·G of the
+// key pub P committing to commitment c, where H(P || c) is SHA-256 of the 33
+// byte compressed P followed by c, read as a big endian number.  Its
+// addresses and signatures are those of any key, while the owner of P can
+// prove the commitment with VerifyCommitment.  Tweaks not below the order of
+// the curve, or making P' the point at infinity, fail with ErrInvalidTweak.
+func TweakPublicKey(pub *btcec.PublicKey, commitment []byte) (*btcec.PublicKey, error) {
+	t, err := commitmentTweak(pub, commitment)
+	if err != nil {
+		return nil, err
+	}
+	curve := btcec.S256()
+	tx, ty := curve.ScalarBaseMult(t.Bytes())
+	x, y := curve.Add(pub.X, pub.Y, tx, ty)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, ErrInvalidTweak
+	}
+	return &btcec.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// TweakPrivateKey returns the private key d + H(P || c) of the
+// pay-to-contract key TweakPublicKey returns for the public key P of priv,
+// to spend the outputs paying it.
+func TweakPrivateKey(priv *btcec.PrivateKey, commitment []byte) (*btcec.PrivateKey, error) {
+	t, err := commitmentTweak(priv.PubKey(), commitment)
+	if err != nil {
+		return nil, err
+	}
+	n := btcec.S256().N
+	d := t.Add(t, priv.D)
+	d.Mod(d, n)
+	if d.Sign() == 0 {
+		return nil, ErrInvalidTweak
+	}
+	tweaked, _ := btcec.PrivKeyFromBytes(btcec.S256(), d.Bytes())
+	return tweaked, nil
+}
+
+// VerifyCommitment returns whether tweakedPub is the pay-to-contract key of
+// basePub committing to commitment, as TweakPublicKey returns.
+func VerifyCommitment(basePub, tweakedPub *btcec.PublicKey, commitment []byte) bool {
+	want, err := TweakPublicKey(basePub, commitment)
+	return err == nil && want.IsEqual(tweakedPub)
+}
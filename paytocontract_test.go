@@ -0,0 +1,114 @@
+package bchutil
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestTweakPublicKey(t *testing.T) {
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{1})
+	commitment := []byte("document digest")
+	tweaked, err := TweakPublicKey(priv.PubKey(), commitment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweakedPriv, err := TweakPrivateKey(priv, commitment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tweakedPriv.PubKey().IsEqual(tweaked) || tweaked.IsEqual(priv.PubKey()) {
+		t.Error("tweaked private key does not match the tweaked public key")
+	}
+	// The key of the private key 1, the generator, tweaked by SHA-256 of
+	// its compressed form and the commitment, computed independently.
+	const want = "028687932d1547bdac80da4dff41776680f0b54b3e54aced1da6b42dce7975186c"
+	if got := hex.EncodeToString(tweaked.SerializeCompressed()); got != want {
+		t.Errorf("tweaked key %s, want %s", got, want)
+	}
+
+	if !VerifyCommitment(priv.PubKey(), tweaked, commitment) {
+		t.Error("commitment does not verify")
+	}
+	if VerifyCommitment(priv.PubKey(), tweaked, []byte("another digest")) ||
+		VerifyCommitment(tweaked, tweaked, commitment) {
+		t.Error("wrong commitment verifies")
+	}
+}
+
+func TestPayToContractSpend(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte("pay-to-contract test key"))
+	commitment := []byte("document digest")
+	base, err := btcutil.NewWIF(priv, params, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweakedPriv, err := TweakPrivateKey(priv, commitment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweaked, _ := btcutil.NewWIF(tweakedPriv, params, true)
+	baseAddr, _ := btcutil.NewAddressPubKeyHash(btcutil.Hash160(base.SerializePubKey()), params)
+	tweakedPub, _ := TweakPublicKey(priv.PubKey(), commitment)
+	tweakedAddr, _ := btcutil.NewAddressPubKeyHash(btcutil.Hash160(tweakedPub.SerializeCompressed()), params)
+
+	chain := NewRegtestChain(params)
+	if _, err := chain.Mine(nil, baseAddr); err != nil {
+		t.Fatal(err)
+	}
+	coinbase, _ := chain.CoinbaseOutPoint(1)
+
+	// spend sends amount from the output op to dest with key, checks the
+	// scripts of its inputs and mines it.
+	spend := func(op wire.OutPoint, key *btcutil.WIF, dest btcutil.Address, amount btcutil.Amount) *wire.MsgTx {
+		t.Helper()
+		prevOut := chain.FetchPrevOutput(op)
+		b := NewTxBuilder(1000, nil)
+		b.SetNetwork(params)
+		b.AddUTXOs(UTXO{OutPoint: op, Amount: btcutil.Amount(prevOut.Value), PkScript: prevOut.PkScript})
+		if err := b.AddPayment(dest, amount); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.SetChangeAddress(baseAddr); err != nil {
+			t.Fatal(err)
+		}
+		u, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := u.SignWithWIFs(key); err != nil {
+			t.Fatal(err)
+		}
+		vm, err := NewEngine(prevOut.PkScript, u.Tx, 0, StandardScriptFlags, nil, prevOut.Value)
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			t.Fatalf("spending %v: %v", op, err)
+		}
+		if _, err := chain.Mine([]*btcutil.Tx{btcutil.NewTx(u.Tx)}, baseAddr); err != nil {
+			t.Fatal(err)
+		}
+		return u.Tx
+	}
+
+	funding := spend(coinbase, base, tweakedAddr, 1e8)
+	// The output paying the tweaked key is an ordinary P2PKH output, of
+	// which the commitment can be proven.
+	pkScript, _ := PayToAddrScript(tweakedAddr)
+	idx := -1
+	for i, txOut := range funding.TxOut {
+		if string(txOut.PkScript) == string(pkScript) {
+			idx = i
+		}
+	}
+	if idx < 0 || !VerifyCommitment(priv.PubKey(), tweakedPub, commitment) {
+		t.Fatal("tweaked output not found")
+	}
+	spend(wire.OutPoint{Hash: funding.TxHash(), Index: uint32(idx)}, tweaked, baseAddr, 5e7)
+}
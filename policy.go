@@ -0,0 +1,284 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// Limits of the transactions relayed by nodes.
+const (
+	// MinTxSize is the smallest transaction allowed since the May 2023
+	// upgrade.
+	MinTxSize = 65
+
+	// minTxSizeMagneticAnomaly is the smallest transaction allowed from
+	// the November 2018 upgrade to the May 2023 one.
+	minTxSizeMagneticAnomaly = 100
+
+	// MaxDataCarrierSize is the largest size of the scripts of all the
+	// OP_RETURN outputs of a transaction.
+	MaxDataCarrierSize = 223
+
+	// MaxStandardScriptSigSize is the largest scriptSig relayed.
+	MaxStandardScriptSigSize = 1650
+
+	// MaxStandardTxSigChecks is the largest number of signature checks of
+	// the inputs of a transaction relayed.
+	MaxStandardTxSigChecks = 3000
+
+	// maxStandardMultiSigKeys is the largest number of public keys of a
+	// bare multisig output relayed.
+	maxStandardMultiSigKeys = 3
+)
+
+var (
+	// ErrTxSize describes an error where a transaction is smaller than
+	// MinTxSize or larger than MaxStandardTxSize.
+	ErrTxSize = errors.New("non-standard transaction size")
+
+	// ErrTxVersion describes an error where a transaction version is not
+	// relayed.
+	ErrTxVersion = errors.New("non-standard transaction version")
+
+	// ErrNonStandardScript describes an error where an output script is
+	// not of a standard type.
+	ErrNonStandardScript = errors.New("non-standard output script")
+
+	// ErrDataCarrierSize describes an error where the OP_RETURN outputs of
+	// a transaction exceed MaxDataCarrierSize.
+	ErrDataCarrierSize = errors.New("OP_RETURN data too large")
+
+	// ErrScriptSigSize describes an error where a scriptSig exceeds
+	// MaxStandardScriptSigSize.
+	ErrScriptSigSize = errors.New("scriptSig too large")
+
+	// ErrTooManySigChecks describes an error where the inputs of a
+	// transaction exceed MaxStandardTxSigChecks.
+	ErrTooManySigChecks = errors.New("too many signature checks")
+
+	// ErrFeeTooLow describes an error where a transaction pays less than
+	// the minimum relay fee, MinRelayFee at MinRelayFeeRate by default.
+	ErrFeeTooLow = errors.New("fee below the minimum relay fee")
+)
+
+// PolicyError lists the reasons why nodes would not relay a transaction.
+type PolicyError struct {
+	Violations []error
+}
+
+// Error returns all the violations.
+func (e *PolicyError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, err := range e.Violations {
+		msgs[i] = err.Error()
+	}
+	return "non-standard transaction: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the violations, for errors.Is and errors.As to match any of
+// them.
+func (e *PolicyError) Unwrap() []error {
+	return e.Violations
+}
+
+// isDataCarrier returns whether pkScript is an OP_RETURN script followed by
+// data pushes.
+func isDataCarrier(pkScript []byte) bool {
+	if len(pkScript) == 0 || pkScript[0] != txscript.OP_RETURN {
+		return false
+	}
+	ops, err := parseScript(pkScript[1:])
+	return err == nil && isPushOnly(ops)
+}
+
+// isStandardOutputScript returns whether nodes relay outputs paying to
+// pkScript, OP_RETURN ones aside.
+func isStandardOutputScript(pkScript []byte) bool {
+	switch txscript.GetScriptClass(pkScript) {
+	case txscript.PubKeyHashTy, txscript.ScriptHashTy, txscript.PubKeyTy:
+		return true
+	case txscript.MultiSigTy:
+		pubKeys, _, _ := multisigPubKeys(pkScript)
+		return len(pubKeys) <= maxStandardMultiSigKeys
+	}
+	return isPayToScriptHash32(pkScript)
+}
+
+// VerifyOption is an option of the transaction verification functions.
+type VerifyOption func(*verifyOptions)
+
+// verifyOptions holds the options selected by VerifyOption values.
+type verifyOptions struct {
+	// batchSchnorr is set by WithBatchSchnorr and failFast by WithFailFast.
+	batchSchnorr bool
+	failFast     bool
+
+	// rules are set by WithRules, LatestRules by default.
+	rules RuleSet
+}
+
+// newVerifyOptions returns the options selected by opts.
+func newVerifyOptions(opts []VerifyOption) verifyOptions {
+	o := verifyOptions{rules: LatestRules}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithBatchSchnorr makes the verification functions check the Schnorr
+// signatures of all inputs at once with BatchVerifySchnorr, which is faster
+// for transactions with many of them.
+func WithBatchSchnorr() VerifyOption {
+	return func(o *verifyOptions) {
+		o.batchSchnorr = true
+	}
+}
+
+// WithRules makes ValidatePolicy check transactions against the upgrades of
+// rules, as returned by ActiveRules for the block including them, instead of
+// the latest ones: scripts run with ScriptFlagsFor(rules) and the policy
+// flags, and the limits of the upgrades not active are not checked.
+func WithRules(rules RuleSet) VerifyOption {
+	return func(o *verifyOptions) {
+		o.rules = rules
+	}
+}
+
+// WithFailFast makes ValidateTxScripts and ValidateTxBatch stop validating the
+// inputs of a transaction at its first failure instead of reporting them all.
+func WithFailFast() VerifyOption {
+	return func(o *verifyOptions) {
+		o.failFast = true
+	}
+}
+
+// ValidatePolicy returns a *PolicyError with all the reasons why nodes would
+// not relay tx, spending the outputs of prevOuts, or nil if they would.  Inputs
+// without scriptSig are assumed to be signed later: their size is estimated
+// with EstimateSignedSize and their scripts are not executed.  Executed
+// scripts must succeed with StandardScriptFlags, or the flags of WithRules.
+func ValidatePolicy(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut, opts ...VerifyOption) error {
+	o := newVerifyOptions(opts)
+	var violations []error
+	violate := func(err error, format string, args ...interface{}) {
+		violations = append(violations, fmt.Errorf("%w: "+format, append([]interface{}{err}, args...)...))
+	}
+
+	if tx.Version < 1 || tx.Version > 2 {
+		violate(ErrTxVersion, "version %d", tx.Version)
+	}
+	size, err := EstimateSignedSize(tx, prevOuts)
+	if err != nil {
+		violations = append(violations, err)
+		size = tx.SerializeSize()
+	}
+	minSize := MinTxSize
+	switch {
+	case !o.rules.Has(UpgradeMagneticAnomaly):
+		minSize = 0
+	case !o.rules.Has(Upgrade9):
+		minSize = minTxSizeMagneticAnomaly
+	}
+	if size < minSize || size > MaxStandardTxSize {
+		violate(ErrTxSize, "%d bytes", size)
+	}
+
+	dataCarrierSize := 0
+	for i, txOut := range tx.TxOut {
+		_, pkScript, err := SplitTokenPrefix(txOut.PkScript)
+		switch {
+		case err != nil:
+			violations = append(violations, fmt.Errorf("output %d: %w", i, err))
+		case isDataCarrier(pkScript):
+			dataCarrierSize += len(pkScript)
+		case !isStandardOutputScript(pkScript):
+			violate(ErrNonStandardScript, "output %d", i)
+		case IsDust(txOut):
+			violate(ErrDustOutput, "output %d pays %v", i, btcutil.Amount(txOut.Value))
+		}
+	}
+	if dataCarrierSize > MaxDataCarrierSize {
+		violate(ErrDataCarrierSize, "%d bytes", dataCarrierSize)
+	}
+
+	flags := ScriptFlagsFor(o.rules) | ScriptDiscourageUpgradableNops
+	sigHashes := txscript.NewTxSigHashes(tx)
+	sigChecks := 0
+	// batch holds the deferred Schnorr signatures, checked by the inputs
+	// listed in batchInputs.
+	var batch []SchnorrVerifyItem
+	var batchInputs []int
+	for i, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) == 0 {
+			continue
+		}
+		if len(txIn.SignatureScript) > MaxStandardScriptSigSize {
+			violate(ErrScriptSigSize, "input %d", i)
+		}
+		if ops, err := parseScript(txIn.SignatureScript); err != nil || !isPushOnly(ops) {
+			violate(ErrNotPushOnly, "input %d", i)
+			continue
+		}
+		prevOut, ok := prevOuts[i]
+		if !ok {
+			continue
+		}
+		vm, err := NewEngine(prevOut.PkScript, tx, i, flags, sigHashes, prevOut.Value)
+		if err == nil {
+			if o.batchSchnorr {
+				vm.DeferSchnorr()
+			}
+			err = vm.Execute()
+		}
+		if err != nil {
+			violations = append(violations, fmt.Errorf("input %d: %w", i, err))
+			continue
+		}
+		sigChecks += vm.SigChecks()
+		for _, item := range vm.DeferredSchnorr() {
+			batch = append(batch, item)
+			batchInputs = append(batchInputs, i)
+		}
+	}
+	var batchErr *BatchVerifyError
+	if err := BatchVerifySchnorr(batch); errors.As(err, &batchErr) {
+		reported := make(map[int]bool)
+		for _, item := range batchErr.Failed {
+			if i := batchInputs[item]; !reported[i] {
+				reported[i] = true
+				violations = append(violations, fmt.Errorf("input %d: %w: invalid Schnorr signature", i, ErrNullFail))
+			}
+		}
+	} else if err != nil {
+		violations = append(violations, err)
+	}
+	if o.rules.Has(UpgradePhonon) && sigChecks > MaxStandardTxSigChecks {
+		violate(ErrTooManySigChecks, "%d", sigChecks)
+	}
+
+	if err := checkMempoolAcceptFee(tx, prevOuts, size, MinRelayFeeRate); err != nil {
+		violations = append(violations, err)
+	}
+
+	if len(violations) != 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// ValidatePolicy runs ValidatePolicy on the transaction.
+func (u *UnsignedTx) ValidatePolicy() error {
+	return ValidatePolicy(u.Tx, u.PrevOuts)
+}
+
+// SetValidatePolicy makes Build fail with the *PolicyError returned by
+// ValidatePolicy when nodes would not relay the transaction it built.
+func (b *TxBuilder) SetValidatePolicy() {
+	b.validatePolicy = true
+}
@@ -0,0 +1,106 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	key := signingTestKeys()[0]
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	prevOuts := map[int]*wire.TxOut{0: wire.NewTxOut(100000, pkScript), 1: wire.NewTxOut(1000, pkScript)}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(99000, pkScript))
+	sign := func() {
+		scriptSig, err := SignatureScript(tx, 0, pkScript, txscript.SigHashAll|SigHashForkID, key, true, 100000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TxIn[0].SignatureScript = scriptSig
+	}
+	sign()
+	if err := ValidatePolicy(tx, prevOuts); err != nil {
+		t.Fatal(err)
+	}
+	vm, _ := NewEngine(pkScript, tx, 0, StandardScriptFlags, nil, 100000)
+	if err := vm.Execute(); err != nil || vm.SigChecks() != 1 {
+		t.Fatalf("got %d signature checks, %v", vm.SigChecks(), err)
+	}
+
+	data, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).AddData(bytes.Repeat([]byte{1}, 150)).Script()
+	tx.Version = 3
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{2}}, []byte{txscript.OP_DUP}, nil))
+	tx.TxOut[0].Value = 100900
+	tx.AddTxOut(wire.NewTxOut(0, data))
+	tx.AddTxOut(wire.NewTxOut(0, data))
+	tx.AddTxOut(wire.NewTxOut(100, pkScript))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{txscript.OP_TRUE}))
+	sign()
+	err := ValidatePolicy(tx, prevOuts)
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("got %v, want a PolicyError", err)
+	}
+	for _, want := range []error{ErrTxVersion, ErrDataCarrierSize, ErrDustOutput, ErrNonStandardScript,
+		ErrNotPushOnly, ErrFeeTooLow} {
+		if !errors.Is(err, want) {
+			t.Errorf("%v not reported", want)
+		}
+	}
+	if len(policyErr.Violations) != 6 {
+		t.Errorf("got %d violations: %v", len(policyErr.Violations), err)
+	}
+}
+
+// TestValidatePolicyTokenInput validates a transaction spending a token
+// output to a token output.
+func TestValidatePolicyTokenInput(t *testing.T) {
+	key := signingTestKeys()[0]
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	token := &TokenData{Category: chainhash.Hash{7}, HasNFT: true, Commitment: []byte{1}}
+	tokenScript := append(token.Bytes(), pkScript...)
+	prevOuts := map[int]*wire.TxOut{0: wire.NewTxOut(100000, tokenScript)}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(99000, tokenScript))
+	scriptSig, err := SignatureScript(tx, 0, pkScript, SigHashAllForkID, key, true, 100000,
+		WithTokenPrevout(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TxIn[0].SignatureScript = scriptSig
+	if err := ValidatePolicy(tx, prevOuts); err != nil {
+		t.Fatal(err)
+	}
+
+	// A signature not committing to the token is invalid.
+	tx.TxIn[0].SignatureScript, _ = SignatureScript(tx, 0, pkScript, SigHashAllForkID, key, true, 100000)
+	if err := ValidatePolicy(tx, prevOuts); !errors.Is(err, ErrNullFail) {
+		t.Errorf("got %v, want %v", err, ErrNullFail)
+	}
+}
+
+func TestBuilderValidatePolicy(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	data, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).AddData(bytes.Repeat([]byte{1}, 250)).Script()
+	b := NewTxBuilder(1000, pkScript)
+	b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 100000, PkScript: pkScript})
+	b.AddOutput(wire.NewTxOut(10000, pkScript))
+	b.AddOutput(wire.NewTxOut(0, data))
+	if _, err := b.Build(); err != nil {
+		t.Fatal(err)
+	}
+	b.AddOutput(wire.NewTxOut(10, pkScript))
+	b.SetValidatePolicy()
+	_, err := b.Build()
+	if !errors.Is(err, ErrDataCarrierSize) || !errors.Is(err, ErrDustOutput) {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var (
+	// ErrBadTarget describes an error where the target of a block header
+	// is not positive, or above the proof of work limit of the network.
+	ErrBadTarget = errors.New("block target out of range")
+
+	// ErrHashAboveTarget describes an error where the hash of a block
+	// header is above its target.
+	ErrHashAboveTarget = errors.New("block hash above target")
+)
+
+// oneLsh256 is 2^256, the number of possible block hashes.
+var oneLsh256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// CompactToBig returns the target encoded by the compact nBits form of block
+// headers: a base 256 exponent in the high byte, the sign in bit 23 and a 23
+// bit mantissa, so that the target is mantissa * 256^(exponent-3), negated if
+// the sign bit is set.
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	negative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var n *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		n = big.NewInt(int64(mantissa))
+	} else {
+		n = big.NewInt(int64(mantissa))
+		n.Lsh(n, 8*(exponent-3))
+	}
+	if negative {
+		n.Neg(n)
+	}
+	return n
+}
+
+// BigToCompact returns the compact nBits form of n, the inverse of
+// CompactToBig for the values it encodes.  Mantissas whose high bit would be
+// read as the sign bit are shifted by a byte, increasing the exponent.
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+	var mantissa uint32
+	exponent := uint(len(n.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(n.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tn := new(big.Int).Abs(n)
+		mantissa = uint32(tn.Rsh(tn, 8*(exponent-3)).Bits()[0])
+	}
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+	compact := uint32(exponent<<24) | mantissa
+	if n.Sign() < 0 {
+		compact |= 0x00800000
+	}
+	return compact
+}
+
+// HashToBig returns the hash as the little endian number compared with
+// targets.
+func HashToBig(hash *chainhash.Hash) *big.Int {
+	var buf chainhash.Hash
+	for i := range hash {
+		buf[chainhash.HashSize-1-i] = hash[i]
+	}
+	return new(big.Int).SetBytes(buf[:])
+}
+
+// CheckProofOfWork returns an error wrapping ErrBadTarget if the target of
+// header is not positive or above powLimit, the ProofOfWorkLimit of the
+// network, and ErrHashAboveTarget if its hash is above its target.
+func CheckProofOfWork(header *wire.BlockHeader, powLimit *big.Int) error {
+	hash := header.BlockHash()
+	return checkProofOfWork(&hash, header.Bits, powLimit)
+}
+
+// checkProofOfWork checks the proof of work of the block of hash and compact
+// target bits like CheckProofOfWork.
+func checkProofOfWork(hash *chainhash.Hash, bits uint32, powLimit *big.Int) error {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return fmt.Errorf("%w: target %064x is not positive", ErrBadTarget, target)
+	}
+	if target.Cmp(powLimit) > 0 {
+		return fmt.Errorf("%w: target %064x above the limit %064x", ErrBadTarget, target, powLimit)
+	}
+	if HashToBig(hash).Cmp(target) > 0 {
+		return fmt.Errorf("%w: hash %v, target %064x", ErrHashAboveTarget, hash, target)
+	}
+	return nil
+}
+
+// CalcWork returns the work of a block of compact target bits, the expected
+// number of hashes to find it: 2^256 / (target + 1).  Blocks whose target is
+// not positive have no work.
+func CalcWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Div(oneLsh256, target.Add(target, big.NewInt(1)))
+}
+
+// ChainWork returns the sum of the work of headers.
+func ChainWork(headers []*wire.BlockHeader) *big.Int {
+	work := big.NewInt(0)
+	for _, header := range headers {
+		work.Add(work, CalcWork(header.Bits))
+	}
+	return work
+}
+
+// CompareChainWork compares the work of the competing header chains a and b,
+// from their common ancestor, and returns -1, 0 or 1 if a has less, as much or
+// more work than b.  Nodes follow the chain with the most work, keeping the
+// first seen of chains with as much.
+func CompareChainWork(a, b []*wire.BlockHeader) int {
+	return ChainWork(a).Cmp(ChainWork(b))
+}
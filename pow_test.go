@@ -0,0 +1,89 @@
+package bchutil
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestCompactToBig(t *testing.T) {
+	tests := []struct {
+		compact uint32
+		n       int64
+		// canonical is the encoding of n, when compact is not.
+		canonical uint32
+	}{
+		{0, 0, 0},
+		{0x01003456, 0, 0},
+		{0x01123456, 0x12, 0x01120000},
+		{0x02008000, 0x80, 0x02008000},
+		{0x05009234, 0x92340000, 0x05009234},
+		{0x04923456, -0x12345600, 0x04923456},
+		{0x04123456, 0x12345600, 0x04123456},
+	}
+	for _, test := range tests {
+		n := CompactToBig(test.compact)
+		if n.Cmp(big.NewInt(test.n)) != 0 {
+			t.Errorf("%08x: got %x, want %x", test.compact, n, test.n)
+		}
+		if got := BigToCompact(n); got != test.canonical {
+			t.Errorf("%x: got %08x, want %08x", n, got, test.canonical)
+		}
+	}
+	limit := chaincfg.MainNetParams.PowLimit
+	if got := BigToCompact(limit); got != chaincfg.MainNetParams.PowLimitBits {
+		t.Errorf("got %08x, want %08x", got, chaincfg.MainNetParams.PowLimitBits)
+	}
+}
+
+func TestCheckProofOfWork(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	genesis := params.GenesisBlock.Header
+	if err := CheckProofOfWork(&genesis, params.PowLimit); err != nil {
+		t.Fatal(err)
+	}
+
+	header := genesis
+	header.Nonce++
+	if err := CheckProofOfWork(&header, params.PowLimit); !errors.Is(err, ErrHashAboveTarget) {
+		t.Errorf("got %v, want ErrHashAboveTarget", err)
+	}
+	for _, bits := range []uint32{0, 0x04923456, 0x1e00ffff} {
+		header.Bits = bits
+		if err := CheckProofOfWork(&header, params.PowLimit); !errors.Is(err, ErrBadTarget) {
+			t.Errorf("bits %08x: got %v, want ErrBadTarget", bits, err)
+		}
+	}
+}
+
+func TestChainWork(t *testing.T) {
+	if got := CalcWork(0x1d00ffff); got.Cmp(big.NewInt(0x100010001)) != 0 {
+		t.Errorf("got %x, want 100010001", got)
+	}
+	if got := CalcWork(0x04923456); got.Sign() != 0 {
+		t.Errorf("got work %v for negative target", got)
+	}
+
+	easy := &wire.BlockHeader{Bits: 0x1d00ffff}
+	hard := &wire.BlockHeader{Bits: 0x1c00ffff}
+	if got := ChainWork([]*wire.BlockHeader{easy, easy}); got.Cmp(big.NewInt(2*0x100010001)) != 0 {
+		t.Errorf("got %x", got)
+	}
+	tests := []struct {
+		a, b []*wire.BlockHeader
+		want int
+	}{
+		{[]*wire.BlockHeader{easy, easy, easy}, []*wire.BlockHeader{hard}, -1},
+		{[]*wire.BlockHeader{hard}, []*wire.BlockHeader{easy, easy}, 1},
+		{[]*wire.BlockHeader{easy}, []*wire.BlockHeader{easy}, 0},
+		{nil, []*wire.BlockHeader{easy}, -1},
+	}
+	for i, test := range tests {
+		if got := CompareChainWork(test.a, test.b); got != test.want {
+			t.Errorf("test %d: got %d, want %d", i, got, test.want)
+		}
+	}
+}
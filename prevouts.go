@@ -0,0 +1,117 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+var (
+	// ErrPrevOutMismatch describes an error where the amount or script
+	// claimed for an output spent differs from that of the UTXO view.
+	ErrPrevOutMismatch = errors.New("previous output mismatch")
+
+	// ErrPrevOutUnknown describes an error where an output spent is not
+	// known to the UTXO view, as unconfirmed parents may not be.
+	ErrPrevOutUnknown = errors.New("previous output unknown")
+)
+
+// PrevOutDiff is an output spent by an input whose claimed amount or script
+// differs from the actual one.
+type PrevOutDiff struct {
+	Input   int
+	Claimed *wire.TxOut
+	Actual  *wire.TxOut
+}
+
+// String returns the input and the fields differing.
+func (d *PrevOutDiff) String() string {
+	var diffs []string
+	if d.Claimed.Value != d.Actual.Value {
+		diffs = append(diffs, fmt.Sprintf("amount %v claimed, %v actual", btcutil.Amount(d.Claimed.Value),
+			btcutil.Amount(d.Actual.Value)))
+	}
+	if !bytes.Equal(d.Claimed.PkScript, d.Actual.PkScript) {
+		diffs = append(diffs, fmt.Sprintf("script %x claimed, %x actual", d.Claimed.PkScript, d.Actual.PkScript))
+	}
+	return fmt.Sprintf("input %d: %s", d.Input, strings.Join(diffs, ", "))
+}
+
+// PrevOutError lists the claimed outputs spent by a transaction that differ
+// from the UTXO view, and the inputs whose outputs it does not know.
+type PrevOutError struct {
+	Mismatches []PrevOutDiff
+	Unknown    []int
+}
+
+// Error returns the differences and the unknown outputs.
+func (e *PrevOutError) Error() string {
+	var msgs []string
+	for i := range e.Mismatches {
+		msgs = append(msgs, e.Mismatches[i].String())
+	}
+	if len(e.Mismatches) != 0 {
+		msgs[0] = ErrPrevOutMismatch.Error() + ": " + msgs[0]
+	}
+	if len(e.Unknown) != 0 {
+		inputs := make([]string, len(e.Unknown))
+		for i, idx := range e.Unknown {
+			inputs[i] = fmt.Sprint(idx)
+		}
+		msgs = append(msgs, fmt.Sprintf("%v: inputs %s", ErrPrevOutUnknown, strings.Join(inputs, ", ")))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns ErrPrevOutMismatch if outputs differ and ErrPrevOutUnknown if
+// outputs are unknown.
+func (e *PrevOutError) Unwrap() []error {
+	var errs []error
+	if len(e.Mismatches) != 0 {
+		errs = append(errs, ErrPrevOutMismatch)
+	}
+	if len(e.Unknown) != 0 {
+		errs = append(errs, ErrPrevOutUnknown)
+	}
+	return errs
+}
+
+// VerifyPrevOuts checks the outputs claimed to be spent by the inputs of tx,
+// by input index, against those of fetcher, an authoritative UTXO view, as
+// signatures committing to stale amounts are invalid.  It returns a
+// *PrevOutError listing the inputs whose claimed amount or script differs,
+// and separately those whose output fetcher does not know.
+func VerifyPrevOuts(tx *wire.MsgTx, claimed map[int]*wire.TxOut, fetcher PrevOutputFetcher) error {
+	indexes := make([]int, 0, len(claimed))
+	for idx := range claimed {
+		if idx < 0 || idx >= len(tx.TxIn) {
+			return fmt.Errorf("input index %d out of range", idx)
+		}
+		if claimed[idx] == nil {
+			return fmt.Errorf("input %d: no output claimed", idx)
+		}
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	var prevOutErr PrevOutError
+	for _, idx := range indexes {
+		actual := fetcher.FetchPrevOutput(tx.TxIn[idx].PreviousOutPoint)
+		switch {
+		case actual == nil:
+			prevOutErr.Unknown = append(prevOutErr.Unknown, idx)
+		case actual.Value != claimed[idx].Value || !bytes.Equal(actual.PkScript, claimed[idx].PkScript):
+			prevOutErr.Mismatches = append(prevOutErr.Mismatches,
+				PrevOutDiff{Input: idx, Claimed: claimed[idx], Actual: actual})
+		}
+	}
+	if len(prevOutErr.Mismatches) != 0 || len(prevOutErr.Unknown) != 0 {
+		return &prevOutErr
+	}
+	return nil
+}
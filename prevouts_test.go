@@ -0,0 +1,65 @@
+package bchutil
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestVerifyPrevOuts(t *testing.T) {
+	paths := map[int]Path{
+		0: BIP44Path(0, ExternalChain, 0),
+		1: BIP44Path(0, ExternalChain, 1),
+	}
+	tx, prevOuts := pathSignTestTx(t, paths)
+	view := make(testPrevOutputFetcher)
+	for idx, prevOut := range prevOuts {
+		view[tx.TxIn[idx].PreviousOutPoint] = wire.NewTxOut(prevOut.Value, prevOut.PkScript)
+	}
+	if err := VerifyPrevOuts(tx, prevOuts, view); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := map[int]*wire.TxOut{
+		0: wire.NewTxOut(prevOuts[0].Value+1, prevOuts[0].PkScript),
+		1: wire.NewTxOut(prevOuts[1].Value, prevOuts[0].PkScript),
+	}
+	err := VerifyPrevOuts(tx, stale, view)
+	var prevOutErr *PrevOutError
+	if !errors.As(err, &prevOutErr) || !errors.Is(err, ErrPrevOutMismatch) || errors.Is(err, ErrPrevOutUnknown) {
+		t.Fatalf("got %v, want a PrevOutError", err)
+	}
+	if len(prevOutErr.Mismatches) != 2 || prevOutErr.Mismatches[0].Input != 0 ||
+		!strings.Contains(err.Error(), "input 0: amount") || !strings.Contains(err.Error(), "input 1: script") {
+		t.Errorf("got %v", err)
+	}
+
+	// Unknown outputs are reported apart from mismatches.
+	delete(view, tx.TxIn[1].PreviousOutPoint)
+	err = VerifyPrevOuts(tx, prevOuts, view)
+	if !errors.As(err, &prevOutErr) || !errors.Is(err, ErrPrevOutUnknown) || errors.Is(err, ErrPrevOutMismatch) ||
+		len(prevOutErr.Unknown) != 1 || prevOutErr.Unknown[0] != 1 {
+		t.Errorf("got %v", err)
+	}
+	if err := VerifyPrevOuts(tx, map[int]*wire.TxOut{5: prevOuts[0]}, view); err == nil {
+		t.Error("input out of range accepted")
+	}
+
+	// The batch signer checks the outputs before signing anything.
+	hashType := txscript.SigHashAll | SigHashForkID
+	err = SignInputsWithPaths(tx, stale, hashType, nil, descTestKey(), paths, WithPrevOutVerification(view, true))
+	if !errors.Is(err, ErrPrevOutMismatch) || len(tx.TxIn[0].SignatureScript) != 0 {
+		t.Errorf("got %v", err)
+	}
+	err = SignInputsWithPaths(tx, prevOuts, hashType, nil, descTestKey(), paths, WithPrevOutVerification(view, false))
+	if !errors.Is(err, ErrPrevOutUnknown) {
+		t.Errorf("got %v, want %v", err, ErrPrevOutUnknown)
+	}
+	err = SignInputsWithPaths(tx, prevOuts, hashType, nil, descTestKey(), paths, WithPrevOutVerification(view, true))
+	if err != nil || len(tx.TxIn[0].SignatureScript) == 0 {
+		t.Errorf("unknown output allowed: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// A proof of reserves shows control of a set of unspent outputs without
+// moving them, with a transaction signing their spend that can never be
+// valid.  Provers and verifiers build the same commitment transaction:
+//
+//   - Its version is 1 and its locktime 0.
+//   - Input 0 spends output 0 of the transaction whose id is the SHA-256 of
+//     proofOfReservesTag followed by the challenge, which does not exist.
+//     Its scriptSig is empty.
+//   - Inputs 1 to n spend the outputs proven, in the order given, with the
+//     scriptSig of a SIGHASH_ALL|FORKID signature of their pay-to-pubkey-hash
+//     or pay-to-pubkey script.  The signatures commit to the tokens of the
+//     outputs, if any.
+//   - All the sequences are final.
+//   - Its only output pays nothing to a bare OP_RETURN script.
+//
+// As the signatures cover every input, they commit to the challenge and can't
+// be replayed against another one, nor used to spend the outputs.
+
+// proofOfReservesTag prefixes the challenge hashed to the prevout of the
+// first input of a proof of reserves.
+const proofOfReservesTag = "Proof-of-Reserves: "
+
+// ErrInvalidProofOfReserves describes an error where a proof of reserves is
+// not the commitment transaction of its challenge and outputs, or one of its
+// signatures does not verify.
+var ErrInvalidProofOfReserves = errors.New("invalid proof of reserves")
+
+// KeySource provides the private keys of the outputs to sign, such as the
+// keys of a wallet.
+type KeySource interface {
+	// PrivKey returns the private key paid to by pkScript, a
+	// pay-to-pubkey-hash or pay-to-pubkey script without token prefix.
+	PrivKey(pkScript []byte) (*btcec.PrivateKey, error)
+}
+
+// ProofOfReservesChallengeHash returns the prevout hash of the first input of
+// the proofs of reserves for challenge.
+func ProofOfReservesChallengeHash(challenge []byte) chainhash.Hash {
+	return chainhash.HashH(append([]byte(proofOfReservesTag), challenge...))
+}
+
+// BuildProofOfReserves returns the proof of reserves of utxos for challenge,
+// each signed with the key of keys it pays to.  The outputs must be
+// pay-to-pubkey-hash or pay-to-pubkey ones, spent once.
+func BuildProofOfReserves(utxos []UTXO, challenge []byte, keys KeySource) (*wire.MsgTx, error) {
+	tx, err := proofOfReservesTx(utxos, challenge)
+	if err != nil {
+		return nil, err
+	}
+	o := newSignOptions(nil)
+	o.sigHashes = txscript.NewTxSigHashes(tx)
+	for i := range utxos {
+		u := &utxos[i]
+		idx := i + 1
+		key, err := keys.PrivKey(u.PkScript)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", idx, err)
+		}
+		pubKey, isP2PK, ok := proofOfReservesPubKey(u.PkScript, key.PubKey())
+		if !ok {
+			return nil, fmt.Errorf("input %d: %w", idx, ErrKeyNotInScript)
+		}
+		o.token = nil
+		if u.HasTokens() {
+			if o.token, _, err = ParseTokenData(u.TokenData); err != nil {
+				return nil, fmt.Errorf("input %d: %w", idx, err)
+			}
+		}
+		sig, err := o.signInput(tx, idx, u.PkScript, SigHashAllForkID, key, int64(u.Amount))
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", idx, err)
+		}
+		if tx.TxIn[idx].SignatureScript, err = pathScriptSig(sig, pubKey, isP2PK); err != nil {
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// VerifyProofOfReserves checks that tx is the proof of reserves of utxos for
+// challenge, with valid signatures for all of them, and returns the amount
+// they prove.
+func VerifyProofOfReserves(tx *wire.MsgTx, utxos []UTXO, challenge []byte) (btcutil.Amount, error) {
+	expected, err := proofOfReservesTx(utxos, challenge)
+	if err != nil {
+		return 0, err
+	}
+	unsigned := tx.Copy()
+	for _, txIn := range unsigned.TxIn {
+		txIn.SignatureScript = nil
+	}
+	var got, want bytes.Buffer
+	if err := unsigned.Serialize(&got); err != nil {
+		return 0, err
+	}
+	if err := expected.Serialize(&want); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		return 0, fmt.Errorf("%w: not the commitment transaction of the challenge and outputs",
+			ErrInvalidProofOfReserves)
+	}
+	if len(tx.TxIn[0].SignatureScript) != 0 {
+		return 0, fmt.Errorf("%w: challenge input has a scriptSig", ErrInvalidProofOfReserves)
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx)
+	var total btcutil.Amount
+	for i := range utxos {
+		u := &utxos[i]
+		idx := i + 1
+		if err := verifyProofOfReservesInput(tx, idx, u, sigHashes); err != nil {
+			return 0, fmt.Errorf("%w: input %d: %v", ErrInvalidProofOfReserves, idx, err)
+		}
+		if total, err = AddChecked(total, u.Amount); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// proofOfReservesTx returns the unsigned commitment transaction of utxos for
+// challenge.
+func proofOfReservesTx(utxos []UTXO, challenge []byte) (*wire.MsgTx, error) {
+	if len(challenge) == 0 {
+		return nil, errors.New("empty proof of reserves challenge")
+	}
+	if len(utxos) == 0 {
+		return nil, errors.New("no outputs to prove")
+	}
+	seen := make(map[wire.OutPoint]bool, len(utxos))
+	tx := wire.NewMsgTx(wire.TxVersion)
+	challengeHash := ProofOfReservesChallengeHash(challenge)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&challengeHash, 0), nil, nil))
+	for i := range utxos {
+		u := &utxos[i]
+		if seen[u.OutPoint] {
+			return nil, fmt.Errorf("output %v proven twice", u.OutPoint)
+		}
+		seen[u.OutPoint] = true
+		if err := CheckAmount(u.Amount); err != nil {
+			return nil, fmt.Errorf("output %v: %w", u.OutPoint, err)
+		}
+		outPoint := u.OutPoint
+		tx.AddTxIn(wire.NewTxIn(&outPoint, nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return tx, nil
+}
+
+// proofOfReservesPubKey returns the serialization of pubKey that pkScript
+// pays to, compressed or not, and whether pkScript is pay-to-pubkey.  ok is
+// false when pkScript pays to neither.
+func proofOfReservesPubKey(pkScript []byte, pubKey *btcec.PublicKey) (serialized []byte, isP2PK, ok bool) {
+	for _, serialized := range [][]byte{pubKey.SerializeCompressed(), pubKey.SerializeUncompressed()} {
+		p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(serialized))
+		if bytes.Equal(pkScript, p2pkh) {
+			return serialized, false, true
+		}
+		p2pk, _ := txscript.NewScriptBuilder().AddData(serialized).AddOp(txscript.OP_CHECKSIG).Script()
+		if bytes.Equal(pkScript, p2pk) {
+			return serialized, true, true
+		}
+	}
+	return nil, false, false
+}
+
+// verifyProofOfReservesInput checks the SIGHASH_ALL|FORKID signature of input
+// idx of tx spending u.
+func verifyProofOfReservesInput(tx *wire.MsgTx, idx int, u *UTXO, sigHashes *txscript.TxSigHashes) error {
+	ops, err := parseScript(tx.TxIn[idx].SignatureScript)
+	if err != nil {
+		return err
+	}
+	if !isPushOnly(ops) {
+		return errors.New("scriptSig is not push only")
+	}
+
+	var sig, pubKey []byte
+	switch GetScriptClass(u.PkScript) {
+	case txscript.PubKeyHashTy:
+		if len(ops) != 2 {
+			return errors.New("pay-to-pubkey-hash scriptSig without a signature and a public key")
+		}
+		sig, pubKey = ops[0].data, ops[1].data
+		if !bytes.Equal(btcutil.Hash160(pubKey), u.PkScript[3:23]) {
+			return errors.New("public key does not match the output")
+		}
+	case txscript.PubKeyTy:
+		if len(ops) != 1 {
+			return errors.New("pay-to-pubkey scriptSig without a single signature")
+		}
+		sig, pubKey = ops[0].data, u.PkScript[1:len(u.PkScript)-1]
+	default:
+		return fmt.Errorf("%w: output is not pay-to-pubkey-hash or pay-to-pubkey", ErrNonStandardScript)
+	}
+
+	if len(sig) == 0 || txscript.SigHashType(sig[len(sig)-1]) != SigHashAllForkID {
+		return fmt.Errorf("%w: signature is not %s", ErrUnsupportedSigHashType, SigHashTypeString(SigHashAllForkID))
+	}
+	hash := calcSignatureHash(u.PkScript, sigHashes, SigHashAllForkID, tx, idx, int64(u.Amount), 0, u.TokenData)
+	if !verifySignature(sig[:len(sig)-1], pubKey, hash, true) {
+		return errors.New("signature does not verify")
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// reservesTestKeys is a KeySource of keys by the scripts they pay to.
+type reservesTestKeys map[string]*btcec.PrivateKey
+
+func (k reservesTestKeys) PrivKey(pkScript []byte) (*btcec.PrivateKey, error) {
+	key, ok := k[string(pkScript)]
+	if !ok {
+		return nil, errors.New("unknown script")
+	}
+	return key, nil
+}
+
+// reservesTestUTXOs returns the outputs of the test keys, pay-to-pubkey-hash
+// compressed, pay-to-pubkey uncompressed and pay-to-pubkey-hash with tokens.
+func reservesTestUTXOs(t *testing.T) ([]UTXO, reservesTestKeys) {
+	keys := signingTestKeys()
+	p2pkh, err := payToPubKeyHashScript(btcutil.Hash160(keys[0].PubKey().SerializeCompressed()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pk, err := txscript.NewScriptBuilder().AddData(keys[1].PubKey().SerializeUncompressed()).
+		AddOp(txscript.OP_CHECKSIG).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &TokenData{Category: chainhash.Hash{7}, Amount: 1000}
+	utxos := []UTXO{
+		{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 150000, PkScript: p2pkh},
+		{OutPoint: wire.OutPoint{Hash: chainhash.Hash{2}, Index: 3}, Amount: 25000, PkScript: p2pk},
+		{OutPoint: wire.OutPoint{Hash: chainhash.Hash{3}, Index: 1}, Amount: 1000, PkScript: p2pkh,
+			TokenData: token.Bytes()},
+	}
+	return utxos, reservesTestKeys{string(p2pkh): keys[0], string(p2pk): keys[1]}
+}
+
+func TestProofOfReserves(t *testing.T) {
+	utxos, keys := reservesTestUTXOs(t)
+	challenge := []byte("audit 2026-10-14")
+	tx, err := BuildProofOfReserves(utxos, challenge, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The construction the verifiers rebuild independently.
+	want := sha256.Sum256(append([]byte("Proof-of-Reserves: "), challenge...))
+	if tx.Version != 1 || tx.LockTime != 0 || len(tx.TxIn) != len(utxos)+1 {
+		t.Fatalf("version %d, locktime %d, %d inputs", tx.Version, tx.LockTime, len(tx.TxIn))
+	}
+	if tx.TxIn[0].PreviousOutPoint != (wire.OutPoint{Hash: want, Index: 0}) ||
+		len(tx.TxIn[0].SignatureScript) != 0 {
+		t.Fatalf("challenge input %v, scriptSig %x", tx.TxIn[0].PreviousOutPoint, tx.TxIn[0].SignatureScript)
+	}
+	for i, u := range utxos {
+		if txIn := tx.TxIn[i+1]; txIn.PreviousOutPoint != u.OutPoint || txIn.Sequence != wire.MaxTxInSequenceNum {
+			t.Fatalf("input %d spends %v with sequence %x", i+1, txIn.PreviousOutPoint, txIn.Sequence)
+		}
+	}
+	if len(tx.TxOut) != 1 || tx.TxOut[0].Value != 0 || !bytes.Equal(tx.TxOut[0].PkScript, []byte{txscript.OP_RETURN}) {
+		t.Fatalf("outputs %v", tx.TxOut)
+	}
+
+	// The script engine, which does not commit to tokens, accepts the
+	// inputs without.
+	for i, u := range utxos[:2] {
+		vm, err := NewEngine(u.PkScript, tx, i+1, StandardScriptFlags, nil, int64(u.Amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Fatalf("input %d: %v", i+1, err)
+		}
+	}
+
+	total, err := VerifyProofOfReserves(tx, utxos, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 176000 {
+		t.Fatalf("proven %v, want 176000 satoshis", total)
+	}
+}
+
+func TestVerifyProofOfReservesRejects(t *testing.T) {
+	utxos, keys := reservesTestUTXOs(t)
+	challenge := []byte("audit")
+	tx, err := BuildProofOfReserves(utxos, challenge, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherAmount := append([]UTXO(nil), utxos...)
+	otherAmount[0].Amount++
+	otherToken := append([]UTXO(nil), utxos...)
+	otherToken[2].TokenData = (&TokenData{Category: chainhash.Hash{7}, Amount: 999}).Bytes()
+	spendable := tx.Copy()
+	spendable.TxIn[0].PreviousOutPoint.Hash = chainhash.Hash{1}
+	challengeSigned := tx.Copy()
+	challengeSigned.TxIn[0].SignatureScript = []byte{txscript.OP_TRUE}
+	swapped := tx.Copy()
+	swapped.TxIn[1].SignatureScript, swapped.TxIn[3].SignatureScript =
+		swapped.TxIn[3].SignatureScript, swapped.TxIn[1].SignatureScript
+	paying := tx.Copy()
+	paying.TxOut[0].Value = 1
+
+	tests := []struct {
+		name      string
+		tx        *wire.MsgTx
+		utxos     []UTXO
+		challenge []byte
+	}{
+		{"other challenge", tx, utxos, []byte("audit2")},
+		{"missing output", tx, utxos[:2], challenge},
+		{"other amount", tx, otherAmount, challenge},
+		{"other token", tx, otherToken, challenge},
+		{"spendable challenge input", spendable, utxos, challenge},
+		{"signed challenge input", challengeSigned, utxos, challenge},
+		{"swapped signatures", swapped, utxos, challenge},
+		{"paying output", paying, utxos, challenge},
+	}
+	for _, test := range tests {
+		if _, err := VerifyProofOfReserves(test.tx, test.utxos, test.challenge); !errors.Is(err,
+			ErrInvalidProofOfReserves) {
+			t.Errorf("%s: got %v, want ErrInvalidProofOfReserves", test.name, err)
+		}
+	}
+}
+
+func TestBuildProofOfReservesErrors(t *testing.T) {
+	utxos, keys := reservesTestUTXOs(t)
+	if _, err := BuildProofOfReserves(utxos, nil, keys); err == nil {
+		t.Error("empty challenge accepted")
+	}
+	if _, err := BuildProofOfReserves(append(utxos, utxos[0]), []byte("audit"), keys); err == nil {
+		t.Error("output proven twice accepted")
+	}
+
+	// A key not paid to by the output.
+	wrongKeys := reservesTestKeys{}
+	for script := range keys {
+		wrongKeys[script] = keys[string(utxos[1].PkScript)]
+	}
+	if _, err := BuildProofOfReserves(utxos, []byte("audit"), wrongKeys); !errors.Is(err, ErrKeyNotInScript) {
+		t.Errorf("got %v, want ErrKeyNotInScript", err)
+	}
+}
@@ -0,0 +1,203 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// maxMineNonces is the number of nonces MineBlock tries, which finds one on
+// regtest, whose target passes about half the hashes, all but never failing.
+const maxMineNonces = 1 << 16
+
+// mineOptions are the options of MineBlock.
+type mineOptions struct {
+	fetcher PrevOutputFetcher
+}
+
+// MineOption is an option of MineBlock.
+type MineOption func(*mineOptions)
+
+// MineWithPrevOutputs makes MineBlock find the outputs spent by the
+// transactions of the block with fetcher, unless the block creates them.
+func MineWithPrevOutputs(fetcher PrevOutputFetcher) MineOption {
+	return func(o *mineOptions) {
+		o.fetcher = fetcher
+	}
+}
+
+// MineBlock returns the block at height following prevHeader, the genesis
+// block of params if nil, with txs, on a network of trivial proof of work
+// such as regtest.  Its coinbase pushes height as BIP 34 requires and pays
+// coinbaseDest the subsidy and the fees of txs, whose outputs spent must be
+// those of the block or found with MineWithPrevOutputs.  The transactions
+// follow the coinbase in the canonical order, the header commits to their
+// merkle root, has the target PowLimitBits of params and a timestamp a second
+// after prevHeader, and its nonce is ground until its hash meets the target,
+// failing with an error wrapping ErrHashAboveTarget when none of the first
+// nonces does on networks of real proof of work.
+func MineBlock(prevHeader *wire.BlockHeader, txs []*btcutil.Tx, coinbaseDest btcutil.Address, height int32,
+	params *chaincfg.Params, opts ...MineOption) (*wire.MsgBlock, error) {
+
+	var o mineOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if params == nil {
+		return nil, errors.New("no network")
+	}
+	if prevHeader == nil {
+		prevHeader = &params.GenesisBlock.Header
+	}
+	if err := CheckNetwork(params, "coinbase address", coinbaseDest); err != nil {
+		return nil, err
+	}
+	pkScript, err := PayToAddrScript(coinbaseDest)
+	if err != nil {
+		return nil, err
+	}
+
+	prevOuts := &blockPrevOuts{outputs: make(map[wire.OutPoint]*wire.TxOut), fetcher: o.fetcher}
+	for _, tx := range txs {
+		for i, txOut := range tx.MsgTx().TxOut {
+			prevOuts.outputs[wire.OutPoint{Hash: *tx.Hash(), Index: uint32(i)}] = txOut
+		}
+	}
+	var fees btcutil.Amount
+	for _, tx := range txs {
+		if IsCoinBaseTx(tx.MsgTx()) {
+			return nil, fmt.Errorf("transaction %v is a coinbase", tx.Hash())
+		}
+		spent := make(map[int]*wire.TxOut, len(tx.MsgTx().TxIn))
+		for i, txIn := range tx.MsgTx().TxIn {
+			if prevOut := prevOuts.FetchPrevOutput(txIn.PreviousOutPoint); prevOut != nil {
+				spent[i] = prevOut
+			}
+		}
+		fee, err := TxFee(tx.MsgTx(), spent)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %v: %w", tx.Hash(), err)
+		}
+		if fees, err = AddChecked(fees, fee); err != nil {
+			return nil, err
+		}
+	}
+	coinbase, err := NewCoinbaseTx(CoinbaseSpec{Height: height, PkScript: pkScript, Params: params}, fees)
+	if err != nil {
+		return nil, err
+	}
+
+	blockTxs := append([]*btcutil.Tx{btcutil.NewTx(coinbase)}, txs...)
+	SortTxsCTOR(blockTxs)
+	block := &wire.MsgBlock{Header: wire.BlockHeader{
+		Version:    blockTemplateVersion,
+		PrevBlock:  prevHeader.BlockHash(),
+		MerkleRoot: CalcMerkleRoot(blockTxs),
+		Timestamp:  prevHeader.Timestamp.Add(time.Second),
+		Bits:       params.PowLimitBits,
+	}}
+	for _, tx := range blockTxs {
+		block.Transactions = append(block.Transactions, tx.MsgTx())
+	}
+	for nonce := uint32(0); nonce < maxMineNonces; nonce++ {
+		block.Header.Nonce = nonce
+		hash := block.Header.BlockHash()
+		if checkProofOfWork(&hash, block.Header.Bits, params.PowLimit) == nil {
+			return block, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: none of %d nonces meets target bits %08x", ErrHashAboveTarget, maxMineNonces,
+		block.Header.Bits)
+}
+
+// RegtestChain is a chain of blocks mined in process with MineBlock, from the
+// genesis block of a network of trivial proof of work, and the outputs left
+// unspent by its blocks, for hermetic integration tests.  Coinbase maturity
+// and the scripts of the transactions are not checked.
+type RegtestChain struct {
+	params *chaincfg.Params
+	blocks []*wire.MsgBlock
+	utxos  map[wire.OutPoint]*wire.TxOut
+}
+
+// NewRegtestChain returns the chain of the genesis block of params, whose
+// outputs are unspendable.
+func NewRegtestChain(params *chaincfg.Params) *RegtestChain {
+	return &RegtestChain{
+		params: params,
+		blocks: []*wire.MsgBlock{params.GenesisBlock},
+		utxos:  make(map[wire.OutPoint]*wire.TxOut),
+	}
+}
+
+// Mine mines the block following the tip with txs, paying its coinbase to
+// coinbaseDest.  The transactions must spend the unspent outputs of the chain
+// or those of the block.
+func (c *RegtestChain) Mine(txs []*btcutil.Tx, coinbaseDest btcutil.Address) (*wire.MsgBlock, error) {
+	block, err := MineBlock(&c.Tip().Header, txs, coinbaseDest, c.Height()+1, c.params, MineWithPrevOutputs(c))
+	if err != nil {
+		return nil, err
+	}
+	c.blocks = append(c.blocks, block)
+	// The outputs spent by the block, its own included, are deleted once
+	// all are added.
+	for _, tx := range block.Transactions {
+		txid := tx.TxHash()
+		for i, txOut := range tx.TxOut {
+			c.utxos[wire.OutPoint{Hash: txid, Index: uint32(i)}] = txOut
+		}
+	}
+	for _, tx := range block.Transactions[1:] {
+		for _, txIn := range tx.TxIn {
+			delete(c.utxos, txIn.PreviousOutPoint)
+		}
+	}
+	return block, nil
+}
+
+// Height returns the height of the tip of the chain, 0 for the genesis block.
+func (c *RegtestChain) Height() int32 {
+	return int32(len(c.blocks) - 1)
+}
+
+// Tip returns the last block of the chain.
+func (c *RegtestChain) Tip() *wire.MsgBlock {
+	return c.blocks[len(c.blocks)-1]
+}
+
+// Block returns the block at height, or nil if the chain is shorter.
+func (c *RegtestChain) Block(height int32) *wire.MsgBlock {
+	if height < 0 || int(height) >= len(c.blocks) {
+		return nil
+	}
+	return c.blocks[height]
+}
+
+// Headers returns the headers of the blocks of the chain following the
+// genesis block, in chain order.
+func (c *RegtestChain) Headers() []*wire.BlockHeader {
+	headers := make([]*wire.BlockHeader, 0, len(c.blocks)-1)
+	for _, block := range c.blocks[1:] {
+		headers = append(headers, &block.Header)
+	}
+	return headers
+}
+
+// FetchPrevOutput implements PrevOutputFetcher with the unspent outputs of
+// the chain.
+func (c *RegtestChain) FetchPrevOutput(op wire.OutPoint) *wire.TxOut {
+	return c.utxos[op]
+}
+
+// CoinbaseOutPoint returns the output of the coinbase of the block at height.
+func (c *RegtestChain) CoinbaseOutPoint(height int32) (wire.OutPoint, error) {
+	block := c.Block(height)
+	if block == nil || height == 0 {
+		return wire.OutPoint{}, fmt.Errorf("no mined block at height %d", height)
+	}
+	return wire.OutPoint{Hash: block.Transactions[0].TxHash(), Index: 0}, nil
+}
@@ -0,0 +1,103 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestMineBlock(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	dest, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := MineBlock(nil, nil, dest, 1, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckProofOfWork(&block.Header, params.PowLimit); err != nil {
+		t.Error(err)
+	}
+	if block.Header.PrevBlock != *params.GenesisHash {
+		t.Errorf("previous block %v", block.Header.PrevBlock)
+	}
+	info, err := ParseCoinbaseScriptSig(block.Transactions[0].TxIn[0].SignatureScript)
+	if err != nil || info.Height != 1 {
+		t.Errorf("coinbase %+v, %v", info, err)
+	}
+
+	if _, err := MineBlock(nil, nil, dest, 1, &chaincfg.MainNetParams); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("mainnet: %v, want ErrNetworkMismatch", err)
+	}
+	mainDest, _ := btcutil.NewAddressPubKeyHash(make([]byte, 20), &chaincfg.MainNetParams)
+	if _, err := MineBlock(nil, nil, mainDest, 1, &chaincfg.MainNetParams); !errors.Is(err, ErrHashAboveTarget) {
+		t.Errorf("mainnet: %v, want ErrHashAboveTarget", err)
+	}
+	spend := wire.NewMsgTx(wire.TxVersion)
+	spend.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	spend.AddTxOut(wire.NewTxOut(1000, nil))
+	if _, err := MineBlock(nil, []*btcutil.Tx{btcutil.NewTx(spend)}, dest, 1, params); err == nil {
+		t.Error("mined a transaction spending an unknown output")
+	}
+}
+
+func TestRegtestChain(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	dest, _ := btcutil.NewAddressPubKeyHash(make([]byte, 20), params)
+	c := NewRegtestChain(params)
+	for i := 0; i < 3; i++ {
+		if _, err := c.Mine(nil, dest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op, err := c.CoinbaseOutPoint(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// parent spends the coinbase of block 1 paying 1000 satoshis of fees,
+	// and child spends parent in the same block paying 500.
+	parent := wire.NewMsgTx(wire.TxVersion)
+	parent.AddTxIn(wire.NewTxIn(&op, nil, nil))
+	parent.AddTxOut(wire.NewTxOut(int64(CalcBlockSubsidy(1, params))-1000, pkScript))
+	child := wire.NewMsgTx(wire.TxVersion)
+	child.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: parent.TxHash()}, nil, nil))
+	child.AddTxOut(wire.NewTxOut(parent.TxOut[0].Value-500, pkScript))
+	block, err := c.Mine([]*btcutil.Tx{btcutil.NewTx(child), btcutil.NewTx(parent)}, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Height() != 4 || c.Tip() != block {
+		t.Errorf("height %d", c.Height())
+	}
+	if got, want := block.Transactions[0].TxOut[0].Value, int64(CalcBlockSubsidy(4, params)+1500); got != want {
+		t.Errorf("coinbase pays %d, want %d", got, want)
+	}
+
+	txs := make([]*btcutil.Tx, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txs[i] = btcutil.NewTx(tx)
+	}
+	if err := CheckBlockTxs(txs, block.Header.MerkleRoot); err != nil {
+		t.Error(err)
+	}
+	prev := *params.GenesisHash
+	for i, header := range c.Headers() {
+		if header.PrevBlock != prev || CheckProofOfWork(header, params.PowLimit) != nil {
+			t.Errorf("header %d does not extend the chain", i+1)
+		}
+		prev = header.BlockHash()
+	}
+	if c.FetchPrevOutput(op) != nil || c.FetchPrevOutput(wire.OutPoint{Hash: parent.TxHash()}) != nil ||
+		c.FetchPrevOutput(wire.OutPoint{Hash: child.TxHash()}) == nil {
+		t.Error("unspent outputs not updated")
+	}
+	if _, err := c.Mine([]*btcutil.Tx{btcutil.NewTx(parent)}, dest); err == nil {
+		t.Error("mined a double spend")
+	}
+}
@@ -0,0 +1,121 @@
+package bchutil
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// signatureHashTypes returns the sighash types of the signatures pushed by
+// scriptSig, as recognized by parseSignaturePush.
+func signatureHashTypes(scriptSig []byte) ([]txscript.SigHashType, error) {
+	ops, err := parseScript(scriptSig)
+	if err != nil {
+		return nil, err
+	}
+	var hashTypes []txscript.SigHashType
+	for _, op := range ops {
+		if sig, ok := parseSignaturePush(op.data); ok {
+			hashTypes = append(hashTypes, sig.HashType)
+		}
+	}
+	return hashTypes, nil
+}
+
+// ReplaceInput makes input idx of tx spend newOutPoint, the outpoint of
+// newPrevOut, keeping its sequence, and records newPrevOut in prevOuts, the
+// outputs spent by the inputs of tx.
+//
+// Changing an outpoint changes the digest of every signature that does not use
+// SIGHASH_ANYONECANPAY, so the scriptSig of input idx and of the inputs with
+// such a signature are cleared.  The returned map holds the inputs to sign
+// again with the sighash type they were signed with, SIGHASH_ALL if unknown,
+// and can be passed to ResignInputs.  Inputs only signed with
+// SIGHASH_ANYONECANPAY are left untouched.
+func ReplaceInput(tx *wire.MsgTx, idx int, newOutPoint wire.OutPoint, newPrevOut *wire.TxOut,
+	prevOuts map[int]*wire.TxOut) (map[int]txscript.SigHashType, error) {
+
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("input index %d out of range", idx)
+	}
+	if newPrevOut == nil || prevOuts == nil {
+		return nil, fmt.Errorf("previous output of input %d missing", idx)
+	}
+	for i, txIn := range tx.TxIn {
+		if i != idx && txIn.PreviousOutPoint == newOutPoint {
+			return nil, fmt.Errorf("outpoint %v is already spent by input %d", newOutPoint, i)
+		}
+	}
+
+	// Check all scriptSigs before modifying anything.
+	resign := make(map[int]txscript.SigHashType)
+	for i, txIn := range tx.TxIn {
+		hashTypes, err := signatureHashTypes(txIn.SignatureScript)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		if i == idx {
+			resign[i] = txscript.SigHashAll | SigHashForkID
+			if len(hashTypes) != 0 {
+				resign[i] = hashTypes[0]
+			}
+			continue
+		}
+		for _, hashType := range hashTypes {
+			if hashType&txscript.SigHashAnyOneCanPay == 0 {
+				resign[i] = hashType
+				break
+			}
+		}
+	}
+
+	tx.TxIn[idx].PreviousOutPoint = newOutPoint
+	prevOuts[idx] = newPrevOut
+	for i := range resign {
+		tx.TxIn[i].SignatureScript = nil
+	}
+	return resign, nil
+}
+
+// ResignInputs signs the inputs of tx listed in resign, as returned by
+// ReplaceInput, with their sighash type using SignTxOutput.  prevOuts holds
+// the outputs spent by those inputs, whose token prefix, if any, is signed
+// as WithTokenPrevout does.  Dangerous sighash types are refused as
+// by the other signing functions, unless opts allow them.
+func ResignInputs(chainParams *chaincfg.Params, tx *wire.MsgTx, prevOuts map[int]*wire.TxOut,
+	resign map[int]txscript.SigHashType, kdb txscript.KeyDB, sdb txscript.ScriptDB, opts ...SignOption) error {
+
+	indexes := make([]int, 0, len(resign))
+	for idx := range resign {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	for _, idx := range indexes {
+		prevOut, ok := prevOuts[idx]
+		if !ok {
+			return fmt.Errorf("no previous output for input %d", idx)
+		}
+		if idx < 0 || idx >= len(tx.TxIn) {
+			return fmt.Errorf("input index %d out of range", idx)
+		}
+		token, pkScript, err := SplitTokenPrefix(prevOut.PkScript)
+		if err != nil {
+			return fmt.Errorf("input %d: %w", idx, err)
+		}
+		inputOpts := opts
+		if token != nil {
+			inputOpts = append(opts[:len(opts):len(opts)], WithTokenPrevout(token))
+		}
+		scriptSig, err := SignTxOutput(chainParams, tx, idx, pkScript, resign[idx],
+			kdb, sdb, nil, prevOut.Value, inputOpts...)
+		if err != nil {
+			return fmt.Errorf("input %d: %w", idx, err)
+		}
+		tx.TxIn[idx].SignatureScript = scriptSig
+	}
+	return nil
+}
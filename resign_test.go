@@ -0,0 +1,96 @@
+package bchutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestReplaceInput(t *testing.T) {
+	keys := signingTestKeys()
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x03})
+	keys = append(keys, key)
+	hashTypes := []txscript.SigHashType{
+		txscript.SigHashAll | SigHashForkID,
+		txscript.SigHashAll | txscript.SigHashAnyOneCanPay | SigHashForkID,
+		txscript.SigHashNone | SigHashForkID,
+	}
+
+	// Input 2 spends a token output.
+	token := &TokenData{Category: chainhash.Hash{9}, Amount: 100}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	prevOuts := make(map[int]*wire.TxOut)
+	for i, key := range keys {
+		pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+		if i == 2 {
+			pkScript = append(token.Bytes(), pkScript...)
+		}
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(i + 1)}, 0), nil, nil))
+		prevOuts[i] = wire.NewTxOut(int64(1000*(i+1)), pkScript)
+	}
+	tx.AddTxOut(wire.NewTxOut(2500, prevOuts[0].PkScript))
+	for i, key := range keys {
+		tokenData, pkScript, _ := SplitTokenPrefix(prevOuts[i].PkScript)
+		scriptSig, err := SignatureScript(tx, i, pkScript, hashTypes[i], key, true,
+			prevOuts[i].Value, AllowDangerousSigHash(txscript.SigHashNone), WithTokenPrevout(tokenData))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TxIn[i].SignatureScript = scriptSig
+	}
+	acpScriptSig := tx.TxIn[1].SignatureScript
+
+	// Input 0 now spends another output of the same key.
+	newOutPoint := wire.OutPoint{Hash: chainhash.Hash{0xaa}, Index: 3}
+	newPrevOut := wire.NewTxOut(1500, prevOuts[0].PkScript)
+	if _, err := ReplaceInput(tx, 0, tx.TxIn[1].PreviousOutPoint, newPrevOut, prevOuts); err == nil {
+		t.Error("replacing with an outpoint already spent succeeded")
+	}
+	resign, err := ReplaceInput(tx, 0, newOutPoint, newPrevOut, prevOuts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]txscript.SigHashType{0: hashTypes[0], 2: hashTypes[2]}
+	if !reflect.DeepEqual(resign, want) {
+		t.Fatalf("got inputs to resign %v, want %v", resign, want)
+	}
+	if tx.TxIn[0].PreviousOutPoint != newOutPoint || prevOuts[0] != newPrevOut {
+		t.Fatal("input not replaced")
+	}
+	if len(tx.TxIn[0].SignatureScript) != 0 || len(tx.TxIn[2].SignatureScript) != 0 ||
+		!reflect.DeepEqual(tx.TxIn[1].SignatureScript, acpScriptSig) {
+		t.Fatal("wrong scriptSigs cleared")
+	}
+
+	kdb := txscript.KeyClosure(func(addr btcutil.Address) (*btcec.PrivateKey, bool, error) {
+		for _, key := range keys {
+			keyAddr, _ := btcutil.NewAddressPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()),
+				&chaincfg.MainNetParams)
+			if addr.EncodeAddress() == keyAddr.EncodeAddress() {
+				return key, true, nil
+			}
+		}
+		return nil, false, errors.New("unknown address")
+	})
+	if err := ResignInputs(&chaincfg.MainNetParams, tx, prevOuts, resign, kdb, nil,
+		AllowDangerousSigHash(txscript.SigHashNone)); err != nil {
+		t.Fatal(err)
+	}
+	sigHashes := txscript.NewTxSigHashes(tx)
+	for i := range tx.TxIn {
+		vm, err := NewEngine(prevOuts[i].PkScript, tx, i, StandardScriptFlags, sigHashes, prevOuts[i].Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Errorf("input %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// nonceRFC6979 derives a deterministic nonce for signing hash with key d as
+// specified by RFC 6979, with extra appended to the key material as allowed by
+// section 3.6.  With no extra data the nonce is the one btcec.Sign uses.
+//
+// extra follows the layout of the nonce function of libsecp256k1: 32 bytes
+// of caller supplied entropy, if any, followed by the 16 byte algorithm name
+// for signatures other than ECDSA.
+func nonceRFC6979(d *big.Int, hash []byte, extra []byte) *big.Int {
+	n := btcec.S256().N
+
+	// int2octets(x) || bits2octets(h)
+	bx := make([]byte, 64)
+	d.FillBytes(bx[:32])
+	h := new(big.Int).SetBytes(hash)
+	if len(hash) > 32 {
+		h.Rsh(h, uint(len(hash)-32)*8)
+	}
+	h.Mod(h, n)
+	h.FillBytes(bx[32:])
+	bx = append(bx, extra...)
+	defer zeroBytes(bx)
+
+	mac := func(k []byte, parts ...[]byte) []byte {
+		m := hmac.New(sha256.New, k)
+		for _, p := range parts {
+			m.Write(p)
+		}
+		return m.Sum(nil)
+	}
+
+	v := bytes.Repeat([]byte{0x01}, 32)
+	k := make([]byte, 32)
+	k = mac(k, v, []byte{0x00}, bx)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, bx)
+	v = mac(k, v)
+	for {
+		v = mac(k, v)
+		secret := new(big.Int).SetBytes(v)
+		if secret.Sign() > 0 && secret.Cmp(n) < 0 {
+			return secret
+		}
+		k = mac(k, v, []byte{0x00})
+		v = mac(k, v)
+	}
+}
+
+// zeroBytes overwrites b with zeroes.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// zeroScalar overwrites the words of x with zeroes and sets it to zero.
+func zeroScalar(x *big.Int) {
+	words := x.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	x.SetInt64(0)
+}
+
+// signECDSAWithNonce returns the low-S ECDSA signature of hash by key d with
+// nonce k.  It returns nil if k yields an invalid signature.
+func signECDSAWithNonce(d *big.Int, hash []byte, k *big.Int) *btcec.Signature {
+	curve := btcec.S256()
+	n := curve.N
+
+	rx, _ := curve.ScalarBaseMult(k.Bytes())
+	r := new(big.Int).Mod(rx, n)
+	if r.Sign() == 0 {
+		return nil
+	}
+	e := new(big.Int).SetBytes(hash)
+	s := new(big.Int).Mul(d, r)
+	s.Add(s, e)
+	s.Mul(s, new(big.Int).ModInverse(k, n))
+	s.Mod(s, n)
+	if s.Sign() == 0 {
+		return nil
+	}
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s.Sub(n, s)
+	}
+	return &btcec.Signature{R: r, S: s}
+}
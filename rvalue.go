@@ -0,0 +1,169 @@
+package bchutil
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/Fabcien/bchutil/sig"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// NonceReuse describes two signatures by the same key with the same R value
+// over different digests, which reveal the private key of the signer.
+type NonceReuse struct {
+	// PubKey is the compressed public key of the signer.
+	PubKey []byte
+
+	// R is the R value of both signatures, the x coordinate of the nonce
+	// point.
+	R [32]byte
+
+	// FirstDigest is the digest signed by the signature observed first,
+	// and Digest the one signed by the signature reusing its nonce.
+	FirstDigest [32]byte
+	Digest      [32]byte
+}
+
+// rValueKey identifies the nonce of a signer.
+type rValueKey struct {
+	pubKey [33]byte
+	r      [32]byte
+}
+
+// rValueEntry is an entry of the LRU list of an RValueIndex.
+type rValueEntry struct {
+	key    rValueKey
+	digest [32]byte
+}
+
+// RValueIndex indexes the R values of signatures by signer, to detect keys
+// signing different digests with the same nonce.  Deterministic nonces sign a
+// digest again with the same R value, which is not a reuse.  It is safe for
+// concurrent use.
+type RValueIndex struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[rValueKey]*list.Element
+	lru        *list.List
+}
+
+// NewRValueIndex returns an index of at most maxEntries R values, evicting the
+// least recently observed ones, so that memory is bounded when scanning the
+// mempool continuously: the reuse of an evicted nonce is not detected.  The
+// index is not bounded when maxEntries is not positive.
+func NewRValueIndex(maxEntries int) *RValueIndex {
+	return &RValueIndex{
+		maxEntries: maxEntries,
+		entries:    make(map[rValueKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Len returns the number of R values in the index.
+func (idx *RValueIndex) Len() int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.lru.Len()
+}
+
+// signatureR returns the R value of body, a 64 byte Schnorr signature or a
+// DER encoded ECDSA signature, without sighash type.
+func signatureR(body []byte) ([32]byte, error) {
+	var r [32]byte
+	if len(body) == SchnorrSignatureLen {
+		copy(r[:], body[:32])
+		return r, nil
+	}
+	parsed, err := sig.ParseDERSignature(body, false)
+	if err != nil {
+		return r, err
+	}
+	parsed.R.FillBytes(r[:])
+	return r, nil
+}
+
+// Observe records the R value of sig, a signature of digest by pubKey, and
+// returns the reuse of its nonce with a previously observed signature of
+// another digest, or nil.  sig is a DER encoded ECDSA signature or a Schnorr
+// signature, without sighash type.  The first digest signed with a nonce is
+// kept, to be reported with every later reuse.
+func (idx *RValueIndex) Observe(pubKey, sig, digest []byte) (*NonceReuse, error) {
+	pub, err := btcec.ParsePubKey(pubKey, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	if len(digest) != 32 {
+		return nil, fmt.Errorf("%d byte digest", len(digest))
+	}
+	r, err := signatureR(sig)
+	if err != nil {
+		return nil, err
+	}
+	key := rValueKey{r: r}
+	copy(key.pubKey[:], pub.SerializeCompressed())
+	var d [32]byte
+	copy(d[:], digest)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if elem, ok := idx.entries[key]; ok {
+		idx.lru.MoveToFront(elem)
+		first := elem.Value.(*rValueEntry).digest
+		if first == d {
+			return nil, nil
+		}
+		return &NonceReuse{PubKey: key.pubKey[:], R: r, FirstDigest: first, Digest: d}, nil
+	}
+	idx.entries[key] = idx.lru.PushFront(&rValueEntry{key: key, digest: d})
+	if idx.maxEntries > 0 && idx.lru.Len() > idx.maxEntries {
+		oldest := idx.lru.Back()
+		idx.lru.Remove(oldest)
+		delete(idx.entries, oldest.Value.(*rValueEntry).key)
+	}
+	return nil, nil
+}
+
+// InputNonceReuse is a nonce reuse found by ScanTransaction in the signature
+// of an input.
+type InputNonceReuse struct {
+	Input int
+	*NonceReuse
+}
+
+// ScanTransaction observes with index the valid signatures of the inputs of
+// tx, spending the outputs of prevOuts, and returns the nonce reuses found,
+// with earlier signatures or between the inputs of tx.  Signatures are those
+// checked by the scripts run with ConsensusScriptFlags, of any script type and
+// including OP_CHECKDATASIG ones; inputs whose scripts fail are scanned up to
+// their failure.
+func ScanTransaction(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut, index *RValueIndex) ([]InputNonceReuse,
+	error) {
+
+	var reuses []InputNonceReuse
+	sigHashes := txscript.NewTxSigHashes(tx)
+	for i := range tx.TxIn {
+		prevOut, ok := prevOuts[i]
+		if !ok {
+			return nil, fmt.Errorf("input %d: unknown output spent", i)
+		}
+		vm, err := NewEngine(prevOut.PkScript, tx, i, ConsensusScriptFlags, sigHashes, prevOut.Value)
+		if err != nil {
+			continue
+		}
+		vm.RecordSignatures()
+		vm.Execute()
+		for _, sig := range vm.Signatures() {
+			reuse, err := index.Observe(sig.PubKey, sig.Signature, sig.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("input %d: %w", i, err)
+			}
+			if reuse != nil {
+				reuses = append(reuses, InputNonceReuse{Input: i, NonceReuse: reuse})
+			}
+		}
+	}
+	return reuses, nil
+}
@@ -0,0 +1,118 @@
+package bchutil
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestRValueIndex(t *testing.T) {
+	key := signingTestKeys()[0]
+	pubKey := key.PubKey().SerializeCompressed()
+	k := big.NewInt(12345)
+	digest1, digest2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	sig1 := signECDSAWithNonce(key.D, digest1, k).Serialize()
+	sig2 := signECDSAWithNonce(key.D, digest2, k).Serialize()
+
+	index := NewRValueIndex(0)
+	for _, sig := range [][]byte{sig1, sig1} {
+		if reuse, err := index.Observe(pubKey, sig, digest1); err != nil || reuse != nil {
+			t.Fatalf("same digest: %+v, %v", reuse, err)
+		}
+	}
+	reuse, err := index.Observe(key.PubKey().SerializeUncompressed(), sig2, digest2)
+	if err != nil || reuse == nil {
+		t.Fatalf("reuse not detected: %v", err)
+	}
+	if !bytes.Equal(reuse.PubKey, pubKey) || !bytes.Equal(reuse.FirstDigest[:], digest1) ||
+		!bytes.Equal(reuse.Digest[:], digest2) {
+		t.Errorf("got %+v", reuse)
+	}
+
+	// Schnorr signatures with the nonce of the ECDSA ones reuse it too.
+	schnorr := signSchnorrWithNonce(key.D, key.PubKey(), bytes.Repeat([]byte{3}, 32), k)
+	if reuse, _ := index.Observe(pubKey, schnorr, bytes.Repeat([]byte{3}, 32)); reuse == nil ||
+		reuse.R != [32]byte(schnorr[:32]) {
+		t.Errorf("Schnorr reuse: got %+v", reuse)
+	}
+	other := signingTestKeys()[1]
+	if reuse, _ := index.Observe(other.PubKey().SerializeCompressed(),
+		signECDSAWithNonce(other.D, digest2, k).Serialize(), digest2); reuse != nil {
+		t.Error("nonce of another key reported")
+	}
+	if _, err := index.Observe(pubKey, []byte{0x30}, digest1); err == nil {
+		t.Error("invalid signature accepted")
+	}
+
+	// A bounded index forgets the least recently observed nonces.
+	bounded := NewRValueIndex(2)
+	for i := int64(1); i <= 3; i++ {
+		bounded.Observe(pubKey, signECDSAWithNonce(key.D, digest1, big.NewInt(i)).Serialize(), digest1)
+	}
+	if bounded.Len() != 2 {
+		t.Errorf("%d entries", bounded.Len())
+	}
+	if reuse, _ := bounded.Observe(pubKey, signECDSAWithNonce(key.D, digest2, big.NewInt(1)).Serialize(),
+		digest2); reuse != nil {
+		t.Error("evicted nonce reported")
+	}
+	if reuse, _ := bounded.Observe(pubKey, signECDSAWithNonce(key.D, digest2, big.NewInt(3)).Serialize(),
+		digest2); reuse == nil {
+		t.Error("recent nonce reuse not detected")
+	}
+}
+
+func TestScanTransaction(t *testing.T) {
+	key := signingTestKeys()[0]
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	tx := wire.NewMsgTx(wire.TxVersion)
+	prevOuts := make(map[int]*wire.TxOut)
+	for i := 0; i < 3; i++ {
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{byte(i + 1)}}, nil, nil))
+		prevOuts[i] = wire.NewTxOut(10000, pkScript)
+	}
+	tx.AddTxOut(wire.NewTxOut(25000, pkScript))
+	// Input 2 spends a token output.
+	token := (&TokenData{Category: chainhash.Hash{3}, Amount: 1}).Bytes()
+	prevOuts[2] = wire.NewTxOut(10000, append(token, pkScript...))
+
+	// Inputs 0 and 2 are signed with the same nonce.
+	sigHashes := txscript.NewTxSigHashes(tx)
+	for i, k := range []int64{7, 8, 7} {
+		var tokenPrefix []byte
+		if i == 2 {
+			tokenPrefix = token
+		}
+		digest := calcSignatureHash(pkScript, sigHashes, txscript.SigHashAll|SigHashForkID, tx, i, 10000, 0,
+			tokenPrefix)
+		sig := append(signECDSAWithNonce(key.D, digest, big.NewInt(k)).Serialize(),
+			byte(txscript.SigHashAll|SigHashForkID))
+		tx.TxIn[i].SignatureScript, _ = txscript.NewScriptBuilder().AddData(sig).
+			AddData(key.PubKey().SerializeCompressed()).Script()
+	}
+
+	index := NewRValueIndex(100)
+	reuses, err := ScanTransaction(tx, prevOuts, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reuses) != 1 || reuses[0].Input != 2 {
+		t.Fatalf("got %+v", reuses)
+	}
+	if index.Len() != 2 {
+		t.Errorf("%d entries", index.Len())
+	}
+	// Scanning the transaction again reports the same reuse only.
+	if reuses, _ := ScanTransaction(tx, prevOuts, index); len(reuses) != 1 {
+		t.Errorf("rescan: got %+v", reuses)
+	}
+	delete(prevOuts, 1)
+	if _, err := ScanTransaction(tx, prevOuts, index); err == nil {
+		t.Error("missing previous output accepted")
+	}
+}
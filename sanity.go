@@ -0,0 +1,116 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// MaxTxSize is the largest transaction allowed by consensus.
+const MaxTxSize = 1000000
+
+// Errors of CheckTransactionSanity, with the reject reasons of Bitcoin Cash
+// Node for the same rules.
+var (
+	// ErrNoInputs describes an error where a transaction has no input,
+	// bad-txns-vin-empty.
+	ErrNoInputs = errors.New("transaction without input")
+
+	// ErrNoOutputs describes an error where a transaction has no output,
+	// bad-txns-vout-empty.
+	ErrNoOutputs = errors.New("transaction without output")
+
+	// ErrTxOversize describes an error where a transaction is larger than
+	// allowed, bad-txns-oversize.
+	ErrTxOversize = errors.New("transaction too large")
+
+	// ErrTxUndersize describes an error where a transaction is smaller than
+	// MinTxSize, bad-txns-undersize.
+	ErrTxUndersize = errors.New("transaction too small")
+
+	// ErrNegativeOutput describes an error where an output value is
+	// negative, bad-txns-vout-negative.
+	ErrNegativeOutput = errors.New("negative output value")
+
+	// ErrOutputTooLarge describes an error where an output value exceeds
+	// MaxSatoshi, bad-txns-vout-toolarge.
+	ErrOutputTooLarge = errors.New("output value too large")
+
+	// ErrOutputTotalTooLarge describes an error where the output values of
+	// a transaction add up to more than MaxSatoshi,
+	// bad-txns-txouttotal-toolarge.
+	ErrOutputTotalTooLarge = errors.New("total output value too large")
+
+	// ErrCoinbaseTx describes an error where a coinbase transaction is
+	// found out of the first position of a block, bad-tx-coinbase.
+	ErrCoinbaseTx = errors.New("coinbase transaction")
+
+	// ErrNullPrevOut describes an error where an input of a transaction
+	// other than a coinbase spends the null outpoint,
+	// bad-txns-prevout-null.
+	ErrNullPrevOut = errors.New("input spends the null outpoint")
+)
+
+// isNullOutPoint returns whether op is the outpoint spent by coinbase inputs.
+func isNullOutPoint(op *wire.OutPoint) bool {
+	return op.Index == wire.MaxPrevOutIndex && op.Hash == (chainhash.Hash{})
+}
+
+// CheckTransactionSanity runs the context-free checks of a transaction other
+// than a coinbase, those of CheckRegularTransaction in Bitcoin Cash Node, and
+// returns an error wrapping the error of the first rule failing.  The size of
+// the transaction must be between MinTxSize and maxTxSize, MaxTxSize when not
+// positive.  Lock times and sequences depend on the chain and are checked by
+// CheckFinalTx.
+func CheckTransactionSanity(tx *wire.MsgTx, maxTxSize int) error {
+	if IsCoinBaseTx(tx) {
+		return ErrCoinbaseTx
+	}
+	if len(tx.TxIn) == 0 {
+		return ErrNoInputs
+	}
+	if len(tx.TxOut) == 0 {
+		return ErrNoOutputs
+	}
+	if maxTxSize <= 0 {
+		maxTxSize = MaxTxSize
+	}
+	size := tx.SerializeSize()
+	if size > maxTxSize {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrTxOversize, size, maxTxSize)
+	}
+	if size < MinTxSize {
+		return fmt.Errorf("%w: %d bytes", ErrTxUndersize, size)
+	}
+
+	var total int64
+	for i, txOut := range tx.TxOut {
+		switch {
+		case txOut.Value < 0:
+			return fmt.Errorf("%w: output %d pays %d satoshis", ErrNegativeOutput, i, txOut.Value)
+		case txOut.Value > btcutil.MaxSatoshi:
+			return fmt.Errorf("%w: output %d pays %d satoshis", ErrOutputTooLarge, i, txOut.Value)
+		}
+		// Both are at most MaxSatoshi, so the sum never overflows.
+		total += txOut.Value
+		if total > btcutil.MaxSatoshi {
+			return fmt.Errorf("%w: outputs up to %d pay more than %v", ErrOutputTotalTooLarge, i,
+				btcutil.Amount(btcutil.MaxSatoshi))
+		}
+	}
+
+	spent := make(map[wire.OutPoint]bool, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		if isNullOutPoint(&txIn.PreviousOutPoint) {
+			return fmt.Errorf("%w: input %d", ErrNullPrevOut, i)
+		}
+		if spent[txIn.PreviousOutPoint] {
+			return fmt.Errorf("%w: input %d spends %v", ErrDuplicateInput, i, txIn.PreviousOutPoint)
+		}
+		spent[txIn.PreviousOutPoint] = true
+	}
+	return nil
+}
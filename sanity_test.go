@@ -0,0 +1,59 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestCheckTransactionSanity(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	valid := func() *wire.MsgTx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}, Index: 1}, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(1000, pkScript))
+		tx.AddTxOut(wire.NewTxOut(btcutil.MaxSatoshi-1000, pkScript))
+		return tx
+	}
+	if err := CheckTransactionSanity(valid(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		modify    func(tx *wire.MsgTx)
+		maxTxSize int
+		want      error
+	}{
+		{"no input", func(tx *wire.MsgTx) { tx.TxIn = nil }, 0, ErrNoInputs},
+		{"no output", func(tx *wire.MsgTx) { tx.TxOut = nil }, 0, ErrNoOutputs},
+		{"oversize", func(tx *wire.MsgTx) {}, 100, ErrTxOversize},
+		{"consensus oversize", func(tx *wire.MsgTx) { tx.TxIn[0].SignatureScript = make([]byte, MaxTxSize) }, 0,
+			ErrTxOversize},
+		{"undersize", func(tx *wire.MsgTx) { tx.TxIn, tx.TxOut = tx.TxIn[:1], []*wire.TxOut{{}} }, 0,
+			ErrTxUndersize},
+		{"negative output", func(tx *wire.MsgTx) { tx.TxOut[1].Value = -1 }, 0, ErrNegativeOutput},
+		{"output too large", func(tx *wire.MsgTx) { tx.TxOut[1].Value = btcutil.MaxSatoshi + 1 }, 0,
+			ErrOutputTooLarge},
+		{"total too large", func(tx *wire.MsgTx) { tx.TxOut[0].Value++ }, 0, ErrOutputTotalTooLarge},
+		{"coinbase", func(tx *wire.MsgTx) {
+			tx.TxIn = tx.TxIn[:1]
+			tx.TxIn[0].PreviousOutPoint = wire.OutPoint{Index: wire.MaxPrevOutIndex}
+		}, 0, ErrCoinbaseTx},
+		{"null outpoint", func(tx *wire.MsgTx) {
+			tx.TxIn[1].PreviousOutPoint = wire.OutPoint{Index: wire.MaxPrevOutIndex}
+		}, 0, ErrNullPrevOut},
+		{"duplicate input", func(tx *wire.MsgTx) { tx.TxIn[1].PreviousOutPoint.Index = 0 }, 0, ErrDuplicateInput},
+	}
+	for _, test := range tests {
+		tx := valid()
+		test.modify(tx)
+		if err := CheckTransactionSanity(tx, test.maxTxSize); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
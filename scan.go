@@ -0,0 +1,249 @@
+package bchutil
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+const (
+	// DefaultGapLimit is the number of consecutive unused addresses after
+	// which BIP44 wallets stop scanning a chain.
+	DefaultGapLimit = 20
+
+	// DefaultScanBatchSize is the number of scripts sent to a HistorySource
+	// in one query by default.
+	DefaultScanBatchSize = 20
+
+	// ExternalChain is the BIP44 chain of receiving addresses.
+	ExternalChain = 0
+
+	// ChangeChain is the BIP44 chain of change addresses.
+	ChangeChain = 1
+)
+
+// HistorySource answers the queries of an address scan.  It is usually backed
+// by an Electrum/Fulcrum server or a node.
+type HistorySource interface {
+	// Used returns, for each of pkScripts, whether it appears in any
+	// transaction output.
+	Used(ctx context.Context, pkScripts [][]byte) ([]bool, error)
+
+	// UTXOs returns the unspent outputs paying to any of pkScripts.
+	UTXOs(ctx context.Context, pkScripts [][]byte) ([]UTXO, error)
+}
+
+// ScannedUTXO is an unspent output found by a scan, with the path of its key
+// relative to the scanned account key.
+type ScannedUTXO struct {
+	UTXO
+	Path Path
+}
+
+// ScanResult is the outcome of the scan of an account.
+type ScanResult struct {
+	// LastUsed is the highest used index on the external and change
+	// chains, indexed by ExternalChain and ChangeChain, or -1 when no
+	// address of the chain was used.
+	LastUsed [2]int64
+
+	Balance btcutil.Amount
+	UTXOs   []ScannedUTXO
+}
+
+// Used returns whether any address of the account was used.
+func (r *ScanResult) Used() bool {
+	return r.LastUsed[ExternalChain] >= 0 || r.LastUsed[ChangeChain] >= 0
+}
+
+// Scanner discovers the used pay-to-pubkey-hash addresses of BIP44 accounts.
+type Scanner struct {
+	Source HistorySource
+
+	// Params, when not nil, is the network account keys must belong to.
+	Params *chaincfg.Params
+
+	// GapLimit is the number of consecutive unused addresses ending the scan
+	// of a chain.  DefaultGapLimit is used when it is not positive.
+	GapLimit int
+
+	// BatchSize is the number of scripts per query to Source.
+	// DefaultScanBatchSize is used when it is not positive.
+	BatchSize int
+}
+
+// ScanAccount scans the external and change chains of the account key xpub
+// with a Scanner using the default batch size.
+func ScanAccount(ctx context.Context, xpub *hdkeychain.ExtendedKey, params *chaincfg.Params,
+	source HistorySource, gapLimit int) (*ScanResult, error) {
+
+	s := &Scanner{Source: source, Params: params, GapLimit: gapLimit}
+	return s.ScanAccount(ctx, xpub)
+}
+
+// ScanAccount scans the external and change chains of the account key,
+// either the public or the private m/44'/145'/account' key.
+func (s *Scanner) ScanAccount(ctx context.Context, account *hdkeychain.ExtendedKey) (*ScanResult, error) {
+	if s.Params != nil && !account.IsForNet(s.Params) {
+		return nil, errors.New("account key is for another network")
+	}
+	result := &ScanResult{}
+	for _, chain := range []uint32{ExternalChain, ChangeChain} {
+		chainKey, err := account.Child(chain)
+		if err != nil {
+			return nil, err
+		}
+		used, lastUsed, err := s.scanChain(ctx, chainKey)
+		if err != nil {
+			return nil, err
+		}
+		result.LastUsed[chain] = lastUsed
+
+		utxos, err := s.utxos(ctx, used)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range utxos {
+			index, ok := used[string(u.PkScript)]
+			if !ok {
+				return nil, errors.New("history source returned an output to an unknown script")
+			}
+			result.Balance += u.Amount
+			result.UTXOs = append(result.UTXOs, ScannedUTXO{UTXO: u, Path: Path{chain, index}})
+		}
+	}
+	return result, nil
+}
+
+// ScanWallet scans the BIP44 accounts of master in order, stopping at the
+// first account without any used address as BIP44 account discovery does.
+// master must be a private key since account keys are hardened.
+func (s *Scanner) ScanWallet(ctx context.Context, master *hdkeychain.ExtendedKey) ([]*ScanResult, error) {
+	var results []*ScanResult
+	for account := uint32(0); account < hdkeychain.HardenedKeyStart; account++ {
+		key, err := BIP44Path(account, 0, 0)[:3].Derive(master)
+		if err != nil {
+			return nil, err
+		}
+		result, err := s.ScanAccount(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if !result.Used() {
+			break
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// scanChain derives the scripts of chainKey until GapLimit consecutive ones
+// are unused.  It returns the used scripts with their index and the highest
+// used index.
+func (s *Scanner) scanChain(ctx context.Context, chainKey *hdkeychain.ExtendedKey) (map[string]uint32, int64, error) {
+	gapLimit := s.GapLimit
+	if gapLimit <= 0 {
+		gapLimit = DefaultGapLimit
+	}
+	batchSize := s.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultScanBatchSize
+	}
+
+	used := make(map[string]uint32)
+	lastUsed := int64(-1)
+	var next uint32
+	for gap := 0; gap < gapLimit; {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+
+		start := next
+		pkScripts := make([][]byte, 0, batchSize)
+		for len(pkScripts) < batchSize && next < hdkeychain.HardenedKeyStart {
+			pkScript, err := chainScript(chainKey, next)
+			if err != nil {
+				return nil, 0, err
+			}
+			pkScripts = append(pkScripts, pkScript)
+			next++
+		}
+		if len(pkScripts) == 0 {
+			break
+		}
+
+		flags, err := s.Source.Used(ctx, pkScripts)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(flags) != len(pkScripts) {
+			return nil, 0, errors.New("history source returned a wrong number of results")
+		}
+		for i, isUsed := range flags {
+			if !isUsed {
+				if gap++; gap >= gapLimit {
+					break
+				}
+				continue
+			}
+			gap = 0
+			index := start + uint32(i)
+			lastUsed = int64(index)
+			used[string(pkScripts[i])] = index
+		}
+	}
+	return used, lastUsed, nil
+}
+
+// utxos queries the unspent outputs of the used scripts in batches.
+func (s *Scanner) utxos(ctx context.Context, used map[string]uint32) ([]UTXO, error) {
+	batchSize := s.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultScanBatchSize
+	}
+
+	// Query in derivation order so that results are deterministic.
+	pkScripts := make([][]byte, 0, len(used))
+	for pkScript := range used {
+		pkScripts = append(pkScripts, []byte(pkScript))
+	}
+	sort.Slice(pkScripts, func(i, j int) bool {
+		return used[string(pkScripts[i])] < used[string(pkScripts[j])]
+	})
+
+	var utxos []UTXO
+	for len(pkScripts) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n := batchSize
+		if n > len(pkScripts) {
+			n = len(pkScripts)
+		}
+		batch, err := s.Source.UTXOs(ctx, pkScripts[:n])
+		if err != nil {
+			return nil, err
+		}
+		utxos = append(utxos, batch...)
+		pkScripts = pkScripts[n:]
+	}
+	return utxos, nil
+}
+
+// chainScript returns the pay-to-pubkey-hash script of the key at index on a
+// chain.
+func chainScript(chainKey *hdkeychain.ExtendedKey, index uint32) ([]byte, error) {
+	key, err := chainKey.Child(index)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := key.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	return payToPubKeyHashScript(btcutil.Hash160(pubKey.SerializeCompressed()))
+}
@@ -0,0 +1,141 @@
+package bchutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// memorySource is a HistorySource over a fixed set of used scripts and
+// outputs.
+type memorySource struct {
+	used    map[string]bool
+	utxos   []UTXO
+	queries int
+}
+
+func (m *memorySource) Used(ctx context.Context, pkScripts [][]byte) ([]bool, error) {
+	m.queries++
+	flags := make([]bool, len(pkScripts))
+	for i, pkScript := range pkScripts {
+		flags[i] = m.used[string(pkScript)]
+	}
+	return flags, nil
+}
+
+func (m *memorySource) UTXOs(ctx context.Context, pkScripts [][]byte) ([]UTXO, error) {
+	m.queries++
+	var utxos []UTXO
+	for _, pkScript := range pkScripts {
+		for _, u := range m.utxos {
+			if string(u.PkScript) == string(pkScript) {
+				utxos = append(utxos, u)
+			}
+		}
+	}
+	return utxos, nil
+}
+
+// use marks the script of account/chain/index as used, with an unspent output
+// of amount when it is not zero.
+func (m *memorySource) use(t *testing.T, account *hdkeychain.ExtendedKey, chain, index uint32, amount btcutil.Amount) {
+	chainKey, _ := account.Child(chain)
+	pkScript, err := chainScript(chainKey, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.used[string(pkScript)] = true
+	if amount != 0 {
+		op := wire.OutPoint{Hash: chainhash.HashH(pkScript), Index: index}
+		m.utxos = append(m.utxos, UTXO{OutPoint: op, Amount: amount, PkScript: pkScript})
+	}
+}
+
+func TestScanAccount(t *testing.T) {
+	account, _ := BIP44Path(0, 0, 0)[:3].Derive(descTestKey())
+	xpub, _ := account.Neuter()
+
+	source := &memorySource{used: make(map[string]bool)}
+	source.use(t, xpub, ExternalChain, 0, 0)
+	source.use(t, xpub, ExternalChain, 3, 1000)
+	source.use(t, xpub, ExternalChain, 22, 2000)
+	source.use(t, xpub, ChangeChain, 1, 500)
+	// Beyond the gap limit of the change chain.
+	source.use(t, xpub, ChangeChain, 30, 700)
+
+	result, err := ScanAccount(context.Background(), xpub, &chaincfg.MainNetParams, source, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.LastUsed != [2]int64{22, 1} {
+		t.Errorf("last used indexes %v, want [22 1]", result.LastUsed)
+	}
+	if result.Balance != 3500 {
+		t.Errorf("balance %v, want 3500", result.Balance)
+	}
+	if len(result.UTXOs) != 3 {
+		t.Fatalf("found %d outputs, want 3", len(result.UTXOs))
+	}
+	if p := result.UTXOs[1].Path; p[0] != ExternalChain || p[1] != 22 {
+		t.Errorf("second output has path %v", p)
+	}
+
+	// The private account key finds the same outputs.
+	priv, err := ScanAccount(context.Background(), account, &chaincfg.MainNetParams, source, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if priv.Balance != result.Balance {
+		t.Error("private and public scans disagree")
+	}
+
+	if _, err := ScanAccount(context.Background(), xpub, &chaincfg.TestNet3Params, source, 20); err == nil {
+		t.Error("mainnet key accepted on testnet")
+	}
+}
+
+func TestScanBatches(t *testing.T) {
+	account, _ := BIP44Path(0, 0, 0)[:3].Derive(descTestKey())
+	source := &memorySource{used: make(map[string]bool)}
+	source.use(t, account, ExternalChain, 0, 1000)
+
+	s := &Scanner{Source: source, GapLimit: 5, BatchSize: 2}
+	if _, err := s.ScanAccount(context.Background(), account); err != nil {
+		t.Fatal(err)
+	}
+	// Three history and one UTXO queries on the external chain, three
+	// history queries on the change chain.
+	if source.queries != 7 {
+		t.Errorf("%d queries, want 7", source.queries)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.ScanAccount(ctx, account); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestScanWallet(t *testing.T) {
+	master := descTestKey()
+	source := &memorySource{used: make(map[string]bool)}
+	for _, i := range []uint32{0, 1, 3} {
+		account, _ := BIP44Path(i, 0, 0)[:3].Derive(master)
+		source.use(t, account, ChangeChain, 0, 100)
+	}
+
+	s := &Scanner{Source: source, Params: &chaincfg.MainNetParams}
+	results, err := s.ScanWallet(context.Background(), master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Account 3 is after the unused account 2.
+	if len(results) != 2 {
+		t.Errorf("found %d accounts, want 2", len(results))
+	}
+}
@@ -0,0 +1,107 @@
+package bchutil
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// SchnorrSignatureLen is the length of a Bitcoin Cash Schnorr signature,
+// without sighash type.
+const SchnorrSignatureLen = 64
+
+// schnorrAlgo is the algorithm name mixed into RFC 6979 nonces of Schnorr
+// signatures, as Bitcoin ABC does, so that they never reuse the nonce of an
+// ECDSA signature of the same message.
+var schnorrAlgo = []byte("Schnorr+SHA256  ")
+
+// ErrInvalidSchnorrSignature describes an error where a Schnorr signature is
+// not 64 bytes long or has out of range values.
+var ErrInvalidSchnorrSignature = errors.New("invalid Schnorr signature")
+
+// schnorrChallenge returns e = sha256(r || compressed(P) || m) mod n.
+func schnorrChallenge(r *big.Int, pubKey *btcec.PublicKey, hash []byte) *big.Int {
+	var rb [32]byte
+	r.FillBytes(rb[:])
+	h := sha256.New()
+	h.Write(rb[:])
+	h.Write(pubKey.SerializeCompressed())
+	h.Write(hash)
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return e.Mod(e, btcec.S256().N)
+}
+
+// signSchnorrWithNonce returns the Schnorr signature of hash by the key d of
+// pubKey with nonce k, negated if needed so that R.y is a quadratic residue.
+func signSchnorrWithNonce(d *big.Int, pubKey *btcec.PublicKey, hash []byte, k *big.Int) []byte {
+	curve := btcec.S256()
+	rx, ry := curve.ScalarBaseMult(k.Bytes())
+	if big.Jacobi(ry, curve.P) != 1 {
+		k = new(big.Int).Sub(curve.N, k)
+		defer zeroScalar(k)
+	}
+	e := schnorrChallenge(rx, pubKey, hash)
+	s := e.Mul(e, d)
+	s.Add(s, k)
+	s.Mod(s, curve.N)
+
+	sig := make([]byte, SchnorrSignatureLen)
+	rx.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig
+}
+
+// SignSchnorr returns the 64 byte Schnorr signature of hash by key, as
+// specified by the May 2019 Bitcoin Cash upgrade.  The nonce is derived with
+// RFC 6979 like Bitcoin ABC does, so signatures are deterministic.
+func SignSchnorr(key *btcec.PrivateKey, hash []byte) ([]byte, error) {
+	return signSchnorr(key.D, key.PubKey(), hash, nil)
+}
+
+// signSchnorr signs hash with the RFC 6979 nonce for extra entropy.
+func signSchnorr(d *big.Int, pubKey *btcec.PublicKey, hash []byte, entropy []byte) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, errors.New("Schnorr signatures are over 32 byte digests")
+	}
+	extra := append(append([]byte(nil), entropy...), schnorrAlgo...)
+	k := nonceRFC6979(d, hash, extra)
+	defer zeroScalar(k)
+	return signSchnorrWithNonce(d, pubKey, hash, k), nil
+}
+
+// parseSchnorr splits a Schnorr signature in its r and s values.
+func parseSchnorr(sig []byte) (r, s *big.Int, err error) {
+	curve := btcec.S256()
+	if len(sig) != SchnorrSignatureLen {
+		return nil, nil, ErrInvalidSchnorrSignature
+	}
+	r = new(big.Int).SetBytes(sig[:32])
+	s = new(big.Int).SetBytes(sig[32:])
+	if r.Cmp(curve.P) >= 0 || s.Cmp(curve.N) >= 0 {
+		return nil, nil, ErrInvalidSchnorrSignature
+	}
+	return r, s, nil
+}
+
+// VerifySchnorr returns whether sig is a valid Schnorr signature of hash by
+// pubKey.
+func VerifySchnorr(pubKey *btcec.PublicKey, hash, sig []byte) bool {
+	r, s, err := parseSchnorr(sig)
+	if err != nil || len(hash) != 32 {
+		return false
+	}
+	curve := btcec.S256()
+
+	// R = s*G - e*P
+	e := schnorrChallenge(r, pubKey, hash)
+	e.Sub(curve.N, e)
+	sx, sy := curve.ScalarBaseMult(s.Bytes())
+	ex, ey := curve.ScalarMult(pubKey.X, pubKey.Y, e.Bytes())
+	rx, ry := curve.Add(sx, sy, ex, ey)
+	if rx.Sign() == 0 && ry.Sign() == 0 {
+		return false
+	}
+	return big.Jacobi(ry, curve.P) == 1 && rx.Cmp(r) == 0
+}
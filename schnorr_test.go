@@ -0,0 +1,152 @@
+package bchutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// Schnorr test vectors of the BIP-Schnorr draft Bitcoin Cash adopted, as
+// used by bchd.
+var schnorrVectors = []struct {
+	pubKey    string
+	message   string
+	signature string
+	valid     bool
+}{
+	{
+		"0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"787a848e71043d280c50470e8e1532b2dd5d20ee912a45dbdd2bd1dfbf187ef67031a98831859dc34dffeedda86831842ccd0079e1f92af177f7f22cc1dced05",
+		true,
+	},
+	{
+		"02dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		"243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		"2a298dacae57395a15d0795ddbfd1dcb564da82b0f269bc70a74f8220429ba1d1e51a22ccec35599b8f266912281f8365ffc2d035a230434a1a64dc59f7013fd",
+		true,
+	},
+	{
+		"03fac2114c2fbb091527eb7c64ecb11f8021cb45e8e7809d3c0938e4b8c0e5f84b",
+		"5e2d58d8b3bcdf1abadec7829054f90dda9805aab56c77333024b9d0a508b75c",
+		"00da9b08172a9b6f0466a2defd817f2d7ab437e0d253cb5395a963866b3574be00880371d01766935b92d2ab4cd5c8a2a5837ec57fed7660773a05f0de142380",
+		true,
+	},
+	{
+		"03defdea4cdb677750a420fee807eacf21eb9898ae79b9768766e4faa04a2d4a34",
+		"4df3c3f68fcc83b27e9d42c90431a72499f17875c81a599b566c9889b9696703",
+		"00000000000000000000003b78ce563f89a0ed9414f5aa28ad0d96d6795f9c6302a8dc32e64e86a333f20ef56eac9ba30b7246d6d25e22adb8c6be1aeb08d49d",
+		true,
+	},
+	{
+		"031b84c5567b126440995d3ed5aaba0565d71e1834604819ff9c17f5e9d5dd078f",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"52818579aca59767e3291d91b76b637bef062083284992f2d95f564ca6cb4e3530b1da849c8e8304adc0cfe870660334b3cfc18e825ef1db34cfae3dfc5d8187",
+		true,
+	},
+	{
+		"03fac2114c2fbb091527eb7c64ecb11f8021cb45e8e7809d3c0938e4b8c0e5f84b",
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		"570dd4ca83d4e6317b8ee6bae83467a1bf419d0767122de409394414b05080dce9ee5f237cbd108eabae1e37759ae47f8e4203da3532eb28db860f33d62d49bd",
+		true,
+	},
+	{
+		"02dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		"243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		"2a298dacae57395a15d0795ddbfd1dcb564da82b0f269bc70a74f8220429ba1dfa16aee06609280a19b67a24e1977e4697712b5fd2943914ecd5f730901b4ab7",
+		false,
+	},
+	{
+		"03fac2114c2fbb091527eb7c64ecb11f8021cb45e8e7809d3c0938e4b8c0e5f84b",
+		"5e2d58d8b3bcdf1abadec7829054f90dda9805aab56c77333024b9d0a508b75c",
+		"00da9b08172a9b6f0466a2defd817f2d7ab437e0d253cb5395a963866b3574bed092f9d860f1776a1f7412ad8a1eb50daccc222bc8c0e26b2056df2f273efdec",
+		false,
+	},
+	{
+		"0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"787a848e71043d280c50470e8e1532b2dd5d20ee912a45dbdd2bd1dfbf187ef68fce5677ce7a623cb20011225797ce7a8de1dc6ccd4f754a47da6c600e59543c",
+		false,
+	},
+	{
+		"03dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		"243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		"2a298dacae57395a15d0795ddbfd1dcb564da82b0f269bc70a74f8220429ba1d1e51a22ccec35599b8f266912281f8365ffc2d035a230434a1a64dc59f7013fd",
+		false,
+	},
+	{
+		"03dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		"243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		"00000000000000000000000000000000000000000000000000000000000000009e9d01af988b5cedce47221bfa9b222721f3fa408915444a4b489021db55775f",
+		false,
+	},
+	{
+		"03dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		"243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		"0000000000000000000000000000000000000000000000000000000000000001d37ddf0254351836d84b1bd6a795fd5d523048f298c4214d187fe4892947f728",
+		false,
+	},
+	{
+		"03dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		"243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		"4a298dacae57395a15d0795ddbfd1dcb564da82b0f269bc70a74f8220429ba1d1e51a22ccec35599b8f266912281f8365ffc2d035a230434a1a64dc59f7013fd",
+		false,
+	},
+	{
+		"03dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		"243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		"fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffc2f1e51a22ccec35599b8f266912281f8365ffc2d035a230434a1a64dc59f7013fd",
+		false,
+	},
+	{
+		"03dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		"243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		"2a298dacae57395a15d0795ddbfd1dcb564da82b0f269bc70a74f8220429ba1dfffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141",
+		false,
+	},
+}
+
+func TestVerifySchnorr(t *testing.T) {
+	for i, v := range schnorrVectors {
+		raw, _ := hex.DecodeString(v.pubKey)
+		pubKey, err := btcec.ParsePubKey(raw, btcec.S256())
+		if err != nil {
+			t.Fatal(err)
+		}
+		message, _ := hex.DecodeString(v.message)
+		sig, _ := hex.DecodeString(v.signature)
+		if VerifySchnorr(pubKey, message, sig) != v.valid {
+			t.Errorf("vector %d: expected valid=%v", i, v.valid)
+		}
+	}
+}
+
+func TestSignSchnorr(t *testing.T) {
+	// Bitcoin ABC deterministic signature test vector.
+	raw, _ := hex.DecodeString("12b004fff7f4b69ef8650e767f18f11ede158148b425660723b9f9a66e61f747")
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), raw)
+	h1 := sha256.Sum256([]byte("Very deterministic message"))
+	h2 := sha256.Sum256(h1[:])
+
+	sig, err := SignSchnorr(key, h2[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2c56731ac2f7a7e7f11518fc7722a166b02438924ca9d8b4d111347b81d07175" +
+		"71846de67ad3d913a8fdf9d8f3f73161a4c48ae81cb183b214765feb86e255ce"
+	if hex.EncodeToString(sig) != want {
+		t.Errorf("signature %x, want %s", sig, want)
+	}
+	if !VerifySchnorr(key.PubKey(), h2[:], sig) {
+		t.Error("signature does not verify")
+	}
+	if VerifySchnorr(key.PubKey(), h1[:], sig) {
+		t.Error("signature verifies for another message")
+	}
+	if _, err := SignSchnorr(key, []byte(strings.Repeat("a", 31))); err == nil {
+		t.Error("short digest accepted")
+	}
+}
@@ -0,0 +1,410 @@
+package bchutil
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// batchWeightLen is the length of the random weights of batch verification.
+// A batch with invalid signatures passes with probability 2^-128.
+const batchWeightLen = 16
+
+// SchnorrVerifyItem is a Schnorr signature to check with BatchVerifySchnorr.
+type SchnorrVerifyItem struct {
+	PubKey    *btcec.PublicKey
+	Signature []byte
+	Digest    []byte
+}
+
+// BatchVerifyError lists the items of a batch whose signature is invalid.
+type BatchVerifyError struct {
+	Failed []int
+}
+
+// Error returns the indexes of the invalid items.
+func (e *BatchVerifyError) Error() string {
+	idx := make([]string, len(e.Failed))
+	for i, failed := range e.Failed {
+		idx[i] = fmt.Sprint(failed)
+	}
+	return fmt.Sprintf("%v: items %s", ErrInvalidSchnorrSignature, strings.Join(idx, ", "))
+}
+
+// Unwrap returns ErrInvalidSchnorrSignature.
+func (e *BatchVerifyError) Unwrap() error {
+	return ErrInvalidSchnorrSignature
+}
+
+// BatchVerifySchnorr checks the signatures of items at once, returning nil if
+// VerifySchnorr accepts them all and a *BatchVerifyError listing the others
+// otherwise.  Every signature is checked with a random weight drawn from
+// crypto/rand, so that invalid signatures can't cancel out: the batch equation
+//
+//	(sum a_i*s_i)*G = sum a_i*R_i + sum a_i*e_i*P_i
+//
+// is evaluated with a single multi-scalar multiplication, and the items are
+// verified one by one to find those failing when it does not hold.
+func BatchVerifySchnorr(items []SchnorrVerifyItem) error {
+	var failed, batched []int
+	var terms []multiexpTerm
+	curve := btcec.S256()
+	weights := make([]byte, batchWeightLen*len(items))
+	if _, err := rand.Read(weights); err != nil {
+		return err
+	}
+	sum := new(big.Int)
+	for i, item := range items {
+		if item.PubKey == nil || len(item.Digest) != 32 {
+			failed = append(failed, i)
+			continue
+		}
+		r, s, err := parseSchnorr(item.Signature)
+		if err != nil {
+			failed = append(failed, i)
+			continue
+		}
+		var rPoint jacobianPoint
+		if !rPoint.liftX(r) {
+			failed = append(failed, i)
+			continue
+		}
+		a := new(big.Int).SetBytes(weights[batchWeightLen*i : batchWeightLen*(i+1)])
+		if a.Sign() == 0 {
+			a.SetInt64(1)
+		}
+		e := schnorrChallenge(r, item.PubKey, item.Digest)
+		e.Mul(e, a)
+		e.Mod(e, curve.N)
+		sum.Add(sum, s.Mul(s, a))
+
+		var pPoint jacobianPoint
+		pPoint.setAffine(item.PubKey.X, item.PubKey.Y)
+		terms = append(terms, newMultiexpTerm(&rPoint, a), newMultiexpTerm(&pPoint, e))
+		batched = append(batched, i)
+	}
+
+	if len(batched) != 0 {
+		// The weighted sum of s*G is subtracted from the other terms,
+		// which must then add up to the point at infinity.
+		sum.Mod(sum, curve.N)
+		sum.Sub(curve.N, sum)
+		var g jacobianPoint
+		g.setAffine(curve.Gx, curve.Gy)
+		terms = append(terms, newMultiexpTerm(&g, sum))
+		if !multiexp(terms).isInfinity() {
+			for _, i := range batched {
+				if !VerifySchnorr(items[i].PubKey, items[i].Digest, items[i].Signature) {
+					failed = append(failed, i)
+				}
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Ints(failed)
+	return &BatchVerifyError{Failed: failed}
+}
+
+// fieldC is 2^256 mod p, the field order of secp256k1.
+const fieldC = 0x1000003d1
+
+// fieldElement is an element of the secp256k1 field, reduced modulo p, in
+// little-endian 64 bit limbs.
+type fieldElement [4]uint64
+
+// setBig sets z to x, which must be below p.
+func (z *fieldElement) setBig(x *big.Int) *fieldElement {
+	var b [32]byte
+	x.FillBytes(b[:])
+	for i := range z {
+		z[i] = binary.BigEndian.Uint64(b[24-8*i:])
+	}
+	return z
+}
+
+func (z *fieldElement) isZero() bool {
+	return z[0]|z[1]|z[2]|z[3] == 0
+}
+
+// reduce subtracts p from z when z is at least p.
+func (z *fieldElement) reduce() {
+	var t fieldElement
+	var carry uint64
+	t[0], carry = bits.Add64(z[0], fieldC, 0)
+	t[1], carry = bits.Add64(z[1], 0, carry)
+	t[2], carry = bits.Add64(z[2], 0, carry)
+	t[3], carry = bits.Add64(z[3], 0, carry)
+	if carry != 0 {
+		*z = t
+	}
+}
+
+func (z *fieldElement) add(x, y *fieldElement) *fieldElement {
+	var carry uint64
+	z[0], carry = bits.Add64(x[0], y[0], 0)
+	z[1], carry = bits.Add64(x[1], y[1], carry)
+	z[2], carry = bits.Add64(x[2], y[2], carry)
+	z[3], carry = bits.Add64(x[3], y[3], carry)
+	if carry != 0 {
+		// 2^256 is fieldC modulo p, and the sum less 2^256 is below
+		// p - fieldC.
+		z[0], carry = bits.Add64(z[0], fieldC, 0)
+		z[1], carry = bits.Add64(z[1], 0, carry)
+		z[2], carry = bits.Add64(z[2], 0, carry)
+		z[3], _ = bits.Add64(z[3], 0, carry)
+		return z
+	}
+	z.reduce()
+	return z
+}
+
+func (z *fieldElement) sub(x, y *fieldElement) *fieldElement {
+	var borrow uint64
+	z[0], borrow = bits.Sub64(x[0], y[0], 0)
+	z[1], borrow = bits.Sub64(x[1], y[1], borrow)
+	z[2], borrow = bits.Sub64(x[2], y[2], borrow)
+	z[3], borrow = bits.Sub64(x[3], y[3], borrow)
+	if borrow != 0 {
+		// Adding p is subtracting fieldC modulo 2^256.
+		z[0], borrow = bits.Sub64(z[0], fieldC, 0)
+		z[1], borrow = bits.Sub64(z[1], 0, borrow)
+		z[2], borrow = bits.Sub64(z[2], 0, borrow)
+		z[3], _ = bits.Sub64(z[3], 0, borrow)
+	}
+	return z
+}
+
+func (z *fieldElement) mul(x, y *fieldElement) *fieldElement {
+	var t [8]uint64
+	for i := 0; i < 4; i++ {
+		var carry uint64
+		for j := 0; j < 4; j++ {
+			hi, lo := bits.Mul64(x[i], y[j])
+			var c uint64
+			lo, c = bits.Add64(lo, t[i+j], 0)
+			hi += c
+			lo, c = bits.Add64(lo, carry, 0)
+			hi += c
+			t[i+j], carry = lo, hi
+		}
+		t[i+4] = carry
+	}
+
+	// The high half is worth fieldC times as much modulo p.
+	var carry uint64
+	for i := 0; i < 4; i++ {
+		hi, lo := bits.Mul64(t[4+i], fieldC)
+		var c uint64
+		lo, c = bits.Add64(lo, t[i], 0)
+		hi += c
+		lo, c = bits.Add64(lo, carry, 0)
+		hi += c
+		z[i], carry = lo, hi
+	}
+	hi, lo := bits.Mul64(carry, fieldC)
+	z[0], carry = bits.Add64(z[0], lo, 0)
+	z[1], carry = bits.Add64(z[1], hi, carry)
+	z[2], carry = bits.Add64(z[2], 0, carry)
+	z[3], carry = bits.Add64(z[3], 0, carry)
+	if carry != 0 {
+		z[0], carry = bits.Add64(z[0], fieldC, 0)
+		z[1], carry = bits.Add64(z[1], 0, carry)
+		z[2], carry = bits.Add64(z[2], 0, carry)
+		z[3], _ = bits.Add64(z[3], 0, carry)
+	}
+	z.reduce()
+	return z
+}
+
+func (z *fieldElement) square(x *fieldElement) *fieldElement {
+	return z.mul(x, x)
+}
+
+// squareN sets z to x^(2^n).
+func (z *fieldElement) squareN(x *fieldElement, n int) *fieldElement {
+	*z = *x
+	for i := 0; i < n; i++ {
+		z.square(z)
+	}
+	return z
+}
+
+// sqrt sets z to x^((p+1)/4), the square root of x that is a quadratic
+// residue when x has square roots, and returns whether it does.
+func (z *fieldElement) sqrt(x *fieldElement) bool {
+	// The addition chain of libsecp256k1, where xn is x^(2^n - 1).
+	var x2, x3, x6, x9, x11, x22, x44, x88, x176, x220, x223, t fieldElement
+	x2.mul(x2.square(x), x)
+	x3.mul(x3.square(&x2), x)
+	x6.mul(x6.squareN(&x3, 3), &x3)
+	x9.mul(x9.squareN(&x6, 3), &x3)
+	x11.mul(x11.squareN(&x9, 2), &x2)
+	x22.mul(x22.squareN(&x11, 11), &x11)
+	x44.mul(x44.squareN(&x22, 22), &x22)
+	x88.mul(x88.squareN(&x44, 44), &x44)
+	x176.mul(x176.squareN(&x88, 88), &x88)
+	x220.mul(x220.squareN(&x176, 44), &x44)
+	x223.mul(x223.squareN(&x220, 3), &x3)
+	t.mul(t.squareN(&x223, 23), &x22)
+	t.mul(t.squareN(&t, 6), &x2)
+	z.squareN(&t, 2)
+
+	var check fieldElement
+	return *check.square(z) == *x
+}
+
+// jacobianPoint is a point of secp256k1 in Jacobian coordinates, standing for
+// (x/z^2, y/z^3), or the point at infinity when z is zero.
+type jacobianPoint struct {
+	x, y, z fieldElement
+}
+
+func (p *jacobianPoint) isInfinity() bool {
+	return p.z.isZero()
+}
+
+// setAffine sets p to (x, y).
+func (p *jacobianPoint) setAffine(x, y *big.Int) {
+	p.x.setBig(x)
+	p.y.setBig(y)
+	p.z = fieldElement{1}
+}
+
+// liftX sets p to the point of x-coordinate x whose y-coordinate is a
+// quadratic residue, the R of Schnorr signatures, and returns whether there is
+// one.
+func (p *jacobianPoint) liftX(x *big.Int) bool {
+	var y2 fieldElement
+	p.x.setBig(x)
+	y2.mul(y2.square(&p.x), &p.x)
+	y2.add(&y2, &fieldElement{7})
+	p.z = fieldElement{1}
+	return p.y.sqrt(&y2)
+}
+
+// double sets p to 2*q, with the dbl-2009-l formulas.
+func (p *jacobianPoint) double(q *jacobianPoint) *jacobianPoint {
+	if q.isInfinity() {
+		*p = *q
+		return p
+	}
+	var a, b, c, d, e, f, t fieldElement
+	a.square(&q.x)
+	b.square(&q.y)
+	c.square(&b)
+	d.add(&q.x, &b)
+	d.square(&d)
+	d.sub(&d, &a)
+	d.sub(&d, &c)
+	d.add(&d, &d)
+	e.add(&a, &a)
+	e.add(&e, &a)
+	f.square(&e)
+
+	var z fieldElement
+	z.mul(&q.y, &q.z)
+	p.z.add(&z, &z)
+	p.x.sub(&f, t.add(&d, &d))
+	t.sub(&d, &p.x)
+	c.add(&c, &c)
+	c.add(&c, &c)
+	c.add(&c, &c)
+	p.y.sub(t.mul(&e, &t), &c)
+	return p
+}
+
+// add sets p to q+r, with the add-2007-bl formulas.
+func (p *jacobianPoint) add(q, r *jacobianPoint) *jacobianPoint {
+	if q.isInfinity() {
+		*p = *r
+		return p
+	}
+	if r.isInfinity() {
+		*p = *q
+		return p
+	}
+	var z1z1, z2z2, u1, u2, s1, s2, h, i, j, rr, v, t fieldElement
+	z1z1.square(&q.z)
+	z2z2.square(&r.z)
+	u1.mul(&q.x, &z2z2)
+	u2.mul(&r.x, &z1z1)
+	s1.mul(s1.mul(&q.y, &r.z), &z2z2)
+	s2.mul(s2.mul(&r.y, &q.z), &z1z1)
+	h.sub(&u2, &u1)
+	rr.sub(&s2, &s1)
+	if h.isZero() {
+		if rr.isZero() {
+			return p.double(q)
+		}
+		*p = jacobianPoint{}
+		return p
+	}
+	i.add(&h, &h)
+	i.square(&i)
+	j.mul(&h, &i)
+	rr.add(&rr, &rr)
+	v.mul(&u1, &i)
+
+	var z fieldElement
+	z.add(&q.z, &r.z)
+	z.square(&z)
+	z.sub(&z, &z1z1)
+	z.sub(&z, &z2z2)
+	p.z.mul(&z, &h)
+	p.x.square(&rr)
+	p.x.sub(&p.x, &j)
+	p.x.sub(&p.x, t.add(&v, &v))
+	t.sub(&v, &p.x)
+	t.mul(&rr, &t)
+	s1.mul(&s1, &j)
+	p.y.sub(&t, s1.add(&s1, &s1))
+	return p
+}
+
+// multiexpTerm is a point of a multi-scalar multiplication, with its first 15
+// multiples, and its scalar.
+type multiexpTerm struct {
+	multiples [16]jacobianPoint
+	scalar    [32]byte
+}
+
+// newMultiexpTerm returns the term k*p, for k below the curve order.
+func newMultiexpTerm(p *jacobianPoint, k *big.Int) multiexpTerm {
+	var t multiexpTerm
+	t.multiples[1] = *p
+	t.multiples[2].double(p)
+	for i := 3; i < len(t.multiples); i++ {
+		t.multiples[i].add(&t.multiples[i-1], p)
+	}
+	k.FillBytes(t.scalar[:])
+	return t
+}
+
+// multiexp returns the sum of terms, sharing the doublings of the 4 bit
+// windows of their scalars.
+func multiexp(terms []multiexpTerm) *jacobianPoint {
+	var sum jacobianPoint
+	for w := 0; w < 64; w++ {
+		for i := 0; i < 4; i++ {
+			sum.double(&sum)
+		}
+		for i := range terms {
+			nibble := terms[i].scalar[w/2]
+			if w%2 == 0 {
+				nibble >>= 4
+			}
+			if nibble &= 0xf; nibble != 0 {
+				sum.add(&sum, &terms[i].multiples[nibble])
+			}
+		}
+	}
+	return &sum
+}
@@ -0,0 +1,183 @@
+package bchutil
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	mathrand "math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// schnorrTestItems returns n valid items signed by distinct keys.
+func schnorrTestItems(tb testing.TB, n int) []SchnorrVerifyItem {
+	items := make([]SchnorrVerifyItem, n)
+	for i := range items {
+		seed := sha256.Sum256([]byte(fmt.Sprint("key ", i)))
+		key, _ := btcec.PrivKeyFromBytes(btcec.S256(), seed[:])
+		digest := sha256.Sum256([]byte(fmt.Sprint("message ", i)))
+		sig, err := SignSchnorr(key, digest[:])
+		if err != nil {
+			tb.Fatal(err)
+		}
+		items[i] = SchnorrVerifyItem{PubKey: key.PubKey(), Signature: sig, Digest: digest[:]}
+	}
+	return items
+}
+
+func TestFieldElement(t *testing.T) {
+	p := btcec.S256().P
+	rng := mathrand.New(mathrand.NewSource(1))
+	values := []*big.Int{big.NewInt(0), big.NewInt(1), new(big.Int).Sub(p, big.NewInt(1))}
+	for i := 0; i < 200; i++ {
+		values = append(values, new(big.Int).Rand(rng, p))
+	}
+	get := func(z *fieldElement) *big.Int {
+		n := new(big.Int)
+		for i := len(z) - 1; i >= 0; i-- {
+			n.Lsh(n, 64).Or(n, new(big.Int).SetUint64(z[i]))
+		}
+		return n
+	}
+	for i, x := range values {
+		y := values[(i+1)%len(values)]
+		var fx, fy, z fieldElement
+		fx.setBig(x)
+		fy.setBig(y)
+		want := new(big.Int)
+		if got := get(z.add(&fx, &fy)); got.Cmp(want.Add(x, y).Mod(want, p)) != 0 {
+			t.Fatalf("%x + %x = %x, want %x", x, y, got, want)
+		}
+		if got := get(z.sub(&fx, &fy)); got.Cmp(want.Sub(x, y).Mod(want, p)) != 0 {
+			t.Fatalf("%x - %x = %x, want %x", x, y, got, want)
+		}
+		if got := get(z.mul(&fx, &fy)); got.Cmp(want.Mul(x, y).Mod(want, p)) != 0 {
+			t.Fatalf("%x * %x = %x, want %x", x, y, got, want)
+		}
+		ok := z.sqrt(&fx)
+		if hasRoot := want.ModSqrt(x, p) != nil; ok != hasRoot {
+			t.Fatalf("square root of %x: %v, want %v", x, ok, hasRoot)
+		}
+		if ok && big.Jacobi(get(&z), p) == -1 {
+			t.Fatalf("square root %x of %x is not a quadratic residue", get(&z), x)
+		}
+	}
+}
+
+func TestMultiexp(t *testing.T) {
+	curve := btcec.S256()
+	var g jacobianPoint
+	g.setAffine(curve.Gx, curve.Gy)
+	// 3*G + 5*G - 8*G is the point at infinity, 3*G + 5*G - 7*G is not.
+	terms := []multiexpTerm{newMultiexpTerm(&g, big.NewInt(3)), newMultiexpTerm(&g, big.NewInt(5)),
+		newMultiexpTerm(&g, new(big.Int).Sub(curve.N, big.NewInt(8)))}
+	if !multiexp(terms).isInfinity() {
+		t.Fatal("3*G + 5*G - 8*G is not the point at infinity")
+	}
+	terms[2] = newMultiexpTerm(&g, new(big.Int).Sub(curve.N, big.NewInt(7)))
+	if multiexp(terms).isInfinity() {
+		t.Fatal("3*G + 5*G - 7*G is the point at infinity")
+	}
+}
+
+func TestBatchVerifySchnorr(t *testing.T) {
+	if err := BatchVerifySchnorr(nil); err != nil {
+		t.Fatal(err)
+	}
+	items := schnorrTestItems(t, 20)
+	if err := BatchVerifySchnorr(items); err != nil {
+		t.Fatal(err)
+	}
+
+	// Shifting the s of two signatures by 11 and -11 keeps the batch
+	// equation without weights balanced.
+	shift := func(sig []byte, d int64) []byte {
+		s := new(big.Int).SetBytes(sig[32:])
+		s.Add(s, big.NewInt(d)).Mod(s, btcec.S256().N)
+		shifted := append([]byte(nil), sig...)
+		s.FillBytes(shifted[32:])
+		return shifted
+	}
+	items[3].Signature = shift(items[3].Signature, 11)
+	items[11].Signature = shift(items[11].Signature, -11)
+	// An r that is not the x-coordinate of a point.
+	items[5].Signature = append(make([]byte, 31), 5)
+	items[5].Signature = append(items[5].Signature, items[0].Signature[32:]...)
+	items[7].PubKey = nil
+	items[8].Digest = items[8].Digest[:31]
+	items[19].Digest = items[0].Digest
+
+	err := BatchVerifySchnorr(items)
+	var batchErr *BatchVerifyError
+	if !errors.As(err, &batchErr) || !errors.Is(err, ErrInvalidSchnorrSignature) {
+		t.Fatalf("got %v, want a BatchVerifyError", err)
+	}
+	if want := []int{3, 5, 7, 8, 11, 19}; !reflect.DeepEqual(batchErr.Failed, want) {
+		t.Fatalf("failed %v, want %v", batchErr.Failed, want)
+	}
+}
+
+func TestValidatePolicyBatchSchnorr(t *testing.T) {
+	keys := signingTestKeys()
+	tx := wire.NewMsgTx(wire.TxVersion)
+	prevOuts := make(map[int]*wire.TxOut)
+	var pkScripts [][]byte
+	for i := 0; i < 6; i++ {
+		key := keys[i%len(keys)]
+		pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+		pkScripts = append(pkScripts, pkScript)
+		prevOuts[i] = wire.NewTxOut(100000, pkScript)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{byte(i)}}, nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(590000, pkScripts[0]))
+	for i := range tx.TxIn {
+		scriptSig, err := SignatureScript(tx, i, pkScripts[i], txscript.SigHashAll|SigHashForkID,
+			keys[i%len(keys)], true, 100000, WithSchnorr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TxIn[i].SignatureScript = scriptSig
+	}
+	if err := ValidatePolicy(tx, prevOuts, WithBatchSchnorr()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The signature of input 4 signs input 2.
+	tx.TxIn[4].SignatureScript = tx.TxIn[2].SignatureScript
+	for _, opts := range [][]VerifyOption{nil, {WithBatchSchnorr()}} {
+		err := ValidatePolicy(tx, prevOuts, opts...)
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) || len(policyErr.Violations) != 1 || !errors.Is(err, ErrNullFail) {
+			t.Fatalf("got %v, want a null fail violation", err)
+		}
+	}
+}
+
+func BenchmarkSchnorrVerify(b *testing.B) {
+	for _, n := range []int{1, 16, 64, 256} {
+		items := schnorrTestItems(b, n)
+		b.Run(fmt.Sprintf("individual/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, item := range items {
+					if !VerifySchnorr(item.PubKey, item.Digest, item.Signature) {
+						b.Fatal("invalid signature")
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("batch/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := BatchVerifySchnorr(items); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package bchutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// Limits enforced by the script interpreter, as defined by the Bitcoin Cash
+// consensus rules.
+const (
+	// MaxScriptSize is the largest script that can be executed.
+	MaxScriptSize = 10000
+
+	// MaxScriptElementSize is the largest item that can be pushed to the
+	// stack.
+	MaxScriptElementSize = 520
+
+	// MaxOpsPerScript is the largest number of non-push operations in a
+	// script.
+	MaxOpsPerScript = 201
+
+	// MaxStackSize is the largest number of items on the main and alt
+	// stacks combined.
+	MaxStackSize = 1000
+
+	// MaxPubKeysPerMultiSig is the largest number of public keys of a
+	// multisig operation.
+	MaxPubKeysPerMultiSig = 20
+
+	// maxScriptNumLen is the length of numeric operands since the 64 bit
+	// integers upgrade of May 2022.
+	maxScriptNumLen = 8
+)
+
+// Opcodes Bitcoin Cash re-enabled or added in slots btcd names differently.
+const (
+	opSplit              = txscript.OP_SUBSTR
+	opNum2Bin            = txscript.OP_LEFT
+	opBin2Num            = txscript.OP_RIGHT
+	opCheckDataSig       = 0xba
+	opCheckDataSigVerify = 0xbb
+	opReverseBytes       = 0xbc
+
+	// The native introspection opcodes of May 2022 and the CashTokens ones
+	// of May 2023 are those from opInputIndex to opOutputTokenAmount.
+	opInputIndex        = 0xc0
+	opOutputTokenAmount = 0xd3
+)
+
+// ErrMalformedPush describes an error where a script ends in the middle of a
+// data push.
+var ErrMalformedPush = errors.New("malformed data push")
+
+// parsedOpcode is an opcode of a script with the data it pushes, if any, and
+// its raw encoding.
+type parsedOpcode struct {
+	value byte
+	data  []byte
+	raw   []byte
+}
+
+// isPush returns whether the opcode only pushes data, OP_RESERVED included as
+// in the reference implementation.
+func (op *parsedOpcode) isPush() bool {
+	return op.value <= txscript.OP_16
+}
+
+// isMinimalPush returns whether the data of a push opcode is pushed with the
+// smallest possible encoding.
+func (op *parsedOpcode) isMinimalPush() bool {
+	if op.value > txscript.OP_PUSHDATA4 {
+		return true
+	}
+	n := len(op.data)
+	switch {
+	case n == 0:
+		return op.value == txscript.OP_0
+	case n == 1 && op.data[0] >= 1 && op.data[0] <= 16:
+		return op.value == txscript.OP_1+op.data[0]-1
+	case n == 1 && op.data[0] == 0x81:
+		return op.value == txscript.OP_1NEGATE
+	case n <= 75:
+		return int(op.value) == n
+	case n <= 0xff:
+		return op.value == txscript.OP_PUSHDATA1
+	case n <= 0xffff:
+		return op.value == txscript.OP_PUSHDATA2
+	}
+	return true
+}
+
+// parseScript splits script in its opcodes.
+func parseScript(script []byte) ([]parsedOpcode, error) {
+	var ops []parsedOpcode
+	for i := 0; i < len(script); {
+		start := i
+		op := parsedOpcode{value: script[i]}
+		i++
+
+		var n int
+		switch {
+		case op.value >= txscript.OP_DATA_1 && op.value <= txscript.OP_DATA_75:
+			n = int(op.value)
+		case op.value == txscript.OP_PUSHDATA1:
+			if len(script)-i < 1 {
+				return nil, ErrMalformedPush
+			}
+			n = int(script[i])
+			i++
+		case op.value == txscript.OP_PUSHDATA2:
+			if len(script)-i < 2 {
+				return nil, ErrMalformedPush
+			}
+			n = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		case op.value == txscript.OP_PUSHDATA4:
+			if len(script)-i < 4 {
+				return nil, ErrMalformedPush
+			}
+			l := binary.LittleEndian.Uint32(script[i:])
+			if l > uint32(len(script)) {
+				return nil, ErrMalformedPush
+			}
+			n = int(l)
+			i += 4
+		}
+		if len(script)-i < n {
+			return nil, ErrMalformedPush
+		}
+		if op.value <= txscript.OP_PUSHDATA4 {
+			op.data = script[i : i+n]
+		}
+		i += n
+		op.raw = script[start:i]
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// unparseScript returns the script made of ops.
+func unparseScript(ops []parsedOpcode) []byte {
+	var script []byte
+	for i := range ops {
+		script = append(script, ops[i].raw...)
+	}
+	return script
+}
+
+// isPushOnly returns whether ops only push data.
+func isPushOnly(ops []parsedOpcode) bool {
+	for i := range ops {
+		if !ops[i].isPush() {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptNum is a numeric stack item.  Numbers are encoded little-endian with
+// the sign in the most significant bit.
+type scriptNum int64
+
+// Bytes returns the minimal encoding of n.
+func (n scriptNum) Bytes() []byte {
+	if n == 0 {
+		return nil
+	}
+	neg := n < 0
+	m := uint64(n)
+	if neg {
+		m = uint64(-n)
+	}
+	var b []byte
+	for m > 0 {
+		b = append(b, byte(m))
+		m >>= 8
+	}
+	switch {
+	case b[len(b)-1]&0x80 != 0 && neg:
+		b = append(b, 0x80)
+	case b[len(b)-1]&0x80 != 0:
+		b = append(b, 0x00)
+	case neg:
+		b[len(b)-1] |= 0x80
+	}
+	return b
+}
+
+// isMinimalNum returns whether v is the minimal encoding of its number.
+func isMinimalNum(v []byte) bool {
+	if len(v) == 0 {
+		return true
+	}
+	return v[len(v)-1]&0x7f != 0 || (len(v) > 1 && v[len(v)-2]&0x80 != 0)
+}
+
+// makeScriptNum decodes a number of at most maxLen bytes.
+func makeScriptNum(v []byte, requireMinimal bool, maxLen int) (scriptNum, error) {
+	if len(v) > maxLen {
+		return 0, fmt.Errorf("%w: %d byte number exceeds the %d byte limit",
+			ErrInvalidNumber, len(v), maxLen)
+	}
+	if requireMinimal && !isMinimalNum(v) {
+		return 0, fmt.Errorf("%w: number %x is not minimally encoded", ErrMinimalData, v)
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	var m uint64
+	for i, b := range v {
+		m |= uint64(b) << (8 * uint(i))
+	}
+	if v[len(v)-1]&0x80 != 0 {
+		m &^= uint64(0x80) << (8 * uint(len(v)-1))
+		return -scriptNum(m), nil
+	}
+	return scriptNum(m), nil
+}
+
+// minimallyEncode returns the minimal encoding of the number encoded by v.
+func minimallyEncode(v []byte) []byte {
+	if len(v) == 0 {
+		return nil
+	}
+	data := append([]byte(nil), v...)
+	last := data[len(data)-1]
+	if last&0x7f != 0 {
+		return data
+	}
+	if len(data) == 1 {
+		return nil
+	}
+	if data[len(data)-2]&0x80 != 0 {
+		return data
+	}
+	for i := len(data) - 1; i > 0; i-- {
+		if data[i-1] != 0 {
+			if data[i-1]&0x80 != 0 {
+				data[i] = last
+				i++
+			} else {
+				data[i-1] |= last
+			}
+			return data[:i]
+		}
+	}
+	return nil
+}
+
+// Checked arithmetic on numbers.  Results must be encodable in 8 bytes, so
+// math.MinInt64 is out of range too.
+
+func addNum(a, b scriptNum) (scriptNum, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < -math.MaxInt64-b) {
+		return 0, fmt.Errorf("%w: integer overflow", ErrInvalidNumber)
+	}
+	return a + b, nil
+}
+
+func subNum(a, b scriptNum) (scriptNum, error) {
+	return addNum(a, -b)
+}
+
+func mulNum(a, b scriptNum) (scriptNum, error) {
+	abs := func(n scriptNum) uint64 {
+		if n < 0 {
+			return uint64(-n)
+		}
+		return uint64(n)
+	}
+	hi, lo := bits.Mul64(abs(a), abs(b))
+	if hi != 0 || lo > math.MaxInt64 {
+		return 0, fmt.Errorf("%w: integer overflow", ErrInvalidNumber)
+	}
+	if (a < 0) != (b < 0) {
+		return -scriptNum(lo), nil
+	}
+	return scriptNum(lo), nil
+}
+
+// asBool returns the truth value of a stack item: it is false if all its
+// bytes are zero, except for a possible negative sign.
+func asBool(v []byte) bool {
+	for i, b := range v {
+		if b != 0 && (i != len(v)-1 || b != 0x80) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromBool returns the stack item for b.
+func fromBool(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return nil
+}
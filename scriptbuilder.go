@@ -0,0 +1,135 @@
+package bchutil
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// ScriptBuilder builds scripts within the limits of Bitcoin Cash: pushes of
+// at most MaxScriptElementSize bytes, encoded minimally, numbers of at most 8
+// bytes and scripts of at most MaxScriptSize bytes.  Opcodes are added by
+// value or by name, the Bitcoin Cash ones included.  The first error is kept
+// and returned by Script, and the calls following it do nothing, so that
+// scripts are built by chaining calls and checking a single error.
+type ScriptBuilder struct {
+	script []byte
+	err    error
+}
+
+// NewScriptBuilder returns an empty builder.
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{}
+}
+
+// add appends ops to the script unless it would exceed MaxScriptSize.
+func (b *ScriptBuilder) add(ops []byte) *ScriptBuilder {
+	if b.err != nil {
+		return b
+	}
+	if n := len(b.script) + len(ops); n > MaxScriptSize {
+		b.err = fmt.Errorf("%w: script of %d bytes, limit %d", ErrScriptLimit, n, MaxScriptSize)
+		return b
+	}
+	b.script = append(b.script, ops...)
+	return b
+}
+
+// AddOp adds the opcode op.
+func (b *ScriptBuilder) AddOp(op byte) *ScriptBuilder {
+	return b.add([]byte{op})
+}
+
+// AddOps adds the opcodes ops, as they are.
+func (b *ScriptBuilder) AddOps(ops []byte) *ScriptBuilder {
+	return b.add(ops)
+}
+
+// AddOpName adds the opcode named name, such as OP_CHECKDATASIG.  Unknown
+// names fail with ErrBadOpcode.
+func (b *ScriptBuilder) AddOpName(name string) *ScriptBuilder {
+	if b.err != nil {
+		return b
+	}
+	op, ok := opcodeByName[name]
+	if !ok {
+		b.err = fmt.Errorf("%w: unknown opcode %q", ErrBadOpcode, name)
+		return b
+	}
+	return b.AddOp(op)
+}
+
+// checkElement returns whether b has no error and data fits in
+// MaxScriptElementSize, keeping the error otherwise.
+func (b *ScriptBuilder) checkElement(data []byte) bool {
+	if b.err == nil && len(data) > MaxScriptElementSize {
+		b.err = fmt.Errorf("%w: push of %d bytes, limit %d", ErrScriptLimit, len(data),
+			MaxScriptElementSize)
+	}
+	return b.err == nil
+}
+
+// AddData adds the minimal push of data: OP_0 for no data, OP_1 to OP_16 and
+// OP_1NEGATE for single bytes of these values and the shortest data push
+// otherwise.  Data larger than MaxScriptElementSize fails with
+// ErrScriptLimit.
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	if !b.checkElement(data) {
+		return b
+	}
+	return b.add(minimalPush(data))
+}
+
+// AddDataPush adds the shortest data push of data, with OP_0 for no data but
+// a data push for the single bytes AddData pushes as small integers, for the
+// protocols reading their fields from data pushes.
+func (b *ScriptBuilder) AddDataPush(data []byte) *ScriptBuilder {
+	if !b.checkElement(data) {
+		return b
+	}
+	if len(data) == 1 {
+		return b.add([]byte{txscript.OP_DATA_1, data[0]})
+	}
+	return b.add(minimalPush(data))
+}
+
+// AddInt64 adds the minimal push of the script number n: OP_0, OP_1 to
+// OP_16 and OP_1NEGATE for these values and the push of its minimal encoding
+// otherwise.  Numbers whose encoding exceeds the 8 bytes of the script
+// numbers, math.MinInt64, fail with ErrInvalidNumber.
+func (b *ScriptBuilder) AddInt64(n int64) *ScriptBuilder {
+	if b.err != nil {
+		return b
+	}
+	switch {
+	case n == 0:
+		return b.AddOp(txscript.OP_0)
+	case n == -1:
+		return b.AddOp(txscript.OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return b.AddOp(byte(txscript.OP_1 + n - 1))
+	}
+	v := scriptNum(n).Bytes()
+	if len(v) > maxScriptNumLen {
+		b.err = fmt.Errorf("%w: %d encodes to %d bytes, limit %d", ErrInvalidNumber, n, len(v),
+			maxScriptNumLen)
+		return b
+	}
+	return b.add(minimalPush(v))
+}
+
+// Reset empties the builder and clears its error, to build another script.
+func (b *ScriptBuilder) Reset() *ScriptBuilder {
+	b.script = b.script[:0]
+	b.err = nil
+	return b
+}
+
+// Script returns a copy of the script built, or the first error of the calls
+// building it.
+func (b *ScriptBuilder) Script() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return append([]byte{}, b.script...), nil
+}
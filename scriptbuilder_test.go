@@ -0,0 +1,116 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestScriptBuilderInt64(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "00"},
+		{-1, "4f"},
+		{1, "51"},
+		{16, "60"},
+		{17, "0111"},
+		{-2, "0182"},
+		{127, "017f"},
+		{128, "028000"},
+		{-128, "028080"},
+		{math.MaxInt64, "08ffffffffffffff7f"},
+		{math.MinInt64 + 1, "08ffffffffffffffff"},
+	}
+	for _, test := range tests {
+		script, err := NewScriptBuilder().AddInt64(test.n).Script()
+		if err != nil {
+			t.Fatalf("%d: %v", test.n, err)
+		}
+		if !bytes.Equal(script, mustDecodeHex(test.want)) {
+			t.Errorf("%d: script %x, want %s", test.n, script, test.want)
+		}
+		// Numbers are pushed as txscript pushes them.
+		expected, _ := txscript.NewScriptBuilder().AddInt64(test.n).Script()
+		if !bytes.Equal(script, expected) {
+			t.Errorf("%d: script %x, txscript %x", test.n, script, expected)
+		}
+	}
+	if _, err := NewScriptBuilder().AddInt64(math.MinInt64).Script(); !errors.Is(err, ErrInvalidNumber) {
+		t.Errorf("math.MinInt64: %v, want ErrInvalidNumber", err)
+	}
+}
+
+func TestScriptBuilderData(t *testing.T) {
+	tests := []struct {
+		data, minimal, push string
+	}{
+		{"", "00", "00"},
+		{"05", "55", "0105"},
+		{"81", "4f", "0181"},
+		{"00", "0100", "0100"},
+		{"0102", "020102", "020102"},
+	}
+	for _, test := range tests {
+		data := mustDecodeHex(test.data)
+		script, err := NewScriptBuilder().AddData(data).Script()
+		if err != nil || !bytes.Equal(script, mustDecodeHex(test.minimal)) {
+			t.Errorf("AddData(%s): %x, %v, want %s", test.data, script, err, test.minimal)
+		}
+		script, err = NewScriptBuilder().AddDataPush(data).Script()
+		if err != nil || !bytes.Equal(script, mustDecodeHex(test.push)) {
+			t.Errorf("AddDataPush(%s): %x, %v, want %s", test.data, script, err, test.push)
+		}
+	}
+
+	b := NewScriptBuilder().AddData(make([]byte, 76)).AddData(make([]byte, MaxScriptElementSize))
+	script, err := b.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script[0] != txscript.OP_PUSHDATA1 || script[78] != txscript.OP_PUSHDATA2 || len(script) != 2+76+3+520 {
+		t.Errorf("pushes of 76 and 520 bytes encoded as %x...", script[:4])
+	}
+	if _, err := NewScriptBuilder().AddData(make([]byte, MaxScriptElementSize+1)).Script(); !errors.Is(err,
+		ErrScriptLimit) {
+		t.Errorf("push of %d bytes: %v, want ErrScriptLimit", MaxScriptElementSize+1, err)
+	}
+}
+
+func TestScriptBuilderErrors(t *testing.T) {
+	b := NewScriptBuilder().AddOpName("OP_CHECKDATASIG").AddOpName("OP_REVERSEBYTES").AddOpName("OP_DUP")
+	script, err := b.Script()
+	if err != nil || !bytes.Equal(script, []byte{opCheckDataSig, opReverseBytes, txscript.OP_DUP}) {
+		t.Errorf("opcodes by name: %x, %v", script, err)
+	}
+
+	// The first error is kept, and following calls add nothing.
+	b.AddOpName("OP_NOPE").AddData(make([]byte, MaxScriptElementSize+1)).AddOp(txscript.OP_EQUAL)
+	if _, err := b.Script(); !errors.Is(err, ErrBadOpcode) {
+		t.Errorf("unknown opcode: %v, want ErrBadOpcode", err)
+	}
+	b.Reset().AddOp(txscript.OP_EQUAL)
+	if script, err := b.Script(); err != nil || !bytes.Equal(script, []byte{txscript.OP_EQUAL}) {
+		t.Errorf("after Reset: %x, %v", script, err)
+	}
+
+	b.Reset()
+	for i := 0; i < MaxScriptSize/(MaxScriptElementSize+3); i++ {
+		b.AddData(make([]byte, MaxScriptElementSize))
+	}
+	b.AddData(make([]byte, MaxScriptElementSize))
+	if _, err := b.Script(); !errors.Is(err, ErrScriptLimit) {
+		t.Errorf("script over %d bytes: %v, want ErrScriptLimit", MaxScriptSize, err)
+	}
+
+	// Scripts returned are not changed by the builder reused.
+	script, _ = b.Reset().AddOp(txscript.OP_1).Script()
+	b.Reset().AddOp(txscript.OP_2)
+	if script[0] != txscript.OP_1 {
+		t.Errorf("script changed to %x by Reset", script)
+	}
+}
@@ -0,0 +1,137 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxErrorStackItems is the number of the top stack items reported by
+// ExecError.
+const maxErrorStackItems = 4
+
+// ExecError describes where the execution of scripts failed.  The errors of
+// Engine.Execute and Engine.Step are ExecError values wrapping the reason of
+// the failure, so that errors.Is matches it.
+type ExecError struct {
+	// Script is the script failing, numbered like StepRecord.Script, and
+	// PC the index of the failing opcode in it, or the number of opcodes of
+	// the script for the checks ending its execution.
+	Script int
+	PC     int
+
+	// Opcode is the failing opcode in ASM, empty for the checks ending the
+	// execution of a script.
+	Opcode string
+
+	// Stack holds the top items of the stack, from bottom to top, in hex,
+	// before the failing opcode executed or when the script ended, and
+	// StackDepth is the number of items of the stack.
+	Stack      []string
+	StackDepth int
+
+	// Err is the reason of the failure.
+	Err error
+
+	ops []parsedOpcode
+}
+
+// execError returns the ExecError of err, the failure of the opcode pc of
+// script or of the end of the script when pc is past its last opcode.
+func (vm *Engine) execError(script, pc int, err error) error {
+	e := &ExecError{Script: script, PC: pc, Err: err, ops: vm.scripts[script]}
+	stack := vm.dstack
+	if pc < len(e.ops) {
+		e.Opcode = e.ops[pc].asm()
+		// Opcodes pop their operands: the stack they saw is that of a
+		// replay of the steps before.
+		stack = vm.replay(vm.steps - 1).dstack
+	}
+	e.StackDepth = len(stack)
+	if len(stack) > maxErrorStackItems {
+		stack = stack[len(stack)-maxErrorStackItems:]
+	}
+	e.Stack = hexItems(stack)
+	return e
+}
+
+// replay returns a new engine executing the same scripts as vm, after steps
+// steps.
+func (vm *Engine) replay(steps int) *Engine {
+	r := &Engine{
+		scripts:      vm.scripts[:2:2],
+		bip16:        vm.bip16,
+		vmLimits:     vm.vmLimits,
+		tx:           vm.tx,
+		txIdx:        vm.txIdx,
+		flags:        vm.flags,
+		sigHashes:    vm.sigHashes,
+		amount:       vm.amount,
+		deferSchnorr: vm.deferSchnorr,
+	}
+	for r.steps < steps {
+		if done, _ := r.Step(); done {
+			break
+		}
+	}
+	return r
+}
+
+// ScriptName returns the name of the failing script: "scriptSig", "pkScript"
+// or "redeem script".
+func (e *ExecError) ScriptName() string {
+	switch e.Script {
+	case 0:
+		return "scriptSig"
+	case 1:
+		return "pkScript"
+	}
+	return "redeem script"
+}
+
+// Error returns where the execution failed and why.
+func (e *ExecError) Error() string {
+	if e.Opcode == "" {
+		return fmt.Sprintf("%s end: %v", e.ScriptName(), e.Err)
+	}
+	return fmt.Sprintf("%s opcode %d (%s): %v", e.ScriptName(), e.PC, e.Opcode, e.Err)
+}
+
+// Unwrap returns the reason of the failure.
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// Disasm returns the ASM of the failing script, written by DisasmASM, with the
+// failing opcode between ">>" and "<<", or "<end>" between them after the last
+// opcode when the checks ending the script failed.
+func (e *ExecError) Disasm() string {
+	tokens := make([]string, 0, len(e.ops)+1)
+	for i := range e.ops {
+		token := e.ops[i].asm()
+		if i == e.PC {
+			token = ">>" + token + "<<"
+		}
+		tokens = append(tokens, token)
+	}
+	if e.PC >= len(e.ops) {
+		tokens = append(tokens, ">><end><<")
+	}
+	return strings.Join(tokens, " ")
+}
+
+// FormatScriptError returns a report of err for bug reports: for errors
+// wrapping an ExecError, the failure, the annotated disassembly of the failing
+// script and the top items of the stack, on separate lines, or else the text of
+// err.
+func FormatScriptError(err error) string {
+	var e *ExecError
+	if !errors.As(err, &e) {
+		return err.Error()
+	}
+	stack := formatStack(e.Stack)
+	if len(e.Stack) < e.StackDepth {
+		stack = fmt.Sprintf("(%d more) %s", e.StackDepth-len(e.Stack), stack)
+	}
+	return fmt.Sprintf("%v\n%s: %s\nstack: %s\n", err, e.ScriptName(), e.Disasm(), stack)
+}
@@ -0,0 +1,85 @@
+package bchutil
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// execTestError executes scriptSig and pkScript and returns their ExecError.
+func execTestError(t *testing.T, scriptSig, pkScript string, flags ScriptFlags) *ExecError {
+	tx := engineTestTx(nil)
+	tx.TxIn[0].SignatureScript, _ = ParseASM(scriptSig)
+	script, _ := ParseASM(pkScript)
+	vm, err := NewEngine(script, tx, 0, flags, nil, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e *ExecError
+	if err := vm.Execute(); !errors.As(err, &e) {
+		t.Fatalf("got %v, want an ExecError", err)
+	}
+	return e
+}
+
+func TestExecError(t *testing.T) {
+	e := execTestError(t, "1 2 3 4 5 0x0102", "OP_DUP OP_HASH160 0x0000000000000000000000000000000000000000 "+
+		"OP_EQUALVERIFY OP_CHECKSIG", 0)
+	if e.Script != 1 || e.PC != 3 || e.Opcode != "OP_EQUALVERIFY" || !errors.Is(e, ErrVerifyFailed) {
+		t.Fatalf("got %+v", e)
+	}
+	// The stack holds the operands of OP_EQUALVERIFY.
+	hash := "0x" + strings.Repeat("00", 20)
+	if e.StackDepth != 8 || formatStack(e.Stack) != "05 0102 15cc49e191cbc520d91944600a5cb77af6aa3291 "+hash[2:] {
+		t.Fatalf("stack of %d items %v", e.StackDepth, e.Stack)
+	}
+	if want := "OP_DUP OP_HASH160 " + hash + " >>OP_EQUALVERIFY<< OP_CHECKSIG"; e.Disasm() != want {
+		t.Fatalf("got %q, want %q", e.Disasm(), want)
+	}
+	report := FormatScriptError(e)
+	lines := strings.Split(strings.TrimSuffix(report, "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "pkScript opcode 3 (OP_EQUALVERIFY): verify failed" ||
+		!strings.HasPrefix(lines[1], "pkScript: OP_DUP") || !strings.HasPrefix(lines[2], "stack: (4 more) 05 ") {
+		t.Fatalf("got report\n%s", report)
+	}
+
+	// The checks ending the scripts fail at their end.
+	e = execTestError(t, "2 3", "OP_ADD 6 OP_EQUAL", 0)
+	if e.Script != 1 || e.PC != 3 || e.Opcode != "" || !errors.Is(e, ErrEvalFalse) ||
+		e.Disasm() != "OP_ADD 6 OP_EQUAL >><end><<" || formatStack(e.Stack) != "[]" {
+		t.Fatalf("got %+v, %s", e, e.Disasm())
+	}
+	if e.Error() != "pkScript end: script evaluated to false" {
+		t.Fatalf("got %q", e.Error())
+	}
+
+	redeemScript, _ := ParseASM("OP_VERIFY 1")
+	p2sh, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+	p2shASM, _ := DisasmASM(p2sh)
+	redeemASM, _ := DisasmASM(append([]byte{txscript.OP_DATA_2}, redeemScript...))
+	e = execTestError(t, "0 "+redeemASM, p2shASM, ScriptBip16)
+	if e.Script != 2 || e.PC != 0 || e.ScriptName() != "redeem script" || formatStack(e.Stack) != "[]" {
+		t.Fatalf("got %+v", e)
+	}
+
+	if got := FormatScriptError(ErrEvalFalse); got != ErrEvalFalse.Error() {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestValidateTxScriptsExecError(t *testing.T) {
+	tx, prevOuts := scriptValidationTestTx(t, 2, 0)
+	pkScript := append([]byte(nil), prevOuts[1].PkScript...)
+	pkScript[3] ^= 1
+	prevOuts[1] = wire.NewTxOut(10000, pkScript)
+	err := ValidateTxScripts(context.Background(), tx, prevOuts, StandardScriptFlags, 1)
+	var e *ExecError
+	if !errors.As(err, &e) || e.Opcode != "OP_EQUALVERIFY" {
+		t.Fatalf("got %v, want an OP_EQUALVERIFY failure", err)
+	}
+}
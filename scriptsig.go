@@ -0,0 +1,292 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/Fabcien/bchutil/sig"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+var (
+	// ErrMalformedScriptSig describes an error where a scriptSig does not
+	// have the form expected to spend a script.
+	ErrMalformedScriptSig = errors.New("malformed scriptSig")
+
+	// ErrRedeemScriptMismatch describes an error where the redeem script of
+	// a scriptSig does not hash to the script hash of the output spent.
+	ErrRedeemScriptMismatch = errors.New("redeem script does not match the script hash")
+)
+
+// ScriptSignature is a signature pushed by a scriptSig.
+type ScriptSignature struct {
+	// Raw is the pushed data, including the sighash type byte.
+	Raw []byte
+
+	HashType txscript.SigHashType
+
+	// ECDSA is the parsed DER signature, or nil for Schnorr signatures.
+	ECDSA *btcec.Signature
+
+	// Schnorr is the 64-byte Schnorr signature, or nil for ECDSA
+	// signatures.
+	Schnorr []byte
+}
+
+// HasForkID returns whether the signature commits to the BCH fork id.
+func (s *ScriptSignature) HasForkID() bool {
+	return s.HashType&SigHashForkID != 0
+}
+
+// parseSignaturePush returns the signature pushed as data, which must end
+// with a supported sighash type and either be 65 bytes long, for Schnorr
+// signatures, or a strict DER ECDSA signature.
+func parseSignaturePush(data []byte) (*ScriptSignature, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+	hashType := txscript.SigHashType(data[len(data)-1])
+	if checkSigHashType(hashType) != nil {
+		return nil, false
+	}
+	s := &ScriptSignature{Raw: data, HashType: hashType}
+	body := data[:len(data)-1]
+	if len(body) == SchnorrSignatureLen {
+		s.Schnorr = body
+		return s, true
+	}
+	ecdsa, err := sig.ParseDERSignature(body, true)
+	if err != nil {
+		return nil, false
+	}
+	s.ECDSA = ecdsa
+	return s, true
+}
+
+// isPubKeyPush returns whether data is a compressed or uncompressed public
+// key.
+func isPubKeyPush(data []byte) bool {
+	switch {
+	case len(data) == 33 && (data[0] == 0x02 || data[0] == 0x03):
+	case len(data) == 65 && data[0] == 0x04:
+	default:
+		return false
+	}
+	_, err := btcec.ParsePubKey(data, btcec.S256())
+	return err == nil
+}
+
+// ParsedScriptSig holds the elements of a scriptSig.
+type ParsedScriptSig struct {
+	// Class is the class of the script spent, the redeem script for
+	// pay-to-script-hash spends.
+	Class txscript.ScriptClass
+
+	Signatures []*ScriptSignature
+
+	// PubKeys are the public keys the signatures are checked against:
+	// pushed by the scriptSig for pay-to-pubkey-hash spends, listed in
+	// the script for pay-to-pubkey and multisig ones.
+	PubKeys [][]byte
+
+	// RedeemScript is the redeem script of pay-to-script-hash spends.
+	RedeemScript []byte
+}
+
+// ParseScriptSig returns the signatures, public keys and redeem script of
+// scriptSig, spending pkScript, whose token prefix, if any, is skipped.
+// Pay-to-pubkey-hash, pay-to-pubkey and multisig spends, optionally wrapped in
+// pay-to-script-hash with a 20 or 32 bytes hash, must have the standard form, and errors wrapping ErrMalformedScriptSig are returned
+// otherwise.  For other scripts, pushes that are valid signatures or public
+// keys are returned.
+func ParseScriptSig(scriptSig, pkScript []byte) (*ParsedScriptSig, error) {
+	ops, err := parseScript(scriptSig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedScriptSig, err)
+	}
+	if !isPushOnly(ops) {
+		return nil, fmt.Errorf("%w: not push only", ErrMalformedScriptSig)
+	}
+
+	_, pkScript, err = SplitTokenPrefix(pkScript)
+	if err != nil {
+		return nil, err
+	}
+	parsed := &ParsedScriptSig{Class: GetScriptClass(pkScript)}
+	script := pkScript
+	if parsed.Class == txscript.ScriptHashTy {
+		if len(ops) == 0 {
+			return nil, fmt.Errorf("%w: no redeem script", ErrMalformedScriptSig)
+		}
+		parsed.RedeemScript = ops[len(ops)-1].data
+		script = parsed.RedeemScript
+		ops = ops[:len(ops)-1]
+		parsed.Class = txscript.GetScriptClass(script)
+	}
+
+	signature := func(i int) error {
+		sig, ok := parseSignaturePush(ops[i].data)
+		if !ok {
+			return fmt.Errorf("%w: push %d is not a signature", ErrMalformedScriptSig, i)
+		}
+		parsed.Signatures = append(parsed.Signatures, sig)
+		return nil
+	}
+	switch parsed.Class {
+	case txscript.PubKeyHashTy:
+		if len(ops) != 2 {
+			return nil, fmt.Errorf("%w: got %d pushes, want 2", ErrMalformedScriptSig, len(ops))
+		}
+		if err := signature(0); err != nil {
+			return nil, err
+		}
+		if !isPubKeyPush(ops[1].data) {
+			return nil, fmt.Errorf("%w: push 1 is not a public key", ErrMalformedScriptSig)
+		}
+		parsed.PubKeys = [][]byte{ops[1].data}
+
+	case txscript.PubKeyTy:
+		if len(ops) != 1 {
+			return nil, fmt.Errorf("%w: got %d pushes, want 1", ErrMalformedScriptSig, len(ops))
+		}
+		if err := signature(0); err != nil {
+			return nil, err
+		}
+		scriptOps, _ := parseScript(script)
+		parsed.PubKeys = [][]byte{scriptOps[0].data}
+
+	case txscript.MultiSigTy:
+		pubKeys, _, _ := multisigPubKeys(script)
+		// The dummy is empty, or the bitfield of the keys signing in
+		// Schnorr multisig.
+		if len(ops) == 0 {
+			return nil, fmt.Errorf("%w: missing multisig dummy", ErrMalformedScriptSig)
+		}
+		if dummy, _ := pushedData(ops[0].value, ops[0].data); len(dummy) != 0 && len(dummy) != (len(pubKeys)+7)/8 {
+			return nil, fmt.Errorf("%w: invalid multisig dummy", ErrMalformedScriptSig)
+		}
+		if len(ops)-1 > len(pubKeys) {
+			return nil, fmt.Errorf("%w: more signatures than public keys", ErrMalformedScriptSig)
+		}
+		for i := 1; i < len(ops); i++ {
+			// Empty pushes are placeholders of partially signed
+			// inputs.
+			if len(ops[i].data) == 0 {
+				continue
+			}
+			if err := signature(i); err != nil {
+				return nil, err
+			}
+		}
+		parsed.PubKeys = pubKeys
+
+	default:
+		for _, op := range ops {
+			if sig, ok := parseSignaturePush(op.data); ok {
+				parsed.Signatures = append(parsed.Signatures, sig)
+			} else if isPubKeyPush(op.data) {
+				parsed.PubKeys = append(parsed.PubKeys, op.data)
+			}
+		}
+	}
+	return parsed, nil
+}
+
+// ExtractRedeemScript returns the redeem script of the pay-to-script-hash
+// spending scriptSig, its last push.  Pushes may use any encoding the
+// consensus rules allow, non-minimal OP_PUSHDATA ones included.  scriptSigs
+// that are not push only, truncated or whose last push is empty fail with an
+// error wrapping ErrMalformedScriptSig.
+func ExtractRedeemScript(scriptSig []byte) ([]byte, error) {
+	ops, err := parseScript(scriptSig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedScriptSig, err)
+	}
+	for _, op := range ops {
+		if _, ok := pushedData(op.value, op.data); !ok {
+			return nil, fmt.Errorf("%w: not push only", ErrMalformedScriptSig)
+		}
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("%w: no redeem script", ErrMalformedScriptSig)
+	}
+	last := ops[len(ops)-1]
+	redeemScript, _ := pushedData(last.value, last.data)
+	if len(redeemScript) == 0 {
+		return nil, fmt.Errorf("%w: empty redeem script", ErrMalformedScriptSig)
+	}
+	return redeemScript, nil
+}
+
+// P2SHSpend describes the redeem script of a pay-to-script-hash spend.
+type P2SHSpend struct {
+	RedeemScript []byte
+
+	// Class and Addresses are the class of the redeem script and the
+	// addresses it pays to, as returned by ClassifyOutput.
+	Class     txscript.ScriptClass
+	Addresses []btcutil.Address
+}
+
+// AnalyzeP2SHSpend returns the redeem script of scriptSig, spending the
+// pay-to-script-hash script pkScript, with 20 or 32 bytes hash and optionally
+// a token prefix, and the underlying class and addresses.  Redeem scripts not
+// hashing to the hash of pkScript fail with an error wrapping
+// ErrRedeemScriptMismatch.
+func AnalyzeP2SHSpend(scriptSig, pkScript []byte, chainParams *chaincfg.Params) (*P2SHSpend, error) {
+	redeemScript, err := checkedRedeemScript(scriptSig, pkScript)
+	if err != nil {
+		return nil, err
+	}
+
+	// Redeem scripts have no token prefix.
+	spend := &P2SHSpend{RedeemScript: redeemScript, Class: txscript.GetScriptClass(redeemScript)}
+	if isPayToScriptHash32(redeemScript) {
+		spend.Class = txscript.ScriptHashTy
+	}
+	spend.Addresses, err = scriptAddrs(spend.Class, redeemScript, chainParams)
+	if err != nil {
+		return nil, err
+	}
+	return spend, nil
+}
+
+// checkedRedeemScript returns the redeem script of scriptSig, which must hash
+// to the script hash of the pay-to-script-hash script pkScript.
+func checkedRedeemScript(scriptSig, pkScript []byte) ([]byte, error) {
+	redeemScript, err := ExtractRedeemScript(scriptSig)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRedeemScriptHash(redeemScript, pkScript); err != nil {
+		return nil, err
+	}
+	return redeemScript, nil
+}
+
+// checkRedeemScriptHash checks that redeemScript hashes to the script hash of
+// the pay-to-script-hash script pkScript.
+func checkRedeemScriptHash(redeemScript, pkScript []byte) error {
+	_, pkScript, err := SplitTokenPrefix(pkScript)
+	if err != nil {
+		return err
+	}
+	var hash, want []byte
+	switch {
+	case isPayToScriptHash32(pkScript):
+		hash, want = chainhash.DoubleHashB(redeemScript), pkScript[2:34]
+	case txscript.GetScriptClass(pkScript) == txscript.ScriptHashTy:
+		hash, want = btcutil.Hash160(redeemScript), pkScript[2:22]
+	default:
+		return fmt.Errorf("%w: not a pay-to-script-hash script", ErrNonStandardScript)
+	}
+	if !bytes.Equal(hash, want) {
+		return fmt.Errorf("%w: hash %x, want %x", ErrRedeemScriptMismatch, hash, want)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestParseScriptSig(t *testing.T) {
+	keys := signingTestKeys()
+	pubKey := keys[0].PubKey().SerializeCompressed()
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(pubKey))
+	tx := engineTestTx(nil)
+
+	hashType := txscript.SigHashNone | SigHashForkID
+	scriptSig, err := SignatureScript(tx, 0, p2pkh, hashType, keys[0], true, 1000,
+		AllowDangerousSigHash(hashType))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseScriptSig(scriptSig, p2pkh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Signatures) != 1 || len(parsed.PubKeys) != 1 || !bytes.Equal(parsed.PubKeys[0], pubKey) {
+		t.Fatalf("got %+v", parsed)
+	}
+	if sig := parsed.Signatures[0]; sig.HashType != hashType || !sig.HasForkID() || sig.ECDSA == nil {
+		t.Errorf("got signature %+v", sig)
+	}
+
+	// Partially signed pay-to-script-hash multisig with a Schnorr
+	// signature.
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_2)
+	for _, key := range keys {
+		builder.AddData(key.PubKey().SerializeCompressed())
+	}
+	redeemScript, _ := builder.AddOp(txscript.OP_2).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	p2sh, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+	schnorrSig := append(bytes.Repeat([]byte{0x11}, SchnorrSignatureLen), byte(txscript.SigHashAll))
+	scriptSig, _ = txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(schnorrSig).
+		AddOp(txscript.OP_0).AddData(redeemScript).Script()
+	parsed, err = ParseScriptSig(scriptSig, p2sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Class != txscript.MultiSigTy || !bytes.Equal(parsed.RedeemScript, redeemScript) ||
+		len(parsed.PubKeys) != 2 || len(parsed.Signatures) != 1 {
+		t.Fatalf("got %+v", parsed)
+	}
+	if sig := parsed.Signatures[0]; sig.Schnorr == nil || sig.HasForkID() {
+		t.Errorf("got signature %+v", sig)
+	}
+
+	// Token prefixes are skipped, and 32 bytes script hashes are
+	// pay-to-script-hash.
+	token := (&TokenData{Category: chainhash.Hash{7}, Amount: 1}).Bytes()
+	withToken := func(pkScript []byte) []byte {
+		return append(append([]byte(nil), token...), pkScript...)
+	}
+	p2sh32, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_HASH256).
+		AddData(chainhash.DoubleHashB(redeemScript)).AddOp(txscript.OP_EQUAL).Script()
+	for _, pkScript := range [][]byte{withToken(p2sh), p2sh32, withToken(p2sh32)} {
+		parsed, err := ParseScriptSig(scriptSig, pkScript)
+		if err != nil || parsed.Class != txscript.MultiSigTy || !bytes.Equal(parsed.RedeemScript, redeemScript) {
+			t.Errorf("%x: got %+v, %v", pkScript, parsed, err)
+		}
+	}
+	p2pkhScriptSig, _ := SignatureScript(tx, 0, p2pkh, hashType, keys[0], true, 1000, AllowDangerousSigHash(hashType))
+	if parsed, err := ParseScriptSig(p2pkhScriptSig, withToken(p2pkh)); err != nil ||
+		parsed.Class != txscript.PubKeyHashTy || len(parsed.Signatures) != 1 {
+		t.Errorf("token pay-to-pubkey-hash: got %+v, %v", parsed, err)
+	}
+	if _, err := ParseScriptSig(p2pkhScriptSig, append([]byte{0xef}, p2pkh...)); !errors.Is(err,
+		ErrInvalidTokenPrefix) {
+		t.Errorf("invalid token prefix: got %v, want ErrInvalidTokenPrefix", err)
+	}
+
+	for i, test := range []struct {
+		scriptSig, pkScript []byte
+	}{
+		{[]byte{0x4c}, p2pkh},
+		{[]byte{txscript.OP_DUP}, p2pkh},
+		{[]byte{0x01, 0x01}, p2pkh},
+		{append([]byte{0x41}, schnorrSig...), p2pkh},
+		{nil, p2sh},
+		{[]byte{0x01, 0x01, byte(len(redeemScript))}, p2sh},
+	} {
+		_, err := ParseScriptSig(test.scriptSig, test.pkScript)
+		if !errors.Is(err, ErrMalformedScriptSig) {
+			t.Errorf("test %d: got %v, want ErrMalformedScriptSig", i, err)
+		}
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		scriptSig := make([]byte, r.Intn(100))
+		r.Read(scriptSig)
+		ParseScriptSig(scriptSig, p2pkh)
+		ParseScriptSig(scriptSig, p2sh)
+	}
+}
+
+func TestAnalyzeP2SHSpend(t *testing.T) {
+	keys := signingTestKeys()
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_1)
+	for _, key := range keys[:2] {
+		builder.AddData(key.PubKey().SerializeCompressed())
+	}
+	redeemScript, _ := builder.AddOp(txscript.OP_2).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	sig := append(bytes.Repeat([]byte{0x11}, SchnorrSignatureLen), byte(txscript.SigHashAll))
+	scriptSig, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(sig).AddData(redeemScript).Script()
+
+	// The redeem script pushed with OP_PUSHDATA2 rather than OP_PUSHDATA1.
+	pushData2 := append([]byte{txscript.OP_0, byte(len(sig))}, sig...)
+	pushData2 = append(pushData2, txscript.OP_PUSHDATA2, byte(len(redeemScript)), 0)
+	pushData2 = append(pushData2, redeemScript...)
+
+	for i, s := range [][]byte{scriptSig, pushData2} {
+		got, err := ExtractRedeemScript(s)
+		if err != nil || !bytes.Equal(got, redeemScript) {
+			t.Errorf("test %d: got %x, %v", i, got, err)
+		}
+	}
+	for i, s := range [][]byte{
+		nil,
+		{txscript.OP_0},
+		{txscript.OP_PUSHDATA1, 0},
+		{txscript.OP_DATA_2, 1},
+		{txscript.OP_PUSHDATA2, 0xff},
+		append([]byte{txscript.OP_NOP}, scriptSig...),
+		{txscript.OP_RESERVED, txscript.OP_DATA_1, 1},
+	} {
+		if _, err := ExtractRedeemScript(s); !errors.Is(err, ErrMalformedScriptSig) {
+			t.Errorf("test %d: got %v, want ErrMalformedScriptSig", i, err)
+		}
+	}
+
+	p2sh, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+	p2sh32Addr, _ := NewCashAddressScriptHash32(redeemScript, &chaincfg.MainNetParams)
+	p2sh32, _ := cashPayToAddrScript(p2sh32Addr)
+	for i, pkScript := range [][]byte{p2sh, p2sh32, append((&TokenData{Category: chainhash.Hash{0xaa}, Amount: 1}).Bytes(), p2sh...)} {
+		spend, err := AnalyzeP2SHSpend(pushData2, pkScript, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if spend.Class != txscript.MultiSigTy || len(spend.Addresses) != 2 ||
+			!bytes.Equal(spend.RedeemScript, redeemScript) {
+			t.Errorf("test %d: got %+v", i, spend)
+		}
+		want, _ := NewCashAddressPubKeyHash(btcutil.Hash160(keys[1].PubKey().SerializeCompressed()),
+			&chaincfg.MainNetParams)
+		if spend.Addresses[1].String() != want.String() {
+			t.Errorf("test %d: got address %v, want %v", i, spend.Addresses[1], want)
+		}
+	}
+
+	other, _ := payToScriptHashScript(btcutil.Hash160(redeemScript[1:]))
+	if _, err := AnalyzeP2SHSpend(scriptSig, other, &chaincfg.MainNetParams); !errors.Is(err,
+		ErrRedeemScriptMismatch) {
+		t.Errorf("got %v, want ErrRedeemScriptMismatch", err)
+	}
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(redeemScript))
+	if _, err := AnalyzeP2SHSpend(scriptSig, p2pkh, &chaincfg.MainNetParams); !errors.Is(err,
+		ErrNonStandardScript) {
+		t.Errorf("got %v, want ErrNonStandardScript", err)
+	}
+}
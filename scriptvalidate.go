@@ -0,0 +1,255 @@
+package bchutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// minSchnorrBatch is the smallest number of deferred signatures of a
+// transaction that ValidateTxBatch gives a worker to batch verify.
+const minSchnorrBatch = 32
+
+// InputError describes the failure of the scripts of an input.
+type InputError struct {
+	Index int
+	Err   error
+}
+
+// Error returns the input and its failure.
+func (e *InputError) Error() string {
+	return fmt.Sprintf("input %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the failure of the input.
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+// TxScriptError lists the inputs of a transaction whose scripts fail, in
+// order.
+type TxScriptError struct {
+	Inputs []*InputError
+}
+
+// Error returns all the failures.
+func (e *TxScriptError) Error() string {
+	msgs := make([]string, len(e.Inputs))
+	for i, err := range e.Inputs {
+		msgs[i] = err.Error()
+	}
+	return "script validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the failures of the inputs, for errors.Is and errors.As to
+// match any of them.
+func (e *TxScriptError) Unwrap() []error {
+	errs := make([]error, len(e.Inputs))
+	for i, err := range e.Inputs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// ValidateTxScripts executes the scripts of all inputs of tx, spending the
+// outputs of prevOuts, with flags and returns a *TxScriptError listing those
+// failing, or nil if they all succeed.  The inputs are validated by workers
+// goroutines, runtime.NumCPU() when not positive, sharing the sighash midstate
+// of tx.  The validation stops with the error of ctx when it is done.
+func ValidateTxScripts(ctx context.Context, tx *wire.MsgTx, prevOuts map[int]*wire.TxOut, flags ScriptFlags,
+	workers int, opts ...VerifyOption) error {
+
+	errs, err := ValidateTxBatch(ctx, []*wire.MsgTx{tx}, []map[int]*wire.TxOut{prevOuts}, flags, workers, opts...)
+	if err != nil {
+		return err
+	}
+	return errs[0]
+}
+
+// txValidation is the state of the validation of a transaction.
+type txValidation struct {
+	sigHashes *txscript.TxSigHashes
+	errs      []error
+	failed    int32
+
+	// deferred holds the Schnorr signatures of every input, with
+	// WithBatchSchnorr.
+	deferred [][]SchnorrVerifyItem
+}
+
+// fail records the failure of an input.
+func (v *txValidation) fail(idx int, err error) {
+	v.errs[idx] = err
+	atomic.StoreInt32(&v.failed, 1)
+}
+
+// ValidateTxBatch validates the scripts of txs like ValidateTxScripts, the
+// previous outputs of txs[i] being prevOuts[i], with a single pool of workers
+// for all their inputs.  It returns the result of every transaction, nil for
+// those whose scripts all succeed, or the error of ctx if it is done first.
+func ValidateTxBatch(ctx context.Context, txs []*wire.MsgTx, prevOuts []map[int]*wire.TxOut, flags ScriptFlags,
+	workers int, opts ...VerifyOption) ([]error, error) {
+
+	if len(prevOuts) != len(txs) {
+		return nil, fmt.Errorf("%d previous output sets for %d transactions", len(prevOuts), len(txs))
+	}
+	o := newVerifyOptions(opts)
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	type inputJob struct{ tx, input int }
+	var jobs []inputJob
+	states := make([]txValidation, len(txs))
+	for i, tx := range txs {
+		states[i] = txValidation{sigHashes: txscript.NewTxSigHashes(tx), errs: make([]error, len(tx.TxIn))}
+		if o.batchSchnorr {
+			states[i].deferred = make([][]SchnorrVerifyItem, len(tx.TxIn))
+		}
+		for j := range tx.TxIn {
+			jobs = append(jobs, inputJob{i, j})
+		}
+	}
+	err := runWorkers(ctx, workers, len(jobs), func(k int) {
+		job := jobs[k]
+		v := &states[job.tx]
+		if o.failFast && atomic.LoadInt32(&v.failed) != 0 {
+			return
+		}
+		prevOut, ok := prevOuts[job.tx][job.input]
+		if !ok {
+			v.fail(job.input, errors.New("no previous output"))
+			return
+		}
+		vm, err := NewEngine(prevOut.PkScript, txs[job.tx], job.input, flags, v.sigHashes, prevOut.Value)
+		if err == nil {
+			if o.batchSchnorr {
+				vm.DeferSchnorr()
+			}
+			err = vm.Execute()
+		}
+		if err != nil {
+			v.fail(job.input, err)
+			return
+		}
+		if o.batchSchnorr {
+			v.deferred[job.input] = vm.DeferredSchnorr()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if o.batchSchnorr {
+		if err := verifyDeferredSchnorr(ctx, states, workers, o.failFast); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]error, len(txs))
+	for i := range states {
+		var failures []*InputError
+		for j, err := range states[i].errs {
+			if err != nil {
+				failures = append(failures, &InputError{Index: j, Err: err})
+			}
+		}
+		if len(failures) != 0 {
+			results[i] = &TxScriptError{Inputs: failures}
+		}
+	}
+	return results, nil
+}
+
+// verifyDeferredSchnorr batch verifies the Schnorr signatures deferred by the
+// inputs of the transactions, split among workers, and fails the inputs with
+// invalid ones.  Transactions already failed are skipped with failFast.
+func verifyDeferredSchnorr(ctx context.Context, states []txValidation, workers int, failFast bool) error {
+	type batchJob struct {
+		tx     int
+		items  []SchnorrVerifyItem
+		inputs []int
+	}
+	var jobs []*batchJob
+	for i := range states {
+		v := &states[i]
+		if failFast && v.failed != 0 {
+			continue
+		}
+		var items []SchnorrVerifyItem
+		var inputs []int
+		for input, deferred := range v.deferred {
+			if v.errs[input] != nil {
+				continue
+			}
+			for _, item := range deferred {
+				items = append(items, item)
+				inputs = append(inputs, input)
+			}
+		}
+		size := (len(items) + workers - 1) / workers
+		if size < minSchnorrBatch {
+			size = minSchnorrBatch
+		}
+		for start := 0; start < len(items); start += size {
+			end := start + size
+			if end > len(items) {
+				end = len(items)
+			}
+			jobs = append(jobs, &batchJob{tx: i, items: items[start:end], inputs: inputs[start:end]})
+		}
+	}
+
+	var mu sync.Mutex
+	return runWorkers(ctx, workers, len(jobs), func(k int) {
+		job := jobs[k]
+		err := BatchVerifySchnorr(job.items)
+		var batchErr *BatchVerifyError
+		if !errors.As(err, &batchErr) {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		v := &states[job.tx]
+		for _, item := range batchErr.Failed {
+			if input := job.inputs[item]; v.errs[input] == nil {
+				v.fail(input, fmt.Errorf("%w: invalid Schnorr signature", ErrNullFail))
+			}
+		}
+	})
+}
+
+// runWorkers calls fn with every index below n from workers goroutines, until
+// ctx is done.
+func runWorkers(ctx context.Context, workers, n int, fn func(int)) error {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				fn(k)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+	for k := 0; k < n; k++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		select {
+		case jobs <- k:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
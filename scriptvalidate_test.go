@@ -0,0 +1,122 @@
+package bchutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// scriptValidationTestTx returns a transaction spending n outputs, signed with
+// Schnorr signatures but every fifth input, and its previous outputs, every
+// third one carrying tokens from the third one.
+func scriptValidationTestTx(t *testing.T, n int, seed byte) (*wire.MsgTx, map[int]*wire.TxOut) {
+	keys := signingTestKeys()
+	tx := wire.NewMsgTx(wire.TxVersion)
+	prevOuts := make(map[int]*wire.TxOut)
+	tokens := make(map[int]*TokenData)
+	for i := 0; i < n; i++ {
+		pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(keys[i%2].PubKey().SerializeCompressed()))
+		if i%3 == 2 {
+			tokens[i] = &TokenData{Category: chainhash.Hash{seed}, Amount: uint64(i)}
+			pkScript = append(tokens[i].Bytes(), pkScript...)
+		}
+		prevOuts[i] = wire.NewTxOut(10000, pkScript)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{seed, byte(i)}}, nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(int64(n)*9000, prevOuts[0].PkScript))
+	for i := range tx.TxIn {
+		opts := []SignOption{WithTokenPrevout(tokens[i])}
+		if i%5 != 0 {
+			opts = append(opts, WithSchnorr())
+		}
+		_, pkScript, _ := SplitTokenPrefix(prevOuts[i].PkScript)
+		scriptSig, err := SignatureScript(tx, i, pkScript, txscript.SigHashAll|SigHashForkID,
+			keys[i%2], true, 10000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TxIn[i].SignatureScript = scriptSig
+	}
+	return tx, prevOuts
+}
+
+// failedInputs returns the inputs listed by a *TxScriptError.
+func failedInputs(t *testing.T, err error) []int {
+	var scriptErr *TxScriptError
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("got %v, want a TxScriptError", err)
+	}
+	var inputs []int
+	for _, input := range scriptErr.Inputs {
+		inputs = append(inputs, input.Index)
+	}
+	return inputs
+}
+
+func TestValidateTxScripts(t *testing.T) {
+	ctx := context.Background()
+	tx, prevOuts := scriptValidationTestTx(t, 40, 0)
+	for _, opts := range [][]VerifyOption{nil, {WithBatchSchnorr()}} {
+		if err := ValidateTxScripts(ctx, tx, prevOuts, StandardScriptFlags, 4, opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Inputs 3 and 10 carry the signatures of other inputs, and the
+	// previous output of input 25 is missing.
+	tx.TxIn[3].SignatureScript = tx.TxIn[5].SignatureScript
+	tx.TxIn[10].SignatureScript = tx.TxIn[20].SignatureScript
+	delete(prevOuts, 25)
+	for _, opts := range [][]VerifyOption{nil, {WithBatchSchnorr()}} {
+		err := ValidateTxScripts(ctx, tx, prevOuts, StandardScriptFlags, 4, opts...)
+		if inputs := failedInputs(t, err); len(inputs) != 3 || inputs[0] != 3 || inputs[1] != 10 ||
+			inputs[2] != 25 {
+			t.Fatalf("inputs %v failed", inputs)
+		}
+		if !errors.Is(err, ErrNullFail) {
+			t.Fatalf("got %v, want ErrNullFail", err)
+		}
+	}
+	// A single worker stops at the first failure.
+	err := ValidateTxScripts(ctx, tx, prevOuts, StandardScriptFlags, 1, WithFailFast())
+	if inputs := failedInputs(t, err); len(inputs) != 1 || inputs[0] != 3 {
+		t.Fatalf("inputs %v failed", inputs)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := ValidateTxScripts(canceled, tx, prevOuts, StandardScriptFlags, 4); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestValidateTxBatch(t *testing.T) {
+	var txs []*wire.MsgTx
+	var prevOuts []map[int]*wire.TxOut
+	for i := 0; i < 3; i++ {
+		tx, txPrevOuts := scriptValidationTestTx(t, 10, byte(i))
+		txs = append(txs, tx)
+		prevOuts = append(prevOuts, txPrevOuts)
+	}
+	txs[1].TxIn[7].SignatureScript = txs[0].TxIn[7].SignatureScript
+	for _, opts := range [][]VerifyOption{nil, {WithBatchSchnorr()}, {WithFailFast()}} {
+		errs, err := ValidateTxBatch(context.Background(), txs, prevOuts, StandardScriptFlags, 0, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(errs) != 3 || errs[0] != nil || errs[2] != nil {
+			t.Fatalf("got %v", errs)
+		}
+		if inputs := failedInputs(t, errs[1]); len(inputs) != 1 || inputs[0] != 7 {
+			t.Fatalf("inputs %v failed", inputs)
+		}
+	}
+	if _, err := ValidateTxBatch(context.Background(), txs, prevOuts[:2], StandardScriptFlags, 0); err == nil {
+		t.Fatal("missing previous outputs accepted")
+	}
+}
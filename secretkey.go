@@ -0,0 +1,89 @@
+package bchutil
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// ErrKeyWiped describes an error where a SecretKey is used after Wipe.
+var ErrKeyWiped = errors.New("secret key was wiped")
+
+// SecretKey owns the bytes of a private key and can wipe them from memory.
+// It implements Signer.
+//
+// Go gives no guarantee that a value is never copied by the runtime, so
+// wiping is best effort: it clears the buffer and the scalar held by the key,
+// and signing wipes its own scalars and nonces.  The intermediate values of
+// math/big arithmetic and the internal state of the HMAC used for nonce
+// derivation are not wiped; they are unreachable garbage once signing
+// returns.  Keys created from a btcec.PrivateKey leave the original value
+// untouched, so callers should prefer NewSecretKey from bytes they wipe.
+type SecretKey struct {
+	mu     sync.Mutex
+	buf    [32]byte
+	d      *big.Int
+	pubKey *btcec.PublicKey
+	wiped  bool
+}
+
+// NewSecretKey returns a SecretKey holding a copy of the 32 byte private key
+// b.  The caller should wipe b once done with it.
+func NewSecretKey(b []byte) (*SecretKey, error) {
+	if len(b) != 32 {
+		return nil, errors.New("private key must be 32 bytes")
+	}
+	k := &SecretKey{}
+	copy(k.buf[:], b)
+	k.d = new(big.Int).SetBytes(k.buf[:])
+	if k.d.Sign() == 0 || k.d.Cmp(btcec.S256().N) >= 0 {
+		k.Wipe()
+		return nil, errors.New("private key out of range")
+	}
+	x, y := btcec.S256().ScalarBaseMult(k.buf[:])
+	k.pubKey = &btcec.PublicKey{Curve: btcec.S256(), X: x, Y: y}
+	return k, nil
+}
+
+// NewSecretKeyFromPrivKey returns a SecretKey for key.  key itself is not
+// wiped by the returned key.
+func NewSecretKeyFromPrivKey(key *btcec.PrivateKey) *SecretKey {
+	k := &SecretKey{d: new(big.Int).Set(key.D)}
+	k.d.FillBytes(k.buf[:])
+	k.pubKey = key.PubKey()
+	return k
+}
+
+// PubKey returns the public key of the key, which stays available after
+// Wipe.
+func (k *SecretKey) PubKey() *btcec.PublicKey {
+	return k.pubKey
+}
+
+// SignDigest implements Signer.  It returns ErrKeyWiped after Wipe.
+func (k *SecretKey) SignDigest(digest []byte, opts *SignerOpts) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.wiped {
+		return nil, ErrKeyWiped
+	}
+	return signDigest(k.d, k.pubKey, digest, opts)
+}
+
+// Wipe zeroes the key material.  Further signing fails with ErrKeyWiped.
+func (k *SecretKey) Wipe() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	zeroBytes(k.buf[:])
+	zeroScalar(k.d)
+	k.wiped = true
+}
+
+// Wiped returns whether Wipe was called.
+func (k *SecretKey) Wiped() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.wiped
+}
@@ -0,0 +1,64 @@
+package bchutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+func TestSecretKeyWipe(t *testing.T) {
+	raw := sha256.Sum256([]byte("secret key test"))
+	key, err := NewSecretKey(raw[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), raw[:])
+	if !key.PubKey().IsEqual(priv.PubKey()) {
+		t.Fatal("wrong public key")
+	}
+
+	digest := sha256.Sum256([]byte("digest"))
+	sig, err := key.SignDigest(digest[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := NewPrivKeySigner(priv).SignDigest(digest[:], nil)
+	if !bytes.Equal(sig, want) {
+		t.Error("signature differs from the in-memory key signature")
+	}
+
+	// The scalar is the same after signing: signing does not consume it.
+	words := key.d.Bits()
+	if key.d.Cmp(priv.D) != 0 {
+		t.Fatal("signing modified the key")
+	}
+
+	key.Wipe()
+	if !key.Wiped() {
+		t.Error("key is not marked as wiped")
+	}
+	if key.buf != ([32]byte{}) {
+		t.Error("key buffer is not zeroed")
+	}
+	for _, w := range words {
+		if w != 0 {
+			t.Error("scalar words are not zeroed")
+		}
+	}
+	if _, err := key.SignDigest(digest[:], &SignerOpts{Schnorr: true}); err != ErrKeyWiped {
+		t.Errorf("expected ErrKeyWiped, got %v", err)
+	}
+	if key.PubKey() == nil {
+		t.Error("public key is not available after Wipe")
+	}
+}
+
+func TestSecretKeyInvalid(t *testing.T) {
+	for _, raw := range [][]byte{make([]byte, 31), make([]byte, 32), btcec.S256().N.Bytes()} {
+		if _, err := NewSecretKey(raw); err == nil {
+			t.Errorf("key %x accepted", raw)
+		}
+	}
+}
@@ -18,7 +18,11 @@ var TestnetDNSSeeds = []chaincfg.DNSSeed{
 	{"testnet-seed.deadalnix.me", true},
 }
 
+// GetDNSSeed returns the DNS seeds of the network of params.
 func GetDNSSeed(params *chaincfg.Params) []chaincfg.DNSSeed {
+	if IsECash(params) {
+		return params.DNSSeeds
+	}
 	if params.Name == chaincfg.MainNetParams.Name {
 		return MainnetDNSSeeds
 	}
@@ -0,0 +1,115 @@
+package bchutil
+
+import (
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// SetShuffle makes the builder shuffle the outputs of the transaction, change
+// included, so that the change can't be told apart from its position, and its
+// inputs too if shuffleInputs is set.  Outputs whose position is required by a
+// protocol or covenant are listed in pinned, by index of AddOutput calls, and
+// keep their position, as does an OP_RETURN first output such as the one of
+// SLP transactions.  Shuffling uses crypto/rand and happens before signing,
+// since signatures commit to the order.
+func (b *TxBuilder) SetShuffle(shuffleInputs bool, pinned ...int) {
+	b.shuffleOutputs = true
+	b.shuffleInputs = shuffleInputs
+	b.pinnedOutputs = make(map[int]bool, len(pinned))
+	for _, idx := range pinned {
+		b.pinnedOutputs[idx] = true
+	}
+}
+
+// shuffle shuffles the outputs and inputs of u as requested by SetShuffle,
+// updating its change indexes, recipients and previous outputs.  The outputs
+// of u pay its recipients first, followed by the token change and change,
+// denominated or not.
+func (b *TxBuilder) shuffle(u *UnsignedTx) error {
+	if !b.shuffleOutputs {
+		return nil
+	}
+	tx := u.Tx
+	var movable []int
+	for i, txOut := range tx.TxOut {
+		pinned := b.pinnedOutputs[i] && i < len(u.Recipients)
+		if i == 0 && i != u.ChangeIndex && txscript.GetScriptClass(txOut.PkScript) == txscript.NullDataTy {
+			pinned = true
+		}
+		if !pinned {
+			movable = append(movable, i)
+		}
+	}
+	perm, err := b.permutation(len(movable))
+	if err != nil {
+		return err
+	}
+
+	// order[i] is the index before shuffling of output i.
+	order := make([]int, len(tx.TxOut))
+	for i := range order {
+		order[i] = i
+	}
+	for i, j := range perm {
+		order[movable[i]] = movable[j]
+	}
+	denominated := make(map[int]bool, len(u.DenominatedChange))
+	for _, j := range u.DenominatedChange {
+		denominated[j] = true
+	}
+	outputs := make([]*wire.TxOut, len(tx.TxOut))
+	var recipients, tokenChange, denominatedChange []int
+	changeIndex := -1
+	for i, j := range order {
+		outputs[i] = tx.TxOut[j]
+		switch {
+		case j < len(u.Recipients):
+			recipients = append(recipients, u.Recipients[j])
+		case j == u.ChangeIndex:
+			changeIndex = i
+		case denominated[j]:
+			denominatedChange = append(denominatedChange, i)
+		default:
+			tokenChange = append(tokenChange, i)
+		}
+	}
+	tx.TxOut, u.Recipients, u.ChangeIndex, u.TokenChange = outputs, recipients, changeIndex, tokenChange
+	u.DenominatedChange = denominatedChange
+
+	if !b.shuffleInputs {
+		return nil
+	}
+	perm, err = b.permutation(len(tx.TxIn))
+	if err != nil {
+		return err
+	}
+	inputs := make([]*wire.TxIn, len(tx.TxIn))
+	prevOuts := make(map[int]*wire.TxOut, len(u.PrevOuts))
+	for i, j := range perm {
+		inputs[i] = tx.TxIn[j]
+		prevOuts[i] = u.PrevOuts[j]
+	}
+	tx.TxIn, u.PrevOuts = inputs, prevOuts
+	return nil
+}
+
+// permutation returns a uniformly random permutation of [0, n) using the
+// Fisher-Yates shuffle.
+func (b *TxBuilder) permutation(n int) ([]int, error) {
+	randInt := b.randInt
+	if randInt == nil {
+		randInt = cryptoRandInt
+	}
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j, err := randInt(i + 1)
+		if err != nil {
+			return nil, err
+		}
+		perm[i], perm[j] = perm[j], perm[i]
+	}
+	return perm, nil
+}
@@ -0,0 +1,76 @@
+package bchutil
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestShuffle(t *testing.T) {
+	changeScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	opReturn, _ := txscript.NullDataScript([]byte("SLP"))
+	utxos := make(map[wire.OutPoint]UTXO)
+	for i := 0; i < 5; i++ {
+		u := UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(i)}}, Amount: btcutil.Amount(10000 + 100*i), PkScript: changeScript}
+		utxos[u.OutPoint] = u
+	}
+
+	changePositions := make(map[int]bool)
+	inputOrders := make(map[wire.OutPoint]bool)
+	for n := 0; n < 50; n++ {
+		b := NewTxBuilder(1000, changeScript)
+		for _, u := range utxos {
+			b.AddUTXOs(u)
+		}
+		outputs := []*wire.TxOut{wire.NewTxOut(0, opReturn)}
+		for i := 1; i < 6; i++ {
+			pkScript, _ := payToPubKeyHashScript(bytes.Repeat([]byte{byte(i)}, 20))
+			outputs = append(outputs, wire.NewTxOut(int64(1000*i), pkScript))
+		}
+		for _, txOut := range outputs {
+			b.AddOutput(txOut)
+		}
+		b.SetShuffle(true, 3)
+		u, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := u.Tx
+
+		if !bytes.Equal(tx.TxOut[0].PkScript, opReturn) || tx.TxOut[3].Value != outputs[3].Value {
+			t.Fatal("pinned output moved")
+		}
+		if u.ChangeIndex < 0 || !bytes.Equal(tx.TxOut[u.ChangeIndex].PkScript, changeScript) {
+			t.Fatalf("change index %d is not the change", u.ChangeIndex)
+		}
+		changePositions[u.ChangeIndex] = true
+		j := 0
+		for i, txOut := range tx.TxOut {
+			if i == u.ChangeIndex {
+				continue
+			}
+			if !bytes.Equal(txOut.PkScript, outputs[u.Recipients[j]].PkScript) {
+				t.Fatalf("output %d does not pay recipient %d", i, u.Recipients[j])
+			}
+			j++
+		}
+		for i, txIn := range tx.TxIn {
+			if u.PrevOuts[i].Value != int64(utxos[txIn.PreviousOutPoint].Amount) {
+				t.Fatalf("wrong previous output for input %d", i)
+			}
+		}
+		inputOrders[tx.TxIn[0].PreviousOutPoint] = true
+	}
+	if len(changePositions) < 2 || len(inputOrders) < 2 {
+		t.Error("outputs or inputs not shuffled")
+	}
+	for i := range changePositions {
+		if i == 0 || i == 3 {
+			t.Errorf("change at pinned position %d", i)
+		}
+	}
+}
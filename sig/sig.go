@@ -0,0 +1,370 @@
+// Package sig parses, serializes and normalizes ECDSA signatures in their DER
+// and compact forms, and splits the sighash type byte off the signatures of
+// transactions.
+//
+// Signatures of transactions are strict DER since BIP 66, and those of the
+// chain before it or of other sources may only be lax DER, as OpenSSL
+// accepted: ParseDERSignature parses both, and reports each deviation from
+// strict DER with its own error.
+package sig
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+const (
+	// minDERSigLen and maxDERSigLen bound the strict DER signatures, of
+	// integers of 1 to 33 bytes.
+	minDERSigLen = 8
+	maxDERSigLen = 72
+
+	// CompactSigLen is the length of compact signatures, R and S as 32
+	// byte big endian integers.
+	CompactSigLen = 64
+
+	// sigHashForkID is the flag of the sighash types of Bitcoin Cash.
+	sigHashForkID = 0x40
+)
+
+var (
+	// ErrSigTooShort describes an error where a signature is shorter than
+	// the smallest signature of its encoding.
+	ErrSigTooShort = errors.New("signature too short")
+
+	// ErrSigTooLong describes an error where a signature is longer than
+	// the largest signature of its encoding.
+	ErrSigTooLong = errors.New("signature too long")
+
+	// ErrSigNoSequence describes an error where a DER signature does not
+	// start with the tag of an ASN.1 sequence.
+	ErrSigNoSequence = errors.New("signature is not a DER sequence")
+
+	// ErrSigBadLength describes an error where a length of a DER signature
+	// does not match its content, or exceeds the data left.
+	ErrSigBadLength = errors.New("bad DER length")
+
+	// ErrSigTrailingGarbage describes an error where bytes follow the
+	// sequence of a strict DER signature.
+	ErrSigTrailingGarbage = errors.New("trailing bytes after DER signature")
+
+	// ErrSigNoInteger describes an error where R or S of a DER signature
+	// is not tagged as an ASN.1 integer.
+	ErrSigNoInteger = errors.New("DER signature value is not an integer")
+
+	// ErrSigEmptyInteger describes an error where R or S of a DER
+	// signature has no bytes.
+	ErrSigEmptyInteger = errors.New("empty DER integer")
+
+	// ErrSigNegative describes an error where R or S of a strict DER
+	// signature is negative, its first byte having its high bit set.
+	ErrSigNegative = errors.New("negative DER integer")
+
+	// ErrSigExcessPadding describes an error where R or S of a strict DER
+	// signature has a leading zero byte that is not needed to keep it
+	// positive.
+	ErrSigExcessPadding = errors.New("excessively padded DER integer")
+
+	// ErrSigOverflow describes an error where R or S is not below the
+	// order of the curve.
+	ErrSigOverflow = errors.New("signature value exceeds the curve order")
+
+	// ErrSigZero describes an error where R or S is zero.
+	ErrSigZero = errors.New("zero signature value")
+
+	// ErrNoSigHashType describes an error where a signature ends without
+	// a sighash type byte.
+	ErrNoSigHashType = errors.New("no sighash type byte")
+
+	// ErrInvalidSigHashType describes an error where the sighash type byte
+	// of a signature is not ALL, NONE or SINGLE with its flags.
+	ErrInvalidSigHashType = errors.New("invalid sighash type")
+)
+
+// order is the order of the curve, above the values of signatures, and
+// halfOrder its half, above the low S values.
+var (
+	order     = btcec.S256().N
+	halfOrder = new(big.Int).Rsh(btcec.S256().N, 1)
+)
+
+// checkValue returns an error unless v, named name, is within [1, N-1].
+func checkValue(name string, v *big.Int) error {
+	if v.Sign() == 0 {
+		return fmt.Errorf("%w: %s", ErrSigZero, name)
+	}
+	if v.Cmp(order) >= 0 {
+		return fmt.Errorf("%w: %s", ErrSigOverflow, name)
+	}
+	return nil
+}
+
+// ParseDERSignature parses der, a DER signature without sighash type byte.
+// With strict, it must be strict DER as BIP 66 requires of the signatures of
+// transactions: the single sequence of the shortest encodings of two positive
+// integers.  Otherwise it is parsed as lax DER, as OpenSSL did: lengths in
+// long form, integers with padding or the high bit set, read as unsigned,
+// and bytes following the sequence are accepted.  In both modes R and S must
+// be within [1, N-1].
+func ParseDERSignature(der []byte, strict bool) (*btcec.Signature, error) {
+	if strict {
+		return parseStrictDER(der)
+	}
+	return parseLaxDER(der)
+}
+
+// splitStrictDER returns the bytes of R and S of the strict DER signature der,
+// whose values are not checked.
+func splitStrictDER(der []byte) (r, s []byte, err error) {
+	if len(der) < minDERSigLen {
+		return nil, nil, fmt.Errorf("%w: %d DER bytes", ErrSigTooShort, len(der))
+	}
+	if len(der) > maxDERSigLen {
+		return nil, nil, fmt.Errorf("%w: %d DER bytes", ErrSigTooLong, len(der))
+	}
+	if der[0] != 0x30 {
+		return nil, nil, fmt.Errorf("%w: tag %#02x", ErrSigNoSequence, der[0])
+	}
+	switch seqLen := int(der[1]); {
+	case seqLen+2 < len(der):
+		return nil, nil, fmt.Errorf("%w: %d bytes", ErrSigTrailingGarbage, len(der)-seqLen-2)
+	case seqLen+2 > len(der):
+		return nil, nil, fmt.Errorf("%w: sequence of %d bytes, %d left", ErrSigBadLength, seqLen, len(der)-2)
+	}
+
+	rest := der[2:]
+	for _, v := range []struct {
+		name  string
+		value *[]byte
+	}{{"R", &r}, {"S", &s}} {
+		if len(rest) < 2 {
+			return nil, nil, fmt.Errorf("%w: %s missing", ErrSigBadLength, v.name)
+		}
+		if rest[0] != 0x02 {
+			return nil, nil, fmt.Errorf("%w: %s tag %#02x", ErrSigNoInteger, v.name, rest[0])
+		}
+		n := int(rest[1])
+		if n == 0 {
+			return nil, nil, fmt.Errorf("%w: %s", ErrSigEmptyInteger, v.name)
+		}
+		if n > len(rest)-2 || n&0x80 != 0 {
+			return nil, nil, fmt.Errorf("%w: %s of %d bytes, %d left", ErrSigBadLength, v.name, n, len(rest)-2)
+		}
+		b := rest[2 : 2+n]
+		if b[0]&0x80 != 0 {
+			return nil, nil, fmt.Errorf("%w: %s", ErrSigNegative, v.name)
+		}
+		if n > 1 && b[0] == 0 && b[1]&0x80 == 0 {
+			return nil, nil, fmt.Errorf("%w: %s", ErrSigExcessPadding, v.name)
+		}
+		*v.value = b
+		rest = rest[2+n:]
+	}
+	if len(rest) != 0 {
+		return nil, nil, fmt.Errorf("%w: sequence length covers %d bytes after S", ErrSigBadLength, len(rest))
+	}
+	return r, s, nil
+}
+
+// parseStrictDER parses the strict DER signature der.
+func parseStrictDER(der []byte) (*btcec.Signature, error) {
+	r, s, err := splitStrictDER(der)
+	if err != nil {
+		return nil, err
+	}
+	sig := &btcec.Signature{R: new(big.Int).SetBytes(r), S: new(big.Int).SetBytes(s)}
+	if err := checkValue("R", sig.R); err != nil {
+		return nil, err
+	}
+	if err := checkValue("S", sig.S); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// CheckDEREncoding returns an error unless der, a signature without sighash
+// type byte, has the strict DER encoding BIP 66 requires of the signatures
+// checked by scripts, with the errors of ParseDERSignature.  Unlike it, R and
+// S are not checked against the order of the curve: scripts fail such
+// signatures when verifying them, not when checking their encoding.
+func CheckDEREncoding(der []byte) error {
+	_, _, err := splitStrictDER(der)
+	return err
+}
+
+// HasLowS returns whether der, a strict DER signature without sighash type
+// byte, has an S at most half the order of the curve, as IsLowS does for
+// parsed signatures.  Signatures that are not strict DER have no low S.
+func HasLowS(der []byte) bool {
+	_, s, err := splitStrictDER(der)
+	return err == nil && new(big.Int).SetBytes(s).Cmp(halfOrder) <= 0
+}
+
+// laxLength returns the length at the start of b, in short or long form with
+// any leading zeros, and the number of its bytes.
+func laxLength(b []byte) (int, int, error) {
+	if len(b) == 0 {
+		return 0, 0, fmt.Errorf("%w: missing length", ErrSigBadLength)
+	}
+	if b[0]&0x80 == 0 {
+		return int(b[0]), 1, nil
+	}
+	n := int(b[0] & 0x7f)
+	if n > len(b)-1 {
+		return 0, 0, fmt.Errorf("%w: long form length of %d bytes, %d left", ErrSigBadLength, n, len(b)-1)
+	}
+	length := 0
+	for _, c := range b[1 : 1+n] {
+		if length > len(b) {
+			return 0, 0, fmt.Errorf("%w: long form length exceeds the data", ErrSigBadLength)
+		}
+		length = length<<8 | int(c)
+	}
+	return length, 1 + n, nil
+}
+
+// parseLaxDER parses the lax DER signature der.
+func parseLaxDER(der []byte) (*btcec.Signature, error) {
+	if len(der) == 0 || der[0] != 0x30 {
+		if len(der) == 0 {
+			return nil, fmt.Errorf("%w: no DER bytes", ErrSigTooShort)
+		}
+		return nil, fmt.Errorf("%w: tag %#02x", ErrSigNoSequence, der[0])
+	}
+	// The length of the sequence is ignored.
+	_, n, err := laxLength(der[1:])
+	if err != nil {
+		return nil, err
+	}
+	rest := der[1+n:]
+
+	sig := &btcec.Signature{}
+	for _, v := range []struct {
+		name  string
+		value **big.Int
+	}{{"R", &sig.R}, {"S", &sig.S}} {
+		if len(rest) == 0 {
+			return nil, fmt.Errorf("%w: %s missing", ErrSigBadLength, v.name)
+		}
+		if rest[0] != 0x02 {
+			return nil, fmt.Errorf("%w: %s tag %#02x", ErrSigNoInteger, v.name, rest[0])
+		}
+		length, n, err := laxLength(rest[1:])
+		if err != nil {
+			return nil, err
+		}
+		rest = rest[1+n:]
+		if length > len(rest) {
+			return nil, fmt.Errorf("%w: %s of %d bytes, %d left", ErrSigBadLength, v.name, length, len(rest))
+		}
+		b := rest[:length]
+		rest = rest[length:]
+		for len(b) != 0 && b[0] == 0 {
+			b = b[1:]
+		}
+		if len(b) > 32 {
+			return nil, fmt.Errorf("%w: %s of %d bytes", ErrSigOverflow, v.name, len(b))
+		}
+		*v.value = new(big.Int).SetBytes(b)
+		if err := checkValue(v.name, *v.value); err != nil {
+			return nil, err
+		}
+	}
+	return sig, nil
+}
+
+// ParseCompact parses the compact signature compact, R and S as 32 byte big
+// endian integers.
+func ParseCompact(compact []byte) (*btcec.Signature, error) {
+	switch {
+	case len(compact) < CompactSigLen:
+		return nil, fmt.Errorf("%w: %d compact bytes", ErrSigTooShort, len(compact))
+	case len(compact) > CompactSigLen:
+		return nil, fmt.Errorf("%w: %d compact bytes", ErrSigTooLong, len(compact))
+	}
+	sig := &btcec.Signature{
+		R: new(big.Int).SetBytes(compact[:32]),
+		S: new(big.Int).SetBytes(compact[32:]),
+	}
+	if err := checkValue("R", sig.R); err != nil {
+		return nil, err
+	}
+	if err := checkValue("S", sig.S); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// derInteger appends the strict DER integer v to b.
+func derInteger(b []byte, v *big.Int) []byte {
+	bytes := v.Bytes()
+	if len(bytes) == 0 || bytes[0]&0x80 != 0 {
+		bytes = append([]byte{0}, bytes...)
+	}
+	return append(append(b, 0x02, byte(len(bytes))), bytes...)
+}
+
+// SerializeDER returns the strict DER encoding of sig, whose S is kept as is:
+// NormalizeS makes it low first.  Unlike btcec.Signature.Serialize, high S
+// values are not normalized, so that signatures round trip.
+func SerializeDER(sig *btcec.Signature) []byte {
+	body := derInteger(derInteger(nil, sig.R), sig.S)
+	return append([]byte{0x30, byte(len(body))}, body...)
+}
+
+// SerializeCompact returns the compact encoding of sig, R and S as 32 byte
+// big endian integers.
+func SerializeCompact(sig *btcec.Signature) []byte {
+	b := make([]byte, CompactSigLen)
+	sig.R.FillBytes(b[:32])
+	sig.S.FillBytes(b[32:])
+	return b
+}
+
+// IsLowS returns whether the S of sig is at most half the order of the curve,
+// as the LOW_S rule of standard transactions requires.
+func IsLowS(sig *btcec.Signature) bool {
+	return sig.S.Cmp(halfOrder) <= 0
+}
+
+// NormalizeS returns sig with a low S: sig itself if its S is low, and
+// otherwise a copy with S replaced by N-S, which verifies as well.
+func NormalizeS(sig *btcec.Signature) *btcec.Signature {
+	if IsLowS(sig) {
+		return sig
+	}
+	return &btcec.Signature{R: new(big.Int).Set(sig.R), S: new(big.Int).Sub(order, sig.S)}
+}
+
+// SplitSigHashByte splits sig, a DER or compact signature of a transaction,
+// into its body and its sighash type byte: the byte following the DER
+// sequence, or the 65th byte of compact and Schnorr signatures.  hashType is
+// the full byte and hasForkID whether it has the SIGHASH_FORKID flag of
+// Bitcoin Cash.  Signatures without the byte fail with ErrNoSigHashType, and
+// bytes whose base type is not ALL, NONE or SINGLE with
+// ErrInvalidSigHashType.  The body is not parsed.
+func SplitSigHashByte(sig []byte) (body []byte, hashType txscript.SigHashType, hasForkID bool, err error) {
+	switch {
+	case len(sig) == CompactSigLen:
+		return nil, 0, false, fmt.Errorf("%w: %d byte compact signature", ErrNoSigHashType, len(sig))
+	case len(sig) == CompactSigLen+1:
+	case len(sig) >= 2 && sig[0] == 0x30 && int(sig[1])+2 == len(sig):
+		return nil, 0, false, fmt.Errorf("%w: DER signature ends with its sequence", ErrNoSigHashType)
+	case len(sig) >= 2 && sig[0] == 0x30 && int(sig[1])+3 == len(sig):
+	case len(sig) == 0:
+		return nil, 0, false, fmt.Errorf("%w: empty signature", ErrSigTooShort)
+	default:
+		return nil, 0, false, fmt.Errorf("%w: %d byte signature is neither DER nor compact", ErrSigBadLength,
+			len(sig))
+	}
+	body, hashType = sig[:len(sig)-1], txscript.SigHashType(sig[len(sig)-1])
+	base := hashType &^ (txscript.SigHashAnyOneCanPay | sigHashForkID)
+	if base < txscript.SigHashAll || base > txscript.SigHashSingle {
+		return nil, 0, false, fmt.Errorf("%w: %#02x", ErrInvalidSigHashType, byte(hashType))
+	}
+	return body, hashType, hashType&sigHashForkID != 0, nil
+}
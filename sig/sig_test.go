@@ -0,0 +1,159 @@
+package sig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// testSig returns a signature by a test key, and the key.
+func testSig(t *testing.T) (*btcec.Signature, *btcec.PublicKey, []byte) {
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{0x11}, 32))
+	hash := sha256.Sum256([]byte("message"))
+	sig, err := key.Sign(hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig, key.PubKey(), hash[:]
+}
+
+func TestParseDERSignature(t *testing.T) {
+	sig, pubKey, hash := testSig(t)
+	der := SerializeDER(sig)
+	if !bytes.Equal(der, sig.Serialize()) {
+		t.Fatalf("got DER %x, want %x", der, sig.Serialize())
+	}
+	for _, strict := range []bool{true, false} {
+		parsed, err := ParseDERSignature(der, strict)
+		if err != nil || !parsed.Verify(hash, pubKey) {
+			t.Errorf("strict %v: got %v", strict, err)
+		}
+	}
+
+	// R and S of one byte, 0x01 and 0x7f.
+	small := []byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x7f}
+	tests := []struct {
+		name string
+		der  []byte
+		err  error
+		lax  error
+	}{
+		{"too short", small[:7], ErrSigTooShort, ErrSigBadLength},
+		{"too long", append(bytes.Repeat([]byte{0}, 70), small...), ErrSigTooLong, ErrSigNoSequence},
+		{"no sequence", append([]byte{0x31}, small[1:]...), ErrSigNoSequence, ErrSigNoSequence},
+		{"trailing garbage", append(append([]byte(nil), small...), 0x00), ErrSigTrailingGarbage, nil},
+		{"sequence too long", []byte{0x30, 0x07, 0x02, 0x01, 0x01, 0x02, 0x01, 0x7f}, ErrSigBadLength, nil},
+		{"no integer", []byte{0x30, 0x06, 0x03, 0x01, 0x01, 0x02, 0x01, 0x7f}, ErrSigNoInteger, ErrSigNoInteger},
+		{"empty R", []byte{0x30, 0x06, 0x02, 0x00, 0x02, 0x02, 0x01, 0x7f}, ErrSigEmptyInteger, ErrSigZero},
+		{"negative S", []byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x81}, ErrSigNegative, nil},
+		{"padded R", []byte{0x30, 0x07, 0x02, 0x02, 0x00, 0x01, 0x02, 0x01, 0x7f}, ErrSigExcessPadding, nil},
+		{"zero S", []byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x00}, ErrSigZero, ErrSigZero},
+		{"long form length", []byte{0x30, 0x81, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x7f}, ErrSigBadLength, nil},
+		{"S past the data", []byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x05, 0x7f}, ErrSigBadLength,
+			ErrSigBadLength},
+	}
+	for _, test := range tests {
+		if _, err := ParseDERSignature(test.der, true); !errors.Is(err, test.err) {
+			t.Errorf("%s: strict got %v, want %v", test.name, err, test.err)
+		}
+		if _, err := ParseDERSignature(test.der, false); !errors.Is(err, test.lax) {
+			t.Errorf("%s: lax got %v, want %v", test.name, err, test.lax)
+		}
+		// The encoding of zero values is valid.
+		want := test.err
+		if want == ErrSigZero {
+			want = nil
+		}
+		if err := CheckDEREncoding(test.der); !errors.Is(err, want) || (err != nil && want == nil) {
+			t.Errorf("%s: encoding got %v, want %v", test.name, err, want)
+		}
+	}
+
+	// R equal to the order of the curve.
+	n := append([]byte{0}, order.Bytes()...)
+	overflow := append(append([]byte{0x30, byte(2 + len(n) + 3), 0x02, byte(len(n))}, n...), 0x02, 0x01, 0x01)
+	for _, strict := range []bool{true, false} {
+		if _, err := ParseDERSignature(overflow, strict); !errors.Is(err, ErrSigOverflow) {
+			t.Errorf("strict %v: got %v, want ErrSigOverflow", strict, err)
+		}
+	}
+	if err := CheckDEREncoding(overflow); err != nil {
+		t.Errorf("overflowing R: got encoding error %v", err)
+	}
+
+	// Lax DER reads negative and padded integers as unsigned.
+	parsed, err := ParseDERSignature([]byte{0x30, 0x00, 0x02, 0x03, 0x00, 0x00, 0x81, 0x02, 0x01, 0x81, 0xff}, false)
+	if err != nil || parsed.R.Int64() != 0x81 || parsed.S.Int64() != 0x81 {
+		t.Errorf("got %v, %v", parsed, err)
+	}
+	if got := SerializeDER(parsed); !bytes.Equal(got, []byte{0x30, 0x08, 0x02, 0x02, 0x00, 0x81, 0x02, 0x02, 0x00, 0x81}) {
+		t.Errorf("got DER %x", got)
+	}
+}
+
+func TestCompactAndLowS(t *testing.T) {
+	sig, pubKey, hash := testSig(t)
+	compact := SerializeCompact(sig)
+	parsed, err := ParseCompact(compact)
+	if err != nil || parsed.R.Cmp(sig.R) != 0 || parsed.S.Cmp(sig.S) != 0 {
+		t.Fatalf("got %v, %v", parsed, err)
+	}
+	for _, b := range [][]byte{compact[:63], append(compact, 0), make([]byte, 64)} {
+		if _, err := ParseCompact(b); err == nil {
+			t.Errorf("compact %x accepted", b)
+		}
+	}
+
+	if !IsLowS(sig) || NormalizeS(sig) != sig {
+		t.Error("signature of btcec has a high S")
+	}
+	high := &btcec.Signature{R: sig.R, S: new(big.Int).Sub(order, sig.S)}
+	if IsLowS(high) || !high.Verify(hash, pubKey) {
+		t.Fatal("high S signature")
+	}
+	normalized := NormalizeS(high)
+	if !IsLowS(normalized) || normalized.S.Cmp(sig.S) != 0 || !IsLowS(NormalizeS(normalized)) || IsLowS(high) {
+		t.Errorf("got normalized S %v", normalized.S)
+	}
+	if !HasLowS(SerializeDER(sig)) || HasLowS(SerializeDER(high)) || HasLowS(compact) {
+		t.Error("HasLowS differs from IsLowS")
+	}
+	// High S values survive a round trip.
+	if parsed, err := ParseDERSignature(SerializeDER(high), true); err != nil || parsed.S.Cmp(high.S) != 0 {
+		t.Errorf("got %v, %v", parsed, err)
+	}
+}
+
+func TestSplitSigHashByte(t *testing.T) {
+	sig, _, _ := testSig(t)
+	der := SerializeDER(sig)
+	compact := SerializeCompact(sig)
+	tests := []struct {
+		sig       []byte
+		body      []byte
+		hashType  txscript.SigHashType
+		hasForkID bool
+		err       error
+	}{
+		{append(append([]byte(nil), der...), 0x41), der, 0x41, true, nil},
+		{append(append([]byte(nil), der...), 0x01), der, txscript.SigHashAll, false, nil},
+		{append(append([]byte(nil), compact...), 0xc3), compact, 0xc3, true, nil},
+		{der, nil, 0, false, ErrNoSigHashType},
+		{compact, nil, 0, false, ErrNoSigHashType},
+		{append(append([]byte(nil), der...), 0x44), nil, 0, false, ErrInvalidSigHashType},
+		{append(append([]byte(nil), der...), 0x41, 0x41), nil, 0, false, ErrSigBadLength},
+		{nil, nil, 0, false, ErrSigTooShort},
+	}
+	for i, test := range tests {
+		body, hashType, hasForkID, err := SplitSigHashByte(test.sig)
+		if !errors.Is(err, test.err) || !bytes.Equal(body, test.body) || hashType != test.hashType ||
+			hasForkID != test.hasForkID {
+			t.Errorf("test %d: got %x, %#02x, %v, %v", i, body, byte(hashType), hasForkID, err)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var (
+	// ErrSigHashFields describes an error where the fields of a signature
+	// digest hold a midstate excluded by their sighash type.
+	ErrSigHashFields = errors.New("sighash fields inconsistent with their type")
+
+	// ErrSigHashPreimage describes an error where a sighash preimage is
+	// truncated, has trailing bytes or holds an invalid field.
+	ErrSigHashPreimage = errors.New("malformed sighash preimage")
+)
+
+// preimageHeadSize is the size of nVersion, hashPrevouts, hashSequence and the
+// outpoint, the fields of sighash preimages before the script code, and
+// preimageTailSize that of amount, nSequence, hashOutputs, nLocktime and
+// sighashType, the fields after it.
+const (
+	preimageHeadSize = 4 + 3*chainhash.HashSize + 4
+	preimageTailSize = 8 + 4 + chainhash.HashSize + 4 + 4
+)
+
+// Sighash types of Bitcoin Cash signatures, combining a base type with
+// SigHashForkID and SIGHASH_ANYONECANPAY.
+const (
+	SigHashAllForkID    = txscript.SigHashAll | SigHashForkID
+	SigHashNoneForkID   = txscript.SigHashNone | SigHashForkID
+	SigHashSingleForkID = txscript.SigHashSingle | SigHashForkID
+
+	SigHashAllForkIDAnyOneCanPay    = SigHashAllForkID | txscript.SigHashAnyOneCanPay
+	SigHashNoneForkIDAnyOneCanPay   = SigHashNoneForkID | txscript.SigHashAnyOneCanPay
+	SigHashSingleForkIDAnyOneCanPay = SigHashSingleForkID | txscript.SigHashAnyOneCanPay
+)
+
+// sigHashBaseNames are the names of the base sighash types.
+var sigHashBaseNames = map[txscript.SigHashType]string{
+	txscript.SigHashAll:    "ALL",
+	txscript.SigHashNone:   "NONE",
+	txscript.SigHashSingle: "SINGLE",
+}
+
+// SigHashTypeString returns the name nodes give to hashType, its base type
+// followed by its flags, such as "ALL|FORKID|ANYONECANPAY".  Unsupported
+// types are formatted as SigHashType(0x..).
+func SigHashTypeString(hashType txscript.SigHashType) string {
+	if checkSigHashType(hashType) != nil {
+		return fmt.Sprintf("SigHashType(%#x)", uint32(hashType))
+	}
+	name := sigHashBaseNames[hashType&sigHashMask]
+	if hashType&SigHashForkID != 0 {
+		name += "|FORKID"
+	}
+	if hashType&txscript.SigHashAnyOneCanPay != 0 {
+		name += "|ANYONECANPAY"
+	}
+	return name
+}
+
+// ParseSigHashType parses the name of a sighash type, as accepted by the
+// signrawtransactionwithkey RPC of nodes and returned by SigHashTypeString: a
+// base type, ALL, NONE or SINGLE, followed by the FORKID and ANYONECANPAY
+// flags, separated by "|".  Names are not case sensitive, and flags may come
+// in any order.  Other names fail with ErrUnsupportedSigHashType.
+func ParseSigHashType(s string) (txscript.SigHashType, error) {
+	parts := strings.Split(strings.ToUpper(strings.TrimSpace(s)), "|")
+	var hashType txscript.SigHashType
+	for base, name := range sigHashBaseNames {
+		if strings.TrimSpace(parts[0]) == name {
+			hashType = base
+		}
+	}
+	if hashType == 0 {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedSigHashType, s)
+	}
+	for _, part := range parts[1:] {
+		var flag txscript.SigHashType
+		switch strings.TrimSpace(part) {
+		case "FORKID":
+			flag = SigHashForkID
+		case "ANYONECANPAY":
+			flag = txscript.SigHashAnyOneCanPay
+		default:
+			return 0, fmt.Errorf("%w: %q", ErrUnsupportedSigHashType, s)
+		}
+		if hashType&flag != 0 {
+			return 0, fmt.Errorf("%w: %q repeats a flag", ErrUnsupportedSigHashType, s)
+		}
+		hashType |= flag
+	}
+	return hashType, nil
+}
+
+// SigHashFields are the fields of the preimage of the replay protected digest
+// signed for an input, to compute digests of transactions that are not built,
+// such as those constrained by covenants.  The midstates are computed from the
+// parts of the transaction by HashPrevouts, HashSequence and HashOutputs, and
+// are zero when HashType excludes them.
+type SigHashFields struct {
+	Version      int32
+	HashPrevouts chainhash.Hash
+	HashSequence chainhash.Hash
+	OutPoint     wire.OutPoint
+
+	// TokenPrefix is the token prefix of the spent output, empty for
+	// outputs without tokens.
+	TokenPrefix []byte
+
+	// ScriptCode is the script code, without its length, and Amount the
+	// value of the spent output.
+	ScriptCode []byte
+	Amount     int64
+
+	Sequence    uint32
+	HashOutputs chainhash.Hash
+	LockTime    uint32
+
+	// HashType is the sighash type, SigHashForkID being always set, and
+	// ForkID the fork value in its high bits, 0 on Bitcoin Cash.
+	HashType txscript.SigHashType
+	ForkID   uint32
+}
+
+// ComposeSigHash returns the digest of fields, as signed by the signatures of
+// their input.  Midstates that the sighash type excludes must be zero, or
+// ComposeSigHash fails with ErrSigHashFields: hashPrevouts for ANYONECANPAY,
+// hashSequence for ANYONECANPAY, SINGLE and NONE, and hashOutputs for NONE.
+// The digests returned by CalcSignatureHash are composed the same way.
+func ComposeSigHash(fields SigHashFields) ([]byte, error) {
+	var zero chainhash.Hash
+	anyoneCanPay := fields.HashType&txscript.SigHashAnyOneCanPay != 0
+	base := fields.HashType & sigHashMask
+	switch {
+	case anyoneCanPay && fields.HashPrevouts != zero:
+		return nil, fmt.Errorf("%w: hashPrevouts for %s", ErrSigHashFields,
+			SigHashTypeString(fields.HashType))
+	case (anyoneCanPay || base == txscript.SigHashSingle || base == txscript.SigHashNone) &&
+		fields.HashSequence != zero:
+		return nil, fmt.Errorf("%w: hashSequence for %s", ErrSigHashFields,
+			SigHashTypeString(fields.HashType))
+	case base == txscript.SigHashNone && fields.HashOutputs != zero:
+		return nil, fmt.Errorf("%w: hashOutputs for %s", ErrSigHashFields,
+			SigHashTypeString(fields.HashType))
+	}
+	return chainhash.DoubleHashB(fields.preimage()), nil
+}
+
+// HashPrevouts returns the hashPrevouts midstate of a transaction spending
+// outPoints, in order.
+func HashPrevouts(outPoints []wire.OutPoint) chainhash.Hash {
+	var b bytes.Buffer
+	for _, outPoint := range outPoints {
+		b.Write(outPoint.Hash[:])
+		binary.Write(&b, binary.LittleEndian, outPoint.Index)
+	}
+	return chainhash.DoubleHashH(b.Bytes())
+}
+
+// HashSequence returns the hashSequence midstate of a transaction whose inputs
+// have sequences, in order.
+func HashSequence(sequences []uint32) chainhash.Hash {
+	var b bytes.Buffer
+	for _, sequence := range sequences {
+		binary.Write(&b, binary.LittleEndian, sequence)
+	}
+	return chainhash.DoubleHashH(b.Bytes())
+}
+
+// HashOutputs returns the hashOutputs midstate of a transaction paying txOuts,
+// in order, or of the output of a SINGLE signature when txOuts is that output
+// alone.
+func HashOutputs(txOuts []*wire.TxOut) chainhash.Hash {
+	var b bytes.Buffer
+	for _, txOut := range txOuts {
+		wire.WriteTxOut(&b, 0, 0, txOut)
+	}
+	return chainhash.DoubleHashH(b.Bytes())
+}
+
+// ParseSigHashPreimage parses a preimage of the digest of ComposeSigHash, such
+// as those covenants have spenders push, back into its fields.  The fields
+// must take the whole preimage, and the sighash type must have SigHashForkID
+// set.  A byte 0xef after the outpoint is either the token prefix of the spent
+// output or the length of a 239 bytes script code: the token prefix is chosen
+// when it parses and the length of the preimage matches.
+func ParseSigHashPreimage(preimage []byte) (*SigHashFields, error) {
+	if len(preimage) < preimageHeadSize+1+preimageTailSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrSigHashPreimage, len(preimage))
+	}
+	f := &SigHashFields{Version: int32(binary.LittleEndian.Uint32(preimage))}
+	copy(f.HashPrevouts[:], preimage[4:])
+	copy(f.HashSequence[:], preimage[4+chainhash.HashSize:])
+	copy(f.OutPoint.Hash[:], preimage[4+2*chainhash.HashSize:])
+	f.OutPoint.Index = binary.LittleEndian.Uint32(preimage[4+3*chainhash.HashSize:])
+
+	rest := preimage[preimageHeadSize:]
+	scriptCode, tail, err := parsePreimageScriptCode(rest)
+	if rest[0] == tokenPrefix {
+		if _, n, tokenErr := ParseTokenData(rest); tokenErr == nil {
+			if code, t, codeErr := parsePreimageScriptCode(rest[n:]); codeErr == nil {
+				f.TokenPrefix = append([]byte(nil), rest[:n]...)
+				scriptCode, tail, err = code, t, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.ScriptCode = append([]byte{}, scriptCode...)
+
+	f.Amount = int64(binary.LittleEndian.Uint64(tail))
+	f.Sequence = binary.LittleEndian.Uint32(tail[8:])
+	copy(f.HashOutputs[:], tail[12:])
+	f.LockTime = binary.LittleEndian.Uint32(tail[12+chainhash.HashSize:])
+	hashType := binary.LittleEndian.Uint32(tail[16+chainhash.HashSize:])
+	f.HashType, f.ForkID = txscript.SigHashType(hashType&0xff), hashType>>8
+	if f.HashType&SigHashForkID == 0 {
+		return nil, fmt.Errorf("%w: sighash type %#x without FORKID", ErrSigHashPreimage, hashType)
+	}
+	return f, nil
+}
+
+// parsePreimageScriptCode splits b, the end of a preimage from its script
+// code, in the script code, without its length, and the fields that follow,
+// which must have their exact size.
+func parsePreimageScriptCode(b []byte) (scriptCode, tail []byte, err error) {
+	r := bytes.NewReader(b)
+	n, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: script code length: %v", ErrSigHashPreimage, err)
+	}
+	start := len(b) - r.Len()
+	if n > uint64(r.Len()) || uint64(r.Len())-n != preimageTailSize {
+		return nil, nil, fmt.Errorf("%w: %d bytes script code with %d bytes left", ErrSigHashPreimage, n,
+			r.Len())
+	}
+	return b[start : start+int(n)], b[start+int(n):], nil
+}
@@ -0,0 +1,195 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestSigHashTypeString(t *testing.T) {
+	tests := []struct {
+		hashType txscript.SigHashType
+		name     string
+	}{
+		{txscript.SigHashAll, "ALL"},
+		{txscript.SigHashNone, "NONE"},
+		{txscript.SigHashSingle, "SINGLE"},
+		{txscript.SigHashAll | txscript.SigHashAnyOneCanPay, "ALL|ANYONECANPAY"},
+		{SigHashAllForkID, "ALL|FORKID"},
+		{SigHashNoneForkID, "NONE|FORKID"},
+		{SigHashSingleForkID, "SINGLE|FORKID"},
+		{SigHashAllForkIDAnyOneCanPay, "ALL|FORKID|ANYONECANPAY"},
+		{SigHashNoneForkIDAnyOneCanPay, "NONE|FORKID|ANYONECANPAY"},
+		{SigHashSingleForkIDAnyOneCanPay, "SINGLE|FORKID|ANYONECANPAY"},
+	}
+	for _, test := range tests {
+		if got := SigHashTypeString(test.hashType); got != test.name {
+			t.Errorf("%#x: got %q, want %q", uint32(test.hashType), got, test.name)
+		}
+	}
+	if SigHashAllForkID != 0x41 || SigHashSingleForkIDAnyOneCanPay != 0xc3 {
+		t.Error("wrong sighash type values")
+	}
+
+	// Every supported type round trips.
+	for hashType := txscript.SigHashType(0); hashType < 0x100; hashType++ {
+		name := SigHashTypeString(hashType)
+		parsed, err := ParseSigHashType(name)
+		if supported := checkSigHashType(hashType) == nil; supported != (err == nil) {
+			t.Errorf("%#x: parsing %q: %v", uint32(hashType), name, err)
+		} else if supported && parsed != hashType {
+			t.Errorf("%#x: %q parsed as %#x", uint32(hashType), name, uint32(parsed))
+		}
+	}
+}
+
+func TestParseSigHashType(t *testing.T) {
+	for s, want := range map[string]txscript.SigHashType{
+		"all|forkid":               SigHashAllForkID,
+		" SINGLE | ANYONECANPAY ":  txscript.SigHashSingle | txscript.SigHashAnyOneCanPay,
+		"NONE|ANYONECANPAY|FORKID": SigHashNoneForkIDAnyOneCanPay,
+	} {
+		if got, err := ParseSigHashType(s); err != nil || got != want {
+			t.Errorf("%q: got %#x, %v, want %#x", s, uint32(got), err, uint32(want))
+		}
+	}
+	for _, s := range []string{"", "FORKID", "ANYONECANPAY|ALL", "ALL|UTXOS", "ALL|FORKID|FORKID", "ALL|", "65",
+		"DEFAULT"} {
+		if _, err := ParseSigHashType(s); !errors.Is(err, ErrUnsupportedSigHashType) {
+			t.Errorf("%q: got %v, want ErrUnsupportedSigHashType", s, err)
+		}
+	}
+}
+
+func TestComposeSigHash(t *testing.T) {
+	tx := wire.NewMsgTx(2)
+	for i := 0; i < 3; i++ {
+		tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(i)}, Index: uint32(i)},
+			Sequence: uint32(10 + i)})
+		tx.AddTxOut(wire.NewTxOut(int64(1000*(i+1)), []byte{txscript.OP_TRUE, byte(i)}))
+	}
+	tx.LockTime = 800000
+
+	var outPoints []wire.OutPoint
+	var sequences []uint32
+	for _, txIn := range tx.TxIn {
+		outPoints = append(outPoints, txIn.PreviousOutPoint)
+		sequences = append(sequences, txIn.Sequence)
+	}
+	sigHashes := txscript.NewTxSigHashes(tx)
+	if HashPrevouts(outPoints) != sigHashes.HashPrevOuts || HashSequence(sequences) != sigHashes.HashSequence ||
+		HashOutputs(tx.TxOut) != sigHashes.HashOutputs {
+		t.Fatal("midstates differ from those of txscript")
+	}
+
+	token := &TokenData{Category: chainhash.Hash{0xaa}, Amount: 5}
+	script := []byte{txscript.OP_TRUE}
+	for _, hashType := range []txscript.SigHashType{SigHashAllForkID, SigHashNoneForkID, SigHashSingleForkID,
+		SigHashAllForkIDAnyOneCanPay, SigHashNoneForkIDAnyOneCanPay, SigHashSingleForkIDAnyOneCanPay} {
+
+		fields := SigHashFields{
+			Version:     tx.Version,
+			OutPoint:    outPoints[1],
+			TokenPrefix: token.Bytes(),
+			ScriptCode:  script,
+			Amount:      2000,
+			Sequence:    sequences[1],
+			LockTime:    tx.LockTime,
+			HashType:    hashType,
+			ForkID:      7,
+		}
+		if hashType&txscript.SigHashAnyOneCanPay == 0 {
+			fields.HashPrevouts = HashPrevouts(outPoints)
+		}
+		switch hashType & sigHashMask {
+		case txscript.SigHashAll:
+			if hashType&txscript.SigHashAnyOneCanPay == 0 {
+				fields.HashSequence = HashSequence(sequences)
+			}
+			fields.HashOutputs = HashOutputs(tx.TxOut)
+		case txscript.SigHashSingle:
+			fields.HashOutputs = HashOutputs(tx.TxOut[1:2])
+		}
+		got, err := ComposeSigHash(fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := CalcSignatureHash(script, hashType, tx, 1, 2000, WithTokenPrevout(token), WithForkID(7))
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %x, want %x", SigHashTypeString(hashType), got, want)
+		}
+	}
+
+	bad := []SigHashFields{
+		{HashType: SigHashAllForkIDAnyOneCanPay, HashPrevouts: chainhash.Hash{1}},
+		{HashType: SigHashSingleForkID, HashSequence: chainhash.Hash{1}},
+		{HashType: SigHashNoneForkID, HashOutputs: chainhash.Hash{1}},
+	}
+	for _, fields := range bad {
+		if _, err := ComposeSigHash(fields); !errors.Is(err, ErrSigHashFields) {
+			t.Errorf("%s: got %v, want ErrSigHashFields", SigHashTypeString(fields.HashType), err)
+		}
+	}
+}
+
+func TestParseSigHashPreimage(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	hashTypes := []txscript.SigHashType{SigHashAllForkID, SigHashNoneForkID, SigHashSingleForkID,
+		SigHashAllForkIDAnyOneCanPay, SigHashNoneForkIDAnyOneCanPay, SigHashSingleForkIDAnyOneCanPay}
+	for i := 0; i < 200; i++ {
+		tx := wire.NewMsgTx(rng.Int31())
+		for j := rng.Intn(4); j >= 0; j-- {
+			var hash chainhash.Hash
+			rng.Read(hash[:])
+			tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: hash, Index: rng.Uint32()},
+				Sequence: rng.Uint32()})
+		}
+		for j := rng.Intn(4); j > 0; j-- {
+			tx.AddTxOut(wire.NewTxOut(rng.Int63n(1e10), make([]byte, rng.Intn(40))))
+		}
+		tx.LockTime = rng.Uint32()
+		// Script codes of 239 bytes have a length of 0xef, the token
+		// prefix byte, and longer ones a three bytes length.
+		script := make([]byte, []int{0, 25, 239, 300}[rng.Intn(4)])
+		rng.Read(script)
+		var tokenPrefix []byte
+		if rng.Intn(2) == 0 {
+			tokenPrefix = (&TokenData{Category: chainhash.Hash{byte(i)}, Amount: uint64(rng.Int63n(1e6) + 1)}).Bytes()
+		}
+		idx := rng.Intn(len(tx.TxIn))
+		want := txSigHashFields(script, txscript.NewTxSigHashes(tx), hashTypes[rng.Intn(len(hashTypes))], tx, idx,
+			rng.Int63n(1e10), uint32(rng.Intn(2)), tokenPrefix)
+
+		preimage := want.preimage()
+		got, err := ParseSigHashPreimage(preimage)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%d: got %+v, want %+v", i, got, want)
+		}
+		digest, err := ComposeSigHash(*got)
+		if err != nil || !bytes.Equal(digest, chainhash.DoubleHashB(preimage)) {
+			t.Fatalf("%d: digest of the parsed fields differs: %v", i, err)
+		}
+
+		if _, err := ParseSigHashPreimage(preimage[:len(preimage)-1]); !errors.Is(err, ErrSigHashPreimage) {
+			t.Fatalf("%d: truncated preimage: got %v, want ErrSigHashPreimage", i, err)
+		}
+		if _, err := ParseSigHashPreimage(append(preimage, 0)); !errors.Is(err, ErrSigHashPreimage) {
+			t.Fatalf("%d: trailing byte: got %v, want ErrSigHashPreimage", i, err)
+		}
+	}
+
+	preimage := (&SigHashFields{HashType: txscript.SigHashAll}).preimage()
+	preimage[len(preimage)-4] = byte(txscript.SigHashAll)
+	if _, err := ParseSigHashPreimage(preimage); !errors.Is(err, ErrSigHashPreimage) {
+		t.Errorf("sighash type without FORKID: got %v, want ErrSigHashPreimage", err)
+	}
+}
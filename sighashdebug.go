@@ -0,0 +1,201 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// sigHashFieldNames are the names of the fields of preimages, in order.
+var sigHashFieldNames = []string{"nVersion", "hashPrevouts", "hashSequence", "outpoint", "tokenPrefix",
+	"scriptCode", "amount", "nSequence", "hashOutputs", "nLocktime", "sighashType"}
+
+// SigHashField is a component of the preimage of a signature digest.
+type SigHashField struct {
+	// Name is the name of the field in the replay protected digest
+	// algorithm: nVersion, hashPrevouts, hashSequence, outpoint,
+	// tokenPrefix, scriptCode, amount, nSequence, hashOutputs, nLocktime or
+	// sighashType.
+	Name  string
+	Bytes []byte
+}
+
+// SigHashBreakdown is the preimage of a signature digest, field by field.
+type SigHashBreakdown struct {
+	// Fields are the fields of the preimage, in order.  The tokenPrefix
+	// field is only present for inputs spending token outputs.
+	Fields []SigHashField
+
+	// Digest is the double SHA-256 of the preimage, the digest signed.
+	Digest []byte
+}
+
+// txSigHashFields returns the fields of the digest of calcSignatureHash, with
+// the midstates of sigHashes, zero for the hashes hashType excludes.
+func txSigHashFields(subScript []byte, sigHashes *txscript.TxSigHashes, hashType txscript.SigHashType,
+	tx *wire.MsgTx, idx int, amt int64, forkID uint32, tokenPrefix []byte) *SigHashFields {
+
+	txIn := tx.TxIn[idx]
+	f := &SigHashFields{
+		Version:     tx.Version,
+		OutPoint:    txIn.PreviousOutPoint,
+		TokenPrefix: tokenPrefix,
+		ScriptCode:  subScript,
+		Amount:      amt,
+		Sequence:    txIn.Sequence,
+		LockTime:    tx.LockTime,
+		HashType:    hashType,
+		ForkID:      forkID,
+	}
+
+	// Anyone can pay signatures commit to their input alone, and single
+	// and none ones allow other inputs to change their sequence.
+	base := hashType & sigHashMask
+	if hashType&txscript.SigHashAnyOneCanPay == 0 {
+		f.HashPrevouts = sigHashes.HashPrevOuts
+		if base != txscript.SigHashSingle && base != txscript.SigHashNone {
+			f.HashSequence = sigHashes.HashSequence
+		}
+	}
+
+	// Single signatures commit to the output of the same index only, if
+	// any, and none ones to no output.
+	switch {
+	case base != txscript.SigHashSingle && base != txscript.SigHashNone:
+		f.HashOutputs = sigHashes.HashOutputs
+	case base == txscript.SigHashSingle && idx < len(tx.TxOut):
+		f.HashOutputs = HashOutputs(tx.TxOut[idx : idx+1])
+	}
+	return f
+}
+
+// fields returns the fields of the preimage of f, in order.
+func (f *SigHashFields) fields() []SigHashField {
+	uint32Field := func(name string, v uint32) SigHashField {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, v)
+		return SigHashField{name, b}
+	}
+	hashField := func(name string, hash *chainhash.Hash) SigHashField {
+		return SigHashField{name, append([]byte(nil), hash[:]...)}
+	}
+
+	fields := []SigHashField{
+		uint32Field("nVersion", uint32(f.Version)),
+		hashField("hashPrevouts", &f.HashPrevouts),
+		hashField("hashSequence", &f.HashSequence),
+	}
+	outPoint := make([]byte, chainhash.HashSize+4)
+	copy(outPoint, f.OutPoint.Hash[:])
+	binary.LittleEndian.PutUint32(outPoint[chainhash.HashSize:], f.OutPoint.Index)
+	fields = append(fields, SigHashField{"outpoint", outPoint})
+
+	// CashTokens commit to the tokens of the spent output before its
+	// script code.
+	if len(f.TokenPrefix) != 0 {
+		fields = append(fields, SigHashField{"tokenPrefix", append([]byte(nil), f.TokenPrefix...)})
+	}
+
+	// The script code is serialized with a var int length prefix.
+	var scriptCode bytes.Buffer
+	wire.WriteVarBytes(&scriptCode, 0, f.ScriptCode)
+	fields = append(fields, SigHashField{"scriptCode", scriptCode.Bytes()})
+
+	amount := make([]byte, 8)
+	binary.LittleEndian.PutUint64(amount, uint64(f.Amount))
+	return append(fields, SigHashField{"amount", amount},
+		uint32Field("nSequence", f.Sequence),
+		hashField("hashOutputs", &f.HashOutputs),
+		uint32Field("nLocktime", f.LockTime),
+		uint32Field("sighashType", uint32(f.HashType|SigHashForkID)|f.ForkID<<8))
+}
+
+// preimage returns the serialized preimage of f.
+func (f *SigHashFields) preimage() []byte {
+	var preimage []byte
+	for _, field := range f.fields() {
+		preimage = append(preimage, field.Bytes...)
+	}
+	return preimage
+}
+
+// ExplainSigHash returns the preimage of the digest CalcSignatureHash returns
+// for input idx of tx, field by field, to find which field a counterparty
+// computes differently when its signatures do not verify.  sigHashes may be
+// nil, and WithForkID and WithTokenPrevout change the preimage as they do for
+// SignInput.
+func ExplainSigHash(subScript []byte, sigHashes *txscript.TxSigHashes, hashType txscript.SigHashType,
+	tx *wire.MsgTx, idx int, amt int64, opts ...SignOption) (*SigHashBreakdown, error) {
+
+	o := newSignOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("input index %d out of range", idx)
+	}
+	if sigHashes == nil {
+		sigHashes = txscript.NewTxSigHashes(tx)
+	}
+	var tokenPrefix []byte
+	if o.token != nil {
+		tokenPrefix = o.token.Bytes()
+	}
+	b := &SigHashBreakdown{Fields: txSigHashFields(subScript, sigHashes, hashType, tx, idx, amt, o.forkID,
+		tokenPrefix).fields()}
+	b.Digest = chainhash.DoubleHashB(b.Preimage())
+	return b, nil
+}
+
+// Preimage returns the serialized preimage, the concatenation of the fields.
+func (b *SigHashBreakdown) Preimage() []byte {
+	var preimage []byte
+	for _, field := range b.Fields {
+		preimage = append(preimage, field.Bytes...)
+	}
+	return preimage
+}
+
+// Field returns the bytes of the field named name, and whether it is present.
+func (b *SigHashBreakdown) Field(name string) ([]byte, bool) {
+	for _, field := range b.Fields {
+		if field.Name == name {
+			return field.Bytes, true
+		}
+	}
+	return nil, false
+}
+
+// String returns the fields and the digest in hex, one per line, for bug
+// reports and support tooling.
+func (b *SigHashBreakdown) String() string {
+	var s strings.Builder
+	for _, field := range b.Fields {
+		fmt.Fprintf(&s, "%-12s %x\n", field.Name, field.Bytes)
+	}
+	fmt.Fprintf(&s, "%-12s %x\n", "digest", b.Digest)
+	return s.String()
+}
+
+// DiffSigHash returns the names of the fields that differ between a and b, in
+// preimage order, including the fields present in only one of them, such as
+// tokenPrefix.  Breakdowns of the same digest have no differences.
+func DiffSigHash(a, b *SigHashBreakdown) []string {
+	if bytes.Equal(a.Digest, b.Digest) {
+		return nil
+	}
+	var diff []string
+	for _, name := range sigHashFieldNames {
+		aBytes, aOK := a.Field(name)
+		bBytes, bOK := b.Field(name)
+		if aOK != bOK || !bytes.Equal(aBytes, bBytes) {
+			diff = append(diff, name)
+		}
+	}
+	return diff
+}
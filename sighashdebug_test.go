@@ -0,0 +1,60 @@
+package bchutil
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestExplainSigHash(t *testing.T) {
+	tx := engineTestTx(nil)
+	tx.LockTime = 7
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	token := &TokenData{Amount: 10}
+
+	for _, hashType := range []txscript.SigHashType{SigHashAllForkID, SigHashNoneForkIDAnyOneCanPay,
+		SigHashSingleForkID} {
+		for _, opts := range [][]SignOption{nil, {WithTokenPrevout(token)}, {WithForkID(0xff)}} {
+			b, err := ExplainSigHash(pkScript, nil, hashType, tx, 0, 1000, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := CalcSignatureHash(pkScript, hashType, tx, 0, 1000, opts...)
+			if !bytes.Equal(b.Digest, want) {
+				t.Errorf("%s: digest %x, want %x", SigHashTypeString(hashType), b.Digest, want)
+			}
+		}
+	}
+
+	b, _ := ExplainSigHash(pkScript, nil, SigHashAllForkID, tx, 0, 1000)
+	var names []string
+	for _, field := range b.Fields {
+		names = append(names, field.Name)
+	}
+	want := []string{"nVersion", "hashPrevouts", "hashSequence", "outpoint", "scriptCode", "amount", "nSequence",
+		"hashOutputs", "nLocktime", "sighashType"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got fields %v, want %v", names, want)
+	}
+	if locktime, _ := b.Field("nLocktime"); !bytes.Equal(locktime, []byte{7, 0, 0, 0}) {
+		t.Errorf("got nLocktime %x", locktime)
+	}
+	if s := b.String(); !strings.Contains(s, "sighashType  41000000\n") || !strings.HasPrefix(s, "nVersion     02000000\n") {
+		t.Errorf("got\n%s", s)
+	}
+
+	// A counterparty signing another amount with tokens.
+	other, _ := ExplainSigHash(pkScript, nil, SigHashAllForkID, tx, 0, 1001, WithTokenPrevout(token))
+	if diff := DiffSigHash(b, other); !reflect.DeepEqual(diff, []string{"tokenPrefix", "amount"}) {
+		t.Errorf("got diff %v", diff)
+	}
+	if diff := DiffSigHash(b, b); diff != nil {
+		t.Errorf("got diff %v of the same breakdown", diff)
+	}
+	if _, err := ExplainSigHash(pkScript, nil, SigHashAllForkID, tx, 1, 1000); err == nil {
+		t.Error("explained an input out of range")
+	}
+}
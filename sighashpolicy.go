@@ -0,0 +1,73 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// ErrDangerousSigHash describes an error where a signature would use a sighash
+// type letting others change the transaction, without AllowDangerousSigHash.
+var ErrDangerousSigHash = errors.New("dangerous sighash type")
+
+// sigHashDanger returns why signatures of hashType let others change the
+// transaction, or "" if they don't: SIGHASH_NONE ones commit to no output,
+// and SIGHASH_SINGLE ones without SIGHASH_ANYONECANPAY to one output only.
+// With strict, SIGHASH_ANYONECANPAY ones, committing to no other input, are
+// dangerous too.
+func sigHashDanger(hashType txscript.SigHashType, strict bool) string {
+	switch hashType & sigHashMask {
+	case txscript.SigHashNone:
+		return "SIGHASH_NONE signatures commit to no output, so that anyone can redirect the funds"
+	case txscript.SigHashSingle:
+		if hashType&txscript.SigHashAnyOneCanPay == 0 {
+			return "SIGHASH_SINGLE signatures commit to the output of the same index only, " +
+				"so that anyone can redirect the rest of the funds"
+		}
+	}
+	if strict && hashType&txscript.SigHashAnyOneCanPay != 0 {
+		return "SIGHASH_ANYONECANPAY signatures commit to no other input, so that they stay valid in " +
+			"transactions spending other outputs"
+	}
+	return ""
+}
+
+// AllowDangerousSigHash makes the signing functions produce the signatures of
+// hashTypes they refuse by default, SIGHASH_NONE and SIGHASH_SINGLE without
+// SIGHASH_ANYONECANPAY, and those of SIGHASH_ANYONECANPAY refused by
+// WithStrictSigHash.  Types are compared with SigHashForkID set.  The
+// SigningEvent of the signatures then has DangerousSigHash set.
+func AllowDangerousSigHash(hashTypes ...txscript.SigHashType) SignOption {
+	return func(o *signOptions) {
+		if o.allowedSigHashes == nil {
+			o.allowedSigHashes = make(map[txscript.SigHashType]bool)
+		}
+		for _, hashType := range hashTypes {
+			o.allowedSigHashes[hashType|SigHashForkID] = true
+		}
+	}
+}
+
+// WithStrictSigHash makes the signing functions also refuse SIGHASH_ANYONECANPAY
+// signatures unless allowed by AllowDangerousSigHash.
+func WithStrictSigHash() SignOption {
+	return func(o *signOptions) {
+		o.strictSigHash = true
+	}
+}
+
+// checkSigHashPolicy returns an error wrapping ErrDangerousSigHash if the
+// signature of input idx with hashType is dangerous and not allowed, and
+// whether it is dangerous.
+func (o *signOptions) checkSigHashPolicy(idx int, hashType txscript.SigHashType) (bool, error) {
+	danger := sigHashDanger(hashType, o.strictSigHash)
+	if danger == "" {
+		return false, nil
+	}
+	if !o.allowedSigHashes[hashType|SigHashForkID] {
+		return true, fmt.Errorf("input %d: %w %s: %s; pass AllowDangerousSigHash to sign with it anyway", idx,
+			ErrDangerousSigHash, SigHashTypeString(hashType|SigHashForkID), danger)
+	}
+	return true, nil
+}
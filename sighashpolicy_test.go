@@ -0,0 +1,71 @@
+package bchutil
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestSigHashPolicy(t *testing.T) {
+	key := signingTestKeys()[0]
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	tx := engineTestTx(nil)
+
+	var events []SigningEvent
+	observer := WithSigningObserver(func(e SigningEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	tests := []struct {
+		hashType  txscript.SigHashType
+		opts      []SignOption
+		dangerous bool
+		refused   bool
+	}{
+		{hashType: txscript.SigHashAll},
+		{hashType: SigHashAllForkID},
+		{hashType: SigHashAllForkIDAnyOneCanPay},
+		{hashType: SigHashSingleForkIDAnyOneCanPay},
+		{hashType: txscript.SigHashNone, dangerous: true, refused: true},
+		{hashType: SigHashNoneForkIDAnyOneCanPay, dangerous: true, refused: true},
+		{hashType: SigHashSingleForkID, dangerous: true, refused: true},
+		{hashType: txscript.SigHashNone, opts: []SignOption{AllowDangerousSigHash(SigHashNoneForkID)},
+			dangerous: true},
+		{hashType: txscript.SigHashSingle, opts: []SignOption{AllowDangerousSigHash(txscript.SigHashSingle)},
+			dangerous: true},
+
+		// Allowing a type does not allow it with other flags.
+		{hashType: SigHashNoneForkIDAnyOneCanPay, opts: []SignOption{AllowDangerousSigHash(txscript.SigHashNone)},
+			dangerous: true, refused: true},
+
+		{hashType: SigHashAllForkIDAnyOneCanPay, opts: []SignOption{WithStrictSigHash()}, dangerous: true,
+			refused: true},
+		{hashType: SigHashSingleForkIDAnyOneCanPay, opts: []SignOption{WithStrictSigHash(),
+			AllowDangerousSigHash(SigHashSingleForkIDAnyOneCanPay)}, dangerous: true},
+		{hashType: SigHashAllForkID, opts: []SignOption{WithStrictSigHash()}},
+	}
+	for _, test := range tests {
+		events = events[:0]
+		opts := append(test.opts, observer)
+		_, err := RawTxInSignature(tx, 0, pkScript, test.hashType, key, 1000, opts...)
+		if test.refused {
+			if !errors.Is(err, ErrDangerousSigHash) || !strings.Contains(err.Error(), "AllowDangerousSigHash") {
+				t.Errorf("%v: got %v, want ErrDangerousSigHash", test.hashType, err)
+			}
+			if len(events) != 0 {
+				t.Errorf("%v: refused signature observed", test.hashType)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.hashType, err)
+			continue
+		}
+		if len(events) != 1 || events[0].DangerousSigHash != test.dangerous {
+			t.Errorf("%v: got events %+v, want DangerousSigHash %v", test.hashType, events, test.dangerous)
+		}
+	}
+}
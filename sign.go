@@ -18,26 +18,416 @@ const (
 	sigHashMask                        = 0x1f
 )
 
-// RawTxInSignature returns the serialized ECDSA signature for the input idx of
-// the given transaction, with hashType appended to it.
+// ErrUnsupportedSigHashType describes an error where a sighash type is not one
+// of SIGHASH_ALL, SIGHASH_NONE and SIGHASH_SINGLE, optionally combined with
+// SIGHASH_ANYONECANPAY and SIGHASH_FORKID.
+var ErrUnsupportedSigHashType = errors.New("unsupported sighash type")
+
+// checkSigHashType returns an error if hashType is not supported.
+func checkSigHashType(hashType txscript.SigHashType) error {
+	base := hashType &^ (txscript.SigHashAnyOneCanPay | SigHashForkID)
+	if base < txscript.SigHashAll || base > txscript.SigHashSingle {
+		return fmt.Errorf("%w: %#x", ErrUnsupportedSigHashType, uint32(hashType))
+	}
+	return nil
+}
+
+// SignOption is an option of the signing functions.
+type SignOption func(*signOptions)
+
+// signOptions holds the options selected by SignOption values.
+type signOptions struct {
+	extraEntropy *[32]byte
+
+	// feeLimits is set by WithFeeLimits and cleared by WithHighFee.
+	feeLimits *feeLimits
+
+	// allowTokenBurn is set by AllowTokenBurn.
+	allowTokenBurn map[chainhash.Hash]bool
+
+	// schnorr is set by WithSchnorr.
+	schnorr bool
+
+	// observer is set by WithSigningObserver.
+	observer func(SigningEvent) error
+
+	// sigCache is set by WithSignatureCache.
+	sigCache *SignatureCache
+
+	// prevOutFetcher and allowUnknownPrevOuts are set by
+	// WithPrevOutVerification.
+	prevOutFetcher       PrevOutputFetcher
+	allowUnknownPrevOuts bool
+
+	// allowedSigHashes is set by AllowDangerousSigHash, with
+	// SigHashForkID, and strictSigHash by WithStrictSigHash.
+	allowedSigHashes map[txscript.SigHashType]bool
+	strictSigHash    bool
+
+	// sigHashes is set by WithSigHashes, forkID by WithForkID, lowR by
+	// WithLowR and token by WithTokenPrevout.
+	sigHashes *txscript.TxSigHashes
+	forkID    uint32
+	lowR      bool
+	token     *TokenData
+}
+
+// ErrInvalidSignOptions describes an error where signing options are out of
+// range or cannot be combined.
+var ErrInvalidSignOptions = errors.New("invalid signing options")
+
+// maxForkID is the largest fork value, which fills the 24 high bits of the
+// sighash type word of the digests.
+const maxForkID = 1<<24 - 1
+
+// validate returns an error wrapping ErrInvalidSignOptions if the options
+// are out of range or conflict.
+func (o *signOptions) validate() error {
+	switch {
+	case o.forkID > maxForkID:
+		return fmt.Errorf("%w: fork id %#x exceeds 24 bits", ErrInvalidSignOptions, o.forkID)
+	case o.lowR && o.schnorr:
+		return fmt.Errorf("%w: low-R grinding of Schnorr signatures", ErrInvalidSignOptions)
+	case o.lowR && o.extraEntropy != nil:
+		return fmt.Errorf("%w: low-R grinding replaces the extra entropy", ErrInvalidSignOptions)
+	}
+	return nil
+}
+
+// feeLimits holds the limits passed to VerifyFee.
+type feeLimits struct {
+	maxFeeRate     FeeRate
+	maxAbsoluteFee btcutil.Amount
+}
+
+// newSignOptions returns the options selected by opts.
+func newSignOptions(opts []SignOption) signOptions {
+	var o signOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithExtraEntropy mixes entropy into the RFC 6979 nonce derivation, like the
+// ndata argument of libsecp256k1.  Signatures stay deterministic for a given
+// key, digest and entropy.  All-zero entropy is the same as no entropy, so
+// that counters used to retry signing start with the plain signature.
+func WithExtraEntropy(entropy [32]byte) SignOption {
+	return func(o *signOptions) {
+		if entropy != ([32]byte{}) {
+			o.extraEntropy = &entropy
+		}
+	}
+}
+
+// WithSignatureCache makes the signing functions return the signatures of
+// cache for the digests they signed before with the same key, sighash type
+// and kind of signature, and cache the signatures they compute.  Signatures
+// of an idempotent retry are then those of the first attempt, whatever the
+// extra entropy.
+func WithSignatureCache(cache *SignatureCache) SignOption {
+	return func(o *signOptions) {
+		o.sigCache = cache
+	}
+}
+
+// WithSchnorr makes the signing functions produce 64 byte Schnorr signatures
+// instead of DER encoded ECDSA ones.  Multisig scriptSigs then use the Schnorr
+// mode of OP_CHECKMULTISIG, whose dummy is the bitfield of the keys signing.
+func WithSchnorr() SignOption {
+	return func(o *signOptions) {
+		o.schnorr = true
+	}
+}
+
+// WithSigHashes makes the signing functions use sigHashes, the midstate
+// hashes of the transaction signed, instead of computing them for every
+// input.
+func WithSigHashes(sigHashes *txscript.TxSigHashes) SignOption {
+	return func(o *signOptions) {
+		o.sigHashes = sigHashes
+	}
+}
+
+// WithForkID makes the signing functions commit to forkID, a 24 bit fork
+// value, in the high bits of the sighash type of the digests, as chains
+// splitting from Bitcoin Cash do for replay protection.  The signatures keep
+// the one byte sighash type.
+func WithForkID(forkID uint32) SignOption {
+	return func(o *signOptions) {
+		o.forkID = forkID
+	}
+}
+
+// WithLowR makes the signing functions grind the nonces of ECDSA signatures
+// until the R value is below 2^255, saving a byte of the DER encoding in half
+// of the signatures, like Bitcoin Core does.  Each try derives the nonce with
+// a counter as extra entropy, so it cannot be combined with WithExtraEntropy
+// or WithSchnorr.
+func WithLowR() SignOption {
+	return func(o *signOptions) {
+		o.lowR = true
+	}
+}
+
+// WithTokenPrevout makes the signing functions commit to token, the tokens
+// of the output spent, as the CashTokens upgrade requires of the inputs
+// spending token outputs: the token prefix is inserted before the script code
+// of the digest.  A nil token is the same as no option.
+func WithTokenPrevout(token *TokenData) SignOption {
+	return func(o *signOptions) {
+		o.token = token
+	}
+}
+
+// ErrSigningVetoed describes an error where the observer set by
+// WithSigningObserver refused a signature.
+var ErrSigningVetoed = errors.New("signature vetoed by the signing observer")
+
+// SigningEvent describes a signature about to be produced, with the data
+// needed to recompute its digest with CalcSignatureHash, WithForkID and
+// WithTokenPrevout.
+type SigningEvent struct {
+	// Tx is a copy of the transaction signed, whose TxID is the one before
+	// the signature is added, and InputIndex the input signed.
+	Tx         *wire.MsgTx
+	TxID       chainhash.Hash
+	InputIndex int
+
+	// PrevOut is the output spent by the input, and Amount its value.
+	PrevOut wire.OutPoint
+	Amount  btcutil.Amount
+
+	// SubScript is the script code committed to, the previous output
+	// script or the redeem script.
+	SubScript []byte
+
+	// HashType is the sighash type of the signature, with SigHashForkID.
+	HashType txscript.SigHashType
+	Digest   []byte
+
+	// ForkID and Token are the fork value and the tokens of the spent
+	// output committed to, as set by WithForkID and WithTokenPrevout.
+	ForkID uint32
+	Token  *TokenData
+
+	// PubKey is the compressed public key of the signing key.
+	PubKey  []byte
+	Schnorr bool
+
+	// DangerousSigHash is whether HashType lets others change the
+	// transaction, a type allowed by AllowDangerousSigHash.
+	DangerousSigHash bool
+}
+
+// WithSigningObserver makes the signing functions call observer before every
+// signature, synchronously, with the signature about to be produced, such as
+// to record it.  Signing fails with an error wrapping ErrSigningVetoed and the
+// error of observer if it returns one, such as a policy refusing SIGHASH_NONE.
+func WithSigningObserver(observer func(SigningEvent) error) SignOption {
+	return func(o *signOptions) {
+		o.observer = observer
+	}
+}
+
+// observe passes the signature of input idx of tx by key, of digest hash, to
+// the observer of o, if any.
+func (o *signOptions) observe(tx *wire.MsgTx, idx int, subScript []byte, hashType txscript.SigHashType,
+	key *btcec.PrivateKey, amt int64, hash []byte, dangerous bool) error {
+
+	if o.observer == nil {
+		return nil
+	}
+	err := o.observer(SigningEvent{
+		Tx:         tx.Copy(),
+		TxID:       tx.TxHash(),
+		InputIndex: idx,
+		PrevOut:    tx.TxIn[idx].PreviousOutPoint,
+		Amount:     btcutil.Amount(amt),
+		SubScript:  append([]byte(nil), subScript...),
+		HashType:   hashType | SigHashForkID,
+		Digest:     append([]byte(nil), hash...),
+		ForkID:     o.forkID,
+		Token:      o.token,
+		PubKey:     key.PubKey().SerializeCompressed(),
+		Schnorr:    o.schnorr,
+
+		DangerousSigHash: dangerous,
+	})
+	if err != nil {
+		return fmt.Errorf("input %d: %w: %w", idx, ErrSigningVetoed, err)
+	}
+	return nil
+}
+
+// WithFeeLimits makes the functions signing whole transactions, such as
+// SignInputsWithPaths, check the fee with VerifyFee before signing, and fail
+// without signing anything if it exceeds maxFeeRate or maxAbsoluteFee.  It has
+// no effect on functions signing single inputs.
+func WithFeeLimits(maxFeeRate FeeRate, maxAbsoluteFee btcutil.Amount) SignOption {
+	return func(o *signOptions) {
+		o.feeLimits = &feeLimits{maxFeeRate, maxAbsoluteFee}
+	}
+}
+
+// WithHighFee disables the fee check of previous WithFeeLimits options, for
+// transactions paying a high fee on purpose, such as child-pays-for-parent
+// ones.
+func WithHighFee() SignOption {
+	return func(o *signOptions) {
+		o.feeLimits = nil
+	}
+}
+
+// checkFee checks the fee of tx against the limits of o, if any.
+func (o *signOptions) checkFee(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut) error {
+	if o.feeLimits == nil {
+		return nil
+	}
+	return VerifyFee(tx, prevOuts, o.feeLimits.maxFeeRate, o.feeLimits.maxAbsoluteFee)
+}
+
+// WithPrevOutVerification makes the functions signing the inputs of a
+// transaction check the outputs they are given as spent against fetcher with
+// VerifyPrevOuts before signing anything.  Outputs unknown to fetcher, such as
+// unconfirmed parents, fail unless allowUnknown is set.
+func WithPrevOutVerification(fetcher PrevOutputFetcher, allowUnknown bool) SignOption {
+	return func(o *signOptions) {
+		o.prevOutFetcher = fetcher
+		o.allowUnknownPrevOuts = allowUnknown
+	}
+}
+
+// checkPrevOuts checks prevOuts against the fetcher of o, if any.
+func (o *signOptions) checkPrevOuts(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut) error {
+	if o.prevOutFetcher == nil {
+		return nil
+	}
+	err := VerifyPrevOuts(tx, prevOuts, o.prevOutFetcher)
+	var prevOutErr *PrevOutError
+	if o.allowUnknownPrevOuts && errors.As(err, &prevOutErr) && len(prevOutErr.Mismatches) == 0 {
+		return nil
+	}
+	return err
+}
+
+// RawTxInSignature returns the signature of input idx of tx like SignInput.
 func RawTxInSignature(tx *wire.MsgTx, idx int, subScript []byte,
+	hashType txscript.SigHashType, key *btcec.PrivateKey, amt int64, opts ...SignOption) ([]byte, error) {
+
+	return SignInput(tx, idx, subScript, hashType, key, amt, opts...)
+}
+
+// SignInput returns the serialized ECDSA signature for the input idx of the
+// given transaction, or the Schnorr signature with WithSchnorr, with hashType
+// appended to it.  The digest signed commits to subScript, the script code,
+// and amt, the value of the spent output, and the options fail with an error
+// wrapping ErrInvalidSignOptions before anything is signed if they conflict.
+func SignInput(tx *wire.MsgTx, idx int, subScript []byte,
+	hashType txscript.SigHashType, key *btcec.PrivateKey, amt int64, opts ...SignOption) ([]byte, error) {
+
+	o := newSignOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	return o.signInput(tx, idx, subScript, hashType, key, amt)
+}
+
+// signInput signs input idx of tx like SignInput, with validated options, so
+// that the functions signing several inputs resolve them once.
+func (o *signOptions) signInput(tx *wire.MsgTx, idx int, subScript []byte,
 	hashType txscript.SigHashType, key *btcec.PrivateKey, amt int64) ([]byte, error) {
 
-	hash := calcBip143SignatureHash(subScript, txscript.NewTxSigHashes(tx), hashType, tx, idx, amt)
-	signature, err := key.Sign(hash)
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("input index %d out of range", idx)
+	}
+	dangerous, err := o.checkSigHashPolicy(idx, hashType)
+	if err != nil {
+		return nil, err
+	}
+	hash := o.sigHash(tx, idx, subScript, hashType, amt)
+	if err := o.observe(tx, idx, subScript, hashType, key, amt, hash, dangerous); err != nil {
+		return nil, err
+	}
+	signFn := func() ([]byte, error) {
+		signerOpts := &SignerOpts{Schnorr: o.schnorr, ExtraEntropy: o.extraEntropy}
+		signature, err := signDigest(key.D, key.PubKey(), hash, signerOpts)
+		for counter := uint32(1); err == nil && o.lowR && !hasLowR(signature); counter++ {
+			var entropy [32]byte
+			binary.LittleEndian.PutUint32(entropy[:], counter)
+			signerOpts.ExtraEntropy = &entropy
+			signature, err = signDigest(key.D, key.PubKey(), hash, signerOpts)
+		}
+		return signature, err
+	}
+	var signature []byte
+	if o.sigCache != nil {
+		kind := sigKindECDSA
+		switch {
+		case o.schnorr:
+			kind = sigKindSchnorr
+		case o.lowR:
+			kind = sigKindECDSALowR
+		}
+		cacheKey, _ := newSignatureCacheKey(hash, key.PubKey(), byte(hashType|SigHashForkID), kind)
+		signature, err = o.sigCache.sign(cacheKey, signFn)
+	} else {
+		signature, err = signFn()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("cannot sign tx input: %s", err)
 	}
 
-	return append(signature.Serialize(), byte(hashType|SigHashForkID)), nil
+	return append(signature, byte(hashType|SigHashForkID)), nil
+}
+
+// sigHash returns the digest of input idx of tx with the sighashes, fork id
+// and token of the spent output of the options.
+func (o *signOptions) sigHash(tx *wire.MsgTx, idx int, subScript []byte, hashType txscript.SigHashType,
+	amt int64) []byte {
+
+	sigHashes := o.sigHashes
+	if sigHashes == nil {
+		sigHashes = txscript.NewTxSigHashes(tx)
+	}
+	var tokenPrefix []byte
+	if o.token != nil {
+		tokenPrefix = o.token.Bytes()
+	}
+	return calcSignatureHash(subScript, sigHashes, hashType, tx, idx, amt, o.forkID, tokenPrefix)
+}
+
+// hasLowR returns whether the R value of the DER signature sig is below
+// 2^255, encoded without a leading zero byte.
+func hasLowR(sig []byte) bool {
+	return len(sig) > 4 && sig[3] <= 32
+}
+
+// CalcSignatureHash returns the replay protected digest signed by the
+// signatures of input idx of tx with hashType, committing to subScript, the
+// script code, and amt, the value of the spent output.  WithSigHashes,
+// WithForkID and WithTokenPrevout change the digest as they do for
+// SignInput, and the other options are ignored.
+func CalcSignatureHash(subScript []byte, hashType txscript.SigHashType, tx *wire.MsgTx, idx int,
+	amt int64, opts ...SignOption) ([]byte, error) {
+
+	o := newSignOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("input index %d out of range", idx)
+	}
+	return o.sigHash(tx, idx, subScript, hashType, amt), nil
 }
 
 func SignTxOutput(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int,
 	pkScript []byte, hashType txscript.SigHashType, kdb txscript.KeyDB, sdb txscript.ScriptDB,
-	previousScript []byte, amt int64) ([]byte, error) {
+	previousScript []byte, amt int64, opts ...SignOption) ([]byte, error) {
 
 	sigScript, class, addresses, nrequired, err := sign(chainParams, tx,
-		idx, pkScript, hashType, kdb, sdb, amt)
+		idx, pkScript, hashType, kdb, sdb, amt, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +435,7 @@ func SignTxOutput(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int,
 	if class == txscript.ScriptHashTy {
 		// TODO keep the sub addressed and pass down to merge.
 		realSigScript, _, _, _, err := sign(chainParams, tx, idx,
-			sigScript, hashType, kdb, sdb, amt)
+			sigScript, hashType, kdb, sdb, amt, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -61,7 +451,7 @@ func SignTxOutput(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int,
 
 	// Merge scripts. with any previous data, if any.
 	mergedScript := mergeScripts(chainParams, tx, idx, pkScript, class,
-		addresses, nrequired, sigScript, previousScript)
+		addresses, nrequired, sigScript, previousScript, amt, newSignOptions(opts))
 	return mergedScript, nil
 }
 
@@ -79,6 +469,16 @@ func SignTxOutput(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int,
 func calcBip143SignatureHash(subScript []byte, sigHashes *txscript.TxSigHashes,
 	hashType txscript.SigHashType, tx *wire.MsgTx, idx int, amt int64) []byte {
 
+	return calcSignatureHash(subScript, sigHashes, hashType, tx, idx, amt, 0, nil)
+}
+
+// calcSignatureHash computes the digest of calcBip143SignatureHash, with the
+// fork value forkID in the high bits of the sighash type and, for inputs
+// spending token outputs, the token prefix of the spent output before the
+// script code.
+func calcSignatureHash(subScript []byte, sigHashes *txscript.TxSigHashes, hashType txscript.SigHashType,
+	tx *wire.MsgTx, idx int, amt int64, forkID uint32, tokenPrefix []byte) []byte {
+
 	// As a sanity check, ensure the passed input index for the transaction
 	// is valid.
 	if idx > len(tx.TxIn)-1 {
@@ -87,89 +487,13 @@ func calcBip143SignatureHash(subScript []byte, sigHashes *txscript.TxSigHashes,
 		return nil
 	}
 
-	// We'll utilize this buffer throughout to incrementally calculate
-	// the signature hash for this transaction.
-	var sigHash bytes.Buffer
-
-	// First write out, then encode the transaction's version number.
-	var bVersion [4]byte
-	binary.LittleEndian.PutUint32(bVersion[:], uint32(tx.Version))
-	sigHash.Write(bVersion[:])
-
-	// Next write out the possibly pre-calculated hashes for the sequence
-	// numbers of all inputs, and the hashes of the previous outs for all
-	// outputs.
-	var zeroHash chainhash.Hash
-
-	// If anyone can pay isn't active, then we can use the cached
-	// hashPrevOuts, otherwise we just write zeroes for the prev outs.
-	if hashType&txscript.SigHashAnyOneCanPay == 0 {
-		sigHash.Write(sigHashes.HashPrevOuts[:])
-	} else {
-		sigHash.Write(zeroHash[:])
-	}
-
-	// If the sighash isn't anyone can pay, single, or none, the use the
-	// cached hash sequences, otherwise write all zeroes for the
-	// hashSequence.
-	if hashType&txscript.SigHashAnyOneCanPay == 0 &&
-		hashType&sigHashMask != txscript.SigHashSingle &&
-		hashType&sigHashMask != txscript.SigHashNone {
-		sigHash.Write(sigHashes.HashSequence[:])
-	} else {
-		sigHash.Write(zeroHash[:])
-	}
-
-	// Next, write the outpoint being spent.
-	sigHash.Write(tx.TxIn[idx].PreviousOutPoint.Hash[:])
-	var bIndex [4]byte
-	binary.LittleEndian.PutUint32(bIndex[:], tx.TxIn[idx].PreviousOutPoint.Index)
-	sigHash.Write(bIndex[:])
-
-	// For p2wsh outputs, and future outputs, the script code is the
-	// original script, with all code separators removed, serialized
-	// with a var int length prefix.
-	wire.WriteVarBytes(&sigHash, 0, subScript)
-
-	// Next, add the input amount, and sequence number of the input being
-	// signed.
-	var bAmount [8]byte
-	binary.LittleEndian.PutUint64(bAmount[:], uint64(amt))
-	sigHash.Write(bAmount[:])
-	var bSequence [4]byte
-	binary.LittleEndian.PutUint32(bSequence[:], tx.TxIn[idx].Sequence)
-	sigHash.Write(bSequence[:])
-
-	// If the current signature mode isn't single, or none, then we can
-	// re-use the pre-generated hashoutputs sighash fragment. Otherwise,
-	// we'll serialize and add only the target output index to the signature
-	// pre-image.
-	if hashType&sigHashMask != txscript.SigHashSingle &&
-		hashType&sigHashMask != txscript.SigHashNone {
-		sigHash.Write(sigHashes.HashOutputs[:])
-	} else if hashType&sigHashMask == txscript.SigHashSingle && idx < len(tx.TxOut) {
-		var b bytes.Buffer
-		wire.WriteTxOut(&b, 0, 0, tx.TxOut[idx])
-		sigHash.Write(chainhash.DoubleHashB(b.Bytes()))
-	} else {
-		sigHash.Write(zeroHash[:])
-	}
-
-	// Finally, write out the transaction's locktime, and the sig hash
-	// type.
-	var bLockTime [4]byte
-	binary.LittleEndian.PutUint32(bLockTime[:], tx.LockTime)
-	sigHash.Write(bLockTime[:])
-	var bHashType [4]byte
-	binary.LittleEndian.PutUint32(bHashType[:], uint32(hashType|SigHashForkID))
-	sigHash.Write(bHashType[:])
-
-	return chainhash.DoubleHashB(sigHash.Bytes())
+	return chainhash.DoubleHashB(txSigHashFields(subScript, sigHashes, hashType, tx, idx, amt, forkID,
+		tokenPrefix).preimage())
 }
 
 func sign(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int,
-	subScript []byte, hashType txscript.SigHashType, kdb txscript.KeyDB, sdb txscript.ScriptDB, amt int64) ([]byte,
-	txscript.ScriptClass, []btcutil.Address, int, error) {
+	subScript []byte, hashType txscript.SigHashType, kdb txscript.KeyDB, sdb txscript.ScriptDB, amt int64,
+	opts []SignOption) ([]byte, txscript.ScriptClass, []btcutil.Address, int, error) {
 
 	class, addresses, nrequired, err := txscript.ExtractPkScriptAddrs(subScript,
 		chainParams)
@@ -186,7 +510,24 @@ func sign(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int,
 		}
 
 		script, err := SignatureScript(tx, idx, subScript, hashType,
-			key, compressed, amt)
+			key, compressed, amt, opts...)
+		if err != nil {
+			return nil, class, nil, 0, err
+		}
+
+		return script, class, addresses, nrequired, nil
+	case txscript.PubKeyTy:
+		// Pay-to-pubkey outputs are spent with the signature alone.
+		key, _, err := kdb.GetKey(addresses[0])
+		if err != nil {
+			return nil, class, nil, 0, err
+		}
+
+		sig, err := RawTxInSignature(tx, idx, subScript, hashType, key, amt, opts...)
+		if err != nil {
+			return nil, class, nil, 0, err
+		}
+		script, err := txscript.NewScriptBuilder().AddData(sig).Script()
 		if err != nil {
 			return nil, class, nil, 0, err
 		}
@@ -200,8 +541,11 @@ func sign(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int,
 
 		return script, class, addresses, nrequired, nil
 	case txscript.MultiSigTy:
-		script, _ := signMultiSig(tx, idx, subScript, hashType,
-			addresses, nrequired, kdb, amt)
+		script, _, err := signMultiSig(tx, idx, subScript, hashType,
+			addresses, nrequired, kdb, amt, opts)
+		if err != nil {
+			return nil, class, nil, 0, err
+		}
 		return script, class, addresses, nrequired, nil
 	default:
 		return nil, class, nil, 0,
@@ -212,38 +556,51 @@ func sign(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int,
 // signMultiSig signs as many of the outputs in the provided multisig script as
 // possible. It returns the generated script and a boolean if the script fulfils
 // the contract (i.e. nrequired signatures are provided).  Since it is arguably
-// legal to not be able to sign any of the outputs, no error is returned.
+// legal to not be able to sign any of the outputs, only signatures vetoed by
+// the signing observer return an error.
+// With WithSchnorr, the signatures are Schnorr signatures and the dummy is the
+// bitfield of the keys signing.
 func signMultiSig(tx *wire.MsgTx, idx int, subScript []byte, hashType txscript.SigHashType,
-	addresses []btcutil.Address, nRequired int, kdb txscript.KeyDB, amt int64) ([]byte, bool) {
-	// We start with a single OP_FALSE to work around the (now standard)
-	// but in the reference implementation that causes a spurious pop at
-	// the end of OP_CHECKMULTISIG.
-	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_FALSE)
-	signed := 0
-	for _, addr := range addresses {
+	addresses []btcutil.Address, nRequired int, kdb txscript.KeyDB, amt int64, opts []SignOption) ([]byte, bool, error) {
+	var sigs [][]byte
+	var checkBits uint32
+	for i, addr := range addresses {
 		key, _, err := kdb.GetKey(addr)
 		if err != nil {
 			continue
 		}
-		sig, err := RawTxInSignature(tx, idx, subScript, hashType, key, amt)
+		sig, err := RawTxInSignature(tx, idx, subScript, hashType, key, amt, opts...)
+		if errors.Is(err, ErrSigningVetoed) {
+			return nil, false, err
+		}
 		if err != nil {
 			continue
 		}
 
-		builder.AddData(sig)
-		signed++
-		if signed == nRequired {
+		sigs = append(sigs, sig)
+		checkBits |= 1 << uint(i)
+		if len(sigs) == nRequired {
 			break
 		}
 
 	}
 
+	// Legacy multisig starts with a single OP_FALSE to work around the
+	// (now standard) bug in the reference implementation that causes a
+	// spurious pop at the end of OP_CHECKMULTISIG.
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_FALSE)
+	if newSignOptions(opts).schnorr {
+		builder = txscript.NewScriptBuilder().AddData(multisigBitfield(checkBits, len(addresses)))
+	}
+	for _, sig := range sigs {
+		builder.AddData(sig)
+	}
 	script, _ := builder.Script()
-	return script, signed == nRequired
+	return script, len(sigs) == nRequired, nil
 }
 
-func SignatureScript(tx *wire.MsgTx, idx int, subscript []byte, hashType txscript.SigHashType, privKey *btcec.PrivateKey, compress bool, amt int64) ([]byte, error) {
-	sig, err := RawTxInSignature(tx, idx, subscript, hashType, privKey, amt)
+func SignatureScript(tx *wire.MsgTx, idx int, subscript []byte, hashType txscript.SigHashType, privKey *btcec.PrivateKey, compress bool, amt int64, opts ...SignOption) ([]byte, error) {
+	sig, err := RawTxInSignature(tx, idx, subscript, hashType, privKey, amt, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -259,21 +616,74 @@ func SignatureScript(tx *wire.MsgTx, idx int, subscript []byte, hashType txscrip
 	return txscript.NewScriptBuilder().AddData(sig).AddData(pkData).Script()
 }
 
+// mergeScripts merges sigScript, the scriptSig just signed, with prevScript,
+// a scriptSig of the input signed before.  The signatures of multisig scripts,
+// bare or redeemed by pay-to-script-hash, are ordered by the keys they are
+// valid for, checked with the digests of o.
 func mergeScripts(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int,
 	pkScript []byte, class txscript.ScriptClass, addresses []btcutil.Address,
-	nRequired int, sigScript, prevScript []byte) []byte {
-	switch class {
+	nRequired int, sigScript, prevScript []byte, amt int64, o signOptions) []byte {
+
+	if len(sigScript) != 0 && len(prevScript) != 0 {
+		sigOps, err := parseScript(sigScript)
+		prevOps, prevErr := parseScript(prevScript)
+		valid := err == nil && prevErr == nil && isPushOnly(sigOps) && isPushOnly(prevOps)
+		switch {
+		case valid && class == txscript.MultiSigTy:
+			if builder, ok := o.mergeMultiSig(tx, idx, pkScript, sigOps, prevOps, amt); ok {
+				if merged, err := builder.Script(); err == nil {
+					return merged
+				}
+			}
+		case valid && class == txscript.ScriptHashTy && len(sigOps) > 1 && len(prevOps) > 1:
+			redeemScript := sigOps[len(sigOps)-1].data
+			if !bytes.Equal(redeemScript, prevOps[len(prevOps)-1].data) {
+				break
+			}
+			builder, ok := o.mergeMultiSig(tx, idx, redeemScript, sigOps[:len(sigOps)-1],
+				prevOps[:len(prevOps)-1], amt)
+			if ok {
+				if merged, err := builder.AddData(redeemScript).Script(); err == nil {
+					return merged
+				}
+			}
+		}
+	}
 
 	// It doesn't actually make sense to merge anything other than multiig
 	// and scripthash (because it could contain multisig). Everything else
 	// has either zero signature, can't be spent, or has a single signature
-	// which is either present or not. The other two cases are handled
-	// above. In the conflict case here we just assume the longest is
-	// correct (this matches behaviour of the reference implementation).
-	default:
-		if len(sigScript) > len(prevScript) {
-			return sigScript
+	// which is either present or not. In the conflict case here we just
+	// assume the longest is correct (this matches behaviour of the
+	// reference implementation).
+	if len(sigScript) > len(prevScript) {
+		return sigScript
+	}
+	return prevScript
+}
+
+// mergeMultiSig returns the builder of the scriptSig pushing the signatures of
+// the multisig scriptSigs sigOps and prevOps, without redeem script, for
+// script.  It fails if script is not multisig, or the signatures cannot be
+// combined.
+func (o *signOptions) mergeMultiSig(tx *wire.MsgTx, idx int, script []byte,
+	sigOps, prevOps []parsedOpcode, amt int64) (*txscript.ScriptBuilder, bool) {
+
+	pubKeys, nRequired, ok := multisigPubKeys(script)
+	if !ok || len(sigOps) == 0 || len(prevOps) == 0 {
+		return nil, false
+	}
+	// The first push of both is the dummy.
+	var sigs [][]byte
+	for _, ops := range [][]parsedOpcode{sigOps[1:], prevOps[1:]} {
+		for _, op := range ops {
+			sigs = append(sigs, op.data)
 		}
-		return prevScript
 	}
+	if o.sigHashes == nil {
+		o.sigHashes = txscript.NewTxSigHashes(tx)
+	}
+	bySlot, _ := o.orderSignatures(pubKeys, sigs, tx, idx, script, amt)
+	builder, err := multisigScriptSigBuilder(bySlot, nRequired)
+	return builder, err == nil
 }
@@ -3,8 +3,10 @@ package bchutil
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -99,3 +101,197 @@ func TestCalulateSigHash(t *testing.T) {
 		}
 	}
 }
+
+func TestExtraEntropy(t *testing.T) {
+	raw, _ := hex.DecodeString(SigHashTestVectors[0].RawTx)
+	msgTx := wire.NewMsgTx(1)
+	msgTx.BtcDecode(bytes.NewReader(raw), 1, wire.BaseEncoding)
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte("extra entropy test key"))
+	prevScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	amt := SigHashTestVectors[0].Inputs[0].Value
+
+	hash := calcBip143SignatureHash(prevScript, txscript.NewTxSigHashes(msgTx), txscript.SigHashAll, msgTx, 0, amt)
+	legacy, _ := key.Sign(hash)
+	want := append(legacy.Serialize(), byte(txscript.SigHashAll|SigHashForkID))
+
+	plain, err := RawTxInSignature(msgTx, 0, prevScript, txscript.SigHashAll, key, amt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero, _ := RawTxInSignature(msgTx, 0, prevScript, txscript.SigHashAll, key, amt, WithExtraEntropy([32]byte{}))
+	if !bytes.Equal(plain, want) || !bytes.Equal(zero, want) {
+		t.Error("signature without entropy differs from btcec.Sign")
+	}
+
+	seen := map[string]bool{string(plain): true}
+	for i := byte(1); i <= 3; i++ {
+		entropy := [32]byte{i}
+		sig, err := RawTxInSignature(msgTx, 0, prevScript, txscript.SigHashAll, key, amt, WithExtraEntropy(entropy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[string(sig)] {
+			t.Errorf("entropy %d: signature is not different", i)
+		}
+		seen[string(sig)] = true
+		again, _ := RawTxInSignature(msgTx, 0, prevScript, txscript.SigHashAll, key, amt, WithExtraEntropy(entropy))
+		if !bytes.Equal(sig, again) {
+			t.Errorf("entropy %d: signature is not deterministic", i)
+		}
+		parsed, err := btcec.ParseDERSignature(sig[:len(sig)-1], btcec.S256())
+		if err != nil || !parsed.Verify(hash, key.PubKey()) {
+			t.Errorf("entropy %d: signature does not verify", i)
+		}
+
+		schnorr, err := NewPrivKeySigner(key).SignDigest(hash, &SignerOpts{Schnorr: true, ExtraEntropy: &entropy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifySchnorr(key.PubKey(), hash, schnorr) {
+			t.Errorf("entropy %d: Schnorr signature does not verify", i)
+		}
+		if plainSchnorr, _ := SignSchnorr(key, hash); bytes.Equal(plainSchnorr, schnorr) {
+			t.Errorf("entropy %d: Schnorr signature is not different", i)
+		}
+	}
+}
+
+func TestSigningObserver(t *testing.T) {
+	keys := signingTestKeys()
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(keys[0].PubKey().SerializeCompressed()))
+	tx := engineTestTx(nil)
+
+	var events []SigningEvent
+	observer := WithSigningObserver(func(e SigningEvent) error {
+		events = append(events, e)
+		if e.HashType&sigHashMask == txscript.SigHashNone {
+			return errors.New("SIGHASH_NONE refused")
+		}
+		return nil
+	})
+	sig, err := RawTxInSignature(tx, 0, pkScript, txscript.SigHashAll, keys[0], 1000, observer, WithSchnorr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events", len(events))
+	}
+	e := events[0]
+	if e.TxID != tx.TxHash() || e.Tx.TxHash() != tx.TxHash() || e.InputIndex != 0 ||
+		e.PrevOut != tx.TxIn[0].PreviousOutPoint || e.Amount != 1000 || !e.Schnorr ||
+		e.HashType != txscript.SigHashAll|SigHashForkID ||
+		!bytes.Equal(e.PubKey, keys[0].PubKey().SerializeCompressed()) {
+		t.Errorf("got event %+v", e)
+	}
+	digest, err := CalcSignatureHash(e.SubScript, e.HashType, e.Tx, e.InputIndex, int64(e.Amount))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(digest, e.Digest) || !VerifySchnorr(keys[0].PubKey(), digest, sig[:len(sig)-1]) {
+		t.Error("digest of the event does not match the signature")
+	}
+
+	if _, err := RawTxInSignature(tx, 0, pkScript, txscript.SigHashNone, keys[0], 1000, observer,
+		AllowDangerousSigHash(txscript.SigHashNone)); !errors.Is(err, ErrSigningVetoed) {
+		t.Errorf("got %v, want ErrSigningVetoed", err)
+	}
+
+	// Vetoed multisig signatures fail instead of being left out.
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_1)
+	for _, key := range keys {
+		builder.AddData(key.PubKey().SerializeCompressed())
+	}
+	multisig, _ := builder.AddOp(txscript.OP_2).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	kdb := txscript.KeyClosure(func(addr btcutil.Address) (*btcec.PrivateKey, bool, error) {
+		return keys[0], true, nil
+	})
+	_, err = SignTxOutput(&chaincfg.MainNetParams, tx, 0, multisig, txscript.SigHashNone, kdb, nil, nil, 1000, observer,
+		AllowDangerousSigHash(txscript.SigHashNone))
+	if !errors.Is(err, ErrSigningVetoed) {
+		t.Errorf("got %v, want ErrSigningVetoed", err)
+	}
+}
+
+func TestSignInputOptions(t *testing.T) {
+	key := signingTestKeys()[0]
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	tx := engineTestTx(nil)
+	hashType := txscript.SigHashAll
+
+	plain, err := SignInput(tx, 0, pkScript, hashType, key, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, _ := RawTxInSignature(tx, 0, pkScript, hashType, key, 1000)
+	cached, _ := SignInput(tx, 0, pkScript, hashType, key, 1000, WithSigHashes(txscript.NewTxSigHashes(tx)))
+	if !bytes.Equal(plain, legacy) || !bytes.Equal(plain, cached) {
+		t.Error("signatures differ")
+	}
+
+	verify := func(name string, sig []byte, opts ...SignOption) {
+		t.Helper()
+		digest, err := CalcSignatureHash(pkScript, hashType, tx, 0, 1000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := btcec.ParseDERSignature(sig[:len(sig)-1], btcec.S256())
+		if err != nil || !parsed.Verify(digest, key.PubKey()) {
+			t.Errorf("%s: signature does not verify", name)
+		}
+		if bytes.Equal(sig, plain) {
+			t.Errorf("%s: signature does not change", name)
+		}
+	}
+	forkID, _ := SignInput(tx, 0, pkScript, hashType, key, 1000, WithForkID(0xabcdef))
+	verify("fork id", forkID, WithForkID(0xabcdef))
+	token := &TokenData{Category: chainhash.Hash{7}, Amount: 100}
+	tokenSig, _ := SignInput(tx, 0, pkScript, hashType, key, 1000, WithTokenPrevout(token))
+	verify("token", tokenSig, WithTokenPrevout(token))
+	if fork, _ := SignInput(tx, 0, pkScript, hashType, key, 1000, WithForkID(0)); !bytes.Equal(fork, plain) {
+		t.Error("fork id 0 changes the signature")
+	}
+
+	for i := byte(0); i < 16; i++ {
+		tx.TxOut[0].Value = 1000 + int64(i)
+		sig, err := SignInput(tx, 0, pkScript, hashType, key, 1000, WithLowR())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasLowR(sig) || len(sig) > 71 {
+			t.Errorf("got signature %x", sig)
+		}
+		digest, _ := CalcSignatureHash(pkScript, hashType, tx, 0, 1000)
+		if parsed, err := btcec.ParseDERSignature(sig[:len(sig)-1], btcec.S256()); err != nil ||
+			!parsed.Verify(digest, key.PubKey()) {
+			t.Errorf("low-R signature %x does not verify", sig)
+		}
+	}
+
+	for _, opts := range [][]SignOption{
+		{WithLowR(), WithSchnorr()},
+		{WithExtraEntropy([32]byte{1}), WithLowR()},
+		{WithForkID(1 << 24)},
+	} {
+		if _, err := SignInput(tx, 0, pkScript, hashType, key, 1000, opts...); !errors.Is(err, ErrInvalidSignOptions) {
+			t.Errorf("got %v, want ErrInvalidSignOptions", err)
+		}
+	}
+}
+
+func TestSignInputWithPathToken(t *testing.T) {
+	paths := map[int]Path{0: BIP44Path(0, ExternalChain, 0)}
+	tx, prevOuts := pathSignTestTx(t, paths)
+	pkScript := prevOuts[0].PkScript
+	token := &TokenData{Category: chainhash.Hash{7}, HasNFT: true, Commitment: []byte{1}}
+	prevOuts[0] = wire.NewTxOut(prevOuts[0].Value, append(token.Bytes(), pkScript...))
+	tx.TxOut[0].PkScript = prevOuts[0].PkScript
+	if err := SignInputsWithPaths(tx, prevOuts, txscript.SigHashAll, nil, descTestKey(), paths); err != nil {
+		t.Fatal(err)
+	}
+	pushes, _ := txscript.PushedData(tx.TxIn[0].SignatureScript)
+	digest, _ := CalcSignatureHash(pkScript, txscript.SigHashAll, tx, 0, prevOuts[0].Value, WithTokenPrevout(token))
+	sig, err := btcec.ParseDERSignature(pushes[0][:len(pushes[0])-1], btcec.S256())
+	if pub, _ := btcec.ParsePubKey(pushes[1], btcec.S256()); err != nil || !sig.Verify(digest, pub) {
+		t.Error("signature does not commit to the token")
+	}
+}
@@ -0,0 +1,196 @@
+package bchutil
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// maxCachedSignatureSize is the size of the largest signature a
+// SignatureCache holds, that of a DER encoded ECDSA signature, so that the
+// memory of the cache is bounded by its number of entries.
+const maxCachedSignatureSize = 72
+
+// Kinds of signatures of a SignatureCache key, which signatures of the same
+// digest and key differ by.
+const (
+	sigKindECDSA byte = iota
+	sigKindECDSALowR
+	sigKindSchnorr
+)
+
+// signatureCacheKey identifies a signature: the digest signed, the
+// compressed public key signing it, the sighash type byte committed to by the
+// digest and the kind of signature.
+type signatureCacheKey struct {
+	digest   [32]byte
+	pubKey   [33]byte
+	hashType byte
+	kind     byte
+}
+
+// newSignatureCacheKey returns the key of a signature, and false if the
+// digest is not 32 bytes long.
+func newSignatureCacheKey(digest []byte, pubKey *btcec.PublicKey, hashType byte, kind byte) (signatureCacheKey,
+	bool) {
+
+	key := signatureCacheKey{hashType: hashType, kind: kind}
+	if len(digest) != len(key.digest) {
+		return key, false
+	}
+	copy(key.digest[:], digest)
+	copy(key.pubKey[:], pubKey.SerializeCompressed())
+	return key, true
+}
+
+// signatureCacheEntry is an entry of the LRU list of a SignatureCache.
+type signatureCacheEntry struct {
+	key signatureCacheKey
+	sig [maxCachedSignatureSize]byte
+	len uint8
+}
+
+// SignatureCacheMetrics are the hooks a SignatureCache calls on lookups and
+// evictions, such as counters of a monitoring system.  Nil hooks are not
+// called.  Hooks are called without the lock of the cache held, possibly
+// concurrently.
+type SignatureCacheMetrics struct {
+	Hit   func()
+	Miss  func()
+	Evict func()
+}
+
+// SignatureCache is a bounded LRU cache of signatures, keyed by digest,
+// public key, sighash type and kind of signature, so that signing the same
+// digest again returns the first signature, whatever the extra entropy of
+// the retry, without computing it.  Signatures larger than a DER encoded
+// ECDSA signature are not cached, which bounds the memory of the cache to a
+// few hundred bytes per entry.  It is safe for concurrent use.  See
+// WithSignatureCache and NewCachingSigner.
+type SignatureCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[signatureCacheKey]*list.Element
+	lru        *list.List
+	metrics    SignatureCacheMetrics
+}
+
+// NewSignatureCache returns a cache of at most maxEntries signatures, at least
+// one, calling the hooks of metrics if not nil.
+func NewSignatureCache(maxEntries int, metrics *SignatureCacheMetrics) *SignatureCache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	c := &SignatureCache{
+		maxEntries: maxEntries,
+		entries:    make(map[signatureCacheKey]*list.Element),
+		lru:        list.New(),
+	}
+	if metrics != nil {
+		c.metrics = *metrics
+	}
+	return c
+}
+
+// Len returns the number of signatures in the cache.
+func (c *SignatureCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// get returns a copy of the signature of key, and whether it is cached.
+func (c *SignatureCache) get(key signatureCacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	var sig []byte
+	if ok {
+		c.lru.MoveToFront(elem)
+		entry := elem.Value.(*signatureCacheEntry)
+		sig = append([]byte(nil), entry.sig[:entry.len]...)
+	}
+	c.mu.Unlock()
+
+	if ok && c.metrics.Hit != nil {
+		c.metrics.Hit()
+	} else if !ok && c.metrics.Miss != nil {
+		c.metrics.Miss()
+	}
+	return sig, ok
+}
+
+// put caches sig as the signature of key, evicting the least recently used
+// signature of a full cache, and returns the signature cached for key.  A
+// signature already cached for key is kept, so that concurrent signers of a
+// digest agree on the first one.
+func (c *SignatureCache) put(key signatureCacheKey, sig []byte) []byte {
+	if len(sig) > maxCachedSignatureSize {
+		return sig
+	}
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*signatureCacheEntry)
+		sig = append([]byte(nil), entry.sig[:entry.len]...)
+		c.mu.Unlock()
+		return sig
+	}
+	entry := &signatureCacheEntry{key: key, len: uint8(len(sig))}
+	copy(entry.sig[:], sig)
+	c.entries[key] = c.lru.PushFront(entry)
+	evicted := false
+	if c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*signatureCacheEntry).key)
+		evicted = true
+	}
+	c.mu.Unlock()
+
+	if evicted && c.metrics.Evict != nil {
+		c.metrics.Evict()
+	}
+	return sig
+}
+
+// sign returns the signature of key from the cache, or that of signFn, which
+// is then cached.
+func (c *SignatureCache) sign(key signatureCacheKey, signFn func() ([]byte, error)) ([]byte, error) {
+	if sig, ok := c.get(key); ok {
+		return sig, nil
+	}
+	sig, err := signFn()
+	if err != nil {
+		return nil, err
+	}
+	return c.put(key, sig), nil
+}
+
+// CachingSigner is a Signer returning the signatures of a SignatureCache for
+// the digests it signed before.  Signer level digests have no sighash type
+// byte, being keyed with zero.
+type CachingSigner struct {
+	Signer
+	cache *SignatureCache
+}
+
+// NewCachingSigner returns a Signer signing with signer through cache.
+func NewCachingSigner(signer Signer, cache *SignatureCache) *CachingSigner {
+	return &CachingSigner{Signer: signer, cache: cache}
+}
+
+// SignDigest returns the signature of digest from the cache, signing it with
+// the wrapped signer the first time.
+func (s *CachingSigner) SignDigest(digest []byte, opts *SignerOpts) ([]byte, error) {
+	kind := sigKindECDSA
+	if opts != nil && opts.Schnorr {
+		kind = sigKindSchnorr
+	}
+	key, ok := newSignatureCacheKey(digest, s.PubKey(), 0, kind)
+	if !ok {
+		return s.Signer.SignDigest(digest, opts)
+	}
+	return s.cache.sign(key, func() ([]byte, error) {
+		return s.Signer.SignDigest(digest, opts)
+	})
+}
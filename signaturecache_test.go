@@ -0,0 +1,116 @@
+package bchutil
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// countingSigner counts the digests signed by a Signer.
+type countingSigner struct {
+	Signer
+	signed int32
+}
+
+func (s *countingSigner) SignDigest(digest []byte, opts *SignerOpts) ([]byte, error) {
+	atomic.AddInt32(&s.signed, 1)
+	return s.Signer.SignDigest(digest, opts)
+}
+
+func TestSignatureCache(t *testing.T) {
+	var hits, misses, evictions int32
+	cache := NewSignatureCache(4, &SignatureCacheMetrics{
+		Hit:   func() { atomic.AddInt32(&hits, 1) },
+		Miss:  func() { atomic.AddInt32(&misses, 1) },
+		Evict: func() { atomic.AddInt32(&evictions, 1) },
+	})
+	key := signingTestKeys()[0]
+	tx := engineTestTx(nil)
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+
+	// Retries with other extra entropy return the first signature.
+	first, err := SignInput(tx, 0, pkScript, txscript.SigHashAll, key, 1000, WithSignatureCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry, err := SignInput(tx, 0, pkScript, txscript.SigHashAll, key, 1000, WithSignatureCache(cache),
+		WithExtraEntropy([32]byte{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, retry) || hits != 1 || misses != 1 {
+		t.Fatalf("retry signature %x, first %x, %d hits, %d misses", retry, first, hits, misses)
+	}
+	uncached, _ := SignInput(tx, 0, pkScript, txscript.SigHashAll, key, 1000, WithExtraEntropy([32]byte{1}))
+	if bytes.Equal(first, uncached) {
+		t.Fatal("extra entropy does not change the signature")
+	}
+
+	// Other sighash types and kinds of signatures are other entries.
+	for _, opts := range [][]SignOption{
+		{WithSchnorr()},
+		{WithLowR()},
+	} {
+		sig, err := SignInput(tx, 0, pkScript, txscript.SigHashAll, key, 1000,
+			append(opts, WithSignatureCache(cache))...)
+		if err != nil || bytes.Equal(sig, first) {
+			t.Errorf("got %x, %v", sig, err)
+		}
+	}
+	sig, _ := SignInput(tx, 0, pkScript, txscript.SigHashSingle, key, 1000, WithSignatureCache(cache),
+		AllowDangerousSigHash(txscript.SigHashSingle))
+	if sig[len(sig)-1] != byte(txscript.SigHashSingle|SigHashForkID) || cache.Len() != 4 || misses != 4 {
+		t.Errorf("SIGHASH_SINGLE signature %x, %d entries, %d misses", sig, cache.Len(), misses)
+	}
+
+	// The least recently used signature is evicted first: the first one is
+	// used again and kept.
+	SignInput(tx, 0, pkScript, txscript.SigHashAll, key, 1000, WithSignatureCache(cache))
+	SignInput(tx, 0, pkScript, txscript.SigHashAll, key, 2000, WithSignatureCache(cache))
+	if cache.Len() != 4 || evictions != 1 {
+		t.Fatalf("%d entries, %d evictions", cache.Len(), evictions)
+	}
+	hitsBefore := hits
+	SignInput(tx, 0, pkScript, txscript.SigHashAll, key, 1000, WithSignatureCache(cache))
+	if hits != hitsBefore+1 {
+		t.Error("most recently used signature evicted")
+	}
+}
+
+func TestCachingSigner(t *testing.T) {
+	cache := NewSignatureCache(100, nil)
+	counting := &countingSigner{Signer: NewPrivKeySigner(signingTestKeys()[0])}
+	signer := NewCachingSigner(counting, cache)
+	digest := bytes.Repeat([]byte{7}, 32)
+
+	var wg sync.WaitGroup
+	sigs := make([][]byte, 16)
+	for i := range sigs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			opts := &SignerOpts{ExtraEntropy: &[32]byte{byte(i)}}
+			sigs[i], _ = signer.SignDigest(digest, opts)
+		}(i)
+	}
+	wg.Wait()
+	for i, sig := range sigs {
+		if !bytes.Equal(sig, sigs[0]) {
+			t.Errorf("signature %d is %x, want %x", i, sig, sigs[0])
+		}
+	}
+	signed := atomic.LoadInt32(&counting.signed)
+	schnorr, err := signer.SignDigest(digest, &SignerOpts{Schnorr: true})
+	if err != nil || len(schnorr) != 64 || atomic.LoadInt32(&counting.signed) != signed+1 {
+		t.Errorf("Schnorr signature %x: %v", schnorr, err)
+	}
+	if _, err := signer.SignDigest(digest[:31], nil); err == nil {
+		t.Error("short digest signed")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("%d entries", cache.Len())
+	}
+}
@@ -0,0 +1,127 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrSignedTxMutated describes an error where a signed transaction was
+// modified after it was signed, which invalidates its signatures.
+var ErrSignedTxMutated = errors.New("signed transaction mutated")
+
+// SignedTx is a transaction as it was when signed.  It snapshots the
+// serialization and txid of the transaction, returns copies of them, and
+// Verify detects the changes made since through the transaction signed, such
+// as an output tweaked or inputs sorted by code keeping a pointer to it.
+type SignedTx struct {
+	tx   *wire.MsgTx
+	raw  []byte
+	txid chainhash.Hash
+}
+
+// NewSignedTx returns the SignedTx of tx, which is to be fully signed.
+func NewSignedTx(tx *wire.MsgTx) *SignedTx {
+	var buf bytes.Buffer
+	buf.Grow(tx.SerializeSize())
+	tx.Serialize(&buf)
+	return &SignedTx{tx: tx, raw: buf.Bytes(), txid: tx.TxHash()}
+}
+
+// TxID returns the txid of the transaction when signed.
+func (s *SignedTx) TxID() chainhash.Hash {
+	return s.txid
+}
+
+// Bytes returns a copy of the serialization of the transaction when signed.
+func (s *SignedTx) Bytes() []byte {
+	return append([]byte(nil), s.raw...)
+}
+
+// Size returns the size of the transaction when signed.
+func (s *SignedTx) Size() int {
+	return len(s.raw)
+}
+
+// MsgTx returns a copy of the transaction when signed, decoded from its
+// snapshot, which may be modified without affecting s.
+func (s *SignedTx) MsgTx() *wire.MsgTx {
+	tx := new(wire.MsgTx)
+	// The snapshot is a serialized transaction.
+	_ = tx.Deserialize(bytes.NewReader(s.raw))
+	return tx
+}
+
+// Verify returns an error wrapping ErrSignedTxMutated, naming the first field
+// differing, if the transaction signed no longer serializes as it did when
+// signed.
+func (s *SignedTx) Verify() error {
+	var buf bytes.Buffer
+	buf.Grow(len(s.raw))
+	s.tx.Serialize(&buf)
+	if bytes.Equal(buf.Bytes(), s.raw) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s differs", ErrSignedTxMutated, txDiff(s.MsgTx(), s.tx))
+}
+
+// txDiff returns the name of the first field of got differing from want.
+func txDiff(want, got *wire.MsgTx) string {
+	switch {
+	case got.Version != want.Version:
+		return "version"
+	case len(got.TxIn) != len(want.TxIn):
+		return "input count"
+	}
+	for i, txIn := range got.TxIn {
+		switch {
+		case txIn.PreviousOutPoint != want.TxIn[i].PreviousOutPoint:
+			return fmt.Sprintf("outpoint of input %d", i)
+		case !bytes.Equal(txIn.SignatureScript, want.TxIn[i].SignatureScript):
+			return fmt.Sprintf("scriptSig of input %d", i)
+		case txIn.Sequence != want.TxIn[i].Sequence:
+			return fmt.Sprintf("sequence of input %d", i)
+		}
+	}
+	if len(got.TxOut) != len(want.TxOut) {
+		return "output count"
+	}
+	for i, txOut := range got.TxOut {
+		switch {
+		case txOut.Value != want.TxOut[i].Value:
+			return fmt.Sprintf("value of output %d", i)
+		case !bytes.Equal(txOut.PkScript, want.TxOut[i].PkScript):
+			return fmt.Sprintf("script of output %d", i)
+		}
+	}
+	if got.LockTime != want.LockTime {
+		return "lock time"
+	}
+	return "serialization"
+}
+
+// SignTx signs all inputs of the transaction as Sign does, and returns it as
+// a SignedTx.
+func (u *UnsignedTx) SignTx(chainParams *chaincfg.Params, kdb txscript.KeyDB, sdb txscript.ScriptDB) (*SignedTx,
+	error) {
+
+	if err := u.Sign(chainParams, kdb, sdb); err != nil {
+		return nil, err
+	}
+	return NewSignedTx(u.Tx), nil
+}
+
+// SignTx signs every input of the transaction with key as Sign does, and
+// returns it as a SignedTx.
+func (t *VaultTx) SignTx(key *btcec.PrivateKey, opts ...SignOption) (*SignedTx, error) {
+	if err := t.Sign(key, opts...); err != nil {
+		return nil, err
+	}
+	return NewSignedTx(t.Tx), nil
+}
@@ -0,0 +1,92 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func signedTestTx(t *testing.T) (*UnsignedTx, *SignedTx) {
+	t.Helper()
+	key := signingTestKeys()[0]
+	wif, _ := btcutil.NewWIF(key, &chaincfg.MainNetParams, true)
+	from, _ := NewCashAddressPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()),
+		&chaincfg.MainNetParams)
+	fromScript, _ := PayToAddrScript(from)
+	to, _ := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.MainNetParams)
+
+	b := NewTxBuilder(1000, fromScript)
+	b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 1e6, PkScript: fromScript},
+		UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{2}}, Amount: 1e6, PkScript: fromScript})
+	if err := b.AddPayment(to, 15e5); err != nil {
+		t.Fatal(err)
+	}
+	u, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kdb, _ := NewWIFKeyDB(&chaincfg.MainNetParams, wif)
+	signed, err := u.SignTx(&chaincfg.MainNetParams, kdb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, signed
+}
+
+func TestSignedTx(t *testing.T) {
+	u, signed := signedTestTx(t)
+	if err := signed.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if signed.TxID() != u.Tx.TxHash() || signed.Size() != u.Tx.SerializeSize() {
+		t.Errorf("txid %v, size %d", signed.TxID(), signed.Size())
+	}
+	var buf bytes.Buffer
+	u.Tx.Serialize(&buf)
+	if !bytes.Equal(signed.Bytes(), buf.Bytes()) {
+		t.Error("wrong serialization")
+	}
+
+	// The accessors return copies.
+	signed.Bytes()[0] ^= 1
+	tx := signed.MsgTx()
+	tx.TxOut[0].Value++
+	tx.TxIn[0].SignatureScript[0] ^= 1
+	if err := signed.Verify(); err != nil || signed.MsgTx().TxHash() != signed.TxID() {
+		t.Errorf("copies mutated the transaction: %v", err)
+	}
+}
+
+func TestSignedTxMutated(t *testing.T) {
+	for _, test := range []struct {
+		field  string
+		mutate func(tx *wire.MsgTx)
+	}{
+		{"version", func(tx *wire.MsgTx) { tx.Version++ }},
+		{"lock time", func(tx *wire.MsgTx) { tx.LockTime = 1 }},
+		{"input count", func(tx *wire.MsgTx) { tx.TxIn = tx.TxIn[:1] }},
+		{"outpoint of input 0", func(tx *wire.MsgTx) { tx.TxIn[0], tx.TxIn[1] = tx.TxIn[1], tx.TxIn[0] }},
+		{"scriptSig of input 1", func(tx *wire.MsgTx) { tx.TxIn[1].SignatureScript = nil }},
+		{"sequence of input 0", func(tx *wire.MsgTx) { tx.TxIn[0].Sequence = 0 }},
+		{"output count", func(tx *wire.MsgTx) { tx.TxOut = append(tx.TxOut, tx.TxOut[0]) }},
+		{"value of output 0", func(tx *wire.MsgTx) { tx.TxOut[0].Value-- }},
+		{"script of output 0", func(tx *wire.MsgTx) { tx.TxOut[0].PkScript = []byte{0x51} }},
+	} {
+		u, signed := signedTestTx(t)
+		want := signed.Bytes()
+		test.mutate(u.Tx)
+		err := signed.Verify()
+		if !errors.Is(err, ErrSignedTxMutated) || !strings.Contains(err.Error(), test.field+" differs") {
+			t.Errorf("%s: got %v", test.field, err)
+		}
+		if !bytes.Equal(signed.Bytes(), want) {
+			t.Errorf("%s: snapshot mutated", test.field)
+		}
+	}
+}
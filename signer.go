@@ -0,0 +1,138 @@
+package bchutil
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// SignerOpts are the options of a signing operation.
+type SignerOpts struct {
+	// Schnorr requests a 64 byte Schnorr signature instead of a DER
+	// encoded ECDSA signature.
+	Schnorr bool
+
+	// ExtraEntropy, when not nil, is mixed into the RFC 6979 nonce as
+	// WithExtraEntropy does.
+	ExtraEntropy *[32]byte
+}
+
+// Signer signs digests with a key it may not reveal, such as the key of a
+// hardware wallet.
+type Signer interface {
+	// PubKey returns the public key of the signer.
+	PubKey() *btcec.PublicKey
+
+	// SignDigest returns the signature of a 32 byte digest, without sighash
+	// type.  opts may be nil for the defaults.
+	SignDigest(digest []byte, opts *SignerOpts) ([]byte, error)
+}
+
+// AntiKleptoSigner is implemented by signers supporting the anti-klepto
+// protocol, in which the host contributes randomness to the nonce so that a
+// malicious signer can't leak its key through nonce choice.  See
+// SignAntiKlepto for the host side.
+type AntiKleptoSigner interface {
+	Signer
+
+	// CommitNonce returns the commitment of the signer to its nonce for
+	// the challenge: the compressed point R0 before the host tweak.
+	CommitNonce(challenge *NonceCommitmentChallenge, opts *SignerOpts) ([]byte, error)
+
+	// SignWithHostNonce signs the digest of the challenge with the nonce
+	// committed to by CommitNonce tweaked by hostNonce.
+	SignWithHostNonce(challenge *NonceCommitmentChallenge, hostNonce [32]byte,
+		opts *SignerOpts) ([]byte, error)
+}
+
+// PrivKeySigner is a Signer holding a private key in memory.
+type PrivKeySigner struct {
+	Key *btcec.PrivateKey
+}
+
+// NewPrivKeySigner returns a Signer for key.
+func NewPrivKeySigner(key *btcec.PrivateKey) *PrivKeySigner {
+	return &PrivKeySigner{Key: key}
+}
+
+// PubKey returns the public key of the signer.
+func (s *PrivKeySigner) PubKey() *btcec.PublicKey {
+	return s.Key.PubKey()
+}
+
+// SignDigest signs digest with the deterministic RFC 6979 nonce.
+func (s *PrivKeySigner) SignDigest(digest []byte, opts *SignerOpts) ([]byte, error) {
+	return signDigest(s.Key.D, s.Key.PubKey(), digest, opts)
+}
+
+// signDigest signs digest with the key d of pubKey as selected by opts.  It
+// works on d in place and wipes the nonce it derives.
+func signDigest(d *big.Int, pubKey *btcec.PublicKey, digest []byte, opts *SignerOpts) ([]byte, error) {
+	if len(digest) != 32 {
+		return nil, errors.New("digest must be 32 bytes")
+	}
+	if opts == nil {
+		opts = &SignerOpts{}
+	}
+	var entropy []byte
+	if opts.ExtraEntropy != nil && *opts.ExtraEntropy != ([32]byte{}) {
+		entropy = opts.ExtraEntropy[:]
+	}
+	if opts.Schnorr {
+		return signSchnorr(d, pubKey, digest, entropy)
+	}
+	k := nonceRFC6979(d, digest, entropy)
+	defer zeroScalar(k)
+	sig := signECDSAWithNonce(d, digest, k)
+	if sig == nil {
+		return nil, errors.New("invalid nonce")
+	}
+	return sig.Serialize(), nil
+}
+
+// CommitNonce implements AntiKleptoSigner.  The untweaked nonce is derived
+// with RFC 6979 with the host commitment as extra entropy, so the signer
+// doesn't need to keep state between the two rounds.
+func (s *PrivKeySigner) CommitNonce(challenge *NonceCommitmentChallenge, opts *SignerOpts) ([]byte, error) {
+	k0 := s.committedNonce(challenge, opts)
+	x, y := btcec.S256().ScalarBaseMult(k0.Bytes())
+	return (&btcec.PublicKey{Curve: btcec.S256(), X: x, Y: y}).SerializeCompressed(), nil
+}
+
+// SignWithHostNonce implements AntiKleptoSigner.
+func (s *PrivKeySigner) SignWithHostNonce(challenge *NonceCommitmentChallenge, hostNonce [32]byte,
+	opts *SignerOpts) ([]byte, error) {
+
+	if hostCommitment(hostNonce) != challenge.HostCommitment {
+		return nil, errors.New("host nonce does not match its commitment")
+	}
+	commitment, err := s.CommitNonce(challenge, opts)
+	if err != nil {
+		return nil, err
+	}
+	k := s.committedNonce(challenge, opts)
+	k.Add(k, nonceTweak(commitment, hostNonce))
+	k.Mod(k, btcec.S256().N)
+	if k.Sign() == 0 {
+		return nil, errors.New("invalid tweaked nonce")
+	}
+
+	if opts != nil && opts.Schnorr {
+		return signSchnorrWithNonce(s.Key.D, s.Key.PubKey(), challenge.SigHash, k), nil
+	}
+	sig := signECDSAWithNonce(s.Key.D, challenge.SigHash, k)
+	if sig == nil {
+		return nil, errors.New("invalid tweaked nonce")
+	}
+	return sig.Serialize(), nil
+}
+
+// committedNonce returns the untweaked nonce of a challenge.
+func (s *PrivKeySigner) committedNonce(challenge *NonceCommitmentChallenge, opts *SignerOpts) *big.Int {
+	extra := challenge.HostCommitment[:]
+	if opts != nil && opts.Schnorr {
+		extra = append(append([]byte(nil), extra...), schnorrAlgo...)
+	}
+	return nonceRFC6979(s.Key.D, challenge.SigHash, extra)
+}
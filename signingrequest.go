@@ -0,0 +1,659 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// signingFormatVersion is the version of the binary and JSON
+	// serializations of signing requests and responses.
+	signingFormatVersion = 1
+
+	// maxSigningPaths bounds the number of derivation paths of an input
+	// when decoding, to reject garbage early.
+	maxSigningPaths = 20
+)
+
+var (
+	// signingRequestMagic and signingResponseMagic prefix the binary
+	// serializations.
+	signingRequestMagic  = []byte("BSRQ")
+	signingResponseMagic = []byte("BSRS")
+)
+
+var (
+	// ErrTxIDMismatch describes an error where a signing response is for
+	// another transaction than the one it is applied to.
+	ErrTxIDMismatch = errors.New("signing response is for another transaction")
+
+	// ErrInvalidSigningRequest describes an error where a signing request
+	// is malformed or inconsistent with its transaction.
+	ErrInvalidSigningRequest = errors.New("invalid signing request")
+
+	// ErrInvalidSigningResponse describes an error where a signing response
+	// is malformed or does not match the request it answers.
+	ErrInvalidSigningResponse = errors.New("invalid signing response")
+)
+
+// SigningInput describes the output spent by an input of a SigningRequest.
+type SigningInput struct {
+	PkScript []byte
+	Amount   btcutil.Amount
+
+	// TokenData is the serialized CashTokens prefix of the spent output,
+	// if any.
+	TokenData []byte
+
+	// RedeemScript is the redeem script of pay-to-script-hash outputs.
+	RedeemScript []byte
+
+	// Paths are the derivation paths, from the master key of the signer,
+	// of the keys expected to sign the input.
+	Paths []Path
+
+	HashType txscript.SigHashType
+}
+
+// scriptCode returns the script committed to by the signatures of the input.
+func (in *SigningInput) scriptCode() []byte {
+	if len(in.RedeemScript) != 0 {
+		return in.RedeemScript
+	}
+	return in.PkScript
+}
+
+// SigningRequest is sent by an online coordinator to an offline signer.  It
+// carries everything needed to sign Tx without access to the chain.
+type SigningRequest struct {
+	Tx *wire.MsgTx
+
+	// Inputs describe the outputs spent by the inputs of Tx, in order.
+	Inputs []SigningInput
+}
+
+// InputSignature is the signature of an input by one key.  Signature
+// includes the trailing sighash type byte.
+type InputSignature struct {
+	Index     uint32
+	PubKey    []byte
+	Signature []byte
+}
+
+// InputScript is a complete scriptSig for an input, returned by signers which
+// know how to assemble it.
+type InputScript struct {
+	Index     uint32
+	ScriptSig []byte
+}
+
+// SigningResponse is returned by an offline signer for a SigningRequest.
+type SigningResponse struct {
+	// TxID is the hash of the unsigned transaction of the request.
+	TxID chainhash.Hash
+
+	Signatures []InputSignature
+	ScriptSigs []InputScript
+}
+
+// Validate checks that the request is consistent with its transaction.
+func (r *SigningRequest) Validate() error {
+	if r.Tx == nil {
+		return fmt.Errorf("%w: no transaction", ErrInvalidSigningRequest)
+	}
+	if len(r.Inputs) != len(r.Tx.TxIn) {
+		return fmt.Errorf("%w: %d inputs described for %d transaction inputs",
+			ErrInvalidSigningRequest, len(r.Inputs), len(r.Tx.TxIn))
+	}
+	for i, txIn := range r.Tx.TxIn {
+		in := &r.Inputs[i]
+		if len(txIn.SignatureScript) != 0 {
+			return fmt.Errorf("%w: input %d is already signed", ErrInvalidSigningRequest, i)
+		}
+		if err := CheckAmount(in.Amount); err != nil {
+			return fmt.Errorf("%w: input %d: %v", ErrInvalidSigningRequest, i, err)
+		}
+		if in.HashType&SigHashForkID == 0 {
+			return fmt.Errorf("%w: input %d sighash type lacks SIGHASH_FORKID",
+				ErrInvalidSigningRequest, i)
+		}
+		if err := checkSigHashType(in.HashType); err != nil {
+			return fmt.Errorf("%w: input %d: %v", ErrInvalidSigningRequest, i, err)
+		}
+		if len(in.RedeemScript) != 0 {
+			want, _ := payToScriptHashScript(btcutil.Hash160(in.RedeemScript))
+			if !bytes.Equal(in.PkScript, want) {
+				return fmt.Errorf("%w: input %d redeem script does not match its output",
+					ErrInvalidSigningRequest, i)
+			}
+		}
+	}
+	return nil
+}
+
+// SigHash returns the digest the signatures of input idx commit to, including
+// the tokens of the spent output.
+func (r *SigningRequest) SigHash(idx int) ([]byte, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	if idx < 0 || idx >= len(r.Inputs) {
+		return nil, fmt.Errorf("input index %d out of range", idx)
+	}
+	in := &r.Inputs[idx]
+	return calcSignatureHash(in.scriptCode(), txscript.NewTxSigHashes(r.Tx),
+		in.HashType, r.Tx, idx, int64(in.Amount), 0, in.TokenData), nil
+}
+
+// ValidateResponse checks that resp answers the request: the transaction IDs
+// must match, and every signature must be valid for its input with the
+// requested sighash type.  Returned scriptSigs are not checked.
+func (r *SigningRequest) ValidateResponse(resp *SigningResponse) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if resp.TxID != r.Tx.TxHash() {
+		return ErrTxIDMismatch
+	}
+
+	sigHashes := txscript.NewTxSigHashes(r.Tx)
+	for _, s := range resp.Signatures {
+		if int(s.Index) >= len(r.Inputs) {
+			return fmt.Errorf("%w: input index %d out of range", ErrInvalidSigningResponse, s.Index)
+		}
+		in := &r.Inputs[s.Index]
+		if len(s.Signature) == 0 ||
+			txscript.SigHashType(s.Signature[len(s.Signature)-1]) != in.HashType {
+			return fmt.Errorf("%w: input %d signature has the wrong sighash type",
+				ErrInvalidSigningResponse, s.Index)
+		}
+		pubKey, err := btcec.ParsePubKey(s.PubKey, btcec.S256())
+		if err != nil {
+			return fmt.Errorf("%w: input %d: %v", ErrInvalidSigningResponse, s.Index, err)
+		}
+		sig, err := btcec.ParseDERSignature(s.Signature[:len(s.Signature)-1], btcec.S256())
+		if err != nil {
+			return fmt.Errorf("%w: input %d: %v", ErrInvalidSigningResponse, s.Index, err)
+		}
+		hash := calcSignatureHash(in.scriptCode(), sigHashes, in.HashType,
+			r.Tx, int(s.Index), int64(in.Amount), 0, in.TokenData)
+		if !sig.Verify(hash, pubKey) {
+			return fmt.Errorf("%w: input %d signature does not verify",
+				ErrInvalidSigningResponse, s.Index)
+		}
+	}
+	for _, s := range resp.ScriptSigs {
+		if int(s.Index) >= len(r.Inputs) {
+			return fmt.Errorf("%w: input index %d out of range", ErrInvalidSigningResponse, s.Index)
+		}
+	}
+	return nil
+}
+
+// ApplyResponse returns a copy of the unsigned transaction tx with the
+// scriptSigs of resp.  Inputs with a full scriptSig in the response use it;
+// inputs with a single signature get a pay-to-pubkey-hash scriptSig.  The
+// transaction ID of resp is checked before anything is applied.
+func ApplyResponse(tx *wire.MsgTx, resp *SigningResponse) (*wire.MsgTx, error) {
+	if resp.TxID != tx.TxHash() {
+		return nil, ErrTxIDMismatch
+	}
+
+	scriptSigs := make(map[uint32][]byte)
+	for _, s := range resp.ScriptSigs {
+		scriptSigs[s.Index] = s.ScriptSig
+	}
+	signatures := make(map[uint32][]InputSignature)
+	for _, s := range resp.Signatures {
+		signatures[s.Index] = append(signatures[s.Index], s)
+	}
+
+	signed := tx.Copy()
+	for i, txIn := range signed.TxIn {
+		idx := uint32(i)
+		if scriptSig, ok := scriptSigs[idx]; ok {
+			txIn.SignatureScript = scriptSig
+			continue
+		}
+		sigs := signatures[idx]
+		switch len(sigs) {
+		case 0:
+			continue
+		case 1:
+			scriptSig, err := txscript.NewScriptBuilder().
+				AddData(sigs[0].Signature).AddData(sigs[0].PubKey).Script()
+			if err != nil {
+				return nil, err
+			}
+			txIn.SignatureScript = scriptSig
+		default:
+			return nil, fmt.Errorf("%w: input %d has several signatures but no scriptSig",
+				ErrInvalidSigningResponse, i)
+		}
+	}
+	for idx := range scriptSigs {
+		if int(idx) >= len(signed.TxIn) {
+			return nil, fmt.Errorf("%w: input index %d out of range", ErrInvalidSigningResponse, idx)
+		}
+	}
+	for idx := range signatures {
+		if int(idx) >= len(signed.TxIn) {
+			return nil, fmt.Errorf("%w: input index %d out of range", ErrInvalidSigningResponse, idx)
+		}
+	}
+	return signed, nil
+}
+
+// sorted returns a copy of the response with its entries ordered by input
+// index and public key, so that its serializations are deterministic.
+func (r *SigningResponse) sorted() *SigningResponse {
+	c := &SigningResponse{
+		TxID:       r.TxID,
+		Signatures: append([]InputSignature(nil), r.Signatures...),
+		ScriptSigs: append([]InputScript(nil), r.ScriptSigs...),
+	}
+	sort.SliceStable(c.Signatures, func(i, j int) bool {
+		a, b := c.Signatures[i], c.Signatures[j]
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return bytes.Compare(a.PubKey, b.PubKey) < 0
+	})
+	sort.SliceStable(c.ScriptSigs, func(i, j int) bool {
+		return c.ScriptSigs[i].Index < c.ScriptSigs[j].Index
+	})
+	return c
+}
+
+// MarshalBinary returns the binary serialization of the request.
+func (r *SigningRequest) MarshalBinary() ([]byte, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(signingRequestMagic)
+	buf.WriteByte(signingFormatVersion)
+	if err := r.Tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	for _, in := range r.Inputs {
+		wire.WriteVarBytes(&buf, 0, in.PkScript)
+		binary.Write(&buf, binary.LittleEndian, int64(in.Amount))
+		wire.WriteVarBytes(&buf, 0, in.TokenData)
+		wire.WriteVarBytes(&buf, 0, in.RedeemScript)
+		wire.WriteVarInt(&buf, 0, uint64(len(in.Paths)))
+		for _, path := range in.Paths {
+			wire.WriteVarInt(&buf, 0, uint64(len(path)))
+			for _, i := range path {
+				binary.Write(&buf, binary.LittleEndian, i)
+			}
+		}
+		binary.Write(&buf, binary.LittleEndian, uint32(in.HashType))
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a request serialized by MarshalBinary.
+func (r *SigningRequest) UnmarshalBinary(data []byte) error {
+	rd := bytes.NewReader(data)
+	if err := readSigningHeader(rd, signingRequestMagic); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSigningRequest, err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(rd); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSigningRequest, err)
+	}
+	inputs := make([]SigningInput, len(tx.TxIn))
+	for i := range inputs {
+		if err := readSigningInput(rd, &inputs[i]); err != nil {
+			return fmt.Errorf("%w: input %d: %v", ErrInvalidSigningRequest, i, err)
+		}
+	}
+	if rd.Len() != 0 {
+		return fmt.Errorf("%w: trailing data", ErrInvalidSigningRequest)
+	}
+	req := SigningRequest{Tx: tx, Inputs: inputs}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	*r = req
+	return nil
+}
+
+// readSigningHeader reads and checks the magic and version of a binary
+// serialization.
+func readSigningHeader(r io.Reader, magic []byte) error {
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	if !bytes.Equal(header[:len(magic)], magic) {
+		return errors.New("bad magic")
+	}
+	if header[len(magic)] != signingFormatVersion {
+		return fmt.Errorf("unknown version %d", header[len(magic)])
+	}
+	return nil
+}
+
+func readSigningInput(r io.Reader, in *SigningInput) error {
+	var err error
+	if in.PkScript, err = wire.ReadVarBytes(r, 0, wire.MaxMessagePayload, "pkScript"); err != nil {
+		return err
+	}
+	var amount int64
+	if err := binary.Read(r, binary.LittleEndian, &amount); err != nil {
+		return err
+	}
+	in.Amount = btcutil.Amount(amount)
+	if in.TokenData, err = wire.ReadVarBytes(r, 0, wire.MaxMessagePayload, "tokenData"); err != nil {
+		return err
+	}
+	if in.RedeemScript, err = wire.ReadVarBytes(r, 0, wire.MaxMessagePayload, "redeemScript"); err != nil {
+		return err
+	}
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	if count > maxSigningPaths {
+		return errors.New("too many derivation paths")
+	}
+	for i := uint64(0); i < count; i++ {
+		n, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return err
+		}
+		if n > 255 {
+			return errors.New("derivation path too long")
+		}
+		path := make(Path, n)
+		if err := binary.Read(r, binary.LittleEndian, path); err != nil {
+			return err
+		}
+		in.Paths = append(in.Paths, path)
+	}
+	var hashType uint32
+	if err := binary.Read(r, binary.LittleEndian, &hashType); err != nil {
+		return err
+	}
+	in.HashType = txscript.SigHashType(hashType)
+	if len(in.TokenData) == 0 {
+		in.TokenData = nil
+	}
+	if len(in.RedeemScript) == 0 {
+		in.RedeemScript = nil
+	}
+	return nil
+}
+
+// MarshalBinary returns the binary serialization of the response.  Entries
+// are written in input index and public key order.
+func (r *SigningResponse) MarshalBinary() ([]byte, error) {
+	r = r.sorted()
+	var buf bytes.Buffer
+	buf.Write(signingResponseMagic)
+	buf.WriteByte(signingFormatVersion)
+	buf.Write(r.TxID[:])
+	wire.WriteVarInt(&buf, 0, uint64(len(r.Signatures)))
+	for _, s := range r.Signatures {
+		binary.Write(&buf, binary.LittleEndian, s.Index)
+		wire.WriteVarBytes(&buf, 0, s.PubKey)
+		wire.WriteVarBytes(&buf, 0, s.Signature)
+	}
+	wire.WriteVarInt(&buf, 0, uint64(len(r.ScriptSigs)))
+	for _, s := range r.ScriptSigs {
+		binary.Write(&buf, binary.LittleEndian, s.Index)
+		wire.WriteVarBytes(&buf, 0, s.ScriptSig)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a response serialized by MarshalBinary.
+func (r *SigningResponse) UnmarshalBinary(data []byte) error {
+	rd := bytes.NewReader(data)
+	resp, err := readSigningResponse(rd)
+	if err == nil && rd.Len() != 0 {
+		err = errors.New("trailing data")
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSigningResponse, err)
+	}
+	*r = *resp
+	return nil
+}
+
+func readSigningResponse(r io.Reader) (*SigningResponse, error) {
+	if err := readSigningHeader(r, signingResponseMagic); err != nil {
+		return nil, err
+	}
+	resp := &SigningResponse{}
+	if _, err := io.ReadFull(r, resp.TxID[:]); err != nil {
+		return nil, err
+	}
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		var s InputSignature
+		if err := binary.Read(r, binary.LittleEndian, &s.Index); err != nil {
+			return nil, err
+		}
+		if s.PubKey, err = wire.ReadVarBytes(r, 0, btcec.PubKeyBytesLenUncompressed, "pubKey"); err != nil {
+			return nil, err
+		}
+		if s.Signature, err = wire.ReadVarBytes(r, 0, txscript.MaxScriptElementSize, "signature"); err != nil {
+			return nil, err
+		}
+		resp.Signatures = append(resp.Signatures, s)
+	}
+	count, err = wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		var s InputScript
+		if err := binary.Read(r, binary.LittleEndian, &s.Index); err != nil {
+			return nil, err
+		}
+		if s.ScriptSig, err = wire.ReadVarBytes(r, 0, txscript.MaxScriptSize, "scriptSig"); err != nil {
+			return nil, err
+		}
+		resp.ScriptSigs = append(resp.ScriptSigs, s)
+	}
+	return resp, nil
+}
+
+// jsonSigningInput is the JSON form of a SigningInput.
+type jsonSigningInput struct {
+	PkScript     string   `json:"pkScript"`
+	Amount       int64    `json:"amount"`
+	TokenData    string   `json:"tokenData,omitempty"`
+	RedeemScript string   `json:"redeemScript,omitempty"`
+	Paths        []string `json:"paths,omitempty"`
+	HashType     uint32   `json:"hashType"`
+}
+
+// jsonSigningRequest is the JSON form of a SigningRequest.
+type jsonSigningRequest struct {
+	Version int                `json:"version"`
+	Tx      string             `json:"tx"`
+	Inputs  []jsonSigningInput `json:"inputs"`
+}
+
+// MarshalJSON returns the JSON serialization of the request, with scripts and
+// the transaction hex encoded and paths in the format of
+// ParseDerivationPath.
+func (r *SigningRequest) MarshalJSON() ([]byte, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := r.Tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	j := jsonSigningRequest{
+		Version: signingFormatVersion,
+		Tx:      hex.EncodeToString(buf.Bytes()),
+		Inputs:  make([]jsonSigningInput, len(r.Inputs)),
+	}
+	for i, in := range r.Inputs {
+		ji := jsonSigningInput{
+			PkScript:     hex.EncodeToString(in.PkScript),
+			Amount:       int64(in.Amount),
+			TokenData:    hex.EncodeToString(in.TokenData),
+			RedeemScript: hex.EncodeToString(in.RedeemScript),
+			HashType:     uint32(in.HashType),
+		}
+		for _, path := range in.Paths {
+			ji.Paths = append(ji.Paths, path.String())
+		}
+		j.Inputs[i] = ji
+	}
+	return json.Marshal(&j)
+}
+
+// UnmarshalJSON decodes a request serialized by MarshalJSON.
+func (r *SigningRequest) UnmarshalJSON(data []byte) error {
+	var j jsonSigningRequest
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.Version != signingFormatVersion {
+		return fmt.Errorf("%w: unknown version %d", ErrInvalidSigningRequest, j.Version)
+	}
+	rawTx, err := hex.DecodeString(j.Tx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSigningRequest, err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(rawTx)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSigningRequest, err)
+	}
+
+	req := SigningRequest{Tx: tx, Inputs: make([]SigningInput, len(j.Inputs))}
+	for i, ji := range j.Inputs {
+		in := &req.Inputs[i]
+		in.Amount = btcutil.Amount(ji.Amount)
+		in.HashType = txscript.SigHashType(ji.HashType)
+		if in.PkScript, err = hex.DecodeString(ji.PkScript); err != nil {
+			return fmt.Errorf("%w: input %d: %v", ErrInvalidSigningRequest, i, err)
+		}
+		if in.TokenData, err = decodeOptionalHex(ji.TokenData); err != nil {
+			return fmt.Errorf("%w: input %d: %v", ErrInvalidSigningRequest, i, err)
+		}
+		if in.RedeemScript, err = decodeOptionalHex(ji.RedeemScript); err != nil {
+			return fmt.Errorf("%w: input %d: %v", ErrInvalidSigningRequest, i, err)
+		}
+		for _, s := range ji.Paths {
+			path, err := ParseDerivationPath(s)
+			if err != nil {
+				return fmt.Errorf("%w: input %d: %v", ErrInvalidSigningRequest, i, err)
+			}
+			in.Paths = append(in.Paths, path)
+		}
+	}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	*r = req
+	return nil
+}
+
+// decodeOptionalHex decodes a hex string, returning nil for an empty one.
+func decodeOptionalHex(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return hex.DecodeString(s)
+}
+
+// jsonInputSignature is the JSON form of an InputSignature.
+type jsonInputSignature struct {
+	Index     uint32 `json:"index"`
+	PubKey    string `json:"pubKey"`
+	Signature string `json:"signature"`
+}
+
+// jsonInputScript is the JSON form of an InputScript.
+type jsonInputScript struct {
+	Index     uint32 `json:"index"`
+	ScriptSig string `json:"scriptSig"`
+}
+
+// jsonSigningResponse is the JSON form of a SigningResponse.
+type jsonSigningResponse struct {
+	Version    int                  `json:"version"`
+	TxID       string               `json:"txid"`
+	Signatures []jsonInputSignature `json:"signatures,omitempty"`
+	ScriptSigs []jsonInputScript    `json:"scriptSigs,omitempty"`
+}
+
+// MarshalJSON returns the JSON serialization of the response.  Entries are
+// written in input index and public key order.
+func (r *SigningResponse) MarshalJSON() ([]byte, error) {
+	r = r.sorted()
+	j := jsonSigningResponse{Version: signingFormatVersion, TxID: r.TxID.String()}
+	for _, s := range r.Signatures {
+		j.Signatures = append(j.Signatures, jsonInputSignature{
+			Index:     s.Index,
+			PubKey:    hex.EncodeToString(s.PubKey),
+			Signature: hex.EncodeToString(s.Signature),
+		})
+	}
+	for _, s := range r.ScriptSigs {
+		j.ScriptSigs = append(j.ScriptSigs, jsonInputScript{
+			Index:     s.Index,
+			ScriptSig: hex.EncodeToString(s.ScriptSig),
+		})
+	}
+	return json.Marshal(&j)
+}
+
+// UnmarshalJSON decodes a response serialized by MarshalJSON.
+func (r *SigningResponse) UnmarshalJSON(data []byte) error {
+	var j jsonSigningResponse
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.Version != signingFormatVersion {
+		return fmt.Errorf("%w: unknown version %d", ErrInvalidSigningResponse, j.Version)
+	}
+	txid, err := chainhash.NewHashFromStr(j.TxID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSigningResponse, err)
+	}
+	resp := SigningResponse{TxID: *txid}
+	for _, js := range j.Signatures {
+		s := InputSignature{Index: js.Index}
+		if s.PubKey, err = hex.DecodeString(js.PubKey); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSigningResponse, err)
+		}
+		if s.Signature, err = hex.DecodeString(js.Signature); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSigningResponse, err)
+		}
+		resp.Signatures = append(resp.Signatures, s)
+	}
+	for _, js := range j.ScriptSigs {
+		s := InputScript{Index: js.Index}
+		if s.ScriptSig, err = hex.DecodeString(js.ScriptSig); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSigningResponse, err)
+		}
+		resp.ScriptSigs = append(resp.ScriptSigs, s)
+	}
+	*r = resp
+	return nil
+}
@@ -0,0 +1,206 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// signingTestRequest returns a request spending two pay-to-pubkey-hash
+// outputs of keys, one with SIGHASH_ALL and one with SIGHASH_SINGLE.
+func signingTestRequest(keys []*btcec.PrivateKey) *SigningRequest {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	req := &SigningRequest{Tx: tx}
+	hashTypes := []txscript.SigHashType{
+		txscript.SigHashAll | SigHashForkID,
+		txscript.SigHashSingle | SigHashForkID,
+	}
+	for i, key := range keys {
+		pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+		op := wire.NewOutPoint(&chainhash.Hash{byte(i + 1)}, uint32(i))
+		tx.AddTxIn(wire.NewTxIn(op, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(int64(1000*(i+1)), pkScript))
+		req.Inputs = append(req.Inputs, SigningInput{
+			PkScript: pkScript,
+			Amount:   btcutil.Amount(5000 * (i + 1)),
+			Paths:    []Path{BIP44Path(0, 0, uint32(i))},
+			HashType: hashTypes[i],
+		})
+	}
+	return req
+}
+
+// signRequest signs every input of req with the key of the same index.
+func signRequest(t *testing.T, req *SigningRequest, keys []*btcec.PrivateKey) *SigningResponse {
+	resp := &SigningResponse{TxID: req.Tx.TxHash()}
+	for i, in := range req.Inputs {
+		sig, err := RawTxInSignature(req.Tx, i, in.PkScript, in.HashType, keys[i], int64(in.Amount),
+			AllowDangerousSigHash(in.HashType))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Signatures = append(resp.Signatures, InputSignature{
+			Index:     uint32(i),
+			PubKey:    keys[i].PubKey().SerializeCompressed(),
+			Signature: sig,
+		})
+	}
+	return resp
+}
+
+// signingRequestsEqual compares requests, treating empty and nil scripts of
+// the transactions as equal.
+func signingRequestsEqual(a, b *SigningRequest) bool {
+	return a.Tx.TxHash() == b.Tx.TxHash() && reflect.DeepEqual(a.Inputs, b.Inputs)
+}
+
+func signingTestKeys() []*btcec.PrivateKey {
+	a, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x01})
+	b, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x02})
+	return []*btcec.PrivateKey{a, b}
+}
+
+func TestSigningRoundTrip(t *testing.T) {
+	keys := signingTestKeys()
+	req := signingTestRequest(keys)
+
+	// The signer only sees the serialized request.
+	data, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received SigningRequest
+	if err := received.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !signingRequestsEqual(&received, req) {
+		t.Fatal("binary round trip changed the request")
+	}
+	resp := signRequest(t, &received, keys)
+
+	// Signatures are serialized in input order whatever their order in the
+	// response.
+	swapped := *resp
+	swapped.Signatures = []InputSignature{resp.Signatures[1], resp.Signatures[0]}
+	a, _ := resp.MarshalBinary()
+	b, _ := swapped.MarshalBinary()
+	if !bytes.Equal(a, b) {
+		t.Error("binary serialization is not deterministic")
+	}
+	var decoded SigningResponse
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, resp) {
+		t.Error("binary round trip changed the response")
+	}
+
+	if err := req.ValidateResponse(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := ApplyResponse(req.Tx, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, txIn := range signed.TxIn {
+		pushes, err := txscript.PushedData(txIn.SignatureScript)
+		if err != nil || len(pushes) != 2 {
+			t.Fatalf("input %d: bad scriptSig %x", i, txIn.SignatureScript)
+		}
+		if !bytes.Equal(pushes[1], keys[i].PubKey().SerializeCompressed()) {
+			t.Errorf("input %d: scriptSig has the wrong public key", i)
+		}
+	}
+	if len(req.Tx.TxIn[0].SignatureScript) != 0 {
+		t.Error("ApplyResponse modified the unsigned transaction")
+	}
+}
+
+func TestSigningJSON(t *testing.T) {
+	keys := signingTestKeys()
+	req := signingTestRequest(keys)
+	req.Inputs[1].TokenData = []byte{0xef, 0x01}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded SigningRequest
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !signingRequestsEqual(&decoded, req) {
+		t.Errorf("JSON round trip changed the request: %s", data)
+	}
+	again, _ := json.Marshal(&decoded)
+	if !bytes.Equal(again, data) {
+		t.Error("JSON serialization is not deterministic")
+	}
+
+	resp := signRequest(t, req, keys)
+	resp.ScriptSigs = []InputScript{{Index: 1, ScriptSig: []byte{txscript.OP_TRUE}}}
+	data, err = json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decodedResp SigningResponse
+	if err := json.Unmarshal(data, &decodedResp); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decodedResp, resp) {
+		t.Errorf("JSON round trip changed the response: %s", data)
+	}
+	signed, err := ApplyResponse(req.Tx, &decodedResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(signed.TxIn[1].SignatureScript, []byte{txscript.OP_TRUE}) {
+		t.Error("full scriptSig was not preferred over the signature")
+	}
+}
+
+func TestSigningValidate(t *testing.T) {
+	keys := signingTestKeys()
+	req := signingTestRequest(keys)
+	resp := signRequest(t, req, keys)
+
+	// A change to the transaction after signing changes its ID.
+	other := req.Tx.Copy()
+	other.TxOut[0].Value++
+	if _, err := ApplyResponse(other, resp); err != ErrTxIDMismatch {
+		t.Errorf("expected ErrTxIDMismatch, got %v", err)
+	}
+	modified := &SigningRequest{Tx: other, Inputs: req.Inputs}
+	if err := modified.ValidateResponse(resp); err != ErrTxIDMismatch {
+		t.Errorf("expected ErrTxIDMismatch, got %v", err)
+	}
+
+	// A signature with another amount does not verify.
+	req.Inputs[0].Amount++
+	if err := req.ValidateResponse(resp); !errors.Is(err, ErrInvalidSigningResponse) {
+		t.Errorf("expected ErrInvalidSigningResponse, got %v", err)
+	}
+	req.Inputs[0].Amount--
+
+	resp.Signatures[1].Index = 5
+	if err := req.ValidateResponse(resp); !errors.Is(err, ErrInvalidSigningResponse) {
+		t.Errorf("expected ErrInvalidSigningResponse, got %v", err)
+	}
+
+	req.Inputs[0].HashType = txscript.SigHashAll
+	if err := req.Validate(); !errors.Is(err, ErrInvalidSigningRequest) {
+		t.Errorf("expected ErrInvalidSigningRequest, got %v", err)
+	}
+	req.Inputs = req.Inputs[:1]
+	if err := req.Validate(); !errors.Is(err, ErrInvalidSigningRequest) {
+		t.Errorf("expected ErrInvalidSigningRequest, got %v", err)
+	}
+}
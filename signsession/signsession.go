@@ -0,0 +1,512 @@
+// Package signsession coordinates the signing of a transaction by several
+// parties, such as the cosigners of m-of-n multisig outputs held across
+// organizations.
+//
+// A Session tracks one unsigned transaction, the outputs its inputs spend,
+// the public keys of the parties expected to sign and the signatures
+// collected so far.  Its compact binary serialization is passed between the
+// parties, over email or an API, and each party returns its signatures as the
+// binary serialization of a bchutil.SigningResponse, which the coordinator
+// adds to the session once checked against its transaction.  The transaction
+// is finalized once the signatures of every input meet its threshold.
+package signsession
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// formatVersion is the version of the binary serialization of sessions.
+	formatVersion = 1
+
+	// maxSigners bounds the number of signers of a session when decoding,
+	// to reject garbage early.
+	maxSigners = 1000
+)
+
+// sessionMagic prefixes the binary serialization of sessions.
+var sessionMagic = []byte("BSSN")
+
+var (
+	// ErrInvalidSession describes an error where a session is malformed or
+	// its inputs cannot be signed by its signers.
+	ErrInvalidSession = errors.New("invalid signing session")
+
+	// ErrInvalidSignature describes an error where a contribution holds a
+	// signature that is not valid for its input, or made by a key that is
+	// not expected to sign it.
+	ErrInvalidSignature = errors.New("invalid partial signature")
+
+	// ErrIncomplete describes an error where a session is finalized before
+	// the signatures of all its inputs meet their threshold.
+	ErrIncomplete = errors.New("signatures missing")
+)
+
+// Input describes the output spent by an input of a session.
+type Input struct {
+	// PrevOut is the output spent, whose script may start with a token
+	// prefix: a pay-to-pubkey-hash script, or a pay-to-script-hash script
+	// with a 20 or 32 bytes hash.
+	PrevOut *wire.TxOut
+
+	// RedeemScript is the multisig redeem script of pay-to-script-hash
+	// outputs.
+	RedeemScript []byte
+}
+
+// input is an Input resolved for signing.
+type input struct {
+	Input
+
+	// scriptCode is the script committed to by signatures, and token the
+	// tokens of the output spent, nil if none.
+	scriptCode []byte
+	token      *bchutil.TokenData
+
+	// pubKeys are the keys of the input expected to sign, in script order,
+	// of which required must sign.
+	pubKeys  [][]byte
+	required int
+	multisig bool
+}
+
+// Session tracks the signatures of an unsigned transaction.  Signatures are
+// of sighash type SIGHASH_ALL|SIGHASH_FORKID, which commits to the whole
+// transaction.
+type Session struct {
+	tx      *wire.MsgTx
+	inputs  []input
+	signers [][]byte
+
+	// sigs are the signatures collected, by input and public key.
+	sigs []map[string][]byte
+}
+
+// NewSession returns the session of unsignedTx, whose inputs spend prevOuts,
+// in order, signed by requiredSigners, serialized public keys.  Each input is
+// signed by the keys of requiredSigners among the keys of its script, which
+// must be enough to meet its threshold; other keys of the scripts never sign.
+func NewSession(unsignedTx *wire.MsgTx, prevOuts []Input, requiredSigners [][]byte) (*Session, error) {
+	s := &Session{tx: unsignedTx.Copy(), sigs: make([]map[string][]byte, len(unsignedTx.TxIn))}
+	if len(prevOuts) != len(s.tx.TxIn) {
+		return nil, fmt.Errorf("%w: %d previous outputs for %d inputs", ErrInvalidSession, len(prevOuts),
+			len(s.tx.TxIn))
+	}
+	for _, pubKey := range requiredSigners {
+		if _, err := btcec.ParsePubKey(pubKey, btcec.S256()); err != nil {
+			return nil, fmt.Errorf("%w: signer %x: %v", ErrInvalidSession, pubKey, err)
+		}
+		if containsKey(s.signers, pubKey) {
+			return nil, fmt.Errorf("%w: signer %x listed twice", ErrInvalidSession, pubKey)
+		}
+		s.signers = append(s.signers, append([]byte(nil), pubKey...))
+	}
+	for i, txIn := range s.tx.TxIn {
+		if len(txIn.SignatureScript) != 0 {
+			return nil, fmt.Errorf("%w: input %d is already signed", ErrInvalidSession, i)
+		}
+		in, err := resolveInput(prevOuts[i], s.signers)
+		if err != nil {
+			return nil, fmt.Errorf("%w: input %d: %v", ErrInvalidSession, i, err)
+		}
+		s.inputs = append(s.inputs, in)
+		s.sigs[i] = make(map[string][]byte)
+	}
+	return s, nil
+}
+
+// resolveInput returns the input spending in, signed by the keys of signers.
+func resolveInput(in Input, signers [][]byte) (input, error) {
+	r := input{Input: in}
+	if in.PrevOut == nil {
+		return r, errors.New("no previous output")
+	}
+	if err := bchutil.CheckAmount(btcutil.Amount(in.PrevOut.Value)); err != nil {
+		return r, err
+	}
+	token, pkScript, err := bchutil.SplitTokenPrefix(in.PrevOut.PkScript)
+	if err != nil {
+		return r, err
+	}
+	r.token = token
+
+	var scriptKeys [][]byte
+	switch class := bchutil.GetScriptClass(pkScript); class {
+	case txscript.PubKeyHashTy:
+		r.scriptCode, r.required = pkScript, 1
+		for _, pubKey := range signers {
+			if bytes.Equal(btcutil.Hash160(pubKey), pkScript[3:23]) {
+				scriptKeys = append(scriptKeys, pubKey)
+			}
+		}
+	case txscript.ScriptHashTy:
+		if !redeems(in.RedeemScript, pkScript) {
+			return r, errors.New("redeem script does not match the script hash")
+		}
+		_, addrs, required, err := txscript.ExtractPkScriptAddrs(in.RedeemScript, &chaincfg.MainNetParams)
+		if err != nil || txscript.GetScriptClass(in.RedeemScript) != txscript.MultiSigTy {
+			return r, errors.New("redeem script is not multisig")
+		}
+		r.scriptCode, r.required, r.multisig = in.RedeemScript, required, true
+		for _, addr := range addrs {
+			scriptKeys = append(scriptKeys, addr.ScriptAddress())
+		}
+	default:
+		return r, fmt.Errorf("cannot sign %v scripts", class)
+	}
+	for _, pubKey := range scriptKeys {
+		if containsKey(signers, pubKey) {
+			r.pubKeys = append(r.pubKeys, pubKey)
+		}
+	}
+	if len(r.pubKeys) < r.required {
+		return r, fmt.Errorf("%d of the signers sign, %d required", len(r.pubKeys), r.required)
+	}
+	return r, nil
+}
+
+// redeems returns whether pkScript pays to the 20 or 32 bytes hash of
+// redeemScript.
+func redeems(redeemScript, pkScript []byte) bool {
+	var addr btcutil.Address
+	var err error
+	if len(pkScript) == 35 {
+		addr, err = bchutil.NewCashAddressScriptHash32(redeemScript, &chaincfg.MainNetParams)
+	} else {
+		addr, err = bchutil.NewCashAddressScriptHash(redeemScript, &chaincfg.MainNetParams)
+	}
+	if err != nil {
+		return false
+	}
+	script, err := bchutil.PayToAddrScript(addr)
+	return err == nil && bytes.Equal(script, pkScript)
+}
+
+// Tx returns the unsigned transaction of the session.
+func (s *Session) Tx() *wire.MsgTx {
+	return s.tx.Copy()
+}
+
+// TxID returns the hash of the unsigned transaction of the session, to which
+// contributions refer.
+func (s *Session) TxID() chainhash.Hash {
+	return s.tx.TxHash()
+}
+
+// sigHash returns the digest signed by the signatures of input idx.
+func (s *Session) sigHash(idx int) []byte {
+	in := &s.inputs[idx]
+	var opts []bchutil.SignOption
+	if in.token != nil {
+		opts = append(opts, bchutil.WithTokenPrevout(in.token))
+	}
+	hash, _ := bchutil.CalcSignatureHash(in.scriptCode, bchutil.SigHashAllForkID, s.tx, idx, in.PrevOut.Value,
+		opts...)
+	return hash
+}
+
+// Sign signs the inputs of the session that key is expected to sign, adds the
+// signatures to the session and returns them, as the binary serialization of
+// a bchutil.SigningResponse to send to the coordinator.  The options are
+// those of bchutil.SignInput.
+func (s *Session) Sign(key *btcec.PrivateKey, opts ...bchutil.SignOption) ([]byte, error) {
+	pubKey := key.PubKey().SerializeCompressed()
+	resp := &bchutil.SigningResponse{TxID: s.TxID()}
+	for i := range s.inputs {
+		in := &s.inputs[i]
+		if !containsKey(in.pubKeys, pubKey) {
+			continue
+		}
+		signOpts := opts
+		if in.token != nil {
+			signOpts = append(append([]bchutil.SignOption(nil), opts...), bchutil.WithTokenPrevout(in.token))
+		}
+		sig, err := bchutil.SignInput(s.tx, i, in.scriptCode, bchutil.SigHashAllForkID, key, in.PrevOut.Value,
+			signOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		resp.Signatures = append(resp.Signatures, bchutil.InputSignature{Index: uint32(i), PubKey: pubKey,
+			Signature: sig})
+	}
+	if len(resp.Signatures) == 0 {
+		return nil, fmt.Errorf("key %x signs no input of the session", pubKey)
+	}
+	if err := s.addSignatures(resp.Signatures); err != nil {
+		return nil, err
+	}
+	return resp.MarshalBinary()
+}
+
+// containsKey returns whether pubKeys holds pubKey.
+func containsKey(pubKeys [][]byte, pubKey []byte) bool {
+	for _, k := range pubKeys {
+		if bytes.Equal(k, pubKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddPartialSignatures adds the signatures of blob, the binary serialization
+// of a bchutil.SigningResponse returned by Sign.  Contributions for another
+// transaction fail with bchutil.ErrTxIDMismatch, and contributions holding
+// signatures of keys not expected to sign their input, or not valid for it,
+// with ErrInvalidSignature; nothing is added on errors.
+func (s *Session) AddPartialSignatures(blob []byte) error {
+	var resp bchutil.SigningResponse
+	if err := resp.UnmarshalBinary(blob); err != nil {
+		return err
+	}
+	if resp.TxID != s.TxID() {
+		return fmt.Errorf("%w: contribution for %v, session of %v", bchutil.ErrTxIDMismatch, resp.TxID,
+			s.TxID())
+	}
+	if len(resp.ScriptSigs) != 0 {
+		return fmt.Errorf("%w: contribution carries scriptSigs", ErrInvalidSignature)
+	}
+	return s.addSignatures(resp.Signatures)
+}
+
+// addSignatures checks sigs and adds them, all or none.
+func (s *Session) addSignatures(sigs []bchutil.InputSignature) error {
+	for _, sig := range sigs {
+		if err := s.checkSignature(sig); err != nil {
+			return err
+		}
+	}
+	for _, sig := range sigs {
+		s.sigs[sig.Index][string(sig.PubKey)] = append([]byte(nil), sig.Signature...)
+	}
+	return nil
+}
+
+// checkSignature returns an error wrapping ErrInvalidSignature if sig is not
+// a valid signature of its input by a key expected to sign it.
+func (s *Session) checkSignature(sig bchutil.InputSignature) error {
+	idx := int(sig.Index)
+	if idx >= len(s.inputs) {
+		return fmt.Errorf("%w: input index %d out of range", ErrInvalidSignature, sig.Index)
+	}
+	if !containsKey(s.inputs[idx].pubKeys, sig.PubKey) {
+		return fmt.Errorf("%w: input %d: key %x is not expected to sign", ErrInvalidSignature, idx, sig.PubKey)
+	}
+	n := len(sig.Signature)
+	if n == 0 || txscript.SigHashType(sig.Signature[n-1]) != bchutil.SigHashAllForkID {
+		return fmt.Errorf("%w: input %d: sighash type is not %s", ErrInvalidSignature, idx,
+			bchutil.SigHashTypeString(bchutil.SigHashAllForkID))
+	}
+	pubKey, _ := btcec.ParsePubKey(sig.PubKey, btcec.S256())
+	hash := s.sigHash(idx)
+	valid := false
+	if n-1 == bchutil.SchnorrSignatureLen {
+		valid = bchutil.VerifySchnorr(pubKey, hash, sig.Signature[:n-1])
+	} else if ecdsa, err := btcec.ParseDERSignature(sig.Signature[:n-1], btcec.S256()); err == nil {
+		valid = ecdsa.Verify(hash, pubKey)
+	}
+	if !valid {
+		return fmt.Errorf("%w: input %d: signature of %x does not verify", ErrInvalidSignature, idx, sig.PubKey)
+	}
+	return nil
+}
+
+// InputStatus describes the signatures collected for an input of a session.
+type InputStatus struct {
+	Index int
+
+	// Required is the number of signatures the input needs.  Signed are
+	// the keys that signed it and Pending the other keys expected to sign
+	// it, in script order.
+	Required int
+	Signed   [][]byte
+	Pending  [][]byte
+}
+
+// Complete returns whether the signatures of the input meet its threshold.
+func (s *InputStatus) Complete() bool {
+	return len(s.Signed) >= s.Required
+}
+
+// Status returns the signatures collected for every input of the session.
+func (s *Session) Status() []InputStatus {
+	statuses := make([]InputStatus, len(s.inputs))
+	for i := range s.inputs {
+		status := InputStatus{Index: i, Required: s.inputs[i].required}
+		for _, pubKey := range s.inputs[i].pubKeys {
+			if _, ok := s.sigs[i][string(pubKey)]; ok {
+				status.Signed = append(status.Signed, pubKey)
+			} else {
+				status.Pending = append(status.Pending, pubKey)
+			}
+		}
+		statuses[i] = status
+	}
+	return statuses
+}
+
+// Finalize returns the signed transaction of the session, once the
+// signatures collected meet the threshold of every input; it fails with
+// ErrIncomplete before.  The signatures of a multisig input must be all ECDSA
+// or all Schnorr signatures.
+func (s *Session) Finalize() (*wire.MsgTx, error) {
+	tx := s.tx.Copy()
+	for i, status := range s.Status() {
+		if !status.Complete() {
+			return nil, fmt.Errorf("%w: input %d has %d of %d signatures", ErrIncomplete, i,
+				len(status.Signed), status.Required)
+		}
+		in := &s.inputs[i]
+		var err error
+		if in.multisig {
+			var sigs []bchutil.InputSignature
+			for _, pubKey := range status.Signed {
+				sigs = append(sigs, bchutil.InputSignature{Index: uint32(i), PubKey: pubKey,
+					Signature: s.sigs[i][string(pubKey)]})
+			}
+			tx.TxIn[i].SignatureScript, err = bchutil.CombineSignatures(in.RedeemScript, sigs)
+		} else {
+			pubKey := status.Signed[0]
+			tx.TxIn[i].SignatureScript, err = txscript.NewScriptBuilder().AddData(s.sigs[i][string(pubKey)]).
+				AddData(pubKey).Script()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	return tx, nil
+}
+
+// Serialize returns the binary serialization of the session, with the
+// signatures collected.
+func (s *Session) Serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(sessionMagic)
+	buf.WriteByte(formatVersion)
+	if err := s.tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	for _, in := range s.inputs {
+		binary.Write(&buf, binary.LittleEndian, in.PrevOut.Value)
+		wire.WriteVarBytes(&buf, 0, in.PrevOut.PkScript)
+		wire.WriteVarBytes(&buf, 0, in.RedeemScript)
+	}
+	wire.WriteVarInt(&buf, 0, uint64(len(s.signers)))
+	for _, pubKey := range s.signers {
+		wire.WriteVarBytes(&buf, 0, pubKey)
+	}
+	// Signatures are written in input and script key order.
+	for i, status := range s.Status() {
+		wire.WriteVarInt(&buf, 0, uint64(len(status.Signed)))
+		for _, pubKey := range status.Signed {
+			wire.WriteVarBytes(&buf, 0, pubKey)
+			wire.WriteVarBytes(&buf, 0, s.sigs[i][string(pubKey)])
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseSession decodes a session serialized by Serialize, checking its
+// signatures again.
+func ParseSession(data []byte) (*Session, error) {
+	s, err := readSession(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSession, err)
+	}
+	return s, nil
+}
+
+func readSession(rd *bytes.Reader) (*Session, error) {
+	header := make([]byte, len(sessionMagic)+1)
+	if _, err := io.ReadFull(rd, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(sessionMagic)], sessionMagic) {
+		return nil, errors.New("bad magic")
+	}
+	if header[len(sessionMagic)] != formatVersion {
+		return nil, fmt.Errorf("unknown version %d", header[len(sessionMagic)])
+	}
+	tx := &wire.MsgTx{}
+	if err := tx.Deserialize(rd); err != nil {
+		return nil, err
+	}
+	prevOuts := make([]Input, len(tx.TxIn))
+	for i := range prevOuts {
+		txOut := &wire.TxOut{}
+		if err := binary.Read(rd, binary.LittleEndian, &txOut.Value); err != nil {
+			return nil, err
+		}
+		var err error
+		if txOut.PkScript, err = wire.ReadVarBytes(rd, 0, txscript.MaxScriptSize, "pkScript"); err != nil {
+			return nil, err
+		}
+		prevOuts[i].PrevOut = txOut
+		redeemScript, err := wire.ReadVarBytes(rd, 0, txscript.MaxScriptElementSize, "redeemScript")
+		if err != nil {
+			return nil, err
+		}
+		if len(redeemScript) != 0 {
+			prevOuts[i].RedeemScript = redeemScript
+		}
+	}
+	count, err := wire.ReadVarInt(rd, 0)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxSigners {
+		return nil, fmt.Errorf("%d signers", count)
+	}
+	var signers [][]byte
+	for i := uint64(0); i < count; i++ {
+		pubKey, err := wire.ReadVarBytes(rd, 0, btcec.PubKeyBytesLenUncompressed, "pubKey")
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, pubKey)
+	}
+	s, err := NewSession(tx, prevOuts, signers)
+	if err != nil {
+		return nil, err
+	}
+
+	var sigs []bchutil.InputSignature
+	for i := range tx.TxIn {
+		count, err := wire.ReadVarInt(rd, 0)
+		if err != nil {
+			return nil, err
+		}
+		if count > uint64(len(s.inputs[i].pubKeys)) {
+			return nil, fmt.Errorf("input %d: %d signatures", i, count)
+		}
+		for j := uint64(0); j < count; j++ {
+			sig := bchutil.InputSignature{Index: uint32(i)}
+			if sig.PubKey, err = wire.ReadVarBytes(rd, 0, btcec.PubKeyBytesLenUncompressed, "pubKey"); err != nil {
+				return nil, err
+			}
+			if sig.Signature, err = wire.ReadVarBytes(rd, 0, txscript.MaxScriptElementSize,
+				"signature"); err != nil {
+				return nil, err
+			}
+			sigs = append(sigs, sig)
+		}
+	}
+	if rd.Len() != 0 {
+		return nil, errors.New("trailing data")
+	}
+	if err := s.addSignatures(sigs); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,204 @@
+package signsession
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Fabcien/bchutil"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testSession returns a session spending a 2-of-3 multisig output, a
+// pay-to-pubkey-hash output of the first key and a 2-of-3 multisig output with
+// a 32 bytes hash carrying tokens, signed by the first two keys, and the keys.
+func testSession(t *testing.T) (*Session, []*btcec.PrivateKey) {
+	var keys []*btcec.PrivateKey
+	var pubKeys []*btcutil.AddressPubKey
+	for i := byte(1); i <= 3; i++ {
+		key, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{i})
+		keys = append(keys, key)
+		pubKey, _ := btcutil.NewAddressPubKey(key.PubKey().SerializeCompressed(), &chaincfg.MainNetParams)
+		pubKeys = append(pubKeys, pubKey)
+	}
+	redeemScript, err := txscript.MultiSigScript(pubKeys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2sh, _ := bchutil.NewCashAddressScriptHash(redeemScript, &chaincfg.MainNetParams)
+	p2sh32, _ := bchutil.NewCashAddressScriptHash32(redeemScript, &chaincfg.MainNetParams)
+	p2pkh, _ := bchutil.NewCashAddressPubKeyHash(btcutil.Hash160(pubKeys[0].ScriptAddress()), &chaincfg.MainNetParams)
+	p2shScript, _ := bchutil.PayToAddrScript(p2sh)
+	p2sh32Script, _ := bchutil.PayToAddrScript(p2sh32)
+	p2pkhScript, _ := bchutil.PayToAddrScript(p2pkh)
+	token := &bchutil.TokenData{Category: chainhash.Hash{9}, Amount: 100}
+	tokenScript := append(token.Bytes(), p2sh32Script...)
+
+	tx := wire.NewMsgTx(2)
+	for i := uint32(0); i < 3; i++ {
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}, Index: i}, nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(25000, p2pkhScript))
+	tx.AddTxOut(wire.NewTxOut(1000, append(token.Bytes(), p2pkhScript...)))
+	prevOuts := []Input{
+		{PrevOut: wire.NewTxOut(20000, p2shScript), RedeemScript: redeemScript},
+		{PrevOut: wire.NewTxOut(7000, p2pkhScript)},
+		{PrevOut: wire.NewTxOut(1000, tokenScript), RedeemScript: redeemScript},
+	}
+	s, err := NewSession(tx, prevOuts, [][]byte{pubKeys[0].ScriptAddress(), pubKeys[1].ScriptAddress()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, keys
+}
+
+// exchange passes s to a party signing with key and returns the session
+// received by the coordinator with its signatures.
+func exchange(t *testing.T, s *Session, key *btcec.PrivateKey, opts ...bchutil.SignOption) *Session {
+	t.Helper()
+	data, err := s.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	party, err := ParseSession(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := party.Sign(key, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddPartialSignatures(blob); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = s.Serialize(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = ParseSession(data); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSession(t *testing.T) {
+	s, keys := testSession(t)
+	if _, err := s.Finalize(); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("got %v, want ErrIncomplete", err)
+	}
+
+	s = exchange(t, s, keys[0])
+	status := s.Status()
+	if !status[1].Complete() || status[0].Complete() || len(status[0].Signed) != 1 ||
+		!bytes.Equal(status[0].Pending[0], keys[1].PubKey().SerializeCompressed()) {
+		t.Errorf("wrong status %+v", status)
+	}
+	if _, err := s.Finalize(); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("got %v, want ErrIncomplete", err)
+	}
+
+	s = exchange(t, s, keys[1])
+	tx, err := s.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, in := range s.inputs[:2] {
+		vm, err := bchutil.NewEngine(in.PrevOut.PkScript, tx, i, bchutil.StandardScriptFlags, nil, in.PrevOut.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Errorf("input %d: %v", i, err)
+		}
+	}
+	// The engine does not commit to tokens.
+	token, pkScript, _ := bchutil.SplitTokenPrefix(s.inputs[2].PrevOut.PkScript)
+	multisig, err := bchutil.VerifyMultisigScriptSig(tx, 2, &bchutil.UTXO{Amount: 1000, PkScript: pkScript,
+		TokenData: token.Bytes()})
+	if err != nil || !multisig.Complete() {
+		t.Errorf("token input: %v", err)
+	}
+}
+
+func TestSessionSchnorr(t *testing.T) {
+	s, keys := testSession(t)
+	s = exchange(t, s, keys[1], bchutil.WithSchnorr())
+	s = exchange(t, s, keys[0], bchutil.WithSchnorr())
+	if _, err := s.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddPartialSignaturesRejects(t *testing.T) {
+	s, keys := testSession(t)
+	other, _ := testSession(t)
+	other.tx.LockTime = 1
+	blob, err := other.Sign(keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddPartialSignatures(blob); !errors.Is(err, bchutil.ErrTxIDMismatch) {
+		t.Errorf("got %v, want ErrTxIDMismatch", err)
+	}
+
+	// The third key is not a signer of the session.
+	if _, err := s.Sign(keys[2]); err == nil {
+		t.Error("third key signed")
+	}
+	sig, _ := bchutil.SignInput(s.tx, 0, s.inputs[0].scriptCode, bchutil.SigHashAllForkID, keys[2], 20000)
+	resp := &bchutil.SigningResponse{TxID: s.TxID(), Signatures: []bchutil.InputSignature{
+		{Index: 0, PubKey: keys[2].PubKey().SerializeCompressed(), Signature: sig}}}
+	blob, _ = resp.MarshalBinary()
+	if err := s.AddPartialSignatures(blob); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("got %v, want ErrInvalidSignature", err)
+	}
+
+	// A signature of the wrong amount does not verify, and nothing is added.
+	good, _ := bchutil.SignInput(s.tx, 0, s.inputs[0].scriptCode, bchutil.SigHashAllForkID, keys[0], 20000)
+	bad, _ := bchutil.SignInput(s.tx, 1, s.inputs[1].scriptCode, bchutil.SigHashAllForkID, keys[0], 7001)
+	pubKey := keys[0].PubKey().SerializeCompressed()
+	resp.Signatures = []bchutil.InputSignature{{Index: 0, PubKey: pubKey, Signature: good},
+		{Index: 1, PubKey: pubKey, Signature: bad}}
+	blob, _ = resp.MarshalBinary()
+	if err := s.AddPartialSignatures(blob); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("got %v, want ErrInvalidSignature", err)
+	}
+	if len(s.Status()[0].Signed) != 0 {
+		t.Error("signatures added on error")
+	}
+	if _, err := ParseSession(blob); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("got %v, want ErrInvalidSession", err)
+	}
+}
+
+func TestNewSessionRejects(t *testing.T) {
+	s, keys := testSession(t)
+	prevOuts := make([]Input, len(s.inputs))
+	for i, in := range s.inputs {
+		prevOuts[i] = in.Input
+	}
+	tests := []struct {
+		name    string
+		signers [][]byte
+		modify  func([]Input)
+	}{
+		{"single signer", [][]byte{keys[0].PubKey().SerializeCompressed()}, func([]Input) {}},
+		{"wrong redeem script", nil, func(in []Input) { in[0].RedeemScript = in[0].RedeemScript[1:] }},
+		{"missing output", nil, func(in []Input) { in[1].PrevOut = nil }},
+	}
+	for _, test := range tests {
+		inputs := append([]Input(nil), prevOuts...)
+		test.modify(inputs)
+		signers := test.signers
+		if signers == nil {
+			signers = s.signers
+		}
+		if _, err := NewSession(s.tx, inputs, signers); !errors.Is(err, ErrInvalidSession) {
+			t.Errorf("%s: got %v, want ErrInvalidSession", test.name, err)
+		}
+	}
+}
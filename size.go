@@ -0,0 +1,217 @@
+package bchutil
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// MaxStandardTxSize is the largest transaction relayed by nodes.
+const MaxStandardTxSize = 100000
+
+// Sizes of the scriptSigs spending standard scripts, with ECDSA signatures of
+// the largest DER encoding.
+const (
+	// maxSigPushSize is the size of the push of the longest ECDSA
+	// signature with its sighash type.
+	maxSigPushSize = 1 + 72 + 1
+
+	// schnorrSigPushSize is the size of the push of a Schnorr signature
+	// with its sighash type.
+	schnorrSigPushSize = 1 + SchnorrSignatureLen + 1
+
+	// P2PKHScriptSigSize is the size of a scriptSig spending a
+	// pay-to-pubkey-hash output of a compressed public key.
+	P2PKHScriptSigSize = maxSigPushSize + 1 + 33
+
+	// P2PKHUncompressedScriptSigSize is the size of a scriptSig spending a
+	// pay-to-pubkey-hash output of an uncompressed public key.
+	P2PKHUncompressedScriptSigSize = maxSigPushSize + 1 + 65
+
+	// P2PKScriptSigSize is the size of a scriptSig spending a
+	// pay-to-pubkey output.
+	P2PKScriptSigSize = maxSigPushSize
+)
+
+// EstimateScriptSigSize returns the largest size of a scriptSig spending
+// pkScript, which must be a pay-to-pubkey-hash script of a compressed public
+// key, a pay-to-pubkey or a bare multisig script.  The scriptSig of
+// pay-to-script-hash outputs depends on the redeem script and can't be
+// estimated.
+func EstimateScriptSigSize(pkScript []byte) (int, error) {
+	switch class := txscript.GetScriptClass(pkScript); class {
+	case txscript.PubKeyHashTy:
+		return P2PKHScriptSigSize, nil
+	case txscript.PubKeyTy:
+		return P2PKScriptSigSize, nil
+	case txscript.MultiSigTy:
+		pubKeys, required, _ := multisigPubKeys(pkScript)
+		return scriptSigSize(class, InputSizeOptions{RequiredSigs: required, PubKeys: len(pubKeys)}), nil
+	default:
+		return 0, fmt.Errorf("cannot estimate the scriptSig size of %v scripts", class)
+	}
+}
+
+// EstimateInputSize returns the serialized size of an input with a
+// scriptSig of scriptSigSize bytes.
+func EstimateInputSize(scriptSigSize int) int {
+	return 32 + 4 + wire.VarIntSerializeSize(uint64(scriptSigSize)) + scriptSigSize + 4
+}
+
+// EstimateSignedSize returns the serialized size of tx once its inputs
+// without scriptSig are signed.  prevOuts holds the outputs spent by those
+// inputs, whose scripts may start with a token prefix.
+func EstimateSignedSize(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut) (int, error) {
+	size := tx.SerializeSize()
+	for i, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) != 0 {
+			continue
+		}
+		prevOut, ok := prevOuts[i]
+		if !ok || prevOut == nil {
+			return 0, fmt.Errorf("no previous output for input %d", i)
+		}
+		_, pkScript, err := SplitTokenPrefix(prevOut.PkScript)
+		if err != nil {
+			return 0, fmt.Errorf("input %d: %w", i, err)
+		}
+		scriptSigSize, err := EstimateScriptSigSize(pkScript)
+		if err != nil {
+			return 0, fmt.Errorf("input %d: %w", i, err)
+		}
+		size += EstimateInputSize(scriptSigSize) - EstimateInputSize(0)
+	}
+	return size, nil
+}
+
+// Sizes of the outputs of standard scripts without tokens.
+const (
+	// P2PKHOutputSize is the size of a pay-to-pubkey-hash output.
+	P2PKHOutputSize = 8 + 1 + 25
+
+	// P2SHOutputSize is the size of a pay-to-script-hash output with a 20
+	// bytes hash.
+	P2SHOutputSize = 8 + 1 + 23
+
+	// P2SH32OutputSize is the size of a pay-to-script-hash output with a 32
+	// bytes hash.
+	P2SH32OutputSize = 8 + 1 + 35
+)
+
+// InputSizeOptions describes the scriptSig of an input for InputSize.
+type InputSizeOptions struct {
+	// Schnorr is set for Schnorr signatures.  ECDSA signatures are of
+	// their largest DER encoding.
+	Schnorr bool
+
+	// Uncompressed is set for pay-to-pubkey-hash scripts of uncompressed
+	// public keys.
+	Uncompressed bool
+
+	// RequiredSigs and PubKeys are the m and n of m-of-n multisig scripts,
+	// bare or redeemed by pay-to-script-hash scripts of compressed public
+	// keys.
+	RequiredSigs int
+	PubKeys      int
+}
+
+// InputSize returns the largest serialized size of an input spending a script
+// of class, signed as described by opts: pay-to-pubkey-hash, pay-to-pubkey
+// and multisig scripts, and pay-to-script-hash scripts, of either hash
+// length, of multisig redeem scripts.  It returns 0 for other classes and
+// invalid multisig counts.
+func InputSize(class txscript.ScriptClass, opts InputSizeOptions) int {
+	size := scriptSigSize(class, opts)
+	if size < 0 {
+		return 0
+	}
+	return EstimateInputSize(size)
+}
+
+// scriptSigSize returns the largest size of the scriptSig of InputSize, or -1.
+func scriptSigSize(class txscript.ScriptClass, opts InputSizeOptions) int {
+	sigPushSize := maxSigPushSize
+	if opts.Schnorr {
+		sigPushSize = schnorrSigPushSize
+	}
+	switch class {
+	case txscript.PubKeyHashTy:
+		if opts.Uncompressed {
+			return sigPushSize + 1 + 65
+		}
+		return sigPushSize + 1 + 33
+	case txscript.PubKeyTy:
+		return sigPushSize
+	case txscript.MultiSigTy:
+		if opts.RequiredSigs <= 0 || opts.RequiredSigs > opts.PubKeys ||
+			opts.PubKeys > txscript.MaxPubKeysPerMultiSig {
+			return -1
+		}
+		// The Schnorr bitfield is pushed in the most bytes it may take,
+		// and ECDSA signatures follow OP_0.
+		dummySize := 1
+		if opts.Schnorr {
+			dummySize += (opts.PubKeys + 7) / 8
+		}
+		return dummySize + opts.RequiredSigs*sigPushSize
+	case txscript.ScriptHashTy:
+		size := scriptSigSize(txscript.MultiSigTy, opts)
+		if size < 0 {
+			return -1
+		}
+		// OP_m <pubKey>... OP_n OP_CHECKMULTISIG
+		redeemScriptSize := 1 + opts.PubKeys*(1+33) + 2
+		return size + pushSize(redeemScriptSize)
+	}
+	return -1
+}
+
+// pushSize returns the size of the push of n bytes by a data push opcode.
+func pushSize(n int) int {
+	switch {
+	case n < txscript.OP_PUSHDATA1:
+		return 1 + n
+	case n <= 0xff:
+		return 2 + n
+	case n <= 0xffff:
+		return 3 + n
+	}
+	return 5 + n
+}
+
+// OutputSize returns the serialized size of an output whose script, of class,
+// is scriptLen bytes long, its token prefix included: the length of the bytes
+// of the TokenData of token outputs is added to that of their script.  A
+// scriptLen of zero stands for the standard scripts of class without tokens,
+// of 25 bytes for PubKeyHashTy, 23 for ScriptHashTy, 35 for PubKeyTy, of a
+// compressed public key, and 1 for NullDataTy, a bare OP_RETURN.
+func OutputSize(class txscript.ScriptClass, scriptLen int) int {
+	if scriptLen == 0 {
+		switch class {
+		case txscript.PubKeyHashTy:
+			scriptLen = 25
+		case txscript.ScriptHashTy:
+			scriptLen = 23
+		case txscript.PubKeyTy:
+			scriptLen = 35
+		case txscript.NullDataTy:
+			scriptLen = 1
+		}
+	}
+	return 8 + wire.VarIntSerializeSize(uint64(scriptLen)) + scriptLen
+}
+
+// EffectiveValue returns the value of u once the fee of the input spending it
+// at feeRate is paid, negative when spending it costs more than it is worth.
+// The input is of the size estimated by EstimateScriptSigSize, and outputs
+// whose scriptSig it can't estimate, such as pay-to-script-hash outputs, are
+// worth 0.
+func EffectiveValue(u UTXO, feeRate FeeRate) btcutil.Amount {
+	scriptSigSize, err := EstimateScriptSigSize(u.PkScript)
+	if err != nil {
+		return 0
+	}
+	return u.Amount - feeRate.Fee(EstimateInputSize(scriptSigSize))
+}
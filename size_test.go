@@ -0,0 +1,109 @@
+package bchutil
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestInputSize(t *testing.T) {
+	var pubKeys []*btcutil.AddressPubKey
+	for i := byte(1); i <= 3; i++ {
+		key, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{i})
+		pubKey, _ := btcutil.NewAddressPubKey(key.PubKey().SerializeCompressed(), &chaincfg.MainNetParams)
+		pubKeys = append(pubKeys, pubKey)
+	}
+	multisig, err := txscript.MultiSigScript(pubKeys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sizes are those of the placeholder scriptSigs.
+	tests := []struct {
+		class txscript.ScriptClass
+		opts  InputSizeOptions
+	}{
+		{txscript.PubKeyHashTy, InputSizeOptions{}},
+		{txscript.PubKeyHashTy, InputSizeOptions{Uncompressed: true}},
+		{txscript.PubKeyHashTy, InputSizeOptions{Schnorr: true}},
+		{txscript.PubKeyHashTy, InputSizeOptions{Schnorr: true, Uncompressed: true}},
+		{txscript.PubKeyTy, InputSizeOptions{}},
+		{txscript.MultiSigTy, InputSizeOptions{RequiredSigs: 2, PubKeys: 3}},
+		{txscript.ScriptHashTy, InputSizeOptions{RequiredSigs: 2, PubKeys: 3}},
+		{txscript.ScriptHashTy, InputSizeOptions{Schnorr: true, RequiredSigs: 2, PubKeys: 3}},
+	}
+	for _, test := range tests {
+		scriptSig, err := DummySignatureScript(test.class, multisig, test.opts.Schnorr, !test.opts.Uncompressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := InputSize(test.class, test.opts), EstimateInputSize(len(scriptSig)); got != want {
+			t.Errorf("%v %+v: got %d, want %d", test.class, test.opts, got, want)
+		}
+	}
+	if got := InputSize(txscript.PubKeyHashTy, InputSizeOptions{}); got != 32+4+1+P2PKHScriptSigSize+4 {
+		t.Errorf("P2PKH input of %d bytes", got)
+	}
+
+	for _, opts := range []InputSizeOptions{{}, {RequiredSigs: 3, PubKeys: 2}, {RequiredSigs: 1, PubKeys: 21}} {
+		if got := InputSize(txscript.ScriptHashTy, opts); got != 0 {
+			t.Errorf("%+v: got %d, want 0", opts, got)
+		}
+	}
+	if got := InputSize(txscript.NullDataTy, InputSizeOptions{}); got != 0 {
+		t.Errorf("data carrier input of %d bytes", got)
+	}
+}
+
+func TestOutputSize(t *testing.T) {
+	p2pkh, _ := payToPubKeyHashScript(make([]byte, 20))
+	addr32, _ := NewCashAddressScriptHash32FromHash(make([]byte, 32), &chaincfg.MainNetParams)
+	p2sh32, err := PayToAddrScript(addr32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &TokenData{Amount: 1000}
+	tokenScript := append(token.Bytes(), p2pkh...)
+	data, _ := txscript.NullDataScript(make([]byte, 80))
+
+	tests := []struct {
+		class     txscript.ScriptClass
+		pkScript  []byte
+		scriptLen int
+	}{
+		{txscript.PubKeyHashTy, p2pkh, 0},
+		{txscript.ScriptHashTy, p2sh32, len(p2sh32)},
+		{txscript.PubKeyHashTy, tokenScript, len(tokenScript)},
+		{txscript.NullDataTy, data, len(data)},
+		{txscript.NullDataTy, []byte{txscript.OP_RETURN}, 0},
+	}
+	for _, test := range tests {
+		if got, want := OutputSize(test.class, test.scriptLen), wire.NewTxOut(0, test.pkScript).SerializeSize(); got != want {
+			t.Errorf("%v of %d bytes: got %d, want %d", test.class, len(test.pkScript), got, want)
+		}
+	}
+	if OutputSize(txscript.PubKeyHashTy, 0) != P2PKHOutputSize || OutputSize(txscript.ScriptHashTy, 0) != P2SHOutputSize ||
+		OutputSize(txscript.ScriptHashTy, 35) != P2SH32OutputSize {
+		t.Error("wrong output size constants")
+	}
+}
+
+func TestEffectiveValue(t *testing.T) {
+	p2pkh, _ := payToPubKeyHashScript(make([]byte, 20))
+	u := UTXO{Amount: 1200, PkScript: p2pkh}
+	// 149 bytes at 2 sat/B.
+	if got := EffectiveValue(u, 2000); got != 1200-298 {
+		t.Errorf("got %v, want %v", got, 1200-298)
+	}
+	if got := EffectiveValue(u, 10000); got >= 0 {
+		t.Errorf("got %v, want a negative value", got)
+	}
+	p2sh, _ := txscript.PayToAddrScript(mustScriptHash(t, p2pkh))
+	if got := EffectiveValue(UTXO{Amount: 1200, PkScript: p2sh}, 2000); got != 0 {
+		t.Errorf("pay-to-script-hash output worth %v", got)
+	}
+}
@@ -0,0 +1,261 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// slpLokadID is the first push of SLP OP_RETURN outputs.
+var slpLokadID = []byte("SLP\x00")
+
+// SLP token types.
+const (
+	SLPFungible  = 0x01
+	SLPNFT1Child = 0x41
+	SLPNFT1Group = 0x81
+)
+
+// SLP transaction types.
+const (
+	SLPGenesis = "GENESIS"
+	SLPMint    = "MINT"
+	SLPSend    = "SEND"
+)
+
+// maxSLPSendOutputs is the largest number of outputs receiving tokens of a
+// SEND transaction.
+const maxSLPSendOutputs = 19
+
+// ErrInvalidSLP describes an error where an output script is not a valid SLP
+// message.
+var ErrInvalidSLP = errors.New("invalid SLP message")
+
+// SLPMessage is the SLP message of the OP_RETURN output 0 of a transaction.
+type SLPMessage struct {
+	TokenType uint16
+	TxType    string
+
+	// TokenID is the hash of the GENESIS transaction of the token, in the
+	// byte order of transaction hashes, for MINT and SEND transactions.
+	TokenID chainhash.Hash
+
+	// Ticker, Name, DocumentURL and DocumentHash, empty or 32 bytes long,
+	// describe the token of GENESIS transactions.
+	Ticker       []byte
+	Name         []byte
+	DocumentURL  []byte
+	DocumentHash []byte
+
+	// Decimals, at most 9, are the decimals of the token and its Amounts.
+	// GENESIS transactions create them, and ParseSLP leaves them zero for
+	// MINT and SEND transactions until set with SetDecimals.
+	Decimals byte
+
+	// MintBatonVout is the output receiving the mint baton of GENESIS and
+	// MINT transactions, 0 if the baton is destroyed.
+	MintBatonVout uint32
+
+	// Amounts are the amounts received by the outputs starting with output
+	// 1: GENESIS and MINT transactions create one amount.
+	Amounts []TokenAmount
+}
+
+// OutputAmount returns the amount received by output vout.
+func (m *SLPMessage) OutputAmount(vout uint32) TokenAmount {
+	if vout == 0 || int(vout) > len(m.Amounts) {
+		return TokenAmount{Decimals: m.Decimals}
+	}
+	return m.Amounts[vout-1]
+}
+
+// SetDecimals sets the decimals of the token, known from its GENESIS
+// transaction, and of the amounts.
+func (m *SLPMessage) SetDecimals(decimals byte) {
+	m.Decimals = decimals
+	for i := range m.Amounts {
+		m.Amounts[i].Decimals = decimals
+	}
+}
+
+// ParseSLP parses the SLP message of an OP_RETURN script.  Scripts that are not
+// valid SLP messages, of the fungible or NFT1 token types, fail with an error
+// wrapping ErrInvalidSLP.
+func ParseSLP(pkScript []byte) (*SLPMessage, error) {
+	if len(pkScript) == 0 || pkScript[0] != txscript.OP_RETURN {
+		return nil, fmt.Errorf("%w: no OP_RETURN", ErrInvalidSLP)
+	}
+	ops, err := parseScript(pkScript[1:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSLP, err)
+	}
+	pushes := make([][]byte, len(ops))
+	for i, op := range ops {
+		// Small integers and empty pushes must use data push opcodes.
+		if op.value < txscript.OP_DATA_1 || op.value > txscript.OP_PUSHDATA4 {
+			return nil, fmt.Errorf("%w: opcode %#x", ErrInvalidSLP, op.value)
+		}
+		pushes[i] = op.data
+	}
+	if len(pushes) < 3 || !bytes.Equal(pushes[0], slpLokadID) {
+		return nil, fmt.Errorf("%w: no SLP identifier", ErrInvalidSLP)
+	}
+
+	m := &SLPMessage{TxType: string(pushes[2])}
+	switch len(pushes[1]) {
+	case 1:
+		m.TokenType = uint16(pushes[1][0])
+	case 2:
+		m.TokenType = binary.BigEndian.Uint16(pushes[1])
+	default:
+		return nil, fmt.Errorf("%w: token type of %d bytes", ErrInvalidSLP, len(pushes[1]))
+	}
+	if m.TokenType != SLPFungible && m.TokenType != SLPNFT1Child && m.TokenType != SLPNFT1Group {
+		return nil, fmt.Errorf("%w: unsupported token type %#x", ErrInvalidSLP, m.TokenType)
+	}
+
+	args := pushes[3:]
+	switch m.TxType {
+	case SLPGenesis:
+		if len(args) != 7 {
+			return nil, fmt.Errorf("%w: GENESIS with %d arguments", ErrInvalidSLP, len(args))
+		}
+		m.Ticker, m.Name, m.DocumentURL, m.DocumentHash = args[0], args[1], args[2], args[3]
+		if len(m.DocumentHash) != 0 && len(m.DocumentHash) != 32 {
+			return nil, fmt.Errorf("%w: document hash of %d bytes", ErrInvalidSLP, len(m.DocumentHash))
+		}
+		if len(args[4]) != 1 || args[4][0] > 9 {
+			return nil, fmt.Errorf("%w: decimals %x", ErrInvalidSLP, args[4])
+		}
+		m.Decimals = args[4][0]
+		args = args[5:]
+	case SLPMint:
+		if len(args) != 3 {
+			return nil, fmt.Errorf("%w: MINT with %d arguments", ErrInvalidSLP, len(args))
+		}
+		if err := m.parseTokenID(args[0]); err != nil {
+			return nil, err
+		}
+		if m.TokenType == SLPNFT1Child {
+			return nil, fmt.Errorf("%w: MINT of NFT1 child", ErrInvalidSLP)
+		}
+		args = args[1:]
+	case SLPSend:
+		if len(args) < 2 || len(args) > 1+maxSLPSendOutputs {
+			return nil, fmt.Errorf("%w: SEND with %d arguments", ErrInvalidSLP, len(args))
+		}
+		if err := m.parseTokenID(args[0]); err != nil {
+			return nil, err
+		}
+		for _, amount := range args[1:] {
+			if err := m.parseAmount(amount); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("%w: transaction type %q", ErrInvalidSLP, m.TxType)
+	}
+
+	// GENESIS and MINT end with the mint baton output and amount.
+	switch len(args[0]) {
+	case 0:
+	case 1:
+		if args[0][0] < 2 {
+			return nil, fmt.Errorf("%w: mint baton output %d", ErrInvalidSLP, args[0][0])
+		}
+		m.MintBatonVout = uint32(args[0][0])
+	default:
+		return nil, fmt.Errorf("%w: mint baton output of %d bytes", ErrInvalidSLP, len(args[0]))
+	}
+	if err := m.parseAmount(args[1]); err != nil {
+		return nil, err
+	}
+	if m.TokenType == SLPNFT1Child && (m.Decimals != 0 || m.MintBatonVout != 0 || m.Amounts[0].Units != 1) {
+		return nil, fmt.Errorf("%w: NFT1 child GENESIS must create one indivisible token", ErrInvalidSLP)
+	}
+	return m, nil
+}
+
+// parseTokenID sets the token id from its push, in the byte order of
+// transaction ids.
+func (m *SLPMessage) parseTokenID(push []byte) error {
+	if len(push) != chainhash.HashSize {
+		return fmt.Errorf("%w: token id of %d bytes", ErrInvalidSLP, len(push))
+	}
+	for i, b := range push {
+		m.TokenID[chainhash.HashSize-1-i] = b
+	}
+	return nil
+}
+
+// parseAmount appends the 8 bytes big-endian amount of push to the amounts.
+func (m *SLPMessage) parseAmount(push []byte) error {
+	a, err := TokenAmountFromBytes(push, m.Decimals)
+	if err != nil {
+		return err
+	}
+	m.Amounts = append(m.Amounts, a)
+	return nil
+}
+
+// Script returns the OP_RETURN script of the message, whose amounts must have
+// its decimals.
+func (m *SLPMessage) Script() ([]byte, error) {
+	var pushes [][]byte
+	tokenType := []byte{byte(m.TokenType)}
+	if m.TokenType > 0xff {
+		tokenType = []byte{byte(m.TokenType >> 8), byte(m.TokenType)}
+	}
+	pushes = append(pushes, slpLokadID, tokenType, []byte(m.TxType))
+	var tokenID [chainhash.HashSize]byte
+	for i, b := range m.TokenID {
+		tokenID[chainhash.HashSize-1-i] = b
+	}
+	var baton []byte
+	if m.MintBatonVout != 0 {
+		if m.MintBatonVout < 2 || m.MintBatonVout > 0xff {
+			return nil, fmt.Errorf("invalid mint baton output %d", m.MintBatonVout)
+		}
+		baton = []byte{byte(m.MintBatonVout)}
+	}
+
+	switch m.TxType {
+	case SLPGenesis:
+		pushes = append(pushes, m.Ticker, m.Name, m.DocumentURL, m.DocumentHash, []byte{m.Decimals}, baton)
+	case SLPMint:
+		pushes = append(pushes, tokenID[:], baton)
+	case SLPSend:
+		pushes = append(pushes, tokenID[:])
+	default:
+		return nil, fmt.Errorf("unknown SLP transaction type %q", m.TxType)
+	}
+	for _, amount := range m.Amounts {
+		if amount.Decimals != m.Decimals {
+			return nil, fmt.Errorf("amount %v of %d decimals, token of %d", amount, amount.Decimals, m.Decimals)
+		}
+		pushes = append(pushes, amount.Bytes())
+	}
+
+	builder := NewScriptBuilder().AddOp(txscript.OP_RETURN)
+	for _, push := range pushes {
+		// Empty pushes and small integers use data push opcodes too.
+		if len(push) == 0 {
+			builder.AddOps([]byte{txscript.OP_PUSHDATA1, 0})
+		} else {
+			builder.AddDataPush(push)
+		}
+	}
+	script, err := builder.Script()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParseSLP(script); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
@@ -0,0 +1,60 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+func TestSLPMessage(t *testing.T) {
+	for i, m := range []*SLPMessage{
+		{TokenType: SLPFungible, TxType: SLPGenesis, Ticker: []byte("TST"), Name: []byte("Test"),
+			DocumentHash: make([]byte, 32), Decimals: 8, MintBatonVout: 2, Amounts: slpAmounts(8, 1e8)},
+		{TokenType: SLPNFT1Child, TxType: SLPGenesis, Amounts: slpAmounts(0, 1)},
+		{TokenType: SLPNFT1Group, TxType: SLPMint, TokenID: chainhash.Hash{1}, Amounts: slpAmounts(0, 5)},
+		{TokenType: SLPFungible, TxType: SLPSend, TokenID: chainhash.Hash{1, 2}, Amounts: slpAmounts(0, 0, 1, 2)},
+	} {
+		script, err := m.Script()
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		got, err := ParseSLP(script)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		again, _ := got.Script()
+		if string(again) != string(script) || got.TokenID != m.TokenID || len(got.Amounts) != len(m.Amounts) {
+			t.Errorf("test %d: got %+v, want %+v", i, got, m)
+		}
+	}
+
+	for i, m := range []*SLPMessage{
+		{TokenType: SLPFungible, TxType: SLPSend, Amounts: make([]TokenAmount, 20)},
+		{TokenType: SLPFungible, TxType: SLPGenesis, Decimals: 10, Amounts: slpAmounts(10, 1)},
+		{TokenType: SLPNFT1Child, TxType: SLPGenesis, Amounts: slpAmounts(0, 2)},
+		{TokenType: SLPNFT1Child, TxType: SLPMint, Amounts: slpAmounts(0, 1)},
+		{TokenType: 2, TxType: SLPSend, Amounts: slpAmounts(0, 1)},
+	} {
+		if _, err := m.Script(); !errors.Is(err, ErrInvalidSLP) {
+			t.Errorf("test %d: got %v, want ErrInvalidSLP", i, err)
+		}
+	}
+
+	// Small integers are not valid pushes.
+	script, _ := (&SLPMessage{TokenType: SLPFungible, TxType: SLPSend, Amounts: slpAmounts(0, 1)}).Script()
+	script[6] = 0x51
+	script = append(script[:5], script[6:]...)
+	if _, err := ParseSLP(script); !errors.Is(err, ErrInvalidSLP) {
+		t.Errorf("got %v, want ErrInvalidSLP", err)
+	}
+}
+
+// slpAmounts returns the amounts of units of a token with decimals.
+func slpAmounts(decimals byte, units ...uint64) []TokenAmount {
+	amounts := make([]TokenAmount, len(units))
+	for i, u := range units {
+		amounts[i] = TokenAmount{u, decimals}
+	}
+	return amounts
+}
@@ -0,0 +1,103 @@
+package bchutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maxSLPDecimals is the largest number of decimals of an SLP token.
+const maxSLPDecimals = 9
+
+// ErrInvalidTokenAmount describes an error where a string is not a token
+// amount of the decimals of its token.
+var ErrInvalidTokenAmount = errors.New("invalid token amount")
+
+// TokenAmount is an amount of SLP tokens, in base units of a token with
+// Decimals decimals: 12345 base units of a token with 3 decimals are 12.345
+// tokens.
+type TokenAmount struct {
+	Units    uint64
+	Decimals byte
+}
+
+// ParseTokenAmount parses the decimal amount s of tokens with decimals
+// decimals, such as "12.345", which may not have more fractional digits than
+// decimals.
+func ParseTokenAmount(s string, decimals byte) (TokenAmount, error) {
+	a := TokenAmount{Decimals: decimals}
+	if decimals > maxSLPDecimals {
+		return a, fmt.Errorf("%w: %d decimals", ErrInvalidTokenAmount, decimals)
+	}
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+		if frac == "" {
+			return a, fmt.Errorf("%w: %q", ErrInvalidTokenAmount, s)
+		}
+	}
+	if whole == "" || len(frac) > int(decimals) {
+		return a, fmt.Errorf("%w: %q with %d decimals", ErrInvalidTokenAmount, s, decimals)
+	}
+	digits := whole + frac + strings.Repeat("0", int(decimals)-len(frac))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return a, fmt.Errorf("%w: %q", ErrInvalidTokenAmount, s)
+		}
+		d := uint64(c - '0')
+		if a.Units > (math.MaxUint64-d)/10 {
+			return a, fmt.Errorf("%w: %q", ErrTokenAmountOverflow, s)
+		}
+		a.Units = a.Units*10 + d
+	}
+	return a, nil
+}
+
+// TokenAmountFromBytes returns the amount of the 8 bytes big-endian base units
+// of SLP messages, of a token with decimals decimals.
+func TokenAmountFromBytes(b []byte, decimals byte) (TokenAmount, error) {
+	if len(b) != 8 {
+		return TokenAmount{}, fmt.Errorf("%w: amount of %d bytes", ErrInvalidSLP, len(b))
+	}
+	return TokenAmount{Units: binary.BigEndian.Uint64(b), Decimals: decimals}, nil
+}
+
+// Bytes returns the 8 bytes big-endian base units of SLP messages.
+func (a TokenAmount) Bytes() []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], a.Units)
+	return b[:]
+}
+
+// String returns the decimal amount of tokens, with all its decimals.
+func (a TokenAmount) String() string {
+	s := fmt.Sprintf("%0*d", int(a.Decimals)+1, a.Units)
+	if a.Decimals == 0 {
+		return s
+	}
+	return s[:len(s)-int(a.Decimals)] + "." + s[len(s)-int(a.Decimals):]
+}
+
+// Add returns the sum of a and b, which must have the same decimals.
+func (a TokenAmount) Add(b TokenAmount) (TokenAmount, error) {
+	if a.Decimals != b.Decimals {
+		return a, fmt.Errorf("adding amounts of %d and %d decimals", a.Decimals, b.Decimals)
+	}
+	if b.Units > math.MaxUint64-a.Units {
+		return a, fmt.Errorf("%w: %v + %v", ErrTokenAmountOverflow, a, b)
+	}
+	return TokenAmount{a.Units + b.Units, a.Decimals}, nil
+}
+
+// Sub returns a minus b, which must have the same decimals and be at most a.
+func (a TokenAmount) Sub(b TokenAmount) (TokenAmount, error) {
+	if a.Decimals != b.Decimals {
+		return a, fmt.Errorf("subtracting amounts of %d and %d decimals", a.Decimals, b.Decimals)
+	}
+	if b.Units > a.Units {
+		return a, fmt.Errorf("%w: %v - %v", ErrInsufficientTokens, a, b)
+	}
+	return TokenAmount{a.Units - b.Units, a.Decimals}, nil
+}
@@ -0,0 +1,89 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseTokenAmount(t *testing.T) {
+	for i, test := range []struct {
+		s        string
+		decimals byte
+		units    uint64
+		str      string
+	}{
+		{"12.345", 3, 12345, "12.345"},
+		{"12.3", 3, 12300, "12.300"},
+		{"12", 3, 12000, "12.000"},
+		{"0.001", 3, 1, "0.001"},
+		{"42", 0, 42, "42"},
+		{"0", 9, 0, "0.000000000"},
+		{"18446744073709551615", 0, math.MaxUint64, "18446744073709551615"},
+		{"18446744073.709551615", 9, math.MaxUint64, "18446744073.709551615"},
+	} {
+		a, err := ParseTokenAmount(test.s, test.decimals)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if a.Units != test.units || a.Decimals != test.decimals || a.String() != test.str {
+			t.Errorf("test %d: got %d units, %s", i, a.Units, a)
+		}
+	}
+
+	for i, test := range []struct {
+		s        string
+		decimals byte
+		err      error
+	}{
+		{"12.3456", 3, ErrInvalidTokenAmount},
+		{"1.5", 0, ErrInvalidTokenAmount},
+		{"", 2, ErrInvalidTokenAmount},
+		{".5", 2, ErrInvalidTokenAmount},
+		{"5.", 2, ErrInvalidTokenAmount},
+		{"-1", 2, ErrInvalidTokenAmount},
+		{"1e3", 2, ErrInvalidTokenAmount},
+		{"1", 10, ErrInvalidTokenAmount},
+		{"18446744073709551616", 0, ErrTokenAmountOverflow},
+		{"18446744073.709551616", 9, ErrTokenAmountOverflow},
+	} {
+		if _, err := ParseTokenAmount(test.s, test.decimals); !errors.Is(err, test.err) {
+			t.Errorf("test %d: got %v, want %v", i, err, test.err)
+		}
+	}
+}
+
+func TestTokenAmountArithmetic(t *testing.T) {
+	a, b := TokenAmount{150, 2}, TokenAmount{25, 2}
+	if sum, err := a.Add(b); err != nil || sum != (TokenAmount{175, 2}) {
+		t.Errorf("got %v, %v", sum, err)
+	}
+	if diff, err := a.Sub(b); err != nil || diff != (TokenAmount{125, 2}) {
+		t.Errorf("got %v, %v", diff, err)
+	}
+	if _, err := b.Sub(a); !errors.Is(err, ErrInsufficientTokens) {
+		t.Errorf("got %v, want ErrInsufficientTokens", err)
+	}
+	if _, err := (TokenAmount{math.MaxUint64, 2}).Add(b); !errors.Is(err, ErrTokenAmountOverflow) {
+		t.Errorf("got %v, want ErrTokenAmountOverflow", err)
+	}
+	if _, err := a.Add(TokenAmount{25, 3}); err == nil {
+		t.Error("added amounts of different decimals")
+	}
+}
+
+func TestTokenAmountBytes(t *testing.T) {
+	a := TokenAmount{0x0102030405060708, 4}
+	b := a.Bytes()
+	if !bytes.Equal(b, []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("got %x", b)
+	}
+	if got, err := TokenAmountFromBytes(b, 4); err != nil || got != a {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if _, err := TokenAmountFromBytes(b[1:], 4); !errors.Is(err, ErrInvalidSLP) {
+		t.Errorf("got %v, want ErrInvalidSLP", err)
+	}
+}
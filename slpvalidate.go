@@ -0,0 +1,236 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MaxSLPValidationTxs is the largest number of ancestors ValidateSLPTx fetches
+// to validate a transaction, which bounds the work of adversarial ancestries.
+const MaxSLPValidationTxs = 10000
+
+// ErrSLPValidationBudget describes an error where validating an SLP
+// transaction requires fetching more than MaxSLPValidationTxs ancestors.
+var ErrSLPValidationBudget = errors.New("SLP validation budget exceeded")
+
+// TxFetcher provides the transactions of the SLP DAG.
+type TxFetcher interface {
+	// FetchTx returns the transaction txid.
+	FetchTx(txid chainhash.Hash) (*wire.MsgTx, error)
+}
+
+// ValidityCache memoizes the SLP validity of transactions across calls of
+// ValidateSLPTx.
+type ValidityCache interface {
+	// Get returns the validity of txid, and whether it is known.
+	Get(txid chainhash.Hash) (valid, ok bool)
+
+	// Put records the validity of txid.
+	Put(txid chainhash.Hash, valid bool)
+}
+
+// SLPInputContribution is the contribution of an input to an SLP transaction.
+type SLPInputContribution struct {
+	Index int
+
+	// TokenID and TokenType are those of the spent output, which carries
+	// Amount and the mint baton if MintBaton is set.  They are zero unless
+	// the spent output belongs to a valid SLP transaction.
+	TokenID   chainhash.Hash
+	TokenType uint16
+	Amount    TokenAmount
+	MintBaton bool
+}
+
+// ValidityResult is the SLP validity of a transaction.
+type ValidityResult struct {
+	Valid bool
+
+	// Reason explains why the transaction is not valid.
+	Reason string
+
+	// Message is the SLP message of the transaction, nil if it has none.
+	// The decimals of its amounts are set when the validation walks to
+	// the GENESIS transaction of the token.
+	Message *SLPMessage
+
+	// Inputs are the contributions of the inputs of the transaction, for
+	// transactions with an SLP message.
+	Inputs []SLPInputContribution
+}
+
+// slpValidator validates transactions of the SLP DAG.
+type slpValidator struct {
+	fetcher TxFetcher
+	cache   ValidityCache
+
+	// validity memoizes the validity of the transactions validated, and
+	// fetched counts the transactions fetched.
+	validity map[chainhash.Hash]bool
+	fetched  int
+
+	// decimals are the decimals of the tokens whose GENESIS transaction
+	// was fetched.
+	decimals map[chainhash.Hash]byte
+}
+
+// ValidateSLPTx returns the SLP validity of tx, fetching its ancestors with
+// fetcher until their GENESIS transactions.  Transactions of the fungible and
+// NFT1 token types are valid when:
+//
+//   - GENESIS transactions are always valid, except NFT1 child ones, whose
+//     first input must spend NFT1 group tokens
+//   - MINT transactions spend the mint baton of their token
+//   - SEND transactions spend at least the amount of their token they send
+//
+// cache, which may be nil, memoizes the validity of the ancestors.  Ancestries
+// requiring more than MaxSLPValidationTxs transactions fail with
+// ErrSLPValidationBudget.  Transactions without a valid SLP message are not
+// valid, and burn the tokens they spend.
+func ValidateSLPTx(tx *wire.MsgTx, fetcher TxFetcher, cache ValidityCache) (ValidityResult, error) {
+	v := &slpValidator{fetcher: fetcher, cache: cache, validity: make(map[chainhash.Hash]bool),
+		decimals: make(map[chainhash.Hash]byte)}
+	result, err := v.validate(tx, true)
+	if err != nil {
+		return ValidityResult{}, err
+	}
+	return *result, nil
+}
+
+// validate returns the validity of tx.  The contributions of all its inputs
+// are computed only if allInputs is set, otherwise only those needed.
+func (v *slpValidator) validate(tx *wire.MsgTx, allInputs bool) (*ValidityResult, error) {
+	if len(tx.TxOut) == 0 {
+		return &ValidityResult{Reason: "no output"}, nil
+	}
+	m, err := ParseSLP(tx.TxOut[0].PkScript)
+	if err != nil {
+		return &ValidityResult{Reason: err.Error()}, nil
+	}
+	result := &ValidityResult{Message: m}
+
+	sameToken := func(c *SLPInputContribution) bool {
+		return c.TokenID == m.TokenID && c.TokenType == m.TokenType
+	}
+	in := new(big.Int)
+	for i := range tx.TxIn {
+		needed := allInputs
+		switch {
+		case m.TxType == SLPGenesis:
+			needed = needed || (m.TokenType == SLPNFT1Child && i == 0)
+		case m.TxType == SLPMint:
+			needed = needed || !result.Valid
+		default:
+			needed = true
+		}
+		if !needed {
+			break
+		}
+		c, err := v.contribution(tx, i)
+		if err != nil {
+			return nil, err
+		}
+		result.Inputs = append(result.Inputs, *c)
+		switch {
+		case m.TxType == SLPMint && c.MintBaton && sameToken(c):
+			result.Valid = true
+		case m.TxType == SLPSend && sameToken(c):
+			in.Add(in, new(big.Int).SetUint64(c.Amount.Units))
+		}
+	}
+
+	switch m.TxType {
+	case SLPGenesis:
+		result.Valid = true
+		if m.TokenType == SLPNFT1Child {
+			if len(result.Inputs) == 0 || result.Inputs[0].TokenType != SLPNFT1Group || result.Inputs[0].Amount.Units == 0 {
+				result.Valid = false
+				result.Reason = "NFT1 child GENESIS does not spend NFT1 group tokens with its first input"
+			}
+		}
+	case SLPMint:
+		if decimals, ok := v.decimals[m.TokenID]; ok {
+			m.SetDecimals(decimals)
+		}
+		if !result.Valid {
+			result.Reason = "MINT does not spend the mint baton"
+		}
+	case SLPSend:
+		if decimals, ok := v.decimals[m.TokenID]; ok {
+			m.SetDecimals(decimals)
+		}
+		out := new(big.Int)
+		for _, amount := range m.Amounts {
+			out.Add(out, new(big.Int).SetUint64(amount.Units))
+		}
+		result.Valid = in.Cmp(out) >= 0
+		if !result.Valid {
+			result.Reason = fmt.Sprintf("SEND spends %v base units and sends %v", in, out)
+		}
+	}
+	return result, nil
+}
+
+// contribution returns the contribution of input idx of tx.
+func (v *slpValidator) contribution(tx *wire.MsgTx, idx int) (*SLPInputContribution, error) {
+	c := &SLPInputContribution{Index: idx}
+	op := tx.TxIn[idx].PreviousOutPoint
+	if v.fetched == MaxSLPValidationTxs {
+		return nil, fmt.Errorf("%w: more than %d transactions", ErrSLPValidationBudget, MaxSLPValidationTxs)
+	}
+	v.fetched++
+	parent, err := v.fetcher.FetchTx(op.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil || int(op.Index) >= len(parent.TxOut) {
+		return nil, fmt.Errorf("input %d: unknown output %v", idx, op)
+	}
+	m, err := ParseSLP(parent.TxOut[0].PkScript)
+	if err != nil {
+		return c, nil
+	}
+	valid, err := v.valid(parent)
+	if err != nil || !valid {
+		return c, err
+	}
+
+	c.TokenID, c.TokenType = m.TokenID, m.TokenType
+	if m.TxType == SLPGenesis {
+		c.TokenID = op.Hash
+		v.decimals[c.TokenID] = m.Decimals
+	}
+	c.Amount = m.OutputAmount(op.Index)
+	if decimals, ok := v.decimals[c.TokenID]; ok {
+		c.Amount.Decimals = decimals
+	}
+	c.MintBaton = m.MintBatonVout != 0 && m.MintBatonVout == op.Index
+	return c, nil
+}
+
+// valid returns the validity of tx, from the cache if known.
+func (v *slpValidator) valid(tx *wire.MsgTx) (bool, error) {
+	txid := tx.TxHash()
+	if valid, ok := v.validity[txid]; ok {
+		return valid, nil
+	}
+	if v.cache != nil {
+		if valid, ok := v.cache.Get(txid); ok {
+			v.validity[txid] = valid
+			return valid, nil
+		}
+	}
+	result, err := v.validate(tx, false)
+	if err != nil {
+		return false, err
+	}
+	v.validity[txid] = result.Valid
+	if v.cache != nil {
+		v.cache.Put(txid, result.Valid)
+	}
+	return result.Valid, nil
+}
@@ -0,0 +1,172 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testTxFetcher is a TxFetcher of transactions in memory.
+type testTxFetcher map[chainhash.Hash]*wire.MsgTx
+
+func (f testTxFetcher) FetchTx(txid chainhash.Hash) (*wire.MsgTx, error) {
+	if tx, ok := f[txid]; ok {
+		return tx, nil
+	}
+	return nil, errors.New("unknown transaction")
+}
+
+// add returns a transaction with msg, if not nil, in its output 0, spending
+// inputs and with outputs more outputs.
+func (f testTxFetcher) add(t *testing.T, msg *SLPMessage, outputs int, inputs ...wire.OutPoint) *wire.MsgTx {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for i := range inputs {
+		tx.AddTxIn(wire.NewTxIn(&inputs[i], nil, nil))
+	}
+	if msg != nil {
+		script, err := msg.Script()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.AddTxOut(wire.NewTxOut(0, script))
+	}
+	for i := 0; i < outputs; i++ {
+		tx.AddTxOut(wire.NewTxOut(546, pkScript))
+	}
+	f[tx.TxHash()] = tx
+	return tx
+}
+
+// testValidityCache is a ValidityCache counting its hits.
+type testValidityCache struct {
+	validity map[chainhash.Hash]bool
+	hits     int
+}
+
+func (c *testValidityCache) Get(txid chainhash.Hash) (bool, bool) {
+	valid, ok := c.validity[txid]
+	if ok {
+		c.hits++
+	}
+	return valid, ok
+}
+
+func (c *testValidityCache) Put(txid chainhash.Hash, valid bool) {
+	c.validity[txid] = valid
+}
+
+func TestValidateSLPTx(t *testing.T) {
+	f := make(testTxFetcher)
+	funding := f.add(t, nil, 3)
+	op := func(tx *wire.MsgTx, i uint32) wire.OutPoint {
+		return wire.OutPoint{Hash: tx.TxHash(), Index: i}
+	}
+
+	genesis := f.add(t, &SLPMessage{TokenType: SLPFungible, TxType: SLPGenesis, MintBatonVout: 2,
+		Amounts: slpAmounts(0, 1000)}, 2, op(funding, 0))
+	tokenID := genesis.TxHash()
+	send := f.add(t, &SLPMessage{TokenType: SLPFungible, TxType: SLPSend, TokenID: tokenID,
+		Amounts: slpAmounts(0, 600, 400)}, 2, op(genesis, 1))
+	mint := f.add(t, &SLPMessage{TokenType: SLPFungible, TxType: SLPMint, TokenID: tokenID, MintBatonVout: 2,
+		Amounts: slpAmounts(0, 50)}, 2, op(funding, 1), op(genesis, 2))
+	badMint := f.add(t, &SLPMessage{TokenType: SLPFungible, TxType: SLPMint, TokenID: tokenID,
+		Amounts: slpAmounts(0, 50)}, 1, op(genesis, 1))
+	overspend := f.add(t, &SLPMessage{TokenType: SLPFungible, TxType: SLPSend, TokenID: tokenID,
+		Amounts: slpAmounts(0, 401)}, 1, op(send, 2))
+	burn := f.add(t, nil, 1, op(send, 1))
+	merge := f.add(t, &SLPMessage{TokenType: SLPFungible, TxType: SLPSend, TokenID: tokenID,
+		Amounts: slpAmounts(0, 1050)}, 1, op(send, 1), op(mint, 1), op(overspend, 1), op(send, 2), op(funding, 2))
+
+	cache := &testValidityCache{validity: make(map[chainhash.Hash]bool)}
+	for i, test := range []struct {
+		tx    *wire.MsgTx
+		valid bool
+	}{
+		{genesis, true},
+		{send, true},
+		{mint, true},
+		{badMint, false},
+		{overspend, false},
+		{burn, false},
+		{merge, true},
+	} {
+		result, err := ValidateSLPTx(test.tx, f, cache)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if result.Valid != test.valid {
+			t.Errorf("test %d: got valid %v (%s)", i, result.Valid, result.Reason)
+		}
+	}
+
+	result, err := ValidateSLPTx(merge, f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SLPInputContribution{
+		{Index: 0, TokenID: tokenID, TokenType: SLPFungible, Amount: TokenAmount{Units: 600}},
+		{Index: 1, TokenID: tokenID, TokenType: SLPFungible, Amount: TokenAmount{Units: 50}},
+		{Index: 2},
+		{Index: 3, TokenID: tokenID, TokenType: SLPFungible, Amount: TokenAmount{Units: 400}},
+		{Index: 4},
+	}
+	if len(result.Inputs) != len(want) {
+		t.Fatalf("got %d inputs", len(result.Inputs))
+	}
+	for i := range want {
+		if result.Inputs[i] != want[i] {
+			t.Errorf("input %d: got %+v, want %+v", i, result.Inputs[i], want[i])
+		}
+	}
+	if cache.hits == 0 {
+		t.Error("cache not used")
+	}
+
+	group := f.add(t, &SLPMessage{TokenType: SLPNFT1Group, TxType: SLPGenesis, Amounts: slpAmounts(0, 10)}, 1,
+		op(funding, 2))
+	child := f.add(t, &SLPMessage{TokenType: SLPNFT1Child, TxType: SLPGenesis, Amounts: slpAmounts(0, 1)}, 1,
+		op(group, 1))
+	orphan := f.add(t, &SLPMessage{TokenType: SLPNFT1Child, TxType: SLPGenesis, Amounts: slpAmounts(0, 1)}, 1,
+		op(funding, 2), op(group, 1))
+	for i, test := range []struct {
+		tx    *wire.MsgTx
+		valid bool
+	}{{child, true}, {orphan, false}} {
+		if result, err := ValidateSLPTx(test.tx, f, nil); err != nil || result.Valid != test.valid {
+			t.Errorf("NFT1 test %d: got %v, %v", i, result.Valid, err)
+		}
+	}
+
+	// The decimals of the token travel with its amounts.
+	cents := f.add(t, &SLPMessage{TokenType: SLPFungible, TxType: SLPGenesis, Decimals: 2,
+		Amounts: slpAmounts(2, 1000)}, 1, op(funding, 0))
+	spend := f.add(t, &SLPMessage{TokenType: SLPFungible, TxType: SLPSend, TokenID: cents.TxHash(),
+		Amounts: slpAmounts(0, 250)}, 1, op(cents, 1))
+	result, err = ValidateSLPTx(spend, f, nil)
+	if err != nil || !result.Valid {
+		t.Fatalf("got %v, %v", result.Valid, err)
+	}
+	if got := result.Message.OutputAmount(1).String(); got != "2.50" {
+		t.Errorf("got output amount %s, want 2.50", got)
+	}
+	if got := result.Inputs[0].Amount.String(); got != "10.00" {
+		t.Errorf("got input amount %s, want 10.00", got)
+	}
+
+	// Long ancestries exceed the budget unless cached.
+	tip := send
+	for i := 0; i < MaxSLPValidationTxs; i++ {
+		tip = f.add(t, &SLPMessage{TokenType: SLPFungible, TxType: SLPSend, TokenID: tokenID,
+			Amounts: slpAmounts(0, 600)}, 1, op(tip, 1))
+	}
+	if _, err := ValidateSLPTx(tip, f, nil); !errors.Is(err, ErrSLPValidationBudget) {
+		t.Errorf("got %v, want ErrSLPValidationBudget", err)
+	}
+	cache.Put(tip.TxIn[0].PreviousOutPoint.Hash, true)
+	if result, err := ValidateSLPTx(tip, f, cache); err != nil || !result.Valid {
+		t.Errorf("got %v, %v", result.Valid, err)
+	}
+}
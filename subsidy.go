@@ -0,0 +1,80 @@
+package bchutil
+
+import (
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// baseSubsidy is the subsidy of the blocks of the first halving
+	// interval.
+	baseSubsidy = 50 * btcutil.SatoshiPerBitcoin
+
+	// subsidyHalvingInterval is the number of blocks between halvings of
+	// the subsidy on the main network and the test networks.
+	subsidyHalvingInterval = 210000
+
+	// maxHalvings is the number of halvings after which the shift of the
+	// subsidy is out of range, long after it reached zero.
+	maxHalvings = 64
+)
+
+// halvingInterval returns the number of blocks between halvings of the
+// subsidy on the network of params, the main network if nil.
+func halvingInterval(params *chaincfg.Params) int64 {
+	if params == nil || params.SubsidyReductionInterval <= 0 {
+		return subsidyHalvingInterval
+	}
+	return int64(params.SubsidyReductionInterval)
+}
+
+// CalcBlockSubsidy returns the subsidy of the block at height on the network
+// of params, the main network if nil: 50 BCH halved every
+// SubsidyReductionInterval blocks, 210000 but on regtest where it is 150.  The
+// halvings shift the subsidy right, truncating the satoshis as consensus
+// does.
+func CalcBlockSubsidy(height int32, params *chaincfg.Params) btcutil.Amount {
+	if height < 0 {
+		return 0
+	}
+	halvings := int64(height) / halvingInterval(params)
+	if halvings >= maxHalvings {
+		return 0
+	}
+	return btcutil.Amount(int64(baseSubsidy) >> uint(halvings))
+}
+
+// NextHalvingHeight returns the height of the first block after height whose
+// subsidy is halved on the network of params, the main network if nil, or -1
+// once the subsidy is zero.
+func NextHalvingHeight(height int32, params *chaincfg.Params) int32 {
+	if CalcBlockSubsidy(height, params) == 0 && height >= 0 {
+		return -1
+	}
+	if height < 0 {
+		height = 0
+	}
+	interval := halvingInterval(params)
+	return int32((int64(height)/interval + 1) * interval)
+}
+
+// TotalSupplyAt returns the coins issued by the blocks up to height included
+// on the network of params, the main network if nil: the sum of their
+// subsidies, that of the genesis block included although it is not
+// spendable.  It sums whole halving intervals, without floating point.
+func TotalSupplyAt(height int32, params *chaincfg.Params) btcutil.Amount {
+	interval := halvingInterval(params)
+	var total int64
+	for halvings := int64(0); halvings < maxHalvings; halvings++ {
+		start := halvings * interval
+		if start > int64(height) {
+			break
+		}
+		end := start + interval - 1
+		if end > int64(height) {
+			end = int64(height)
+		}
+		total += (end - start + 1) * (int64(baseSubsidy) >> uint(halvings))
+	}
+	return btcutil.Amount(total)
+}
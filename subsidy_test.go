@@ -0,0 +1,88 @@
+package bchutil
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestCalcBlockSubsidy(t *testing.T) {
+	tests := []struct {
+		height  int32
+		params  *chaincfg.Params
+		subsidy btcutil.Amount
+	}{
+		{0, nil, 5000000000},
+		{209999, nil, 5000000000},
+		{210000, nil, 2500000000},
+		{840000, &chaincfg.MainNetParams, 312500000},
+		{840000, &chaincfg.TestNet3Params, 312500000},
+		{32 * 210000, nil, 1},
+		{33 * 210000, nil, 0},
+		{64 * 210000, nil, 0},
+		{-1, nil, 0},
+		{149, &chaincfg.RegressionNetParams, 5000000000},
+		{150, &chaincfg.RegressionNetParams, 2500000000},
+		{450, &chaincfg.RegressionNetParams, 625000000},
+		{64 * 150, &chaincfg.RegressionNetParams, 0},
+	}
+	for _, test := range tests {
+		if got := CalcBlockSubsidy(test.height, test.params); got != test.subsidy {
+			t.Errorf("height %d: got %v, want %v", test.height, got, test.subsidy)
+		}
+	}
+}
+
+func TestNextHalvingHeight(t *testing.T) {
+	tests := []struct {
+		height int32
+		params *chaincfg.Params
+		next   int32
+	}{
+		{-1, nil, 210000},
+		{0, nil, 210000},
+		{209999, nil, 210000},
+		{210000, nil, 420000},
+		{840000, nil, 1050000},
+		{32 * 210000, nil, 33 * 210000},
+		{33 * 210000, nil, -1},
+		{0, &chaincfg.RegressionNetParams, 150},
+		{151, &chaincfg.RegressionNetParams, 300},
+	}
+	for _, test := range tests {
+		if got := NextHalvingHeight(test.height, test.params); got != test.next {
+			t.Errorf("height %d: got %d, want %d", test.height, got, test.next)
+		}
+	}
+}
+
+func TestTotalSupplyAt(t *testing.T) {
+	tests := []struct {
+		height int32
+		params *chaincfg.Params
+		supply btcutil.Amount
+	}{
+		{-1, nil, 0},
+		{0, nil, 5000000000},
+		{209999, nil, 210000 * 5000000000},
+		{210000, nil, 210000*5000000000 + 2500000000},
+		{149, &chaincfg.RegressionNetParams, 150 * 5000000000},
+		{299, &chaincfg.RegressionNetParams, 150*5000000000 + 150*2500000000},
+		// The schedule issues just under 21 million coins.
+		{1 << 30, nil, 2099999997690000},
+	}
+	for _, test := range tests {
+		if got := TotalSupplyAt(test.height, test.params); got != test.supply {
+			t.Errorf("height %d: got %d, want %d", test.height, got, test.supply)
+		}
+	}
+
+	// Each block adds its subsidy.
+	for _, height := range []int32{1, 210000, 630000, 33 * 210000} {
+		diff := TotalSupplyAt(height, nil) - TotalSupplyAt(height-1, nil)
+		if want := CalcBlockSubsidy(height, nil); diff != want {
+			t.Errorf("height %d: supply grew by %d, want %d", height, diff, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package bchutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// SweepResult is the outcome of SweepKey.
+type SweepResult struct {
+	// Tx is the signed transaction paying the swept outputs to the
+	// destination.
+	Tx *wire.MsgTx
+
+	Fee btcutil.Amount
+
+	// Swept is the value of the spent outputs, fee included.
+	Swept btcutil.Amount
+
+	// SkippedTokens are the outputs left unspent because they carry
+	// tokens, which the sweep would burn.
+	SkippedTokens []UTXO
+}
+
+// SweepKey spends all the outputs paying to the pay-to-pubkey-hash addresses
+// of both the compressed and uncompressed public keys of wif, as returned by
+// fetcher, to dest at feeRate.  Outputs carrying tokens are not spent and are
+// reported in the result.  An error wrapping ErrInsufficientFunds is returned
+// when the swept value can't cover the fee and a non-dust output, and one
+// wrapping ErrNetworkMismatch when wif and dest are not for the same network.
+func SweepKey(ctx context.Context, wif *btcutil.WIF, dest btcutil.Address, fetcher UTXOSource,
+	feeRate FeeRate) (*SweepResult, error) {
+
+	if !SameNetwork(wif, dest) {
+		return nil, fmt.Errorf("%w: key for %s, destination %s for %s", ErrNetworkMismatch, networkName(wif),
+			dest, networkName(dest))
+	}
+	destScript, err := PayToAddrScript(dest)
+	if err != nil {
+		return nil, err
+	}
+	pubKey := wif.PrivKey.PubKey()
+	compressedScript, _ := payToPubKeyHashScript(btcutil.Hash160(pubKey.SerializeCompressed()))
+	uncompressedScript, _ := payToPubKeyHashScript(btcutil.Hash160(pubKey.SerializeUncompressed()))
+	utxos, err := fetcher.UTXOs(ctx, [][]byte{compressedScript, uncompressedScript})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SweepResult{Tx: wire.NewMsgTx(wire.TxVersion)}
+	tx := result.Tx
+	var compressed []bool
+	var amounts []int64
+	scriptSigsSize := 0
+	for _, u := range utxos {
+		var isCompressed bool
+		switch {
+		case bytes.Equal(u.PkScript, compressedScript):
+			isCompressed = true
+		case bytes.Equal(u.PkScript, uncompressedScript):
+		default:
+			return nil, errors.New("UTXO source returned an output to an unknown script")
+		}
+		if u.HasTokens() {
+			result.SkippedTokens = append(result.SkippedTokens, u)
+			continue
+		}
+		tx.AddTxIn(wire.NewTxIn(&u.OutPoint, nil, nil))
+		compressed = append(compressed, isCompressed)
+		amounts = append(amounts, int64(u.Amount))
+		if result.Swept, err = AddChecked(result.Swept, u.Amount); err != nil {
+			return nil, err
+		}
+		scriptSigsSize += InputSize(txscript.PubKeyHashTy, InputSizeOptions{Uncompressed: !isCompressed}) -
+			EstimateInputSize(0)
+	}
+	if len(tx.TxIn) == 0 {
+		return nil, fmt.Errorf("%w: no output to sweep", ErrInsufficientFunds)
+	}
+
+	txOut := wire.NewTxOut(0, destScript)
+	tx.AddTxOut(txOut)
+	result.Fee = feeRate.Fee(tx.SerializeSize() + scriptSigsSize)
+	txOut.Value = int64(result.Swept - result.Fee)
+	if IsDust(txOut) {
+		return nil, fmt.Errorf("%w: swept %v for a fee of %v", ErrInsufficientFunds, result.Swept, result.Fee)
+	}
+
+	hashType := txscript.SigHashAll | SigHashForkID
+	for i, txIn := range tx.TxIn {
+		pkScript := uncompressedScript
+		if compressed[i] {
+			pkScript = compressedScript
+		}
+		scriptSig, err := SignatureScript(tx, i, pkScript, hashType, wif.PrivKey, compressed[i], amounts[i])
+		if err != nil {
+			return nil, err
+		}
+		txIn.SignatureScript = scriptSig
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package bchutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestSweepKey(t *testing.T) {
+	key := signingTestKeys()[0]
+	wif, _ := btcutil.NewWIF(key, &chaincfg.MainNetParams, false)
+	compressed, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	uncompressed, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeUncompressed()))
+	source := testUTXOSource{
+		{OutPoint: wireOutPoint(1), Amount: 20000, PkScript: compressed},
+		{OutPoint: wireOutPoint(2), Amount: 30000, PkScript: uncompressed},
+		{OutPoint: wireOutPoint(3), Amount: 1000, PkScript: compressed, TokenData: []byte{0x10}},
+	}
+	dest, _ := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.MainNetParams)
+
+	feeRate := FeeRate(1000)
+	result, err := SweepKey(context.Background(), wif, dest, source, feeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := result.Tx
+	if len(tx.TxIn) != 2 || len(tx.TxOut) != 1 || len(result.SkippedTokens) != 1 {
+		t.Fatalf("got %d inputs, %d outputs and %d skipped outputs", len(tx.TxIn), len(tx.TxOut),
+			len(result.SkippedTokens))
+	}
+	if result.Swept != 50000 || tx.TxOut[0].Value != int64(result.Swept-result.Fee) {
+		t.Errorf("swept %v with a fee of %v, got output %d", result.Swept, result.Fee, tx.TxOut[0].Value)
+	}
+	if result.Fee < feeRate.Fee(tx.SerializeSize()) {
+		t.Errorf("fee %v too low for %d bytes", result.Fee, tx.SerializeSize())
+	}
+	for i, prevOut := range []*UTXO{&source[0], &source[1]} {
+		vm, _ := NewEngine(prevOut.PkScript, tx, i, StandardScriptFlags, nil, int64(prevOut.Amount))
+		if err := vm.Execute(); err != nil {
+			t.Errorf("input %d: %v", i, err)
+		}
+	}
+
+	_, err = SweepKey(context.Background(), wif, dest, source[2:], feeRate)
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+	testnet, _ := NewCashAddressPubKeyHash(make([]byte, 20), &chaincfg.TestNet3Params)
+	if _, err := SweepKey(context.Background(), wif, testnet, source, feeRate); !errors.Is(err,
+		ErrNetworkMismatch) {
+		t.Errorf("got %v, want ErrNetworkMismatch", err)
+	}
+	source[0].Amount, source[1].Amount = 400, 400
+	_, err = SweepKey(context.Background(), wif, dest, source, feeRate)
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+}
+
+func wireOutPoint(b byte) wire.OutPoint {
+	return wire.OutPoint{Hash: chainhash.Hash{b}}
+}
@@ -0,0 +1,168 @@
+package bchutil
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// ErrInvalidTemplate describes an error where a script template can't be
+// compiled.
+var ErrInvalidTemplate = errors.New("invalid script template")
+
+// templateElemKind is the kind of element of a script template.
+type templateElemKind int
+
+const (
+	// templateOpcode matches a non-push opcode.
+	templateOpcode templateElemKind = iota
+
+	// templateData matches a push of the data of the element.
+	templateData
+
+	// templatePush captures a push of any data, of size bytes unless size
+	// is negative.
+	templatePush
+
+	// templateNum captures a push of a minimally encoded number.
+	templateNum
+)
+
+// templateElem is an element of a script template.
+type templateElem struct {
+	kind templateElemKind
+	op   byte
+	data []byte
+	size int
+}
+
+// ScriptTemplate is a compiled script template, matching scripts made of its
+// opcodes and pushes.
+type ScriptTemplate struct {
+	elems []templateElem
+}
+
+// CompileTemplate compiles a template made of space separated opcode names,
+// such as OP_CHECKSIG, data pushes in hex, such as 0x0102, and wildcards
+// capturing pushes, which are:
+//
+//   - <push:N>, a push of exactly N bytes
+//   - <push:any>, a push of any data
+//   - <push:num>, a push of a minimally encoded number of at most 8 bytes
+//
+// The template may be enclosed in brackets, like
+// [OP_DUP OP_HASH160 <push:20> OP_EQUALVERIFY OP_CHECKSIG].  Pushes match the
+// data they push, whatever opcode pushes it: OP_1 and OP_DATA_1 0x01 are the
+// same push, so templates name pushes by their data, and OP_DATA_N and
+// OP_PUSHDATA opcodes are not allowed.
+func CompileTemplate(template string) (*ScriptTemplate, error) {
+	s := strings.TrimSpace(template)
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+	}
+	t := &ScriptTemplate{}
+	for _, token := range strings.Fields(s) {
+		elem, err := compileTemplateElem(token)
+		if err != nil {
+			return nil, err
+		}
+		t.elems = append(t.elems, elem)
+	}
+	if len(t.elems) == 0 {
+		return nil, fmt.Errorf("%w: empty template", ErrInvalidTemplate)
+	}
+	return t, nil
+}
+
+// compileTemplateElem compiles an element of a template.
+func compileTemplateElem(token string) (templateElem, error) {
+	switch {
+	case strings.HasPrefix(token, "<push:") && strings.HasSuffix(token, ">"):
+		class := token[len("<push:") : len(token)-1]
+		switch class {
+		case "any":
+			return templateElem{kind: templatePush, size: -1}, nil
+		case "num":
+			return templateElem{kind: templateNum}, nil
+		}
+		size, err := strconv.Atoi(class)
+		if err != nil || size < 0 || size > MaxScriptElementSize {
+			return templateElem{}, fmt.Errorf("%w: push class %q", ErrInvalidTemplate, class)
+		}
+		return templateElem{kind: templatePush, size: size}, nil
+
+	case strings.HasPrefix(token, "0x"):
+		data, err := hex.DecodeString(token[2:])
+		if err != nil {
+			return templateElem{}, fmt.Errorf("%w: data %q", ErrInvalidTemplate, token)
+		}
+		return templateElem{kind: templateData, data: data}, nil
+	}
+
+	op, ok := opcodeByName[token]
+	if !ok {
+		return templateElem{}, fmt.Errorf("%w: unknown opcode %q", ErrInvalidTemplate, token)
+	}
+	if op > txscript.OP_0 && op <= txscript.OP_PUSHDATA4 {
+		return templateElem{}, fmt.Errorf("%w: %s, push the data instead", ErrInvalidTemplate, token)
+	}
+	if data, ok := pushedData(op, nil); ok {
+		return templateElem{kind: templateData, data: data}, nil
+	}
+	return templateElem{kind: templateOpcode, op: op}, nil
+}
+
+// pushedData returns the data pushed by the opcode op, of data data, and
+// whether op is a push opcode.
+func pushedData(op byte, data []byte) ([]byte, bool) {
+	switch {
+	case op <= txscript.OP_PUSHDATA4:
+		if data == nil {
+			data = []byte{}
+		}
+		return data, true
+	case op == txscript.OP_1NEGATE:
+		return []byte{0x81}, true
+	case op >= txscript.OP_1 && op <= txscript.OP_16:
+		return []byte{op - txscript.OP_1 + 1}, true
+	}
+	return nil, false
+}
+
+// Match returns the pushes of script captured by the wildcards of the
+// template, in order, and whether script is an instance of the template.
+func (t *ScriptTemplate) Match(script []byte) (params [][]byte, ok bool) {
+	ops, err := parseScript(script)
+	if err != nil || len(ops) != len(t.elems) {
+		return nil, false
+	}
+	for i, elem := range t.elems {
+		data, isPush := pushedData(ops[i].value, ops[i].data)
+		switch elem.kind {
+		case templateOpcode:
+			if isPush || ops[i].value != elem.op {
+				return nil, false
+			}
+			continue
+		case templateData:
+			if !isPush || string(data) != string(elem.data) {
+				return nil, false
+			}
+			continue
+		case templatePush:
+			if !isPush || (elem.size >= 0 && len(data) != elem.size) {
+				return nil, false
+			}
+		case templateNum:
+			if !isPush || len(data) > maxScriptNumLen || !isMinimalNum(data) {
+				return nil, false
+			}
+		}
+		params = append(params, data)
+	}
+	return params, true
+}
@@ -0,0 +1,80 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestScriptTemplate(t *testing.T) {
+	p2pkh, err := CompileTemplate("[OP_DUP OP_HASH160 <push:20> OP_EQUALVERIFY OP_CHECKSIG]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := bytes.Repeat([]byte{0xab}, 20)
+	script, _ := payToPubKeyHashScript(hash)
+	params, ok := p2pkh.Match(script)
+	if !ok || len(params) != 1 || !bytes.Equal(params[0], hash) {
+		t.Fatalf("got %x, %v", params, ok)
+	}
+
+	// Alternative encodings of the push match too.
+	pushData1 := append([]byte{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_PUSHDATA1, 20}, hash...)
+	pushData1 = append(pushData1, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG)
+	if params, ok := p2pkh.Match(pushData1); !ok || !bytes.Equal(params[0], hash) {
+		t.Errorf("OP_PUSHDATA1: got %x, %v", params, ok)
+	}
+
+	for i, script := range [][]byte{
+		nil,
+		script[:len(script)-1],
+		append(append([]byte(nil), script...), txscript.OP_NOP),
+		append([]byte{txscript.OP_DUP, txscript.OP_HASH160, 19}, hash[1:]...),
+		{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_16, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG},
+		{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_PUSHDATA1, 20},
+	} {
+		if _, ok := p2pkh.Match(script); ok {
+			t.Errorf("test %d: matched %x", i, script)
+		}
+	}
+
+	covenant, err := CompileTemplate("<push:num> OP_CHECKLOCKTIMEVERIFY OP_DROP OP_2 <push:any> 0xdead OP_CAT OP_SPLIT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		script []byte
+		params [][]byte
+		ok     bool
+	}{
+		{[]byte{3, 0x40, 0x42, 0x0f, 0xb1, 0x75, 0x52, 0, 2, 0xde, 0xad, 0x7e, 0x7f},
+			[][]byte{{0x40, 0x42, 0x0f}, {}}, true},
+		{[]byte{txscript.OP_10, 0xb1, 0x75, 1, 2, txscript.OP_PUSHDATA2, 1, 0, 0xaa, 2, 0xde, 0xad, 0x7e, 0x7f},
+			[][]byte{{10}, {0xaa}}, true},
+		// Non-minimal numbers are not numbers.
+		{[]byte{2, 10, 0, 0xb1, 0x75, 0x52, 0, 2, 0xde, 0xad, 0x7e, 0x7f}, nil, false},
+		{[]byte{9, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0xb1, 0x75, 0x52, 0, 2, 0xde, 0xad, 0x7e, 0x7f}, nil, false},
+		{[]byte{txscript.OP_1, 0xb1, 0x75, 0x52, 0, 2, 0xde, 0xae, 0x7e, 0x7f}, nil, false},
+		{[]byte{txscript.OP_1, 0xb1, 0x75, 0x52, txscript.OP_NOP, 2, 0xde, 0xad, 0x7e, 0x7f}, nil, false},
+	} {
+		params, ok := covenant.Match(test.script)
+		if ok != test.ok || len(params) != len(test.params) {
+			t.Errorf("test %d: got %x, %v", i, params, ok)
+			continue
+		}
+		for j := range params {
+			if !bytes.Equal(params[j], test.params[j]) {
+				t.Errorf("test %d: param %d: got %x, want %x", i, j, params[j], test.params[j])
+			}
+		}
+	}
+
+	for _, template := range []string{"", "[]", "OP_FOO", "OP_DATA_20", "OP_PUSHDATA1", "<push:x>",
+		"<push:-1>", "0xabc"} {
+		if _, err := CompileTemplate(template); !errors.Is(err, ErrInvalidTemplate) {
+			t.Errorf("%q: got %v, want ErrInvalidTemplate", template, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// CashTokens prefix encoding.
+const (
+	// tokenPrefix is the byte starting the token prefix of output scripts.
+	tokenPrefix = 0xef
+
+	tokenReserved         = 0x80
+	tokenHasCommitmentLen = 0x40
+	tokenHasNFT           = 0x20
+	tokenHasAmount        = 0x10
+	tokenCapabilityMask   = 0x0f
+
+	// MaxTokenCommitmentLen is the longest NFT commitment.
+	MaxTokenCommitmentLen = 40
+)
+
+// ErrInvalidTokenPrefix describes an error where the token prefix of an
+// output is not encoded as required by the CashTokens rules.
+var ErrInvalidTokenPrefix = errors.New("invalid token prefix")
+
+// NFTCapability is the capability of a CashTokens NFT.
+type NFTCapability byte
+
+const (
+	// NFTImmutable NFTs can't be changed.
+	NFTImmutable NFTCapability = iota
+
+	// NFTMutable NFTs can be replaced by one NFT of the same category
+	// with any commitment.
+	NFTMutable
+
+	// NFTMinting NFTs can create any NFTs of their category.
+	NFTMinting
+)
+
+// String returns the name of the capability.
+func (c NFTCapability) String() string {
+	switch c {
+	case NFTImmutable:
+		return "none"
+	case NFTMutable:
+		return "mutable"
+	case NFTMinting:
+		return "minting"
+	}
+	return fmt.Sprintf("NFTCapability(%d)", byte(c))
+}
+
+// TokenData holds the tokens carried by an output.
+type TokenData struct {
+	// Category is the category id, in the byte order of transaction
+	// hashes.
+	Category chainhash.Hash
+
+	// Amount is the fungible amount, 0 if none.
+	Amount uint64
+
+	// HasNFT is set for outputs carrying an NFT, with Capability and
+	// Commitment.
+	HasNFT     bool
+	Capability NFTCapability
+	Commitment []byte
+}
+
+// Bytes returns the serialized token prefix, starting with the prefix byte.
+func (t *TokenData) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(tokenPrefix)
+	buf.Write(t.Category[:])
+	var bitfield byte
+	if t.HasNFT {
+		bitfield |= tokenHasNFT | byte(t.Capability)
+		if len(t.Commitment) != 0 {
+			bitfield |= tokenHasCommitmentLen
+		}
+	}
+	if t.Amount != 0 {
+		bitfield |= tokenHasAmount
+	}
+	buf.WriteByte(bitfield)
+	if bitfield&tokenHasCommitmentLen != 0 {
+		wire.WriteVarBytes(&buf, 0, t.Commitment)
+	}
+	if t.Amount != 0 {
+		wire.WriteVarInt(&buf, 0, t.Amount)
+	}
+	return buf.Bytes()
+}
+
+// ParseTokenData parses a token prefix, starting with the prefix byte, and
+// returns the number of bytes read.
+func ParseTokenData(prefix []byte) (*TokenData, int, error) {
+	if len(prefix) < 1+chainhash.HashSize+1 || prefix[0] != tokenPrefix {
+		return nil, 0, fmt.Errorf("%w: too short", ErrInvalidTokenPrefix)
+	}
+	t := &TokenData{}
+	copy(t.Category[:], prefix[1:])
+	bitfield := prefix[1+chainhash.HashSize]
+	r := bytes.NewReader(prefix[2+chainhash.HashSize:])
+
+	switch {
+	case bitfield&tokenReserved != 0:
+		return nil, 0, fmt.Errorf("%w: reserved bit set", ErrInvalidTokenPrefix)
+	case bitfield&(tokenHasNFT|tokenHasAmount) == 0:
+		return nil, 0, fmt.Errorf("%w: no NFT nor amount", ErrInvalidTokenPrefix)
+	case bitfield&tokenHasNFT == 0 && bitfield&(tokenHasCommitmentLen|tokenCapabilityMask) != 0:
+		return nil, 0, fmt.Errorf("%w: commitment or capability without NFT", ErrInvalidTokenPrefix)
+	case bitfield&tokenCapabilityMask > byte(NFTMinting):
+		return nil, 0, fmt.Errorf("%w: unknown capability %d", ErrInvalidTokenPrefix,
+			bitfield&tokenCapabilityMask)
+	}
+	t.HasNFT = bitfield&tokenHasNFT != 0
+	t.Capability = NFTCapability(bitfield & tokenCapabilityMask)
+
+	if bitfield&tokenHasCommitmentLen != 0 {
+		n, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: commitment length: %v", ErrInvalidTokenPrefix, err)
+		}
+		if n == 0 || n > MaxTokenCommitmentLen {
+			return nil, 0, fmt.Errorf("%w: commitment of %d bytes", ErrInvalidTokenPrefix, n)
+		}
+		t.Commitment = make([]byte, n)
+		if _, err := io.ReadFull(r, t.Commitment); err != nil {
+			return nil, 0, fmt.Errorf("%w: commitment: %v", ErrInvalidTokenPrefix, err)
+		}
+	}
+	if bitfield&tokenHasAmount != 0 {
+		amount, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: amount: %v", ErrInvalidTokenPrefix, err)
+		}
+		if amount == 0 || amount > math.MaxInt64 {
+			return nil, 0, fmt.Errorf("%w: amount %d", ErrInvalidTokenPrefix, amount)
+		}
+		t.Amount = amount
+	}
+	return t, len(prefix) - r.Len(), nil
+}
+
+// SplitTokenPrefix splits the script of an output, as serialized in
+// transactions, in its token data, nil if none, and its locking script.
+func SplitTokenPrefix(pkScript []byte) (*TokenData, []byte, error) {
+	if len(pkScript) == 0 || pkScript[0] != tokenPrefix {
+		return nil, pkScript, nil
+	}
+	t, n, err := ParseTokenData(pkScript)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, pkScript[n:], nil
+}
+
+// Token returns the tokens carried by the output, nil if none.
+func (u *UTXO) Token() (*TokenData, error) {
+	if !u.HasTokens() {
+		return nil, nil
+	}
+	t, n, err := ParseTokenData(u.TokenData)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(u.TokenData) {
+		return nil, fmt.Errorf("%w: trailing bytes", ErrInvalidTokenPrefix)
+	}
+	return t, nil
+}
@@ -0,0 +1,62 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+func TestTokenData(t *testing.T) {
+	category := chainhash.Hash{0xbb, 0xbb}
+	tests := []*TokenData{
+		{Category: category, Amount: 1},
+		{Category: category, Amount: 253},
+		{Category: category, Amount: 9223372036854775807},
+		{Category: category, HasNFT: true},
+		{Category: category, HasNFT: true, Capability: NFTMinting, Amount: 1000},
+		{Category: category, HasNFT: true, Capability: NFTMutable, Commitment: []byte{0xcc}},
+		{Category: category, HasNFT: true, Commitment: bytes.Repeat([]byte{0xcc}, 40), Amount: 5},
+	}
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	for i, test := range tests {
+		prefix := test.Bytes()
+		got, n, err := ParseTokenData(append(prefix, pkScript...))
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if n != len(prefix) || !reflect.DeepEqual(got, test) {
+			t.Errorf("test %d: got %+v after %d bytes, want %+v", i, got, n, test)
+		}
+		_, script, err := SplitTokenPrefix(append(prefix, pkScript...))
+		if err != nil || !bytes.Equal(script, pkScript) {
+			t.Errorf("test %d: got script %x, %v", i, script, err)
+		}
+	}
+
+	// Bitfield and trailing fields, after the prefix byte and category.
+	for i, test := range []string{
+		"",
+		"00",
+		"80",
+		"b0",
+		"40",
+		"11",
+		"2301",
+		"6000",
+		"6029" + hex.EncodeToString(make([]byte, 41)),
+		"6002cc",
+		"1000",
+		"10fd0100",
+		"10ff0000000000000080",
+	} {
+		b, _ := hex.DecodeString(test)
+		prefix := append(append([]byte{tokenPrefix}, category[:]...), b...)
+		if _, _, err := ParseTokenData(prefix); !errors.Is(err, ErrInvalidTokenPrefix) {
+			t.Errorf("test %d: got %v, want ErrInvalidTokenPrefix", i, err)
+		}
+	}
+}
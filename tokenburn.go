@@ -0,0 +1,100 @@
+package bchutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// BurnReport summarizes the tokens of a category destroyed by a transaction.
+type BurnReport struct {
+	Category chainhash.Hash
+
+	// Fungible is the fungible amount destroyed.
+	Fungible uint64
+
+	// NFTs are the NFTs destroyed, with their capability and commitment.
+	NFTs []*TokenData
+}
+
+// String returns a summary of the tokens destroyed.
+func (r *BurnReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "category %v: %d fungible tokens", r.Category, r.Fungible)
+	for _, t := range r.NFTs {
+		fmt.Fprintf(&b, ", %v NFT %x", t.Capability, t.Commitment)
+	}
+	return b.String()
+}
+
+// DetectTokenBurns returns, by category in the order of inputs, the tokens of
+// inputs that outputs don't send and that the transaction destroys.  Outputs
+// breaking the rules of ValidateTokenTransition are rejected with a
+// *TokenTransitionError.
+func DetectTokenBurns(inputs []UTXO, outputs []*wire.TxOut) ([]BurnReport, error) {
+	tt, err := checkTokenTransition(inputs, outputs)
+	if err != nil {
+		return nil, err
+	}
+	var reports []BurnReport
+	for _, category := range tt.categories {
+		unsent := tt.unsent[category]
+		if unsent.amount == 0 && len(unsent.nfts) == 0 {
+			continue
+		}
+		reports = append(reports, BurnReport{Category: category, Fungible: unsent.amount, NFTs: unsent.nfts})
+	}
+	return reports, nil
+}
+
+// checkTokenBurns returns an error wrapping ErrTokenBurn if outputs, spending
+// inputs, destroy tokens of categories not in allowed.
+func checkTokenBurns(inputs []UTXO, outputs []*wire.TxOut, allowed map[chainhash.Hash]bool) error {
+	reports, err := DetectTokenBurns(inputs, outputs)
+	if err != nil {
+		return err
+	}
+	var burns []string
+	for _, r := range reports {
+		if !allowed[r.Category] {
+			burns = append(burns, r.String())
+		}
+	}
+	if len(burns) != 0 {
+		return fmt.Errorf("%w: %s", ErrTokenBurn, strings.Join(burns, "; "))
+	}
+	return nil
+}
+
+// AllowTokenBurn makes the functions signing whole transactions, such as
+// SignInputsWithPaths, sign transactions destroying the tokens of categories.
+// Without it, they fail with an error wrapping ErrTokenBurn when the tokens of
+// the spent outputs are known, and their outputs don't send all of them.
+func AllowTokenBurn(categories ...chainhash.Hash) SignOption {
+	return func(o *signOptions) {
+		if o.allowTokenBurn == nil {
+			o.allowTokenBurn = make(map[chainhash.Hash]bool)
+		}
+		for _, category := range categories {
+			o.allowTokenBurn[category] = true
+		}
+	}
+}
+
+// checkTokenBurns checks that tx, spending the outputs of prevOuts, doesn't
+// destroy tokens of categories not allowed by o.  Transactions are not checked
+// when prevOuts doesn't hold the outputs spent by all their inputs.
+func (o *signOptions) checkTokenBurns(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut) error {
+	for i := range tx.TxIn {
+		if prevOuts[i] == nil {
+			return nil
+		}
+	}
+	utxos, err := prevOutUTXOs(tx, prevOuts)
+	if err != nil {
+		return err
+	}
+	return checkTokenBurns(utxos, tx.TxOut, o.allowTokenBurn)
+}
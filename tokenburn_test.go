@@ -0,0 +1,83 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestDetectTokenBurns(t *testing.T) {
+	dest, _ := payToPubKeyHashScript(make([]byte, 20))
+	category, other := chainhash.Hash{0xaa}, chainhash.Hash{0xbb}
+	inputs := []UTXO{
+		tokenTestUTXO(1, &TokenData{Category: category, Amount: 100}),
+		tokenTestUTXO(2, &TokenData{Category: other, HasNFT: true, Commitment: []byte{1}}),
+		tokenTestUTXO(3, &TokenData{Category: category, HasNFT: true, Capability: NFTMutable, Commitment: []byte{2}}),
+		tokenTestUTXO(4, &TokenData{Category: other, HasNFT: true, Commitment: []byte{3}}),
+	}
+	outputs := []*wire.TxOut{
+		tokenChangeOutput(&TokenData{Category: category, Amount: 60}, dest),
+		tokenChangeOutput(&TokenData{Category: other, HasNFT: true, Commitment: []byte{3}}, dest),
+		wire.NewTxOut(1000, dest),
+	}
+	reports, err := DetectTokenBurns(inputs, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("got %d reports, want 2", len(reports))
+	}
+	if r := reports[0]; r.Category != category || r.Fungible != 40 || len(r.NFTs) != 1 ||
+		r.NFTs[0].Capability != NFTMutable || !bytes.Equal(r.NFTs[0].Commitment, []byte{2}) {
+		t.Errorf("got %v", r.String())
+	}
+	if r := reports[1]; r.Category != other || r.Fungible != 0 || len(r.NFTs) != 1 ||
+		!bytes.Equal(r.NFTs[0].Commitment, []byte{1}) {
+		t.Errorf("got %v", r.String())
+	}
+
+	if err := checkTokenBurns(inputs, outputs, map[chainhash.Hash]bool{category: true}); !errors.Is(err, ErrTokenBurn) {
+		t.Errorf("got %v, want ErrTokenBurn", err)
+	}
+	if err := checkTokenBurns(inputs, outputs, map[chainhash.Hash]bool{category: true, other: true}); err != nil {
+		t.Error(err)
+	}
+	if reports, err := DetectTokenBurns(inputs[:1], outputs[:1]); err != nil || len(reports) != 1 {
+		t.Errorf("got %v, %v", reports, err)
+	}
+}
+
+func TestSignTokenBurn(t *testing.T) {
+	master := descTestKey()
+	var keys []*btcec.PrivateKey
+	for i := uint32(0); i < 2; i++ {
+		key, err := BIP44Path(0, 0, i).Derive(master)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, _ := key.ECPrivKey()
+		keys = append(keys, priv)
+	}
+	category := chainhash.Hash{0xaa}
+	req := signingTestRequest(keys)
+	req.Inputs[1].TokenData = (&TokenData{Category: category, Amount: 10}).Bytes()
+	if _, err := req.Sign(master); !errors.Is(err, ErrTokenBurn) {
+		t.Fatalf("got %v, want ErrTokenBurn", err)
+	}
+	if _, err := req.Sign(master, AllowTokenBurn(category), AllowDangerousSigHash(txscript.SigHashSingle)); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := map[int]Path{0: BIP44Path(0, ExternalChain, 0)}
+	tx, prevOuts := pathSignTestTx(t, paths)
+	prevOuts[0].PkScript = append((&TokenData{Category: category, Amount: 10}).Bytes(), prevOuts[0].PkScript...)
+	err := SignInputsWithPaths(tx, prevOuts, txscript.SigHashAll|SigHashForkID, nil, master, paths)
+	if !errors.Is(err, ErrTokenBurn) {
+		t.Fatalf("got %v, want ErrTokenBurn", err)
+	}
+}
@@ -0,0 +1,120 @@
+package bchutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrTokenBurn describes an error where a transaction would destroy tokens
+// of its inputs that were not explicitly allowed to be burned.
+var ErrTokenBurn = errors.New("tokens burned")
+
+// tokenChange returns the outputs sending to changeScript the tokens of inputs
+// not sent by outputs, each NFT in its own output and the fungible tokens of
+// every category in another one, paying the dust threshold.  Tokens of the
+// categories of allowBurn are burned instead.  Outputs breaking the rules of
+// ValidateTokenTransition are rejected.  Without changeScript, the tokens to
+// return fail with an error wrapping ErrTokenBurn.
+func tokenChange(inputs []UTXO, outputs []*wire.TxOut, changeScript []byte,
+	allowBurn map[chainhash.Hash]bool) ([]*wire.TxOut, error) {
+
+	tt, err := checkTokenTransition(inputs, outputs)
+	if err != nil {
+		return nil, err
+	}
+	var change []*wire.TxOut
+	for _, category := range tt.categories {
+		amount, nfts := tt.unsent[category].amount, tt.unsent[category].nfts
+		if (amount == 0 && len(nfts) == 0) || allowBurn[category] {
+			continue
+		}
+		if len(changeScript) == 0 {
+			return nil, fmt.Errorf("%w: no token change script for %d fungible tokens and %d NFTs of "+
+				"category %v", ErrTokenBurn, amount, len(nfts), category)
+		}
+		for _, t := range nfts {
+			change = append(change, tokenChangeOutput(&TokenData{Category: category, HasNFT: true,
+				Capability: t.Capability, Commitment: t.Commitment}, changeScript))
+		}
+		if amount != 0 {
+			change = append(change, tokenChangeOutput(&TokenData{Category: category, Amount: amount},
+				changeScript))
+		}
+	}
+	return change, nil
+}
+
+// tokenChangeOutput returns the output sending t to pkScript, paying the dust
+// threshold.
+func tokenChangeOutput(t *TokenData, pkScript []byte) *wire.TxOut {
+	pkScript = append(t.Bytes(), pkScript...)
+	return wire.NewTxOut(int64(DustThreshold(pkScript)), pkScript)
+}
+
+// AddTokenInputs makes the transaction spend utxos, such as the token inputs
+// selected by SelectTokenCoins, whatever their value.  The tokens they carry
+// that the outputs don't send are returned to the script set by
+// SetTokenChange, and Build fails if an output sends tokens they don't carry.
+// To create a category, spend the output 0 of the transaction whose hash is
+// its id with AddTokenInputs.
+func (b *TxBuilder) AddTokenInputs(utxos ...UTXO) {
+	b.tokenInputs = append(b.tokenInputs, utxos...)
+}
+
+// SetTokenChange sets the script receiving the tokens of the token inputs not
+// sent by the outputs.  It should be the script of a token-aware address of
+// the wallet.  Without token change script, Build fails rather than burning
+// them, unless allowed by AllowTokenBurn.
+func (b *TxBuilder) SetTokenChange(pkScript []byte) {
+	b.tokenChangeScript = pkScript
+}
+
+// AllowTokenBurn makes the builder burn the tokens of categories not sent by
+// the outputs, instead of returning them to the token change script.
+func (b *TxBuilder) AllowTokenBurn(categories ...chainhash.Hash) {
+	if b.allowTokenBurn == nil {
+		b.allowTokenBurn = make(map[chainhash.Hash]bool)
+	}
+	for _, category := range categories {
+		b.allowTokenBurn[category] = true
+	}
+}
+
+// addTokenInputs adds the token inputs to u, followed by the token change
+// outputs.
+func (b *TxBuilder) addTokenInputs(u *UnsignedTx) error {
+	change, err := tokenChange(b.tokenInputs, b.outputs, b.tokenChangeScript, b.allowTokenBurn)
+	if err != nil {
+		return err
+	}
+	for _, utxo := range b.tokenInputs {
+		if _, err := AddInputFromUTXO(u, utxo); err != nil {
+			return err
+		}
+	}
+	for _, txOut := range change {
+		u.TokenChange = append(u.TokenChange, len(u.Tx.TxOut))
+		u.Tx.AddTxOut(txOut)
+	}
+	return nil
+}
+
+// fundingPool returns the outputs funding the transaction, those without
+// tokens that are not token inputs and that the spend policy spends, largest
+// first.
+func (b *TxBuilder) fundingPool() []UTXO {
+	spent := make(map[wire.OutPoint]bool, len(b.tokenInputs))
+	for _, u := range b.tokenInputs {
+		spent[u.OutPoint] = true
+	}
+	var utxos []UTXO
+	for _, u := range b.utxos {
+		if !spent[u.OutPoint] {
+			utxos = append(utxos, u)
+		}
+	}
+	return selectionPool(utxos, b.fundingPolicy())
+}
@@ -0,0 +1,144 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestTokenChange(t *testing.T) {
+	pkScript, _ := payToPubKeyHashScript(make([]byte, 20))
+	tokenChangeScript, _ := payToPubKeyHashScript(bytes.Repeat([]byte{1}, 20))
+	dest, _ := payToPubKeyHashScript(bytes.Repeat([]byte{2}, 20))
+	category, other := chainhash.Hash{0xaa}, chainhash.Hash{0xbb}
+	tokenOutput := func(t *TokenData) *wire.TxOut {
+		return tokenChangeOutput(t, dest)
+	}
+
+	build := func(tokenInputs []UTXO, outputs ...*wire.TxOut) (*TxBuilder, *UnsignedTx, error) {
+		b := NewTxBuilder(1000, pkScript)
+		b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{0xff}, Index: 1}, Amount: 100000,
+			PkScript: pkScript})
+		b.AddTokenInputs(tokenInputs...)
+		b.SetTokenChange(tokenChangeScript)
+		for _, txOut := range outputs {
+			b.AddOutput(txOut)
+		}
+		u, err := b.Build()
+		return b, u, err
+	}
+	tokenInputs := []UTXO{
+		tokenTestUTXO(1, &TokenData{Category: category, Amount: 100}),
+		tokenTestUTXO(2, &TokenData{Category: category, Amount: 20, HasNFT: true, Commitment: []byte{1}}),
+		tokenTestUTXO(3, &TokenData{Category: other, HasNFT: true, Capability: NFTMinting}),
+	}
+
+	_, u, err := build(tokenInputs, tokenOutput(&TokenData{Category: category, Amount: 70}),
+		tokenOutput(&TokenData{Category: other, HasNFT: true, Commitment: []byte{2}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []*TokenData
+	for _, i := range u.TokenChange {
+		token, script, err := SplitTokenPrefix(u.Tx.TxOut[i].PkScript)
+		if err != nil || !bytes.Equal(script, tokenChangeScript) || IsDust(u.Tx.TxOut[i]) {
+			t.Fatalf("token change %d: %x, %v", i, u.Tx.TxOut[i].PkScript, err)
+		}
+		got = append(got, token)
+	}
+	want := []*TokenData{
+		{Category: category, HasNFT: true, Commitment: []byte{1}},
+		{Category: category, Amount: 50},
+		{Category: other, HasNFT: true, Capability: NFTMinting},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d token change outputs, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i].Bytes(), want[i].Bytes()) {
+			t.Errorf("token change %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if len(u.Tx.TxIn) != 4 || u.ChangeIndex != 5 || u.Fee > btcutil.Amount(2*u.Size) {
+		t.Errorf("got %d inputs, change %d, fee %v for %d bytes", len(u.Tx.TxIn), u.ChangeIndex, u.Fee, u.Size)
+	}
+	if err := u.ValidatePolicy(); err != nil {
+		t.Error(err)
+	}
+
+	for i, test := range []struct {
+		outputs []*wire.TxOut
+		err     error
+	}{
+		{[]*wire.TxOut{tokenOutput(&TokenData{Category: category, Amount: 121})}, ErrInsufficientTokens},
+		{[]*wire.TxOut{tokenOutput(&TokenData{Category: chainhash.Hash{0xcc}, Amount: 1})}, ErrUnknownTokenCategory},
+		{[]*wire.TxOut{tokenOutput(&TokenData{Category: category, HasNFT: true, Commitment: []byte{2}})},
+			ErrNFTNotFound},
+		{[]*wire.TxOut{tokenOutput(&TokenData{Category: category, HasNFT: true, Capability: NFTMutable,
+			Commitment: []byte{1}})}, ErrNFTNotFound},
+	} {
+		if _, _, err := build(tokenInputs, test.outputs...); !errors.Is(err, test.err) {
+			t.Errorf("test %d: got %v, want %v", i, err, test.err)
+		}
+	}
+
+	// Tokens not sent are burned only when allowed.
+	b := NewTxBuilder(1000, pkScript)
+	b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Index: 1}, Amount: 100000, PkScript: pkScript})
+	b.AddTokenInputs(tokenInputs[:2]...)
+	b.AddOutput(wire.NewTxOut(10000, dest))
+	if _, err := b.Build(); !errors.Is(err, ErrTokenBurn) {
+		t.Errorf("got %v, want ErrTokenBurn", err)
+	}
+	b.AllowTokenBurn(category)
+	if u, err := b.Build(); err != nil || len(u.TokenChange) != 0 {
+		t.Errorf("got %v", err)
+	}
+
+	// A category is created by spending the output 0 of its id.
+	genesis := UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{0xdd}}, Amount: btcutil.Amount(5000),
+		PkScript: pkScript}
+	_, u, err = build([]UTXO{genesis}, tokenOutput(&TokenData{Category: genesis.OutPoint.Hash, Amount: 1000,
+		HasNFT: true, Capability: NFTMinting}))
+	if err != nil || len(u.TokenChange) != 0 {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestTokenChangeSign(t *testing.T) {
+	key := signingTestKeys()[0]
+	wif, _ := btcutil.NewWIF(key, &chaincfg.MainNetParams, true)
+	pkScript, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	token := &TokenData{Category: chainhash.Hash{0xaa}, Amount: 100}
+
+	b := NewTxBuilder(1000, pkScript)
+	b.AddUTXOs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{0xff}}, Amount: 100000, PkScript: pkScript})
+	b.AddTokenInputs(UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{0xfe}}, Amount: 1000, PkScript: pkScript,
+		TokenData: token.Bytes()})
+	b.SetTokenChange(pkScript)
+	b.AddOutput(wire.NewTxOut(50000, pkScript))
+	u, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kdb, _ := NewWIFKeyDB(&chaincfg.MainNetParams, wif)
+	if err := u.Sign(&chaincfg.MainNetParams, kdb, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The token input signs the token prefix of its output.
+	for i, prevOut := range u.PrevOuts {
+		vm, err := NewEngine(prevOut.PkScript, u.Tx, i, StandardScriptFlags, nil, prevOut.Value)
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			t.Errorf("input %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+var (
+	// ErrUnknownTokenCategory describes an error where an output carries
+	// tokens of a category that is neither carried by the inputs nor
+	// created by the transaction.
+	ErrUnknownTokenCategory = errors.New("token category not in the inputs")
+
+	// ErrTokenAmountOverflow describes an error where the fungible amounts
+	// of a category exceed the largest amount.
+	ErrTokenAmountOverflow = errors.New("fungible token amount overflow")
+
+	// ErrNFTMinting describes an error where an output carries a minting
+	// NFT, or an NFT that must be minted, without a minting NFT of the
+	// category in the inputs.
+	ErrNFTMinting = errors.New("NFT created without a minting NFT")
+)
+
+// TokenTransitionError describes an output breaking the CashTokens rules.
+type TokenTransitionError struct {
+	Output   int
+	Category chainhash.Hash
+
+	// Err wraps the error of the rule broken, such as ErrInsufficientTokens
+	// or ErrNFTMinting.
+	Err error
+}
+
+// Error returns the output, category and rule broken.
+func (e *TokenTransitionError) Error() string {
+	return fmt.Sprintf("output %d, category %v: %v", e.Output, e.Category, e.Err)
+}
+
+// Unwrap returns the error of the rule broken.
+func (e *TokenTransitionError) Unwrap() error {
+	return e.Err
+}
+
+// tokenBalance holds the tokens of a category carried by inputs or outputs.
+type tokenBalance struct {
+	amount uint64
+	nfts   []*TokenData
+
+	// outputs are the indexes of the outputs carrying the NFTs.
+	outputs []int
+}
+
+// add adds the tokens of t to the balance.
+func (b *tokenBalance) add(t *TokenData) error {
+	if t.Amount > math.MaxInt64-b.amount {
+		return fmt.Errorf("%w: more than %d", ErrTokenAmountOverflow, uint64(math.MaxInt64))
+	}
+	b.amount += t.Amount
+	if t.HasNFT {
+		b.nfts = append(b.nfts, t)
+	}
+	return nil
+}
+
+// matchNFTs returns the NFTs of in not spent to create the NFTs of out, or the
+// index in out of the first NFT they can't create.  Identical NFTs are
+// matched first, then the others are created from mutable NFTs unless in
+// holds a minting NFT, which can create any number of NFTs.
+func matchNFTs(in, out []*TokenData) ([]*TokenData, int) {
+	remaining := append([]*TokenData(nil), in...)
+	minting := false
+	for _, t := range in {
+		minting = minting || t.Capability == NFTMinting
+	}
+	created := make([]bool, len(out))
+	for i, t := range out {
+		for j, r := range remaining {
+			if r.Capability == t.Capability && bytes.Equal(r.Commitment, t.Commitment) {
+				remaining = append(remaining[:j], remaining[j+1:]...)
+				created[i] = true
+				break
+			}
+		}
+	}
+	for i, t := range out {
+		if created[i] || minting {
+			continue
+		}
+		mutable := -1
+		for j, r := range remaining {
+			if r.Capability == NFTMutable {
+				mutable = j
+				break
+			}
+		}
+		if mutable < 0 || t.Capability == NFTMinting {
+			return nil, i
+		}
+		remaining = append(remaining[:mutable], remaining[mutable+1:]...)
+	}
+	return remaining, -1
+}
+
+// tokenTransition holds the tokens of the inputs of a transaction that its
+// outputs don't send.
+type tokenTransition struct {
+	// categories are the categories of the inputs, in order.
+	categories []chainhash.Hash
+	unsent     map[chainhash.Hash]*tokenBalance
+}
+
+// ValidateTokenTransition checks that outputs, spending inputs, follow the
+// CashTokens rules:
+//
+//   - token prefixes are valid
+//   - outputs only carry tokens of the categories of the inputs, or created by
+//     the transaction, whose id is the hash of an input spending the output 0
+//     of a transaction
+//   - the fungible amounts of a category sum to at most the largest amount
+//   - outputs send at most the fungible amounts of the inputs, unless the
+//     category is created
+//   - every input NFT is sent unchanged at most once, and immutable NFTs can't
+//     be changed
+//   - every mutable input NFT can be replaced by one mutable or immutable NFT
+//     of any commitment
+//   - minting input NFTs can create any NFTs, and other NFTs can't create
+//     minting ones
+//
+// Outputs breaking a rule are reported with a *TokenTransitionError.
+func ValidateTokenTransition(inputs []UTXO, outputs []*wire.TxOut) error {
+	_, err := checkTokenTransition(inputs, outputs)
+	return err
+}
+
+// checkTokenTransition validates the transition like ValidateTokenTransition
+// and returns the tokens of the inputs not sent.
+func checkTokenTransition(inputs []UTXO, outputs []*wire.TxOut) (*tokenTransition, error) {
+	tt := &tokenTransition{unsent: make(map[chainhash.Hash]*tokenBalance)}
+	genesis := make(map[chainhash.Hash]bool)
+	for i, u := range inputs {
+		if u.OutPoint.Index == 0 {
+			genesis[u.OutPoint.Hash] = true
+		}
+		t, err := u.Token()
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		if t == nil {
+			continue
+		}
+		bal := tt.unsent[t.Category]
+		if bal == nil {
+			bal = &tokenBalance{}
+			tt.unsent[t.Category] = bal
+			tt.categories = append(tt.categories, t.Category)
+		}
+		if err := bal.add(t); err != nil {
+			return nil, fmt.Errorf("input %d, category %v: %w", i, t.Category, err)
+		}
+	}
+
+	// outCategories are the categories of the outputs, in order.
+	var outCategories []chainhash.Hash
+	out := make(map[chainhash.Hash]*tokenBalance)
+	for i, txOut := range outputs {
+		t, _, err := SplitTokenPrefix(txOut.PkScript)
+		if err != nil {
+			return nil, fmt.Errorf("output %d: %w", i, err)
+		}
+		if t == nil {
+			continue
+		}
+		in := tt.unsent[t.Category]
+		if !genesis[t.Category] && in == nil {
+			return nil, &TokenTransitionError{i, t.Category, ErrUnknownTokenCategory}
+		}
+		bal := out[t.Category]
+		if bal == nil {
+			bal = &tokenBalance{}
+			out[t.Category] = bal
+			outCategories = append(outCategories, t.Category)
+		}
+		if err := bal.add(t); err != nil {
+			return nil, &TokenTransitionError{i, t.Category, err}
+		}
+		if in != nil && bal.amount > in.amount {
+			return nil, &TokenTransitionError{i, t.Category, fmt.Errorf("%w: outputs send %d, inputs carry %d",
+				ErrInsufficientTokens, bal.amount, in.amount)}
+		}
+		if t.HasNFT {
+			bal.outputs = append(bal.outputs, i)
+		}
+	}
+
+	for _, category := range outCategories {
+		in, bal := tt.unsent[category], out[category]
+		if in == nil {
+			// Categories created by the transaction.
+			continue
+		}
+		nfts, failed := matchNFTs(in.nfts, bal.nfts)
+		if failed >= 0 {
+			err := fmt.Errorf("%w: identical NFT not in the inputs, nor mutable NFT to change", ErrNFTNotFound)
+			if bal.nfts[failed].Capability == NFTMinting {
+				err = fmt.Errorf("%w: minting capability requires a minting NFT", ErrNFTMinting)
+			}
+			return nil, &TokenTransitionError{bal.outputs[failed], category, err}
+		}
+		in.amount -= bal.amount
+		in.nfts = nfts
+	}
+	return tt, nil
+}
+
+// prevOutUTXOs returns the outputs spent by the inputs of tx, whose scripts in
+// prevOuts may start with a token prefix.
+func prevOutUTXOs(tx *wire.MsgTx, prevOuts map[int]*wire.TxOut) ([]UTXO, error) {
+	utxos := make([]UTXO, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		prevOut, ok := prevOuts[i]
+		if !ok || prevOut == nil {
+			return nil, fmt.Errorf("no previous output for input %d", i)
+		}
+		t, pkScript, err := SplitTokenPrefix(prevOut.PkScript)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		utxos[i] = UTXO{OutPoint: txIn.PreviousOutPoint, Amount: btcutil.Amount(prevOut.Value), PkScript: pkScript}
+		if t != nil {
+			utxos[i].TokenData = prevOut.PkScript[:len(prevOut.PkScript)-len(pkScript)]
+		}
+	}
+	return utxos, nil
+}
+
+// ValidateTokenTransition runs ValidateTokenTransition on the transaction.
+func (u *UnsignedTx) ValidateTokenTransition() error {
+	utxos, err := prevOutUTXOs(u.Tx, u.PrevOuts)
+	if err != nil {
+		return err
+	}
+	return ValidateTokenTransition(utxos, u.Tx.TxOut)
+}
+
+// TokenCategoryAccounting is the balance of a token category in a transaction.
+type TokenCategoryAccounting struct {
+	Category chainhash.Hash
+
+	// Genesis is set for the categories created by the transaction, which
+	// its inputs don't carry.
+	Genesis bool
+
+	// InputAmount and OutputAmount are the fungible amounts of the inputs
+	// and outputs, and BurnedAmount the one of the inputs not sent.
+	InputAmount  uint64
+	OutputAmount uint64
+	BurnedAmount uint64
+
+	// InputNFTs and OutputNFTs are the numbers of NFTs of the inputs and
+	// outputs, and BurnedNFTs the number of input NFTs not sent nor used
+	// to create output NFTs.
+	InputNFTs  int
+	OutputNFTs int
+	BurnedNFTs int
+}
+
+// TokenValidationResult is the token accounting of a transaction checked by
+// ValidateTokenTx.
+type TokenValidationResult struct {
+	// Categories are the categories of the inputs, in order, followed by
+	// those created by the transaction, in the order of the outputs.
+	Categories []*TokenCategoryAccounting
+}
+
+// Category returns the accounting of category, or nil if the transaction
+// neither spends nor sends tokens of it.
+func (r *TokenValidationResult) Category(category chainhash.Hash) *TokenCategoryAccounting {
+	for _, acc := range r.Categories {
+		if acc.Category == category {
+			return acc
+		}
+	}
+	return nil
+}
+
+// ValidateTokenTx checks that tx follows the CashTokens consensus rules, as
+// ValidateTokenTransition does, spending the outputs returned by fetcher, and
+// returns the accounting of every category.  Inputs whose output fetcher
+// doesn't know fail.
+func ValidateTokenTx(tx *wire.MsgTx, fetcher PrevOutputFetcher) (*TokenValidationResult, error) {
+	prevOuts := make(map[int]*wire.TxOut, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		prevOut := fetcher.FetchPrevOutput(txIn.PreviousOutPoint)
+		if prevOut == nil {
+			return nil, fmt.Errorf("no previous output for input %d, %v", i, txIn.PreviousOutPoint)
+		}
+		prevOuts[i] = prevOut
+	}
+	inputs, err := prevOutUTXOs(tx, prevOuts)
+	if err != nil {
+		return nil, err
+	}
+	tt, err := checkTokenTransition(inputs, tx.TxOut)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TokenValidationResult{}
+	accounts := make(map[chainhash.Hash]*TokenCategoryAccounting)
+	account := func(category chainhash.Hash) *TokenCategoryAccounting {
+		acc := accounts[category]
+		if acc == nil {
+			acc = &TokenCategoryAccounting{Category: category, Genesis: tt.unsent[category] == nil}
+			accounts[category] = acc
+			result.Categories = append(result.Categories, acc)
+		}
+		return acc
+	}
+	for _, category := range tt.categories {
+		acc := account(category)
+		acc.BurnedAmount = tt.unsent[category].amount
+		acc.BurnedNFTs = len(tt.unsent[category].nfts)
+	}
+	// The inputs and outputs were parsed by checkTokenTransition.
+	for _, u := range inputs {
+		if t, _ := u.Token(); t != nil {
+			acc := account(t.Category)
+			acc.InputAmount += t.Amount
+			if t.HasNFT {
+				acc.InputNFTs++
+			}
+		}
+	}
+	for _, txOut := range tx.TxOut {
+		if t, _, _ := SplitTokenPrefix(txOut.PkScript); t != nil {
+			acc := account(t.Category)
+			acc.OutputAmount += t.Amount
+			if t.HasNFT {
+				acc.OutputNFTs++
+			}
+		}
+	}
+	return result, nil
+}
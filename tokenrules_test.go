@@ -0,0 +1,148 @@
+package bchutil
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestValidateTokenTransition(t *testing.T) {
+	dest, _ := payToPubKeyHashScript(make([]byte, 20))
+	category := chainhash.Hash{0xaa}
+	output := func(t *TokenData) *wire.TxOut {
+		if t == nil {
+			return wire.NewTxOut(1000, dest)
+		}
+		return tokenChangeOutput(t, dest)
+	}
+	fungible := func(amount uint64) *TokenData {
+		return &TokenData{Category: category, Amount: amount}
+	}
+	nft := func(capability NFTCapability, commitment ...byte) *TokenData {
+		return &TokenData{Category: category, HasNFT: true, Capability: capability, Commitment: commitment}
+	}
+	genesis := UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{0xbb}}, Amount: 1000, PkScript: dest}
+
+	tests := []struct {
+		inputs  []*TokenData
+		genesis bool
+		outputs []*TokenData
+		err     error
+		output  int
+	}{
+		{inputs: []*TokenData{fungible(10), fungible(5)}, outputs: []*TokenData{fungible(7), nil, fungible(8)}},
+		{inputs: []*TokenData{fungible(10)}, outputs: []*TokenData{fungible(7), fungible(4)},
+			err: ErrInsufficientTokens, output: 1},
+		{inputs: []*TokenData{nft(NFTImmutable, 1)}, outputs: []*TokenData{fungible(1)},
+			err: ErrInsufficientTokens},
+		{inputs: []*TokenData{fungible(10)}, outputs: []*TokenData{nil, {Category: chainhash.Hash{0xcc}, Amount: 1}},
+			err: ErrUnknownTokenCategory, output: 1},
+		{inputs: []*TokenData{nft(NFTImmutable, 1)}, outputs: []*TokenData{nft(NFTImmutable, 1)}},
+		{inputs: []*TokenData{nft(NFTImmutable, 1)}, outputs: []*TokenData{nft(NFTImmutable, 2)},
+			err: ErrNFTNotFound},
+		{inputs: []*TokenData{nft(NFTImmutable, 1)}, outputs: []*TokenData{nft(NFTImmutable, 1), nft(NFTImmutable, 1)},
+			err: ErrNFTNotFound, output: 1},
+		{inputs: []*TokenData{nft(NFTImmutable, 1)}, outputs: []*TokenData{nft(NFTMutable, 1)},
+			err: ErrNFTNotFound},
+		{inputs: []*TokenData{nft(NFTMutable, 1)}, outputs: []*TokenData{nft(NFTImmutable, 2)}},
+		{inputs: []*TokenData{nft(NFTMutable, 1), nft(NFTImmutable, 2)},
+			outputs: []*TokenData{nft(NFTMutable, 3), nft(NFTImmutable, 2)}},
+		{inputs: []*TokenData{nft(NFTMutable, 1)}, outputs: []*TokenData{nft(NFTMutable, 2), nft(NFTMutable, 3)},
+			err: ErrNFTNotFound, output: 1},
+		{inputs: []*TokenData{nft(NFTMutable, 1)}, outputs: []*TokenData{nft(NFTMinting, 1)},
+			err: ErrNFTMinting},
+		{inputs: []*TokenData{nft(NFTMinting)},
+			outputs: []*TokenData{nft(NFTMinting), nft(NFTMinting, 1), nft(NFTMutable, 2), nft(NFTImmutable, 3)}},
+		{inputs: []*TokenData{nft(NFTMinting)}, outputs: []*TokenData{fungible(1)},
+			err: ErrInsufficientTokens},
+		{genesis: true, outputs: []*TokenData{{Category: genesis.OutPoint.Hash, Amount: math.MaxInt64},
+			{Category: genesis.OutPoint.Hash, HasNFT: true, Capability: NFTMinting}}},
+		{genesis: true, outputs: []*TokenData{{Category: genesis.OutPoint.Hash, Amount: math.MaxInt64},
+			{Category: genesis.OutPoint.Hash, Amount: 1}}, err: ErrTokenAmountOverflow, output: 1},
+	}
+	for i, test := range tests {
+		var inputs []UTXO
+		for j, token := range test.inputs {
+			inputs = append(inputs, tokenTestUTXO(byte(j), token))
+		}
+		if test.genesis {
+			inputs = append(inputs, genesis)
+		}
+		var outputs []*wire.TxOut
+		for _, token := range test.outputs {
+			outputs = append(outputs, output(token))
+		}
+		err := ValidateTokenTransition(inputs, outputs)
+		if !errors.Is(err, test.err) {
+			t.Errorf("test %d: got %v, want %v", i, err, test.err)
+			continue
+		}
+		var terr *TokenTransitionError
+		if test.err != nil && (!errors.As(err, &terr) || terr.Output != test.output) {
+			t.Errorf("test %d: got %v, want output %d", i, err, test.output)
+		}
+	}
+}
+
+func TestValidateTokenTx(t *testing.T) {
+	dest, _ := payToPubKeyHashScript(make([]byte, 20))
+	category, burned := chainhash.Hash{0xaa}, chainhash.Hash{0xcc}
+	genesis := UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{0xbb}}, Amount: 1000, PkScript: dest}
+	inputs := []UTXO{
+		tokenTestUTXO(1, &TokenData{Category: category, Amount: 100, HasNFT: true, Capability: NFTMinting}),
+		tokenTestUTXO(2, &TokenData{Category: category, Amount: 50}),
+		tokenTestUTXO(3, &TokenData{Category: burned, HasNFT: true, Commitment: []byte{1}}),
+		genesis,
+	}
+	fetcher := make(testPrevOutputFetcher)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for i := range inputs {
+		fetcher[inputs[i].OutPoint] = inputs[i].TxOut()
+		tx.AddTxIn(wire.NewTxIn(&inputs[i].OutPoint, nil, nil))
+	}
+	for _, token := range []*TokenData{
+		{Category: category, Amount: 120, HasNFT: true, Capability: NFTMinting},
+		{Category: category, HasNFT: true, Commitment: []byte{7}},
+		{Category: genesis.OutPoint.Hash, Amount: 1000000},
+	} {
+		tx.AddTxOut(tokenChangeOutput(token, dest))
+	}
+
+	result, err := ValidateTokenTx(tx, fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TokenCategoryAccounting{
+		{Category: category, InputAmount: 150, OutputAmount: 120, BurnedAmount: 30, InputNFTs: 1, OutputNFTs: 2},
+		{Category: burned, InputNFTs: 1, BurnedNFTs: 1},
+		{Category: genesis.OutPoint.Hash, Genesis: true, OutputAmount: 1000000},
+	}
+	if len(result.Categories) != len(want) {
+		t.Fatalf("got %d categories, want %d", len(result.Categories), len(want))
+	}
+	for i, acc := range result.Categories {
+		if *acc != want[i] {
+			t.Errorf("category %d: got %+v, want %+v", i, *acc, want[i])
+		}
+	}
+	if result.Category(burned) != result.Categories[1] || result.Category(chainhash.Hash{}) != nil {
+		t.Error("wrong category lookup")
+	}
+
+	// Without the minting NFT, the new NFT can't be created.
+	immutable := tokenTestUTXO(1, &TokenData{Category: category, Amount: 100, HasNFT: true})
+	fetcher[immutable.OutPoint] = immutable.TxOut()
+	var terr *TokenTransitionError
+	if _, err := ValidateTokenTx(tx, fetcher); !errors.Is(err, ErrNFTMinting) || !errors.As(err, &terr) ||
+		terr.Output != 0 {
+		t.Errorf("got %v, want ErrNFTMinting for output 0", err)
+	}
+
+	delete(fetcher, genesis.OutPoint)
+	if _, err := ValidateTokenTx(tx, fetcher); err == nil {
+		t.Error("missing previous output accepted")
+	}
+}
@@ -0,0 +1,129 @@
+package bchutil
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// StepRecord is a step of the execution of scripts by TraceScript.
+type StepRecord struct {
+	// Script is the script executed: 0 for the scriptSig, 1 for the
+	// output script and 2 for the redeem script of pay-to-script-hash
+	// spends.  PC is the index of the opcode in the script.
+	Script int
+	PC     int
+
+	// Opcode is the opcode about to execute, in ASM, empty for the checks
+	// ending the execution.
+	Opcode string
+
+	// Executing is whether the opcode executes, rather than being skipped
+	// in a false branch of a conditional.
+	Executing bool
+
+	// Stack and AltStack are the items of the stacks before the step, from
+	// bottom to top, in hex.
+	Stack    []string
+	AltStack []string
+
+	// Err is the error the step failed with, if any.
+	Err error
+}
+
+// TraceScript executes scriptSig and pkScript, spending input idx of tx
+// holding amt satoshis with flags like NewEngine with an engine, and returns
+// the steps of the execution.  scriptSig replaces the scriptSig of the input.
+// The error the execution fails with is returned with the steps, and recorded
+// by the last one.
+func TraceScript(scriptSig, pkScript []byte, tx *wire.MsgTx, idx int, amt int64,
+	flags ScriptFlags) ([]StepRecord, error) {
+
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("input index %d out of range", idx)
+	}
+	tx = tx.Copy()
+	tx.TxIn[idx].SignatureScript = scriptSig
+	vm, err := NewEngine(pkScript, tx, idx, flags, nil, amt)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []StepRecord
+	for {
+		step := StepRecord{
+			Script:    vm.scriptIdx,
+			PC:        vm.opIdx,
+			Executing: vm.executing(),
+			Stack:     hexItems(vm.dstack),
+			AltStack:  hexItems(vm.astack),
+		}
+		hasOpcode := vm.scriptIdx < len(vm.scripts) && vm.opIdx < len(vm.scripts[vm.scriptIdx])
+		if hasOpcode {
+			step.Opcode = vm.scripts[vm.scriptIdx][vm.opIdx].asm()
+		}
+		done, err := vm.Step()
+		if hasOpcode || err != nil {
+			step.Err = err
+			steps = append(steps, step)
+		}
+		if done {
+			return steps, err
+		}
+	}
+}
+
+// hexItems returns the stack items in hex.
+func hexItems(stack [][]byte) []string {
+	items := make([]string, len(stack))
+	for i, item := range stack {
+		items[i] = hex.EncodeToString(item)
+	}
+	return items
+}
+
+// FormatTrace returns the steps as a table, one step per line, aligning the
+// script and opcode index, the opcode, the stacks and the error.  Empty stack
+// items are written as "[]", and skipped opcodes in parentheses.
+func FormatTrace(steps []StepRecord) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCRIPT:PC\tOPCODE\tSTACK\tALTSTACK\tERROR")
+	for _, step := range steps {
+		opcode := step.Opcode
+		switch {
+		case opcode == "":
+			opcode = "<end>"
+		case !step.Executing:
+			opcode = "(" + opcode + ")"
+		}
+		errText := ""
+		var execErr *ExecError
+		if errors.As(step.Err, &execErr) {
+			// The step shows where the execution failed.
+			errText = execErr.Err.Error()
+		} else if step.Err != nil {
+			errText = step.Err.Error()
+		}
+		fmt.Fprintf(w, "%d:%d\t%s\t%s\t%s\t%s\n", step.Script, step.PC, opcode,
+			formatStack(step.Stack), formatStack(step.AltStack), errText)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// formatStack returns the items of a stack, separated by spaces.
+func formatStack(items []string) string {
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = item
+		if item == "" {
+			out[i] = "[]"
+		}
+	}
+	return strings.Join(out, " ")
+}
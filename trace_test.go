@@ -0,0 +1,91 @@
+package bchutil
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestTraceScript(t *testing.T) {
+	tx := engineTestTx(nil)
+	scriptSig, _ := ParseASM("2 3")
+	pkScript, _ := ParseASM("OP_TOALTSTACK OP_0 OP_IF OP_RETURN OP_ENDIF OP_FROMALTSTACK OP_ADD 5 OP_EQUAL")
+	steps, err := TraceScript(scriptSig, pkScript, tx, 0, 1000, StandardScriptFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		script, pc int
+		opcode     string
+		executing  bool
+		stack, alt string
+	}{
+		{0, 0, "2", true, "", ""},
+		{0, 1, "3", true, "02", ""},
+		{1, 0, "OP_TOALTSTACK", true, "02 03", ""},
+		{1, 1, "0", true, "02", "03"},
+		{1, 2, "OP_IF", true, "02 []", "03"},
+		{1, 3, "OP_RETURN", false, "02", "03"},
+		{1, 4, "OP_ENDIF", false, "02", "03"},
+		{1, 5, "OP_FROMALTSTACK", true, "02", "03"},
+		{1, 6, "OP_ADD", true, "02 03", ""},
+		{1, 7, "5", true, "05", ""},
+		{1, 8, "OP_EQUAL", true, "05 05", ""},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("got %d steps, want %d", len(steps), len(want))
+	}
+	for i, w := range want {
+		s := steps[i]
+		if s.Script != w.script || s.PC != w.pc || s.Opcode != w.opcode || s.Executing != w.executing ||
+			formatStack(s.Stack) != w.stack || formatStack(s.AltStack) != w.alt || s.Err != nil {
+			t.Errorf("step %d: got %+v", i, s)
+		}
+	}
+	// The scriptSig of tx is unchanged.
+	if len(tx.TxIn[0].SignatureScript) != 0 {
+		t.Error("tx modified")
+	}
+
+	// Failures are recorded by the last step.
+	pkScript, _ = ParseASM("OP_ADD 6 OP_EQUAL")
+	steps, err = TraceScript(scriptSig, pkScript, tx, 0, 1000, StandardScriptFlags)
+	if !errors.Is(err, ErrEvalFalse) || len(steps) != 5 || !errors.Is(steps[4].Err, ErrEvalFalse) {
+		t.Fatalf("got %d steps, %v", len(steps), err)
+	}
+	steps, err = TraceScript(nil, nil, tx, 0, 1000, StandardScriptFlags)
+	if !errors.Is(err, ErrEvalFalse) || len(steps) != 1 || steps[0].Opcode != "" {
+		t.Fatalf("got %+v, %v", steps, err)
+	}
+
+	// Pay-to-script-hash spends trace the redeem script.
+	redeemScript, _ := ParseASM("OP_DROP 1")
+	p2sh, _ := payToScriptHashScript(btcutil.Hash160(redeemScript))
+	scriptSig, _ = txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(redeemScript).Script()
+	steps, err = TraceScript(scriptSig, p2sh, tx, 0, 1000, ScriptBip16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := steps[len(steps)-1]; last.Script != 2 || last.Opcode != "1" {
+		t.Errorf("got last step %+v", last)
+	}
+
+	table := FormatTrace(steps)
+	lines := strings.Split(strings.TrimSuffix(table, "\n"), "\n")
+	if len(lines) != len(steps)+1 || !strings.HasPrefix(lines[0], "SCRIPT:PC") {
+		t.Fatalf("got table\n%s", table)
+	}
+	// Columns are aligned.
+	col := strings.Index(lines[0], "OPCODE")
+	for _, line := range lines[1:] {
+		if line[col-1] != ' ' || line[col] == ' ' {
+			t.Errorf("misaligned line %q", line)
+		}
+	}
+	if _, err := TraceScript(nil, nil, tx, 1, 1000, 0); err == nil {
+		t.Error("traced input out of range")
+	}
+}
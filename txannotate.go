@@ -0,0 +1,108 @@
+package bchutil
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// txDumpWidth is the number of bytes per line of the dumps of annotated
+// transactions.
+const txDumpWidth = 16
+
+// TxField is the byte range of a field of a raw transaction, from Start to
+// End excluded.
+type TxField struct {
+	Name       string
+	Start, End int
+}
+
+// TxAnnotation is a raw transaction annotated with the byte range of each of
+// its fields.
+type TxAnnotation struct {
+	Raw []byte
+
+	// Tx is the transaction decoded, nil if decoding failed.
+	Tx *wire.MsgTx
+
+	// Fields are the fields parsed, in their order, those before the
+	// failure if decoding failed.
+	Fields []TxField
+
+	// FailOffset is the byte at which the field that failed starts and
+	// Err why it failed, or -1 and nil.
+	FailOffset int
+	Err        error
+}
+
+// record records the range of field, extending the last range recorded when
+// it continues it, as the bytes of a varint do.
+func (d *txDecoder) record(field string, start, end int) {
+	if n := len(d.fields); n != 0 && d.fields[n-1].Name == field && d.fields[n-1].End == start {
+		d.fields[n-1].End = end
+		return
+	}
+	d.fields = append(d.fields, TxField{Name: field, Start: start, End: end})
+}
+
+// DecodeTxAnnotated decodes the raw transaction raw as DecodeTxStrict does,
+// recording the byte range of every field: the version, the counts, the
+// outpoint, scriptSig length, scriptSig and sequence of the inputs, the value,
+// script length and script of the outputs and the locktime.  Transactions
+// that fail to decode return the annotation of the fields parsed before the
+// failure with the *TxDecodeError of the failure, bytes following the
+// transaction failing with ErrTxTrailingBytes.
+func DecodeTxAnnotated(raw []byte) (*TxAnnotation, error) {
+	d := txDecoder{raw: raw, annotate: true}
+	tx := d.decode()
+	if d.err == nil && d.pos != len(raw) {
+		d.fail("trailing bytes", d.pos, fmt.Errorf("%w: %d bytes", ErrTxTrailingBytes, len(raw)-d.pos))
+	}
+	a := &TxAnnotation{Raw: raw, Fields: d.fields, FailOffset: -1}
+	if d.err != nil {
+		a.FailOffset, a.Err = d.err.(*TxDecodeError).Offset, d.err
+		// The bytes of the field failing may be recorded already.
+		for len(a.Fields) != 0 && a.Fields[len(a.Fields)-1].End > a.FailOffset {
+			a.Fields = a.Fields[:len(a.Fields)-1]
+		}
+		return a, d.err
+	}
+	a.Tx = tx
+	return a, nil
+}
+
+// Dump returns the hex dump of the transaction, a line per field with the
+// offset of its first byte, its bytes, on continuation lines of 16 bytes for
+// scripts, and its name.  The bytes from a failure are dumped after its error.
+func (a *TxAnnotation) Dump() string {
+	var b strings.Builder
+	writeLines := func(start, end int, label string) {
+		if start == end {
+			fmt.Fprintf(&b, "%08x  %-*s  %s\n", start, 2*txDumpWidth, "", label)
+			return
+		}
+		for off := start; off < end; off += txDumpWidth {
+			lineEnd := off + txDumpWidth
+			if lineEnd > end {
+				lineEnd = end
+			}
+			fmt.Fprintf(&b, "%08x  %-*s", off, 2*txDumpWidth, hex.EncodeToString(a.Raw[off:lineEnd]))
+			if off == start {
+				fmt.Fprintf(&b, "  %s", label)
+			}
+			b.WriteByte('\n')
+		}
+	}
+	for _, f := range a.Fields {
+		writeLines(f.Start, f.End, f.Name)
+	}
+	if a.Err != nil {
+		fmt.Fprintf(&b, "%08x  error: %v\n", a.FailOffset, a.Err)
+		if a.FailOffset < len(a.Raw) {
+			writeLines(a.FailOffset, len(a.Raw), "unparsed")
+		}
+	}
+	return b.String()
+}
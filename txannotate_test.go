@@ -0,0 +1,78 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecodeTxAnnotated(t *testing.T) {
+	tx := engineTestTx([]byte{0x51, 0x52})
+	var buf bytes.Buffer
+	tx.Serialize(&buf)
+	raw := buf.Bytes()
+
+	a, err := DecodeTxAnnotated(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Tx.TxHash() != tx.TxHash() || a.FailOffset != -1 {
+		t.Fatalf("got %+v", a)
+	}
+	nFields := len(a.Fields)
+	end := 0
+	for _, f := range a.Fields {
+		if f.Start != end {
+			t.Errorf("field %s starts at %d, want %d", f.Name, f.Start, end)
+		}
+		end = f.End
+	}
+	if end != len(raw) {
+		t.Errorf("fields end at %d of %d bytes", end, len(raw))
+	}
+	want := []TxField{
+		{"version", 0, 4},
+		{"input count", 4, 5},
+		{"input 0 outpoint hash", 5, 37},
+		{"input 0 outpoint index", 37, 41},
+		{"input 0 scriptSig length", 41, 42},
+		{"input 0 scriptSig", 42, 44},
+	}
+	for i, f := range want {
+		if a.Fields[i] != f {
+			t.Errorf("field %d: got %+v, want %+v", i, a.Fields[i], f)
+		}
+	}
+	if last := a.Fields[len(a.Fields)-1]; last.Name != "locktime" || last.End-last.Start != 4 {
+		t.Errorf("got last field %+v", last)
+	}
+	dump := a.Dump()
+	if !strings.HasPrefix(dump, "00000000  "+EncodeTxHex(tx)[:8]) || !strings.Contains(dump, "00000029  02") ||
+		!strings.Contains(dump, "input 0 outpoint hash") {
+		t.Errorf("got dump\n%s", dump)
+	}
+
+	// A scriptSig length exceeding the bytes left.
+	bad := append([]byte(nil), raw...)
+	bad[41] = 0xfc
+	a, err = DecodeTxAnnotated(bad)
+	if !errors.Is(err, ErrLengthExceedsData) || a.Tx != nil || a.FailOffset != 41 {
+		t.Fatalf("got %v, fail offset %d", err, a.FailOffset)
+	}
+	if len(a.Fields) != 4 || a.Fields[3].Name != "input 0 outpoint index" {
+		t.Errorf("got fields %+v", a.Fields)
+	}
+	if !strings.Contains(a.Dump(), "00000029  error: ") || !strings.Contains(a.Dump(), "unparsed") {
+		t.Errorf("got dump\n%s", a.Dump())
+	}
+
+	if _, err := DecodeTxAnnotated(raw[:len(raw)-2]); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+	a, err = DecodeTxAnnotated(append(append([]byte(nil), raw...), 0))
+	if !errors.Is(err, ErrTxTrailingBytes) || a.FailOffset != len(raw) || len(a.Fields) != nFields {
+		t.Errorf("got %v at %d, %d fields", err, a.FailOffset, len(a.Fields))
+	}
+}
@@ -0,0 +1,189 @@
+package bchutil
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var (
+	// ErrDuplicateTx describes an error where a set of transactions has the
+	// same transaction twice.
+	ErrDuplicateTx = errors.New("duplicate transaction")
+
+	// ErrDependencyCycle describes an error where transactions spend the
+	// outputs of each other in a cycle, which no valid transactions can, as
+	// the txid of a parent commits to it before its children exist.
+	ErrDependencyCycle = errors.New("transaction dependency cycle")
+)
+
+// DependencyGraph is the graph of the transactions of a set spending the
+// outputs of each other.  Transactions are identified by their txids, and the
+// parents and children of each are in the order of the set.
+type DependencyGraph struct {
+	txs      []*wire.MsgTx
+	index    map[chainhash.Hash]int
+	parents  [][]int
+	children [][]int
+}
+
+// NewDependencyGraph returns the dependency graph of txs, whose inputs
+// spending the outputs of transactions of txs make them their children.
+// Inputs spending other outputs are ignored.
+func NewDependencyGraph(txs []*wire.MsgTx) (*DependencyGraph, error) {
+	g := &DependencyGraph{
+		txs:      txs,
+		index:    make(map[chainhash.Hash]int, len(txs)),
+		parents:  make([][]int, len(txs)),
+		children: make([][]int, len(txs)),
+	}
+	for i, tx := range txs {
+		txid := tx.TxHash()
+		if j, ok := g.index[txid]; ok {
+			return nil, fmt.Errorf("%w: %v at %d and %d", ErrDuplicateTx, txid, j, i)
+		}
+		g.index[txid] = i
+	}
+	for i, tx := range txs {
+		seen := make(map[int]bool)
+		for _, in := range tx.TxIn {
+			j, ok := g.index[in.PreviousOutPoint.Hash]
+			if !ok || seen[j] {
+				continue
+			}
+			seen[j] = true
+			g.parents[i] = append(g.parents[i], j)
+		}
+	}
+	// Children are appended by increasing index, in the order of the set.
+	for i := range txs {
+		for _, j := range g.parents[i] {
+			g.children[j] = append(g.children[j], i)
+		}
+	}
+	return g, nil
+}
+
+// hashes returns the txids of the transactions at indexes.
+func (g *DependencyGraph) hashes(indexes []int) []chainhash.Hash {
+	if len(indexes) == 0 {
+		return nil
+	}
+	hashes := make([]chainhash.Hash, len(indexes))
+	for k, i := range indexes {
+		hashes[k] = g.txs[i].TxHash()
+	}
+	return hashes
+}
+
+// Parents returns the txids of the transactions of the set whose outputs the
+// transaction txid spends, nil if none or if txid is not in the set.
+func (g *DependencyGraph) Parents(txid *chainhash.Hash) []chainhash.Hash {
+	i, ok := g.index[*txid]
+	if !ok {
+		return nil
+	}
+	return g.hashes(g.parents[i])
+}
+
+// Children returns the txids of the transactions of the set spending the
+// outputs of the transaction txid, nil if none or if txid is not in the set.
+func (g *DependencyGraph) Children(txid *chainhash.Hash) []chainhash.Hash {
+	i, ok := g.index[*txid]
+	if !ok {
+		return nil
+	}
+	return g.hashes(g.children[i])
+}
+
+// indexHeap is a min-heap of indexes of transactions.
+type indexHeap []int
+
+func (h indexHeap) Len() int            { return len(h) }
+func (h indexHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h indexHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *indexHeap) Push(x interface{}) { *h = append(*h, x.(int)) }
+func (h *indexHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Sorted returns the transactions of the set with their parents before them,
+// each transaction whose parents precede it coming in the order of the set, so
+// that transactions already in order are left in place.  Transactions
+// spending each other in a cycle fail with ErrDependencyCycle.
+func (g *DependencyGraph) Sorted() ([]*wire.MsgTx, error) {
+	pending := make([]int, len(g.txs))
+	ready := &indexHeap{}
+	for i := range g.txs {
+		pending[i] = len(g.parents[i])
+		if pending[i] == 0 {
+			*ready = append(*ready, i)
+		}
+	}
+	heap.Init(ready)
+	sorted := make([]*wire.MsgTx, 0, len(g.txs))
+	for ready.Len() != 0 {
+		i := heap.Pop(ready).(int)
+		sorted = append(sorted, g.txs[i])
+		for _, j := range g.children[i] {
+			if pending[j]--; pending[j] == 0 {
+				heap.Push(ready, j)
+			}
+		}
+	}
+	if len(sorted) != len(g.txs) {
+		return nil, g.cycleError(pending)
+	}
+	return sorted, nil
+}
+
+// cycleError returns the error reporting a cycle among the transactions with
+// pending parents, each of which has a pending parent: following them from the
+// first leads to a cycle.
+func (g *DependencyGraph) cycleError(pending []int) error {
+	i := 0
+	for pending[i] == 0 {
+		i++
+	}
+	visited := make(map[int]int)
+	var path []int
+	for {
+		if k, ok := visited[i]; ok {
+			path = path[k:]
+			break
+		}
+		visited[i] = len(path)
+		path = append(path, i)
+		for _, j := range g.parents[i] {
+			if pending[j] != 0 {
+				i = j
+				break
+			}
+		}
+	}
+	txids := make([]string, len(path))
+	for k, i := range path {
+		txids[len(path)-1-k] = g.txs[i].TxHash().String()
+	}
+	return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(txids, " -> "))
+}
+
+// SortTopological returns txs ordered with the parents of each transaction,
+// the transactions whose outputs it spends, before it, as they must be
+// broadcast or mined for the children not to be orphans.  Independent
+// transactions keep their order in txs.  Duplicate transactions fail with
+// ErrDuplicateTx and cycles with ErrDependencyCycle.
+func SortTopological(txs []*wire.MsgTx) ([]*wire.MsgTx, error) {
+	g, err := NewDependencyGraph(txs)
+	if err != nil {
+		return nil, err
+	}
+	return g.Sorted()
+}
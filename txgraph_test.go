@@ -0,0 +1,75 @@
+package bchutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestSortTopological(t *testing.T) {
+	newTx := func(lockTime uint32, parents ...*wire.MsgTx) *wire.MsgTx {
+		tx := wire.NewMsgTx(2)
+		tx.LockTime = lockTime
+		if len(parents) == 0 {
+			tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(lockTime)}, 0), nil, nil))
+		}
+		for _, parent := range parents {
+			hash := parent.TxHash()
+			tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, 0), nil, nil))
+			tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, 1), nil, nil))
+		}
+		tx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+		return tx
+	}
+	a := newTx(1)
+	b := newTx(2, a)
+	c := newTx(3, a, b)
+	d := newTx(4)
+	e := newTx(5, c)
+
+	sorted, err := SortTopological([]*wire.MsgTx{e, d, c, b, a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []*wire.MsgTx{d, a, b, c, e}; !reflect.DeepEqual(sorted, want) {
+		t.Errorf("got order %v", sorted)
+	}
+	// Transactions in order are left in place.
+	in := []*wire.MsgTx{a, d, b, c, e}
+	if sorted, err := SortTopological(in); err != nil || !reflect.DeepEqual(sorted, in) {
+		t.Errorf("sorted set reordered: %v, %v", sorted, err)
+	}
+
+	if _, err := SortTopological([]*wire.MsgTx{a, b, a}); !errors.Is(err, ErrDuplicateTx) {
+		t.Errorf("duplicate: got %v", err)
+	}
+
+	g, err := NewDependencyGraph([]*wire.MsgTx{c, b, a, d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashA, hashB, hashC, hashD := a.TxHash(), b.TxHash(), c.TxHash(), d.TxHash()
+	if got := g.Children(&hashA); !reflect.DeepEqual(got, []chainhash.Hash{hashC, hashB}) {
+		t.Errorf("children of a: %v", got)
+	}
+	if got := g.Parents(&hashC); !reflect.DeepEqual(got, []chainhash.Hash{hashA, hashB}) {
+		t.Errorf("parents of c: %v", got)
+	}
+	if g.Parents(&hashD) != nil || g.Children(&hashD) != nil {
+		t.Error("independent transaction has relatives")
+	}
+	hashE := e.TxHash()
+	if g.Parents(&hashE) != nil {
+		t.Error("transaction not in the set has parents")
+	}
+
+	// Txids commit to the parents, so only a corrupt graph has cycles.
+	g.parents[2] = append(g.parents[2], 0)
+	g.children[0] = append(g.children[0], 2)
+	if _, err := g.Sorted(); !errors.Is(err, ErrDependencyCycle) {
+		t.Errorf("cycle: got %v", err)
+	}
+}
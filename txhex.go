@@ -0,0 +1,316 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Smallest serializations of inputs and outputs, which bound the counts of a
+// transaction before they are allocated.
+const (
+	minTxInSize  = 32 + 4 + 1 + 4
+	minTxOutSize = 8 + 1
+)
+
+var (
+	// ErrInvalidTxHex describes an error where a raw transaction is not
+	// valid hex.
+	ErrInvalidTxHex = errors.New("invalid transaction hex")
+
+	// ErrTxTooLarge describes an error where a raw transaction is larger
+	// than the size accepted.
+	ErrTxTooLarge = errors.New("transaction too large")
+
+	// ErrTxTrailingBytes describes an error where bytes follow the
+	// transaction in a raw transaction decoded strictly.
+	ErrTxTrailingBytes = errors.New("trailing bytes after transaction")
+
+	// ErrNonCanonicalVarInt describes an error where a count or length of a
+	// raw transaction is not encoded in the fewest bytes.
+	ErrNonCanonicalVarInt = errors.New("non-canonical varint")
+
+	// ErrLengthExceedsData describes an error where a script of a raw
+	// transaction is longer than the bytes left.
+	ErrLengthExceedsData = errors.New("length exceeds the data left")
+
+	// ErrNonCanonicalTx describes an error where a raw transaction is not
+	// the serialization of the transaction it decodes to.
+	ErrNonCanonicalTx = errors.New("non-canonical transaction encoding")
+)
+
+// TxDecodeError is the error of a raw transaction that could not be parsed.
+type TxDecodeError struct {
+	// Offset is the byte of the transaction at which Field starts.
+	Offset int
+	Field  string
+
+	// Err is io.ErrUnexpectedEOF for truncated transactions, and otherwise
+	// describes why the field is invalid.
+	Err error
+}
+
+// Error returns the field, its offset and why it could not be parsed.
+func (e *TxDecodeError) Error() string {
+	return fmt.Sprintf("decoding transaction: %s at byte %d: %v", e.Field, e.Offset, e.Err)
+}
+
+// Unwrap returns the error of the field.
+func (e *TxDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeTxHex returns the raw transaction hex of tx.
+func EncodeTxHex(tx *wire.MsgTx) string {
+	var buf bytes.Buffer
+	buf.Grow(tx.SerializeSize())
+	tx.Serialize(&buf)
+	return hex.EncodeToString(buf.Bytes())
+}
+
+// DecodeTxHex decodes the raw transaction hex s, in which whitespace is
+// ignored, of a transaction of at most maxSize bytes, or MaxStandardTxSize
+// when maxSize is not positive.  Larger transactions fail with ErrTxTooLarge
+// before they are decoded, invalid hex with ErrInvalidTxHex, and transactions
+// that cannot be parsed with a *TxDecodeError naming the field at fault.
+// Bytes following the transaction are ignored, as by wire.MsgTx.Deserialize.
+func DecodeTxHex(s string, maxSize int) (*wire.MsgTx, error) {
+	tx, _, err := decodeTxHex(s, maxSize)
+	return tx, err
+}
+
+// DecodeTxHexStrict decodes s like DecodeTxHex, but fails with
+// ErrTxTrailingBytes when bytes follow the transaction.
+func DecodeTxHexStrict(s string, maxSize int) (*wire.MsgTx, error) {
+	tx, rest, err := decodeTxHex(s, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	if rest != 0 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTxTrailingBytes, rest)
+	}
+	return tx, nil
+}
+
+// decodeTxHex decodes the raw transaction hex s and returns the transaction
+// and the number of bytes following it.
+func decodeTxHex(s string, maxSize int) (*wire.MsgTx, int, error) {
+	if maxSize <= 0 {
+		maxSize = MaxStandardTxSize
+	}
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s)/2 > maxSize {
+		return nil, 0, fmt.Errorf("%w: %d bytes, limit %d", ErrTxTooLarge, len(s)/2, maxSize)
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return nil, 0, fmt.Errorf("%w: character %q at %d", ErrInvalidTxHex, c, i)
+		}
+	}
+	if len(s)%2 != 0 {
+		return nil, 0, fmt.Errorf("%w: odd length", ErrInvalidTxHex)
+	}
+	raw, _ := hex.DecodeString(s)
+	return decodeTxBytes(raw)
+}
+
+// decodeTxBytes decodes the raw transaction raw and returns the transaction
+// and the number of bytes following it.
+func decodeTxBytes(raw []byte) (*wire.MsgTx, int, error) {
+	d := txDecoder{raw: raw}
+	tx := d.decode()
+	if d.err != nil {
+		return nil, 0, d.err
+	}
+	return tx, len(raw) - d.pos, nil
+}
+
+// decodeTxBytesStrict decodes the raw transaction raw, failing with
+// ErrTxTrailingBytes when bytes follow it.
+func decodeTxBytesStrict(raw []byte) (*wire.MsgTx, error) {
+	tx, rest, err := decodeTxBytes(raw)
+	if err != nil {
+		return nil, err
+	}
+	if rest != 0 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTxTrailingBytes, rest)
+	}
+	return tx, nil
+}
+
+// DecodeTxStrict reads r to its end and decodes the raw transaction read,
+// which must be the serialization of the transaction decoded, so that the
+// bytes hash to its txid.  Unlike wire.MsgTx.Deserialize, it fails with
+// ErrTxTrailingBytes when bytes follow the transaction.  Counts and lengths
+// not encoded in the fewest bytes fail with ErrNonCanonicalVarInt and scripts
+// longer than the bytes left with ErrLengthExceedsData, both in a
+// *TxDecodeError naming the field at fault.  Transactions larger than
+// MaxTxSize fail with ErrTxTooLarge.
+func DecodeTxStrict(r io.Reader) (*wire.MsgTx, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, MaxTxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > MaxTxSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTxTooLarge, MaxTxSize)
+	}
+	return decodeTxBytesStrict(raw)
+}
+
+// ReserializeCheck returns an error unless raw decodes strictly, as by
+// DecodeTxStrict, to a transaction whose serialization is raw, byte for
+// byte.  Mismatches fail with ErrNonCanonicalTx and the offset of the first
+// byte differing.
+func ReserializeCheck(raw []byte) error {
+	tx, err := decodeTxBytesStrict(raw)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.Grow(tx.SerializeSize())
+	if err := tx.Serialize(&buf); err != nil {
+		return err
+	}
+	out := buf.Bytes()
+	if bytes.Equal(out, raw) {
+		return nil
+	}
+	i := 0
+	for i < len(out) && i < len(raw) && out[i] == raw[i] {
+		i++
+	}
+	return fmt.Errorf("%w: reserialization of %d bytes differs at byte %d", ErrNonCanonicalTx, len(out), i)
+}
+
+// txDecoder parses a raw transaction, recording the first field that fails
+// and, if annotate, the byte range of each field parsed.
+type txDecoder struct {
+	raw []byte
+	pos int
+	err error
+
+	annotate bool
+	fields   []TxField
+}
+
+// decode parses the transaction.
+func (d *txDecoder) decode() *wire.MsgTx {
+	tx := &wire.MsgTx{Version: int32(d.uint32("version"))}
+
+	nIn, capacity := d.count("input count", minTxInSize)
+	tx.TxIn = make([]*wire.TxIn, 0, capacity)
+	for i := 0; i < nIn && d.err == nil; i++ {
+		txIn := &wire.TxIn{}
+		copy(txIn.PreviousOutPoint.Hash[:], d.bytes(fmt.Sprintf("input %d outpoint hash", i), chainhash.HashSize))
+		txIn.PreviousOutPoint.Index = d.uint32(fmt.Sprintf("input %d outpoint index", i))
+		txIn.SignatureScript = d.varBytes(fmt.Sprintf("input %d scriptSig", i))
+		txIn.Sequence = d.uint32(fmt.Sprintf("input %d sequence", i))
+		tx.TxIn = append(tx.TxIn, txIn)
+	}
+
+	nOut, capacity := d.count("output count", minTxOutSize)
+	tx.TxOut = make([]*wire.TxOut, 0, capacity)
+	for i := 0; i < nOut && d.err == nil; i++ {
+		txOut := &wire.TxOut{}
+		txOut.Value = int64(binary.LittleEndian.Uint64(d.bytes(fmt.Sprintf("output %d value", i), 8)))
+		txOut.PkScript = d.varBytes(fmt.Sprintf("output %d pkScript", i))
+		tx.TxOut = append(tx.TxOut, txOut)
+	}
+
+	tx.LockTime = d.uint32("locktime")
+	return tx
+}
+
+// fail records the error of field, which starts at offset, unless a field
+// failed before.
+func (d *txDecoder) fail(field string, offset int, err error) {
+	if d.err == nil {
+		d.err = &TxDecodeError{Offset: offset, Field: field, Err: err}
+	}
+}
+
+// bytes returns the next n bytes of field, zeros if they are missing.
+func (d *txDecoder) bytes(field string, n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	if len(d.raw)-d.pos < n {
+		d.fail(field, d.pos, io.ErrUnexpectedEOF)
+		return make([]byte, n)
+	}
+	b := d.raw[d.pos : d.pos+n]
+	if d.annotate {
+		d.record(field, d.pos, d.pos+n)
+	}
+	d.pos += n
+	return b
+}
+
+// uint32 returns field, a little endian uint32.
+func (d *txDecoder) uint32(field string) uint32 {
+	return binary.LittleEndian.Uint32(d.bytes(field, 4))
+}
+
+// varInt returns field, a canonically encoded variable length integer.
+func (d *txDecoder) varInt(field string) uint64 {
+	start := d.pos
+	prefix := d.bytes(field, 1)[0]
+	var v, min uint64
+	switch prefix {
+	case 0xfd:
+		v, min = uint64(binary.LittleEndian.Uint16(d.bytes(field, 2))), 0xfd
+	case 0xfe:
+		v, min = uint64(binary.LittleEndian.Uint32(d.bytes(field, 4))), 0x10000
+	case 0xff:
+		v, min = binary.LittleEndian.Uint64(d.bytes(field, 8)), 0x100000000
+	default:
+		return uint64(prefix)
+	}
+	if d.err == nil && v < min {
+		d.fail(field, start, ErrNonCanonicalVarInt)
+	}
+	return v
+}
+
+// count returns field, the number of the following items, and the capacity
+// to allocate for them, bounded by the items of minSize bytes that fit the
+// bytes left.  Counts of more items than fit are capped to one more item, whose
+// field fails to parse.
+func (d *txDecoder) count(field string, minSize int) (int, int) {
+	n := d.varInt(field)
+	if fit := (len(d.raw) - d.pos) / minSize; n > uint64(fit) {
+		return fit + 1, fit
+	}
+	return int(n), int(n)
+}
+
+// varBytes returns field, a byte string prefixed by its length.
+func (d *txDecoder) varBytes(field string) []byte {
+	start := d.pos
+	n := d.varInt(field + " length")
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.raw)-d.pos) {
+		d.fail(field, start, fmt.Errorf("%w: length %d, %d bytes left: %w", ErrLengthExceedsData, n,
+			len(d.raw)-d.pos, io.ErrUnexpectedEOF))
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.bytes(field, int(n)))
+	return b
+}
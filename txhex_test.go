@@ -0,0 +1,133 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestDecodeTxHex(t *testing.T) {
+	p2pkh, _ := payToPubKeyHashScript(make([]byte, 20))
+	tx := engineTestTx([]byte{0x51, 0x52})
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{2}, 1), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(5000, p2pkh))
+	tx.LockTime = 12345
+	s := EncodeTxHex(tx)
+
+	// Whitespace is ignored, and the case of the hex.
+	spaced := " " + strings.ToUpper(s[:20]) + "\n\t" + s[20:] + "\r\n"
+	for _, input := range []string{s, spaced} {
+		decoded, err := DecodeTxHexStrict(input, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.TxHash() != tx.TxHash() || EncodeTxHex(decoded) != s {
+			t.Error("transaction does not round trip")
+		}
+	}
+
+	if _, err := DecodeTxHex(s, len(s)/2-1); !errors.Is(err, ErrTxTooLarge) {
+		t.Errorf("got %v, want ErrTxTooLarge", err)
+	}
+	if _, err := DecodeTxHex(s, len(s)/2); err != nil {
+		t.Errorf("size limit: %v", err)
+	}
+	for _, input := range []string{s[:11] + "g" + s[12:], s[:len(s)-1], "0x" + s} {
+		if _, err := DecodeTxHex(input, 0); !errors.Is(err, ErrInvalidTxHex) {
+			t.Errorf("got %v, want ErrInvalidTxHex", err)
+		}
+	}
+
+	// Trailing bytes are only rejected by the strict mode.
+	if decoded, err := DecodeTxHex(s+"00ff", 0); err != nil || decoded.TxHash() != tx.TxHash() {
+		t.Errorf("got %v, %v", decoded, err)
+	}
+	if _, err := DecodeTxHexStrict(s+"00ff", 0); !errors.Is(err, ErrTxTrailingBytes) {
+		t.Errorf("got %v, want ErrTxTrailingBytes", err)
+	}
+}
+
+func TestDecodeTxHexErrors(t *testing.T) {
+	tx := engineTestTx([]byte{0x51, 0x52})
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{2}, 1), nil, nil))
+	s := EncodeTxHex(tx)
+	// The first input starts at byte 5 and is 43 bytes long, its scriptSig
+	// length at byte 41, and the second input at byte 48.
+	tests := []struct {
+		name   string
+		hex    string
+		field  string
+		offset int
+		err    error
+	}{
+		{"empty", "", "version", 0, io.ErrUnexpectedEOF},
+		{"truncated version", s[:6], "version", 0, io.ErrUnexpectedEOF},
+		{"truncated hash", s[:2*20], "input 0 outpoint hash", 5, io.ErrUnexpectedEOF},
+		{"truncated scriptSig", s[:2*43], "input 0 scriptSig", 41, io.ErrUnexpectedEOF},
+		{"truncated sequence", s[:2*50+2*38], "input 1 sequence", 48 + 37, io.ErrUnexpectedEOF},
+		{"truncated locktime", s[:len(s)-2], "locktime", len(s)/2 - 4, io.ErrUnexpectedEOF},
+		{"input count too large", s[:8] + "feffffffff" + s[10:], "input 2 outpoint hash", 52 + 41, io.ErrUnexpectedEOF},
+		{"non-canonical input count", s[:8] + "fd0200" + s[10:], "input count", 4, ErrNonCanonicalVarInt},
+		{"scriptSig too long", s[:2*41] + "fc" + s[2*42:], "input 0 scriptSig", 41, io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		_, err := DecodeTxHex(test.hex, 0)
+		var decodeErr *TxDecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("%s: got %v, want TxDecodeError", test.name, err)
+			continue
+		}
+		if decodeErr.Field != test.field || decodeErr.Offset != test.offset || !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %s at byte %d: %v", test.name, err, test.field, test.offset, test.err)
+		}
+	}
+}
+
+func TestDecodeTxStrict(t *testing.T) {
+	tx := engineTestTx([]byte{0x51, 0x52})
+	var buf bytes.Buffer
+	tx.Serialize(&buf)
+	raw := buf.Bytes()
+
+	decoded, err := DecodeTxStrict(bytes.NewReader(raw))
+	if err != nil || decoded.TxHash() != tx.TxHash() {
+		t.Fatalf("got %v, %v", decoded, err)
+	}
+	if err := ReserializeCheck(raw); err != nil {
+		t.Error(err)
+	}
+
+	// The input count 1 as a 3 byte varint.
+	nonCanonical := append(append(append([]byte(nil), raw[:4]...), 0xfd, 0x01, 0x00), raw[5:]...)
+	// The scriptSig length, at byte 41, exceeding the data left.
+	tooLong := append([]byte(nil), raw...)
+	tooLong[41] = 0xfc
+	tests := []struct {
+		name string
+		raw  []byte
+		err  error
+	}{
+		{"non-canonical varint", nonCanonical, ErrNonCanonicalVarInt},
+		// Accepted by wire, with the txid of tx.
+		{"trailing bytes", append(append([]byte(nil), raw...), 0), ErrTxTrailingBytes},
+		{"script too long", tooLong, ErrLengthExceedsData},
+		{"truncated", raw[:len(raw)-1], io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		if _, err := DecodeTxStrict(bytes.NewReader(test.raw)); !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+		if err := ReserializeCheck(test.raw); !errors.Is(err, test.err) {
+			t.Errorf("%s: reserialize check got %v, want %v", test.name, err, test.err)
+		}
+	}
+
+	if _, err := DecodeTxStrict(bytes.NewReader(make([]byte, MaxTxSize+1))); !errors.Is(err, ErrTxTooLarge) {
+		t.Errorf("got %v, want ErrTxTooLarge", err)
+	}
+}
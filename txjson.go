@@ -0,0 +1,369 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// satoshiDecimals is the number of decimals of BCH values.
+const satoshiDecimals = 8
+
+// TxVerbose is the verbose JSON form of a transaction, as returned by the
+// getrawtransaction RPC of nodes.
+type TxVerbose struct {
+	TxID     string        `json:"txid"`
+	Hash     string        `json:"hash"`
+	Version  int32         `json:"version"`
+	Size     int           `json:"size"`
+	LockTime uint32        `json:"locktime"`
+	Vin      []VinVerbose  `json:"vin"`
+	Vout     []VoutVerbose `json:"vout"`
+	Hex      string        `json:"hex,omitempty"`
+}
+
+// VinVerbose is the verbose JSON form of a transaction input.
+type VinVerbose struct {
+	// Coinbase is the hex scriptSig of coinbase inputs, which have no
+	// previous output.
+	Coinbase string `json:"coinbase,omitempty"`
+
+	TxID      string         `json:"txid,omitempty"`
+	Vout      uint32         `json:"vout"`
+	ScriptSig *ScriptVerbose `json:"scriptSig,omitempty"`
+	Sequence  uint32         `json:"sequence"`
+
+	// Prevout is the output spent, when known.
+	Prevout *PrevoutVerbose `json:"prevout,omitempty"`
+}
+
+// PrevoutVerbose is the verbose JSON form of the output spent by an input.
+type PrevoutVerbose struct {
+	Value        json.Number         `json:"value"`
+	ScriptPubKey ScriptPubKeyVerbose `json:"scriptPubKey"`
+	TokenData    *TokenDataVerbose   `json:"tokenData,omitempty"`
+}
+
+// VoutVerbose is the verbose JSON form of a transaction output.
+type VoutVerbose struct {
+	// Value is the value of the output in BCH, with exactly 8 decimals.
+	Value        json.Number         `json:"value"`
+	N            uint32              `json:"n"`
+	ScriptPubKey ScriptPubKeyVerbose `json:"scriptPubKey"`
+	TokenData    *TokenDataVerbose   `json:"tokenData,omitempty"`
+}
+
+// ScriptVerbose is the verbose JSON form of a scriptSig.
+type ScriptVerbose struct {
+	Asm string `json:"asm"`
+	Hex string `json:"hex"`
+}
+
+// ScriptPubKeyVerbose is the verbose JSON form of the locking script of an
+// output, without its token prefix.
+type ScriptPubKeyVerbose struct {
+	Asm       string   `json:"asm"`
+	Hex       string   `json:"hex"`
+	ReqSigs   int      `json:"reqSigs,omitempty"`
+	Type      string   `json:"type"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// TokenDataVerbose is the verbose JSON form of the CashTokens of an output.
+type TokenDataVerbose struct {
+	Category string `json:"category"`
+
+	// Amount is the fungible amount, as a decimal string.
+	Amount string      `json:"amount"`
+	NFT    *NFTVerbose `json:"nft,omitempty"`
+}
+
+// NFTVerbose is the verbose JSON form of a CashTokens NFT.
+type NFTVerbose struct {
+	Capability string `json:"capability"`
+	Commitment string `json:"commitment"`
+}
+
+// MarshalTxVerbose returns the verbose JSON form of tx, as returned by the
+// getrawtransaction RPC of nodes, with the addresses of params in CashAddr
+// form.  prevOuts, which may be nil or hold nil entries, are the outputs spent
+// by the inputs of the same index, and are included when known.  Values are
+// written as exact decimal numbers.
+func MarshalTxVerbose(tx *wire.MsgTx, prevOuts []*UTXO, params *chaincfg.Params) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	txid := tx.TxHash().String()
+	v := TxVerbose{
+		TxID:     txid,
+		Hash:     txid,
+		Version:  tx.Version,
+		Size:     buf.Len(),
+		LockTime: tx.LockTime,
+		Vin:      make([]VinVerbose, len(tx.TxIn)),
+		Vout:     make([]VoutVerbose, len(tx.TxOut)),
+		Hex:      hex.EncodeToString(buf.Bytes()),
+	}
+	for i, txIn := range tx.TxIn {
+		vin := &v.Vin[i]
+		vin.Sequence = txIn.Sequence
+		op := txIn.PreviousOutPoint
+		if op.Index == wire.MaxPrevOutIndex && op.Hash == (chainhash.Hash{}) {
+			vin.Coinbase = hex.EncodeToString(txIn.SignatureScript)
+			continue
+		}
+		vin.TxID, vin.Vout = op.Hash.String(), op.Index
+		vin.ScriptSig = &ScriptVerbose{
+			Asm: nodeASM(txIn.SignatureScript, true),
+			Hex: hex.EncodeToString(txIn.SignatureScript),
+		}
+		if i < len(prevOuts) && prevOuts[i] != nil {
+			value, scriptPubKey, tokenData, err := outputVerbose(prevOuts[i].TxOut(), params)
+			if err != nil {
+				return nil, fmt.Errorf("prevout %d: %w", i, err)
+			}
+			vin.Prevout = &PrevoutVerbose{Value: value, ScriptPubKey: scriptPubKey, TokenData: tokenData}
+		}
+	}
+	for i, txOut := range tx.TxOut {
+		value, scriptPubKey, tokenData, err := outputVerbose(txOut, params)
+		if err != nil {
+			return nil, fmt.Errorf("vout %d: %w", i, err)
+		}
+		v.Vout[i] = VoutVerbose{Value: value, N: uint32(i), ScriptPubKey: scriptPubKey, TokenData: tokenData}
+	}
+	return json.Marshal(&v)
+}
+
+// outputVerbose returns the verbose JSON forms of the value, script and tokens
+// of txOut.
+func outputVerbose(txOut *wire.TxOut, params *chaincfg.Params) (json.Number, ScriptPubKeyVerbose,
+	*TokenDataVerbose, error) {
+
+	token, pkScript, err := SplitTokenPrefix(txOut.PkScript)
+	if err != nil {
+		return "", ScriptPubKeyVerbose{}, nil, err
+	}
+	class, addrs, _, err := ClassifyOutput(txOut, params)
+	if err != nil {
+		return "", ScriptPubKeyVerbose{}, nil, err
+	}
+	s := ScriptPubKeyVerbose{
+		Asm:  nodeASM(pkScript, false),
+		Hex:  hex.EncodeToString(pkScript),
+		Type: class.String(),
+	}
+	switch class {
+	case txscript.PubKeyHashTy, txscript.ScriptHashTy, txscript.PubKeyTy:
+		s.ReqSigs = 1
+	case txscript.MultiSigTy:
+		_, s.ReqSigs, _ = multisigPubKeys(pkScript)
+	}
+	for _, addr := range addrs {
+		s.Addresses = append(s.Addresses, Prefixes[params.Name]+":"+addr.EncodeAddress())
+	}
+
+	var t *TokenDataVerbose
+	if token != nil {
+		t = &TokenDataVerbose{Category: token.Category.String(), Amount: strconv.FormatUint(token.Amount, 10)}
+		if token.HasNFT {
+			t.NFT = &NFTVerbose{Capability: token.Capability.String(),
+				Commitment: hex.EncodeToString(token.Commitment)}
+		}
+	}
+	return formatBCHValue(txOut.Value), s, t, nil
+}
+
+// formatBCHValue returns the value of satoshis in BCH with 8 decimals.
+func formatBCHValue(satoshis int64) json.Number {
+	sign, units := "", uint64(satoshis)
+	if satoshis < 0 {
+		sign, units = "-", uint64(-satoshis)
+	}
+	return json.Number(sign + TokenAmount{Units: units, Decimals: satoshiDecimals}.String())
+}
+
+// parseBCHValue returns the satoshis of a value in BCH, with at most 8
+// decimals.
+func parseBCHValue(value json.Number) (int64, error) {
+	a, err := ParseTokenAmount(value.String(), satoshiDecimals)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %s", value)
+	}
+	if a.Units > btcutil.MaxSatoshi {
+		return 0, fmt.Errorf("%w: value %s", ErrInvalidAmount, value)
+	}
+	return int64(a.Units), nil
+}
+
+// nodeASM returns the ASM of script as written by nodes: pushes of up to 4
+// bytes as numbers, other pushes in hex and opcodes by name.  If sigs is set,
+// pushes that are signatures end with the name of their sighash type in
+// brackets.  Malformed scripts are written [error].
+func nodeASM(script []byte, sigs bool) string {
+	ops, err := parseScript(script)
+	if err != nil {
+		return "[error]"
+	}
+	tokens := make([]string, len(ops))
+	for i, op := range ops {
+		switch {
+		case op.value > txscript.OP_PUSHDATA4:
+			tokens[i] = opcodeNames[op.value]
+			if op.value == txscript.OP_1NEGATE || (op.value >= txscript.OP_1 && op.value <= txscript.OP_16) {
+				data, _ := pushedData(op.value, nil)
+				n, _ := makeScriptNum(data, false, 1)
+				tokens[i] = strconv.FormatInt(int64(n), 10)
+			}
+		case len(op.data) <= 4:
+			n, _ := makeScriptNum(op.data, false, 4)
+			tokens[i] = strconv.FormatInt(int64(n), 10)
+		default:
+			tokens[i] = hex.EncodeToString(op.data)
+			if sig, ok := parseSignaturePush(op.data); sigs && ok {
+				tokens[i] = hex.EncodeToString(op.data[:len(op.data)-1]) + "[" + SigHashTypeString(sig.HashType) + "]"
+			}
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// UnmarshalTxVerbose decodes the verbose JSON form of a transaction, as
+// returned by the getrawtransaction and decoderawtransaction RPCs of nodes,
+// and returns the transaction and the outputs its inputs spend, nil where the
+// response does not include them.  The transaction is rebuilt from the inputs
+// and outputs, and must match the hex serialization if included.
+func UnmarshalTxVerbose(data []byte) (*wire.MsgTx, []*UTXO, error) {
+	var v TxVerbose
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, nil, err
+	}
+
+	tx := wire.NewMsgTx(v.Version)
+	tx.LockTime = v.LockTime
+	prevOuts := make([]*UTXO, len(v.Vin))
+	for i, vin := range v.Vin {
+		txIn := &wire.TxIn{Sequence: vin.Sequence}
+		if vin.TxID == "" {
+			script, err := hex.DecodeString(vin.Coinbase)
+			if err != nil {
+				return nil, nil, fmt.Errorf("vin %d: coinbase: %v", i, err)
+			}
+			txIn.PreviousOutPoint.Index = wire.MaxPrevOutIndex
+			txIn.SignatureScript = script
+			tx.AddTxIn(txIn)
+			continue
+		}
+		hash, err := chainhash.NewHashFromStr(vin.TxID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("vin %d: txid: %v", i, err)
+		}
+		txIn.PreviousOutPoint = wire.OutPoint{Hash: *hash, Index: vin.Vout}
+		if vin.ScriptSig != nil {
+			if txIn.SignatureScript, err = hex.DecodeString(vin.ScriptSig.Hex); err != nil {
+				return nil, nil, fmt.Errorf("vin %d: scriptSig: %v", i, err)
+			}
+		}
+		tx.AddTxIn(txIn)
+
+		if p := vin.Prevout; p != nil {
+			txOut, err := decodeOutputVerbose(p.Value, &p.ScriptPubKey, p.TokenData)
+			if err != nil {
+				return nil, nil, fmt.Errorf("vin %d: prevout: %w", i, err)
+			}
+			prevOuts[i] = &UTXO{OutPoint: txIn.PreviousOutPoint, Amount: btcutil.Amount(txOut.Value)}
+			token, pkScript, _ := SplitTokenPrefix(txOut.PkScript)
+			prevOuts[i].PkScript = pkScript
+			if token != nil {
+				prevOuts[i].TokenData = token.Bytes()
+			}
+		}
+	}
+	for i, vout := range v.Vout {
+		if vout.N != uint32(i) {
+			return nil, nil, fmt.Errorf("vout %d: index %d", i, vout.N)
+		}
+		txOut, err := decodeOutputVerbose(vout.Value, &vout.ScriptPubKey, vout.TokenData)
+		if err != nil {
+			return nil, nil, fmt.Errorf("vout %d: %w", i, err)
+		}
+		tx.AddTxOut(txOut)
+	}
+
+	if v.Hex != "" {
+		raw, err := hex.DecodeString(v.Hex)
+		if err != nil {
+			return nil, nil, fmt.Errorf("hex: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tx.Serialize(&buf); err != nil {
+			return nil, nil, err
+		}
+		if !bytes.Equal(raw, buf.Bytes()) {
+			return nil, nil, fmt.Errorf("transaction does not match its hex serialization")
+		}
+	}
+	if v.TxID != "" && v.TxID != tx.TxHash().String() {
+		return nil, nil, fmt.Errorf("txid %s, want %s", v.TxID, tx.TxHash())
+	}
+	return tx, prevOuts, nil
+}
+
+// decodeOutputVerbose returns the output of the verbose JSON forms of a value,
+// script and tokens.
+func decodeOutputVerbose(value json.Number, s *ScriptPubKeyVerbose, t *TokenDataVerbose) (*wire.TxOut, error) {
+	satoshis, err := parseBCHValue(value)
+	if err != nil {
+		return nil, err
+	}
+	pkScript, err := hex.DecodeString(s.Hex)
+	if err != nil {
+		return nil, fmt.Errorf("scriptPubKey: %v", err)
+	}
+	if t == nil {
+		return wire.NewTxOut(satoshis, pkScript), nil
+	}
+
+	token := &TokenData{}
+	category, err := chainhash.NewHashFromStr(t.Category)
+	if err != nil {
+		return nil, fmt.Errorf("%w: category: %v", ErrInvalidTokenPrefix, err)
+	}
+	token.Category = *category
+	if token.Amount, err = strconv.ParseUint(t.Amount, 10, 64); err != nil {
+		return nil, fmt.Errorf("%w: amount %q", ErrInvalidTokenPrefix, t.Amount)
+	}
+	if t.NFT != nil {
+		token.HasNFT = true
+		switch t.NFT.Capability {
+		case NFTImmutable.String():
+			token.Capability = NFTImmutable
+		case NFTMutable.String():
+			token.Capability = NFTMutable
+		case NFTMinting.String():
+			token.Capability = NFTMinting
+		default:
+			return nil, fmt.Errorf("%w: capability %q", ErrInvalidTokenPrefix, t.NFT.Capability)
+		}
+		if token.Commitment, err = hex.DecodeString(t.NFT.Commitment); err != nil {
+			return nil, fmt.Errorf("%w: commitment: %v", ErrInvalidTokenPrefix, err)
+		}
+	}
+	prefix := token.Bytes()
+	if _, _, err := ParseTokenData(prefix); err != nil {
+		return nil, err
+	}
+	return wire.NewTxOut(satoshis, append(prefix, pkScript...)), nil
+}
@@ -0,0 +1,118 @@
+package bchutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestMarshalTxVerbose(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	key := signingTestKeys()[0]
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(key.PubKey().SerializeCompressed()))
+	token := &TokenData{Category: chainhash.Hash{7}, Amount: 1000, HasNFT: true, Capability: NFTMutable,
+		Commitment: []byte{0xab}}
+	nullData, _ := txscript.NullDataScript([]byte("memo"))
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 3), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(10000000, p2pkh))
+	tx.AddTxOut(wire.NewTxOut(1000, append(token.Bytes(), p2pkh...)))
+	tx.AddTxOut(wire.NewTxOut(0, nullData))
+	tx.LockTime = 700000
+	prevOuts := []*UTXO{{OutPoint: tx.TxIn[0].PreviousOutPoint, Amount: 10011000, PkScript: p2pkh}}
+	var err error
+	tx.TxIn[0].SignatureScript, err = SignatureScript(tx, 0, p2pkh, txscript.SigHashAll|SigHashForkID, key,
+		true, 10011000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := MarshalTxVerbose(tx, prevOuts, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"value":0.10000000,`, `"value":0.00001000,`, `"value":0.00000000,`,
+		`"value":0.10011000,`, `"type":"pubkeyhash"`, `"type":"nulldata"`, `"locktime":700000`,
+		`"amount":"1000"`, `"capability":"mutable"`, `"commitment":"ab"`, `"category":"` + token.Category.String(),
+		`"txid":"` + tx.TxHash().String(), `"addresses":["bitcoincash:q`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("missing %s in %s", want, data)
+		}
+	}
+	var v TxVerbose
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if asm := v.Vin[0].ScriptSig.Asm; !strings.Contains(asm, "[ALL|FORKID] ") {
+		t.Errorf("got scriptSig asm %s", asm)
+	}
+	if asm := v.Vout[0].ScriptPubKey.Asm; !strings.HasPrefix(asm, "OP_DUP OP_HASH160 ") ||
+		!strings.HasSuffix(asm, " OP_EQUALVERIFY OP_CHECKSIG") {
+		t.Errorf("got scriptPubKey asm %s", asm)
+	}
+	if v.Vout[1].ScriptPubKey.Hex != v.Vout[0].ScriptPubKey.Hex {
+		t.Error("token prefix in scriptPubKey")
+	}
+
+	decoded, decodedPrevOuts, err := UnmarshalTxVerbose(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.TxHash() != tx.TxHash() {
+		t.Error("transaction does not round trip")
+	}
+	if p := decodedPrevOuts[0]; p == nil || p.Amount != prevOuts[0].Amount || !bytes.Equal(p.PkScript, p2pkh) {
+		t.Errorf("got prevout %+v", p)
+	}
+
+	// Responses without hex, such as those of decoderawtransaction, are
+	// rebuilt from their fields, and must agree with the hex otherwise.
+	v.Hex = ""
+	data, _ = json.Marshal(&v)
+	if decoded, _, err := UnmarshalTxVerbose(data); err != nil || decoded.TxHash() != tx.TxHash() {
+		t.Errorf("got %v, %v", decoded, err)
+	}
+	v.Vout[0].Value = "0.1"
+	data, _ = json.Marshal(&v)
+	if decoded, _, err := UnmarshalTxVerbose(data); err != nil || decoded.TxOut[0].Value != 10000000 {
+		t.Errorf("got %v, %v", decoded, err)
+	}
+	for _, value := range []json.Number{"0.000000001", "21000000.00000001", "-1", "1e-8"} {
+		v.Vout[0].Value = value
+		data, _ = json.Marshal(&v)
+		if _, _, err := UnmarshalTxVerbose(data); err == nil {
+			t.Errorf("decoded value %s", value)
+		}
+	}
+}
+
+func TestMarshalTxVerboseCoinbase(t *testing.T) {
+	p2pkh, _ := payToPubKeyHashScript(make([]byte, 20))
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), []byte{3, 1, 2, 3}, nil))
+	tx.AddTxOut(wire.NewTxOut(625000000, p2pkh))
+	data, err := MarshalTxVerbose(tx, nil, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"coinbase":"03010203"`) || !strings.Contains(string(data), `"value":6.25000000`) {
+		t.Errorf("got %s", data)
+	}
+	decoded, _, err := UnmarshalTxVerbose(data)
+	if err != nil || decoded.TxHash() != tx.TxHash() {
+		t.Errorf("got %v, %v", decoded, err)
+	}
+
+	data = bytes.Replace(data, []byte(`"hex":"01`), []byte(`"hex":"02`), 1)
+	if _, _, err := UnmarshalTxVerbose(data); err == nil {
+		t.Error("decoded transaction not matching its hex")
+	}
+}
@@ -0,0 +1,273 @@
+package bchutil
+
+import (
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Upgrade is a rule change of the Bitcoin Cash consensus.
+type Upgrade uint8
+
+const (
+	// UpgradeBIP66 requires strict DER signatures.
+	UpgradeBIP66 Upgrade = iota
+
+	// UpgradeBIP65 enables OP_CHECKLOCKTIMEVERIFY.
+	UpgradeBIP65
+
+	// UpgradeCSV enables relative lock times and
+	// OP_CHECKSEQUENCEVERIFY (BIPs 68, 112 and 113).
+	UpgradeCSV
+
+	// UpgradeUAHF is the August 2017 fork creating Bitcoin Cash, which
+	// requires fork id signatures.
+	UpgradeUAHF
+
+	// UpgradeDAA is the November 2017 upgrade, which requires low S and
+	// null failing signatures.
+	UpgradeDAA
+
+	// UpgradeMagneticAnomaly is the November 2018 upgrade, which requires
+	// push only scriptSigs and a clean stack, and orders transactions
+	// canonically.
+	UpgradeMagneticAnomaly
+
+	// UpgradeGreatWall is the May 2019 upgrade enabling Schnorr
+	// signatures.
+	UpgradeGreatWall
+
+	// UpgradeGraviton is the November 2019 upgrade, which requires minimal
+	// pushes and numbers and enables Schnorr multisig.
+	UpgradeGraviton
+
+	// UpgradePhonon is the May 2020 upgrade replacing signature operations
+	// by the signature checks limits.
+	UpgradePhonon
+
+	// UpgradeAxion is the November 2020 upgrade of the difficulty
+	// adjustment (ASERT), without script changes.
+	UpgradeAxion
+
+	// Upgrade8 is the May 2022 upgrade enabling native introspection and
+	// 64 bit integers.
+	Upgrade8
+
+	// Upgrade9 is the May 2023 upgrade enabling CashTokens and
+	// pay-to-script-hash with 32 byte hashes.
+	Upgrade9
+
+	numUpgrades
+)
+
+// upgradeNames are the names of the upgrades.
+var upgradeNames = [numUpgrades]string{
+	"BIP66", "BIP65", "CSV", "UAHF", "DAA", "Magnetic Anomaly", "Great Wall", "Graviton", "Phonon",
+	"Axion", "Upgrade 8", "Upgrade 9",
+}
+
+// String returns the name of the upgrade.
+func (u Upgrade) String() string {
+	if u >= numUpgrades {
+		return "unknown upgrade"
+	}
+	return upgradeNames[u]
+}
+
+// RuleSet is the set of the upgrades active in a block.
+type RuleSet uint32
+
+// LatestRules are the rules of all the upgrades, those of the main network
+// today.
+const LatestRules RuleSet = 1<<numUpgrades - 1
+
+// Has returns whether upgrade u is active.
+func (r RuleSet) Has(u Upgrade) bool {
+	return r&(1<<u) != 0
+}
+
+// String returns the names of the active upgrades.
+func (r RuleSet) String() string {
+	var names []string
+	for u := Upgrade(0); u < numUpgrades; u++ {
+		if r.Has(u) {
+			names = append(names, u.String())
+		}
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// Activation is when an upgrade activates on a network: with the blocks of
+// height above Height, or after the block whose median time past reaches
+// Time.  Heights are used for the upgrades whose activation is buried, and a
+// nil Activation never activates.
+type Activation struct {
+	// Height is the height of the last block of the old rules, -1 for
+	// upgrades active from the genesis block.
+	Height int32
+
+	// Time is the Unix activation time, used when Height is zero.
+	Time int64
+}
+
+// activeIn returns whether the activation is passed in the block of height
+// whose previous block has median time past mtp.
+func (a *Activation) activeIn(height int32, mtp time.Time) bool {
+	switch {
+	case a == nil:
+		return false
+	case a.Height != 0:
+		return height > a.Height
+	}
+	return mtp.Unix() >= a.Time
+}
+
+// UpgradeSchedule is the activation of each upgrade on a network.
+type UpgradeSchedule [numUpgrades]*Activation
+
+// atHeight returns the activation after the block of height.
+func atHeight(height int32) *Activation {
+	return &Activation{Height: height}
+}
+
+// atTime returns the activation at the median time past t.
+func atTime(t int64) *Activation {
+	return &Activation{Time: t}
+}
+
+// fromGenesis is the activation of upgrades active from the genesis block.
+var fromGenesis = atHeight(-1)
+
+// Activation times of the upgrades decided by the median time past, on the
+// main network and on chipnet, which activates them six months earlier.
+const (
+	upgrade8Time        = 1652616000
+	upgrade9Time        = 1684152000
+	chipnetUpgrade9Time = 1668513600
+)
+
+var (
+	// mainNetSchedule is the schedule of the Bitcoin Cash main network.
+	mainNetSchedule = UpgradeSchedule{
+		UpgradeBIP66:           atHeight(363724),
+		UpgradeBIP65:           atHeight(388380),
+		UpgradeCSV:             atHeight(419327),
+		UpgradeUAHF:            atHeight(478558),
+		UpgradeDAA:             atHeight(504031),
+		UpgradeMagneticAnomaly: atHeight(556766),
+		UpgradeGreatWall:       atHeight(582679),
+		UpgradeGraviton:        atHeight(609135),
+		UpgradePhonon:          atHeight(635258),
+		UpgradeAxion:           atHeight(661647),
+		Upgrade8:               atTime(upgrade8Time),
+		Upgrade9:               atTime(upgrade9Time),
+	}
+
+	// testNet3Schedule is the schedule of testnet3.
+	testNet3Schedule = UpgradeSchedule{
+		UpgradeBIP66:           atHeight(330775),
+		UpgradeBIP65:           atHeight(581884),
+		UpgradeCSV:             atHeight(770111),
+		UpgradeUAHF:            atHeight(1155875),
+		UpgradeDAA:             atHeight(1188697),
+		UpgradeMagneticAnomaly: atHeight(1267996),
+		UpgradeGreatWall:       atHeight(1303884),
+		UpgradeGraviton:        atHeight(1341711),
+		UpgradePhonon:          atHeight(1378460),
+		UpgradeAxion:           atHeight(1421481),
+		Upgrade8:               atTime(upgrade8Time),
+		Upgrade9:               atTime(upgrade9Time),
+	}
+
+	// chipNetSchedule is the schedule of chipnet, which shares the history
+	// of testnet4 up to its earlier activation of Upgrade 9.
+	chipNetSchedule = UpgradeSchedule{
+		UpgradeBIP66:           fromGenesis,
+		UpgradeBIP65:           fromGenesis,
+		UpgradeCSV:             fromGenesis,
+		UpgradeUAHF:            atHeight(5),
+		UpgradeDAA:             atHeight(3000),
+		UpgradeMagneticAnomaly: atHeight(3999),
+		UpgradeGreatWall:       fromGenesis,
+		UpgradeGraviton:        atHeight(4999),
+		UpgradePhonon:          fromGenesis,
+		UpgradeAxion:           atHeight(16844),
+		Upgrade8:               atTime(1637694000),
+		Upgrade9:               atTime(chipnetUpgrade9Time),
+	}
+)
+
+// eCashSchedule returns the schedule of an eCash network, that of the
+// Bitcoin Cash network base, from which it split at the Axion upgrade,
+// without the later upgrades.
+func eCashSchedule(base UpgradeSchedule) UpgradeSchedule {
+	base[Upgrade8], base[Upgrade9] = nil, nil
+	return base
+}
+
+// upgradeSchedules are the schedules of the networks, by name.
+var upgradeSchedules = map[string]UpgradeSchedule{
+	chaincfg.MainNetParams.Name:  mainNetSchedule,
+	chaincfg.TestNet3Params.Name: testNet3Schedule,
+	ChipNetName:                  chipNetSchedule,
+	ECashMainNetParams.Name:      eCashSchedule(mainNetSchedule),
+	ECashTestNetParams.Name:      eCashSchedule(testNet3Schedule),
+}
+
+// ChipNetName is the name of the parameters of chipnet, the test network of
+// upcoming upgrades, whose schedule ActiveRules knows.  btcd has no
+// parameters for it, so that callers must provide them with this name.
+const ChipNetName = "chipnet"
+
+// RegisterUpgradeSchedule sets the upgrade schedule of the networks named
+// netName, replacing that of a known network.
+func RegisterUpgradeSchedule(netName string, schedule UpgradeSchedule) {
+	upgradeSchedules[netName] = schedule
+}
+
+// ActiveRules returns the upgrades active in the block of height height on
+// the network of params, whose previous block has median time past mtp.
+// Upgrades are known for the main network, testnet3, chipnet, the eCash
+// networks and those of RegisterUpgradeSchedule; other networks, such as
+// regtest, have all the upgrades active from their genesis block.
+func ActiveRules(params *chaincfg.Params, height int32, mtp time.Time) RuleSet {
+	schedule, ok := upgradeSchedules[params.Name]
+	if !ok {
+		return LatestRules
+	}
+	var rules RuleSet
+	for u, activation := range schedule {
+		if activation.activeIn(height, mtp) {
+			rules |= 1 << u
+		}
+	}
+	return rules
+}
+
+// ScriptFlagsFor returns the consensus script flags of the blocks following
+// rules.  Pay-to-script-hash evaluation (BIP 16), enforced since 2012, is
+// always enabled.  Policy adds ScriptDiscourageUpgradableNops, so that
+// StandardScriptFlags are those of LatestRules with it.
+func ScriptFlagsFor(rules RuleSet) ScriptFlags {
+	flags := ScriptBip16
+	for _, rule := range []struct {
+		upgrade Upgrade
+		flags   ScriptFlags
+	}{
+		{UpgradeBIP66, ScriptVerifyDERSignatures},
+		{UpgradeBIP65, ScriptVerifyCheckLockTimeVerify},
+		{UpgradeCSV, ScriptVerifyCheckSequenceVerify},
+		{UpgradeUAHF, ScriptVerifyStrictEncoding | ScriptEnableSighashForkID},
+		{UpgradeDAA, ScriptVerifyLowS | ScriptVerifyNullFail},
+		{UpgradeMagneticAnomaly, ScriptVerifySigPushOnly | ScriptVerifyCleanStack},
+		{UpgradeGreatWall, ScriptEnableSchnorr},
+		{UpgradeGraviton, ScriptVerifyMinimalData | ScriptEnableSchnorrMultisig},
+		{Upgrade9, ScriptEnableP2SH32},
+	} {
+		if rules.Has(rule.upgrade) {
+			flags |= rule.flags
+		}
+	}
+	return flags
+}
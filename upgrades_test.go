@@ -0,0 +1,133 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestActiveRules(t *testing.T) {
+	chipnet := chaincfg.TestNet3Params
+	chipnet.Name = ChipNetName
+	before9, after9 := time.Unix(1668513599, 0), time.Unix(1684152000, 0)
+
+	tests := []struct {
+		params *chaincfg.Params
+		height int32
+		mtp    time.Time
+		has    []Upgrade
+		hasNot []Upgrade
+	}{
+		{&chaincfg.MainNetParams, 478558, time.Unix(1501590000, 0), []Upgrade{UpgradeCSV},
+			[]Upgrade{UpgradeUAHF}},
+		{&chaincfg.MainNetParams, 478559, time.Unix(1501590000, 0), []Upgrade{UpgradeUAHF},
+			[]Upgrade{UpgradeDAA}},
+		{&chaincfg.MainNetParams, 635259, time.Unix(1589544000, 0), []Upgrade{UpgradePhonon},
+			[]Upgrade{UpgradeAxion, Upgrade8}},
+		{&chaincfg.MainNetParams, 790000, after9, []Upgrade{Upgrade8, Upgrade9}, nil},
+		// Chipnet activated Upgrade 9 six months before the other networks.
+		{&chipnet, 120000, before9, []Upgrade{Upgrade8}, []Upgrade{Upgrade9}},
+		{&chipnet, 120000, time.Unix(1668513600, 0), []Upgrade{Upgrade9}, nil},
+		{&chaincfg.TestNet3Params, 1500000, time.Unix(1668513600, 0), []Upgrade{Upgrade8}, []Upgrade{Upgrade9}},
+		{&ECashMainNetParams, 800000, after9, []Upgrade{UpgradeAxion}, []Upgrade{Upgrade8, Upgrade9}},
+		{&chaincfg.RegressionNetParams, 1, time.Unix(0, 0), []Upgrade{UpgradeUAHF, Upgrade9}, nil},
+	}
+	for _, test := range tests {
+		rules := ActiveRules(test.params, test.height, test.mtp)
+		for _, u := range test.has {
+			if !rules.Has(u) {
+				t.Errorf("%s at %d: %v not active in %v", test.params.Name, test.height, u, rules)
+			}
+		}
+		for _, u := range test.hasNot {
+			if rules.Has(u) {
+				t.Errorf("%s at %d: %v active in %v", test.params.Name, test.height, u, rules)
+			}
+		}
+	}
+
+	custom := chaincfg.RegressionNetParams
+	custom.Name = "test-upgrades"
+	RegisterUpgradeSchedule(custom.Name, UpgradeSchedule{UpgradeUAHF: {Height: 10}})
+	defer delete(upgradeSchedules, custom.Name)
+	if rules := ActiveRules(&custom, 11, time.Now()); rules != 1<<UpgradeUAHF {
+		t.Errorf("registered schedule: got %v", rules)
+	}
+}
+
+func TestScriptFlagsFor(t *testing.T) {
+	if flags := ScriptFlagsFor(LatestRules); flags != ConsensusScriptFlags ||
+		flags|ScriptDiscourageUpgradableNops != StandardScriptFlags {
+		t.Errorf("latest rules: got %#x, want %#x", flags, ConsensusScriptFlags)
+	}
+	uahf := ActiveRules(&chaincfg.MainNetParams, 478559, time.Unix(1501590000, 0))
+	if flags := ScriptFlagsFor(uahf); flags&ScriptEnableSighashForkID == 0 || flags&ScriptVerifyLowS != 0 ||
+		flags&ScriptVerifyCleanStack != 0 {
+		t.Errorf("UAHF: got %#x", flags)
+	}
+
+	// A transaction of the 2018 rules leaving two items on the stack,
+	// standard before the clean stack rule.
+	tx := engineTestTx([]byte{txscript.OP_1, txscript.OP_1})
+	tx.TxOut[0].PkScript, _ = payToPubKeyHashScript(make([]byte, 20))
+	prevOuts := map[int]*wire.TxOut{0: wire.NewTxOut(100000, []byte{txscript.OP_NOP})}
+	daa := ActiveRules(&chaincfg.MainNetParams, 556766, time.Unix(1542300000, 0))
+	if err := ValidatePolicy(tx, prevOuts, WithRules(daa)); err != nil {
+		t.Errorf("before Magnetic Anomaly: %v", err)
+	}
+	if err := ValidatePolicy(tx, prevOuts); err == nil {
+		t.Error("dirty stack accepted with the latest rules")
+	}
+}
+
+// TestScriptFlagsForSchnorr checks the activation of Schnorr signatures by
+// the Great Wall upgrade, and of Schnorr multisig by Graviton.
+func TestScriptFlagsForSchnorr(t *testing.T) {
+	key := signingTestKeys()[0]
+	pubKey := key.PubKey().SerializeCompressed()
+	p2pkh, _ := payToPubKeyHashScript(btcutil.Hash160(pubKey))
+	multisig, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_1).AddData(pubKey).AddOp(txscript.OP_1).
+		AddOp(txscript.OP_CHECKMULTISIG).Script()
+	execute := func(height int32, pkScript []byte, dummy bool) error {
+		t.Helper()
+		tx := engineTestTx(nil)
+		sig, err := RawTxInSignature(tx, 0, pkScript, SigHashAllForkID, key, 1000, WithSchnorr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder := txscript.NewScriptBuilder()
+		if dummy {
+			// The bitfield selecting the only key.
+			builder.AddData([]byte{0x01})
+		}
+		builder.AddData(sig)
+		if !dummy {
+			builder.AddData(pubKey)
+		}
+		tx.TxIn[0].SignatureScript, _ = builder.Script()
+		rules := ActiveRules(&chaincfg.MainNetParams, height, time.Unix(1550000000, 0))
+		vm, err := NewEngine(pkScript, tx, 0, ScriptFlagsFor(rules), nil, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vm.Execute()
+	}
+
+	if err := execute(582679, p2pkh, false); !errors.Is(err, ErrSigEncoding) {
+		t.Errorf("Schnorr signature before Great Wall: got %v, want %v", err, ErrSigEncoding)
+	}
+	if err := execute(582680, p2pkh, false); err != nil {
+		t.Errorf("Schnorr signature after Great Wall: %v", err)
+	}
+	if err := execute(609135, multisig, true); !errors.Is(err, ErrSigEncoding) {
+		t.Errorf("Schnorr multisig before Graviton: got %v, want %v", err, ErrSigEncoding)
+	}
+	if err := execute(609136, multisig, true); err != nil {
+		t.Errorf("Schnorr multisig after Graviton: %v", err)
+	}
+}
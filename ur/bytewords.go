@@ -0,0 +1,95 @@
+package ur
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// bytewords are the words of the Bytewords encoding of each byte value,
+// identified in its minimal form by their first and last letters.
+var bytewords = [256]string{
+	"able", "acid", "also", "apex", "aqua", "arch", "atom", "aunt",
+	"away", "axis", "back", "bald", "barn", "belt", "beta", "bias",
+	"blue", "body", "brag", "brew", "bulb", "buzz", "calm", "cash",
+	"cats", "chef", "city", "claw", "code", "cola", "cook", "cost",
+	"crux", "curl", "cusp", "cyan", "dark", "data", "days", "deli",
+	"dice", "diet", "door", "down", "draw", "drop", "drum", "dull",
+	"duty", "each", "easy", "echo", "edge", "epic", "even", "exam",
+	"exit", "eyes", "fact", "fair", "fern", "figs", "film", "fish",
+	"fizz", "flap", "flew", "flux", "foxy", "free", "frog", "fuel",
+	"fund", "gala", "game", "gear", "gems", "gift", "girl", "glow",
+	"good", "gray", "grim", "guru", "gush", "gyro", "half", "hang",
+	"hard", "hawk", "heat", "help", "high", "hill", "holy", "hope",
+	"horn", "huts", "iced", "idea", "idle", "inch", "inky", "into",
+	"iris", "iron", "item", "jade", "jazz", "join", "jolt", "jowl",
+	"judo", "jugs", "jump", "junk", "jury", "keep", "keno", "kept",
+	"keys", "kick", "kiln", "king", "kite", "kiwi", "knob", "lamb",
+	"lava", "lazy", "leaf", "legs", "liar", "limp", "lion", "list",
+	"logo", "loud", "love", "luau", "luck", "lung", "main", "many",
+	"math", "maze", "memo", "menu", "meow", "mild", "mint", "miss",
+	"monk", "nail", "navy", "need", "news", "next", "noon", "note",
+	"numb", "obey", "oboe", "omit", "onyx", "open", "oval", "owls",
+	"paid", "part", "peck", "play", "plus", "poem", "pool", "pose",
+	"puff", "puma", "purr", "quad", "quiz", "race", "ramp", "real",
+	"redo", "rich", "road", "rock", "roof", "ruby", "ruin", "runs",
+	"rust", "safe", "saga", "scar", "sets", "silk", "skew", "slot",
+	"soap", "solo", "song", "stub", "surf", "swan", "taco", "task",
+	"taxi", "tent", "tied", "time", "tiny", "toil", "tomb", "toys",
+	"trip", "tuna", "twin", "ugly", "undo", "unit", "urge", "user",
+	"vast", "very", "veto", "vial", "vibe", "view", "visa", "void",
+	"vows", "wall", "wand", "warm", "wasp", "wave", "waxy", "webs",
+	"what", "when", "whiz", "wolf", "work", "yank", "yawn", "yell",
+	"yoga", "yurt", "zaps", "zero", "zest", "zinc", "zone", "zoom",
+}
+
+// minimalBytewords maps the first and last letters of the bytewords to their
+// byte values.
+var minimalBytewords = func() map[string]byte {
+	m := make(map[string]byte, len(bytewords))
+	for i, w := range bytewords {
+		m[w[:1]+w[3:]] = byte(i)
+	}
+	return m
+}()
+
+// encodeBytewords returns the minimal Bytewords encoding of data followed by
+// its CRC-32, the first and last letters of the word of each byte.
+func encodeBytewords(data []byte) string {
+	var checksum [4]byte
+	binary.BigEndian.PutUint32(checksum[:], crc32.ChecksumIEEE(data))
+	var b strings.Builder
+	b.Grow(2 * (len(data) + len(checksum)))
+	for _, c := range append(append([]byte(nil), data...), checksum[:]...) {
+		w := bytewords[c]
+		b.WriteByte(w[0])
+		b.WriteByte(w[3])
+	}
+	return b.String()
+}
+
+// decodeBytewords decodes the minimal Bytewords encoding s, in either case,
+// and checks and strips its CRC-32.
+func decodeBytewords(s string) ([]byte, error) {
+	if len(s)%2 != 0 {
+		return nil, fmt.Errorf("%w: odd bytewords length %d", ErrInvalidUR, len(s))
+	}
+	s = strings.ToLower(s)
+	data := make([]byte, len(s)/2)
+	for i := range data {
+		c, ok := minimalBytewords[s[2*i:2*i+2]]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown byteword %q", ErrInvalidUR, s[2*i:2*i+2])
+		}
+		data[i] = c
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("%w: bytewords too short for their checksum", ErrInvalidUR)
+	}
+	data, checksum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, fmt.Errorf("%w: bytewords", ErrChecksum)
+	}
+	return data, nil
+}
@@ -0,0 +1,38 @@
+package ur
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBytewords(t *testing.T) {
+	// The example of BCR-2020-012.
+	data, _ := hex.DecodeString("d9012ca20150c7098580125e2ab0981253468b2dbc5202d8641947da")
+	words := "tuna acid draw oboe acid good slot axis limp lava brag holy door puff monk brag guru frog luau drop " +
+		"roof grim also trip idle chef fuel twin tied draw grim ramp"
+	var minimal strings.Builder
+	for _, w := range strings.Fields(words) {
+		minimal.WriteString(w[:1] + w[3:])
+	}
+	if got := encodeBytewords(data); got != minimal.String() {
+		t.Errorf("got %s, want %s", got, minimal.String())
+	}
+	decoded, err := decodeBytewords(strings.ToUpper(minimal.String()))
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("got %x, %v", decoded, err)
+	}
+
+	encoded := encodeBytewords(data)
+	corrupted := encoded[:10] + "ae" + encoded[12:]
+	if _, err := decodeBytewords(corrupted); !errors.Is(err, ErrChecksum) {
+		t.Errorf("got %v, want ErrChecksum", err)
+	}
+	for _, s := range []string{encoded[1:], "zz" + encoded, encoded[:6]} {
+		if _, err := decodeBytewords(s); !errors.Is(err, ErrInvalidUR) {
+			t.Errorf("%s: got %v, want ErrInvalidUR", s, err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package ur
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	// minFragmentLen is the shortest fragment of multi-part messages.
+	minFragmentLen = 10
+
+	// maxMessageLen bounds the messages decoded, against parts claiming
+	// messages too large to allocate.
+	maxMessageLen = 1 << 24
+)
+
+// xoshiro256 is the xoshiro256** generator choosing the fragments mixed into
+// the parts of a message, seeded with the SHA-256 of a seed.
+type xoshiro256 [4]uint64
+
+// newXoshiro256 returns the generator seeded with seed.
+func newXoshiro256(seed []byte) *xoshiro256 {
+	sum := sha256.Sum256(seed)
+	var x xoshiro256
+	for i := range x {
+		x[i] = binary.BigEndian.Uint64(sum[8*i:])
+	}
+	return &x
+}
+
+// next returns the next number of the generator.
+func (x *xoshiro256) next() uint64 {
+	result := bits.RotateLeft64(x[1]*5, 7) * 9
+	t := x[1] << 17
+	x[2] ^= x[0]
+	x[3] ^= x[1]
+	x[1] ^= x[2]
+	x[0] ^= x[3]
+	x[2] ^= t
+	x[3] = bits.RotateLeft64(x[3], 45)
+	return result
+}
+
+// nextDouble returns the next number of the generator in [0, 1].
+func (x *xoshiro256) nextDouble() float64 {
+	return float64(x.next()) / (float64(^uint64(0)) + 1)
+}
+
+// nextInt returns the next number of the generator in [low, high].
+func (x *xoshiro256) nextInt(low, high int) int {
+	return int(x.nextDouble()*float64(high-low+1)) + low
+}
+
+// randomSampler samples indexes with the probabilities it was built with, by
+// the alias method of Vose, as the reference implementation does to match its
+// choices.
+type randomSampler struct {
+	probs   []float64
+	aliases []int
+}
+
+// newRandomSampler returns the sampler of the indexes of probs with their
+// probabilities, normalized.
+func newRandomSampler(probs []float64) *randomSampler {
+	n := len(probs)
+	sum := 0.0
+	for _, p := range probs {
+		sum += p
+	}
+	scaled := make([]float64, n)
+	for i, p := range probs {
+		scaled[i] = p * float64(n) / sum
+	}
+	var small, large []int
+	for i := n - 1; i >= 0; i-- {
+		if scaled[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+	s := &randomSampler{probs: make([]float64, n), aliases: make([]int, n)}
+	for len(small) != 0 && len(large) != 0 {
+		a, g := small[len(small)-1], large[len(large)-1]
+		small, large = small[:len(small)-1], large[:len(large)-1]
+		s.probs[a] = scaled[a]
+		s.aliases[a] = g
+		scaled[g] += scaled[a] - 1
+		if scaled[g] < 1 {
+			small = append(small, g)
+		} else {
+			large = append(large, g)
+		}
+	}
+	// Indexes left in small only have a probability below 1 by rounding.
+	for _, i := range append(large, small...) {
+		s.probs[i] = 1
+	}
+	return s
+}
+
+// next returns an index sampled with the numbers of rng.
+func (s *randomSampler) next(rng *xoshiro256) int {
+	r1, r2 := rng.nextDouble(), rng.nextDouble()
+	i := int(float64(len(s.probs)) * r1)
+	if r2 < s.probs[i] {
+		return i
+	}
+	return s.aliases[i]
+}
+
+// chooseDegree returns the number of the seqLen fragments to mix into a
+// part, n with a probability proportional to 1/n.
+func chooseDegree(seqLen int, rng *xoshiro256) int {
+	probs := make([]float64, seqLen)
+	for i := range probs {
+		probs[i] = 1 / float64(i+1)
+	}
+	return newRandomSampler(probs).next(rng) + 1
+}
+
+// shuffled returns the items shuffled with rng.
+func shuffled(items []int, rng *xoshiro256) []int {
+	remaining := append([]int(nil), items...)
+	result := make([]int, 0, len(items))
+	for len(remaining) != 0 {
+		i := rng.nextInt(0, len(remaining)-1)
+		result = append(result, remaining[i])
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+	return result
+}
+
+// chooseFragments returns the indexes of the fragments mixed into the part
+// seqNum of the message of seqLen fragments and CRC-32 checksum: the
+// fragment seqNum-1 for the first seqLen parts, and then a random set.
+func chooseFragments(seqNum uint32, seqLen int, checksum uint32) []int {
+	if int64(seqNum) <= int64(seqLen) {
+		return []int{int(seqNum) - 1}
+	}
+	var seed [8]byte
+	binary.BigEndian.PutUint32(seed[:4], seqNum)
+	binary.BigEndian.PutUint32(seed[4:], checksum)
+	rng := newXoshiro256(seed[:])
+	degree := chooseDegree(seqLen, rng)
+	indexes := make([]int, seqLen)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return shuffled(indexes, rng)[:degree]
+}
+
+// fragmentLen returns the length of the fragments of a message of
+// messageLen bytes, of at most maxFragmentLen bytes but for messages
+// splitting into fragments shorter than minFragmentLen, with the fewest
+// fragments of the most even length.
+func fragmentLen(messageLen, maxFragmentLen int) int {
+	maxFragments := messageLen / minFragmentLen
+	if maxFragments < 1 {
+		maxFragments = 1
+	}
+	n := messageLen
+	for fragments := 1; fragments <= maxFragments; fragments++ {
+		n = (messageLen + fragments - 1) / fragments
+		if n <= maxFragmentLen {
+			break
+		}
+	}
+	return n
+}
+
+// part is a part of a multi-part message: the fragments of indexes mixed
+// together, of a message of seqLen fragments.
+type part struct {
+	seqNum     uint32
+	seqLen     int
+	messageLen int
+	checksum   uint32
+	data       []byte
+}
+
+// cborHead appends the head of a CBOR item of major type major and argument
+// v, in its shortest form.
+func cborHead(b []byte, major byte, v uint64) []byte {
+	major <<= 5
+	switch {
+	case v < 24:
+		return append(b, major|byte(v))
+	case v <= 0xff:
+		return append(b, major|24, byte(v))
+	case v <= 0xffff:
+		return append(b, major|25, byte(v>>8), byte(v))
+	case v <= 0xffffffff:
+		return append(b, major|26, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	b = append(b, major|27)
+	return binary.BigEndian.AppendUint64(b, v)
+}
+
+// encode returns the CBOR encoding of p, the array of its sequence number,
+// sequence length, message length, checksum and data.
+func (p *part) encode() []byte {
+	b := cborHead(nil, 4, 5)
+	b = cborHead(b, 0, uint64(p.seqNum))
+	b = cborHead(b, 0, uint64(p.seqLen))
+	b = cborHead(b, 0, uint64(p.messageLen))
+	b = cborHead(b, 0, uint64(p.checksum))
+	b = cborHead(b, 2, uint64(len(p.data)))
+	return append(b, p.data...)
+}
+
+// cborDecoder reads the CBOR items of a part.
+type cborDecoder struct {
+	b   []byte
+	err error
+}
+
+// head returns the argument of the next item, which must be of type major
+// and in its shortest form.
+func (d *cborDecoder) head(major byte) uint64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.b) == 0 || d.b[0]>>5 != major {
+		d.err = fmt.Errorf("%w: part is not the CBOR of a part", ErrInvalidUR)
+		return 0
+	}
+	info := d.b[0] & 0x1f
+	d.b = d.b[1:]
+	if info < 24 {
+		return uint64(info)
+	}
+	if info > 27 || len(d.b) < 1<<(info-24) {
+		d.err = fmt.Errorf("%w: truncated CBOR of a part", ErrInvalidUR)
+		return 0
+	}
+	n := 1 << (info - 24)
+	var v uint64
+	for _, c := range d.b[:n] {
+		v = v<<8 | uint64(c)
+	}
+	d.b = d.b[n:]
+	if info > 24 && v>>(4*n) == 0 || info == 24 && v < 24 {
+		d.err = fmt.Errorf("%w: non-canonical CBOR of a part", ErrInvalidUR)
+	}
+	return v
+}
+
+// decodePart decodes the CBOR encoding of a part.
+func decodePart(b []byte) (*part, error) {
+	d := &cborDecoder{b: b}
+	if n := d.head(4); d.err == nil && n != 5 {
+		return nil, fmt.Errorf("%w: part of %d items", ErrInvalidUR, n)
+	}
+	seqNum, seqLen, messageLen, checksum := d.head(0), d.head(0), d.head(0), d.head(0)
+	dataLen := d.head(2)
+	if d.err != nil {
+		return nil, d.err
+	}
+	if dataLen != uint64(len(d.b)) {
+		return nil, fmt.Errorf("%w: part data of %d bytes, %d left", ErrInvalidUR, dataLen, len(d.b))
+	}
+	if seqNum == 0 || seqNum > 0xffffffff || seqLen == 0 || checksum > 0xffffffff || messageLen < seqLen ||
+		messageLen > maxMessageLen {
+		return nil, fmt.Errorf("%w: part %d of %d of a %d byte message", ErrInvalidUR, seqNum, seqLen,
+			messageLen)
+	}
+	if dataLen == 0 || dataLen*seqLen < messageLen || dataLen*(seqLen-1) >= messageLen {
+		return nil, fmt.Errorf("%w: fragments of %d bytes for a %d byte message of %d fragments",
+			ErrInvalidUR, dataLen, messageLen, seqLen)
+	}
+	return &part{seqNum: uint32(seqNum), seqLen: int(seqLen), messageLen: int(messageLen),
+		checksum: uint32(checksum), data: append([]byte(nil), d.b...)}, nil
+}
@@ -0,0 +1,101 @@
+package ur
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"testing"
+)
+
+// makeMessage returns the n pseudo-random bytes of the messages of the tests
+// of the reference implementation.
+func makeMessage(n int, seed string) []byte {
+	rng := newXoshiro256([]byte(seed))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rng.nextInt(0, 255))
+	}
+	return b
+}
+
+func TestXoshiro256(t *testing.T) {
+	// The vectors of the reference implementation.
+	rng := newXoshiro256([]byte("Wolf"))
+	want := []uint64{42, 81, 85, 8, 82, 84, 76, 73, 70, 88, 2, 74, 40, 48, 77, 54, 88, 7, 5, 88}
+	for i, w := range want {
+		if got := rng.next() % 100; got != w {
+			t.Fatalf("number %d: got %d, want %d", i, got, w)
+		}
+	}
+	rng = newXoshiro256([]byte("Wolf"))
+	if got := shuffled([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, rng); !reflect.DeepEqual(got,
+		[]int{6, 4, 9, 3, 10, 5, 7, 8, 1, 2}) {
+		t.Errorf("got shuffle %v", got)
+	}
+	if got := crc32.ChecksumIEEE(makeMessage(256, "Wolf")); got != 23570951 {
+		t.Errorf("got message checksum %d", got)
+	}
+}
+
+func TestChooseFragments(t *testing.T) {
+	for seqNum := uint32(1); seqNum <= 9; seqNum++ {
+		if got := chooseFragments(seqNum, 9, 1234); !reflect.DeepEqual(got, []int{int(seqNum) - 1}) {
+			t.Errorf("part %d mixes %v", seqNum, got)
+		}
+	}
+	for seqNum := uint32(10); seqNum < 100; seqNum++ {
+		indexes := chooseFragments(seqNum, 9, 1234)
+		seen := make(map[int]bool)
+		for _, i := range indexes {
+			if i < 0 || i >= 9 || seen[i] {
+				t.Fatalf("part %d mixes %v", seqNum, indexes)
+			}
+			seen[i] = true
+		}
+		if len(indexes) == 0 || !reflect.DeepEqual(indexes, chooseFragments(seqNum, 9, 1234)) {
+			t.Fatalf("part %d mixes %v", seqNum, indexes)
+		}
+	}
+}
+
+func TestFragmentLen(t *testing.T) {
+	tests := []struct {
+		messageLen, maxFragmentLen, want int
+	}{
+		{259, 30, 29},
+		{100, 100, 100},
+		{101, 100, 51},
+		{5, 10, 5},
+		{1000, 10, 10},
+	}
+	for _, test := range tests {
+		if got := fragmentLen(test.messageLen, test.maxFragmentLen); got != test.want {
+			t.Errorf("%d bytes in fragments of at most %d: got %d, want %d", test.messageLen,
+				test.maxFragmentLen, got, test.want)
+		}
+	}
+}
+
+func TestPartEncoding(t *testing.T) {
+	p := &part{seqNum: 12, seqLen: 9, messageLen: 259, checksum: 0x0167aac7, data: bytes.Repeat([]byte{7}, 29)}
+	decoded, err := decodePart(p.encode())
+	if err != nil || !reflect.DeepEqual(decoded, p) {
+		t.Fatalf("got %+v, %v", decoded, err)
+	}
+
+	tests := [][]byte{
+		append(p.encode(), 0),
+		p.encode()[:20],
+		// The sequence number 12 encoded in two bytes.
+		append([]byte{0x85, 0x18, 12}, p.encode()[2:]...),
+		// Fragments of 29 bytes for a message of 500.
+		(&part{seqNum: 1, seqLen: 9, messageLen: 500, checksum: 1, data: make([]byte, 29)}).encode(),
+		(&part{seqNum: 0, seqLen: 9, messageLen: 259, checksum: 1, data: make([]byte, 29)}).encode(),
+	}
+	for i, b := range tests {
+		if _, err := decodePart(b); !errors.Is(err, ErrInvalidUR) {
+			t.Errorf("test %d: got %v, want ErrInvalidUR", i, err)
+		}
+	}
+}
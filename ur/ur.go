@@ -0,0 +1,335 @@
+// Package ur encodes payloads as Uniform Resources, the "ur:" strings of
+// BCR-2020-005 that air-gapped wallets exchange as QR codes.
+//
+// Payloads too large for one QR code are split into fragments and sent as an
+// animated sequence of parts "ur:type/seqNum-seqLen/...".  The first seqLen
+// parts carry each fragment, and the following ones, endlessly, the XOR of a
+// pseudo-random set of fragments: this fountain code lets a decoder scanning
+// parts in any order, and missing some, recover the payload from a few more
+// parts than fragments.  Part bodies are the CBOR array of the sequence
+// number, the sequence length, the length and CRC-32 of the payload and the
+// fragment data, in minimal Bytewords followed by their CRC-32.  Fragments
+// are chosen as the reference implementation chooses them, so that parts are
+// interchangeable with those of other wallets.
+package ur
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidUR describes an error where a string is not a valid part
+	// of a Uniform Resource.
+	ErrInvalidUR = errors.New("invalid UR")
+
+	// ErrChecksum describes an error where the CRC-32 of Bytewords or of a
+	// payload reconstructed does not match.
+	ErrChecksum = errors.New("UR checksum mismatch")
+
+	// ErrInconsistentPart describes an error where a part belongs to
+	// another payload than the parts received before.
+	ErrInconsistentPart = errors.New("UR part of another payload")
+)
+
+// checkType returns an error unless typeString is a UR type: lowercase
+// letters, digits and hyphens.
+func checkType(typeString string) error {
+	if typeString == "" {
+		return fmt.Errorf("%w: empty type", ErrInvalidUR)
+	}
+	for i := 0; i < len(typeString); i++ {
+		c := typeString[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-') {
+			return fmt.Errorf("%w: character %q in type", ErrInvalidUR, c)
+		}
+	}
+	return nil
+}
+
+// Encoder generates the parts of a payload.
+type Encoder struct {
+	typeString string
+	payload    []byte
+	fragments  [][]byte
+	checksum   uint32
+	seqNum     uint32
+}
+
+// EncodeUR returns the encoder of payload, the CBOR encoding of a value of
+// the registered type typeString such as "bytes" or "crypto-psbt", in parts
+// of at most maxFragmentLen payload bytes.  Payloads of at most
+// maxFragmentLen bytes are encoded as single part URs "ur:type/...".
+func EncodeUR(typeString string, payload []byte, maxFragmentLen int) (*Encoder, error) {
+	if err := checkType(typeString); err != nil {
+		return nil, err
+	}
+	if len(payload) == 0 || len(payload) > maxMessageLen {
+		return nil, fmt.Errorf("%w: payload of %d bytes", ErrInvalidUR, len(payload))
+	}
+	if maxFragmentLen < minFragmentLen {
+		return nil, fmt.Errorf("%w: fragments of at most %d bytes, want at least %d", ErrInvalidUR,
+			maxFragmentLen, minFragmentLen)
+	}
+	e := &Encoder{typeString: typeString, payload: append([]byte(nil), payload...),
+		checksum: crc32.ChecksumIEEE(payload)}
+	n := fragmentLen(len(payload), maxFragmentLen)
+	for start := 0; start < len(payload); start += n {
+		fragment := make([]byte, n)
+		copy(fragment, payload[start:])
+		e.fragments = append(e.fragments, fragment)
+	}
+	return e, nil
+}
+
+// SeqLen returns the number of fragments of the payload.
+func (e *Encoder) SeqLen() int {
+	return len(e.fragments)
+}
+
+// IsSinglePart returns whether the payload is encoded in a single part.
+func (e *Encoder) IsSinglePart() bool {
+	return len(e.fragments) == 1
+}
+
+// NextPart returns the next part of the payload: the single part UR for
+// payloads of one fragment, and otherwise the part of the next sequence
+// number, from 1.  The first SeqLen parts carry each fragment, and the next
+// ones mixes of fragments, for as long as the decoder needs.
+func (e *Encoder) NextPart() string {
+	if e.IsSinglePart() {
+		return "ur:" + e.typeString + "/" + encodeBytewords(e.payload)
+	}
+	e.seqNum++
+	p := &part{seqNum: e.seqNum, seqLen: len(e.fragments), messageLen: len(e.payload), checksum: e.checksum,
+		data: make([]byte, len(e.fragments[0]))}
+	for _, i := range chooseFragments(p.seqNum, p.seqLen, p.checksum) {
+		xorInto(p.data, e.fragments[i])
+	}
+	return fmt.Sprintf("ur:%s/%d-%d/%s", e.typeString, p.seqNum, p.seqLen, encodeBytewords(p.encode()))
+}
+
+// xorInto XORs src into dst.
+func xorInto(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// mixedPart is a mix of fragments received, keyed by the sorted indexes of
+// its fragments.
+type mixedPart struct {
+	indexes []int
+	data    []byte
+}
+
+// Decoder reconstructs a payload from its parts, received in any order.
+type Decoder struct {
+	typeString string
+	seqLen     int
+	messageLen int
+	checksum   uint32
+
+	fragments [][]byte
+	recovered int
+	mixed     map[string]*mixedPart
+	payload   []byte
+	err       error
+}
+
+// NewDecoder returns a decoder waiting for its first part.
+func NewDecoder() *Decoder {
+	return &Decoder{mixed: make(map[string]*mixedPart)}
+}
+
+// parseUR splits the UR s into its lowercase type, its sequence number and
+// length, zeros for single part URs, and its Bytewords.
+func parseUR(s string) (string, uint32, int, string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if !strings.HasPrefix(s, "ur:") {
+		return "", 0, 0, "", fmt.Errorf("%w: no ur: scheme", ErrInvalidUR)
+	}
+	components := strings.Split(s[len("ur:"):], "/")
+	if err := checkType(components[0]); err != nil {
+		return "", 0, 0, "", err
+	}
+	switch len(components) {
+	case 2:
+		return components[0], 0, 0, components[1], nil
+	case 3:
+		seq := strings.SplitN(components[1], "-", 2)
+		if len(seq) == 2 {
+			seqNum, err1 := strconv.ParseUint(seq[0], 10, 32)
+			seqLen, err2 := strconv.ParseUint(seq[1], 10, 32)
+			if err1 == nil && err2 == nil && seqNum != 0 && seqLen != 0 {
+				return components[0], uint32(seqNum), int(seqLen), components[2], nil
+			}
+		}
+		return "", 0, 0, "", fmt.Errorf("%w: sequence %q", ErrInvalidUR, components[1])
+	}
+	return "", 0, 0, "", fmt.Errorf("%w: %d path components", ErrInvalidUR, len(components))
+}
+
+// Receive decodes the part s, a single part UR or a part of a multi-part UR
+// consistent with those received before.  Parts received once the payload is
+// complete are ignored.
+func (d *Decoder) Receive(s string) error {
+	if d.Complete() {
+		return nil
+	}
+	typeString, seqNum, seqLen, body, err := parseUR(s)
+	if err != nil {
+		return err
+	}
+	data, err := decodeBytewords(body)
+	if err != nil {
+		return err
+	}
+	if d.typeString != "" && typeString != d.typeString {
+		return fmt.Errorf("%w: type %s, want %s", ErrInconsistentPart, typeString, d.typeString)
+	}
+	if seqNum == 0 {
+		if d.seqLen != 0 {
+			return fmt.Errorf("%w: single part UR among the parts of a multi-part UR", ErrInconsistentPart)
+		}
+		d.typeString, d.payload = typeString, data
+		return nil
+	}
+
+	p, err := decodePart(data)
+	if err != nil {
+		return err
+	}
+	if p.seqNum != seqNum || p.seqLen != seqLen {
+		return fmt.Errorf("%w: part %d-%d labeled %d-%d", ErrInvalidUR, p.seqNum, p.seqLen, seqNum, seqLen)
+	}
+	if d.seqLen == 0 {
+		d.typeString, d.seqLen, d.messageLen, d.checksum = typeString, p.seqLen, p.messageLen, p.checksum
+		d.fragments = make([][]byte, p.seqLen)
+	} else if p.seqLen != d.seqLen || p.messageLen != d.messageLen || p.checksum != d.checksum ||
+		len(p.data) != d.fragmentLen() {
+		return fmt.Errorf("%w: part %d of %d of a %d byte payload with checksum %08x", ErrInconsistentPart,
+			p.seqNum, p.seqLen, p.messageLen, p.checksum)
+	}
+	d.add(&mixedPart{indexes: chooseFragments(p.seqNum, p.seqLen, p.checksum), data: p.data})
+	if d.recovered == d.seqLen {
+		d.join()
+	}
+	return nil
+}
+
+// fragmentLen returns the length of the fragments of the payload.
+func (d *Decoder) fragmentLen() int {
+	return (d.messageLen + d.seqLen - 1) / d.seqLen
+}
+
+// add adds the part m, reduced by the fragments recovered, and reduces the
+// mixed parts by the fragments it recovers until no more are.
+func (d *Decoder) add(m *mixedPart) {
+	queue := []*mixedPart{m}
+	for len(queue) != 0 {
+		m, queue = queue[0], queue[1:]
+		m = d.reduce(m)
+		switch len(m.indexes) {
+		case 0:
+			continue
+		case 1:
+			d.fragments[m.indexes[0]] = m.data
+			d.recovered++
+			// The mixes of the fragment may now reduce to one.
+			for key, other := range d.mixed {
+				if containsIndex(other.indexes, m.indexes[0]) {
+					delete(d.mixed, key)
+					queue = append(queue, other)
+				}
+			}
+		default:
+			key := fmt.Sprint(m.indexes)
+			if _, ok := d.mixed[key]; !ok {
+				d.mixed[key] = m
+			}
+		}
+	}
+}
+
+// reduce returns m without the fragments recovered, and with its indexes
+// sorted.
+func (d *Decoder) reduce(m *mixedPart) *mixedPart {
+	reduced := &mixedPart{data: append([]byte(nil), m.data...)}
+	for _, i := range m.indexes {
+		if d.fragments[i] != nil {
+			xorInto(reduced.data, d.fragments[i])
+			continue
+		}
+		reduced.indexes = append(reduced.indexes, i)
+	}
+	sortInts(reduced.indexes)
+	return reduced
+}
+
+// containsIndex returns whether indexes contains i.
+func containsIndex(indexes []int, i int) bool {
+	for _, j := range indexes {
+		if j == i {
+			return true
+		}
+	}
+	return false
+}
+
+// sortInts sorts the few indexes of a part.
+func sortInts(a []int) {
+	for i := 1; i < len(a); i++ {
+		for j := i; j > 0 && a[j] < a[j-1]; j-- {
+			a[j], a[j-1] = a[j-1], a[j]
+		}
+	}
+}
+
+// join joins the fragments recovered into the payload, checking its CRC-32.
+func (d *Decoder) join() {
+	payload := make([]byte, 0, d.seqLen*d.fragmentLen())
+	for _, fragment := range d.fragments {
+		payload = append(payload, fragment...)
+	}
+	payload = payload[:d.messageLen]
+	if crc32.ChecksumIEEE(payload) != d.checksum {
+		d.err = fmt.Errorf("%w: payload", ErrChecksum)
+		return
+	}
+	d.payload = payload
+	d.mixed = nil
+}
+
+// Complete returns whether the payload is reconstructed, or failed to be.
+func (d *Decoder) Complete() bool {
+	return d.payload != nil || d.err != nil
+}
+
+// Progress returns the percentage of the fragments of the payload recovered,
+// 100 once it is complete.  Mixed parts not reduced yet are not counted,
+// although they may recover several fragments at once.
+func (d *Decoder) Progress() float64 {
+	switch {
+	case d.Complete():
+		return 100
+	case d.seqLen == 0:
+		return 0
+	}
+	return 100 * float64(d.recovered) / float64(d.seqLen)
+}
+
+// Result returns the type and payload of the UR once Complete, or the
+// ErrChecksum error if the payload reconstructed does not match its checksum.
+func (d *Decoder) Result() (string, []byte, error) {
+	if !d.Complete() {
+		return "", nil, fmt.Errorf("%w: %d of %d fragments recovered", ErrInvalidUR, d.recovered, d.seqLen)
+	}
+	if d.err != nil {
+		return "", nil, d.err
+	}
+	return d.typeString, d.payload, nil
+}
@@ -0,0 +1,174 @@
+package ur
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bytesUR returns the CBOR encoding of the byte string b, the payload of a UR
+// of type bytes.
+func bytesUR(b []byte) []byte {
+	return append(cborHead(nil, 2, uint64(len(b))), b...)
+}
+
+func TestEncodeUR(t *testing.T) {
+	// The vectors of the reference implementation.
+	e, err := EncodeUR("bytes", bytesUR(makeMessage(50, "Wolf")), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ur:bytes/hdeymejtswhhylkepmykhhtsytsnoyoyaxaedsuttydmmhhpktpmsrjtgwdpfnsboxgwlbaawzuefywkdplrsrjyn" +
+		"bvygabwjldapfcsdwkbrkch"
+	if !e.IsSinglePart() || e.NextPart() != want || e.NextPart() != want {
+		t.Errorf("got single part %s", e.NextPart())
+	}
+
+	e, err = EncodeUR("bytes", bytesUR(makeMessage(256, "Wolf")), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantParts := []string{
+		"ur:bytes/1-9/lpadascfadaxcywenbpljkhdcahkadaemejtswhhylkepmykhhtsytsnoyoyaxaedsuttydmmhhpktpmsrjtdkgslpgh",
+		"ur:bytes/2-9/lpaoascfadaxcywenbpljkhdcagwdpfnsboxgwlbaawzuefywkdplrsrjynbvygabwjldapfcsgmghhkhstlrdcxaefz",
+		"ur:bytes/3-9/lpaxascfadaxcywenbpljkhdcahelbknlkuejnbadmssfhfrdpsbiegecpasvssovlgeykssjykklronvsjksopdzmol",
+	}
+	if e.SeqLen() != 9 {
+		t.Errorf("got %d fragments", e.SeqLen())
+	}
+	for i, w := range wantParts {
+		if got := e.NextPart(); got != w {
+			t.Errorf("part %d: got %s, want %s", i+1, got, w)
+		}
+	}
+
+	if _, err := EncodeUR("Bytes", []byte{1}, 100); !errors.Is(err, ErrInvalidUR) {
+		t.Errorf("got %v for an uppercase type", err)
+	}
+	if _, err := EncodeUR("bytes", nil, 100); !errors.Is(err, ErrInvalidUR) {
+		t.Errorf("got %v for an empty payload", err)
+	}
+	if _, err := EncodeUR("bytes", []byte{1}, 5); !errors.Is(err, ErrInvalidUR) {
+		t.Errorf("got %v for fragments of 5 bytes", err)
+	}
+}
+
+// TestEncodeURMultipart checks the parts of the multi-part vector of the
+// reference implementation, the UR of type bytes of makeMessage(256, "Wolf")
+// in fragments of at most 30 bytes, saved one per line in
+// testdata/multipart.txt, simple and mixed ones.  The encoder must produce
+// them in order, and the decoder recover the message from them, mixed ones
+// first.
+func TestEncodeURMultipart(t *testing.T) {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", "multipart.txt"))
+	if err != nil {
+		t.Skip("no multi-part vector in testdata/multipart.txt")
+	}
+	payload := bytesUR(makeMessage(256, "Wolf"))
+	e, err := EncodeUR("bytes", payload, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Fields(string(raw))
+	for i, w := range want {
+		if got := e.NextPart(); got != w {
+			t.Errorf("part %d: got %s, want %s", i+1, got, w)
+		}
+	}
+	if len(want) <= e.SeqLen() {
+		t.Fatalf("%d parts, no mixed one", len(want))
+	}
+	d := NewDecoder()
+	for _, p := range append(want[e.SeqLen():], want[:e.SeqLen()]...) {
+		if err := d.Receive(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, decoded, err := d.Result(); err != nil || !bytes.Equal(decoded, payload) {
+		t.Errorf("got %x, %v", decoded, err)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	payload := bytesUR(makeMessage(1000, "Round trip"))
+	e, err := EncodeUR("crypto-psbt", payload, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make([]string, 60)
+	for i := range parts {
+		parts[i] = e.NextPart()
+	}
+
+	// Parts out of order and repeated, scanned in uppercase, and missing
+	// most simple parts so that mixed parts recover their fragments.
+	d := NewDecoder()
+	order := []string{parts[40], parts[3], parts[40], strings.ToUpper(parts[25])}
+	order = append(order, parts[30:]...)
+	order = append(order, parts[:e.SeqLen()]...)
+	progress := 0.0
+	for _, p := range order {
+		if err := d.Receive(p); err != nil {
+			t.Fatal(err)
+		}
+		if d.Progress() < progress {
+			t.Fatalf("progress went from %v to %v", progress, d.Progress())
+		}
+		progress = d.Progress()
+		if d.Complete() {
+			break
+		}
+	}
+	typeString, decoded, err := d.Result()
+	if err != nil || typeString != "crypto-psbt" || !bytes.Equal(decoded, payload) {
+		t.Fatalf("got %s, %x, %v", typeString, decoded, err)
+	}
+	if d.Progress() != 100 {
+		t.Errorf("got progress %v", d.Progress())
+	}
+
+	// All mixed parts can do.
+	d = NewDecoder()
+	for _, p := range parts[e.SeqLen():] {
+		d.Receive(p)
+	}
+	if _, decoded, err := d.Result(); err != nil || !bytes.Equal(decoded, payload) {
+		t.Errorf("mixed parts only: got %v", err)
+	}
+
+	d = NewDecoder()
+	if _, _, err := d.Result(); !errors.Is(err, ErrInvalidUR) || d.Progress() != 0 {
+		t.Errorf("got %v before any part", err)
+	}
+	d.Receive(parts[0])
+	other, _ := EncodeUR("crypto-psbt", bytesUR(makeMessage(1000, "Other")), 100)
+	if err := d.Receive(other.NextPart()); !errors.Is(err, ErrInconsistentPart) {
+		t.Errorf("got %v, want ErrInconsistentPart", err)
+	}
+	renamed := strings.Replace(parts[1], "crypto-psbt", "bytes", 1)
+	if err := d.Receive(renamed); !errors.Is(err, ErrInconsistentPart) {
+		t.Errorf("got %v, want ErrInconsistentPart", err)
+	}
+	relabeled := strings.Replace(parts[1], "/2-", "/3-", 1)
+	if err := d.Receive(relabeled); !errors.Is(err, ErrInvalidUR) {
+		t.Errorf("got %v, want ErrInvalidUR", err)
+	}
+	for _, s := range []string{"bytes/ab", "ur:bytes", "ur:bytes/0-9/ab", "ur:by_tes/ab", "ur:bytes/1-9/x/ab"} {
+		if err := d.Receive(s); !errors.Is(err, ErrInvalidUR) {
+			t.Errorf("%s: got %v, want ErrInvalidUR", s, err)
+		}
+	}
+
+	single, _ := EncodeUR("bytes", bytesUR([]byte("short")), 100)
+	d = NewDecoder()
+	if err := d.Receive(single.NextPart()); err != nil || !d.Complete() {
+		t.Fatalf("single part: %v", err)
+	}
+	if typeString, decoded, err := d.Result(); err != nil || typeString != "bytes" ||
+		!bytes.Equal(decoded, bytesUR([]byte("short"))) {
+		t.Errorf("got %s, %x, %v", typeString, decoded, err)
+	}
+}
@@ -0,0 +1,113 @@
+package bchutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// UTXO is an unspent transaction output.
+type UTXO struct {
+	OutPoint wire.OutPoint
+	Amount   btcutil.Amount
+	PkScript []byte
+
+	// TokenData is the serialized CashTokens prefix of the output, if any.
+	TokenData []byte
+
+	// Coinbase is set for the outputs of coinbase transactions, and
+	// Confirmations is the number of blocks confirming the output, 0 while
+	// it is unconfirmed.
+	Coinbase      bool
+	Confirmations int
+
+	// Height is the height of the block confirming the output, 0 while it
+	// is unconfirmed or unknown.  With the height of the chain tip, it
+	// gives the confirmations of the output however old Confirmations is.
+	Height int32
+
+	// MedianTime is the median time past of the block preceding the one
+	// confirming the output, from which its time-based relative lock
+	// times count.
+	MedianTime time.Time
+}
+
+// CoinbaseMaturity is the number of confirmations of the outputs of coinbase
+// transactions before they can be spent.
+const CoinbaseMaturity = 100
+
+// TxOut returns the output as a wire.TxOut, whose script starts with the token
+// prefix if any.
+func (u *UTXO) TxOut() *wire.TxOut {
+	if !u.HasTokens() {
+		return wire.NewTxOut(int64(u.Amount), u.PkScript)
+	}
+	pkScript := append(append([]byte(nil), u.TokenData...), u.PkScript...)
+	return wire.NewTxOut(int64(u.Amount), pkScript)
+}
+
+// HasTokens returns whether the output carries CashTokens, which are burned
+// by transactions that are not token-aware.
+func (u *UTXO) HasTokens() bool {
+	return len(u.TokenData) != 0
+}
+
+// IsImmature returns whether the output is the output of a coinbase
+// transaction that can't be spent yet.
+func (u *UTXO) IsImmature() bool {
+	return u.Coinbase && u.Confirmations < CoinbaseMaturity
+}
+
+// SpendPolicy selects the outputs that can be spent.  The zero SpendPolicy
+// spends unconfirmed outputs and coinbase outputs with CoinbaseMaturity
+// confirmations, counted by the Confirmations field of outputs.
+type SpendPolicy struct {
+	// TipHeight is the height of the chain tip, from which the
+	// confirmations of the outputs with a Height are counted when
+	// positive.
+	TipHeight int32
+
+	// ExcludeUnconfirmed leaves the outputs without confirmation unspent.
+	ExcludeUnconfirmed bool
+
+	// SpendImmature spends coinbase outputs before they mature, for
+	// transactions held until then.
+	SpendImmature bool
+}
+
+// confirmations returns the number of confirmations of u.
+func (p SpendPolicy) confirmations(u *UTXO) int {
+	if p.TipHeight <= 0 || u.Height <= 0 {
+		return u.Confirmations
+	}
+	if u.Height > p.TipHeight {
+		return 0
+	}
+	return int(p.TipHeight-u.Height) + 1
+}
+
+// IsSpendable returns whether the policy spends u in a transaction for the
+// block after the tip.  Coinbase outputs mature with CoinbaseMaturity
+// confirmations, when their transaction is CoinbaseMaturity blocks deep.
+func (p SpendPolicy) IsSpendable(u UTXO) bool {
+	confirmations := p.confirmations(&u)
+	if confirmations == 0 && p.ExcludeUnconfirmed {
+		return false
+	}
+	return !u.Coinbase || p.SpendImmature || confirmations >= CoinbaseMaturity
+}
+
+// IsSpendable returns whether utxo can be spent in a transaction for the block
+// after the tip at tipHeight, under the zero SpendPolicy.
+func IsSpendable(utxo UTXO, tipHeight int32) bool {
+	return SpendPolicy{TipHeight: tipHeight}.IsSpendable(utxo)
+}
+
+// UTXOSource provides the unspent outputs funding new transactions.  Any
+// HistorySource is a UTXOSource.
+type UTXOSource interface {
+	// UTXOs returns the unspent outputs paying to any of pkScripts.
+	UTXOs(ctx context.Context, pkScripts [][]byte) ([]UTXO, error)
+}
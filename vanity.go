@@ -0,0 +1,227 @@
+package bchutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// vanityBatch is the number of keys a worker tries between two checks
+	// of the context and two progress reports.
+	vanityBatch = 1024
+
+	// maxVanityLen is the number of characters of a P2PKH CashAddr payload
+	// which only depend on the version byte and the hash.  The last payload
+	// character is partly padding and the checksum can't be searched for.
+	maxVanityLen = 33
+)
+
+// ErrInvalidVanityPrefix describes an error where a vanity prefix can never
+// be matched by a pay-to-pubkey-hash CashAddr.
+var ErrInvalidVanityPrefix = errors.New("invalid vanity prefix")
+
+// parseVanityPrefix validates a vanity prefix and returns the 5-bit values
+// the address payload must start with.  The prefix is case insensitive and
+// may include the network prefix of params.
+//
+// The first character of a P2PKH address encodes the top 5 bits of the
+// version byte and is always 'q'.  The second one encodes the last 3 bits of
+// the version byte, which are zero as well, followed by the top 2 bits of the
+// hash, so only the characters with a value below 4 (q, p, z and r) can
+// appear there.
+func parseVanityPrefix(prefix string, params *chaincfg.Params) ([]byte, error) {
+	prefix = strings.ToLower(prefix)
+	if netPrefix, ok := Prefixes[params.Name]; ok {
+		prefix = strings.TrimPrefix(prefix, netPrefix+":")
+	}
+	if len(prefix) == 0 {
+		return nil, fmt.Errorf("%w: empty prefix", ErrInvalidVanityPrefix)
+	}
+	if len(prefix) > maxVanityLen {
+		return nil, fmt.Errorf("%w: prefix longer than %d characters",
+			ErrInvalidVanityPrefix, maxVanityLen)
+	}
+
+	values := make([]byte, len(prefix))
+	for i := 0; i < len(prefix); i++ {
+		c := prefix[i]
+		if c > 127 || CHARSET_REV[c] == -1 {
+			return nil, fmt.Errorf("%w: character %q is not in the CashAddr alphabet",
+				ErrInvalidVanityPrefix, c)
+		}
+		values[i] = byte(CHARSET_REV[c])
+	}
+	if values[0] != 0 {
+		return nil, fmt.Errorf("%w: pay-to-pubkey-hash addresses start with 'q'",
+			ErrInvalidVanityPrefix)
+	}
+	if len(values) > 1 && values[1] > 3 {
+		return nil, fmt.Errorf("%w: the second character must be one of q, p, z or r",
+			ErrInvalidVanityPrefix)
+	}
+	return values, nil
+}
+
+// VanityDifficulty returns the expected number of keys to try before finding
+// an address starting with prefix.  The search time can be estimated by
+// dividing it by the attempt rate reported by SearchVanity.
+func VanityDifficulty(prefix string, params *chaincfg.Params) (float64, error) {
+	values, err := parseVanityPrefix(prefix, params)
+	if err != nil {
+		return 0, err
+	}
+	switch len(values) {
+	case 1:
+		return 1, nil
+	default:
+		return 4 * math.Pow(32, float64(len(values)-2)), nil
+	}
+}
+
+// matchVanity returns whether the P2PKH payload of hash160 starts with the
+// passed 5-bit values.
+func matchVanity(hash160 []byte, values []byte) bool {
+	// The version byte is all zeroes, so the payload bits are 8 zero bits
+	// followed by the hash bits.
+	for i, want := range values {
+		bit := i*5 - 8
+		var v byte
+		for j := 0; j < 5; j++ {
+			v <<= 1
+			if b := bit + j; b >= 0 && hash160[b/8]&(0x80>>uint(b%8)) != 0 {
+				v |= 1
+			}
+		}
+		if v != want {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchVanity searches for a key whose pay-to-pubkey-hash CashAddr on
+// params starts with prefix, ignoring case.  The search runs on workers
+// goroutines, or one per CPU if workers is not positive, until a key is
+// found or ctx is done.
+//
+// progress, when not nil, is called with the total number of keys tried so
+// far as the search goes.  It is called from the worker goroutines and must
+// be safe for concurrent use.
+//
+// Each worker starts from a random key and walks consecutive keys, which is
+// much cheaper than drawing a new random key for every attempt.
+func SearchVanity(ctx context.Context, prefix string, params *chaincfg.Params, workers int,
+	progress func(attempts uint64)) (*btcec.PrivateKey, btcutil.Address, error) {
+
+	values, err := parseVanityPrefix(prefix, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := Prefixes[params.Name]; !ok {
+		return nil, nil, errors.New("unknown network parameters")
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		attempts uint64
+		once     sync.Once
+		found    *btcec.PrivateKey
+		wg       sync.WaitGroup
+		errs     = make(chan error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, err := vanityWorker(ctx, values, &attempts, progress)
+			if err != nil {
+				errs <- err
+				cancel()
+				return
+			}
+			if key != nil {
+				once.Do(func() {
+					found = key
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if found == nil {
+		select {
+		case err := <-errs:
+			return nil, nil, err
+		default:
+		}
+		return nil, nil, ctx.Err()
+	}
+	addr, err := NewCashAddressPubKeyHash(btcutil.Hash160(found.PubKey().SerializeCompressed()), params)
+	if err != nil {
+		return nil, nil, err
+	}
+	return found, addr, nil
+}
+
+// vanityWorker walks keys from a random starting point until one matches
+// values or ctx is done.
+func vanityWorker(ctx context.Context, values []byte, attempts *uint64,
+	progress func(uint64)) (*btcec.PrivateKey, error) {
+
+	curve := btcec.S256()
+	start, err := btcec.NewPrivateKey(curve)
+	if err != nil {
+		return nil, err
+	}
+	d := new(big.Int).Set(start.D)
+	x, y := start.PubKey().X, start.PubKey().Y
+	pub := &btcec.PublicKey{Curve: curve}
+
+	for {
+		for i := 0; i < vanityBatch; i++ {
+			pub.X, pub.Y = x, y
+			if matchVanity(btcutil.Hash160(pub.SerializeCompressed()), values) {
+				total := atomic.AddUint64(attempts, uint64(i+1))
+				if progress != nil {
+					progress(total)
+				}
+				key, _ := btcec.PrivKeyFromBytes(curve, d.Bytes())
+				return key, nil
+			}
+			x, y = curve.Add(x, y, curve.Gx, curve.Gy)
+			d.Add(d, big.NewInt(1))
+			if d.Cmp(curve.N) >= 0 {
+				// Restart from a fresh key, the walk wrapped
+				// around the group order.
+				return vanityWorker(ctx, values, attempts, progress)
+			}
+		}
+
+		total := atomic.AddUint64(attempts, vanityBatch)
+		if progress != nil {
+			progress(total)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		default:
+		}
+	}
+}
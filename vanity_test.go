@@ -0,0 +1,87 @@
+package bchutil
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestSearchVanity(t *testing.T) {
+	var reported uint64
+	key, addr, err := SearchVanity(context.Background(), "bitcoincash:QQPZ", &chaincfg.MainNetParams, 2,
+		func(attempts uint64) { atomic.StoreUint64(&reported, attempts) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(addr.String(), "qqpz") {
+		t.Errorf("address %s does not match the prefix", addr)
+	}
+	want, _ := NewCashAddressPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()), &chaincfg.MainNetParams)
+	if want.String() != addr.String() {
+		t.Error("returned key does not match the address")
+	}
+	if atomic.LoadUint64(&reported) == 0 {
+		t.Error("no progress reported")
+	}
+}
+
+func TestSearchVanityCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var reported uint64
+	_, _, err := SearchVanity(ctx, "qqqqqqqqqqqqqqqqqqqqqq", &chaincfg.MainNetParams, 2,
+		func(attempts uint64) { atomic.StoreUint64(&reported, attempts) })
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if atomic.LoadUint64(&reported) == 0 {
+		t.Error("no progress reported")
+	}
+}
+
+func TestVanityPrefix(t *testing.T) {
+	// 'o' is not part of the alphabet, so "qqshop" can't be found.
+	invalid := []string{"", "p", "qb", "qx", "q1", "qqshop", "bchtest:qq", strings.Repeat("q", 34)}
+	for _, prefix := range invalid {
+		if _, err := VanityDifficulty(prefix, &chaincfg.MainNetParams); !errors.Is(err, ErrInvalidVanityPrefix) {
+			t.Errorf("prefix %q: expected ErrInvalidVanityPrefix, got %v", prefix, err)
+		}
+	}
+
+	difficulties := map[string]float64{
+		"q":                  1,
+		"qr":                 4,
+		"QQSH0P":             4 * 32 * 32 * 32 * 32,
+		"bitcoincash:qqsh0p": 4 * 32 * 32 * 32 * 32,
+	}
+	for prefix, want := range difficulties {
+		got, err := VanityDifficulty(prefix, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Errorf("prefix %q: %v", prefix, err)
+		}
+		if got != want {
+			t.Errorf("prefix %q: difficulty %v, want %v", prefix, got, want)
+		}
+	}
+}
+
+func TestMatchVanity(t *testing.T) {
+	// qr95sy3j9xwd2ap32xkykttr4cvcu7as4y0qverfuy
+	values, err := parseVanityPrefix("qr95sy3j9xwd2ap32xkykttr4cvcu7as4", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matchVanity(dataElement, values) {
+		t.Error("known address does not match its own prefix")
+	}
+	values, _ = parseVanityPrefix("qr95sy3j9xwd2ap32xkykttr4cvcu7asq", &chaincfg.MainNetParams)
+	if matchVanity(dataElement, values) {
+		t.Error("address matched a different prefix")
+	}
+}
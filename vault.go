@@ -0,0 +1,310 @@
+package bchutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// ErrInvalidVaultSpend describes an error where a vault transaction spends
+// outputs that are not those of the stage of the vault it is built for.
+var ErrInvalidVaultSpend = errors.New("invalid vault spend")
+
+// VaultPath is a spend path of the scripts of a Vault.
+type VaultPath int
+
+const (
+	// VaultUnvault spends deposits of the vault with the hot key into its
+	// delayed unvault script.
+	VaultUnvault VaultPath = iota
+
+	// VaultWithdrawal spends unvault outputs with the hot key once their
+	// delay has passed.
+	VaultWithdrawal
+
+	// VaultClawback spends deposits or unvault outputs with the cold key at
+	// any time.
+	VaultClawback
+)
+
+// String returns the name of the path.
+func (p VaultPath) String() string {
+	switch p {
+	case VaultUnvault:
+		return "unvault"
+	case VaultWithdrawal:
+		return "withdrawal"
+	case VaultClawback:
+		return "clawback"
+	}
+	return fmt.Sprintf("VaultPath(%d)", int(p))
+}
+
+// vaultScript returns the script paying to the hot key, after delay unless
+// zero, or the cold key at any time:
+//
+//	OP_IF [<delay> OP_CHECKSEQUENCEVERIFY OP_DROP] <hot> OP_ELSE <cold> OP_ENDIF OP_CHECKSIG
+func vaultScript(hotPub, coldPub *btcec.PublicKey, delay RelativeLockTime) ([]byte, error) {
+	if hotPub == nil || coldPub == nil {
+		return nil, errors.New("no hot or cold public key")
+	}
+	hot, cold := hotPub.SerializeCompressed(), coldPub.SerializeCompressed()
+	if bytes.Equal(hot, cold) {
+		return nil, errors.New("hot and cold public keys are the same")
+	}
+	b := NewScriptBuilder().AddOp(txscript.OP_IF)
+	if delay != 0 {
+		b.AddInt64(int64(delay)).AddOps([]byte{txscript.OP_CHECKSEQUENCEVERIFY, txscript.OP_DROP})
+	}
+	return b.AddData(hot).AddOp(txscript.OP_ELSE).AddData(cold).AddOps([]byte{txscript.OP_ENDIF,
+		txscript.OP_CHECKSIG}).Script()
+}
+
+// CreateVaultScript returns the unvault redeem script of a vault: the hot key
+// spends its outputs once delay has passed since they confirmed, so that the
+// cold key can claw the funds back in the meantime.
+//
+//	OP_IF <delay> OP_CHECKSEQUENCEVERIFY OP_DROP <hot> OP_ELSE <cold> OP_ENDIF OP_CHECKSIG
+//
+// The delay must be a positive relative lock time, of NewRelativeLockTime.
+func CreateVaultScript(hotPub, coldPub *btcec.PublicKey, delay RelativeLockTime) ([]byte, error) {
+	if delay.Sequence()&^(wire.SequenceLockTimeIsSeconds|wire.SequenceLockTimeMask) != 0 ||
+		delay.Sequence()&wire.SequenceLockTimeMask == 0 {
+		return nil, fmt.Errorf("invalid vault delay %#x", delay.Sequence())
+	}
+	return vaultScript(hotPub, coldPub, delay)
+}
+
+// Vault is a hot and cold key custody of two stages, behind
+// pay-to-script-hash addresses.  Deposits are spent by the hot key into
+// unvault outputs, whose script of CreateVaultScript lets the hot key
+// withdraw them after a delay, during which the cold key claws them back.  The
+// cold key also spends the deposits at any time.
+//
+// Without introspection in the scripts, consensus does not restrict the hot
+// key spends of the deposits to unvault outputs: the vault delays the
+// withdrawals of the wallets spending them with BuildUnvault, and watchtowers
+// claw back the unvault outputs their owner did not initiate.
+type Vault struct {
+	hotPub, coldPub []byte
+	delay           RelativeLockTime
+
+	// depositScript and unvaultScript are the redeem scripts of the two
+	// stages.
+	depositScript   []byte
+	depositPkScript []byte
+	depositAddress  btcutil.Address
+	unvaultScript   []byte
+	unvaultPkScript []byte
+	unvaultAddress  btcutil.Address
+}
+
+// NewVault returns the vault of the hot and cold public keys whose
+// withdrawals wait for delay, with addresses of params.
+func NewVault(hotPub, coldPub *btcec.PublicKey, delay RelativeLockTime, params *chaincfg.Params) (*Vault, error) {
+	unvaultScript, err := CreateVaultScript(hotPub, coldPub, delay)
+	if err != nil {
+		return nil, err
+	}
+	v := &Vault{hotPub: hotPub.SerializeCompressed(), coldPub: coldPub.SerializeCompressed(), delay: delay,
+		unvaultScript: unvaultScript}
+	if v.depositScript, err = vaultScript(hotPub, coldPub, 0); err != nil {
+		return nil, err
+	}
+	if v.depositAddress, err = NewCashAddressScriptHash(v.depositScript, params); err != nil {
+		return nil, err
+	}
+	if v.unvaultAddress, err = NewCashAddressScriptHash(v.unvaultScript, params); err != nil {
+		return nil, err
+	}
+	if v.depositPkScript, err = PayToAddrScript(v.depositAddress); err != nil {
+		return nil, err
+	}
+	if v.unvaultPkScript, err = PayToAddrScript(v.unvaultAddress); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// DepositAddress returns the address funding the vault.
+func (v *Vault) DepositAddress() btcutil.Address {
+	return v.depositAddress
+}
+
+// DepositScript returns the redeem script of the deposits, spent by the hot
+// or the cold key at any time.
+func (v *Vault) DepositScript() []byte {
+	return v.depositScript
+}
+
+// UnvaultAddress returns the address of the unvault outputs.
+func (v *Vault) UnvaultAddress() btcutil.Address {
+	return v.unvaultAddress
+}
+
+// UnvaultScript returns the redeem script of the unvault outputs, of
+// CreateVaultScript.
+func (v *Vault) UnvaultScript() []byte {
+	return v.unvaultScript
+}
+
+// Delay returns the relative lock time of the withdrawals.
+func (v *Vault) Delay() RelativeLockTime {
+	return v.delay
+}
+
+// BuildUnvault returns the transaction moving utxos, deposits of the vault,
+// to a single unvault output, less the fee at feeRate, to be signed with the
+// hot key.
+func (v *Vault) BuildUnvault(utxos []UTXO, feeRate FeeRate) (*VaultTx, error) {
+	return v.build(VaultUnvault, utxos, v.unvaultPkScript, feeRate)
+}
+
+// BuildWithdrawal returns the transaction paying utxos, unvault outputs of
+// the vault, to dest, less the fee at feeRate, to be signed with the hot
+// key.  Its inputs are locked by the delay of the vault, so that it is final
+// once the delay has passed since the unvault outputs confirmed.
+func (v *Vault) BuildWithdrawal(utxos []UTXO, dest btcutil.Address, feeRate FeeRate) (*VaultTx, error) {
+	pkScript, err := PayToAddrScript(dest)
+	if err != nil {
+		return nil, err
+	}
+	return v.build(VaultWithdrawal, utxos, pkScript, feeRate)
+}
+
+// BuildClawback returns the transaction paying utxos, deposits or unvault
+// outputs of the vault, to dest, less the fee at feeRate, to be signed with
+// the cold key.
+func (v *Vault) BuildClawback(utxos []UTXO, dest btcutil.Address, feeRate FeeRate) (*VaultTx, error) {
+	pkScript, err := PayToAddrScript(dest)
+	if err != nil {
+		return nil, err
+	}
+	return v.build(VaultClawback, utxos, pkScript, feeRate)
+}
+
+// redeemScript returns the redeem script of the outputs of pkScript spent by
+// path, or nil if path does not spend them.
+func (v *Vault) redeemScript(path VaultPath, pkScript []byte) []byte {
+	deposit, unvault := bytes.Equal(pkScript, v.depositPkScript), bytes.Equal(pkScript, v.unvaultPkScript)
+	switch {
+	case deposit && path != VaultWithdrawal:
+		return v.depositScript
+	case unvault && path != VaultUnvault:
+		return v.unvaultScript
+	}
+	return nil
+}
+
+// vaultScriptSigSize returns the size of the scriptSig of an input spending
+// redeemScript: an ECDSA signature, the selector of the branch and the redeem
+// script.
+func vaultScriptSigSize(redeemScript []byte) int {
+	return maxSigPushSize + 1 + dataPushLen(len(redeemScript))
+}
+
+// build returns the vault transaction of path paying utxos to pkScript.
+func (v *Vault) build(path VaultPath, utxos []UTXO, pkScript []byte, feeRate FeeRate) (*VaultTx, error) {
+	if len(utxos) == 0 {
+		return nil, fmt.Errorf("%w: no output to spend", ErrInsufficientFunds)
+	}
+	tx := wire.NewMsgTx(2)
+	var total btcutil.Amount
+	for i := range utxos {
+		u := &utxos[i]
+		redeemScript := v.redeemScript(path, u.PkScript)
+		switch {
+		case redeemScript == nil:
+			return nil, fmt.Errorf("%w: output %v is not spent by the %v path", ErrInvalidVaultSpend, u.OutPoint,
+				path)
+		case u.HasTokens():
+			return nil, fmt.Errorf("%w: output %v carries tokens", ErrInvalidVaultSpend, u.OutPoint)
+		}
+		txIn := wire.NewTxIn(&u.OutPoint, nil, nil)
+		if path == VaultWithdrawal {
+			txIn.Sequence = v.delay.Sequence()
+		}
+		// The scriptSig of the estimated size is cleared once the fee is
+		// computed.
+		txIn.SignatureScript = make([]byte, vaultScriptSigSize(redeemScript))
+		tx.AddTxIn(txIn)
+		var err error
+		if total, err = AddChecked(total, u.Amount); err != nil {
+			return nil, err
+		}
+	}
+	txOut := wire.NewTxOut(0, pkScript)
+	tx.AddTxOut(txOut)
+	fee := feeRate.Fee(tx.SerializeSize())
+	for _, txIn := range tx.TxIn {
+		txIn.SignatureScript = nil
+	}
+	txOut.Value = int64(total - fee)
+	if IsDust(txOut) {
+		return nil, fmt.Errorf("%w: %v in the vault, fee of %v", ErrInsufficientFunds, total, fee)
+	}
+	return &VaultTx{Tx: tx, Inputs: utxos, Fee: fee, Path: path, vault: v}, nil
+}
+
+// VaultTx is a transaction of a Vault spending its outputs by one of its
+// paths.
+type VaultTx struct {
+	Tx *wire.MsgTx
+
+	// Inputs are the outputs spent by the inputs of Tx, in order, Fee the
+	// fee Tx pays, and Path the path of the vault spending them.
+	Inputs []UTXO
+	Fee    btcutil.Amount
+	Path   VaultPath
+
+	vault *Vault
+}
+
+// Sign signs every input of the transaction with key, the hot key for the
+// unvault and withdrawal paths and the cold key for the clawback path, and
+// sets their scriptSigs.  The options are those of SignInput and
+// WithFeeLimits; the sighash type is SigHashAllForkID over the redeem script
+// of each input.
+func (t *VaultTx) Sign(key *btcec.PrivateKey, opts ...SignOption) error {
+	want, selector := t.vault.hotPub, int64(1)
+	if t.Path == VaultClawback {
+		want, selector = t.vault.coldPub, 0
+	}
+	if !bytes.Equal(key.PubKey().SerializeCompressed(), want) {
+		return fmt.Errorf("%w: key is not the key of the %v path", ErrKeyNotInScript, t.Path)
+	}
+	prevOuts := make(map[int]*wire.TxOut, len(t.Inputs))
+	for i := range t.Inputs {
+		prevOuts[i] = t.Inputs[i].TxOut()
+	}
+	o := newSignOptions(append([]SignOption{WithSigHashes(txscript.NewTxSigHashes(t.Tx))}, opts...))
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if err := o.checkFee(t.Tx, prevOuts); err != nil {
+		return err
+	}
+
+	scriptSigs := make([][]byte, len(t.Tx.TxIn))
+	for i := range t.Tx.TxIn {
+		redeemScript := t.vault.redeemScript(t.Path, t.Inputs[i].PkScript)
+		sig, err := o.signInput(t.Tx, i, redeemScript, SigHashAllForkID, key, int64(t.Inputs[i].Amount))
+		if err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+		if scriptSigs[i], err = NewScriptBuilder().AddData(sig).AddInt64(selector).AddData(
+			redeemScript).Script(); err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	for i, scriptSig := range scriptSigs {
+		t.Tx.TxIn[i].SignatureScript = scriptSig
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package bchutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// executeVaultTx runs the scripts of the inputs of vt.
+func executeVaultTx(vt *VaultTx) error {
+	for i, u := range vt.Inputs {
+		vm, err := NewEngine(u.PkScript, vt.Tx, i, StandardScriptFlags, nil, int64(u.Amount))
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestVault(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	hot, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte("vault hot key"))
+	cold, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte("vault cold key"))
+	delay, err := NewRelativeLockTime(144, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVault(hot.PubKey(), cold.PubKey(), delay, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, _ := btcutil.NewAddressPubKeyHash(make([]byte, 20), params)
+	depositScript, _ := PayToAddrScript(v.DepositAddress())
+	deposits := []UTXO{
+		{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, Amount: 1e6, PkScript: depositScript},
+		{OutPoint: wire.OutPoint{Hash: chainhash.Hash{2}}, Amount: 2e6, PkScript: depositScript},
+	}
+
+	unvault, err := v.BuildUnvault(deposits, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unvault.Sign(cold); !errors.Is(err, ErrKeyNotInScript) {
+		t.Errorf("unvault signed with the cold key: %v", err)
+	}
+	if err := unvault.Sign(hot); err != nil {
+		t.Fatal(err)
+	}
+	if err := executeVaultTx(unvault); err != nil {
+		t.Fatalf("unvault: %v", err)
+	}
+	if size := unvault.Tx.SerializeSize(); unvault.Fee < FeeRate(1000).Fee(size) {
+		t.Errorf("fee %v for %d bytes", unvault.Fee, size)
+	}
+	unvaultScript, _ := PayToAddrScript(v.UnvaultAddress())
+	unvaulted := []UTXO{{OutPoint: wire.OutPoint{Hash: unvault.Tx.TxHash()}, Amount: 3e6 - unvault.Fee,
+		PkScript: unvaultScript, Height: 1000}}
+
+	// The withdrawal waits for the delay, enforced by its sequence.
+	withdrawal, err := v.BuildWithdrawal(unvaulted, dest, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := withdrawal.Sign(hot); err != nil {
+		t.Fatal(err)
+	}
+	if err := executeVaultTx(withdrawal); err != nil {
+		t.Fatalf("withdrawal: %v", err)
+	}
+	prevOuts := []*UTXO{&unvaulted[0]}
+	mtp := time.Unix(1700000000, 0)
+	if err := CheckSequenceLocks(withdrawal.Tx, prevOuts, 1142, mtp); !errors.Is(err,
+		ErrUnsatisfiedLockTime) {
+		t.Errorf("withdrawal before the delay: %v", err)
+	}
+	if err := CheckSequenceLocks(withdrawal.Tx, prevOuts, 1143, mtp); err != nil {
+		t.Errorf("withdrawal after the delay: %v", err)
+	}
+	early := withdrawal.Tx.Copy()
+	early.TxIn[0].Sequence = 10
+	if err := executeVaultTx(&VaultTx{Tx: early, Inputs: unvaulted}); !errors.Is(err, ErrUnsatisfiedLockTime) {
+		t.Errorf("withdrawal of a shorter delay: %v", err)
+	}
+
+	// The cold key claws back unvault outputs and deposits alike.
+	clawback, err := v.BuildClawback(append(unvaulted, deposits[0]), dest, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clawback.Sign(cold); err != nil {
+		t.Fatal(err)
+	}
+	if err := executeVaultTx(clawback); err != nil {
+		t.Fatalf("clawback: %v", err)
+	}
+	if clawback.Tx.TxIn[0].Sequence != wire.MaxTxInSequenceNum {
+		t.Error("clawback waits for the delay")
+	}
+
+	if _, err := v.BuildWithdrawal(deposits, dest, 1000); !errors.Is(err, ErrInvalidVaultSpend) {
+		t.Errorf("withdrawal of deposits: %v", err)
+	}
+	if _, err := v.BuildUnvault(unvaulted, 1000); !errors.Is(err, ErrInvalidVaultSpend) {
+		t.Errorf("unvault of unvault outputs: %v", err)
+	}
+	if _, err := CreateVaultScript(hot.PubKey(), cold.PubKey(), 0); err == nil {
+		t.Error("vault without delay")
+	}
+	if _, err := CreateVaultScript(hot.PubKey(), hot.PubKey(), delay); err == nil {
+		t.Error("vault of the same hot and cold keys")
+	}
+}